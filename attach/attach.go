@@ -0,0 +1,257 @@
+// Package attach ingests the attachments of email messages into an FS.
+//
+// The attachments of a message parsed with net/mail are put into the FS with
+// names that are safe to store, and with their content type set as metadata,
+// for example,
+//
+//	msg, err := mail.ReadMessage(r)
+//
+//	if err != nil {
+//		return err
+//	}
+//
+//	sub, err := store.Sub(ticket.ID)
+//
+//	if err != nil {
+//		return err
+//	}
+//
+//	atts, err := attach.Put(sub, msg)
+package attach
+
+import (
+	"encoding/base64"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/andrewpillar/fs"
+)
+
+// maxNameLen is the maximum length in bytes of the name an attachment is
+// stored under.
+const maxNameLen = 255
+
+// Attachment is an attachment that was put into an FS.
+type Attachment struct {
+	// Name is the name the attachment was stored under.
+	Name string
+
+	// Filename is the name of the attachment as given in the message.
+	Filename string
+
+	ContentType string
+	Size        int64
+}
+
+type metadataFile struct {
+	fs.File
+
+	md fs.Metadata
+}
+
+func (f *metadataFile) Metadata() fs.Metadata { return f.md }
+
+type ingester struct {
+	fs    fs.FS
+	names map[string]struct{}
+	atts  []Attachment
+}
+
+// Put puts each attachment of the given message into the given FS, and returns
+// the attachments that were put. Parts of the message with a disposition of
+// attachment, or that have a filename, are treated as attachments, and nested
+// multipart parts are searched. The content type of each attachment is set as
+// metadata under fs.MetadataContentType, if the FS implements fs.MetadataFS.
+//
+// The filename of each attachment is sanitized before it is stored, any
+// directories are removed, along with control characters, and characters that
+// are not valid in names on common filesystems are replaced. Attachments with
+// the same name in a message are stored with a numeric suffix, for example
+// report.pdf and report-1.pdf. Any attachments already put are returned if an
+// error occurs.
+func Put(s fs.FS, msg *mail.Message) ([]Attachment, error) {
+	ing := &ingester{
+		fs:    s,
+		names: make(map[string]struct{}),
+	}
+
+	err := ing.part(textproto.MIMEHeader(msg.Header), msg.Body)
+	return ing.atts, err
+}
+
+func (ing *ingester) part(hdr textproto.MIMEHeader, r io.Reader) error {
+	mediatype, params, err := mime.ParseMediaType(hdr.Get("Content-Type"))
+
+	typed := err == nil
+
+	if strings.HasPrefix(mediatype, "multipart/") {
+		mr := multipart.NewReader(r, params["boundary"])
+
+		for {
+			p, err := mr.NextRawPart()
+
+			if err != nil {
+				if errors.Is(err, io.EOF) {
+					return nil
+				}
+				return err
+			}
+
+			if err := ing.part(p.Header, p); err != nil {
+				return err
+			}
+		}
+	}
+
+	disposition, dparams, _ := mime.ParseMediaType(hdr.Get("Content-Disposition"))
+
+	filename := dparams["filename"]
+
+	if filename == "" {
+		filename = params["name"]
+	}
+
+	if disposition != "attachment" && filename == "" {
+		return nil
+	}
+
+	if filename == "" {
+		filename = "attachment"
+	}
+
+	dec := new(mime.WordDecoder)
+
+	if decoded, err := dec.DecodeHeader(filename); err == nil {
+		filename = decoded
+	}
+
+	switch strings.ToLower(hdr.Get("Content-Transfer-Encoding")) {
+	case "base64":
+		r = base64.NewDecoder(base64.StdEncoding, r)
+	case "quoted-printable":
+		r = quotedprintable.NewReader(r)
+	}
+	return ing.put(filename, mediatype, typed, r)
+}
+
+func (ing *ingester) put(filename, ctype string, typed bool, r io.Reader) error {
+	name := ing.unique(sanitize(filename))
+
+	f, err := fs.ReadFile(name, r)
+
+	if err != nil {
+		return &fs.PathError{Op: "attach", Path: filename, Err: err}
+	}
+
+	defer fs.Cleanup(f)
+
+	var file fs.File
+
+	// Attachments without a valid content type have it detected from their
+	// content.
+	if !typed {
+		ctype, file, err = fs.DetectContentType(f)
+
+		if err != nil {
+			return &fs.PathError{Op: "attach", Path: filename, Err: err}
+		}
+	} else {
+		file = &metadataFile{
+			File: f,
+			md:   fs.Metadata{fs.MetadataContentType: ctype},
+		}
+	}
+
+	stored, err := fs.PutMetadata(ing.fs, file)
+
+	if err != nil {
+		return err
+	}
+
+	defer stored.Close()
+
+	info, err := stored.Stat()
+
+	if err != nil {
+		return err
+	}
+
+	ing.atts = append(ing.atts, Attachment{
+		Name:        name,
+		Filename:    filename,
+		ContentType: ctype,
+		Size:        info.Size(),
+	})
+	return nil
+}
+
+// unique returns the given name, or the name with a numeric suffix if an
+// attachment of the same name has already been put.
+func (ing *ingester) unique(name string) string {
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+
+	unique := name
+
+	for i := 1; ; i++ {
+		if _, ok := ing.names[unique]; !ok {
+			break
+		}
+		unique = base + "-" + strconv.Itoa(i) + ext
+	}
+
+	ing.names[unique] = struct{}{}
+	return unique
+}
+
+// sanitize returns the given filename as a name that is safe to store. Any
+// directories are removed, as are control characters, and characters that are
+// reserved on common filesystems are replaced with an underscore. Leading and
+// trailing dots and spaces are trimmed, and the name is truncated to
+// maxNameLen bytes, keeping its extension.
+func sanitize(filename string) string {
+	if i := strings.LastIndexAny(filename, `/\`); i >= 0 {
+		filename = filename[i+1:]
+	}
+
+	var b strings.Builder
+
+	for _, r := range filename {
+		switch {
+		case r < 0x20 || r == 0x7f:
+			continue
+		case strings.ContainsRune(`<>:"|?*`, r):
+			b.WriteRune('_')
+		default:
+			b.WriteRune(r)
+		}
+	}
+
+	name := strings.Trim(b.String(), ". ")
+
+	if name == "" {
+		return "attachment"
+	}
+
+	if len(name) > maxNameLen {
+		ext := path.Ext(name)
+
+		if len(ext) > maxNameLen/2 {
+			ext = ""
+		}
+
+		// Cutting the name may split a multi-byte character, which is then
+		// dropped.
+		base := strings.ToValidUTF8(name[:maxNameLen-len(ext)], "")
+		name = strings.TrimRight(base, ". ") + ext
+	}
+	return name
+}
@@ -0,0 +1,136 @@
+package attach
+
+import (
+	"io"
+	"net/mail"
+	"strings"
+	"testing"
+
+	"github.com/andrewpillar/fs"
+	"github.com/andrewpillar/fs/fakefs"
+)
+
+const message = "From: alice@example.com\r\n" +
+	"To: support@example.com\r\n" +
+	"Subject: Broken invoice\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/mixed; boundary=outer\r\n" +
+	"\r\n" +
+	"--outer\r\n" +
+	"Content-Type: multipart/alternative; boundary=inner\r\n" +
+	"\r\n" +
+	"--inner\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"\r\n" +
+	"The invoice is attached.\r\n" +
+	"--inner--\r\n" +
+	"--outer\r\n" +
+	"Content-Type: application/pdf\r\n" +
+	"Content-Disposition: attachment; filename=\"../../etc/invoice?.pdf\"\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"JVBERi0xLjQK\r\n" +
+	"--outer\r\n" +
+	"Content-Type: text/plain; name=\"=?UTF-8?Q?notes_=C3=A9t=C3=A9.txt?=\"\r\n" +
+	"Content-Transfer-Encoding: quoted-printable\r\n" +
+	"\r\n" +
+	"caf=C3=A9\r\n" +
+	"--outer\r\n" +
+	"Content-Type: application/pdf\r\n" +
+	"Content-Disposition: attachment; filename=\"invoice_.pdf\"\r\n" +
+	"\r\n" +
+	"%PDF-1.5\r\n" +
+	"--outer--\r\n"
+
+func Test_Put(t *testing.T) {
+	msg, err := mail.ReadMessage(strings.NewReader(message))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := fakefs.New()
+
+	atts, err := Put(store, msg)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		filename string
+		ctype    string
+		content  string
+	}{
+		{"invoice_.pdf", "../../etc/invoice?.pdf", "application/pdf", "%PDF-1.4\n"},
+		{"notes été.txt", "notes été.txt", "text/plain", "café"},
+		{"invoice_-1.pdf", "invoice_.pdf", "application/pdf", "%PDF-1.5"},
+	}
+
+	if len(atts) != len(tests) {
+		t.Fatalf("unexpected attachments, expected=%d, got=%d\n", len(tests), len(atts))
+	}
+
+	for i, test := range tests {
+		att := atts[i]
+
+		if att.Name != test.name {
+			t.Fatalf("tests[%d] - unexpected name, expected=%q, got=%q\n", i, test.name, att.Name)
+		}
+
+		if att.Filename != test.filename {
+			t.Fatalf("tests[%d] - unexpected filename, expected=%q, got=%q\n", i, test.filename, att.Filename)
+		}
+
+		f, err := store.Open(test.name)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := io.ReadAll(f)
+		f.Close()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(b) != test.content {
+			t.Fatalf("tests[%d] - unexpected content, expected=%q, got=%q\n", i, test.content, string(b))
+		}
+
+		md, err := fs.GetMetadata(store, test.name)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if ctype := md[fs.MetadataContentType]; ctype != test.ctype {
+			t.Fatalf("tests[%d] - unexpected content type, expected=%q, got=%q\n", i, test.ctype, ctype)
+		}
+	}
+}
+
+func Test_Sanitize(t *testing.T) {
+	long := strings.Repeat("é", 200) + ".txt"
+
+	tests := []struct {
+		filename string
+		expected string
+	}{
+		{"report.pdf", "report.pdf"},
+		{`C:\Users\bob\report.pdf`, "report.pdf"},
+		{"a<b>c:d.txt", "a_b_c_d.txt"},
+		{"bad\x00\nname.txt", "badname.txt"},
+		{"..", "attachment"},
+		{" .hidden. ", "hidden"},
+		{long, strings.Repeat("é", 125) + ".txt"},
+	}
+
+	for i, test := range tests {
+		if name := sanitize(test.filename); name != test.expected {
+			t.Fatalf("tests[%d] - unexpected name, expected=%q, got=%q\n", i, test.expected, name)
+		}
+	}
+}
@@ -0,0 +1,495 @@
+// Package backup implements incremental snapshots of an FS into another FS.
+//
+// Files are split into fixed size chunks which are stored against the SHA256
+// hash of their content, so a chunk is only ever stored once no matter how
+// many files or snapshots refer to it. Each snapshot is recorded as a JSON
+// manifest listing the files in the snapshot and the chunks that make them up.
+package backup
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/andrewpillar/fs"
+)
+
+const (
+	chunksDir    = "chunks"
+	snapshotsDir = "snapshots"
+
+	idLayout = "20060102T150405.000000000Z"
+)
+
+// ErrNoSnapshot is returned when a snapshot cannot be found.
+var ErrNoSnapshot = errors.New("no snapshot")
+
+// ChecksumError is returned when a chunk read back from the repository does
+// not match the hash it was stored against.
+type ChecksumError struct {
+	Chunk string
+}
+
+func (e ChecksumError) Error() string {
+	return "chunk " + e.Chunk + " is corrupt"
+}
+
+// Entry is a single file recorded in a snapshot.
+type Entry struct {
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	Chunks  []string  `json:"chunks"`
+}
+
+// Snapshot is the manifest of a single backup.
+type Snapshot struct {
+	ID     string    `json:"id"`
+	Time   time.Time `json:"time"`
+	Parent string    `json:"parent,omitempty"`
+	Files  []Entry   `json:"files"`
+}
+
+// Repo is a repository of snapshots stored in an FS.
+type Repo struct {
+	store     fs.FS
+	chunkSize int
+	now       func() time.Time
+}
+
+// Option configures a Repo.
+type Option func(*Repo)
+
+// ChunkSize sets the size of the chunks files are split into. The default is
+// 1MB.
+func ChunkSize(n int) Option {
+	return func(r *Repo) {
+		if n > 0 {
+			r.chunkSize = n
+		}
+	}
+}
+
+// Clock sets the function used to get the time a snapshot is taken.
+func Clock(now func() time.Time) Option {
+	return func(r *Repo) {
+		r.now = now
+	}
+}
+
+// New returns a new Repo that stores its chunks and snapshots in the given
+// FS.
+func New(s fs.FS, opts ...Option) *Repo {
+	r := &Repo{
+		store:     s,
+		chunkSize: 1 << 20,
+		now:       time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Snapshots returns all of the snapshots in the repository ordered from
+// oldest to newest.
+func (r *Repo) Snapshots() ([]*Snapshot, error) {
+	sub, err := r.store.Sub(snapshotsDir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	ents, err := fs.ReadDir(sub, ".")
+
+	if err != nil {
+		return nil, err
+	}
+
+	snaps := make([]*Snapshot, 0, len(ents))
+
+	for _, ent := range ents {
+		if ent.IsDir() || !strings.HasSuffix(ent.Name(), ".json") {
+			continue
+		}
+
+		snap, err := r.loadSnapshot(sub, ent.Name())
+
+		if err != nil {
+			return nil, err
+		}
+		snaps = append(snaps, snap)
+	}
+
+	sort.Slice(snaps, func(i, j int) bool {
+		return snaps[i].ID < snaps[j].ID
+	})
+	return snaps, nil
+}
+
+func (r *Repo) loadSnapshot(s fs.FS, name string) (*Snapshot, error) {
+	f, err := s.Open(name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	var snap Snapshot
+
+	if err := json.NewDecoder(f).Decode(&snap); err != nil {
+		return nil, err
+	}
+	return &snap, nil
+}
+
+// Snapshot returns the snapshot with the given ID.
+func (r *Repo) Snapshot(id string) (*Snapshot, error) {
+	sub, err := r.store.Sub(snapshotsDir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	snap, err := r.loadSnapshot(sub, id+".json")
+
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, ErrNoSnapshot
+		}
+		return nil, err
+	}
+	return snap, nil
+}
+
+// Latest returns the most recent snapshot. ErrNoSnapshot is returned if the
+// repository is empty.
+func (r *Repo) Latest() (*Snapshot, error) {
+	snaps, err := r.Snapshots()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(snaps) == 0 {
+		return nil, ErrNoSnapshot
+	}
+	return snaps[len(snaps)-1], nil
+}
+
+// At returns the most recent snapshot taken at or before the given time.
+// ErrNoSnapshot is returned if no such snapshot exists.
+func (r *Repo) At(t time.Time) (*Snapshot, error) {
+	snaps, err := r.Snapshots()
+
+	if err != nil {
+		return nil, err
+	}
+
+	for i := len(snaps) - 1; i >= 0; i-- {
+		if !snaps[i].Time.After(t) {
+			return snaps[i], nil
+		}
+	}
+	return nil, ErrNoSnapshot
+}
+
+func (r *Repo) putChunk(chunks fs.FS, data []byte) (string, error) {
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+
+	if _, err := chunks.Stat(hash); err == nil {
+		return hash, nil
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+
+	f, err := fs.ReadFile(hash, bytes.NewReader(data))
+
+	if err != nil {
+		return "", err
+	}
+
+	defer fs.Cleanup(f)
+
+	stored, err := chunks.Put(f)
+
+	if err != nil {
+		return "", err
+	}
+	return hash, stored.Close()
+}
+
+func (r *Repo) backupFile(src, chunks fs.FS, name string, buf []byte) ([]string, error) {
+	f, err := src.Open(name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	hashes := make([]string, 0)
+
+	for {
+		n, err := io.ReadFull(f, buf)
+
+		if n > 0 {
+			hash, err := r.putChunk(chunks, buf[:n])
+
+			if err != nil {
+				return nil, err
+			}
+			hashes = append(hashes, hash)
+		}
+
+		if err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				break
+			}
+			return nil, err
+		}
+	}
+	return hashes, nil
+}
+
+// Backup takes a snapshot of the given FS and stores it in the repository.
+// The backup is incremental, files whose size and modification time have not
+// changed since the previous snapshot are not read again, and only chunks that
+// do not already exist in the repository are stored. The source FS must
+// implement fs.ReadDirFS.
+func (r *Repo) Backup(src fs.FS) (*Snapshot, error) {
+	chunks, err := r.store.Sub(chunksDir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	prev := make(map[string]Entry)
+
+	parent, err := r.Latest()
+
+	if err != nil {
+		if !errors.Is(err, ErrNoSnapshot) {
+			return nil, err
+		}
+	}
+
+	if parent != nil {
+		for _, ent := range parent.Files {
+			prev[ent.Name] = ent
+		}
+	}
+
+	now := r.now().UTC()
+
+	snap := &Snapshot{
+		ID:   now.Format(idLayout),
+		Time: now,
+	}
+
+	if parent != nil {
+		snap.Parent = parent.ID
+	}
+
+	buf := make([]byte, r.chunkSize)
+
+	walk := func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			return nil
+		}
+
+		info, err := d.Info()
+
+		if err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		ent := Entry{
+			Name:    name,
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		}
+
+		if old, ok := prev[name]; ok && old.Size == ent.Size && old.ModTime.Equal(ent.ModTime) {
+			ent.Chunks = old.Chunks
+		} else {
+			hashes, err := r.backupFile(src, chunks, name, buf)
+
+			if err != nil {
+				return err
+			}
+			ent.Chunks = hashes
+		}
+
+		snap.Files = append(snap.Files, ent)
+		return nil
+	}
+
+	if err := fs.Walk(src, ".", walk); err != nil {
+		return nil, err
+	}
+
+	b, err := json.Marshal(snap)
+
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := fs.ReadFile(snap.ID+".json", bytes.NewReader(b))
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer fs.Cleanup(f)
+
+	stored, err := fs.PutPath(r.store, snapshotsDir+"/"+snap.ID+".json", f)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := stored.Close(); err != nil {
+		return nil, err
+	}
+	return snap, nil
+}
+
+// chunkReader reads the content of a file back from its chunks, verifying
+// each chunk against its hash as it is read.
+type chunkReader struct {
+	chunks fs.FS
+	hashes []string
+	cur    io.Reader
+}
+
+func (r *chunkReader) next() error {
+	hash := r.hashes[0]
+	r.hashes = r.hashes[1:]
+
+	f, err := r.chunks.Open(hash)
+
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	h := sha256.New()
+
+	var buf bytes.Buffer
+
+	if _, err := io.Copy(io.MultiWriter(&buf, h), f); err != nil {
+		return err
+	}
+
+	if hex.EncodeToString(h.Sum(nil)) != hash {
+		return ChecksumError{Chunk: hash}
+	}
+
+	r.cur = &buf
+	return nil
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for {
+		if r.cur != nil {
+			n, err := r.cur.Read(p)
+
+			if n > 0 {
+				return n, nil
+			}
+
+			if err != nil && !errors.Is(err, io.EOF) {
+				return 0, err
+			}
+			r.cur = nil
+		}
+
+		if len(r.hashes) == 0 {
+			return 0, io.EOF
+		}
+
+		if err := r.next(); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// restoreFile is the File used to put a restored file into the destination
+// FS.
+type restoreFile struct {
+	*chunkReader
+
+	ent Entry
+}
+
+func (f *restoreFile) Stat() (fs.FileInfo, error) { return f, nil }
+func (f *restoreFile) Close() error               { return nil }
+func (f *restoreFile) Name() string               { return path.Base(f.ent.Name) }
+func (f *restoreFile) Size() int64                { return f.ent.Size }
+func (f *restoreFile) Mode() fs.FileMode          { return fs.FileMode(0400) }
+func (f *restoreFile) ModTime() time.Time         { return f.ent.ModTime }
+func (f *restoreFile) IsDir() bool                { return false }
+func (f *restoreFile) Sys() any                   { return nil }
+
+// Restore restores every file in the given snapshot into the given FS. Each
+// chunk is verified against its hash as it is read, and ChecksumError is
+// returned if a chunk is corrupt.
+func (r *Repo) Restore(snap *Snapshot, dst fs.FS) error {
+	chunks, err := r.store.Sub(chunksDir)
+
+	if err != nil {
+		return err
+	}
+
+	for _, ent := range snap.Files {
+		f := &restoreFile{
+			chunkReader: &chunkReader{
+				chunks: chunks,
+				hashes: ent.Chunks,
+			},
+			ent: ent,
+		}
+
+		stored, err := fs.PutPath(dst, ent.Name, f)
+
+		if err != nil {
+			return err
+		}
+
+		if err := stored.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RestoreAt restores the most recent snapshot taken at or before the given
+// time into the given FS.
+func (r *Repo) RestoreAt(t time.Time, dst fs.FS) error {
+	snap, err := r.At(t)
+
+	if err != nil {
+		return err
+	}
+	return r.Restore(snap, dst)
+}
@@ -0,0 +1,127 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/andrewpillar/fs"
+)
+
+func tmpdir(t *testing.T) string {
+	dir, err := os.MkdirTemp("", t.Name())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func writeFile(t *testing.T, name, content string) {
+	if err := os.MkdirAll(filepath.Dir(name), 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(name, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func countChunks(t *testing.T, dir string) int {
+	ents, err := os.ReadDir(filepath.Join(dir, chunksDir))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(ents)
+}
+
+func Test_BackupRestore(t *testing.T) {
+	src := tmpdir(t)
+	defer os.RemoveAll(src)
+
+	repodir := tmpdir(t)
+	defer os.RemoveAll(repodir)
+
+	writeFile(t, filepath.Join(src, "a.txt"), "aaaaaaaaaa")
+	writeFile(t, filepath.Join(src, "dir", "b.txt"), "bbbbbbbbbb")
+
+	clock := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	repo := New(fs.New(repodir), ChunkSize(4), Clock(func() time.Time { return clock }))
+
+	first, err := repo.Backup(fs.New(src))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chunks := countChunks(t, repodir)
+
+	clock = clock.Add(time.Hour)
+
+	if _, err := repo.Backup(fs.New(src)); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := countChunks(t, repodir); n != chunks {
+		t.Fatalf("unexpected chunk count, expected=%d, got=%d\n", chunks, n)
+	}
+
+	clock = clock.Add(time.Hour)
+
+	writeFile(t, filepath.Join(src, "a.txt"), "changed content")
+
+	latest, err := repo.Backup(fs.New(src))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if latest.Parent == "" {
+		t.Fatal("expected snapshot to have a parent, it did not")
+	}
+
+	tests := []struct {
+		at       time.Time
+		expected string
+	}{
+		{first.Time.Add(time.Minute), "aaaaaaaaaa"},
+		{latest.Time, "changed content"},
+	}
+
+	for i, test := range tests {
+		func(i int) {
+			dst := tmpdir(t)
+			defer os.RemoveAll(dst)
+
+			if err := repo.RestoreAt(test.at, fs.New(dst)); err != nil {
+				t.Fatalf("tests[%d] - %s\n", i, err)
+			}
+
+			b, err := os.ReadFile(filepath.Join(dst, "a.txt"))
+
+			if err != nil {
+				t.Fatalf("tests[%d] - %s\n", i, err)
+			}
+
+			if string(b) != test.expected {
+				t.Fatalf("tests[%d] - unexpected content, expected=%q, got=%q\n", i, test.expected, string(b))
+			}
+
+			b, err = os.ReadFile(filepath.Join(dst, "dir", "b.txt"))
+
+			if err != nil {
+				t.Fatalf("tests[%d] - %s\n", i, err)
+			}
+
+			if string(b) != "bbbbbbbbbb" {
+				t.Fatalf("tests[%d] - unexpected content, expected=%q, got=%q\n", i, "bbbbbbbbbb", string(b))
+			}
+		}(i)
+	}
+
+	if _, err := repo.At(first.Time.Add(-time.Hour)); err != ErrNoSnapshot {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", ErrNoSnapshot, err)
+	}
+}
@@ -0,0 +1,253 @@
+package fs
+
+import (
+	"sync"
+	"time"
+)
+
+// Strategy picks which replica a read is sent to. Implementations must be safe
+// for concurrent use.
+type Strategy interface {
+	// Pick returns the index of the replica to read from, of the n replicas.
+	Pick(n int) int
+
+	// Observe records how long a read from the replica at the given index
+	// took, and whether it failed.
+	Observe(i int, d time.Duration, err error)
+}
+
+type roundRobin struct {
+	mu   sync.Mutex
+	next int
+}
+
+// RoundRobin returns a Strategy that sends reads to each replica in turn.
+func RoundRobin() Strategy {
+	return &roundRobin{}
+}
+
+func (r *roundRobin) Pick(n int) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.next % n
+	r.next = i + 1
+
+	return i
+}
+
+func (*roundRobin) Observe(int, time.Duration, error) {}
+
+// latencyDecay is the weight given to each new observation of the latency of
+// a replica.
+const latencyDecay = 0.2
+
+type leastLatency struct {
+	mu       sync.Mutex
+	latency  []float64
+	observed []bool
+}
+
+// LeastLatency returns a Strategy that sends reads to the replica with the
+// lowest moving average of latency. Replicas that have not been read from yet
+// are picked first, and a failed read counts against a replica as though it
+// took a second, so a failing replica is only picked again once the others are
+// as slow.
+func LeastLatency() Strategy {
+	return &leastLatency{}
+}
+
+func (l *leastLatency) grow(n int) {
+	for len(l.latency) < n {
+		l.latency = append(l.latency, 0)
+		l.observed = append(l.observed, false)
+	}
+}
+
+func (l *leastLatency) Pick(n int) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.grow(n)
+
+	best := 0
+
+	for i := 0; i < n; i++ {
+		if !l.observed[i] {
+			return i
+		}
+
+		if l.latency[i] < l.latency[best] {
+			best = i
+		}
+	}
+	return best
+}
+
+func (l *leastLatency) Observe(i int, d time.Duration, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.grow(i + 1)
+
+	if err != nil && isBackendFailure(err) {
+		d = time.Second
+	}
+
+	if !l.observed[i] {
+		l.latency[i] = float64(d)
+		l.observed[i] = true
+		return
+	}
+	l.latency[i] += latencyDecay * (float64(d) - l.latency[i])
+}
+
+type balanceFS struct {
+	FS
+
+	replicas []FS
+	strategy Strategy
+}
+
+// ReadBalance returns a filesystem that spreads reads across the given
+// replicas, as picked by the strategy, and sends writes to the primary. Reads
+// are Open, Stat, ReadDir, and Metadata. If a read from a replica fails, for
+// example because the file has not been replicated yet, then it is retried
+// against the primary. If there are no replicas then every read goes to the
+// primary. The strategy is shared with the filesystems returned from Sub.
+func ReadBalance(primary FS, strategy Strategy, replicas ...FS) FS {
+	bs := &balanceFS{
+		FS:       primary,
+		replicas: replicas,
+		strategy: strategy,
+	}
+
+	if canRename(primary) {
+		return renameBalanceFS{balanceFS: bs}
+	}
+	return bs
+}
+
+// renameBalanceFS is a balanceFS over a primary that implements RenameFS.
+type renameBalanceFS struct {
+	*balanceFS
+}
+
+func (s *balanceFS) Unwrap() []FS {
+	return append([]FS{s.FS}, s.replicas...)
+}
+
+// read calls fn with a replica picked by the strategy, falling back to the
+// primary if the read fails.
+func (s *balanceFS) read(fn func(FS) error) error {
+	if len(s.replicas) == 0 {
+		return fn(s.FS)
+	}
+
+	i := s.strategy.Pick(len(s.replicas))
+
+	start := time.Now()
+	err := fn(s.replicas[i])
+	s.strategy.Observe(i, time.Since(start), err)
+
+	if err == nil {
+		return nil
+	}
+	return fn(s.FS)
+}
+
+func (s *balanceFS) Open(name string) (File, error) {
+	var f File
+
+	err := s.read(func(store FS) error {
+		var err error
+
+		f, err = store.Open(name)
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (s *balanceFS) Sub(dir string) (FS, error) {
+	primary, err := s.FS.Sub(dir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	replicas := make([]FS, 0, len(s.replicas))
+
+	for _, replica := range s.replicas {
+		sub, err := replica.Sub(dir)
+
+		if err != nil {
+			return nil, err
+		}
+		replicas = append(replicas, sub)
+	}
+	return ReadBalance(primary, s.strategy, replicas...), nil
+}
+
+func (s *balanceFS) Stat(name string) (FileInfo, error) {
+	var info FileInfo
+
+	err := s.read(func(store FS) error {
+		var err error
+
+		info, err = store.Stat(name)
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+func (s *balanceFS) ReadDir(name string) ([]DirEntry, error) {
+	var ents []DirEntry
+
+	err := s.read(func(store FS) error {
+		var err error
+
+		ents, err = ReadDir(store, name)
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return ents, nil
+}
+
+func (s renameBalanceFS) Rename(oldname, newname string) error {
+	return Move(s.FS, oldname, newname)
+}
+
+func (s *balanceFS) Metadata(name string) (Metadata, error) {
+	var md Metadata
+
+	err := s.read(func(store FS) error {
+		var err error
+
+		md, err = GetMetadata(store, name)
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return md, nil
+}
+
+func (s *balanceFS) SetMetadata(name string, md Metadata) error {
+	return SetMetadata(s.FS, name, md)
+}
+
+func (s *balanceFS) Link(oldname, newname string) error {
+	return Link(s.FS, oldname, newname)
+}
@@ -0,0 +1,116 @@
+package fs
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// openCounter counts the number of files opened from the filesystem.
+type openCounter struct {
+	FS
+
+	opens int
+}
+
+func (s *openCounter) Open(name string) (File, error) {
+	s.opens++
+	return s.FS.Open(name)
+}
+
+func Test_ReadBalance(t *testing.T) {
+	dirs := make([]string, 3)
+
+	for i := range dirs {
+		dirs[i] = tmpdir(t)
+		defer os.RemoveAll(dirs[i])
+
+		if err := os.WriteFile(filepath.Join(dirs[i], "file"), []byte("data"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	primary := &openCounter{FS: New(dirs[0])}
+	replicas := []*openCounter{
+		{FS: New(dirs[1])},
+		{FS: New(dirs[2])},
+	}
+
+	store := ReadBalance(primary, RoundRobin(), replicas[0], replicas[1])
+
+	for i := 0; i < 4; i++ {
+		if s := readAll(t, store, "file"); s != "data" {
+			t.Fatalf("unexpected content, expected=%q, got=%q\n", "data", s)
+		}
+	}
+
+	tests := []struct {
+		store *openCounter
+		opens int
+	}{
+		{primary, 0},
+		{replicas[0], 2},
+		{replicas[1], 2},
+	}
+
+	for i, test := range tests {
+		if test.store.opens != test.opens {
+			t.Fatalf("tests[%d] - unexpected opens, expected=%d, got=%d\n", i, test.opens, test.store.opens)
+		}
+	}
+
+	f, err := ReadFile("new", bytes.NewReader([]byte("new")))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := store.Put(f)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored.Close()
+
+	if _, err := os.Stat(filepath.Join(dirs[1], "new")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("unexpected error, expected=%v, got=%v\n", os.ErrNotExist, err)
+	}
+
+	// The file has not been replicated, so should be read from the primary.
+	if s := readAll(t, store, "new"); s != "new" {
+		t.Fatalf("unexpected content, expected=%q, got=%q\n", "new", s)
+	}
+}
+
+func Test_LeastLatency(t *testing.T) {
+	l := LeastLatency()
+
+	tests := []struct {
+		latency []time.Duration
+		err     []error
+		pick    int
+	}{
+		{nil, nil, 0},
+		{[]time.Duration{time.Millisecond}, nil, 1},
+		{[]time.Duration{time.Millisecond, 2 * time.Millisecond}, nil, 0},
+		{[]time.Duration{time.Millisecond, time.Millisecond}, []error{errors.New("timeout"), nil}, 1},
+	}
+
+	for i, test := range tests {
+		for j, d := range test.latency {
+			var err error
+
+			if test.err != nil {
+				err = test.err[j]
+			}
+			l.Observe(j, d, err)
+		}
+
+		if pick := l.Pick(2); pick != test.pick {
+			t.Fatalf("tests[%d] - unexpected pick, expected=%d, got=%d\n", i, test.pick, pick)
+		}
+	}
+}
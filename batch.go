@@ -0,0 +1,585 @@
+package fs
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	iofs "io/fs"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// packDir is the directory packs are stored in by Batch.
+const packDir = ".packs"
+
+// BatchConfig configures when the files buffered by Batch are flushed into a
+// pack.
+type BatchConfig struct {
+	// MaxFiles is the number of buffered files after which they are flushed.
+	// Defaults to 1000.
+	MaxFiles int
+
+	// MaxSize is the total size of the buffered files after which they are
+	// flushed. Defaults to 8MB.
+	MaxSize int64
+
+	// MaxAge is how long a file can be buffered before the files are flushed
+	// in the background. If zero, files are only flushed once one of the other
+	// limits is reached, or on a call to Flush.
+	MaxAge time.Duration
+
+	// Threshold is the size above which files are put directly in the
+	// underlying filesystem instead of being buffered. Defaults to 256KB.
+	Threshold int64
+}
+
+// FlushFS is the interface implemented by a filesystem that buffers writes.
+type FlushFS interface {
+	FS
+
+	// Flush writes any buffered files to the underlying storage.
+	Flush() error
+}
+
+// Flush flushes any files buffered in the given filesystem. If the filesystem
+// does not implement FlushFS then ErrUnsupported is returned in the
+// *PathError.
+func Flush(s FS) error {
+	fl, ok := s.(FlushFS)
+
+	if !ok {
+		return &PathError{Op: "flush", Path: ".", Err: ErrUnsupported}
+	}
+	return fl.Flush()
+}
+
+type packLoc struct {
+	pack  string
+	entry PackEntry
+}
+
+type batchFS struct {
+	FS
+
+	cfg BatchConfig
+
+	mu      sync.Mutex
+	loaded  bool
+	index   map[string]packLoc
+	buf     map[string]*file
+	order   []string
+	removed []string
+	size    int64
+	oldest  time.Time
+
+	// timer flushes the buffered files once the oldest reaches MaxAge, and
+	// err is the error from that flush, returned from the next call to Flush.
+	timer *time.Timer
+	err   error
+	done  bool
+}
+
+// Batch returns a filesystem that buffers small files put in it in memory,
+// and flushes them to the given filesystem as a single pack, so many small
+// files are stored with a single write. Files are opened from the buffer if
+// they have not yet been flushed, and from their pack otherwise. The packs
+// are stored in the .packs directory of the underlying filesystem, which must
+// implement ReadDirFS so the packs can be indexed when first used.
+//
+// Buffered files are lost if they are not flushed, so Flush or Shutdown should
+// be called before the program exits. Shutdown also stops the flushing of files
+// that reach MaxAge. Files removed after being packed are recorded as
+// removed in the next pack, the space they take up in their pack is not
+// reclaimed.
+func Batch(s FS, cfg BatchConfig) FS {
+	if cfg.MaxFiles <= 0 {
+		cfg.MaxFiles = 1000
+	}
+	if cfg.MaxSize <= 0 {
+		cfg.MaxSize = 8 << 20
+	}
+	if cfg.Threshold <= 0 {
+		cfg.Threshold = 256 << 10
+	}
+
+	return &batchFS{
+		FS:    s,
+		cfg:   cfg,
+		index: make(map[string]packLoc),
+		buf:   make(map[string]*file),
+	}
+}
+
+// openPack opens the named pack, returning it along with a ReaderAt for its
+// content.
+func (s *batchFS) openPack(name string) (File, io.ReaderAt, int64, error) {
+	f, err := s.FS.Open(packDir + "/" + name)
+
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	info, err := f.Stat()
+
+	if err != nil {
+		f.Close()
+		return nil, nil, 0, err
+	}
+
+	if ra, ok := f.(io.ReaderAt); ok {
+		return f, ra, info.Size(), nil
+	}
+
+	b, err := io.ReadAll(f)
+
+	if err != nil {
+		f.Close()
+		return nil, nil, 0, err
+	}
+	return f, bytes.NewReader(b), int64(len(b)), nil
+}
+
+// load builds the index from the packs in the underlying filesystem. This
+// must be called with the lock held.
+func (s *batchFS) load() error {
+	if s.loaded {
+		return nil
+	}
+
+	ents, err := ReadDir(s.FS, packDir)
+
+	if err != nil && !errors.Is(err, ErrNotExist) {
+		return err
+	}
+
+	// Pack names sort in the order they were written, so later packs take
+	// precedence.
+	sort.Slice(ents, func(i, j int) bool {
+		return ents[i].Name() < ents[j].Name()
+	})
+
+	for _, ent := range ents {
+		if ent.IsDir() {
+			continue
+		}
+
+		f, ra, size, err := s.openPack(ent.Name())
+
+		if err != nil {
+			return err
+		}
+
+		entries, err := ReadPackIndex(ra, size)
+		f.Close()
+
+		if err != nil {
+			return &PathError{Op: "batch", Path: packDir + "/" + ent.Name(), Err: err}
+		}
+
+		for _, e := range entries {
+			if e.Deleted {
+				delete(s.index, e.Name)
+				continue
+			}
+			s.index[e.Name] = packLoc{pack: ent.Name(), entry: e}
+		}
+	}
+
+	s.loaded = true
+	return nil
+}
+
+func packName() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+
+	ts := strconv.FormatInt(time.Now().UnixNano(), 10)
+
+	for len(ts) < 20 {
+		ts = "0" + ts
+	}
+	return ts + "-" + hex.EncodeToString(b) + ".pack"
+}
+
+// flush writes the buffered files into a pack. This must be called with the
+// lock held.
+func (s *batchFS) flush() error {
+	if len(s.order) == 0 && len(s.removed) == 0 {
+		return nil
+	}
+
+	var buf bytes.Buffer
+
+	pw, err := NewPackWriter(&buf)
+
+	if err != nil {
+		return err
+	}
+
+	// Removals are written first, since the entries of a pack are applied in
+	// order, and a file removed and then put again must not be removed by
+	// its own pack.
+	for _, name := range s.removed {
+		pw.Remove(name)
+	}
+
+	for _, name := range s.order {
+		f := s.buf[name]
+
+		if err := pw.Add(name, f.modTime, bytes.NewReader(f.data)); err != nil {
+			return err
+		}
+	}
+
+	if err := pw.Close(); err != nil {
+		return err
+	}
+
+	name := packName()
+
+	dir, err := s.FS.Sub(packDir)
+
+	if err != nil {
+		return err
+	}
+
+	stored, err := dir.Put(&file{
+		name:    name,
+		data:    buf.Bytes(),
+		modTime: time.Now(),
+	})
+
+	if err != nil {
+		return err
+	}
+	stored.Close()
+
+	for _, e := range pw.Entries() {
+		if !e.Deleted {
+			s.index[e.Name] = packLoc{pack: name, entry: e}
+		}
+	}
+
+	s.buf = make(map[string]*file)
+	s.order = s.order[:0]
+	s.removed = s.removed[:0]
+	s.size = 0
+
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	return nil
+}
+
+// flushAged flushes the buffered files once the oldest reaches MaxAge. This is
+// called by the timer.
+func (s *batchFS) flushAged() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// The timer may have been stopped by a flush, or by Shutdown, after it
+	// fired.
+	if s.timer == nil || s.done {
+		return
+	}
+
+	s.timer = nil
+
+	if err := s.flush(); err != nil && s.err == nil {
+		s.err = err
+	}
+}
+
+func (s *batchFS) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return err
+	}
+
+	if err := s.flush(); err != nil {
+		return err
+	}
+
+	err := s.err
+	s.err = nil
+	return err
+}
+
+func (s *batchFS) Unwrap() FS { return s.FS }
+
+// Shutdown flushes the buffered files, and stops files from being flushed once
+// they reach MaxAge.
+func (s *batchFS) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.done = true
+
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	s.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.Flush()
+}
+
+func (s *batchFS) Sub(dir string) (FS, error) {
+	sub, err := s.FS.Sub(dir)
+
+	if err != nil {
+		return nil, err
+	}
+	return Batch(sub, s.cfg), nil
+}
+
+// lookup returns the buffered file or the location in a pack of the named
+// file.
+func (s *batchFS) lookup(name string) (*file, packLoc, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return nil, packLoc{}, false, err
+	}
+
+	if f, ok := s.buf[name]; ok {
+		return f, packLoc{}, true, nil
+	}
+
+	loc, ok := s.index[name]
+	return nil, loc, ok, nil
+}
+
+func (s *batchFS) Open(name string) (File, error) {
+	buffered, loc, ok, err := s.lookup(name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		return s.FS.Open(name)
+	}
+
+	if buffered != nil {
+		return &file{
+			name:    buffered.name,
+			data:    buffered.data,
+			modTime: buffered.modTime,
+		}, nil
+	}
+
+	f, ra, _, err := s.openPack(loc.pack)
+
+	if err != nil {
+		return nil, &PathError{Op: "open", Path: name, Err: err}
+	}
+
+	return openPacked(ra, f, loc.entry), nil
+}
+
+func (s *batchFS) Stat(name string) (FileInfo, error) {
+	buffered, loc, ok, err := s.lookup(name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		return s.FS.Stat(name)
+	}
+
+	if buffered != nil {
+		return buffered, nil
+	}
+	return packInfo{e: loc.entry}, nil
+}
+
+func (s *batchFS) Put(f File) (File, error) {
+	info, err := f.Stat()
+
+	if err != nil {
+		return nil, err
+	}
+
+	name := info.Name()
+
+	if info.Size() > s.cfg.Threshold {
+		stored, err := s.FS.Put(f)
+
+		if err != nil {
+			return nil, err
+		}
+
+		// Make sure the file put directly is not shadowed by an earlier
+		// version in the buffer or a pack.
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		if err := s.load(); err != nil {
+			stored.Close()
+			return nil, err
+		}
+
+		s.forget(name)
+		return stored, nil
+	}
+
+	data, err := io.ReadAll(f)
+
+	if err != nil {
+		return nil, &PathError{Op: "put", Path: name, Err: err}
+	}
+
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+
+	if prev, ok := s.buf[name]; ok {
+		s.size -= prev.Size()
+	} else {
+		s.order = append(s.order, name)
+	}
+
+	if len(s.order) == 1 {
+		s.oldest = now
+
+		if s.cfg.MaxAge > 0 && s.timer == nil && !s.done {
+			s.timer = time.AfterFunc(s.cfg.MaxAge, s.flushAged)
+		}
+	}
+
+	s.buf[name] = &file{
+		name:    name,
+		data:    data,
+		modTime: now,
+	}
+	s.size += int64(len(data))
+
+	full := len(s.order)+len(s.removed) >= s.cfg.MaxFiles || s.size >= s.cfg.MaxSize
+	aged := s.cfg.MaxAge > 0 && now.Sub(s.oldest) >= s.cfg.MaxAge
+
+	if full || aged {
+		if err := s.flush(); err != nil {
+			return nil, &PathError{Op: "put", Path: name, Err: err}
+		}
+	}
+
+	return &file{
+		name:    name,
+		data:    data,
+		modTime: now,
+	}, nil
+}
+
+// forget drops the named file from the buffer, and records its removal from
+// the packs. This reports whether the file was buffered or packed. This must
+// be called with the lock held.
+func (s *batchFS) forget(name string) bool {
+	found := false
+
+	if prev, ok := s.buf[name]; ok {
+		s.size -= prev.Size()
+		delete(s.buf, name)
+
+		for i, n := range s.order {
+			if n == name {
+				s.order = append(s.order[:i], s.order[i+1:]...)
+				break
+			}
+		}
+		found = true
+	}
+
+	if _, ok := s.index[name]; ok {
+		delete(s.index, name)
+		s.removed = append(s.removed, name)
+		found = true
+	}
+	return found
+}
+
+func (s *batchFS) Remove(name string) error {
+	s.mu.Lock()
+
+	if err := s.load(); err != nil {
+		s.mu.Unlock()
+		return err
+	}
+
+	found := s.forget(name)
+	s.mu.Unlock()
+
+	if err := s.FS.Remove(name); err != nil {
+		if !found || !errors.Is(err, ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadDir returns the entries of the named directory in the underlying
+// filesystem, with the buffered and packed files included in the root.
+func (s *batchFS) ReadDir(name string) ([]DirEntry, error) {
+	ents, err := ReadDir(s.FS, name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if name != "." {
+		return ents, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]struct{})
+	merged := make([]DirEntry, 0, len(ents)+len(s.buf)+len(s.index))
+
+	for name, f := range s.buf {
+		seen[name] = struct{}{}
+		merged = append(merged, iofs.FileInfoToDirEntry(f))
+	}
+
+	for name, loc := range s.index {
+		if _, ok := seen[name]; !ok {
+			seen[name] = struct{}{}
+			merged = append(merged, iofs.FileInfoToDirEntry(packInfo{e: loc.entry}))
+		}
+	}
+
+	for _, ent := range ents {
+		if ent.Name() == packDir {
+			continue
+		}
+
+		if _, ok := seen[ent.Name()]; !ok {
+			merged = append(merged, ent)
+		}
+	}
+
+	sort.Slice(merged, func(i, j int) bool {
+		return merged[i].Name() < merged[j].Name()
+	})
+	return merged, nil
+}
@@ -0,0 +1,243 @@
+package fs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func countPacks(t *testing.T, dir string) int {
+	ents, err := os.ReadDir(filepath.Join(dir, packDir))
+
+	if err != nil {
+		if errors.Is(err, ErrNotExist) {
+			return 0
+		}
+		t.Fatal(err)
+	}
+	return len(ents)
+}
+
+func readAll(t *testing.T, s FS, name string) string {
+	f, err := s.Open(name)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	b, err := io.ReadAll(f)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func Test_Batch(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	cfg := BatchConfig{
+		MaxFiles:  3,
+		Threshold: 1024,
+	}
+
+	store := Batch(New(dir), cfg)
+
+	for i := 0; i < 5; i++ {
+		name := "file-" + strconv.Itoa(i)
+
+		f, err := ReadFile(name, bytes.NewReader([]byte(name)))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		stored, err := store.Put(f)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+		stored.Close()
+	}
+
+	if n := countPacks(t, dir); n != 1 {
+		t.Fatalf("unexpected packs, expected=%d, got=%d\n", 1, n)
+	}
+
+	// Both packed and buffered files should be readable.
+	for i := 0; i < 5; i++ {
+		name := "file-" + strconv.Itoa(i)
+
+		if content := readAll(t, store, name); content != name {
+			t.Fatalf("unexpected content, expected=%q, got=%q\n", name, content)
+		}
+	}
+
+	f, err := ReadFile("large", bytes.NewReader(generateData(t, 2048)))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := store.Put(f)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored.Close()
+
+	if _, err := os.Stat(filepath.Join(dir, "large")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Remove("file-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Flush(store); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := countPacks(t, dir); n != 2 {
+		t.Fatalf("unexpected packs, expected=%d, got=%d\n", 2, n)
+	}
+
+	// A new batch should index the existing packs.
+	store = Batch(New(dir), cfg)
+
+	if content := readAll(t, store, "file-4"); content != "file-4" {
+		t.Fatalf("unexpected content, expected=%q, got=%q\n", "file-4", content)
+	}
+
+	if _, err := store.Stat("file-1"); !errors.Is(err, ErrNotExist) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", ErrNotExist, err)
+	}
+
+	ents, err := ReadDir(store, ".")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"file-0", "file-2", "file-3", "file-4", "large"}
+
+	if len(ents) != len(expected) {
+		t.Fatalf("unexpected entries, expected=%d, got=%d\n", len(expected), len(ents))
+	}
+
+	for i, ent := range ents {
+		if ent.Name() != expected[i] {
+			t.Fatalf("unexpected entry, expected=%q, got=%q\n", expected[i], ent.Name())
+		}
+	}
+
+	if err := store.Remove("missing"); !errors.Is(err, ErrNotExist) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", ErrNotExist, err)
+	}
+}
+
+func Test_BatchRemovePut(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	cfg := BatchConfig{
+		MaxFiles:  10,
+		Threshold: 1024,
+	}
+
+	store := Batch(New(dir), cfg)
+
+	put := func(name, content string) {
+		f, err := ReadFile(name, bytes.NewReader([]byte(content)))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		stored, err := store.Put(f)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+		stored.Close()
+	}
+
+	put("a", "old")
+	put("b", "old")
+
+	if err := Flush(store); err != nil {
+		t.Fatal(err)
+	}
+
+	// Both files are removed and put again in the same pack, and b is then
+	// removed once more.
+	for _, name := range []string{"a", "b"} {
+		if err := store.Remove(name); err != nil {
+			t.Fatal(err)
+		}
+		put(name, "new")
+	}
+
+	if err := store.Remove("b"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Flush(store); err != nil {
+		t.Fatal(err)
+	}
+
+	store = Batch(New(dir), cfg)
+
+	if content := readAll(t, store, "a"); content != "new" {
+		t.Fatalf("unexpected content, expected=%q, got=%q\n", "new", content)
+	}
+
+	if _, err := store.Stat("b"); !errors.Is(err, ErrNotExist) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", ErrNotExist, err)
+	}
+}
+
+func Test_BatchMaxAge(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	store := Batch(New(dir), BatchConfig{
+		MaxAge: 10 * time.Millisecond,
+	})
+
+	f, err := ReadFile("file", bytes.NewReader([]byte("data")))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.Put(f); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+
+	for countPacks(t, dir) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected buffered file to be flushed once it reached the max age")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := Shutdown(context.Background(), store); err != nil {
+		t.Fatal(err)
+	}
+
+	if timer := store.(*batchFS).timer; timer != nil {
+		t.Fatal("expected flush timer to be stopped by shutdown")
+	}
+}
@@ -0,0 +1,266 @@
+// Package bench provides a load generator for measuring the performance of an
+// FS and the wrappers around it. The content of the files that are generated
+// is derived from a seed, so runs are reproducible.
+package bench
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/andrewpillar/fs"
+)
+
+// file is a File whose content is generated from a seed as it is read.
+type file struct {
+	name    string
+	size    int64
+	off     int64
+	rand    *rand.Rand
+	modTime time.Time
+}
+
+// File returns a File of the given size whose content is generated from the
+// given seed. Two files created with the same seed and size have the same
+// content.
+func File(name string, size, seed int64) fs.File {
+	return &file{
+		name:    name,
+		size:    size,
+		rand:    rand.New(rand.NewSource(seed)),
+		modTime: time.Now(),
+	}
+}
+
+func (f *file) Stat() (fs.FileInfo, error) { return f, nil }
+
+func (f *file) Read(p []byte) (int, error) {
+	if f.off >= f.size {
+		return 0, io.EOF
+	}
+
+	if rem := f.size - f.off; int64(len(p)) > rem {
+		p = p[:rem]
+	}
+
+	n, _ := f.rand.Read(p)
+	f.off += int64(n)
+
+	return n, nil
+}
+
+func (f *file) Close() error       { return nil }
+func (f *file) Name() string       { return f.name }
+func (f *file) Size() int64        { return f.size }
+func (f *file) Mode() fs.FileMode  { return fs.FileMode(0400) }
+func (f *file) ModTime() time.Time { return f.modTime }
+func (f *file) IsDir() bool        { return false }
+func (f *file) Sys() any           { return nil }
+
+// Config configures a run of the load generator.
+type Config struct {
+	// Workers is the number of goroutines putting files concurrently.
+	Workers int
+
+	// Files is the number of files each worker puts.
+	Files int
+
+	// Size is the size of each file in bytes.
+	Size int64
+
+	// Seed is the seed the content of each file is derived from.
+	Seed int64
+
+	// Read configures the run to open and read back each file after it has
+	// been put.
+	Read bool
+
+	// Remove configures the run to remove each file once done with it.
+	Remove bool
+}
+
+// Result is the result of a run of the load generator.
+type Result struct {
+	Ops      int
+	Errors   int
+	Bytes    int64
+	Duration time.Duration
+	P50      time.Duration
+	P99      time.Duration
+	Max      time.Duration
+}
+
+// Throughput returns the number of bytes transferred per second.
+func (r Result) Throughput() float64 {
+	if r.Duration <= 0 {
+		return 0
+	}
+	return float64(r.Bytes) / r.Duration.Seconds()
+}
+
+func (r Result) String() string {
+	return fmt.Sprintf(
+		"ops=%d errors=%d bytes=%d duration=%s throughput=%s/s p50=%s p99=%s max=%s",
+		r.Ops, r.Errors, r.Bytes, r.Duration, fs.HumanSize(int64(r.Throughput())), r.P50, r.P99, r.Max,
+	)
+}
+
+func percentile(lats []time.Duration, p float64) time.Duration {
+	if len(lats) == 0 {
+		return 0
+	}
+	return lats[int(float64(len(lats)-1)*p)]
+}
+
+type worker struct {
+	id     int
+	cfg    Config
+	store  fs.FS
+	lats   []time.Duration
+	bytes  int64
+	errors int
+	err    error
+}
+
+func (w *worker) time(fn func() (int64, error)) {
+	start := time.Now()
+
+	n, err := fn()
+
+	w.lats = append(w.lats, time.Since(start))
+	w.bytes += n
+
+	if err != nil {
+		w.errors++
+
+		if w.err == nil {
+			w.err = err
+		}
+	}
+}
+
+func (w *worker) run() {
+	for i := 0; i < w.cfg.Files; i++ {
+		name := "bench-" + strconv.Itoa(w.id) + "-" + strconv.Itoa(i)
+		seed := w.cfg.Seed + int64(w.id*w.cfg.Files+i)
+
+		var stored string
+
+		w.time(func() (int64, error) {
+			f, err := w.store.Put(File(name, w.cfg.Size, seed))
+
+			if err != nil {
+				return 0, err
+			}
+
+			defer f.Close()
+
+			info, err := f.Stat()
+
+			if err != nil {
+				return 0, err
+			}
+
+			stored = info.Name()
+			return w.cfg.Size, nil
+		})
+
+		if stored == "" {
+			continue
+		}
+
+		if w.cfg.Read {
+			w.time(func() (int64, error) {
+				f, err := w.store.Open(stored)
+
+				if err != nil {
+					return 0, err
+				}
+
+				defer f.Close()
+
+				return io.Copy(io.Discard, f)
+			})
+		}
+
+		if w.cfg.Remove {
+			w.time(func() (int64, error) {
+				return 0, w.store.Remove(stored)
+			})
+		}
+	}
+}
+
+// Run runs the load generator against the given FS with the given
+// configuration. The first error encountered is returned along with the
+// result, the run is not stopped on error.
+func Run(s fs.FS, cfg Config) (Result, error) {
+	if cfg.Workers < 1 {
+		cfg.Workers = 1
+	}
+
+	workers := make([]*worker, cfg.Workers)
+
+	var wg sync.WaitGroup
+
+	start := time.Now()
+
+	for i := range workers {
+		w := &worker{
+			id:    i,
+			cfg:   cfg,
+			store: s,
+		}
+
+		workers[i] = w
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			w.run()
+		}()
+	}
+
+	wg.Wait()
+
+	res := Result{
+		Duration: time.Since(start),
+	}
+
+	lats := make([]time.Duration, 0)
+
+	var err error
+
+	for _, w := range workers {
+		lats = append(lats, w.lats...)
+
+		res.Bytes += w.bytes
+		res.Errors += w.errors
+
+		if err == nil && w.err != nil {
+			err = w.err
+		}
+	}
+
+	sort.Slice(lats, func(i, j int) bool {
+		return lats[i] < lats[j]
+	})
+
+	res.Ops = len(lats)
+	res.P50 = percentile(lats, 0.5)
+	res.P99 = percentile(lats, 0.99)
+
+	if len(lats) > 0 {
+		res.Max = lats[len(lats)-1]
+	}
+
+	if err != nil {
+		return res, fmt.Errorf("bench: %w", err)
+	}
+	return res, nil
+}
@@ -0,0 +1,117 @@
+package bench
+
+import (
+	"crypto/sha256"
+	"os"
+	"testing"
+
+	"github.com/andrewpillar/fs"
+)
+
+func tmpdir(b testing.TB) string {
+	dir, err := os.MkdirTemp("", "bench")
+
+	if err != nil {
+		b.Fatal(err)
+	}
+	return dir
+}
+
+func benchmark(b *testing.B, wrap func(fs.FS) fs.FS, cfg Config) {
+	dir := tmpdir(b)
+	defer os.RemoveAll(dir)
+
+	store := wrap(fs.New(dir))
+
+	b.SetBytes(cfg.Size * int64(cfg.Workers*cfg.Files))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := Run(store, cfg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func nowrap(s fs.FS) fs.FS { return s }
+
+func chain(s fs.FS) fs.FS {
+	return fs.Limit(fs.Hash(fs.CacheStat(s, 0), sha256.New), 1<<30)
+}
+
+func Benchmark_SmallFileChurn(b *testing.B) {
+	benchmark(b, nowrap, Config{
+		Workers: 4,
+		Files:   64,
+		Size:    4 << 10,
+		Read:    true,
+		Remove:  true,
+	})
+}
+
+func Benchmark_LargeFileStreaming(b *testing.B) {
+	benchmark(b, nowrap, Config{
+		Workers: 1,
+		Files:   1,
+		Size:    64 << 20,
+		Read:    true,
+		Remove:  true,
+	})
+}
+
+func Benchmark_WrapperChain(b *testing.B) {
+	benchmark(b, chain, Config{
+		Workers: 4,
+		Files:   16,
+		Size:    1 << 20,
+		Read:    true,
+		Remove:  true,
+	})
+}
+
+func Test_File(t *testing.T) {
+	h1 := sha256.New()
+	h2 := sha256.New()
+
+	for _, h := range []interface{ Write([]byte) (int, error) }{h1, h2} {
+		f := File("file", 1<<20, 42)
+
+		buf := make([]byte, 4096)
+
+		for {
+			n, err := f.Read(buf)
+
+			h.Write(buf[:n])
+
+			if err != nil {
+				break
+			}
+		}
+	}
+
+	if string(h1.Sum(nil)) != string(h2.Sum(nil)) {
+		t.Fatal("expected files with the same seed to have the same content")
+	}
+}
+
+func Test_Run(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	res, err := Run(fs.New(dir), Config{
+		Workers: 2,
+		Files:   4,
+		Size:    1024,
+		Read:    true,
+		Remove:  true,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Ops != 24 {
+		t.Fatalf("unexpected ops, expected=%d, got=%d\n", 24, res.Ops)
+	}
+}
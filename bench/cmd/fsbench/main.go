@@ -0,0 +1,91 @@
+// Command fsbench generates load against a directory on the operating
+// system's filesystem, optionally wrapped in a chain of the wrappers provided
+// by the fs package, and reports the throughput and latency.
+package main
+
+import (
+	"crypto/sha256"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/andrewpillar/fs"
+	"github.com/andrewpillar/fs/bench"
+)
+
+func wrap(s fs.FS, chain string) (fs.FS, error) {
+	if chain == "" {
+		return s, nil
+	}
+
+	for _, name := range strings.Split(chain, ",") {
+		switch strings.TrimSpace(name) {
+		case "hash":
+			s = fs.Hash(s, sha256.New)
+		case "unique":
+			s = fs.Unique(s)
+		case "limit":
+			s = fs.Limit(s, 1<<40)
+		case "cache":
+			s = fs.CacheStat(s, time.Minute)
+		default:
+			return nil, fmt.Errorf("unknown wrapper %q", name)
+		}
+	}
+	return s, nil
+}
+
+func run(args []string) error {
+	var cfg bench.Config
+
+	var (
+		dir   string
+		chain string
+	)
+
+	fset := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	fset.StringVar(&dir, "dir", "", "directory to generate load in, defaults to a temporary directory")
+	fset.StringVar(&chain, "chain", "", "comma separated wrappers to apply, innermost first (hash, unique, limit, cache)")
+	fset.IntVar(&cfg.Workers, "workers", 4, "number of concurrent workers")
+	fset.IntVar(&cfg.Files, "files", 100, "number of files put by each worker")
+	fset.Int64Var(&cfg.Size, "size", 1<<20, "size of each file in bytes")
+	fset.Int64Var(&cfg.Seed, "seed", 1, "seed for generating file content")
+	fset.BoolVar(&cfg.Read, "read", false, "read back each file after it is put")
+	fset.BoolVar(&cfg.Remove, "remove", true, "remove each file once done with it")
+
+	if err := fset.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	if dir == "" {
+		tmp, err := os.MkdirTemp("", "fsbench-*")
+
+		if err != nil {
+			return err
+		}
+
+		defer os.RemoveAll(tmp)
+
+		dir = tmp
+	}
+
+	store, err := wrap(fs.New(dir), chain)
+
+	if err != nil {
+		return err
+	}
+
+	res, err := bench.Run(store, cfg)
+
+	fmt.Println(res)
+	return err
+}
+
+func main() {
+	if err := run(os.Args); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", os.Args[0], err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,297 @@
+package fs
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"math"
+	"strings"
+	"sync"
+)
+
+// bloomFilter is a counting bloom filter, so names can be removed as well as
+// added. Counters saturate rather than overflow, and a saturated counter is
+// never decremented.
+type bloomFilter struct {
+	counts []uint8
+	k      int
+}
+
+func newBloomFilter(n int, p float64) *bloomFilter {
+	if n < 1 {
+		n = 1
+	}
+	if p <= 0 || p >= 1 {
+		p = 0.01
+	}
+
+	m := int(math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2)))
+	k := int(math.Round(float64(m) / float64(n) * math.Ln2))
+
+	if k < 1 {
+		k = 1
+	}
+
+	return &bloomFilter{
+		counts: make([]uint8, m),
+		k:      k,
+	}
+}
+
+// indexes calls fn with each index of the given name, using double hashing of
+// the two halves of a 128 bit FNV hash.
+func (b *bloomFilter) indexes(name string, fn func(i int)) {
+	h := fnv.New128a()
+	h.Write([]byte(name))
+
+	sum := h.Sum(nil)
+
+	h1 := binary.BigEndian.Uint64(sum[:8])
+	h2 := binary.BigEndian.Uint64(sum[8:])
+
+	m := uint64(len(b.counts))
+
+	for i := 0; i < b.k; i++ {
+		fn(int((h1 + uint64(i)*h2) % m))
+	}
+}
+
+func (b *bloomFilter) add(name string) {
+	b.indexes(name, func(i int) {
+		if b.counts[i] < math.MaxUint8 {
+			b.counts[i]++
+		}
+	})
+}
+
+// remove removes the given name from the filter. Removing a name that was
+// never added could make other names appear missing, so only names the filter
+// may have are removed.
+func (b *bloomFilter) remove(name string) {
+	if !b.has(name) {
+		return
+	}
+
+	b.indexes(name, func(i int) {
+		if c := b.counts[i]; c > 0 && c < math.MaxUint8 {
+			b.counts[i]--
+		}
+	})
+}
+
+func (b *bloomFilter) has(name string) bool {
+	ok := true
+
+	b.indexes(name, func(i int) {
+		if b.counts[i] == 0 {
+			ok = false
+		}
+	})
+	return ok
+}
+
+type bloomFS struct {
+	FS
+
+	n int
+	p float64
+
+	mu     sync.Mutex
+	filter *bloomFilter
+}
+
+// Bloom returns a filesystem that keeps a bloom filter of the names of the
+// files in the given filesystem, so that Stat and Open of a file that does
+// not exist can usually return ErrNotExist without calling the underlying
+// filesystem. The filter is sized for n files with a false positive rate of
+// p. This is intended to sit beneath Unique, or any other wrapper that checks
+// whether a file exists before putting it.
+//
+// The filter is built from ReadDir on first use, and is kept up to date by
+// the calls to Put, Rename, Link, and Remove made through the returned
+// filesystem. Files added to the underlying filesystem by other means will
+// not be seen. If the filter cannot be built, then every call falls through
+// to the underlying filesystem until it can. Only files directly in the
+// filesystem are tracked, names containing a slash always fall through.
+func Bloom(s FS, n int, p float64) FS {
+	bs := &bloomFS{
+		FS: s,
+		n:  n,
+		p:  p,
+	}
+
+	if canRename(s) {
+		return renameBloomFS{bloomFS: bs}
+	}
+	return bs
+}
+
+// renameBloomFS is a bloomFS over a filesystem that implements RenameFS.
+type renameBloomFS struct {
+	*bloomFS
+}
+
+// load builds the filter if it has not been built. This must be called with
+// the lock held.
+func (s *bloomFS) load() bool {
+	if s.filter != nil {
+		return true
+	}
+
+	ents, err := ReadDir(s.FS, ".")
+
+	if err != nil {
+		return false
+	}
+
+	filter := newBloomFilter(s.n, s.p)
+
+	for _, ent := range ents {
+		if !ent.IsDir() {
+			filter.add(ent.Name())
+		}
+	}
+
+	s.filter = filter
+	return true
+}
+
+// tracked reports whether the named file is tracked by the filter. Only the
+// files in the root of the filesystem are, since the filter is built from its
+// entries.
+func tracked(name string) bool {
+	return !strings.Contains(name, "/")
+}
+
+// missing reports whether the named file is definitely not in the
+// filesystem.
+func (s *bloomFS) missing(name string) bool {
+	if !tracked(name) {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.load() {
+		return false
+	}
+	return !s.filter.has(name)
+}
+
+func (s *bloomFS) update(fn func(b *bloomFilter)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.filter != nil {
+		fn(s.filter)
+	}
+}
+
+func (s *bloomFS) Unwrap() FS { return s.FS }
+
+func (s *bloomFS) Open(name string) (File, error) {
+	if s.missing(name) {
+		return nil, &PathError{Op: "open", Path: name, Err: ErrNotExist}
+	}
+	return s.FS.Open(name)
+}
+
+func (s *bloomFS) Sub(dir string) (FS, error) {
+	sub, err := s.FS.Sub(dir)
+
+	if err != nil {
+		return nil, err
+	}
+	return Bloom(sub, s.n, s.p), nil
+}
+
+func (s *bloomFS) Stat(name string) (FileInfo, error) {
+	if s.missing(name) {
+		return nil, &PathError{Op: "stat", Path: name, Err: ErrNotExist}
+	}
+	return s.FS.Stat(name)
+}
+
+func (s *bloomFS) Put(f File) (File, error) {
+	stored, err := s.FS.Put(f)
+
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := stored.Stat()
+
+	if err != nil {
+		stored.Close()
+		return nil, err
+	}
+
+	s.update(func(b *bloomFilter) {
+		b.add(info.Name())
+	})
+	return stored, nil
+}
+
+func (s *bloomFS) ReadDir(name string) ([]DirEntry, error) {
+	return ReadDir(s.FS, name)
+}
+
+func (s renameBloomFS) Rename(oldname, newname string) error {
+	// Check whether newname exists first, so it is not counted twice if it is
+	// replaced.
+	_, err := s.Stat(newname)
+	replaced := err == nil
+
+	if err := Move(s.FS, oldname, newname); err != nil {
+		return err
+	}
+
+	s.update(func(b *bloomFilter) {
+		if tracked(oldname) {
+			b.remove(oldname)
+		}
+
+		if !replaced && tracked(newname) {
+			b.add(newname)
+		}
+	})
+	return nil
+}
+
+func (s *bloomFS) Link(oldname, newname string) error {
+	if err := Link(s.FS, oldname, newname); err != nil {
+		return err
+	}
+
+	if !tracked(newname) {
+		return nil
+	}
+
+	s.update(func(b *bloomFilter) {
+		b.add(newname)
+	})
+	return nil
+}
+
+func (s *bloomFS) Remove(name string) error {
+	if err := s.FS.Remove(name); err != nil {
+		return err
+	}
+
+	if !tracked(name) {
+		return nil
+	}
+
+	s.update(func(b *bloomFilter) {
+		b.remove(name)
+	})
+	return nil
+}
+
+func (s *bloomFS) Metadata(name string) (Metadata, error) {
+	return GetMetadata(s.FS, name)
+}
+
+func (s *bloomFS) SetMetadata(name string, md Metadata) error {
+	return SetMetadata(s.FS, name, md)
+}
@@ -0,0 +1,148 @@
+package fs
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strconv"
+	"testing"
+)
+
+// statCounter counts the calls made to Stat.
+type statCounter struct {
+	FS
+
+	stats int
+}
+
+func (s *statCounter) Stat(name string) (FileInfo, error) {
+	s.stats++
+	return s.FS.Stat(name)
+}
+
+func (s *statCounter) ReadDir(name string) ([]DirEntry, error) {
+	return ReadDir(s.FS, name)
+}
+
+func Test_Bloom(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	if err := os.WriteFile(dir+"/existing", nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	counter := &statCounter{FS: New(dir)}
+	store := Bloom(counter, 1000, 0.01)
+
+	if _, err := store.Stat("existing"); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := ReadFile("put", bytes.NewReader([]byte("data")))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := store.Put(f)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored.Close()
+
+	if _, err := store.Stat("put"); err != nil {
+		t.Fatal(err)
+	}
+
+	counter.stats = 0
+
+	for i := 0; i < 100; i++ {
+		if _, err := store.Stat("missing-" + strconv.Itoa(i)); !errors.Is(err, ErrNotExist) {
+			t.Fatalf("unexpected error, expected=%q, got=%v\n", ErrNotExist, err)
+		}
+	}
+
+	// With a 1% false positive rate, almost all of the lookups should have
+	// been answered by the filter.
+	if counter.stats > 10 {
+		t.Fatalf("unexpected stats, expected at most %d, got=%d\n", 10, counter.stats)
+	}
+
+	if err := store.Remove("put"); err != nil {
+		t.Fatal(err)
+	}
+
+	counter.stats = 0
+
+	if _, err := store.Stat("put"); !errors.Is(err, ErrNotExist) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", ErrNotExist, err)
+	}
+
+	if _, err := store.Stat("existing"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_BloomNested(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	if err := os.WriteFile(dir+"/existing", nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Mkdir(dir+"/sub", 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// A small filter, so nested names are likely to be false positives.
+	store := Bloom(New(dir), 1, 0.5)
+
+	if _, err := store.Stat("existing"); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 50; i++ {
+		name := "sub/file-" + strconv.Itoa(i)
+
+		if err := os.WriteFile(dir+"/"+name, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := store.Remove(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Removing the nested files must not remove the root file from the
+	// filter.
+	if _, err := store.Stat("existing"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_BloomFilter(t *testing.T) {
+	b := newBloomFilter(100, 0.01)
+
+	for i := 0; i < 100; i++ {
+		b.add(strconv.Itoa(i))
+	}
+
+	for i := 0; i < 100; i++ {
+		if !b.has(strconv.Itoa(i)) {
+			t.Fatalf("expected filter to have %d\n", i)
+		}
+	}
+
+	for i := 0; i < 50; i++ {
+		b.remove(strconv.Itoa(i))
+	}
+
+	for i := 50; i < 100; i++ {
+		if !b.has(strconv.Itoa(i)) {
+			t.Fatalf("expected filter to have %d after removing others\n", i)
+		}
+	}
+}
@@ -0,0 +1,390 @@
+package fs
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrBreakerOpen is the error returned by a filesystem wrapped via Breaker when
+// the breaker is open and there is no fallback.
+var ErrBreakerOpen = errors.New("circuit breaker open")
+
+// BreakerPolicy configures when a breaker trips, and how it recovers.
+type BreakerPolicy struct {
+	// Failures is the number of consecutive failures after which the breaker
+	// trips. Defaults to 5.
+	Failures int
+
+	// Cooldown is how long the breaker stays open before an operation is let
+	// through to probe the underlying filesystem. Defaults to 30 seconds.
+	Cooldown time.Duration
+
+	// Fallback is the filesystem operations are diverted to whilst the breaker
+	// is open. If nil, then operations fail with ErrBreakerOpen.
+	Fallback FS
+
+	// IsFailure reports whether the given error is a failure of the underlying
+	// filesystem. By default, errors that are the result of the operation
+	// itself, such as ErrNotExist, ErrExist, ErrPermission, ErrInvalid,
+	// ErrUnsupported, and SizeError, are not failures.
+	IsFailure func(err error) bool
+}
+
+func isBackendFailure(err error) bool {
+	switch {
+	case errors.Is(err, ErrNotExist),
+		errors.Is(err, ErrExist),
+		errors.Is(err, ErrPermission),
+		errors.Is(err, ErrInvalid),
+		errors.Is(err, ErrUnsupported),
+		errors.Is(err, SizeError{}):
+		return false
+	}
+	return true
+}
+
+// breakerState is the state of a breaker, shared between a filesystem and all
+// of its sub filesystems.
+type breakerState struct {
+	policy BreakerPolicy
+	now    func() time.Time
+
+	mu       sync.Mutex
+	failures int
+	open     bool
+	openedAt time.Time
+	probing  bool
+	probedAt time.Time
+	probe    int64
+}
+
+// allow reports whether an operation can be made on the underlying
+// filesystem, and if so, the ID of the probe if that operation is a probe,
+// otherwise 0. A probe that has not finished within the cooldown is treated as
+// having failed when it was made, so a probe that hangs does not keep the
+// breaker open forever.
+func (b *breakerState) allow() (int64, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.open {
+		return 0, true
+	}
+
+	now := b.now()
+
+	if b.probing {
+		if now.Sub(b.probedAt) < b.policy.Cooldown {
+			return 0, false
+		}
+
+		b.probing = false
+		b.openedAt = b.probedAt
+	}
+
+	if now.Sub(b.openedAt) < b.policy.Cooldown {
+		return 0, false
+	}
+
+	b.probing = true
+	b.probedAt = now
+	b.probe++
+
+	return b.probe, true
+}
+
+// done records the result of an operation made on the underlying filesystem.
+// The result of a probe that was given up on is ignored.
+func (b *breakerState) done(probe int64, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	failed := err != nil && b.policy.IsFailure(err)
+
+	if probe != 0 {
+		if !b.probing || probe != b.probe {
+			return
+		}
+
+		b.probing = false
+
+		if failed {
+			b.openedAt = b.now()
+			return
+		}
+
+		b.open = false
+		b.failures = 0
+		return
+	}
+
+	if !failed {
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+
+	if !b.open && b.failures >= b.policy.Failures {
+		b.open = true
+		b.openedAt = b.now()
+	}
+}
+
+type breaker struct {
+	FS
+
+	fallback FS
+	state    *breakerState
+
+	// pending is set for a breaker returned from Sub whilst the breaker was
+	// open, and takes the sub filesystem of the underlying filesystem once
+	// the breaker lets an operation through.
+	pending *pendingSub
+
+	// rename is whether the underlying filesystem, and the fallback if any,
+	// implement RenameFS.
+	rename bool
+}
+
+// renameBreaker is a breaker that implements RenameFS.
+type renameBreaker struct {
+	*breaker
+}
+
+// wrap returns the breaker as a renameBreaker if it can rename files.
+func (s *breaker) wrap() FS {
+	if s.rename {
+		return renameBreaker{breaker: s}
+	}
+	return s
+}
+
+// pendingSub is a sub filesystem of the underlying filesystem that is yet to be
+// taken.
+type pendingSub struct {
+	parent func() (FS, error)
+	dir    string
+
+	mu  sync.Mutex
+	sub FS
+}
+
+func (p *pendingSub) get() (FS, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.sub == nil {
+		parent, err := p.parent()
+
+		if err != nil {
+			return nil, err
+		}
+
+		sub, err := parent.Sub(p.dir)
+
+		if err != nil {
+			return nil, err
+		}
+		p.sub = sub
+	}
+	return p.sub, nil
+}
+
+// Breaker returns a filesystem that stops making operations on the given
+// filesystem once they have failed a number of times in a row, as configured
+// by the given policy. Whilst the breaker is open operations fail fast with
+// ErrBreakerOpen, or are diverted to the fallback filesystem if one is
+// configured. Once the cooldown has passed a single operation is let through
+// as a probe, if it succeeds then the breaker is closed, otherwise it stays
+// open for another cooldown. A probe that does not return within the cooldown
+// is treated as failed.
+//
+// The breaker is shared with each filesystem returned from Sub. If the breaker
+// is open when Sub is called, then the sub filesystem of the underlying
+// filesystem is taken once the breaker lets an operation through.
+func Breaker(s FS, policy BreakerPolicy) FS {
+	if policy.Failures <= 0 {
+		policy.Failures = 5
+	}
+	if policy.Cooldown <= 0 {
+		policy.Cooldown = 30 * time.Second
+	}
+	if policy.IsFailure == nil {
+		policy.IsFailure = isBackendFailure
+	}
+
+	b := &breaker{
+		FS:       s,
+		fallback: policy.Fallback,
+		state: &breakerState{
+			policy: policy,
+			now:    time.Now,
+		},
+		rename: canRename(s) && (policy.Fallback == nil || canRename(policy.Fallback)),
+	}
+	return b.wrap()
+}
+
+// primary returns the underlying filesystem.
+func (s *breaker) primary() (FS, error) {
+	if s.pending == nil {
+		return s.FS, nil
+	}
+	return s.pending.get()
+}
+
+// breakerDo calls fn with the underlying filesystem if the breaker allows it,
+// otherwise with the fallback.
+func breakerDo[T any](s *breaker, op, name string, fn func(FS) (T, error)) (T, error) {
+	probe, ok := s.state.allow()
+
+	if !ok {
+		if s.fallback != nil {
+			return fn(s.fallback)
+		}
+
+		var zero T
+		return zero, &PathError{Op: op, Path: name, Err: ErrBreakerOpen}
+	}
+
+	primary, err := s.primary()
+
+	if err != nil {
+		s.state.done(probe, err)
+
+		var zero T
+		return zero, err
+	}
+
+	v, err := fn(primary)
+	s.state.done(probe, err)
+
+	return v, err
+}
+
+// Unwrap returns the underlying filesystem, or nil if it is a sub filesystem
+// that is yet to be taken.
+func (s *breaker) Unwrap() FS {
+	if s.pending == nil {
+		return s.FS
+	}
+
+	s.pending.mu.Lock()
+	defer s.pending.mu.Unlock()
+
+	return s.pending.sub
+}
+
+func (s *breaker) Open(name string) (File, error) {
+	return breakerDo(s, "open", name, func(s FS) (File, error) {
+		return s.Open(name)
+	})
+}
+
+func (s *breaker) Sub(dir string) (FS, error) {
+	var fallback FS
+
+	if s.fallback != nil {
+		sub, err := s.fallback.Sub(dir)
+
+		if err != nil {
+			return nil, err
+		}
+		fallback = sub
+	}
+
+	probe, ok := s.state.allow()
+
+	if !ok {
+		b := &breaker{
+			fallback: fallback,
+			state:    s.state,
+			pending: &pendingSub{
+				parent: s.primary,
+				dir:    dir,
+			},
+			rename: s.rename,
+		}
+		return b.wrap(), nil
+	}
+
+	primary, err := s.primary()
+
+	if err == nil {
+		primary, err = primary.Sub(dir)
+	}
+
+	s.state.done(probe, err)
+
+	if err != nil {
+		return nil, err
+	}
+
+	b := &breaker{
+		FS:       primary,
+		fallback: fallback,
+		state:    s.state,
+		rename:   canRename(primary) && (fallback == nil || canRename(fallback)),
+	}
+	return b.wrap(), nil
+}
+
+func (s *breaker) Stat(name string) (FileInfo, error) {
+	return breakerDo(s, "stat", name, func(s FS) (FileInfo, error) {
+		return s.Stat(name)
+	})
+}
+
+func (s *breaker) Put(f File) (File, error) {
+	info, err := f.Stat()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return breakerDo(s, "put", info.Name(), func(s FS) (File, error) {
+		return s.Put(f)
+	})
+}
+
+func (s *breaker) ReadDir(name string) ([]DirEntry, error) {
+	return breakerDo(s, "readdir", name, func(s FS) ([]DirEntry, error) {
+		return ReadDir(s, name)
+	})
+}
+
+func (s renameBreaker) Rename(oldname, newname string) error {
+	_, err := breakerDo(s.breaker, "rename", oldname, func(s FS) (struct{}, error) {
+		return struct{}{}, Move(s, oldname, newname)
+	})
+	return err
+}
+
+func (s *breaker) Link(oldname, newname string) error {
+	_, err := breakerDo(s, "link", oldname, func(s FS) (struct{}, error) {
+		return struct{}{}, Link(s, oldname, newname)
+	})
+	return err
+}
+
+func (s *breaker) Remove(name string) error {
+	_, err := breakerDo(s, "remove", name, func(s FS) (struct{}, error) {
+		return struct{}{}, s.Remove(name)
+	})
+	return err
+}
+
+func (s *breaker) Metadata(name string) (Metadata, error) {
+	return breakerDo(s, "metadata", name, func(s FS) (Metadata, error) {
+		return GetMetadata(s, name)
+	})
+}
+
+func (s *breaker) SetMetadata(name string, md Metadata) error {
+	_, err := breakerDo(s, "setmetadata", name, func(s FS) (struct{}, error) {
+		return struct{}{}, SetMetadata(s, name, md)
+	})
+	return err
+}
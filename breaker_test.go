@@ -0,0 +1,254 @@
+package fs
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+// downFS fails every Stat whilst down is true.
+type downFS struct {
+	FS
+
+	down  bool
+	calls int
+}
+
+var errDown = errors.New("backend down")
+
+func (s *downFS) Stat(name string) (FileInfo, error) {
+	s.calls++
+
+	if s.down {
+		return nil, &PathError{Op: "stat", Path: name, Err: errDown}
+	}
+	return s.FS.Stat(name)
+}
+
+// hangFS blocks a Stat until released whilst hang is set, otherwise fails
+// every Stat with err if set.
+type hangFS struct {
+	FS
+
+	err     error
+	hang    chan struct{}
+	started chan struct{}
+}
+
+func (s *hangFS) Stat(name string) (FileInfo, error) {
+	if s.hang != nil {
+		hang := s.hang
+
+		s.started <- struct{}{}
+		<-hang
+
+		return nil, &PathError{Op: "stat", Path: name, Err: errDown}
+	}
+
+	if s.err != nil {
+		return nil, &PathError{Op: "stat", Path: name, Err: s.err}
+	}
+	return s.FS.Stat(name)
+}
+
+func Test_Breaker(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	if err := os.WriteFile(dir+"/file", []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	down := &downFS{FS: New(dir), down: true}
+
+	store := Breaker(down, BreakerPolicy{
+		Failures: 3,
+		Cooldown: time.Minute,
+	})
+
+	now := time.Now()
+	store.(*breaker).state.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if _, err := store.Stat("file"); !errors.Is(err, errDown) {
+			t.Fatalf("unexpected error, expected=%q, got=%v\n", errDown, err)
+		}
+	}
+
+	if _, err := store.Stat("file"); !errors.Is(err, ErrBreakerOpen) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", ErrBreakerOpen, err)
+	}
+
+	if down.calls != 3 {
+		t.Fatalf("unexpected calls, expected=%d, got=%d\n", 3, down.calls)
+	}
+
+	// Probe after the cooldown, which fails, so the breaker stays open.
+	now = now.Add(time.Minute)
+
+	if _, err := store.Stat("file"); !errors.Is(err, errDown) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", errDown, err)
+	}
+
+	if _, err := store.Stat("file"); !errors.Is(err, ErrBreakerOpen) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", ErrBreakerOpen, err)
+	}
+
+	// Probe after the cooldown, which succeeds, so the breaker closes.
+	now = now.Add(time.Minute)
+	down.down = false
+
+	for i := 0; i < 2; i++ {
+		if _, err := store.Stat("file"); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func Test_BreakerNotFailure(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	store := Breaker(New(dir), BreakerPolicy{Failures: 1})
+
+	for i := 0; i < 3; i++ {
+		if _, err := store.Stat("missing"); !errors.Is(err, ErrNotExist) {
+			t.Fatalf("unexpected error, expected=%q, got=%v\n", ErrNotExist, err)
+		}
+	}
+}
+
+func Test_BreakerFallback(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	fallback := tmpdir(t)
+	defer os.RemoveAll(fallback)
+
+	if err := os.WriteFile(fallback+"/file", []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	store := Breaker(&downFS{FS: New(dir), down: true}, BreakerPolicy{
+		Failures: 1,
+		Fallback: New(fallback),
+	})
+
+	if _, err := store.Stat("file"); !errors.Is(err, errDown) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", errDown, err)
+	}
+
+	if _, err := store.Stat("file"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_BreakerHungProbe(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	if err := os.WriteFile(dir+"/file", []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	hang := &hangFS{
+		FS:      New(dir),
+		err:     errDown,
+		started: make(chan struct{}),
+	}
+
+	store := Breaker(hang, BreakerPolicy{
+		Failures: 1,
+		Cooldown: time.Minute,
+	})
+
+	now := time.Now()
+	store.(*breaker).state.now = func() time.Time { return now }
+
+	if _, err := store.Stat("file"); !errors.Is(err, errDown) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", errDown, err)
+	}
+
+	now = now.Add(time.Minute)
+
+	release := make(chan struct{})
+	hang.hang = release
+
+	go store.Stat("file")
+
+	<-hang.started
+
+	hang.hang = nil
+	hang.err = nil
+
+	if _, err := store.Stat("file"); !errors.Is(err, ErrBreakerOpen) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", ErrBreakerOpen, err)
+	}
+
+	// The probe has not returned within the cooldown, so another probe is let
+	// through, which succeeds.
+	now = now.Add(time.Minute)
+
+	if _, err := store.Stat("file"); err != nil {
+		t.Fatal(err)
+	}
+
+	close(release)
+
+	if _, err := store.Stat("file"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_BreakerSubOpen(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	fallback := tmpdir(t)
+	defer os.RemoveAll(fallback)
+
+	for _, dir := range []string{dir, fallback} {
+		if err := os.MkdirAll(dir+"/sub", 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := os.WriteFile(dir+"/sub/file", []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	down := &downFS{FS: New(dir), down: true}
+
+	store := Breaker(down, BreakerPolicy{
+		Failures: 1,
+		Cooldown: time.Minute,
+		Fallback: New(fallback),
+	})
+
+	now := time.Now()
+	store.(*breaker).state.now = func() time.Time { return now }
+
+	if _, err := store.Stat("file"); !errors.Is(err, errDown) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", errDown, err)
+	}
+
+	sub, err := store.Sub("sub")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := sub.Stat("file"); !errors.Is(err, ErrNotExist) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", ErrNotExist, err)
+	}
+
+	// Once the breaker closes, the sub should use the underlying filesystem
+	// rather than the fallback.
+	now = now.Add(time.Minute)
+	down.down = false
+
+	if _, err := sub.Stat("file"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,226 @@
+package fs
+
+import (
+	"errors"
+	"path"
+	"sync"
+	"time"
+)
+
+// maxStatEntries is the number of cached entries the cache is bounded to. Once
+// reached, expired entries are swept from the cache, and if none have expired
+// then the entry closest to expiring is evicted.
+const maxStatEntries = 4096
+
+type statEntry struct {
+	info    FileInfo
+	err     error
+	expires time.Time
+}
+
+// statTable is the table of cached entries shared by a statCache and each of
+// its subs, keyed by the full path of the file.
+type statTable struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]statEntry
+	hits    int64
+	misses  int64
+}
+
+type statCache struct {
+	FS
+	*statTable
+
+	dir string
+}
+
+// CacheStat returns a filesystem that caches the results of Stat for the given
+// duration. Both successful lookups and lookups that return ErrNotExist are
+// cached. Entries are invalidated when a file of the same name is put,
+// renamed, or removed via the returned filesystem, or via any filesystem
+// returned from its Sub, since they all share the same cache. Changes made to
+// the underlying filesystem by other means will not be seen until the entry
+// expires.
+func CacheStat(s FS, ttl time.Duration) FS {
+	return newStatCache(s, &statTable{
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[string]statEntry),
+	}, ".")
+}
+
+// renameStatCache is a statCache over a filesystem that implements RenameFS.
+type renameStatCache struct {
+	*statCache
+}
+
+func newStatCache(s FS, table *statTable, dir string) FS {
+	sc := &statCache{
+		FS:        s,
+		statTable: table,
+		dir:       dir,
+	}
+
+	if canRename(s) {
+		return renameStatCache{statCache: sc}
+	}
+	return sc
+}
+
+// key returns the key of the given name in the shared table.
+func (s *statCache) key(name string) string {
+	return path.Join(s.dir, name)
+}
+
+func (s *statCache) lookup(name string) (statEntry, bool) {
+	key := s.key(name)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[key]
+
+	if !ok {
+		s.misses++
+		return e, false
+	}
+
+	if !s.now().Before(e.expires) {
+		delete(s.entries, key)
+		s.misses++
+		return e, false
+	}
+
+	s.hits++
+	return e, true
+}
+
+func (s *statCache) store(name string, info FileInfo, err error) {
+	key := s.key(name)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+
+	if _, ok := s.entries[key]; !ok && len(s.entries) >= maxStatEntries {
+		var (
+			oldest  string
+			expires time.Time
+		)
+
+		for k, e := range s.entries {
+			if !now.Before(e.expires) {
+				delete(s.entries, k)
+				continue
+			}
+
+			if oldest == "" || e.expires.Before(expires) {
+				oldest, expires = k, e.expires
+			}
+		}
+
+		if len(s.entries) >= maxStatEntries {
+			delete(s.entries, oldest)
+		}
+	}
+
+	s.entries[key] = statEntry{
+		info:    info,
+		err:     err,
+		expires: now.Add(s.ttl),
+	}
+}
+
+func (s *statCache) invalidate(names ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, name := range names {
+		delete(s.entries, s.key(name))
+	}
+}
+
+func (s *statCache) Unwrap() FS { return s.FS }
+
+func (s *statCache) Sub(dir string) (FS, error) {
+	sub, err := s.FS.Sub(dir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return newStatCache(sub, s.statTable, s.key(dir)), nil
+}
+
+func (s *statCache) Stat(name string) (FileInfo, error) {
+	if e, ok := s.lookup(name); ok {
+		return e.info, e.err
+	}
+
+	info, err := s.FS.Stat(name)
+
+	if err == nil || errors.Is(err, ErrNotExist) {
+		s.store(name, info, err)
+	}
+	return info, err
+}
+
+func (s *statCache) Put(f File) (File, error) {
+	info, err := f.Stat()
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer s.invalidate(info.Name())
+
+	return s.FS.Put(f)
+}
+
+func (s *statCache) ReadDir(name string) ([]DirEntry, error) {
+	return ReadDir(s.FS, name)
+}
+
+func (s renameStatCache) Rename(oldname, newname string) error {
+	defer s.invalidate(oldname, newname)
+
+	return Move(s.FS, oldname, newname)
+}
+
+func (s *statCache) Metadata(name string) (Metadata, error) {
+	return GetMetadata(s.FS, name)
+}
+
+func (s *statCache) SetMetadata(name string, md Metadata) error {
+	return SetMetadata(s.FS, name, md)
+}
+
+func (s *statCache) Remove(name string) error {
+	defer s.invalidate(name)
+
+	return s.FS.Remove(name)
+}
+
+// Debug returns the number of cached entries, and the hits and misses of the
+// cache.
+func (s *statCache) Debug() map[string]any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var rate float64
+
+	if total := s.hits + s.misses; total > 0 {
+		rate = float64(s.hits) / float64(total)
+	}
+
+	return map[string]any{
+		"entries":  len(s.entries),
+		"hits":     s.hits,
+		"misses":   s.misses,
+		"hit_rate": rate,
+	}
+}
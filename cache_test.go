@@ -0,0 +1,111 @@
+package fs
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func Test_CacheStat(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	now := time.Now()
+
+	store := CacheStat(New(dir), time.Minute)
+	store.(renameStatCache).now = func() time.Time { return now }
+
+	if _, err := store.Stat("file"); !errors.Is(err, ErrNotExist) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", ErrNotExist, err)
+	}
+
+	// Created behind the cache's back, so the negative lookup should still be
+	// cached.
+	if err := os.WriteFile(filepath.Join(dir, "file"), []byte("data"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.Stat("file"); !errors.Is(err, ErrNotExist) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", ErrNotExist, err)
+	}
+
+	now = now.Add(time.Minute)
+
+	if _, err := store.Stat("file"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Remove("file"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.Stat("file"); !errors.Is(err, ErrNotExist) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", ErrNotExist, err)
+	}
+
+	f, err := ReadFile("file", bytes.NewReader([]byte("data")))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.Put(f); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.Stat("file"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_CacheStatSub(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	store := CacheStat(New(dir), time.Minute)
+
+	if _, err := store.Stat("sub/file"); !errors.Is(err, ErrNotExist) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", ErrNotExist, err)
+	}
+
+	sub, err := store.Sub("sub")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := ReadFile("file", bytes.NewReader([]byte("data")))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := sub.Put(f); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.Stat("sub/file"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_CacheStatBounded(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	store := CacheStat(New(dir), time.Minute)
+
+	for i := 0; i < maxStatEntries+10; i++ {
+		if _, err := store.Stat("file" + strconv.Itoa(i)); !errors.Is(err, ErrNotExist) {
+			t.Fatalf("unexpected error, expected=%q, got=%v\n", ErrNotExist, err)
+		}
+	}
+
+	if n := len(store.(renameStatCache).entries); n > maxStatEntries {
+		t.Fatalf("unexpected entries, expected=%d, got=%d\n", maxStatEntries, n)
+	}
+}
@@ -0,0 +1,486 @@
+// Package cdc implements an FS that deduplicates the content of the files put
+// into it at the level of chunks rather than whole files.
+//
+// Files are split into chunks with content-defined chunking, see Chunker,
+// and each chunk is stored once against the SHA256 hash of its content. Each
+// file is stored as a manifest of the chunks that make it up. Files that share
+// most of their content, such as successive backups of a database or disk
+// image, share most of their chunks, for example,
+//
+//	store, err := cdc.New(fs.New("/var/lib/backups"))
+//
+//	if err != nil {
+//		return err
+//	}
+//
+//	// Each dump only stores the chunks that differ from the previous.
+//	if _, err := fs.PutPath(store, "db/2024-01-02.sql", dump); err != nil {
+//		return err
+//	}
+//
+// Removing a file only removes its manifest, the chunks that are no longer
+// referenced by any file are removed by GC.
+package cdc
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"path"
+	"time"
+
+	"github.com/andrewpillar/fs"
+)
+
+const (
+	chunksDir = "chunks"
+	filesDir  = "files"
+)
+
+// ChecksumError is returned when a chunk read back from the store does not
+// match the hash it was stored against.
+type ChecksumError struct {
+	Chunk string
+}
+
+func (e ChecksumError) Error() string {
+	return "chunk " + e.Chunk + " is corrupt"
+}
+
+// Chunk is a chunk of a file.
+type Chunk struct {
+	Hash string `json:"hash"`
+	Size int64  `json:"size"`
+}
+
+// Manifest is the record of a file stored in a Store.
+type Manifest struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	Chunks  []Chunk   `json:"chunks"`
+}
+
+// Store is an FS that stores the files put into it as chunks.
+type Store struct {
+	chunks fs.FS
+	files  fs.FS
+	dir    string
+
+	min, avg, max int
+}
+
+var (
+	_ fs.FS        = (*Store)(nil)
+	_ fs.ReadDirFS = (*Store)(nil)
+)
+
+// Option configures a Store.
+type Option func(*Store)
+
+// ChunkSize sets the minimum, average, and maximum size of the chunks files
+// are split into. The defaults are 16KB, 64KB, and 256KB. Smaller chunks find
+// more duplicate content, at the cost of larger manifests.
+func ChunkSize(min, avg, max int) Option {
+	return func(s *Store) {
+		if min > 0 && min <= avg && avg <= max {
+			s.min = min
+			s.avg = avg
+			s.max = max
+		}
+	}
+}
+
+// New returns a Store that keeps its chunks and manifests in the given FS.
+func New(s fs.FS, opts ...Option) (*Store, error) {
+	chunks, err := s.Sub(chunksDir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := s.Sub(filesDir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	st := &Store{
+		chunks: chunks,
+		files:  files,
+		dir:    ".",
+		min:    16 << 10,
+		avg:    64 << 10,
+		max:    256 << 10,
+	}
+
+	for _, opt := range opts {
+		opt(st)
+	}
+	return st, nil
+}
+
+// chunkPath returns the path of the chunk with the given hash, fanned out by
+// its first two characters.
+func chunkPath(hash string) string {
+	return path.Join(hash[:2], hash)
+}
+
+// Manifest returns the manifest of the named file.
+func (s *Store) Manifest(name string) (*Manifest, error) {
+	f, err := s.files.Open(name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	info, err := f.Stat()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if info.IsDir() {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	var m Manifest
+
+	if err := json.NewDecoder(f).Decode(&m); err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return &m, nil
+}
+
+func (s *Store) Open(name string) (fs.File, error) {
+	info, err := s.files.Stat(name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if info.IsDir() {
+		return s.files.Open(name)
+	}
+
+	m, err := s.Manifest(name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &file{
+		chunkReader: &chunkReader{
+			chunks: s.chunks,
+			left:   m.Chunks,
+		},
+		info: &fileInfo{
+			name: path.Base(name),
+			m:    m,
+		},
+	}, nil
+}
+
+func (s *Store) Sub(dir string) (fs.FS, error) {
+	files, err := s.files.Sub(dir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	sub := *s
+	sub.files = files
+	sub.dir = path.Join(s.dir, dir)
+
+	return &sub, nil
+}
+
+func (s *Store) Stat(name string) (fs.FileInfo, error) {
+	info, err := s.files.Stat(name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if info.IsDir() {
+		return info, nil
+	}
+
+	m, err := s.Manifest(name)
+
+	if err != nil {
+		return nil, err
+	}
+	return &fileInfo{name: path.Base(name), m: m}, nil
+}
+
+// putChunk stores the given chunk if it is not already stored.
+func (s *Store) putChunk(p []byte) (Chunk, error) {
+	sum := sha256.Sum256(p)
+
+	c := Chunk{
+		Hash: hex.EncodeToString(sum[:]),
+		Size: int64(len(p)),
+	}
+
+	name := chunkPath(c.Hash)
+
+	if _, err := s.chunks.Stat(name); err == nil {
+		return c, nil
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return c, err
+	}
+
+	f, err := fs.ReadFile(c.Hash, bytes.NewReader(p))
+
+	if err != nil {
+		return c, err
+	}
+
+	defer fs.Cleanup(f)
+
+	stored, err := fs.PutPath(s.chunks, name, f)
+
+	if err != nil {
+		return c, err
+	}
+	return c, stored.Close()
+}
+
+// Put splits the file into chunks, stores the chunks not already stored, and
+// then stores the manifest of the file.
+func (s *Store) Put(f fs.File) (fs.File, error) {
+	info, err := f.Stat()
+
+	if err != nil {
+		return nil, err
+	}
+
+	name := info.Name()
+
+	m := &Manifest{
+		ModTime: info.ModTime(),
+		Chunks:  make([]Chunk, 0),
+	}
+
+	chunker := NewChunker(f, s.min, s.avg, s.max)
+
+	for {
+		p, err := chunker.Next()
+
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, &fs.PathError{Op: "put", Path: name, Err: err}
+		}
+
+		c, err := s.putChunk(p)
+
+		if err != nil {
+			return nil, err
+		}
+
+		m.Size += c.Size
+		m.Chunks = append(m.Chunks, c)
+	}
+
+	b, err := json.Marshal(m)
+
+	if err != nil {
+		return nil, err
+	}
+
+	mf, err := fs.ReadFile(name, bytes.NewReader(b))
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer fs.Cleanup(mf)
+
+	stored, err := s.files.Put(mf)
+
+	if err != nil {
+		return nil, err
+	}
+	stored.Close()
+
+	return s.Open(name)
+}
+
+// Remove removes the manifest of the named file. The chunks of the file are
+// left in place until GC is called.
+func (s *Store) Remove(name string) error {
+	return s.files.Remove(name)
+}
+
+func (s *Store) ReadDir(name string) ([]fs.DirEntry, error) {
+	ents, err := fs.ReadDir(s.files, name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for i, ent := range ents {
+		ents[i] = &dirEntry{
+			DirEntry: ent,
+			s:        s,
+			name:     path.Join(name, ent.Name()),
+		}
+	}
+	return ents, nil
+}
+
+// GC removes the chunks that are not referenced by any file in the store, and
+// returns the number of chunks removed. This must be called on the Store
+// returned from New rather than a Sub of it, and must not be called while
+// files are being put, since the chunks of a file being put are not
+// referenced until its manifest is stored.
+func (s *Store) GC() (int, error) {
+	if s.dir != "." {
+		return 0, &fs.PathError{Op: "gc", Path: s.dir, Err: fs.ErrInvalid}
+	}
+
+	refs := make(map[string]struct{})
+
+	err := fs.Walk(s.files, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			return nil
+		}
+
+		m, err := s.Manifest(name)
+
+		if err != nil {
+			return err
+		}
+
+		for _, c := range m.Chunks {
+			refs[c.Hash] = struct{}{}
+		}
+		return nil
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+
+	err = fs.Walk(s.chunks, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			return nil
+		}
+
+		if _, ok := refs[path.Base(name)]; ok {
+			return nil
+		}
+
+		if err := s.chunks.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+
+		n++
+		return nil
+	})
+	return n, err
+}
+
+// chunkReader reads the content of a file back from its chunks, verifying
+// each chunk against its hash as it is read.
+type chunkReader struct {
+	chunks fs.FS
+	left   []Chunk
+	cur    *bytes.Reader
+}
+
+func (r *chunkReader) next() error {
+	c := r.left[0]
+	r.left = r.left[1:]
+
+	f, err := r.chunks.Open(chunkPath(c.Hash))
+
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	b, err := io.ReadAll(f)
+
+	if err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(b)
+
+	if hex.EncodeToString(sum[:]) != c.Hash {
+		return ChecksumError{Chunk: c.Hash}
+	}
+
+	r.cur = bytes.NewReader(b)
+	return nil
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for r.cur == nil || r.cur.Len() == 0 {
+		if len(r.left) == 0 {
+			return 0, io.EOF
+		}
+
+		if err := r.next(); err != nil {
+			return 0, err
+		}
+	}
+	return r.cur.Read(p)
+}
+
+// file is a file read back from its chunks.
+type file struct {
+	*chunkReader
+
+	info *fileInfo
+}
+
+func (f *file) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *file) Close() error               { return nil }
+
+type fileInfo struct {
+	name string
+	m    *Manifest
+}
+
+func (fi *fileInfo) Name() string       { return fi.name }
+func (fi *fileInfo) Size() int64        { return fi.m.Size }
+func (fi *fileInfo) Mode() fs.FileMode  { return fs.FileMode(0400) }
+func (fi *fileInfo) ModTime() time.Time { return fi.m.ModTime }
+func (fi *fileInfo) IsDir() bool        { return false }
+func (fi *fileInfo) Sys() any           { return fi.m }
+
+// dirEntry reports the size of a file from its manifest rather than the size
+// of the manifest itself.
+type dirEntry struct {
+	fs.DirEntry
+
+	s    *Store
+	name string
+}
+
+func (e *dirEntry) Info() (fs.FileInfo, error) {
+	if e.IsDir() {
+		return e.DirEntry.Info()
+	}
+	return e.s.Stat(e.name)
+}
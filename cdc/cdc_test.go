@@ -0,0 +1,238 @@
+package cdc
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/andrewpillar/fs"
+	"github.com/andrewpillar/fs/fakefs"
+)
+
+func random(n int) []byte {
+	b := make([]byte, n)
+	rand.New(rand.NewSource(1)).Read(b)
+	return b
+}
+
+func put(t *testing.T, s fs.FS, name string, content []byte) {
+	f, err := fs.ReadFile(name, bytes.NewReader(content))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := fs.PutPath(s, name, f)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored.Close()
+}
+
+func read(t *testing.T, s fs.FS, name string) []byte {
+	f, err := s.Open(name)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	b, err := io.ReadAll(f)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func countChunks(t *testing.T, s fs.FS) int {
+	n := 0
+
+	err := fs.Walk(s, chunksDir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			n++
+		}
+		return nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func Test_Chunker(t *testing.T) {
+	b := random(1 << 20)
+
+	chunks := func(b []byte) map[string]struct{} {
+		set := make(map[string]struct{})
+
+		c := NewChunker(bytes.NewReader(b), 2<<10, 8<<10, 32<<10)
+
+		total := 0
+
+		for {
+			p, err := c.Next()
+
+			if err != nil {
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				t.Fatal(err)
+			}
+
+			total += len(p)
+
+			if len(p) > 32<<10 {
+				t.Fatalf("unexpected chunk size, expected at most=%d, got=%d\n", 32<<10, len(p))
+			}
+			set[string(p)] = struct{}{}
+		}
+
+		if total != len(b) {
+			t.Fatalf("unexpected total size, expected=%d, got=%d\n", len(b), total)
+		}
+		return set
+	}
+
+	before := chunks(b)
+
+	edited := append(append(b[:500000:500000], "inserted"...), b[500000:]...)
+
+	after := chunks(edited)
+
+	changed := 0
+
+	for p := range after {
+		if _, ok := before[p]; !ok {
+			changed++
+		}
+	}
+
+	// Only the chunks around the insertion should differ.
+	if changed > 2 {
+		t.Fatalf("unexpected changed chunks, expected at most=%d, got=%d\n", 2, changed)
+	}
+}
+
+func Test_Store(t *testing.T) {
+	backend := fakefs.New()
+
+	s, err := New(backend, ChunkSize(2<<10, 8<<10, 32<<10))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := random(256 << 10)
+	b := append(append(a[:100000:100000], "inserted"...), a[100000:]...)
+
+	put(t, s, "dumps/a", a)
+
+	n := countChunks(t, backend)
+
+	put(t, s, "dumps/b", b)
+
+	if added := countChunks(t, backend) - n; added > 2 {
+		t.Fatalf("unexpected chunks added, expected at most=%d, got=%d\n", 2, added)
+	}
+
+	if got := read(t, s, "dumps/a"); !bytes.Equal(got, a) {
+		t.Fatalf("unexpected content for %q\n", "dumps/a")
+	}
+
+	if got := read(t, s, "dumps/b"); !bytes.Equal(got, b) {
+		t.Fatalf("unexpected content for %q\n", "dumps/b")
+	}
+
+	info, err := s.Stat("dumps/b")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Size() != int64(len(b)) {
+		t.Fatalf("unexpected size, expected=%d, got=%d\n", len(b), info.Size())
+	}
+
+	ents, err := s.ReadDir("dumps")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ents) != 2 {
+		t.Fatalf("unexpected entries, expected=%d, got=%d\n", 2, len(ents))
+	}
+
+	if info, err := ents[0].Info(); err != nil || info.Size() != int64(len(a)) {
+		t.Fatalf("unexpected entry info, expected size=%d, got=%v (%v)\n", len(a), info, err)
+	}
+
+	if err := s.Remove("dumps/a"); err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := s.GC()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if removed == 0 || removed > 2 {
+		t.Fatalf("unexpected chunks removed, expected between=%d and %d, got=%d\n", 1, 2, removed)
+	}
+
+	if got := read(t, s, "dumps/b"); !bytes.Equal(got, b) {
+		t.Fatalf("unexpected content for %q after gc\n", "dumps/b")
+	}
+
+	if _, err := s.Open("dumps/a"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", fs.ErrNotExist, err)
+	}
+}
+
+func Test_StoreCorrupt(t *testing.T) {
+	backend := fakefs.New()
+
+	s, err := New(backend)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	put(t, s, "file", []byte("content"))
+
+	m, err := s.Manifest("file")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chunks, err := backend.Sub(chunksDir)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	put(t, chunks, chunkPath(m.Chunks[0].Hash), []byte("corrupt"))
+
+	f, err := s.Open("file")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	if _, err := io.ReadAll(f); !errors.As(err, &ChecksumError{}) {
+		t.Fatalf("unexpected error, expected=%T, got=%v\n", ChecksumError{}, err)
+	}
+}
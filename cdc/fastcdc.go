@@ -0,0 +1,136 @@
+package cdc
+
+import (
+	"errors"
+	"io"
+	"math/bits"
+)
+
+// gear is the table of random values the rolling hash is computed from. It is
+// generated from a fixed seed, so chunk boundaries are stable across builds.
+var gear [256]uint64
+
+func init() {
+	seed := uint64(0x6663646368756e6b)
+
+	// splitmix64.
+	for i := range gear {
+		seed += 0x9e3779b97f4a7c15
+
+		z := seed
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+
+		gear[i] = z ^ (z >> 31)
+	}
+}
+
+// Chunker splits the content read from an io.Reader into chunks using
+// FastCDC, so the boundaries between chunks depend on the content rather than
+// the offset, and an insertion or deletion only changes the chunks around it.
+type Chunker struct {
+	r   io.Reader
+	buf []byte
+	off int
+	end int
+	eof bool
+
+	min, avg, max int
+	maskS, maskL  uint64
+}
+
+// mask returns a mask of the given number of high bits.
+func mask(n int) uint64 {
+	if n <= 0 {
+		return 0
+	}
+	return ^uint64(0) << (64 - n)
+}
+
+// NewChunker returns a Chunker that splits the content of r into chunks of
+// at least min and at most max bytes, averaging avg bytes.
+func NewChunker(r io.Reader, min, avg, max int) *Chunker {
+	n := bits.Len(uint(avg)) - 1
+
+	// Normalized chunking, a harder mask before the average size and an
+	// easier one after, narrows the distribution of chunk sizes.
+	return &Chunker{
+		r:     r,
+		buf:   make([]byte, 2*max),
+		min:   min,
+		avg:   avg,
+		max:   max,
+		maskS: mask(n + 2),
+		maskL: mask(n - 2),
+	}
+}
+
+// cut returns the length of the next chunk in p.
+func (c *Chunker) cut(p []byte) int {
+	n := len(p)
+
+	if n <= c.min {
+		return n
+	}
+	if n > c.max {
+		n = c.max
+	}
+
+	normal := c.avg
+
+	if normal > n {
+		normal = n
+	}
+
+	var fp uint64
+
+	i := c.min
+
+	for ; i < normal; i++ {
+		fp = (fp << 1) + gear[p[i]]
+
+		if fp&c.maskS == 0 {
+			return i + 1
+		}
+	}
+
+	for ; i < n; i++ {
+		fp = (fp << 1) + gear[p[i]]
+
+		if fp&c.maskL == 0 {
+			return i + 1
+		}
+	}
+	return n
+}
+
+// Next returns the next chunk. The chunk is only valid until the next call.
+// At the end of the content io.EOF is returned.
+func (c *Chunker) Next() ([]byte, error) {
+	if c.end-c.off < c.max && !c.eof {
+		copy(c.buf, c.buf[c.off:c.end])
+		c.end -= c.off
+		c.off = 0
+
+		n, err := io.ReadFull(c.r, c.buf[c.end:])
+		c.end += n
+
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+				return nil, err
+			}
+			c.eof = true
+		}
+	}
+
+	if c.off == c.end {
+		return nil, io.EOF
+	}
+
+	n := c.cut(c.buf[c.off:c.end])
+
+	p := c.buf[c.off : c.off+n]
+	c.off += n
+
+	return p, nil
+}
@@ -0,0 +1,244 @@
+package fs
+
+import (
+	"errors"
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// ErrChaos is the default error returned for faults injected by Chaos.
+var ErrChaos = errors.New("chaos: injected fault")
+
+// ChaosConfig configures the faults injected by Chaos. Each rate is the
+// probability, between 0 and 1, of that fault being injected into an
+// operation.
+type ChaosConfig struct {
+	// ErrorRate is the rate at which an operation fails with Err without
+	// reaching the underlying filesystem.
+	ErrorRate float64
+
+	// PartialWriteRate is the rate at which Put only writes part of the file
+	// to the underlying filesystem, and then fails with io.ErrShortWrite.
+	PartialWriteRate float64
+
+	// MaxDelay is the maximum delay added before each operation. Injected
+	// errors are returned after the delay.
+	MaxDelay time.Duration
+
+	// Shuffle configures ReadDir to return its entries in a random order.
+	Shuffle bool
+
+	// Err is the error returned for injected faults. Defaults to ErrChaos.
+	Err error
+}
+
+type chaos struct {
+	FS
+
+	cfg *ChaosConfig
+
+	mu   *sync.Mutex
+	rand *rand.Rand
+}
+
+// Chaos returns a filesystem that randomly injects faults into the operations
+// performed on the given filesystem, as configured by cfg. The faults are
+// derived from the given seed, so a sequence of operations performed in the
+// same order will see the same faults. The filesystems returned from Sub share
+// the same source of randomness.
+func Chaos(s FS, seed int64, cfg ChaosConfig) FS {
+	if cfg.Err == nil {
+		cfg.Err = ErrChaos
+	}
+
+	c := &chaos{
+		FS:   s,
+		cfg:  &cfg,
+		mu:   &sync.Mutex{},
+		rand: rand.New(rand.NewSource(seed)),
+	}
+
+	if canRename(s) {
+		return renameChaos{chaos: c}
+	}
+	return c
+}
+
+// renameChaos is a chaos over a filesystem that implements RenameFS.
+type renameChaos struct {
+	*chaos
+}
+
+// roll returns the delay to apply to an operation, whether the operation
+// should fail, and the fraction of a write to perform, which is negative if the
+// write should be performed in full.
+func (s *chaos) roll() (time.Duration, bool, float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var delay time.Duration
+
+	if s.cfg.MaxDelay > 0 {
+		delay = time.Duration(s.rand.Int63n(int64(s.cfg.MaxDelay)))
+	}
+
+	fail := s.rand.Float64() < s.cfg.ErrorRate
+
+	partial := -1.0
+
+	if s.rand.Float64() < s.cfg.PartialWriteRate {
+		partial = s.rand.Float64()
+	}
+	return delay, fail, partial
+}
+
+func (s *chaos) fault(op, name string) (float64, error) {
+	delay, fail, partial := s.roll()
+
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+
+	if fail {
+		return 0, &PathError{Op: op, Path: name, Err: s.cfg.Err}
+	}
+	return partial, nil
+}
+
+func (s *chaos) Open(name string) (File, error) {
+	if _, err := s.fault("open", name); err != nil {
+		return nil, err
+	}
+	return s.FS.Open(name)
+}
+
+func (s *chaos) Unwrap() FS { return s.FS }
+
+func (s *chaos) Sub(dir string) (FS, error) {
+	if _, err := s.fault("sub", dir); err != nil {
+		return nil, err
+	}
+
+	sub, err := s.FS.Sub(dir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	c := &chaos{
+		FS:   sub,
+		cfg:  s.cfg,
+		mu:   s.mu,
+		rand: s.rand,
+	}
+
+	if canRename(sub) {
+		return renameChaos{chaos: c}, nil
+	}
+	return c, nil
+}
+
+func (s *chaos) Stat(name string) (FileInfo, error) {
+	if _, err := s.fault("stat", name); err != nil {
+		return nil, err
+	}
+	return s.FS.Stat(name)
+}
+
+// partialFile reads only part of the underlying file, whilst still reporting
+// the full size of the file.
+type partialFile struct {
+	File
+
+	r io.Reader
+}
+
+func (f *partialFile) Read(p []byte) (int, error) {
+	return f.r.Read(p)
+}
+
+func (s *chaos) Put(f File) (File, error) {
+	info, err := f.Stat()
+
+	if err != nil {
+		return nil, err
+	}
+
+	name := info.Name()
+
+	partial, err := s.fault("put", name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if partial < 0 {
+		return s.FS.Put(f)
+	}
+
+	n := int64(float64(info.Size()) * partial)
+
+	stored, err := s.FS.Put(&partialFile{
+		File: f,
+		r:    io.LimitReader(f, n),
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	stored.Close()
+
+	return nil, &PathError{Op: "put", Path: name, Err: io.ErrShortWrite}
+}
+
+func (s *chaos) ReadDir(name string) ([]DirEntry, error) {
+	if _, err := s.fault("readdir", name); err != nil {
+		return nil, err
+	}
+
+	ents, err := ReadDir(s.FS, name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if s.cfg.Shuffle {
+		s.mu.Lock()
+		s.rand.Shuffle(len(ents), func(i, j int) {
+			ents[i], ents[j] = ents[j], ents[i]
+		})
+		s.mu.Unlock()
+	}
+	return ents, nil
+}
+
+func (s renameChaos) Rename(oldname, newname string) error {
+	if _, err := s.fault("rename", oldname); err != nil {
+		return err
+	}
+	return Move(s.FS, oldname, newname)
+}
+
+func (s *chaos) Metadata(name string) (Metadata, error) {
+	if _, err := s.fault("metadata", name); err != nil {
+		return nil, err
+	}
+	return GetMetadata(s.FS, name)
+}
+
+func (s *chaos) SetMetadata(name string, md Metadata) error {
+	if _, err := s.fault("setmetadata", name); err != nil {
+		return err
+	}
+	return SetMetadata(s.FS, name, md)
+}
+
+func (s *chaos) Remove(name string) error {
+	if _, err := s.fault("remove", name); err != nil {
+		return err
+	}
+	return s.FS.Remove(name)
+}
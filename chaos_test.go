@@ -0,0 +1,68 @@
+package fs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func Test_ChaosReproducible(t *testing.T) {
+	cfg := ChaosConfig{
+		ErrorRate: 0.5,
+	}
+
+	run := func() []bool {
+		store := Chaos(Null(), 42, cfg)
+		failed := make([]bool, 0, 32)
+
+		for i := 0; i < 32; i++ {
+			_, err := store.Stat("file")
+
+			if err != nil && !errors.Is(err, ErrChaos) {
+				t.Fatalf("unexpected error, expected=%q, got=%v\n", ErrChaos, err)
+			}
+			failed = append(failed, err != nil)
+		}
+		return failed
+	}
+
+	a := run()
+	b := run()
+
+	if !reflect.DeepEqual(a, b) {
+		t.Fatalf("expected the same faults for the same seed\na=%v\nb=%v\n", a, b)
+	}
+}
+
+func Test_ChaosPartialWrite(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	store := Chaos(New(dir), 1, ChaosConfig{PartialWriteRate: 1})
+
+	buf := generateData(t, 4096)
+
+	f, err := ReadFile("file", bytes.NewReader(buf))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.Put(f); !errors.Is(err, io.ErrShortWrite) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", io.ErrShortWrite, err)
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, "file"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(b) >= len(buf) || !bytes.Equal(b, buf[:len(b)]) {
+		t.Fatalf("expected a truncated prefix of the file, got %d bytes\n", len(b))
+	}
+}
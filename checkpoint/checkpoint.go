@@ -0,0 +1,359 @@
+// Package checkpoint stores the progress of batch jobs in an FS, so a job can
+// resume where it left off after it is restarted.
+//
+// A Store holds a single checkpoint of any type that can be encoded as JSON,
+// for example,
+//
+//	type Progress struct {
+//		Offset int64
+//	}
+//
+//	cp := checkpoint.New[Progress](store, "import")
+//
+//	prog, _, err := cp.Load()
+//
+//	if err != nil {
+//		return err
+//	}
+//
+//	for batch := range batches(prog.Offset) {
+//		...
+//
+//		if err := cp.Save(Progress{Offset: batch.End}); err != nil {
+//			return err
+//		}
+//	}
+//
+// Each checkpoint saved is kept in the history of the Store, so a job can be
+// rewound to an earlier checkpoint. For checkpoints to survive a power
+// failure the FS should flush the files put in it, such as an FS returned
+// from fs.New with the fs.Durable option.
+package checkpoint
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andrewpillar/fs"
+)
+
+// Version is a checkpoint saved in a Store.
+type Version[T any] struct {
+	// Seq is the sequence number of the checkpoint, starting at 1 for the
+	// first checkpoint saved.
+	Seq   int64     `json:"seq"`
+	Time  time.Time `json:"time"`
+	Value T         `json:"value"`
+}
+
+type config struct {
+	keep int
+	now  func() time.Time
+}
+
+// Option configures a Store.
+type Option func(*config)
+
+// Keep sets the number of checkpoints kept in the history. Defaults to 10.
+func Keep(n int) Option {
+	return func(c *config) {
+		if n > 0 {
+			c.keep = n
+		}
+	}
+}
+
+// WithClock sets the function used to get the time a checkpoint was saved.
+// Defaults to time.Now.
+func WithClock(now func() time.Time) Option {
+	return func(c *config) {
+		c.now = now
+	}
+}
+
+// Store stores the checkpoints of a job in an FS. It is safe for concurrent
+// use, though only one Store should save the checkpoints of a job at a time.
+type Store[T any] struct {
+	fs   fs.FS
+	name string
+	cfg  config
+
+	mu  sync.Mutex
+	seq int64 // The sequence of the last checkpoint, or -1 if it has not been loaded.
+}
+
+// New returns a Store for the checkpoints of the given name in the FS. The
+// latest checkpoint is stored as <name>.json, and the history of checkpoints
+// in the <name>.history directory.
+func New[T any](s fs.FS, name string, opts ...Option) *Store[T] {
+	cfg := config{
+		keep: 10,
+		now:  time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	return &Store[T]{
+		fs:   s,
+		name: name,
+		cfg:  cfg,
+		seq:  -1,
+	}
+}
+
+func (s *Store[T]) current() string    { return s.name + ".json" }
+func (s *Store[T]) historyDir() string { return s.name + ".history" }
+
+func (s *Store[T]) historyName(seq int64) string {
+	return path.Join(s.historyDir(), fmt.Sprintf("%020d.json", seq))
+}
+
+func (s *Store[T]) read(name string) (*Version[T], error) {
+	f, err := s.fs.Open(name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	var v Version[T]
+
+	if err := json.NewDecoder(f).Decode(&v); err != nil {
+		return nil, &fs.PathError{Op: "checkpoint", Path: name, Err: err}
+	}
+	return &v, nil
+}
+
+// history returns the names of the checkpoints in the history, oldest first.
+func (s *Store[T]) history() ([]string, error) {
+	ents, err := fs.ReadDir(s.fs, s.historyDir())
+
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	names := make([]string, 0, len(ents))
+
+	for _, ent := range ents {
+		if !ent.IsDir() && strings.HasSuffix(ent.Name(), ".json") {
+			names = append(names, path.Join(s.historyDir(), ent.Name()))
+		}
+	}
+
+	// The names are zero padded, so sort in the order they were saved.
+	sort.Strings(names)
+	return names, nil
+}
+
+// latest returns the latest checkpoint, or nil if none has been saved. The
+// checkpoint is put into the history before it replaces the latest, so the
+// history is checked too in case the job stopped between the two, or the
+// latest checkpoint was only partially written.
+func (s *Store[T]) latest() (*Version[T], error) {
+	v, err := s.read(s.current())
+
+	if err != nil && !errors.Is(err, fs.ErrNotExist) && !isDecodeError(err) {
+		return nil, err
+	}
+
+	names, err := s.history()
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Walk back through the history, in case the newest checkpoint in it
+	// was only partially written.
+	for i := len(names) - 1; i >= 0; i-- {
+		hv, err := s.read(names[i])
+
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) || isDecodeError(err) {
+				continue
+			}
+			return nil, err
+		}
+
+		if v == nil || hv.Seq > v.Seq {
+			v = hv
+		}
+		break
+	}
+	return v, nil
+}
+
+func isDecodeError(err error) bool {
+	var perr *fs.PathError
+
+	return errors.As(err, &perr) && perr.Op == "checkpoint"
+}
+
+// Load returns the latest checkpoint, and whether one has been saved. If none
+// has been saved then the zero value of T is returned.
+func (s *Store[T]) Load() (T, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v, err := s.latest()
+
+	if err != nil {
+		var zero T
+		return zero, false, err
+	}
+
+	if v == nil {
+		s.seq = 0
+
+		var zero T
+		return zero, false, nil
+	}
+
+	s.seq = v.Seq
+	return v.Value, true, nil
+}
+
+func (s *Store[T]) put(name string, b []byte) error {
+	f, err := fs.ReadFile(path.Base(name), bytes.NewReader(b))
+
+	if err != nil {
+		return err
+	}
+
+	defer fs.Cleanup(f)
+
+	stored, err := fs.PutPath(s.fs, name, f)
+
+	if err != nil {
+		return err
+	}
+	return stored.Close()
+}
+
+// Save saves the given checkpoint as the latest. The latest checkpoint is
+// replaced by renaming a temporary file over it, if the FS implements
+// fs.RenameFS, so it is never seen partially written. Checkpoints older than
+// those kept are removed from the history.
+func (s *Store[T]) Save(val T) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.seq < 0 {
+		v, err := s.latest()
+
+		if err != nil {
+			return err
+		}
+
+		s.seq = 0
+
+		if v != nil {
+			s.seq = v.Seq
+		}
+	}
+
+	v := Version[T]{
+		Seq:   s.seq + 1,
+		Time:  s.cfg.now(),
+		Value: val,
+	}
+
+	b, err := json.Marshal(v)
+
+	if err != nil {
+		return fmt.Errorf("checkpoint: %w", err)
+	}
+
+	if err := s.put(s.historyName(v.Seq), b); err != nil {
+		return err
+	}
+
+	tmp := s.current() + ".tmp"
+
+	if err := s.put(tmp, b); err != nil {
+		return err
+	}
+
+	if err := fs.Move(s.fs, tmp, s.current()); err != nil {
+		if !errors.Is(err, fs.ErrUnsupported) {
+			return err
+		}
+
+		s.fs.Remove(tmp)
+
+		if err := s.put(s.current(), b); err != nil {
+			return err
+		}
+	}
+
+	s.seq = v.Seq
+
+	return s.prune()
+}
+
+// prune removes the checkpoints older than those kept from the history.
+func (s *Store[T]) prune() error {
+	names, err := s.history()
+
+	if err != nil {
+		return err
+	}
+
+	for len(names) > s.cfg.keep {
+		if err := s.fs.Remove(names[0]); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		names = names[1:]
+	}
+	return nil
+}
+
+// History returns the checkpoints in the history, oldest first.
+func (s *Store[T]) History() ([]Version[T], error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	names, err := s.history()
+
+	if err != nil {
+		return nil, err
+	}
+
+	vs := make([]Version[T], 0, len(names))
+
+	for _, name := range names {
+		v, err := s.read(name)
+
+		if err != nil {
+			return nil, err
+		}
+		vs = append(vs, *v)
+	}
+	return vs, nil
+}
+
+// Rewind saves the checkpoint with the given sequence number from the history
+// as the latest, so the job resumes from it. The checkpoint is saved under a
+// new sequence number, so the history records the rewind.
+func (s *Store[T]) Rewind(seq int64) error {
+	s.mu.Lock()
+	v, err := s.read(s.historyName(seq))
+	s.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+	return s.Save(v.Value)
+}
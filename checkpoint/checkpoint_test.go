@@ -0,0 +1,117 @@
+package checkpoint
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/andrewpillar/fs"
+	"github.com/andrewpillar/fs/fakefs"
+)
+
+type progress struct {
+	Offset int64
+}
+
+func Test_Store(t *testing.T) {
+	store := fakefs.New()
+
+	cp := New[progress](store, "jobs/import", Keep(2))
+
+	if _, ok, err := cp.Load(); err != nil || ok {
+		t.Fatalf("unexpected checkpoint, expected=%v, got=%v (%v)\n", false, ok, err)
+	}
+
+	for _, off := range []int64{10, 20, 30} {
+		if err := cp.Save(progress{Offset: off}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	prog, ok, err := New[progress](store, "jobs/import").Load()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !ok || prog.Offset != 30 {
+		t.Fatalf("unexpected offset, expected=%d, got=%d\n", 30, prog.Offset)
+	}
+
+	hist, err := cp.History()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(hist) != 2 || hist[0].Seq != 2 || hist[1].Value.Offset != 30 {
+		t.Fatalf("unexpected history %v\n", hist)
+	}
+
+	if err := cp.Rewind(2); err != nil {
+		t.Fatal(err)
+	}
+
+	prog, _, err = cp.Load()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if prog.Offset != 20 {
+		t.Fatalf("unexpected offset, expected=%d, got=%d\n", 20, prog.Offset)
+	}
+
+	if _, err := store.Stat("jobs/import.json.tmp"); err == nil {
+		t.Fatalf("expected temporary file to be removed\n")
+	}
+}
+
+func Test_StorePartialWrite(t *testing.T) {
+	store := fakefs.New()
+
+	cp := New[progress](store, "import")
+
+	for _, off := range []int64{10, 20} {
+		if err := cp.Save(progress{Offset: off}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A latest checkpoint that was only partially written falls back to the
+	// history.
+	f, err := fs.ReadFile("import.json", strings.NewReader(`{"seq":2,"val`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.Put(f); err != nil {
+		t.Fatal(err)
+	}
+
+	cp = New[progress](store, "import")
+
+	prog, ok, err := cp.Load()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !ok || prog.Offset != 20 {
+		t.Fatalf("unexpected offset, expected=%d, got=%d\n", 20, prog.Offset)
+	}
+
+	if err := cp.Save(progress{Offset: 30}); err != nil {
+		t.Fatal(err)
+	}
+
+	hist, err := cp.History()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if last := hist[len(hist)-1]; last.Seq != 3 {
+		t.Fatalf("unexpected seq, expected=%d, got=%d\n", 3, last.Seq)
+	}
+}
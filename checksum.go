@@ -0,0 +1,227 @@
+package fs
+
+import (
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"strings"
+)
+
+// ChecksumError is the error returned when the contents of a file do not match
+// its checksum.
+type ChecksumError struct {
+	Name     string
+	Expected string
+	Actual   string
+}
+
+func (e *ChecksumError) Error() string {
+	return "checksum mismatch for " + e.Name + ", expected " + e.Expected + ", got " + e.Actual
+}
+
+type checksumFS struct {
+	FS
+
+	mech func() hash.Hash
+	ext  string
+}
+
+// Checksum returns a filesystem that writes a sidecar file containing the
+// checksum of each file put in it, named after the file with the given
+// extension, for example "file.tar.gz.sha256". The sidecar is in the format
+// used by sha256sum and similar tools, so it can be checked by them.
+//
+// Files opened from the filesystem are checked against their sidecar as they
+// are read, and a *ChecksumError is returned instead of io.EOF if they do not
+// match. Only files read sequentially from the start are checked. Files that do
+// not have a sidecar are opened without being checked. Sidecars are not listed
+// by ReadDir.
+func Checksum(s FS, mech func() hash.Hash, ext string) FS {
+	cs := &checksumFS{
+		FS:   s,
+		mech: mech,
+		ext:  ext,
+	}
+
+	if canRename(s) {
+		return renameChecksumFS{checksumFS: cs}
+	}
+	return cs
+}
+
+// renameChecksumFS is a checksumFS over a filesystem that implements RenameFS.
+type renameChecksumFS struct {
+	*checksumFS
+}
+
+func (s *checksumFS) Unwrap() FS { return s.FS }
+
+func (s *checksumFS) Sub(dir string) (FS, error) {
+	fs, err := s.FS.Sub(dir)
+
+	if err != nil {
+		return nil, err
+	}
+	return Checksum(fs, s.mech, s.ext), nil
+}
+
+// readSum returns the checksum in the sidecar of the named file.
+func (s *checksumFS) readSum(name string) (string, error) {
+	f, err := s.FS.Open(name + s.ext)
+
+	if err != nil {
+		return "", err
+	}
+
+	defer f.Close()
+
+	b, err := io.ReadAll(io.LimitReader(f, 4096))
+
+	if err != nil {
+		return "", err
+	}
+
+	fields := strings.Fields(string(b))
+
+	if len(fields) == 0 {
+		return "", &PathError{Op: "open", Path: name + s.ext, Err: ErrInvalid}
+	}
+	return strings.ToLower(fields[0]), nil
+}
+
+type checksumFile struct {
+	File
+
+	name     string
+	h        hash.Hash
+	expected string
+}
+
+func (f *checksumFile) Read(p []byte) (int, error) {
+	n, err := f.File.Read(p)
+
+	f.h.Write(p[:n])
+
+	if err == io.EOF {
+		if actual := hex.EncodeToString(f.h.Sum(nil)); actual != f.expected {
+			return n, &ChecksumError{
+				Name:     f.name,
+				Expected: f.expected,
+				Actual:   actual,
+			}
+		}
+	}
+	return n, err
+}
+
+func (s *checksumFS) Open(name string) (File, error) {
+	sum, err := s.readSum(name)
+
+	if err != nil {
+		if errors.Is(err, ErrNotExist) {
+			return s.FS.Open(name)
+		}
+		return nil, err
+	}
+
+	f, err := s.FS.Open(name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &checksumFile{
+		File:     f,
+		name:     name,
+		h:        s.mech(),
+		expected: sum,
+	}, nil
+}
+
+func (s *checksumFS) Put(f File) (File, error) {
+	info, err := f.Stat()
+
+	if err != nil {
+		return nil, err
+	}
+
+	name := info.Name()
+
+	h := s.mech()
+
+	stored, err := s.FS.Put(&hashReader{File: f, r: io.TeeReader(f, h)})
+
+	if err != nil {
+		return nil, err
+	}
+
+	line := hex.EncodeToString(h.Sum(nil)) + "  " + name + "\n"
+
+	sidecar, err := ReadFile(name+s.ext, strings.NewReader(line))
+
+	if err != nil {
+		stored.Close()
+		return nil, err
+	}
+
+	sc, err := s.FS.Put(sidecar)
+
+	if err != nil {
+		stored.Close()
+		return nil, err
+	}
+	sc.Close()
+
+	return stored, nil
+}
+
+func (s *checksumFS) ReadDir(name string) ([]DirEntry, error) {
+	ents, err := ReadDir(s.FS, name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	filtered := ents[:0]
+
+	for _, ent := range ents {
+		if !ent.IsDir() && strings.HasSuffix(ent.Name(), s.ext) {
+			continue
+		}
+		filtered = append(filtered, ent)
+	}
+	return filtered, nil
+}
+
+// Rename renames the file along with its sidecar.
+func (s renameChecksumFS) Rename(oldname, newname string) error {
+	if err := Move(s.FS, oldname, newname); err != nil {
+		return err
+	}
+
+	if err := Move(s.FS, oldname+s.ext, newname+s.ext); err != nil && !errors.Is(err, ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Remove removes the file along with its sidecar.
+func (s *checksumFS) Remove(name string) error {
+	if err := s.FS.Remove(name); err != nil {
+		return err
+	}
+
+	if err := s.FS.Remove(name + s.ext); err != nil && !errors.Is(err, ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *checksumFS) Metadata(name string) (Metadata, error) {
+	return GetMetadata(s.FS, name)
+}
+
+func (s *checksumFS) SetMetadata(name string, md Metadata) error {
+	return SetMetadata(s.FS, name, md)
+}
@@ -0,0 +1,95 @@
+package fs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_Checksum(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	store := Checksum(New(dir), sha256.New, ".sha256")
+
+	buf := generateData(t, 4096)
+
+	f, err := ReadFile("file", bytes.NewReader(buf))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := store.Put(f)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored.Close()
+
+	sum := sha256.Sum256(buf)
+	expected := hex.EncodeToString(sum[:]) + "  file\n"
+
+	b, err := os.ReadFile(filepath.Join(dir, "file.sha256"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(b) != expected {
+		t.Fatalf("unexpected sidecar, expected=%q, got=%q\n", expected, string(b))
+	}
+
+	ents, err := ReadDir(store, ".")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ents) != 1 || ents[0].Name() != "file" {
+		t.Fatalf("expected sidecar to be hidden, got %d entries\n", len(ents))
+	}
+
+	opened, err := store.Open("file")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := io.ReadAll(opened); err != nil {
+		t.Fatal(err)
+	}
+	opened.Close()
+
+	// Corrupt the file behind the wrapper's back.
+	if err := os.WriteFile(filepath.Join(dir, "file"), []byte("corrupt"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	opened, err = store.Open("file")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer opened.Close()
+
+	var cerr *ChecksumError
+
+	if _, err := io.ReadAll(opened); !errors.As(err, &cerr) {
+		t.Fatalf("unexpected error, expected=%T, got=%T(%v)\n", cerr, err, err)
+	}
+
+	if err := store.Remove("file"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "file.sha256")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", os.ErrNotExist, err)
+	}
+}
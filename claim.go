@@ -0,0 +1,284 @@
+package fs
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrClaimed is the error returned when claiming a file that is already
+// claimed, or when renewing a lease that has been lost.
+var ErrClaimed = errors.New("file already claimed")
+
+// Lease is a claim on a file, held until it expires or is released.
+type Lease interface {
+	// Name returns the name of the file claimed.
+	Name() string
+
+	// Expires returns when the lease expires, unless it is renewed.
+	Expires() time.Time
+
+	// Renew extends the lease to expire after the given duration. If the
+	// lease expired and the file was claimed by another, then ErrClaimed is
+	// returned, and whatever was being done with the file should be
+	// abandoned.
+	Renew(ttl time.Duration) error
+
+	// Release releases the lease so the file can be claimed by another.
+	Release() error
+}
+
+// ClaimFS is the interface implemented by a filesystem that can coordinate
+// which of multiple workers processes each file.
+type ClaimFS interface {
+	FS
+
+	// Claim claims the named file for the given duration. If the file is
+	// already claimed, and the lease has not expired, then ErrClaimed is
+	// returned. The file itself does not need to exist.
+	Claim(name string, ttl time.Duration) (Lease, error)
+}
+
+// Claim claims the named file in the given filesystem for the given duration,
+// so a fleet of workers sharing the filesystem can coordinate which of them
+// processes the file without an external lock service. A worker should renew
+// the lease before it expires for as long as it is processing the file. If
+// the filesystem does not implement ClaimFS then ErrUnsupported is returned in
+// the *PathError.
+func Claim(s FS, name string, ttl time.Duration) (Lease, error) {
+	cs, ok := s.(ClaimFS)
+
+	if !ok {
+		return nil, &PathError{Op: "claim", Path: name, Err: ErrUnsupported}
+	}
+	return cs.Claim(name, ttl)
+}
+
+// claimDir is the hidden directory the lock files of claimed files are kept
+// in, alongside the files themselves. It is not listed by ReadDir, so the lock
+// files are not mistaken for files to be processed.
+const claimDir = ".claims"
+
+// claimRecord is the content of the lock file of a claimed file.
+type claimRecord struct {
+	Token   string    `json:"token"`
+	Expires time.Time `json:"expires"`
+}
+
+func readClaim(path string) (claimRecord, error) {
+	var rec claimRecord
+
+	b, err := os.ReadFile(path)
+
+	if err != nil {
+		return rec, err
+	}
+
+	if err := json.Unmarshal(b, &rec); err != nil {
+		return rec, err
+	}
+	return rec, nil
+}
+
+// writeClaim writes the lock file, failing with ErrExist if it already exists.
+func (s filesystem) writeClaim(path string, rec claimRecord) error {
+	b, err := json.Marshal(rec)
+
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, s.filePerm)
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+
+	if s.durable {
+		if err := s.sync(f); err != nil {
+			f.Close()
+			os.Remove(path)
+			return err
+		}
+	}
+	return f.Close()
+}
+
+// claimPath returns the path of the lock file for the named file, which is kept
+// in the claims directory of the directory of the file.
+func (s filesystem) claimPath(name string) string {
+	path := s.path(name)
+	return filepath.Join(filepath.Dir(path), claimDir, filepath.Base(path)+".claim")
+}
+
+// Claim claims the file by exclusively creating a lock file in a hidden
+// ".claims" directory alongside it that records when the lease expires. An
+// expired lock file is moved aside before the file is claimed, and is put back
+// if another worker claimed the file in the meantime. The clocks of the
+// workers sharing the filesystem should be kept in sync.
+//
+// Renew and Release check that the lock file still belongs to the lease before
+// they replace or remove it, but not atomically, so a lease that expires
+// during the call could be taken over by another worker, and its lock file
+// replaced or removed. Leases should be renewed well before they expire.
+func (s filesystem) Claim(name string, ttl time.Duration) (Lease, error) {
+	if err := s.check(name); err != nil {
+		return nil, &PathError{Op: "claim", Path: name, Err: err}
+	}
+
+	b := make([]byte, 16)
+
+	if _, err := rand.Read(b); err != nil {
+		return nil, &PathError{Op: "claim", Path: name, Err: err}
+	}
+
+	lock := s.claimPath(name)
+
+	if err := s.mkdirAll(filepath.Dir(lock)); err != nil {
+		return nil, &PathError{Op: "claim", Path: name, Err: errors.Unwrap(err)}
+	}
+
+	l := &fileLease{
+		s:     s,
+		name:  name,
+		path:  lock,
+		token: hex.EncodeToString(b),
+	}
+
+	rec := claimRecord{
+		Token:   l.token,
+		Expires: time.Now().Add(ttl),
+	}
+
+	err := s.writeClaim(lock, rec)
+
+	if errors.Is(err, ErrExist) {
+		err = s.steal(lock, rec)
+	}
+
+	if err != nil {
+		if errors.Is(err, ErrClaimed) {
+			return nil, &PathError{Op: "claim", Path: name, Err: ErrClaimed}
+		}
+		return nil, &PathError{Op: "claim", Path: name, Err: errors.Unwrap(err)}
+	}
+
+	l.expires = rec.Expires
+	return l, nil
+}
+
+// steal takes over the lock file if its lease has expired.
+func (s filesystem) steal(lock string, rec claimRecord) error {
+	old, err := readClaim(lock)
+
+	if err != nil {
+		// The lock was released, or is still being written.
+		if errors.Is(err, ErrNotExist) {
+			return s.writeClaim(lock, rec)
+		}
+		return ErrClaimed
+	}
+
+	if time.Now().Before(old.Expires) {
+		return ErrClaimed
+	}
+
+	stale := lock + "." + old.Token
+
+	if err := os.Rename(lock, stale); err != nil {
+		if errors.Is(err, ErrNotExist) {
+			return ErrClaimed
+		}
+		return err
+	}
+
+	moved, err := readClaim(stale)
+
+	// Another worker claimed the file between reading and moving the lock
+	// file, so theirs is put back. If that fails then the other worker
+	// finds out when it next renews its lease.
+	if err != nil || moved.Token != old.Token {
+		os.Link(stale, lock)
+		os.Remove(stale)
+		return ErrClaimed
+	}
+
+	os.Remove(stale)
+
+	if err := s.writeClaim(lock, rec); err != nil {
+		if errors.Is(err, ErrExist) {
+			return ErrClaimed
+		}
+		return err
+	}
+	return nil
+}
+
+type fileLease struct {
+	s       filesystem
+	name    string
+	path    string
+	token   string
+	expires time.Time
+}
+
+func (l *fileLease) Name() string       { return l.name }
+func (l *fileLease) Expires() time.Time { return l.expires }
+
+// held returns an error if the lock file no longer belongs to the lease.
+func (l *fileLease) held(op string) error {
+	rec, err := readClaim(l.path)
+
+	if err != nil || rec.Token != l.token {
+		return &PathError{Op: op, Path: l.name, Err: ErrClaimed}
+	}
+	return nil
+}
+
+// Renew rewrites the lock file with the new expiry via a temporary file that
+// is renamed over it.
+func (l *fileLease) Renew(ttl time.Duration) error {
+	if err := l.held("renew"); err != nil {
+		return err
+	}
+
+	rec := claimRecord{
+		Token:   l.token,
+		Expires: time.Now().Add(ttl),
+	}
+
+	tmp := l.path + "." + l.token
+
+	if err := l.s.writeClaim(tmp, rec); err != nil {
+		return &PathError{Op: "renew", Path: l.name, Err: errors.Unwrap(err)}
+	}
+
+	if err := os.Rename(tmp, l.path); err != nil {
+		os.Remove(tmp)
+		return &PathError{Op: "renew", Path: l.name, Err: errors.Unwrap(err)}
+	}
+
+	l.expires = rec.Expires
+	return nil
+}
+
+func (l *fileLease) Release() error {
+	if err := l.held("release"); err != nil {
+		return err
+	}
+
+	if err := os.Remove(l.path); err != nil {
+		return &PathError{Op: "release", Path: l.name, Err: errors.Unwrap(err)}
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package fs
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func Test_Claim(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	store := New(dir)
+
+	lease, err := Claim(store, "jobs/job1", time.Minute)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Claim(store, "jobs/job1", time.Minute); !errors.Is(err, ErrClaimed) {
+		t.Fatalf("unexpected error, expected=%q, got=%q\n", ErrClaimed, err)
+	}
+
+	// The lock file is not listed alongside the files to be claimed.
+	ents, err := ReadDir(store, "jobs")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ents) != 0 {
+		t.Fatalf("unexpected entries, expected=%d, got=%d\n", 0, len(ents))
+	}
+
+	if err := lease.Renew(time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	if ents, _ := ReadDir(store, "jobs"); len(ents) != 0 {
+		t.Fatalf("unexpected entries, expected=%d, got=%d\n", 0, len(ents))
+	}
+
+	if err := lease.Release(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lease.Release(); !errors.Is(err, ErrClaimed) {
+		t.Fatalf("unexpected error, expected=%q, got=%q\n", ErrClaimed, err)
+	}
+
+	// An expired lease can be taken over, after which the original holder
+	// can no longer renew it.
+	expired, err := Claim(store, "jobs/job1", -time.Second)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lease, err = Claim(store, "jobs/job1", time.Minute)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := expired.Renew(time.Minute); !errors.Is(err, ErrClaimed) {
+		t.Fatalf("unexpected error, expected=%q, got=%q\n", ErrClaimed, err)
+	}
+
+	if err := lease.Release(); err != nil {
+		t.Fatal(err)
+	}
+
+	ents, err = os.ReadDir(dir + "/jobs/" + claimDir)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ents) != 0 {
+		t.Fatalf("unexpected entries, expected=%d, got=%d\n", 0, len(ents))
+	}
+
+	if _, err := Claim(Null(), "job1", time.Minute); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("unexpected error, expected=%q, got=%q\n", ErrUnsupported, err)
+	}
+}
@@ -0,0 +1,148 @@
+package fs
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// registry tracks the temporary directories created by ReadFileMax for files
+// that are spooled to disk, so only those are removed by Cleanup.
+type registry struct {
+	mu   sync.Mutex
+	dirs map[string]struct{}
+}
+
+var spooled = registry{
+	dirs: make(map[string]struct{}),
+}
+
+func (r *registry) add(dir string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.dirs[dir] = struct{}{}
+}
+
+func (r *registry) has(dir string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, ok := r.dirs[dir]
+	return ok
+}
+
+// remove removes the given directory from the registry, and reports whether it
+// was in the registry.
+func (r *registry) remove(dir string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, ok := r.dirs[dir]
+	delete(r.dirs, dir)
+	return ok
+}
+
+// drain removes and returns every directory in the registry.
+func (r *registry) drain() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	dirs := make([]string, 0, len(r.dirs))
+
+	for dir := range r.dirs {
+		dirs = append(dirs, dir)
+	}
+
+	r.dirs = make(map[string]struct{})
+	return dirs
+}
+
+// CleanupAll deletes every file spooled to disk by ReadFileMax that has not yet
+// been deleted via Cleanup. This would typically be called at shutdown to reap
+// any files that were not cleaned up. The first error encountered is returned,
+// after attempting to delete every file.
+func CleanupAll() error {
+	var err error
+
+	for _, dir := range spooled.drain() {
+		if rmerr := os.RemoveAll(dir); rmerr != nil && err == nil {
+			err = rmerr
+		}
+	}
+	return err
+}
+
+// overwrite overwrites the contents of the file with the given name with
+// zeros, and syncs it to disk.
+func overwrite(name string) error {
+	f, err := os.OpenFile(name, os.O_WRONLY, 0)
+
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	info, err := f.Stat()
+
+	if err != nil {
+		return err
+	}
+
+	buf := copyBufPool.Get().(*[]byte)
+	defer copyBufPool.Put(buf)
+
+	zero := *buf
+
+	for i := range zero {
+		zero[i] = 0
+	}
+
+	for off := int64(0); off < info.Size(); off += int64(len(zero)) {
+		p := zero
+
+		if rem := info.Size() - off; rem < int64(len(p)) {
+			p = p[:rem]
+		}
+
+		if _, err := f.WriteAt(p, off); err != nil {
+			return err
+		}
+	}
+	return f.Sync()
+}
+
+// CleanupSecure functions the same as Cleanup, only the contents of the file
+// are overwritten with zeros before it is deleted, or before its memory is
+// released. This should be called before the file is closed, since the memory
+// of a closed file may already have been released for reuse.
+//
+// The contents are overwritten once in place, which does not guarantee they
+// are unrecoverable on filesystems or devices that do not write in place, such
+// as copy-on-write filesystems and SSDs.
+func CleanupSecure(f File) error {
+	switch v := unwrapFile(f).(type) {
+	case *file:
+		if v.pool != nil {
+			// The whole capacity of the buffer is zeroed, not just the
+			// file's data, since the buffer may have held more before it
+			// was last reset.
+			v.pool.buf.Reset()
+
+			b := v.pool.buf.Bytes()
+			b = b[:cap(b)]
+
+			for i := range b {
+				b[i] = 0
+			}
+		}
+	case *os.File:
+		if spooled.has(filepath.Dir(v.Name())) {
+			if err := overwrite(v.Name()); err != nil {
+				return err
+			}
+		}
+	}
+	return Cleanup(f)
+}
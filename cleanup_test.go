@@ -0,0 +1,190 @@
+package fs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_CleanupSecureMemory(t *testing.T) {
+	buf := generateData(t, 4096)
+
+	f, err := ReadFile("file", bytes.NewReader(buf))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := f.(*file).data
+	data = data[:cap(data)]
+
+	if err := CleanupSecure(f); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(data, make([]byte, len(data))) {
+		t.Fatal("expected file memory to be zeroed")
+	}
+}
+
+func Test_CleanupSecureDisk(t *testing.T) {
+	buf := generateData(t, 4096)
+
+	f, err := ReadFileMax("file", bytes.NewReader(buf), 1024)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	osf := f.(*os.File)
+	defer osf.Close()
+
+	if err := CleanupSecure(f); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(osf.Name()); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", os.ErrNotExist, err)
+	}
+
+	// The file is still open, so its contents can be read after removal
+	// to check they were overwritten.
+	if _, err := osf.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := io.ReadAll(osf)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(b, make([]byte, len(buf))) {
+		t.Fatal("expected file contents to be overwritten")
+	}
+}
+
+func Test_CleanupTempDirChange(t *testing.T) {
+	buf := generateData(t, 4096)
+
+	f, err := ReadFileMax("file", bytes.NewReader(buf), 1024)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	name := f.(*os.File).Name()
+	f.Close()
+
+	t.Setenv("TMPDIR", tmpdir(t))
+
+	if err := Cleanup(f); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(name); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", os.ErrNotExist, err)
+	}
+}
+
+func Test_CleanupAll(t *testing.T) {
+	buf := generateData(t, 4096)
+
+	names := make([]string, 0, 3)
+
+	for i := 0; i < 3; i++ {
+		f, err := ReadFileMax("file", bytes.NewReader(buf), 1024)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		names = append(names, f.(*os.File).Name())
+		f.Close()
+	}
+
+	if err := CleanupAll(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range names {
+		if _, err := os.Stat(name); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("unexpected error, expected=%q, got=%v\n", os.ErrNotExist, err)
+		}
+	}
+}
+
+func Test_CleanupNotSpooled(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	f, err := os.Create(filepath.Join(dir, "file"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	if err := Cleanup(f); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(f.Name()); err != nil {
+		t.Fatalf("expected file not spooled by ReadFileMax to remain, got %v\n", err)
+	}
+}
+
+func Test_CleanupNotPooled(t *testing.T) {
+	f := &file{
+		name: "file",
+		data: []byte("data"),
+	}
+
+	if err := Cleanup(f); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := io.ReadAll(f)
+
+	if err != nil {
+		t.Fatalf("expected file not read by ReadFileMax to remain readable, got %v\n", err)
+	}
+
+	if string(b) != "data" {
+		t.Fatalf("unexpected content, expected=%q, got=%q\n", "data", string(b))
+	}
+}
+
+func Test_CloseNotReleased(t *testing.T) {
+	f, err := ReadFile("file", bytes.NewReader([]byte("data")))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer Cleanup(f)
+
+	f.Close()
+
+	b, err := io.ReadAll(f)
+
+	if err != nil {
+		t.Fatalf("expected closed file to remain readable until Cleanup, got %v\n", err)
+	}
+
+	if string(b) != "data" {
+		t.Fatalf("unexpected content, expected=%q, got=%q\n", "data", string(b))
+	}
+
+	if err := Cleanup(f); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := f.Read(make([]byte, 1)); !errors.Is(err, ErrClosed) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", ErrClosed, err)
+	}
+}
@@ -0,0 +1,49 @@
+//go:build linux
+
+package fs
+
+import (
+	"os"
+	"syscall"
+)
+
+// ficlone is the FICLONE ioctl request, see ioctl_ficlone(2).
+const ficlone = 0x40049409
+
+// cloneFile makes dst share the data of src via the FICLONE ioctl. This is
+// only supported on filesystems with reflink support such as btrfs and XFS,
+// on other filesystems an error is returned.
+func cloneFile(dst, src *os.File) error {
+	dconn, err := dst.SyscallConn()
+
+	if err != nil {
+		return err
+	}
+
+	sconn, err := src.SyscallConn()
+
+	if err != nil {
+		return err
+	}
+
+	var errno syscall.Errno
+
+	err = dconn.Control(func(dfd uintptr) {
+		err := sconn.Control(func(sfd uintptr) {
+			_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, dfd, ficlone, sfd)
+		})
+
+		if err != nil {
+			errno = syscall.EBADF
+		}
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package fs
+
+import (
+	"os"
+)
+
+// cloneFile is only supported on Linux, on every other platform the data is
+// copied instead.
+func cloneFile(dst, src *os.File) error {
+	return ErrUnsupported
+}
@@ -0,0 +1,159 @@
+package fs
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+// ComposeFS is the interface implemented by a filesystem that can concatenate
+// the files stored in it without streaming them through the caller.
+type ComposeFS interface {
+	FS
+
+	// Compose concatenates the named parts, in order, into the file dst,
+	// and returns the composed file. The parts are left in place.
+	Compose(dst string, parts ...string) (File, error)
+}
+
+// composedFile is the concatenation of parts being put by Compose.
+type composedFile struct {
+	io.Reader
+
+	info *fileInfo
+}
+
+func (f *composedFile) Stat() (FileInfo, error) { return f.info, nil }
+func (f *composedFile) Close() error            { return nil }
+
+// Compose concatenates the named parts of the given filesystem, in order, into
+// the file dst, and returns the composed file. This would typically be used
+// to finalize an upload that was received in chunks. If the filesystem
+// implements ComposeFS then the parts are concatenated by the filesystem,
+// otherwise they are read and put back via PutPath. The parts are left in
+// place, and dst must not be one of the parts.
+func Compose(s FS, dst string, parts ...string) (File, error) {
+	if cs, ok := s.(ComposeFS); ok {
+		return cs.Compose(dst, parts...)
+	}
+
+	var size int64
+
+	readers := make([]io.Reader, 0, len(parts))
+
+	for _, part := range parts {
+		info, err := s.Stat(part)
+
+		if err != nil {
+			return nil, err
+		}
+
+		size += info.Size()
+
+		f := Lazy(s, part)
+		defer f.Close()
+
+		readers = append(readers, f)
+	}
+
+	return PutPath(s, dst, &composedFile{
+		Reader: io.MultiReader(readers...),
+		info: &fileInfo{
+			name:    path.Base(dst),
+			size:    size,
+			modTime: time.Now(),
+		},
+	})
+}
+
+// Compose concatenates the parts into a temporary file alongside dst, which is
+// then renamed to dst. The first part is cloned where possible, and the rest
+// are copied by the kernel where possible, so this is safe to call with dst as
+// one of the parts.
+func (s filesystem) Compose(dst string, parts ...string) (File, error) {
+	if err := s.check(dst); err != nil {
+		return nil, &PathError{Op: "compose", Path: dst, Err: err}
+	}
+
+	if err := s.check(parts...); err != nil {
+		return nil, &PathError{Op: "compose", Path: dst, Err: err}
+	}
+
+	dir := filepath.Dir(s.path(dst))
+
+	if err := s.mkdirAll(dir); err != nil {
+		return nil, &PathError{Op: "compose", Path: dst, Err: errors.Unwrap(err)}
+	}
+
+	suffix := make([]byte, 8)
+
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, &PathError{Op: "compose", Path: dst, Err: err}
+	}
+
+	tmp := filepath.Join(dir, "."+path.Base(dst)+".compose-"+hex.EncodeToString(suffix))
+
+	f, err := s.create(tmp)
+
+	if err != nil {
+		return nil, &PathError{Op: "compose", Path: dst, Err: errors.Unwrap(err)}
+	}
+
+	if err := s.compose(f, parts); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return nil, &PathError{Op: "compose", Path: dst, Err: err}
+	}
+
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return nil, &PathError{Op: "compose", Path: dst, Err: errors.Unwrap(err)}
+	}
+
+	if err := os.Rename(tmp, s.path(dst)); err != nil {
+		os.Remove(tmp)
+		return nil, &PathError{Op: "compose", Path: dst, Err: errors.Unwrap(err)}
+	}
+
+	if s.durable {
+		if err := syncDir(dir); err != nil {
+			return nil, &PathError{Op: "compose", Path: dst, Err: errors.Unwrap(err)}
+		}
+	}
+	return s.Open(dst)
+}
+
+// compose copies each of the parts into the given file.
+func (s filesystem) compose(dst *os.File, parts []string) error {
+	for i, part := range parts {
+		src, err := os.Open(s.path(part))
+
+		if err != nil {
+			return errors.Unwrap(err)
+		}
+
+		// A clone replaces the entire file, so is only attempted for the
+		// first part.
+		if i == 0 {
+			_, err = copyFile(dst, src)
+		} else {
+			_, err = dst.ReadFrom(src)
+		}
+
+		src.Close()
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if s.durable {
+		return s.sync(dst)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package fs
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_Compose(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	parts := []string{"part1", "part2", "part3"}
+
+	for _, name := range parts {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		store FS
+		dst   string
+		parts []string
+		want  string
+		err   error
+	}{
+		{New(dir), "file", parts, "part1part2part3", nil},
+		{New(dir), "dir/file", parts[1:], "part2part3", nil},
+		{struct{ FS }{New(dir)}, "fallback", parts[:2], "part1part2", nil},
+		{struct{ FS }{New(dir)}, "dir/fallback", parts, "part1part2part3", nil},
+		{New(dir), "part1", parts, "part1part2part3", nil},
+		{New(dir), "missing", []string{"part1", "missing"}, "", ErrNotExist},
+		{struct{ FS }{New(dir)}, "missing", []string{"part1", "missing"}, "", ErrNotExist},
+	}
+
+	for i, test := range tests {
+		f, err := Compose(test.store, test.dst, test.parts...)
+
+		if err != nil {
+			if !errors.Is(err, test.err) {
+				t.Fatalf("tests[%d] - unexpected error, expected=%v, got=%v\n", i, test.err, err)
+			}
+
+			if _, err := os.Stat(filepath.Join(dir, test.dst)); !errors.Is(err, os.ErrNotExist) {
+				t.Fatalf("tests[%d] - unexpected error, expected=%v, got=%v\n", i, os.ErrNotExist, err)
+			}
+			continue
+		}
+		f.Close()
+
+		if test.err != nil {
+			t.Fatalf("tests[%d] - expected error %v\n", i, test.err)
+		}
+
+		b, err := os.ReadFile(filepath.Join(dir, test.dst))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(b) != test.want {
+			t.Fatalf("tests[%d] - unexpected content, expected=%q, got=%q\n", i, test.want, string(b))
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package fs
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+)
+
+// PutResult is the result of putting a single file via PutConcurrent.
+type PutResult struct {
+	// Name is the name of the file that was given to Put.
+	Name string
+
+	// File is the file as it is stored in the filesystem. This will be nil if
+	// Err is non-nil.
+	File File
+
+	// Err is the error that occurred when putting the file, if any.
+	Err error
+}
+
+// PutErrors is the aggregate of the errors that occurred when putting multiple
+// files.
+type PutErrors []error
+
+func (e PutErrors) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+	return e[0].Error() + " (and " + strconv.Itoa(len(e)-1) + " more errors)"
+}
+
+// Is reports whether any of the underlying errors match the target.
+func (e PutErrors) Is(target error) bool {
+	for _, err := range e {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// PutConcurrent puts each file received from the given channel into the
+// filesystem using at most the given number of workers. A PutResult is sent on
+// the returned channel for every file put, in the order they complete. The
+// returned channel is closed once the files channel is closed and all files
+// have been put.
+func PutConcurrent(s FS, files <-chan File, workers int) <-chan PutResult {
+	if workers < 1 {
+		workers = 1
+	}
+
+	results := make(chan PutResult)
+
+	var wg sync.WaitGroup
+
+	wg.Add(workers)
+
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+
+			for f := range files {
+				var res PutResult
+
+				info, err := f.Stat()
+
+				if err != nil {
+					res.Err = err
+					results <- res
+					continue
+				}
+
+				res.Name = info.Name()
+				res.File, res.Err = s.Put(f)
+
+				results <- res
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+	return results
+}
+
+// CollectPut receives every result from the given channel and returns the
+// files that were successfully stored. If any file failed to be put then the
+// errors are returned as PutErrors.
+func CollectPut(results <-chan PutResult) ([]File, error) {
+	files := make([]File, 0)
+
+	var errs PutErrors
+
+	for res := range results {
+		if res.Err != nil {
+			errs = append(errs, res.Err)
+			continue
+		}
+		files = append(files, res.File)
+	}
+
+	if len(errs) > 0 {
+		return files, errs
+	}
+	return files, nil
+}
@@ -0,0 +1,58 @@
+package fs
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strconv"
+	"testing"
+)
+
+func Test_PutConcurrent(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	store := Limit(New(dir), 1024)
+
+	sizes := [...]int{512, 2048, 128, 4096, 1024}
+
+	files := make(chan File)
+
+	go func() {
+		defer close(files)
+
+		for i, size := range sizes {
+			f, err := ReadFile("file-"+strconv.Itoa(i), bytes.NewReader(generateData(t, size)))
+
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			files <- f
+		}
+	}()
+
+	stored, err := CollectPut(PutConcurrent(store, files, 3))
+
+	if len(stored) != 3 {
+		t.Fatalf("unexpected number of stored files, expected=%d, got=%d\n", 3, len(stored))
+	}
+
+	for _, f := range stored {
+		f.Close()
+	}
+
+	var errs PutErrors
+
+	if !errors.As(err, &errs) {
+		t.Fatalf("unexpected error, expected=%T, got=%T(%q)\n", errs, err, err)
+	}
+
+	if len(errs) != 2 {
+		t.Fatalf("unexpected number of errors, expected=%d, got=%d\n", 2, len(errs))
+	}
+
+	if !errors.Is(err, SizeError{Size: 1024}) {
+		t.Fatalf("unexpected error, expected=%T, got=%T(%q)\n", SizeError{}, err, err)
+	}
+}
@@ -0,0 +1,203 @@
+// Package config loads configuration files from a chain of FSs.
+//
+// A Loader reads a configuration file from each FS in its chain, and decodes
+// each into the same value, so the files are layered over one another, for
+// example,
+//
+//	l := config.New[Config]("app.json", []fs.FS{remote, fs.New("/etc/app")})
+//
+//	cfg, err := l.Load()
+//
+// loads app.json from /etc/app, and then from the remote FS, so the fields set
+// in the remote file override those set on disk, and the file on disk serves
+// as a fallback for the fields the remote file does not set, or if it does not
+// exist at all. A Loader can watch the files, and load them again when any of
+// them change.
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"time"
+
+	"github.com/andrewpillar/fs"
+)
+
+// Decoder decodes the content of a configuration file into the given value.
+// Fields that are not set in the content should be left as they are, as with
+// json.Unmarshal, so the files can be layered.
+type Decoder func(b []byte, v any) error
+
+type options struct {
+	decode   Decoder
+	optional bool
+	interval time.Duration
+}
+
+// Option configures a Loader.
+type Option func(*options)
+
+// WithDecoder sets the Decoder used to decode each file. Defaults to
+// json.Unmarshal.
+func WithDecoder(dec Decoder) Option {
+	return func(o *options) {
+		o.decode = dec
+	}
+}
+
+// Optional allows none of the FSs to have the file, in which case the zero
+// value is loaded.
+func Optional() Option {
+	return func(o *options) {
+		o.optional = true
+	}
+}
+
+// PollInterval sets how often the files are checked for changes when watched,
+// for FSs that do not implement fs.WatchFS. Defaults to 30 seconds.
+func PollInterval(d time.Duration) Option {
+	return func(o *options) {
+		o.interval = d
+	}
+}
+
+// Loader loads a configuration file from a chain of FSs.
+type Loader[T any] struct {
+	name   string
+	stores []fs.FS
+	opts   options
+}
+
+// New returns a Loader for the given file in the given FSs. The FSs are given
+// in order of priority, so the file in the first FS overrides those after it.
+func New[T any](name string, stores []fs.FS, opts ...Option) *Loader[T] {
+	o := options{
+		decode:   json.Unmarshal,
+		interval: 30 * time.Second,
+	}
+
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return &Loader[T]{
+		name:   name,
+		stores: stores,
+		opts:   o,
+	}
+}
+
+func readAll(s fs.FS, name string) ([]byte, error) {
+	f, err := s.Open(name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	return io.ReadAll(f)
+}
+
+// Load loads the file from each FS, starting with the last, and decodes it
+// into the returned value. FSs that do not have the file are skipped. If none
+// of the FSs have the file, then an error is returned that matches
+// fs.ErrNotExist, unless the Optional option was given.
+func (l *Loader[T]) Load() (T, error) {
+	var (
+		v     T
+		found bool
+	)
+
+	for i := len(l.stores) - 1; i >= 0; i-- {
+		b, err := readAll(l.stores[i], l.name)
+
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+
+			var zero T
+			return zero, err
+		}
+
+		if err := l.opts.decode(b, &v); err != nil {
+			var zero T
+			return zero, fmt.Errorf("config: %s: %w", l.name, err)
+		}
+		found = true
+	}
+
+	if !found && !l.opts.optional {
+		var zero T
+		return zero, &fs.PathError{Op: "config", Path: l.name, Err: fs.ErrNotExist}
+	}
+	return v, nil
+}
+
+// Watch loads the files each time any of them change, until the given context
+// is done, and calls fn with the value loaded. The files are first loaded when
+// Watch is called, returning any error, and the value is only passed to fn if
+// it differs from the last one loaded. An error from loading the files, or
+// from watching them, is passed to fn with the last value loaded, so a broken
+// change to a file does not replace a working configuration.
+func (l *Loader[T]) Watch(ctx context.Context, fn func(T, error)) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	events := make(chan fs.Event)
+
+	for _, s := range l.stores {
+		ch, err := fs.Watch(ctx, s, l.name, l.opts.interval)
+
+		if err != nil {
+			return err
+		}
+
+		go func(ch <-chan fs.Event) {
+			for ev := range ch {
+				select {
+				case events <- ev:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(ch)
+	}
+
+	last, err := l.Load()
+
+	if err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case ev := <-events:
+			if ev.Err != nil {
+				fn(last, ev.Err)
+				continue
+			}
+
+			v, err := l.Load()
+
+			if err != nil {
+				fn(last, err)
+				continue
+			}
+
+			if reflect.DeepEqual(v, last) {
+				continue
+			}
+
+			last = v
+			fn(v, nil)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andrewpillar/fs"
+	"github.com/andrewpillar/fs/fakefs"
+)
+
+type appConfig struct {
+	Addr  string
+	Debug bool
+	Log   string
+}
+
+func putFile(t *testing.T, s fs.FS, name, content string) {
+	f, err := fs.ReadFile(name, strings.NewReader(content))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Put(f); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_Load(t *testing.T) {
+	remote := fakefs.New()
+	local := fakefs.New()
+
+	l := New[appConfig]("app.json", []fs.FS{remote, local})
+
+	if _, err := l.Load(); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("unexpected error, expected=%q, got=%q\n", fs.ErrNotExist, err)
+	}
+
+	putFile(t, local, "app.json", `{"Addr":":8080","Log":"info"}`)
+	putFile(t, remote, "app.json", `{"Addr":":9090","Debug":true}`)
+
+	cfg, err := l.Load()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := appConfig{Addr: ":9090", Debug: true, Log: "info"}
+
+	if cfg != expected {
+		t.Fatalf("unexpected config, expected=%+v, got=%+v\n", expected, cfg)
+	}
+
+	remote.Fail("open", "app.json", errors.New("connection reset"))
+
+	if _, err := l.Load(); err == nil {
+		t.Fatalf("expected error loading from failing FS\n")
+	}
+
+	if _, err := New[appConfig]("missing.json", []fs.FS{local}, Optional()).Load(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_Watch(t *testing.T) {
+	remote := fakefs.New()
+	local := fakefs.New()
+
+	putFile(t, local, "app.json", `{"Addr":":8080"}`)
+
+	l := New[appConfig]("app.json", []fs.FS{remote, local}, PollInterval(10*time.Millisecond))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	loaded := make(chan appConfig)
+
+	done := make(chan error)
+
+	go func() {
+		done <- l.Watch(ctx, func(cfg appConfig, err error) {
+			if err == nil {
+				loaded <- cfg
+			}
+		})
+	}()
+
+	// Give the watchers time to start before the file changes.
+	time.Sleep(50 * time.Millisecond)
+
+	putFile(t, remote, "app.json", `{"Debug":true}`)
+
+	select {
+	case cfg := <-loaded:
+		if !cfg.Debug || cfg.Addr != ":8080" {
+			t.Fatalf("unexpected config, expected=%+v, got=%+v\n", appConfig{Addr: ":8080", Debug: true}, cfg)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("timed out waiting for config\n")
+	}
+
+	cancel()
+
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("unexpected error, expected=%q, got=%q\n", context.Canceled, err)
+	}
+}
@@ -0,0 +1,100 @@
+package fs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+)
+
+// MetadataContentType is the metadata key for the content type of a file.
+const MetadataContentType = "content-type"
+
+// sniffLen is the number of bytes http.DetectContentType considers.
+const sniffLen = 512
+
+// MetadataFile is the interface implemented by a File that carries metadata
+// with it, which is stored alongside the file by PutMetadata.
+type MetadataFile interface {
+	File
+
+	// Metadata returns the metadata of the file.
+	Metadata() Metadata
+}
+
+type sniffedFile struct {
+	File
+
+	r    io.Reader
+	meta Metadata
+}
+
+func (f *sniffedFile) Read(p []byte) (int, error) {
+	return f.r.Read(p)
+}
+
+func (f *sniffedFile) Metadata() Metadata {
+	return f.meta
+}
+
+// DetectContentType detects the content type of the given file via
+// http.DetectContentType, and returns the content type along with a File
+// that reads the entire file, including the bytes read to detect the content
+// type. The returned File implements MetadataFile, with the content type set
+// under MetadataContentType. The given file should not be read from once this
+// is called.
+func DetectContentType(f File) (string, File, error) {
+	head := make([]byte, sniffLen)
+
+	n, err := io.ReadFull(f, head)
+
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", nil, err
+	}
+
+	head = head[:n]
+	ctype := http.DetectContentType(head)
+
+	return ctype, &sniffedFile{
+		File: f,
+		r:    io.MultiReader(bytes.NewReader(head), f),
+		meta: Metadata{MetadataContentType: ctype},
+	}, nil
+}
+
+// PutMetadata puts the given file in the filesystem, and if the file
+// implements MetadataFile, then its metadata is set on the stored file. If the
+// filesystem does not implement MetadataFS then the file is put without its
+// metadata. The same is true if setting the metadata returns ErrUnsupported,
+// as the os filesystem does where extended attributes are not supported, since
+// the file has already been stored.
+func PutMetadata(s FS, f File) (File, error) {
+	stored, err := s.Put(f)
+
+	if err != nil {
+		return nil, err
+	}
+
+	mf, ok := f.(MetadataFile)
+
+	if !ok {
+		return stored, nil
+	}
+
+	if _, ok := s.(MetadataFS); !ok {
+		return stored, nil
+	}
+
+	info, err := stored.Stat()
+
+	if err != nil {
+		stored.Close()
+		return nil, err
+	}
+
+	if err := SetMetadata(s, info.Name(), mf.Metadata()); err != nil && !errors.Is(err, ErrUnsupported) {
+		stored.Close()
+		return nil, err
+	}
+	return stored, nil
+}
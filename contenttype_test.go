@@ -0,0 +1,138 @@
+package fs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"testing"
+)
+
+func Test_DetectContentType(t *testing.T) {
+	tests := []struct {
+		data     []byte
+		expected string
+	}{
+		{[]byte("<!DOCTYPE html><html></html>"), "text/html; charset=utf-8"},
+		{[]byte("\x89PNG\x0d\x0a\x1a\x0a"), "image/png"},
+		{[]byte("plain text"), "text/plain; charset=utf-8"},
+		{[]byte{}, "text/plain; charset=utf-8"},
+		{append([]byte("%PDF-"), generateData(t, 4096)...), "application/pdf"},
+	}
+
+	for i, test := range tests {
+		f, err := ReadFile("file", bytes.NewReader(test.data))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ctype, sniffed, err := DetectContentType(f)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if ctype != test.expected {
+			t.Fatalf("tests[%d] - unexpected content type, expected=%q, got=%q\n", i, test.expected, ctype)
+		}
+
+		b, err := io.ReadAll(sniffed)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(b, test.data) {
+			t.Fatalf("tests[%d] - unexpected content after detection\n", i)
+		}
+
+		if md := sniffed.(MetadataFile).Metadata(); md[MetadataContentType] != ctype {
+			t.Fatalf("tests[%d] - unexpected metadata, expected=%q, got=%q\n", i, ctype, md[MetadataContentType])
+		}
+	}
+}
+
+func Test_PutMetadata(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	store := New(dir)
+
+	f, err := ReadFile("page.html", bytes.NewReader([]byte("<html></html>")))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, sniffed, err := DetectContentType(f)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := PutMetadata(store, sniffed)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored.Close()
+
+	md, err := GetMetadata(store, "page.html")
+
+	if err != nil {
+		if errors.Is(err, ErrUnsupported) {
+			t.Skip("extended attributes are not supported")
+		}
+		t.Fatal(err)
+	}
+
+	if ctype := md[MetadataContentType]; ctype != "text/html; charset=utf-8" {
+		t.Fatalf("unexpected content type, expected=%q, got=%q\n", "text/html; charset=utf-8", ctype)
+	}
+}
+
+// noMetadataFS is a filesystem that implements MetadataFS, but does not
+// support metadata, as is the case for the os filesystem without extended
+// attributes.
+type noMetadataFS struct {
+	FS
+}
+
+func (s noMetadataFS) Metadata(name string) (Metadata, error) {
+	return nil, &PathError{Op: "metadata", Path: name, Err: ErrUnsupported}
+}
+
+func (s noMetadataFS) SetMetadata(name string, md Metadata) error {
+	return &PathError{Op: "setmetadata", Path: name, Err: ErrUnsupported}
+}
+
+func Test_PutMetadataUnsupported(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	store := noMetadataFS{FS: New(dir)}
+
+	f, err := ReadFile("page.html", bytes.NewReader([]byte("<html></html>")))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, sniffed, err := DetectContentType(f)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := PutMetadata(store, sniffed)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored.Close()
+
+	if _, err := store.Stat("page.html"); err != nil {
+		t.Fatal(err)
+	}
+}
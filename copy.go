@@ -0,0 +1,74 @@
+package fs
+
+import (
+	"io"
+	"os"
+)
+
+// unwrapFile returns the original File of a File returned from Rename.
+func unwrapFile(f File) File {
+	for {
+		rf, ok := f.(*openFile)
+
+		if !ok {
+			return f
+		}
+		f = rf.File
+	}
+}
+
+// clone attempts to clone all of src into dst. This is only attempted if src
+// has not been read from yet, since a clone always covers the entire file.
+func clone(dst, src *os.File) (int64, bool) {
+	if off, err := src.Seek(0, io.SeekCurrent); err != nil || off != 0 {
+		return 0, false
+	}
+
+	if err := cloneFile(dst, src); err != nil {
+		return 0, false
+	}
+
+	n, err := src.Seek(0, io.SeekEnd)
+
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
+
+// copyFile copies the contents of src to the file dst. If src is an *os.File
+// then first a reflink clone is attempted, which turns the copy into a
+// metadata operation on filesystems that support it. If that fails and src is
+// sparse, then only the data in src is copied so the holes are preserved.
+// Otherwise dst.ReadFrom is used, which lets the kernel copy the data via
+// copy_file_range or sendfile where available. If src implements io.WriterTo
+// then that is used, otherwise the data is copied via a pooled buffer.
+func copyFile(dst *os.File, src File) (int64, error) {
+	if f, ok := unwrapFile(src).(*os.File); ok {
+		if n, ok := clone(dst, f); ok {
+			return n, nil
+		}
+
+		if n, ok, err := copySparse(dst, f); ok {
+			return n, err
+		}
+		return dst.ReadFrom(f)
+	}
+	return copyBuffer(dst, src)
+}
+
+// Copy copies the named file from the src filesystem to the dst filesystem,
+// and returns the file as it is stored in dst. The file is stored at the same
+// path in dst as it is in src. When both filesystems are on the operating
+// system's filesystem the data is copied by the kernel where possible.
+func Copy(dst, src FS, name string) (File, error) {
+	f, err := src.Open(name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	return PutPath(dst, name, f)
+}
@@ -0,0 +1,44 @@
+package fs
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_Copy(t *testing.T) {
+	src := tmpdir(t)
+	defer os.RemoveAll(src)
+
+	dst := tmpdir(t)
+	defer os.RemoveAll(dst)
+
+	buf := generateData(t, 1<<20)
+
+	if err := os.MkdirAll(filepath.Join(src, "dir"), 0750); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(src, "dir", "file"), buf, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := Copy(New(dst), New(src), "dir/file")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	b, err := os.ReadFile(filepath.Join(dst, "dir", "file"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(b, buf) {
+		t.Fatal("unexpected file content")
+	}
+}
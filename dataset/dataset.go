@@ -0,0 +1,343 @@
+// Package dataset writes rows of data into size bounded files in an FS.
+//
+// A Writer encodes the rows written to it into a file that is put into the FS
+// once it reaches its limits, at which point a new file is started. This lets
+// exporters write datasets to any FS, for example,
+//
+//	w := dataset.NewWriter(store, "events",
+//		dataset.WithFormat(dataset.CSV("id", "type", "time")),
+//		dataset.RotateBytes(128<<20),
+//	)
+//	defer w.Close()
+//
+//	for _, ev := range events {
+//		if err := w.Write([]string{ev.ID, ev.Type, ev.Time}); err != nil {
+//			return err
+//		}
+//	}
+//
+// Rows are encoded as CSV or JSON lines. Other formats, such as Parquet, can
+// be written by implementing Format.
+package dataset
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/andrewpillar/fs"
+)
+
+// Encoder encodes rows into a single file of a dataset.
+type Encoder interface {
+	// Encode encodes the given row.
+	Encode(row any) error
+
+	// Close writes anything buffered, along with any footer of the format.
+	// It does not close the underlying writer.
+	Close() error
+}
+
+// Format is the format the files of a dataset are written in.
+type Format interface {
+	// Ext returns the extension of the files, including the leading dot.
+	Ext() string
+
+	// NewEncoder returns an Encoder that writes rows to the given writer.
+	NewEncoder(w io.Writer) (Encoder, error)
+}
+
+type csvFormat struct {
+	header []string
+}
+
+// CSV returns a Format that writes rows as CSV. Rows must be a []string. If a
+// header is given then it is written at the start of each file.
+func CSV(header ...string) Format {
+	return csvFormat{header: header}
+}
+
+func (csvFormat) Ext() string { return ".csv" }
+
+func (f csvFormat) NewEncoder(w io.Writer) (Encoder, error) {
+	enc := csvEncoder{w: csv.NewWriter(w)}
+
+	if len(f.header) > 0 {
+		if err := enc.w.Write(f.header); err != nil {
+			return nil, err
+		}
+	}
+	return enc, nil
+}
+
+type csvEncoder struct {
+	w *csv.Writer
+}
+
+func (e csvEncoder) Encode(row any) error {
+	rec, ok := row.([]string)
+
+	if !ok {
+		return fmt.Errorf("dataset: csv row must be []string, got %T", row)
+	}
+
+	if err := e.w.Write(rec); err != nil {
+		return err
+	}
+
+	// Flush so the size of the file is known after each row.
+	e.w.Flush()
+	return e.w.Error()
+}
+
+func (e csvEncoder) Close() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+type jsonLines struct{}
+
+// JSONLines returns a Format that writes each row as a line of JSON.
+func JSONLines() Format {
+	return jsonLines{}
+}
+
+func (jsonLines) Ext() string { return ".jsonl" }
+
+func (jsonLines) NewEncoder(w io.Writer) (Encoder, error) {
+	return jsonEncoder{enc: json.NewEncoder(w)}, nil
+}
+
+type jsonEncoder struct {
+	enc *json.Encoder
+}
+
+func (e jsonEncoder) Encode(row any) error { return e.enc.Encode(row) }
+func (jsonEncoder) Close() error           { return nil }
+
+// countWriter counts the bytes written through it.
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// Writer writes rows into rotated files within a directory of an FS. It is
+// safe for concurrent use.
+type Writer struct {
+	fs     fs.FS
+	dir    string
+	format Format
+
+	maxBytes int64
+	maxRows  int64
+	maxAge   time.Duration
+	now      func() time.Time
+	onPut    func(name string)
+
+	mu      sync.Mutex
+	seq     int
+	tmp     *os.File
+	count   *countWriter
+	enc     Encoder
+	sealed  bool // Whether the encoder has been closed, and the file is to be put.
+	rows    int64
+	started time.Time
+}
+
+// Option configures a Writer.
+type Option func(*Writer)
+
+// WithFormat sets the format the files are written in. Defaults to CSV without
+// a header.
+func WithFormat(f Format) Option {
+	return func(w *Writer) {
+		w.format = f
+	}
+}
+
+// RotateBytes sets the size in bytes a file may grow to before it is put, and
+// a new file started. A file may exceed this by the size of a single row.
+// Defaults to 128MB.
+func RotateBytes(n int64) Option {
+	return func(w *Writer) {
+		w.maxBytes = n
+	}
+}
+
+// RotateRows sets the number of rows a file may hold before it is put, and a
+// new file started. Defaults to no limit.
+func RotateRows(n int64) Option {
+	return func(w *Writer) {
+		w.maxRows = n
+	}
+}
+
+// RotateEvery sets how long a file may be written to before it is put, and a
+// new file started. The age of a file is checked on each write, so a file is
+// not put until a row is written after it has expired, or the Writer is
+// flushed. Defaults to no limit.
+func RotateEvery(d time.Duration) Option {
+	return func(w *Writer) {
+		w.maxAge = d
+	}
+}
+
+// OnPut sets the function called with the name of each file once it has been
+// put into the FS.
+func OnPut(fn func(name string)) Option {
+	return func(w *Writer) {
+		w.onPut = fn
+	}
+}
+
+// NewWriter returns a Writer that writes rows into files in the given
+// directory of the FS. Each file is named after the time it was started and
+// its sequence in the Writer, such as 20060102T150405Z-000001.csv, so files
+// sort in the order they were written. Files are written to a temporary file
+// on disk until they are put.
+func NewWriter(s fs.FS, dir string, opts ...Option) *Writer {
+	w := &Writer{
+		fs:       s,
+		dir:      dir,
+		format:   CSV(),
+		maxBytes: 128 << 20,
+		now:      time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(w)
+	}
+	return w
+}
+
+// open starts a new file.
+func (w *Writer) open() error {
+	tmp, err := os.CreateTemp("", "dataset-*")
+
+	if err != nil {
+		return err
+	}
+
+	count := &countWriter{w: tmp}
+
+	enc, err := w.format.NewEncoder(count)
+
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	w.seq++
+	w.tmp = tmp
+	w.count = count
+	w.enc = enc
+	w.sealed = false
+	w.rows = 0
+	w.started = w.now()
+	return nil
+}
+
+// full reports whether the current file has reached any of its limits.
+func (w *Writer) full() bool {
+	if w.maxBytes > 0 && w.count.n >= w.maxBytes {
+		return true
+	}
+
+	if w.maxRows > 0 && w.rows >= w.maxRows {
+		return true
+	}
+	return w.maxAge > 0 && w.now().Sub(w.started) >= w.maxAge
+}
+
+// rotate puts the current file into the FS. If the file fails to be put then
+// it is kept, and put again on the next write or flush.
+func (w *Writer) rotate() error {
+	if w.tmp == nil {
+		return nil
+	}
+
+	if !w.sealed {
+		if err := w.enc.Close(); err != nil {
+			return err
+		}
+		w.sealed = true
+	}
+
+	if _, err := w.tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s-%06d%s", w.started.UTC().Format("20060102T150405Z"), w.seq, w.format.Ext())
+
+	stored, err := fs.PutPath(w.fs, path.Join(w.dir, name), fs.Rename(w.tmp, name))
+
+	if err != nil {
+		return err
+	}
+	stored.Close()
+
+	w.tmp.Close()
+	os.Remove(w.tmp.Name())
+	w.tmp = nil
+
+	if w.onPut != nil {
+		w.onPut(path.Join(w.dir, name))
+	}
+	return nil
+}
+
+// Write writes the given row. If the current file has reached its limits
+// after the row is written, then it is put into the FS.
+func (w *Writer) Write(row any) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.tmp != nil && (w.sealed || w.full()) {
+		if err := w.rotate(); err != nil {
+			return err
+		}
+	}
+
+	if w.tmp == nil {
+		if err := w.open(); err != nil {
+			return err
+		}
+	}
+
+	if err := w.enc.Encode(row); err != nil {
+		return err
+	}
+
+	w.rows++
+
+	if w.full() {
+		return w.rotate()
+	}
+	return nil
+}
+
+// Flush puts the current file into the FS, if any rows have been written to
+// it, so the next row starts a new file.
+func (w *Writer) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.rotate()
+}
+
+// Close flushes the Writer.
+func (w *Writer) Close() error {
+	return w.Flush()
+}
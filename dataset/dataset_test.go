@@ -0,0 +1,132 @@
+package dataset
+
+import (
+	"errors"
+	"io"
+	"strconv"
+	"testing"
+
+	"github.com/andrewpillar/fs"
+	"github.com/andrewpillar/fs/fakefs"
+)
+
+func read(t *testing.T, s fs.FS, name string) string {
+	f, err := s.Open(name)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	b, err := io.ReadAll(f)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func Test_Writer(t *testing.T) {
+	type row struct {
+		ID int `json:"id"`
+	}
+
+	tests := []struct {
+		opts     []Option
+		row      func(i int) any
+		expected []string
+	}{
+		{
+			[]Option{WithFormat(CSV("id", "name")), RotateRows(2)},
+			func(i int) any { return []string{strconv.Itoa(i), "row" + strconv.Itoa(i)} },
+			[]string{
+				"id,name\n0,row0\n1,row1\n",
+				"id,name\n2,row2\n3,row3\n",
+				"id,name\n4,row4\n",
+			},
+		},
+		{
+			[]Option{WithFormat(JSONLines()), RotateBytes(20)},
+			func(i int) any { return row{ID: i} },
+			[]string{
+				"{\"id\":0}\n{\"id\":1}\n{\"id\":2}\n",
+				"{\"id\":3}\n{\"id\":4}\n",
+			},
+		},
+	}
+
+	for i, test := range tests {
+		store := fakefs.New()
+
+		var names []string
+
+		w := NewWriter(store, "events", append(test.opts, OnPut(func(name string) {
+			names = append(names, name)
+		}))...)
+
+		for j := 0; j < 5; j++ {
+			if err := w.Write(test.row(j)); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(names) != len(test.expected) {
+			t.Fatalf("tests[%d] - unexpected files, expected=%d, got=%d\n", i, len(test.expected), len(names))
+		}
+
+		ents, err := fs.ReadDir(store, "events")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(ents) != len(test.expected) {
+			t.Fatalf("tests[%d] - unexpected entries, expected=%d, got=%d\n", i, len(test.expected), len(ents))
+		}
+
+		for j, name := range names {
+			if data := read(t, store, name); data != test.expected[j] {
+				t.Fatalf("tests[%d] - unexpected content of %s, expected=%q, got=%q\n", i, name, test.expected[j], data)
+			}
+		}
+	}
+}
+
+func Test_WriterRetry(t *testing.T) {
+	errOffline := errors.New("offline")
+
+	store := fakefs.New()
+	store.Fail("put", "", errOffline)
+
+	w := NewWriter(store, ".", RotateRows(1))
+
+	if err := w.Write([]string{"a"}); !errors.Is(err, errOffline) {
+		t.Fatalf("unexpected error, expected=%q, got=%q\n", errOffline, err)
+	}
+
+	store.Fail("put", "", nil)
+
+	// The file that failed to be put is put before the next row is written.
+	if err := w.Write([]string{"b"}); err != nil {
+		t.Fatal(err)
+	}
+
+	ents, err := fs.ReadDir(store, ".")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ents) != 2 {
+		t.Fatalf("unexpected entries, expected=%d, got=%d\n", 2, len(ents))
+	}
+
+	if data := read(t, store, ents[0].Name()); data != "a\n" {
+		t.Fatalf("unexpected content, expected=%q, got=%q\n", "a\n", data)
+	}
+}
@@ -0,0 +1,11 @@
+package fs
+
+// DebugFS is the interface implemented by a filesystem that can report its
+// internal state, such as the hit rate of a cache, for debugging.
+type DebugFS interface {
+	FS
+
+	// Debug returns the internal state of the filesystem. The values must be
+	// encodable as JSON.
+	Debug() map[string]any
+}
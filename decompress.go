@@ -0,0 +1,166 @@
+package fs
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+)
+
+// Decoder decompresses files that begin with its magic bytes.
+type Decoder struct {
+	// Magic is the sequence of bytes a compressed file begins with.
+	Magic []byte
+
+	// NewReader returns a reader that decompresses the given reader.
+	NewReader func(r io.Reader) (io.ReadCloser, error)
+}
+
+// ZstdMagic is the sequence of bytes a zstd compressed file begins with. The
+// standard library provides no zstd decompressor, so a Decoder for it must be
+// given to Decompress using a third party implementation.
+var ZstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+// GzipDecoder decompresses gzip compressed files.
+var GzipDecoder = Decoder{
+	Magic: []byte{0x1f, 0x8b},
+	NewReader: func(r io.Reader) (io.ReadCloser, error) {
+		return gzip.NewReader(r)
+	},
+}
+
+type decompressFS struct {
+	FS
+
+	decoders []Decoder
+	peek     int
+}
+
+// Decompress returns a filesystem that transparently decompresses files
+// opened from the given filesystem, detecting the compression of each file
+// from its magic bytes. Files that do not match any of the given decoders are
+// returned as is. If no decoders are given then GzipDecoder is used.
+//
+// The FileInfo of a decompressed file is that of the file as stored, so the
+// size reported is the compressed size.
+func Decompress(s FS, decoders ...Decoder) FS {
+	if len(decoders) == 0 {
+		decoders = []Decoder{GzipDecoder}
+	}
+
+	peek := 0
+
+	for _, d := range decoders {
+		if len(d.Magic) > peek {
+			peek = len(d.Magic)
+		}
+	}
+
+	ds := &decompressFS{
+		FS:       s,
+		decoders: decoders,
+		peek:     peek,
+	}
+
+	if canRename(s) {
+		return renameDecompressFS{decompressFS: ds}
+	}
+	return ds
+}
+
+// renameDecompressFS is a decompressFS over a filesystem that implements RenameFS.
+type renameDecompressFS struct {
+	*decompressFS
+}
+
+type decompressedFile struct {
+	File
+
+	r io.ReadCloser
+}
+
+func (f *decompressedFile) Read(p []byte) (int, error) {
+	return f.r.Read(p)
+}
+
+func (f *decompressedFile) Close() error {
+	err := f.r.Close()
+
+	if err1 := f.File.Close(); err == nil {
+		err = err1
+	}
+	return err
+}
+
+// decode returns a reader that decompresses the given file if it begins with
+// the magic bytes of one of the decoders.
+func (s *decompressFS) decode(f File) (File, error) {
+	br := bufio.NewReaderSize(f, s.peek)
+
+	magic, err := br.Peek(s.peek)
+
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	for _, d := range s.decoders {
+		if len(d.Magic) == 0 || !bytes.HasPrefix(magic, d.Magic) {
+			continue
+		}
+
+		r, err := d.NewReader(br)
+
+		if err != nil {
+			return nil, err
+		}
+		return &decompressedFile{File: f, r: r}, nil
+	}
+	return &decompressedFile{File: f, r: io.NopCloser(br)}, nil
+}
+
+func (s *decompressFS) Unwrap() FS { return s.FS }
+
+func (s *decompressFS) Open(name string) (File, error) {
+	f, err := s.FS.Open(name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	df, err := s.decode(f)
+
+	if err != nil {
+		f.Close()
+		return nil, &PathError{Op: "open", Path: name, Err: err}
+	}
+	return df, nil
+}
+
+func (s *decompressFS) Sub(dir string) (FS, error) {
+	sub, err := s.FS.Sub(dir)
+
+	if err != nil {
+		return nil, err
+	}
+	return Decompress(sub, s.decoders...), nil
+}
+
+func (s *decompressFS) ReadDir(name string) ([]DirEntry, error) {
+	return ReadDir(s.FS, name)
+}
+
+func (s renameDecompressFS) Rename(oldname, newname string) error {
+	return Move(s.FS, oldname, newname)
+}
+
+func (s *decompressFS) Link(oldname, newname string) error {
+	return Link(s.FS, oldname, newname)
+}
+
+func (s *decompressFS) Metadata(name string) (Metadata, error) {
+	return GetMetadata(s.FS, name)
+}
+
+func (s *decompressFS) SetMetadata(name string, md Metadata) error {
+	return SetMetadata(s.FS, name, md)
+}
@@ -0,0 +1,84 @@
+package fs
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_Decompress(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	var buf bytes.Buffer
+
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte("compressed"))
+	zw.Close()
+
+	files := map[string][]byte{
+		"compressed.gz": buf.Bytes(),
+		"raw":           []byte("raw"),
+		"short":         []byte("s"),
+		"empty":         nil,
+	}
+
+	for name, b := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), b, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"compressed.gz", "compressed"},
+		{"raw", "raw"},
+		{"short", "s"},
+		{"empty", ""},
+	}
+
+	store := Decompress(New(dir))
+
+	for i, test := range tests {
+		f, err := store.Open(test.name)
+
+		if err != nil {
+			t.Fatalf("tests[%d] - %s\n", i, err)
+		}
+
+		b, err := io.ReadAll(f)
+
+		if err != nil {
+			t.Fatalf("tests[%d] - %s\n", i, err)
+		}
+		f.Close()
+
+		if string(b) != test.expected {
+			t.Fatalf("tests[%d] - unexpected content, expected=%q, got=%q\n", i, test.expected, string(b))
+		}
+	}
+}
+
+func Test_DecompressCorrupt(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	// Gzip magic bytes followed by an invalid header.
+	if err := os.WriteFile(filepath.Join(dir, "corrupt"), []byte{0x1f, 0x8b, 0}, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := Decompress(New(dir)).Open("corrupt")
+
+	var perr *PathError
+
+	if !errors.As(err, &perr) {
+		t.Fatalf("unexpected error, expected=%T, got=%T\n", perr, err)
+	}
+}
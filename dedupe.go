@@ -0,0 +1,146 @@
+package fs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"sort"
+)
+
+// FindDuplicates walks the given filesystem and returns the groups of files
+// with identical contents, keyed by the hex encoded SHA-256 of the contents.
+// The names in each group are sorted. Only files that share their size with
+// another file are hashed, so files of a unique size are never read. The
+// filesystem must implement ReadDirFS.
+func FindDuplicates(s FS) (map[string][]string, error) {
+	sizes := make(map[int64][]string)
+
+	err := Walk(s, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := d.Info()
+
+		if err != nil {
+			return err
+		}
+
+		sizes[info.Size()] = append(sizes[info.Size()], name)
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	dups := make(map[string][]string)
+
+	for _, names := range sizes {
+		if len(names) < 2 {
+			continue
+		}
+
+		groups := make(map[string][]string)
+
+		for _, name := range names {
+			sum, err := hashFile(s, name)
+
+			if err != nil {
+				return nil, err
+			}
+			groups[sum] = append(groups[sum], name)
+		}
+
+		for sum, group := range groups {
+			if len(group) > 1 {
+				sort.Strings(group)
+				dups[sum] = group
+			}
+		}
+	}
+	return dups, nil
+}
+
+func hashFile(s FS, name string) (string, error) {
+	f, err := s.Open(name)
+
+	if err != nil {
+		return "", err
+	}
+
+	defer f.Close()
+
+	h := sha256.New()
+
+	if _, err := io.Copy(h, f); err != nil {
+		return "", &PathError{Op: "read", Path: name, Err: err}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Dedupe replaces the duplicates found by FindDuplicates with hard links to the
+// first file in each group, and returns the number of files replaced. Each
+// file is hashed again before it is linked, and files that no longer match the
+// hash of their group are left as they are, so files that changed since they
+// were found are not lost. Each duplicate is replaced by linking to a temporary
+// name that is then renamed over it, so a duplicate is never missing. The
+// filesystem must implement LinkFS and RenameFS.
+//
+// Files that are linked share their contents, so writing to one in place
+// changes them all. Files put via New replace the file rather than writing to
+// it, so are safe to put again after they are linked.
+func Dedupe(s FS, dups map[string][]string) (int, error) {
+	n := 0
+
+	for sum, group := range dups {
+		if len(group) < 2 {
+			continue
+		}
+
+		keep := group[0]
+
+		keepSum, err := hashFile(s, keep)
+
+		if err != nil {
+			return n, err
+		}
+
+		if keepSum != sum {
+			continue
+		}
+
+		for _, name := range group[1:] {
+			nameSum, err := hashFile(s, name)
+
+			if err != nil {
+				return n, err
+			}
+
+			if nameSum != sum {
+				continue
+			}
+
+			tmp := name + ".dedupe"
+
+			if err := Link(s, keep, tmp); err != nil {
+				return n, err
+			}
+
+			if err := Move(s, tmp, name); err != nil {
+				if rmerr := s.Remove(tmp); rmerr != nil && !errors.Is(rmerr, ErrNotExist) {
+					return n, rmerr
+				}
+				return n, err
+			}
+			n++
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,151 @@
+package fs
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func Test_FindDuplicates(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	if err := os.MkdirAll(filepath.Join(dir, "dir"), 0750); err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]string{
+		"a":      "duplicate",
+		"b":      "duplicate",
+		"c":      "different",
+		"d":      "unique size",
+		"dir/e":  "duplicate",
+		"dir/f":  "other",
+		"dir/f2": "other",
+	}
+
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	store := New(dir)
+
+	dups, err := FindDuplicates(store)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	groups := make([][]string, 0, len(dups))
+
+	for _, group := range dups {
+		groups = append(groups, group)
+	}
+
+	if len(groups) == 2 && groups[0][0] != "a" {
+		groups[0], groups[1] = groups[1], groups[0]
+	}
+
+	expected := [][]string{
+		{"a", "b", "dir/e"},
+		{"dir/f", "dir/f2"},
+	}
+
+	if !reflect.DeepEqual(groups, expected) {
+		t.Fatalf("unexpected duplicates, expected=%v, got=%v\n", expected, groups)
+	}
+
+	n, err := Dedupe(store, dups)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 3 {
+		t.Fatalf("unexpected files replaced, expected=%d, got=%d\n", 3, n)
+	}
+
+	for i, group := range expected {
+		keep, err := os.Stat(filepath.Join(dir, group[0]))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, name := range group[1:] {
+			info, err := os.Stat(filepath.Join(dir, name))
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !os.SameFile(keep, info) {
+				t.Fatalf("groups[%d] - expected %q to be linked to %q\n", i, name, group[0])
+			}
+		}
+	}
+}
+
+func Test_Dedupe(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"a", "b", "c"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("duplicate"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	store := New(dir)
+
+	dups, err := FindDuplicates(store)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Changed after the duplicates were found, so should not be linked.
+	if err := os.WriteFile(filepath.Join(dir, "c"), []byte("different"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := Dedupe(store, dups)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 1 {
+		t.Fatalf("unexpected files replaced, expected=%d, got=%d\n", 1, n)
+	}
+
+	f, err := ReadFile("a", bytes.NewReader([]byte("changed")))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := store.Put(f)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored.Close()
+
+	// Putting one of the linked files should not change the other.
+	for name, expected := range map[string]string{"a": "changed", "b": "duplicate", "c": "different"} {
+		b, err := os.ReadFile(filepath.Join(dir, name))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(b) != expected {
+			t.Fatalf("unexpected content for %s, expected=%q, got=%q\n", name, expected, string(b))
+		}
+	}
+}
@@ -0,0 +1,416 @@
+package fs
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// DeltaFS is the interface implemented by a filesystem that can rebuild the
+// files stored in it from ranges of their current content, so only the parts
+// of a file that changed need to be sent to it.
+type DeltaFS interface {
+	FS
+
+	// BlockSums returns the checksums of each whole block of the named file.
+	// A trailing partial block is not included.
+	BlockSums(name string, blockSize int) ([]BlockSum, error)
+
+	// Patch replaces the named file with the concatenation of the given
+	// ranges, and returns the patched file.
+	Patch(name string, ranges []Range) (File, error)
+}
+
+// BlockSum is the checksum of a block of a file, Weak being the rolling
+// checksum and Strong the SHA-256 of the block.
+type BlockSum struct {
+	Weak   uint32
+	Strong [sha256.Size]byte
+}
+
+// Range is a range of a file given to Patch. If Data is nil then the range is
+// the Len bytes at offset Src of the file as it is stored, otherwise it is the
+// Len bytes read from Data.
+type Range struct {
+	Src  int64
+	Len  int64
+	Data io.Reader
+}
+
+// rollingSum is the rolling checksum of a block, as used by rsync.
+type rollingSum struct {
+	a, b uint32
+	n    uint32
+}
+
+func newRollingSum(p []byte) rollingSum {
+	var r rollingSum
+
+	r.n = uint32(len(p))
+
+	for i, c := range p {
+		r.a += uint32(c)
+		r.b += (r.n - uint32(i)) * uint32(c)
+	}
+	return r
+}
+
+func (r *rollingSum) roll(out, in byte) {
+	r.a += uint32(in) - uint32(out)
+	r.b += r.a - r.n*uint32(out)
+}
+
+func (r rollingSum) sum() uint32 {
+	return r.a&0xffff | r.b<<16
+}
+
+// ReadBlockSums returns the checksums of each whole block read from r. This
+// is for filesystems implementing DeltaFS.
+func ReadBlockSums(r io.Reader, blockSize int) ([]BlockSum, error) {
+	if blockSize <= 0 {
+		return nil, ErrInvalid
+	}
+
+	buf := make([]byte, blockSize)
+	sums := make([]BlockSum, 0)
+
+	for {
+		if _, err := io.ReadFull(r, buf); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return sums, nil
+			}
+			return nil, err
+		}
+
+		sums = append(sums, BlockSum{
+			Weak:   newRollingSum(buf).sum(),
+			Strong: sha256.Sum256(buf),
+		})
+	}
+}
+
+// deltaBlockSize returns the block size for a file of the given size, the
+// square root of the size bounded as rsync does.
+func deltaBlockSize(size int64) int {
+	n := int(math.Sqrt(float64(size))) &^ 7
+
+	if n < 700 {
+		return 700
+	}
+	if n > 128<<10 {
+		return 128 << 10
+	}
+	return n
+}
+
+// deltaWindow reads a file via io.ReaderAt in chunks, keeping the chunk that
+// holds the current block in memory.
+type deltaWindow struct {
+	r     io.ReaderAt
+	size  int64
+	start int64
+	buf   []byte
+}
+
+// bytes returns the n bytes of the file at the given offset, which must not
+// be before the offset of the last call.
+func (w *deltaWindow) bytes(off int64, n int) ([]byte, error) {
+	end := w.start + int64(len(w.buf))
+
+	if off >= w.start && off+int64(n) <= end {
+		return w.buf[off-w.start : off-w.start+int64(n)], nil
+	}
+
+	chunk := cap(w.buf)
+
+	if rem := w.size - off; rem < int64(chunk) {
+		chunk = int(rem)
+	}
+
+	buf := w.buf[:chunk]
+
+	if _, err := w.r.ReadAt(buf, off); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	w.start = off
+	w.buf = buf
+
+	return w.buf[:n], nil
+}
+
+// computeDelta returns the ranges that make up the file read from r, copying
+// the blocks of the stored file with the given checksums where they match.
+func computeDelta(r io.ReaderAt, size int64, sums []BlockSum, blockSize int) ([]Range, error) {
+	index := make(map[uint32][]int)
+
+	for i, sum := range sums {
+		index[sum.Weak] = append(index[sum.Weak], i)
+	}
+
+	chunk := 16 * blockSize
+
+	if chunk < 1<<20 {
+		chunk = 1 << 20
+	}
+
+	w := &deltaWindow{
+		r:     r,
+		size:  size,
+		start: -1,
+		buf:   make([]byte, 0, chunk),
+	}
+
+	bs := int64(blockSize)
+
+	ranges := make([]Range, 0)
+
+	add := func(rng Range) {
+		// Copies of consecutive blocks are merged into a single range.
+		if n := len(ranges); n > 0 && rng.Data == nil {
+			if last := &ranges[n-1]; last.Data == nil && last.Src+last.Len == rng.Src {
+				last.Len += rng.Len
+				return
+			}
+		}
+		ranges = append(ranges, rng)
+	}
+
+	var (
+		lit   int64
+		pos   int64
+		sum   rollingSum
+		fresh = true
+	)
+
+	for pos+bs <= size {
+		block, err := w.bytes(pos, blockSize)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if fresh {
+			sum = newRollingSum(block)
+			fresh = false
+		}
+
+		match := -1
+
+		if candidates, ok := index[sum.sum()]; ok {
+			strong := sha256.Sum256(block)
+
+			for _, i := range candidates {
+				if sums[i].Strong == strong {
+					match = i
+					break
+				}
+			}
+		}
+
+		if match >= 0 {
+			if lit < pos {
+				add(Range{Src: lit, Len: pos - lit, Data: io.NewSectionReader(r, lit, pos-lit)})
+			}
+
+			add(Range{Src: int64(match) * bs, Len: bs})
+
+			pos += bs
+			lit = pos
+			fresh = true
+			continue
+		}
+
+		if pos+bs == size {
+			break
+		}
+
+		next, err := w.bytes(pos, blockSize+1)
+
+		if err != nil {
+			return nil, err
+		}
+
+		sum.roll(next[0], next[blockSize])
+		pos++
+	}
+
+	if lit < size {
+		add(Range{Src: lit, Len: size - lit, Data: io.NewSectionReader(r, lit, size-lit)})
+	}
+	return ranges, nil
+}
+
+// PutDelta puts the given file into the filesystem under the given name. If
+// the filesystem implements DeltaFS, and a file of that name is already
+// stored, then only the parts of the file that changed are sent, using the
+// rsync algorithm, and the rest is copied from the stored file by the
+// filesystem. Otherwise the whole file is put via PutPath.
+func PutDelta(s FS, name string, f File) (File, error) {
+	ds, ok := s.(DeltaFS)
+
+	if !ok {
+		return PutPath(s, name, f)
+	}
+
+	info, err := ds.Stat(name)
+
+	if err != nil {
+		if errors.Is(err, ErrNotExist) {
+			return PutPath(s, name, f)
+		}
+		return nil, err
+	}
+
+	if info.IsDir() {
+		return nil, &PathError{Op: "put", Path: name, Err: ErrInvalid}
+	}
+
+	var (
+		ra   io.ReaderAt
+		size int64
+	)
+
+	if v, ok := f.(io.ReaderAt); ok {
+		fi, err := f.Stat()
+
+		if err != nil {
+			return nil, err
+		}
+		ra, size = v, fi.Size()
+	} else {
+		tmp, err := os.CreateTemp("", "fs-delta-*")
+
+		if err != nil {
+			return nil, &PathError{Op: "put", Path: name, Err: err}
+		}
+
+		defer os.Remove(tmp.Name())
+		defer tmp.Close()
+
+		n, err := copyBuffer(tmp, f)
+
+		if err != nil {
+			return nil, &PathError{Op: "put", Path: name, Err: err}
+		}
+		ra, size = tmp, n
+	}
+
+	blockSize := deltaBlockSize(info.Size())
+
+	sums, err := ds.BlockSums(name, blockSize)
+
+	if err != nil {
+		return nil, err
+	}
+
+	ranges, err := computeDelta(ra, size, sums, blockSize)
+
+	if err != nil {
+		return nil, &PathError{Op: "put", Path: name, Err: err}
+	}
+	return ds.Patch(name, ranges)
+}
+
+func (s filesystem) BlockSums(name string, blockSize int) ([]BlockSum, error) {
+	if err := s.check(name); err != nil {
+		return nil, &PathError{Op: "blocksums", Path: name, Err: err}
+	}
+
+	f, err := os.Open(s.path(name))
+
+	if err != nil {
+		return nil, &PathError{Op: "blocksums", Path: name, Err: errors.Unwrap(err)}
+	}
+
+	defer f.Close()
+
+	sums, err := ReadBlockSums(f, blockSize)
+
+	if err != nil {
+		return nil, &PathError{Op: "blocksums", Path: name, Err: err}
+	}
+	return sums, nil
+}
+
+// Patch writes the ranges to a temporary file alongside the named file, which
+// is then renamed to it, so readers never see a partially patched file.
+func (s filesystem) Patch(name string, ranges []Range) (File, error) {
+	if err := s.check(name); err != nil {
+		return nil, &PathError{Op: "patch", Path: name, Err: err}
+	}
+
+	src, err := os.Open(s.path(name))
+
+	if err != nil {
+		return nil, &PathError{Op: "patch", Path: name, Err: errors.Unwrap(err)}
+	}
+
+	defer src.Close()
+
+	suffix := make([]byte, 8)
+
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, &PathError{Op: "patch", Path: name, Err: err}
+	}
+
+	dir := filepath.Dir(s.path(name))
+	tmp := filepath.Join(dir, "."+path.Base(name)+".patch-"+hex.EncodeToString(suffix))
+
+	f, err := s.create(tmp)
+
+	if err != nil {
+		return nil, &PathError{Op: "patch", Path: name, Err: errors.Unwrap(err)}
+	}
+
+	for _, rng := range ranges {
+		r := rng.Data
+
+		if r == nil {
+			r = io.NewSectionReader(src, rng.Src, rng.Len)
+		}
+
+		n, err := copyBuffer(f, io.LimitReader(r, rng.Len))
+
+		if err == nil && n != rng.Len {
+			err = io.ErrUnexpectedEOF
+		}
+
+		if err != nil {
+			f.Close()
+			os.Remove(tmp)
+			return nil, &PathError{Op: "patch", Path: name, Err: err}
+		}
+	}
+
+	if s.durable {
+		if err := s.sync(f); err != nil {
+			f.Close()
+			os.Remove(tmp)
+			return nil, &PathError{Op: "patch", Path: name, Err: errors.Unwrap(err)}
+		}
+	}
+
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return nil, &PathError{Op: "patch", Path: name, Err: errors.Unwrap(err)}
+	}
+
+	if err := os.Rename(tmp, s.path(name)); err != nil {
+		os.Remove(tmp)
+		return nil, &PathError{Op: "patch", Path: name, Err: errors.Unwrap(err)}
+	}
+
+	if s.durable {
+		if err := syncDir(dir); err != nil {
+			return nil, &PathError{Op: "patch", Path: name, Err: errors.Unwrap(err)}
+		}
+	}
+	return s.Open(name)
+}
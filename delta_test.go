@@ -0,0 +1,122 @@
+package fs
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_PutDelta(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	old := make([]byte, 256<<10)
+	rand.New(rand.NewSource(1)).Read(old)
+
+	edit := func(b []byte) []byte {
+		b = append(b[:0:0], b...)
+
+		// Insert, modify, delete, and append.
+		b = append(b[:50000], append([]byte("inserted"), b[50000:]...)...)
+		copy(b[120000:], "modified")
+		b = append(b[:150000], b[153000:]...)
+
+		return append(b, "appended"...)
+	}
+
+	tests := []struct {
+		old []byte
+		new []byte
+	}{
+		{old, edit(old)},
+		{old, old[:1000]},
+		{old[:1000], old},
+		{old, nil},
+	}
+
+	s := New(dir)
+
+	for i, test := range tests {
+		if err := os.WriteFile(filepath.Join(dir, "file"), test.old, 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		f, err := ReadFile("file", bytes.NewReader(test.new))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		stored, err := PutDelta(s, "file", f)
+
+		if err != nil {
+			t.Fatalf("tests[%d] - %s\n", i, err)
+		}
+		stored.Close()
+
+		b, err := os.ReadFile(filepath.Join(dir, "file"))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(b, test.new) {
+			t.Fatalf("tests[%d] - unexpected content, expected=%d bytes, got=%d bytes\n", i, len(test.new), len(b))
+		}
+	}
+
+	// Files that do not exist are put whole.
+	f, err := ReadFile("new", bytes.NewReader(old))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := PutDelta(s, "sub/new", f)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored.Close()
+
+	if b, _ := os.ReadFile(filepath.Join(dir, "sub", "new")); !bytes.Equal(b, old) {
+		t.Fatalf("unexpected content, expected=%d bytes, got=%d bytes\n", len(old), len(b))
+	}
+}
+
+func Test_ComputeDelta(t *testing.T) {
+	old := make([]byte, 256<<10)
+	rand.New(rand.NewSource(1)).Read(old)
+
+	new := append(old[:100000:100000], append([]byte("inserted"), old[100000:]...)...)
+
+	bs := deltaBlockSize(int64(len(old)))
+
+	sums, err := ReadBlockSums(bytes.NewReader(old), bs)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ranges, err := computeDelta(bytes.NewReader(new), int64(len(new)), sums, bs)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sent int64
+
+	for _, r := range ranges {
+		if r.Data != nil {
+			sent += r.Len
+		}
+	}
+
+	// Only the block with the insertion, and the trailing partial block,
+	// should be sent.
+	if max := int64(3 * bs); sent > max {
+		t.Fatalf("unexpected bytes sent, expected at most=%d, got=%d\n", max, sent)
+	}
+}
@@ -0,0 +1,187 @@
+package fs
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+	"time"
+)
+
+// DiffEntry is a file that differs between two trees.
+type DiffEntry struct {
+	Name string `json:"name"`
+
+	// Size and ModTime are those of the file in the new tree, or in the old
+	// tree if the file was removed.
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// TreeDiff is the difference between two trees. Each list is sorted by name.
+type TreeDiff struct {
+	Added   []DiffEntry `json:"added"`
+	Removed []DiffEntry `json:"removed"`
+	Changed []DiffEntry `json:"changed"`
+}
+
+// Empty reports whether the trees are the same.
+func (d *TreeDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// String formats the diff with a line for each file, prefixed with +, -, or ~
+// for added, removed, and changed files, followed by a summary.
+func (d *TreeDiff) String() string {
+	var buf strings.Builder
+
+	for _, e := range d.Added {
+		fmt.Fprintf(&buf, "+ %s (%s)\n", e.Name, HumanSize(e.Size))
+	}
+	for _, e := range d.Removed {
+		fmt.Fprintf(&buf, "- %s (%s)\n", e.Name, HumanSize(e.Size))
+	}
+	for _, e := range d.Changed {
+		fmt.Fprintf(&buf, "~ %s (%s)\n", e.Name, HumanSize(e.Size))
+	}
+
+	fmt.Fprintf(&buf, "%d added, %d removed, %d changed\n", len(d.Added), len(d.Removed), len(d.Changed))
+	return buf.String()
+}
+
+type differ struct {
+	hash bool
+}
+
+// DiffOption configures how Diff compares files.
+type DiffOption func(*differ)
+
+// DiffHash configures Diff to compare files of the same size by the SHA-256
+// of their contents, rather than by their modification times. This reads every
+// file of the same size in both trees, but is not fooled by files that were
+// copied without their modification times.
+func DiffHash() DiffOption {
+	return func(d *differ) {
+		d.hash = true
+	}
+}
+
+func walkFiles(s FS) (map[string]FileInfo, []string, error) {
+	files := make(map[string]FileInfo)
+	names := make([]string, 0)
+
+	err := Walk(s, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			return nil
+		}
+
+		info, err := d.Info()
+
+		if err != nil {
+			return err
+		}
+
+		files[name] = info
+		names = append(names, name)
+		return nil
+	})
+
+	if err != nil {
+		return nil, nil, err
+	}
+	return files, names, nil
+}
+
+func diffEntry(name string, info FileInfo) DiffEntry {
+	return DiffEntry{
+		Name:    name,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+	}
+}
+
+// Diff returns the difference between the old tree a and the new tree b.
+// Files are changed if their sizes differ, or, by default, if their
+// modification times differ. Both filesystems must implement ReadDirFS. If
+// the root of either tree does not exist then it is treated as empty.
+func Diff(a, b FS, opts ...DiffOption) (*TreeDiff, error) {
+	var d differ
+
+	for _, opt := range opts {
+		opt(&d)
+	}
+
+	old, oldNames, err := walkFiles(a)
+
+	if err != nil && !errors.Is(err, ErrNotExist) {
+		return nil, err
+	}
+
+	cur, curNames, err := walkFiles(b)
+
+	if err != nil && !errors.Is(err, ErrNotExist) {
+		return nil, err
+	}
+
+	// Walk visits names in lexical order, so each list is sorted.
+	diff := &TreeDiff{
+		Added:   make([]DiffEntry, 0),
+		Removed: make([]DiffEntry, 0),
+		Changed: make([]DiffEntry, 0),
+	}
+
+	for _, name := range oldNames {
+		if _, ok := cur[name]; !ok {
+			diff.Removed = append(diff.Removed, diffEntry(name, old[name]))
+		}
+	}
+
+	for _, name := range curNames {
+		info := cur[name]
+
+		prev, ok := old[name]
+
+		if !ok {
+			diff.Added = append(diff.Added, diffEntry(name, info))
+			continue
+		}
+
+		changed, err := d.changed(a, b, name, prev, info)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if changed {
+			diff.Changed = append(diff.Changed, diffEntry(name, info))
+		}
+	}
+	return diff, nil
+}
+
+func (d *differ) changed(a, b FS, name string, old, cur FileInfo) (bool, error) {
+	if old.Size() != cur.Size() {
+		return true, nil
+	}
+
+	if !d.hash {
+		return !old.ModTime().Equal(cur.ModTime()), nil
+	}
+
+	oldSum, err := hashFile(a, name)
+
+	if err != nil {
+		return false, err
+	}
+
+	curSum, err := hashFile(b, name)
+
+	if err != nil {
+		return false, err
+	}
+	return oldSum != curSum, nil
+}
@@ -0,0 +1,102 @@
+package fs
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_Diff(t *testing.T) {
+	a := tmpdir(t)
+	defer os.RemoveAll(a)
+
+	b := tmpdir(t)
+	defer os.RemoveAll(b)
+
+	modTime := time.Now().Add(-time.Hour)
+
+	write := func(dir, name, data string, modTime time.Time) {
+		path := filepath.Join(dir, name)
+
+		if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(a, "same", "same", modTime)
+	write(b, "same", "same", modTime)
+
+	write(a, "removed", "removed", modTime)
+	write(b, "dir/added", "added", modTime)
+
+	write(a, "resized", "old", modTime)
+	write(b, "resized", "newer", modTime)
+
+	// Same contents, but copied without the modification time.
+	write(a, "touched", "touched", modTime)
+	write(b, "touched", "touched", time.Now())
+
+	write(a, "edited", "aaaa", modTime)
+	write(b, "edited", "bbbb", modTime)
+
+	tests := []struct {
+		opts    []DiffOption
+		added   []string
+		removed []string
+		changed []string
+	}{
+		{nil, []string{"dir/added"}, []string{"removed"}, []string{"resized", "touched"}},
+		{[]DiffOption{DiffHash()}, []string{"dir/added"}, []string{"removed"}, []string{"edited", "resized"}},
+	}
+
+	names := func(ents []DiffEntry) string {
+		s := make([]string, 0, len(ents))
+
+		for _, e := range ents {
+			s = append(s, e.Name)
+		}
+		return strings.Join(s, ",")
+	}
+
+	for i, test := range tests {
+		diff, err := Diff(New(a), New(b), test.opts...)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if s := names(diff.Added); s != strings.Join(test.added, ",") {
+			t.Fatalf("tests[%d] - unexpected added, expected=%q, got=%q\n", i, strings.Join(test.added, ","), s)
+		}
+		if s := names(diff.Removed); s != strings.Join(test.removed, ",") {
+			t.Fatalf("tests[%d] - unexpected removed, expected=%q, got=%q\n", i, strings.Join(test.removed, ","), s)
+		}
+		if s := names(diff.Changed); s != strings.Join(test.changed, ",") {
+			t.Fatalf("tests[%d] - unexpected changed, expected=%q, got=%q\n", i, strings.Join(test.changed, ","), s)
+		}
+
+		if !strings.HasSuffix(diff.String(), "1 added, 1 removed, 2 changed\n") {
+			t.Fatalf("tests[%d] - unexpected summary, got=%q\n", i, diff.String())
+		}
+	}
+
+	diff, err := Diff(New(a), New(a))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !diff.Empty() {
+		t.Fatalf("unexpected diff, expected empty, got=%q\n", diff.String())
+	}
+}
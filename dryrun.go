@@ -0,0 +1,153 @@
+package fs
+
+import (
+	"path"
+	"strconv"
+)
+
+// Op is an operation that modifies a filesystem, as recorded by DryRun.
+type Op struct {
+	// Name is the name of the operation, one of put, remove, rename, link,
+	// or setmetadata.
+	Name string
+
+	// Path is the path of the file operated on, relative to the filesystem
+	// given to DryRun.
+	Path string
+
+	// NewPath is the new path of a renamed file, or of a link.
+	NewPath string
+
+	// Size is the size of a file that is put.
+	Size int64
+
+	// Metadata is the metadata being set.
+	Metadata Metadata
+}
+
+// String formats the operation as a single line.
+func (op Op) String() string {
+	switch op.Name {
+	case "put":
+		return op.Name + " " + op.Path + " (" + strconv.FormatInt(op.Size, 10) + " bytes)"
+	case "rename", "link":
+		return op.Name + " " + op.Path + " " + op.NewPath
+	}
+	return op.Name + " " + op.Path
+}
+
+type dryRunFS struct {
+	FS
+
+	dir string
+	log func(Op)
+}
+
+// DryRun returns a filesystem that passes reads through to the given
+// filesystem, but only records operations that would modify it by passing
+// them to log. This allows destructive scripts to be previewed. Put returns
+// the file it is given, and the other operations succeed without checking
+// whether they would. Sub does not call Sub on the underlying filesystem,
+// since that may create the directory.
+func DryRun(s FS, log func(Op)) FS {
+	ds := &dryRunFS{
+		FS:  s,
+		dir: ".",
+		log: log,
+	}
+
+	if canRename(s) {
+		return renameDryRunFS{dryRunFS: ds}
+	}
+	return ds
+}
+
+// renameDryRunFS is a dryRunFS over a filesystem that implements RenameFS.
+type renameDryRunFS struct {
+	*dryRunFS
+}
+
+func (s *dryRunFS) Unwrap() FS { return s.FS }
+
+func (s *dryRunFS) path(name string) string {
+	return path.Join(s.dir, name)
+}
+
+func (s *dryRunFS) Open(name string) (File, error) {
+	return s.FS.Open(s.path(name))
+}
+
+func (s *dryRunFS) Sub(dir string) (FS, error) {
+	ds := &dryRunFS{
+		FS:  s.FS,
+		dir: s.path(dir),
+		log: s.log,
+	}
+
+	if canRename(s.FS) {
+		return renameDryRunFS{dryRunFS: ds}, nil
+	}
+	return ds, nil
+}
+
+func (s *dryRunFS) Stat(name string) (FileInfo, error) {
+	return s.FS.Stat(s.path(name))
+}
+
+func (s *dryRunFS) Put(f File) (File, error) {
+	info, err := f.Stat()
+
+	if err != nil {
+		return nil, err
+	}
+
+	s.log(Op{
+		Name: "put",
+		Path: s.path(info.Name()),
+		Size: info.Size(),
+	})
+	return f, nil
+}
+
+func (s *dryRunFS) ReadDir(name string) ([]DirEntry, error) {
+	return ReadDir(s.FS, s.path(name))
+}
+
+func (s renameDryRunFS) Rename(oldname, newname string) error {
+	s.log(Op{
+		Name:    "rename",
+		Path:    s.path(oldname),
+		NewPath: s.path(newname),
+	})
+	return nil
+}
+
+func (s *dryRunFS) Link(oldname, newname string) error {
+	s.log(Op{
+		Name:    "link",
+		Path:    s.path(oldname),
+		NewPath: s.path(newname),
+	})
+	return nil
+}
+
+func (s *dryRunFS) Metadata(name string) (Metadata, error) {
+	return GetMetadata(s.FS, s.path(name))
+}
+
+func (s *dryRunFS) SetMetadata(name string, md Metadata) error {
+	s.log(Op{
+		Name:     "setmetadata",
+		Path:     s.path(name),
+		Metadata: md,
+	})
+	return nil
+}
+
+func (s *dryRunFS) Remove(name string) error {
+	s.log(Op{
+		Name: "remove",
+		Path: s.path(name),
+	})
+	return nil
+}
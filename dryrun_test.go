@@ -0,0 +1,77 @@
+package fs
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_DryRun(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	if err := os.WriteFile(filepath.Join(dir, "file"), []byte("data"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ops := make([]string, 0)
+
+	store := DryRun(New(dir), func(op Op) {
+		ops = append(ops, op.String())
+	})
+
+	if s := readAll(t, store, "file"); s != "data" {
+		t.Fatalf("unexpected content, expected=%q, got=%q\n", "data", s)
+	}
+
+	if err := store.Remove("file"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Move(store, "file", "renamed"); err != nil {
+		t.Fatal(err)
+	}
+
+	sub, err := store.Sub("dir")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := ReadFile("new", bytes.NewReader([]byte("new")))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := sub.Put(f); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"remove file",
+		"rename file renamed",
+		"put dir/new (3 bytes)",
+	}
+
+	if len(ops) != len(expected) {
+		t.Fatalf("unexpected ops, expected=%q, got=%q\n", expected, ops)
+	}
+
+	for i, op := range expected {
+		if ops[i] != op {
+			t.Fatalf("ops[%d] - unexpected op, expected=%q, got=%q\n", i, op, ops[i])
+		}
+	}
+
+	ents, err := os.ReadDir(dir)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ents) != 1 || ents[0].Name() != "file" {
+		t.Fatalf("unexpected files, expected only %q\n", "file")
+	}
+}
@@ -0,0 +1,24 @@
+package fs
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Durable configures the FS to flush each file put in it to stable storage,
+// along with the directory it is in, before Put returns. Likewise the
+// directory is flushed after a file is renamed. This ensures a file that has
+// been put survives a power failure, at the cost of slower writes.
+func Durable() Option {
+	return func(s *filesystem) {
+		s.durable = true
+	}
+}
+
+// sync flushes the given file and its parent directory to stable storage.
+func (s filesystem) sync(f *os.File) error {
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(f.Name()))
+}
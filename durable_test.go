@@ -0,0 +1,45 @@
+package fs
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+)
+
+func Test_Durable(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	store := New(dir, Durable())
+
+	buf := generateData(t, 4096)
+
+	f, err := ReadFile("file", bytes.NewReader(buf))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := store.Put(f)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := io.ReadAll(stored)
+
+	stored.Close()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(b, buf) {
+		t.Fatal("unexpected file content")
+	}
+
+	if err := Move(store, "file", "renamed"); err != nil {
+		t.Fatal(err)
+	}
+}
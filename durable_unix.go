@@ -0,0 +1,19 @@
+//go:build !windows
+
+package fs
+
+import "os"
+
+// syncDir flushes the given directory to stable storage, so that the entries
+// created in it are not lost.
+func syncDir(dir string) error {
+	f, err := os.Open(dir)
+
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	return f.Sync()
+}
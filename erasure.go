@@ -0,0 +1,728 @@
+package fs
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"path"
+	"sync"
+	"time"
+)
+
+// ErrTooFewShards is the error returned when a file stored via Erasure cannot
+// be read, because fewer than k of its shards are available.
+var ErrTooFewShards = errors.New("too few shards available")
+
+const (
+	shardMagic      = "FSEC\x00\x00\x00\x01"
+	shardHeaderSize = len(shardMagic) + 4 + 4 + 8 + 4
+
+	// erasureBlockSize is the size of the block each shard holds of each
+	// stripe of a file.
+	erasureBlockSize = 64 << 10
+)
+
+// shardHeader is the header at the start of each shard of a file.
+type shardHeader struct {
+	k, m      int
+	index     int
+	blockSize int
+	size      int64
+}
+
+func (h shardHeader) stripes() int64 {
+	stripe := int64(h.k * h.blockSize)
+	return (h.size + stripe - 1) / stripe
+}
+
+func (h shardHeader) shardSize() int64 {
+	return int64(shardHeaderSize) + h.stripes()*int64(h.blockSize+4)
+}
+
+func (h shardHeader) compatible(other shardHeader) bool {
+	return h.k == other.k && h.m == other.m && h.blockSize == other.blockSize && h.size == other.size
+}
+
+func (h shardHeader) encode() []byte {
+	b := make([]byte, shardHeaderSize)
+
+	n := copy(b, shardMagic)
+
+	b[n] = byte(h.k)
+	b[n+1] = byte(h.m)
+	b[n+2] = byte(h.index)
+	n += 4
+
+	binary.BigEndian.PutUint32(b[n:], uint32(h.blockSize))
+	n += 4
+
+	binary.BigEndian.PutUint64(b[n:], uint64(h.size))
+	n += 8
+
+	binary.BigEndian.PutUint32(b[n:], crc32.ChecksumIEEE(b[:n]))
+	return b
+}
+
+var errBadShard = errors.New("bad shard")
+
+func readShardHeader(r io.Reader) (shardHeader, error) {
+	var h shardHeader
+
+	b := make([]byte, shardHeaderSize)
+
+	if _, err := io.ReadFull(r, b); err != nil {
+		return h, err
+	}
+
+	if string(b[:len(shardMagic)]) != shardMagic {
+		return h, errBadShard
+	}
+
+	n := shardHeaderSize - 4
+
+	if crc32.ChecksumIEEE(b[:n]) != binary.BigEndian.Uint32(b[n:]) {
+		return h, errBadShard
+	}
+
+	n = len(shardMagic)
+
+	h.k = int(b[n])
+	h.m = int(b[n+1])
+	h.index = int(b[n+2])
+	h.blockSize = int(binary.BigEndian.Uint32(b[n+4:]))
+	h.size = int64(binary.BigEndian.Uint64(b[n+8:]))
+
+	if h.k == 0 || h.blockSize == 0 || h.size < 0 {
+		return h, errBadShard
+	}
+	return h, nil
+}
+
+type erasureFS struct {
+	k, m   int
+	stores []FS
+	coding gfMatrix
+	err    error
+}
+
+// Erasure returns a filesystem that Reed-Solomon encodes each file put in it
+// into k data shards and m parity shards, and stores one shard in each of the
+// given filesystems, of which there must be k+m. A file can be read as long
+// as any k of its shards can be, so up to m of the filesystems can be
+// unavailable, or hold corrupt shards, at a storage overhead of (k+m)/k.
+// Each block of each shard is checksummed, so corruption is detected and
+// repaired from the other shards as the file is read.
+//
+// Putting a file requires every filesystem to be available. If k is less
+// than one, m is less than zero, k+m is more than 255, or the number of
+// filesystems is not k+m, then every call returns ErrInvalid.
+func Erasure(k, m int, stores ...FS) FS {
+	s := &erasureFS{
+		k:      k,
+		m:      m,
+		stores: stores,
+	}
+
+	if k < 1 || m < 0 || k+m > 255 || len(stores) != k+m {
+		s.err = ErrInvalid
+		return s
+	}
+
+	s.coding = codingMatrix(k, m)
+	return s
+}
+
+// fileInfo is the FileInfo of a file that is not stored anywhere, such as a
+// shard being put, or a file read from its shards.
+type fileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+func (fi *fileInfo) Name() string       { return fi.name }
+func (fi *fileInfo) Size() int64        { return fi.size }
+func (fi *fileInfo) Mode() FileMode     { return 0644 }
+func (fi *fileInfo) ModTime() time.Time { return fi.modTime }
+func (fi *fileInfo) IsDir() bool        { return false }
+func (fi *fileInfo) Sys() any           { return nil }
+
+// shardWriter is a shard streamed to the Put of a filesystem via a pipe.
+type shardWriter struct {
+	*io.PipeReader
+
+	info *fileInfo
+}
+
+func (f *shardWriter) Stat() (FileInfo, error) { return f.info, nil }
+
+func (s *erasureFS) Unwrap() []FS { return s.stores }
+
+func (s *erasureFS) Open(name string) (File, error) {
+	if s.err != nil {
+		return nil, &PathError{Op: "open", Path: name, Err: s.err}
+	}
+
+	f := &erasureFile{
+		s:      s,
+		name:   name,
+		shards: make([]*shardReader, len(s.stores)),
+	}
+
+	// Open the data shards, falling back to the parity shards for any that
+	// are unavailable.
+	for i := 0; i < len(s.stores) && f.available() < s.k; i++ {
+		f.open(i)
+	}
+
+	if f.available() < s.k {
+		f.Close()
+
+		if f.missing == len(s.stores) {
+			return nil, &PathError{Op: "open", Path: name, Err: ErrNotExist}
+		}
+		return nil, &PathError{Op: "open", Path: name, Err: ErrTooFewShards}
+	}
+	return f, nil
+}
+
+func (s *erasureFS) Sub(dir string) (FS, error) {
+	if s.err != nil {
+		return nil, &PathError{Op: "sub", Path: dir, Err: s.err}
+	}
+
+	subs := make([]FS, len(s.stores))
+
+	for i, store := range s.stores {
+		sub, err := store.Sub(dir)
+
+		if err != nil {
+			return nil, err
+		}
+		subs[i] = sub
+	}
+	return Erasure(s.k, s.m, subs...), nil
+}
+
+// Stat returns the FileInfo of the file from the header of the first shard
+// that can be read.
+func (s *erasureFS) Stat(name string) (FileInfo, error) {
+	if s.err != nil {
+		return nil, &PathError{Op: "stat", Path: name, Err: s.err}
+	}
+
+	missing := 0
+
+	for _, store := range s.stores {
+		info, err := statShard(store, name)
+
+		if err == nil {
+			return info, nil
+		}
+
+		if errors.Is(err, ErrNotExist) {
+			missing++
+		}
+	}
+
+	if missing == len(s.stores) {
+		return nil, &PathError{Op: "stat", Path: name, Err: ErrNotExist}
+	}
+	return nil, &PathError{Op: "stat", Path: name, Err: ErrTooFewShards}
+}
+
+func statShard(store FS, name string) (FileInfo, error) {
+	f, err := store.Open(name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	info, err := f.Stat()
+
+	if err != nil {
+		return nil, err
+	}
+
+	h, err := readShardHeader(f)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &fileInfo{
+		name:    info.Name(),
+		size:    h.size,
+		modTime: info.ModTime(),
+	}, nil
+}
+
+// Put encodes the file into its shards as it is read, streaming each shard to
+// its filesystem concurrently. If any shard cannot be put then the shards that
+// were put are removed.
+func (s *erasureFS) Put(f File) (File, error) {
+	info, err := f.Stat()
+
+	if err != nil {
+		return nil, err
+	}
+
+	name := info.Name()
+
+	if s.err != nil {
+		return nil, &PathError{Op: "put", Path: name, Err: s.err}
+	}
+
+	n := len(s.stores)
+
+	writers := make([]*io.PipeWriter, n)
+	errs := make([]error, n)
+
+	shardSize := shardHeader{
+		k:         s.k,
+		blockSize: erasureBlockSize,
+		size:      info.Size(),
+	}.shardSize()
+
+	var wg sync.WaitGroup
+
+	for i, store := range s.stores {
+		pr, pw := io.Pipe()
+		writers[i] = pw
+
+		wg.Add(1)
+
+		go func(i int, store FS, pr *io.PipeReader) {
+			defer wg.Done()
+
+			stored, err := store.Put(&shardWriter{
+				PipeReader: pr,
+				info: &fileInfo{
+					name:    name,
+					size:    shardSize,
+					modTime: info.ModTime(),
+				},
+			})
+
+			if err == nil {
+				err = stored.Close()
+			}
+
+			errs[i] = err
+
+			// Unblock the encoder if the Put returned without reading
+			// everything.
+			pr.CloseWithError(err)
+		}(i, store, pr)
+	}
+
+	// Writes to a shard whose Put has failed are ignored, since the failure
+	// is returned by the Put.
+	for i, pw := range writers {
+		h := shardHeader{
+			k:         s.k,
+			m:         s.m,
+			index:     i,
+			blockSize: erasureBlockSize,
+			size:      info.Size(),
+		}
+		pw.Write(h.encode())
+	}
+
+	encErr := s.encode(f, info.Size(), writers)
+
+	for _, pw := range writers {
+		pw.CloseWithError(encErr)
+	}
+
+	wg.Wait()
+
+	err = encErr
+
+	for _, e := range errs {
+		if err == nil && e != nil {
+			err = e
+		}
+	}
+
+	if err != nil {
+		for _, store := range s.stores {
+			store.Remove(name)
+		}
+		return nil, &PathError{Op: "put", Path: name, Err: err}
+	}
+	return s.Open(name)
+}
+
+// encode reads the file a stripe at a time, and writes the data and parity
+// blocks of each stripe, with their checksums, to the writers of the shards.
+func (s *erasureFS) encode(r io.Reader, size int64, writers []*io.PipeWriter) error {
+	n := len(writers)
+	bs := erasureBlockSize
+
+	blocks := make([][]byte, n)
+
+	for i := range blocks {
+		blocks[i] = make([]byte, bs+4)
+	}
+
+	stripe := make([]byte, s.k*bs)
+
+	var read int64
+
+	for read < size {
+		want := int64(len(stripe))
+
+		if size-read < want {
+			want = size - read
+		}
+
+		if _, err := io.ReadFull(r, stripe[:want]); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+
+		read += want
+
+		// Pad the last stripe with zeros.
+		for i := want; i < int64(len(stripe)); i++ {
+			stripe[i] = 0
+		}
+
+		for i := 0; i < s.k; i++ {
+			copy(blocks[i], stripe[i*bs:(i+1)*bs])
+		}
+
+		for p := 0; p < s.m; p++ {
+			parity := blocks[s.k+p][:bs]
+
+			for i := range parity {
+				parity[i] = 0
+			}
+
+			for i := 0; i < s.k; i++ {
+				gfMulAdd(parity, blocks[i][:bs], s.coding[s.k+p][i])
+			}
+		}
+
+		for i, w := range writers {
+			binary.BigEndian.PutUint32(blocks[i][bs:], crc32.ChecksumIEEE(blocks[i][:bs]))
+			w.Write(blocks[i])
+		}
+	}
+	return nil
+}
+
+// ReadDir merges the listings of the directory in each filesystem. The size
+// of each file is read from the header of its shards when its Info is
+// requested.
+func (s *erasureFS) ReadDir(name string) ([]DirEntry, error) {
+	if s.err != nil {
+		return nil, &PathError{Op: "readdir", Path: name, Err: s.err}
+	}
+
+	lists := make([][]DirEntry, 0, len(s.stores))
+
+	var firstErr error
+
+	for _, store := range s.stores {
+		ents, err := ReadDir(store, name)
+
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		lists = append(lists, ents)
+	}
+
+	if len(lists) == 0 {
+		return nil, firstErr
+	}
+
+	ents := mergeEntries(lists...)
+
+	for i, ent := range ents {
+		if !ent.IsDir() {
+			ents[i] = &erasureDirEntry{
+				DirEntry: ent,
+				s:        s,
+				path:     path.Join(name, ent.Name()),
+			}
+		}
+	}
+	return ents, nil
+}
+
+type erasureDirEntry struct {
+	DirEntry
+
+	s    *erasureFS
+	path string
+}
+
+func (e *erasureDirEntry) Info() (FileInfo, error) {
+	return e.s.Stat(e.path)
+}
+
+// Remove removes the shards of the file from each filesystem. If none of the
+// filesystems have a shard of the file then ErrNotExist is returned.
+func (s *erasureFS) Remove(name string) error {
+	if s.err != nil {
+		return &PathError{Op: "remove", Path: name, Err: s.err}
+	}
+
+	var (
+		removed int
+		err     error
+	)
+
+	for _, store := range s.stores {
+		if rmerr := store.Remove(name); rmerr != nil {
+			if !errors.Is(rmerr, ErrNotExist) && err == nil {
+				err = rmerr
+			}
+			continue
+		}
+		removed++
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if removed == 0 {
+		return &PathError{Op: "remove", Path: name, Err: ErrNotExist}
+	}
+	return nil
+}
+
+// shardReader reads the blocks of a single shard.
+type shardReader struct {
+	f      File
+	stripe int64 // The stripe the next block read is from.
+}
+
+// erasureFile reads a file from its shards a stripe at a time, reconstructing
+// the data blocks of any shard that is unavailable from the parity blocks.
+type erasureFile struct {
+	s    *erasureFS
+	name string
+
+	hdr     shardHeader
+	modTime time.Time
+
+	shards  []*shardReader
+	tried   []bool
+	missing int // The number of shards that do not exist.
+
+	stripe int64
+	buf    []byte
+	off    int
+	read   int64
+}
+
+func (f *erasureFile) available() int {
+	n := 0
+
+	for _, sh := range f.shards {
+		if sh != nil {
+			n++
+		}
+	}
+	return n
+}
+
+// open opens the shard at the given index, if it has not been tried.
+func (f *erasureFile) open(i int) {
+	if f.tried == nil {
+		f.tried = make([]bool, len(f.shards))
+	}
+
+	if f.tried[i] {
+		return
+	}
+
+	f.tried[i] = true
+
+	sf, err := f.s.stores[i].Open(f.name)
+
+	if err != nil {
+		if errors.Is(err, ErrNotExist) {
+			f.missing++
+		}
+		return
+	}
+
+	h, err := readShardHeader(sf)
+
+	if err != nil || h.index != i {
+		sf.Close()
+		return
+	}
+
+	if f.hdr.k == 0 {
+		f.hdr = h
+
+		if info, err := sf.Stat(); err == nil {
+			f.modTime = info.ModTime()
+		}
+	} else if !f.hdr.compatible(h) {
+		sf.Close()
+		return
+	}
+
+	f.shards[i] = &shardReader{f: sf}
+}
+
+// drop closes the shard at the given index, so it is no longer read from.
+func (f *erasureFile) drop(i int) {
+	if sh := f.shards[i]; sh != nil {
+		sh.f.Close()
+		f.shards[i] = nil
+	}
+}
+
+// block reads the block of the shard at the given index for the given stripe.
+func (f *erasureFile) block(i int, stripe int64, dst []byte) bool {
+	f.open(i)
+
+	sh := f.shards[i]
+
+	if sh == nil {
+		return false
+	}
+
+	bs := int64(f.hdr.blockSize + 4)
+
+	if sh.stripe < stripe {
+		if _, err := io.CopyN(io.Discard, sh.f, (stripe-sh.stripe)*bs); err != nil {
+			f.drop(i)
+			return false
+		}
+		sh.stripe = stripe
+	}
+
+	if _, err := io.ReadFull(sh.f, dst); err != nil {
+		f.drop(i)
+		return false
+	}
+
+	sh.stripe++
+
+	n := f.hdr.blockSize
+
+	if crc32.ChecksumIEEE(dst[:n]) != binary.BigEndian.Uint32(dst[n:]) {
+		f.drop(i)
+		return false
+	}
+	return true
+}
+
+// next reads the next stripe into the buffer.
+func (f *erasureFile) next() error {
+	k := f.hdr.k
+	bs := f.hdr.blockSize
+
+	if f.buf == nil {
+		f.buf = make([]byte, k*bs)
+	}
+
+	rows := make([]int, 0, k)
+	blocks := make([][]byte, 0, k)
+
+	for i := 0; i < len(f.shards) && len(rows) < k; i++ {
+		b := make([]byte, bs+4)
+
+		if f.block(i, f.stripe, b) {
+			rows = append(rows, i)
+			blocks = append(blocks, b[:bs])
+		}
+	}
+
+	if len(rows) < k {
+		return ErrTooFewShards
+	}
+
+	f.stripe++
+
+	// The data blocks are all available, so there is nothing to decode.
+	if rows[k-1] == k-1 {
+		for i, b := range blocks {
+			copy(f.buf[i*bs:], b)
+		}
+		return nil
+	}
+
+	sub := make(gfMatrix, k)
+
+	for i, row := range rows {
+		sub[i] = f.s.coding[row]
+	}
+
+	inv, err := sub.invert()
+
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < k; i++ {
+		out := f.buf[i*bs : (i+1)*bs]
+
+		for j := range out {
+			out[j] = 0
+		}
+
+		for j, b := range blocks {
+			gfMulAdd(out, b, inv[i][j])
+		}
+	}
+	return nil
+}
+
+func (f *erasureFile) Read(p []byte) (int, error) {
+	if f.read >= f.hdr.size {
+		return 0, io.EOF
+	}
+
+	if f.buf == nil || f.off >= len(f.buf) {
+		if err := f.next(); err != nil {
+			return 0, &PathError{Op: "read", Path: f.name, Err: err}
+		}
+		f.off = 0
+	}
+
+	buf := f.buf[f.off:]
+
+	if remaining := f.hdr.size - f.read; int64(len(buf)) > remaining {
+		buf = buf[:remaining]
+	}
+
+	n := copy(p, buf)
+
+	f.off += n
+	f.read += int64(n)
+
+	return n, nil
+}
+
+func (f *erasureFile) Stat() (FileInfo, error) {
+	return &fileInfo{
+		name:    path.Base(f.name),
+		size:    f.hdr.size,
+		modTime: f.modTime,
+	}, nil
+}
+
+func (f *erasureFile) Close() error {
+	for i := range f.shards {
+		f.drop(i)
+	}
+	return nil
+}
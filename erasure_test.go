@@ -0,0 +1,164 @@
+package fs
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_GFMatrixInvert(t *testing.T) {
+	k, m := 4, 3
+
+	coding := codingMatrix(k, m)
+
+	// Every choice of k rows of the coding matrix should be invertible.
+	for mask := 0; mask < 1<<(k+m); mask++ {
+		rows := make(gfMatrix, 0, k)
+
+		for i := 0; i < k+m; i++ {
+			if mask&(1<<i) != 0 {
+				rows = append(rows, coding[i])
+			}
+		}
+
+		if len(rows) != k {
+			continue
+		}
+
+		inv, err := rows.invert()
+
+		if err != nil {
+			t.Fatalf("rows %b - unexpected error, expected=%v, got=%v\n", mask, nil, err)
+		}
+
+		for i := 0; i < k; i++ {
+			for j := 0; j < k; j++ {
+				var sum byte
+
+				for n := 0; n < k; n++ {
+					sum ^= gfMul(rows[i][n], inv[n][j])
+				}
+
+				var want byte
+
+				if i == j {
+					want = 1
+				}
+
+				if sum != want {
+					t.Fatalf("rows %b - unexpected product[%d][%d], expected=%d, got=%d\n", mask, i, j, want, sum)
+				}
+			}
+		}
+	}
+}
+
+func Test_Erasure(t *testing.T) {
+	k, m := 3, 2
+
+	dirs := make([]string, k+m)
+	stores := make([]FS, k+m)
+
+	for i := range dirs {
+		dirs[i] = tmpdir(t)
+		defer os.RemoveAll(dirs[i])
+
+		stores[i] = New(dirs[i])
+	}
+
+	store := Erasure(k, m, stores...)
+
+	tests := []struct {
+		size    int
+		damaged []int
+		corrupt bool
+		err     error
+	}{
+		{0, nil, false, nil},
+		{100, nil, false, nil},
+		{1 << 20, nil, false, nil},
+		{1 << 20, []int{0}, false, nil},
+		{1 << 20, []int{1, 4}, false, nil},
+		{1 << 20, []int{0, 2}, true, nil},
+		{1<<20 + 7, []int{3, 4}, false, nil},
+		{1 << 20, []int{0, 1, 2}, false, ErrTooFewShards},
+	}
+
+	for i, test := range tests {
+		buf := generateData(t, test.size)
+
+		f, err := ReadFile("file", bytes.NewReader(buf))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		stored, err := store.Put(f)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+		stored.Close()
+
+		info, err := store.Stat("file")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if info.Size() != int64(test.size) {
+			t.Fatalf("tests[%d] - unexpected size, expected=%d, got=%d\n", i, test.size, info.Size())
+		}
+
+		for _, j := range test.damaged {
+			shard := filepath.Join(dirs[j], "file")
+
+			if !test.corrupt {
+				if err := os.Remove(shard); err != nil {
+					t.Fatal(err)
+				}
+				continue
+			}
+
+			b, err := os.ReadFile(shard)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Corrupt a block in the middle of the shard, past the header.
+			b[len(b)/2] ^= 0xff
+
+			if err := os.WriteFile(shard, b, 0600); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if test.err != nil {
+			_, err := store.Open("file")
+
+			if !errors.Is(err, test.err) {
+				t.Fatalf("tests[%d] - unexpected error, expected=%v, got=%v\n", i, test.err, err)
+			}
+			continue
+		}
+
+		if s := readAll(t, store, "file"); s != string(buf) {
+			t.Fatalf("tests[%d] - unexpected content, expected=%d bytes, got=%d bytes\n", i, len(buf), len(s))
+		}
+	}
+
+	if err := store.Remove("file"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.Stat("file"); !errors.Is(err, ErrNotExist) {
+		t.Fatalf("unexpected error, expected=%v, got=%v\n", ErrNotExist, err)
+	}
+
+	if _, err := Erasure(2, 1, stores...).Open("file"); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("unexpected error, expected=%v, got=%v\n", ErrInvalid, err)
+	}
+}
@@ -0,0 +1,215 @@
+package fs
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"io"
+	"path"
+	"strings"
+)
+
+// Format is the format of an archive that can be unpacked via Extract.
+type Format uint
+
+const (
+	Tar     Format = iota + 1 // tar archive
+	TarGzip                   // gzip compressed tar archive
+	Zip                       // zip archive
+)
+
+func (f Format) String() string {
+	switch f {
+	case Tar:
+		return "tar"
+	case TarGzip:
+		return "tar.gz"
+	case Zip:
+		return "zip"
+	default:
+		return "unknown"
+	}
+}
+
+// cleanPath cleans the given archive entry name and checks that it does not
+// escape the root it will be extracted to. Names that are absolute, or that
+// traverse above the root via "..", return ErrInvalid.
+func cleanPath(name string) (string, error) {
+	name = strings.ReplaceAll(name, "\\", "/")
+
+	if path.IsAbs(name) {
+		return "", ErrInvalid
+	}
+
+	name = path.Clean(name)
+
+	if !ValidPath(name) {
+		return "", ErrInvalid
+	}
+	return name, nil
+}
+
+// PutPath puts the given file into the filesystem at the given path. The
+// directory of the path is created via Sub, and the file is stored under the
+// base name of the path.
+func PutPath(s FS, name string, f File) (File, error) {
+	dir, base := path.Split(name)
+
+	if dir != "" {
+		sub, err := s.Sub(path.Clean(dir))
+
+		if err != nil {
+			return nil, err
+		}
+		s = sub
+	}
+	return s.Put(Rename(f, base))
+}
+
+func extractEntry(s FS, name string, r io.Reader) error {
+	f, err := ReadFile(path.Base(name), r)
+
+	if err != nil {
+		return &PathError{Op: "extract", Path: name, Err: err}
+	}
+
+	defer Cleanup(f)
+
+	stored, err := PutPath(s, name, f)
+
+	if err != nil {
+		return err
+	}
+	return stored.Close()
+}
+
+func extractTar(s FS, r io.Reader) error {
+	tr := tar.NewReader(r)
+
+	for {
+		hdr, err := tr.Next()
+
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return err
+		}
+
+		name, err := cleanPath(hdr.Name)
+
+		if err != nil {
+			return &PathError{Op: "extract", Path: hdr.Name, Err: err}
+		}
+
+		if name == "." {
+			continue
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if _, err := s.Sub(name); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := extractEntry(s, name, tr); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func extractZip(s FS, r io.Reader) error {
+	f, err := ReadFile("extract.zip", r)
+
+	if err != nil {
+		return err
+	}
+
+	defer Cleanup(f)
+
+	info, err := f.Stat()
+
+	if err != nil {
+		return err
+	}
+
+	// A reader that is already an *os.File is returned as is by ReadFile,
+	// wrapped to give it its new name.
+	ra, ok := unwrapFile(f).(io.ReaderAt)
+
+	if !ok {
+		return &PathError{Op: "extract", Path: info.Name(), Err: ErrInvalid}
+	}
+
+	zr, err := zip.NewReader(ra, info.Size())
+
+	if err != nil {
+		return err
+	}
+
+	for _, zf := range zr.File {
+		name, err := cleanPath(zf.Name)
+
+		if err != nil {
+			return &PathError{Op: "extract", Path: zf.Name, Err: err}
+		}
+
+		if name == "." {
+			continue
+		}
+
+		if zf.FileInfo().IsDir() {
+			if _, err := s.Sub(name); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if !zf.Mode().IsRegular() {
+			continue
+		}
+
+		rc, err := zf.Open()
+
+		if err != nil {
+			return err
+		}
+
+		err = extractEntry(s, name, rc)
+		rc.Close()
+
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Extract unpacks the archive read from the given reader into the given
+// filesystem. Directories in the archive are created via Sub. Only regular
+// files and directories are extracted, other entries such as symlinks are
+// skipped. If an entry name is absolute, or would be extracted outside of the
+// filesystem, then ErrInvalid is returned in the *PathError.
+func Extract(s FS, r io.Reader, format Format) error {
+	switch format {
+	case Tar:
+		return extractTar(s, r)
+	case TarGzip:
+		gz, err := gzip.NewReader(r)
+
+		if err != nil {
+			return err
+		}
+
+		defer gz.Close()
+
+		return extractTar(s, gz)
+	case Zip:
+		return extractZip(s, r)
+	default:
+		return &PathError{Op: "extract", Path: format.String(), Err: ErrInvalid}
+	}
+}
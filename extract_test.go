@@ -0,0 +1,182 @@
+package fs
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var archiveFiles = map[string]string{
+	"readme.txt":       "hello world",
+	"dir/file.txt":     "file in dir",
+	"dir/sub/deep.txt": "deep file",
+}
+
+func tarArchive(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+
+	tw := tar.NewWriter(&buf)
+
+	for name, content := range files {
+		hdr := &tar.Header{
+			Name:     name,
+			Mode:     0600,
+			Size:     int64(len(content)),
+			Typeflag: tar.TypeReg,
+		}
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(tw, content); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func zipArchive(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+
+	zw := zip.NewWriter(&buf)
+
+	for name, content := range files {
+		w, err := zw.Create(name)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(w, content); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func Test_Extract(t *testing.T) {
+	var gzbuf bytes.Buffer
+
+	gz := gzip.NewWriter(&gzbuf)
+	gz.Write(tarArchive(t, archiveFiles))
+	gz.Close()
+
+	tests := []struct {
+		format Format
+		data   []byte
+	}{
+		{Tar, tarArchive(t, archiveFiles)},
+		{TarGzip, gzbuf.Bytes()},
+		{Zip, zipArchive(t, archiveFiles)},
+	}
+
+	for i, test := range tests {
+		func(i int) {
+			dir := tmpdir(t)
+			defer os.RemoveAll(dir)
+
+			if err := Extract(New(dir), bytes.NewReader(test.data), test.format); err != nil {
+				t.Fatalf("tests[%d] - %s\n", i, err)
+			}
+
+			for name, expected := range archiveFiles {
+				b, err := os.ReadFile(filepath.Join(dir, name))
+
+				if err != nil {
+					t.Fatalf("tests[%d] - %s\n", i, err)
+				}
+
+				if string(b) != expected {
+					t.Fatalf("tests[%d] - unexpected content, expected=%q, got=%q\n", i, expected, string(b))
+				}
+			}
+		}(i)
+	}
+}
+
+func Test_ExtractZipFile(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	archive := filepath.Join(dir, "archive.zip")
+
+	if err := os.WriteFile(archive, zipArchive(t, archiveFiles), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(archive)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	out := filepath.Join(dir, "out")
+
+	if err := os.Mkdir(out, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Extract(New(out), f, Zip); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, expected := range archiveFiles {
+		b, err := os.ReadFile(filepath.Join(out, name))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(b) != expected {
+			t.Fatalf("unexpected content, expected=%q, got=%q\n", expected, string(b))
+		}
+	}
+}
+
+func Test_ExtractZipSlip(t *testing.T) {
+	names := [...]string{
+		"../evil.txt",
+		"dir/../../evil.txt",
+		"/etc/evil.txt",
+	}
+
+	for i, name := range names {
+		func(i int, name string) {
+			dir := tmpdir(t)
+			defer os.RemoveAll(dir)
+
+			files := map[string]string{name: "evil"}
+
+			tests := []struct {
+				format Format
+				data   []byte
+			}{
+				{Tar, tarArchive(t, files)},
+				{Zip, zipArchive(t, files)},
+			}
+
+			for _, test := range tests {
+				err := Extract(New(dir), bytes.NewReader(test.data), test.format)
+
+				if !errors.Is(err, ErrInvalid) {
+					t.Fatalf("names[%d] - unexpected error, expected=%q, got=%v\n", i, ErrInvalid, err)
+				}
+			}
+		}(i, name)
+	}
+}
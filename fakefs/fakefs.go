@@ -0,0 +1,620 @@
+// Package fakefs provides an in-memory FS for testing. The modification times
+// of files come from an injected clock, the contents can be seeded from a
+// map, and errors can be injected for any operation, so that time dependent
+// and error handling logic can be tested deterministically.
+package fakefs
+
+import (
+	"io"
+	iofs "io/fs"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andrewpillar/fs"
+)
+
+// ManualClock is a clock that only moves when it is told to.
+type ManualClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+// NewManualClock returns a clock set to the given time.
+func NewManualClock(t time.Time) *ManualClock {
+	return &ManualClock{t: t}
+}
+
+// Now returns the current time of the clock.
+func (c *ManualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.t
+}
+
+// Advance moves the clock forward by the given duration.
+func (c *ManualClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.t = c.t.Add(d)
+}
+
+// Set sets the clock to the given time.
+func (c *ManualClock) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.t = t
+}
+
+type entry struct {
+	data    []byte
+	modTime time.Time
+	dir     bool
+	meta    fs.Metadata
+}
+
+type failure struct {
+	op   string
+	name string
+}
+
+type store struct {
+	mu       sync.Mutex
+	now      func() time.Time
+	entries  map[string]*entry
+	failures map[failure]error
+}
+
+// Option configures the FS returned from New.
+type Option func(*store)
+
+// WithClock sets the function used to get the modification time of files that
+// are put in the FS. By default this is time.Now.
+func WithClock(now func() time.Time) Option {
+	return func(st *store) {
+		st.now = now
+	}
+}
+
+// Seed seeds the FS with the given files. The keys of the map are the paths
+// of the files, any parent directories are created.
+func Seed(files map[string][]byte) Option {
+	return func(st *store) {
+		for name, data := range files {
+			name = path.Clean(name)
+
+			st.mkdirAll(path.Dir(name))
+			st.entries[name] = &entry{
+				data:    data,
+				modTime: st.now(),
+			}
+		}
+	}
+}
+
+// Fail configures the FS to return the given error for the operation on the
+// named file. See FS.Fail.
+func Fail(op, name string, err error) Option {
+	return func(st *store) {
+		key := failure{op: op}
+
+		if name != "" {
+			key.name = path.Clean(name)
+		}
+		st.failures[key] = err
+	}
+}
+
+// FS is an in-memory filesystem. The FS returned from Sub shares the same
+// underlying files.
+type FS struct {
+	st  *store
+	dir string
+}
+
+var (
+	_ fs.ReadDirFS  = (*FS)(nil)
+	_ fs.RenameFS   = (*FS)(nil)
+	_ fs.LinkFS     = (*FS)(nil)
+	_ fs.MetadataFS = (*FS)(nil)
+)
+
+// New returns a new empty FS configured with the given options.
+func New(opts ...Option) *FS {
+	st := &store{
+		now: time.Now,
+		entries: map[string]*entry{
+			".": {dir: true},
+		},
+		failures: make(map[failure]error),
+	}
+
+	for _, opt := range opts {
+		opt(st)
+	}
+
+	return &FS{
+		st:  st,
+		dir: ".",
+	}
+}
+
+func (st *store) mkdirAll(dir string) {
+	for dir != "." && dir != "/" {
+		if _, ok := st.entries[dir]; !ok {
+			st.entries[dir] = &entry{
+				dir:     true,
+				modTime: st.now(),
+			}
+		}
+		dir = path.Dir(dir)
+	}
+}
+
+func (st *store) fail(op, name string) error {
+	if err, ok := st.failures[failure{op: op, name: name}]; ok {
+		return err
+	}
+	if err, ok := st.failures[failure{op: op}]; ok {
+		return err
+	}
+	return nil
+}
+
+func (s *FS) path(name string) string {
+	return path.Join(s.dir, name)
+}
+
+// Fail configures the FS to return the given error, wrapped in a
+// *fs.PathError, for the given operation on the named file. The operation is
+// one of "open", "sub", "stat", "put", "readdir", "rename", "link", "remove",
+// "metadata", or "setmetadata". The
+// name is relative to the FS returned from New, if the name is empty then
+// the error is returned for every file. Passing a nil error clears the
+// failure.
+func (s *FS) Fail(op, name string, err error) {
+	s.st.mu.Lock()
+	defer s.st.mu.Unlock()
+
+	key := failure{op: op}
+
+	if name != "" {
+		key.name = s.path(name)
+	}
+
+	if err == nil {
+		delete(s.st.failures, key)
+		return
+	}
+	s.st.failures[key] = err
+}
+
+func (s *FS) Open(name string) (fs.File, error) {
+	s.st.mu.Lock()
+	defer s.st.mu.Unlock()
+
+	p := s.path(name)
+
+	if err := s.st.fail("open", p); err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	e, ok := s.st.entries[p]
+
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return newFile(p, e), nil
+}
+
+func (s *FS) Sub(dir string) (fs.FS, error) {
+	s.st.mu.Lock()
+	defer s.st.mu.Unlock()
+
+	p := s.path(dir)
+
+	if err := s.st.fail("sub", p); err != nil {
+		return nil, &fs.PathError{Op: "sub", Path: dir, Err: err}
+	}
+
+	if e, ok := s.st.entries[p]; ok && !e.dir {
+		return nil, &fs.PathError{Op: "sub", Path: dir, Err: fs.ErrExist}
+	}
+
+	s.st.mkdirAll(p)
+
+	return &FS{
+		st:  s.st,
+		dir: p,
+	}, nil
+}
+
+func (s *FS) Stat(name string) (fs.FileInfo, error) {
+	s.st.mu.Lock()
+	defer s.st.mu.Unlock()
+
+	p := s.path(name)
+
+	if err := s.st.fail("stat", p); err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+
+	e, ok := s.st.entries[p]
+
+	if !ok {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	return &fileInfo{name: path.Base(p), entry: e}, nil
+}
+
+func (s *FS) Put(f fs.File) (fs.File, error) {
+	info, err := f.Stat()
+
+	if err != nil {
+		return nil, err
+	}
+
+	name := info.Name()
+	p := s.path(name)
+
+	s.st.mu.Lock()
+	err = s.st.fail("put", p)
+	s.st.mu.Unlock()
+
+	if err != nil {
+		return nil, &fs.PathError{Op: "put", Path: name, Err: err}
+	}
+
+	data, err := io.ReadAll(f)
+
+	if err != nil {
+		return nil, &fs.PathError{Op: "put", Path: name, Err: err}
+	}
+
+	s.st.mu.Lock()
+	defer s.st.mu.Unlock()
+
+	if parent, ok := s.st.entries[path.Dir(p)]; !ok || !parent.dir {
+		return nil, &fs.PathError{Op: "put", Path: name, Err: fs.ErrNotExist}
+	}
+
+	old, ok := s.st.entries[p]
+
+	if ok && old.dir {
+		return nil, &fs.PathError{Op: "put", Path: name, Err: fs.ErrExist}
+	}
+
+	e := &entry{
+		data:    data,
+		modTime: s.st.now(),
+	}
+
+	// Overwriting a file keeps its metadata, as with extended attributes on
+	// the operating system's filesystem.
+	if ok {
+		e.meta = old.meta
+	}
+
+	s.st.entries[p] = e
+
+	return newFile(p, e), nil
+}
+
+func (s *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	s.st.mu.Lock()
+	defer s.st.mu.Unlock()
+
+	p := s.path(name)
+
+	if err := s.st.fail("readdir", p); err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+
+	e, ok := s.st.entries[p]
+
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+
+	if !e.dir {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	return s.st.readDir(p), nil
+}
+
+func (st *store) readDir(dir string) []fs.DirEntry {
+	ents := make([]fs.DirEntry, 0)
+
+	for p, e := range st.entries {
+		if p == "." || path.Dir(p) != dir {
+			continue
+		}
+		ents = append(ents, &fileInfo{name: path.Base(p), entry: e})
+	}
+
+	sort.Slice(ents, func(i, j int) bool {
+		return ents[i].Name() < ents[j].Name()
+	})
+	return ents
+}
+
+func (s *FS) Rename(oldname, newname string) error {
+	s.st.mu.Lock()
+	defer s.st.mu.Unlock()
+
+	oldp := s.path(oldname)
+	newp := s.path(newname)
+
+	if err := s.st.fail("rename", oldp); err != nil {
+		return &fs.PathError{Op: "rename", Path: oldname, Err: err}
+	}
+
+	e, ok := s.st.entries[oldp]
+
+	if !ok {
+		return &fs.PathError{Op: "rename", Path: oldname, Err: fs.ErrNotExist}
+	}
+
+	if e.dir {
+		return &fs.PathError{Op: "rename", Path: oldname, Err: fs.ErrInvalid}
+	}
+
+	if parent, ok := s.st.entries[path.Dir(newp)]; !ok || !parent.dir {
+		return &fs.PathError{Op: "rename", Path: newname, Err: fs.ErrNotExist}
+	}
+
+	delete(s.st.entries, oldp)
+	s.st.entries[newp] = e
+
+	return nil
+}
+
+// Link makes newname share the entry of oldname. Since Put replaces entries
+// rather than writing to them, putting either name does not affect the other.
+func (s *FS) Link(oldname, newname string) error {
+	s.st.mu.Lock()
+	defer s.st.mu.Unlock()
+
+	oldp := s.path(oldname)
+	newp := s.path(newname)
+
+	if err := s.st.fail("link", oldp); err != nil {
+		return &fs.PathError{Op: "link", Path: oldname, Err: err}
+	}
+
+	e, ok := s.st.entries[oldp]
+
+	if !ok {
+		return &fs.PathError{Op: "link", Path: oldname, Err: fs.ErrNotExist}
+	}
+
+	if e.dir {
+		return &fs.PathError{Op: "link", Path: oldname, Err: fs.ErrInvalid}
+	}
+
+	if _, ok := s.st.entries[newp]; ok {
+		return &fs.PathError{Op: "link", Path: newname, Err: fs.ErrExist}
+	}
+
+	if parent, ok := s.st.entries[path.Dir(newp)]; !ok || !parent.dir {
+		return &fs.PathError{Op: "link", Path: newname, Err: fs.ErrNotExist}
+	}
+
+	s.st.entries[newp] = e
+	return nil
+}
+
+func (s *FS) Remove(name string) error {
+	s.st.mu.Lock()
+	defer s.st.mu.Unlock()
+
+	p := s.path(name)
+
+	if err := s.st.fail("remove", p); err != nil {
+		return &fs.PathError{Op: "remove", Path: name, Err: err}
+	}
+
+	e, ok := s.st.entries[p]
+
+	if !ok || p == "." {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+
+	if e.dir && len(s.st.readDir(p)) > 0 {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrExist}
+	}
+
+	delete(s.st.entries, p)
+	return nil
+}
+
+func (s *FS) Metadata(name string) (fs.Metadata, error) {
+	s.st.mu.Lock()
+	defer s.st.mu.Unlock()
+
+	p := s.path(name)
+
+	if err := s.st.fail("metadata", p); err != nil {
+		return nil, &fs.PathError{Op: "metadata", Path: name, Err: err}
+	}
+
+	e, ok := s.st.entries[p]
+
+	if !ok {
+		return nil, &fs.PathError{Op: "metadata", Path: name, Err: fs.ErrNotExist}
+	}
+
+	md := make(fs.Metadata, len(e.meta))
+
+	for k, v := range e.meta {
+		md[k] = v
+	}
+	return md, nil
+}
+
+func (s *FS) SetMetadata(name string, md fs.Metadata) error {
+	s.st.mu.Lock()
+	defer s.st.mu.Unlock()
+
+	p := s.path(name)
+
+	if err := s.st.fail("setmetadata", p); err != nil {
+		return &fs.PathError{Op: "setmetadata", Path: name, Err: err}
+	}
+
+	e, ok := s.st.entries[p]
+
+	if !ok {
+		return &fs.PathError{Op: "setmetadata", Path: name, Err: fs.ErrNotExist}
+	}
+
+	if e.meta == nil {
+		e.meta = make(fs.Metadata)
+	}
+
+	for k, v := range md {
+		if v == "" {
+			delete(e.meta, k)
+			continue
+		}
+		e.meta[k] = v
+	}
+	return nil
+}
+
+// Files returns the paths of every file in the FS, relative to the FS
+// returned from New, in sorted order.
+func (s *FS) Files() []string {
+	s.st.mu.Lock()
+	defer s.st.mu.Unlock()
+
+	names := make([]string, 0, len(s.st.entries))
+
+	prefix := s.dir + "/"
+
+	for p, e := range s.st.entries {
+		if e.dir {
+			continue
+		}
+
+		if s.dir == "." || strings.HasPrefix(p, prefix) {
+			names = append(names, p)
+		}
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+type fileInfo struct {
+	name  string
+	entry *entry
+}
+
+func (fi *fileInfo) Name() string { return fi.name }
+func (fi *fileInfo) Size() int64  { return int64(len(fi.entry.data)) }
+
+func (fi *fileInfo) Mode() fs.FileMode {
+	if fi.entry.dir {
+		return iofs.ModeDir | 0750
+	}
+	return fs.FileMode(0640)
+}
+
+func (fi *fileInfo) ModTime() time.Time         { return fi.entry.modTime }
+func (fi *fileInfo) IsDir() bool                { return fi.entry.dir }
+func (fi *fileInfo) Sys() any                   { return nil }
+func (fi *fileInfo) Type() fs.FileMode          { return fi.Mode().Type() }
+func (fi *fileInfo) Info() (fs.FileInfo, error) { return fi, nil }
+func (fi *fileInfo) String() string             { return fi.name }
+
+// file is an open file in the FS. The data of an entry is never modified in
+// place, only replaced, so an open file is unaffected by subsequent puts.
+type file struct {
+	*fileInfo
+
+	path   string
+	off    int64
+	closed bool
+}
+
+func newFile(p string, e *entry) *file {
+	return &file{
+		fileInfo: &fileInfo{
+			name:  path.Base(p),
+			entry: e,
+		},
+		path: p,
+	}
+}
+
+func (f *file) Stat() (fs.FileInfo, error) { return f.fileInfo, nil }
+
+func (f *file) Read(p []byte) (int, error) {
+	if f.closed {
+		return 0, &fs.PathError{Op: "read", Path: f.path, Err: fs.ErrClosed}
+	}
+	if f.entry.dir {
+		return 0, &fs.PathError{Op: "read", Path: f.path, Err: fs.ErrInvalid}
+	}
+	if f.off >= int64(len(f.entry.data)) {
+		return 0, io.EOF
+	}
+
+	n := copy(p, f.entry.data[f.off:])
+	f.off += int64(n)
+
+	return n, nil
+}
+
+func (f *file) ReadAt(p []byte, off int64) (int, error) {
+	if f.closed {
+		return 0, &fs.PathError{Op: "read", Path: f.path, Err: fs.ErrClosed}
+	}
+	if off < 0 {
+		return 0, &fs.PathError{Op: "read", Path: f.path, Err: fs.ErrInvalid}
+	}
+	if off >= int64(len(f.entry.data)) {
+		return 0, io.EOF
+	}
+
+	n := copy(p, f.entry.data[off:])
+
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (f *file) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.off
+	case io.SeekEnd:
+		offset += int64(len(f.entry.data))
+	default:
+		return 0, &fs.PathError{Op: "seek", Path: f.path, Err: fs.ErrInvalid}
+	}
+
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "seek", Path: f.path, Err: fs.ErrInvalid}
+	}
+
+	f.off = offset
+	return offset, nil
+}
+
+func (f *file) Close() error {
+	if f.closed {
+		return &fs.PathError{Op: "close", Path: f.path, Err: fs.ErrClosed}
+	}
+
+	f.closed = true
+	return nil
+}
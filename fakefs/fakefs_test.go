@@ -0,0 +1,157 @@
+package fakefs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/andrewpillar/fs"
+)
+
+func Test_Clock(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewManualClock(start)
+
+	store := New(WithClock(clock.Now))
+
+	clock.Advance(time.Hour)
+
+	f, err := fs.ReadFile("file", bytes.NewReader([]byte("data")))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.Put(f); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := store.Stat("file")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := start.Add(time.Hour); !info.ModTime().Equal(expected) {
+		t.Fatalf("unexpected mod time, expected=%s, got=%s\n", expected, info.ModTime())
+	}
+}
+
+func Test_Seed(t *testing.T) {
+	store := New(Seed(map[string][]byte{
+		"a":         []byte("a"),
+		"dir/b":     []byte("b"),
+		"dir/sub/c": []byte("c"),
+	}))
+
+	expected := []string{"a", "dir/b", "dir/sub/c"}
+
+	if files := store.Files(); !reflect.DeepEqual(expected, files) {
+		t.Fatalf("unexpected files, expected=%v, got=%v\n", expected, files)
+	}
+
+	sub, err := store.Sub("dir")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := sub.Open("sub/c")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := io.ReadAll(f)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(b) != "c" {
+		t.Fatalf("unexpected content, expected=%q, got=%q\n", "c", string(b))
+	}
+
+	walked := make([]string, 0)
+
+	err = fs.Walk(store, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			walked = append(walked, name)
+		}
+		return nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(expected, walked) {
+		t.Fatalf("unexpected walk, expected=%v, got=%v\n", expected, walked)
+	}
+}
+
+func Test_Fail(t *testing.T) {
+	errBoom := errors.New("boom")
+
+	store := New(Seed(map[string][]byte{"dir/file": nil}), Fail("open", "dir/file", errBoom))
+
+	if _, err := store.Open("dir/file"); !errors.Is(err, errBoom) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", errBoom, err)
+	}
+
+	sub, err := store.Sub("dir")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := sub.Open("file"); !errors.Is(err, errBoom) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", errBoom, err)
+	}
+
+	store.Fail("open", "dir/file", nil)
+
+	if _, err := sub.Open("file"); err != nil {
+		t.Fatal(err)
+	}
+
+	store.Fail("remove", "", fs.ErrPermission)
+
+	if err := sub.Remove("file"); !errors.Is(err, fs.ErrPermission) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", fs.ErrPermission, err)
+	}
+}
+
+func Test_Metadata(t *testing.T) {
+	store := New(Seed(map[string][]byte{
+		"file": []byte("data"),
+	}))
+
+	if err := fs.SetMetadata(store, "file", fs.Metadata{"content-type": "text/plain", "origin": "test"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := fs.SetMetadata(store, "file", fs.Metadata{"origin": ""}); err != nil {
+		t.Fatal(err)
+	}
+
+	md, err := fs.GetMetadata(store, "file")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(md) != 1 || md["content-type"] != "text/plain" {
+		t.Fatalf("unexpected metadata, expected=%v, got=%v\n", fs.Metadata{"content-type": "text/plain"}, md)
+	}
+
+	if _, err := fs.GetMetadata(store, "missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", fs.ErrNotExist, err)
+	}
+}
@@ -0,0 +1,97 @@
+package fs
+
+import (
+	"io"
+	"sync"
+)
+
+// minFetchPart is the smallest range Fetch will split a file into.
+const minFetchPart = 1 << 20
+
+// offsetWriter writes to the underlying io.WriterAt starting from the given
+// offset.
+type offsetWriter struct {
+	w   io.WriterAt
+	off int64
+}
+
+func (w *offsetWriter) Write(p []byte) (int, error) {
+	n, err := w.w.WriteAt(p, w.off)
+	w.off += int64(n)
+
+	return n, err
+}
+
+// Fetch reads the named file from the filesystem into the given writer. If
+// the opened file implements io.ReaderAt, then the file is split into ranges
+// which are read concurrently using at most the given parallelism. Otherwise,
+// the file is read sequentially. This returns the number of bytes written.
+func Fetch(s FS, name string, w io.WriterAt, parallelism int) (int64, error) {
+	f, err := s.Open(name)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer f.Close()
+
+	info, err := f.Stat()
+
+	if err != nil {
+		return 0, err
+	}
+
+	size := info.Size()
+
+	ra, ok := f.(io.ReaderAt)
+
+	if !ok || parallelism < 2 || size <= minFetchPart {
+		return copyBuffer(&offsetWriter{w: w}, f)
+	}
+
+	part := (size + int64(parallelism) - 1) / int64(parallelism)
+
+	if part < minFetchPart {
+		part = minFetchPart
+	}
+
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		total int64
+		ferr  error
+	)
+
+	for off := int64(0); off < size; off += part {
+		n := part
+
+		if off+n > size {
+			n = size - off
+		}
+
+		wg.Add(1)
+
+		go func(off, n int64) {
+			defer wg.Done()
+
+			written, err := copyBuffer(&offsetWriter{w: w, off: off}, io.NewSectionReader(ra, off, n))
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			total += written
+
+			if err == nil && written != n {
+				err = io.ErrUnexpectedEOF
+			}
+
+			if err != nil && ferr == nil {
+				ferr = &PathError{Op: "fetch", Path: name, Err: err}
+			}
+		}(off, n)
+	}
+
+	wg.Wait()
+
+	return total, ferr
+}
@@ -0,0 +1,51 @@
+package fs
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_Fetch(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	buf := generateData(t, 10<<20+123)
+
+	if err := os.WriteFile(filepath.Join(dir, "file"), buf, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, parallelism := range [...]int{1, 4, 16} {
+		func(i, parallelism int) {
+			dst, err := os.Create(filepath.Join(dir, "dst"))
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			defer dst.Close()
+
+			n, err := Fetch(New(dir), "file", dst, parallelism)
+
+			if err != nil {
+				t.Fatalf("tests[%d] - %s\n", i, err)
+			}
+
+			if n != int64(len(buf)) {
+				t.Fatalf("tests[%d] - unexpected bytes written, expected=%d, got=%d\n", i, len(buf), n)
+			}
+
+			b, err := os.ReadFile(dst.Name())
+
+			if err != nil {
+				t.Fatalf("tests[%d] - %s\n", i, err)
+			}
+
+			if !bytes.Equal(b, buf) {
+				t.Fatalf("tests[%d] - unexpected file content\n", i)
+			}
+		}(i, parallelism)
+	}
+}
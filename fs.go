@@ -1,7 +1,7 @@
 package fs
 
 import (
-	"bytes"
+	"crypto/rand"
 	"encoding/hex"
 	"errors"
 	"hash"
@@ -9,8 +9,6 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
-	"regexp"
-	"strconv"
 	"time"
 )
 
@@ -27,6 +25,10 @@ var (
 	ErrExist      = fs.ErrExist
 	ErrNotExist   = fs.ErrNotExist
 	ErrClosed     = fs.ErrClosed
+
+	// ErrUnsupported is returned when an optional operation is not supported
+	// by a filesystem.
+	ErrUnsupported = errors.New("operation not supported")
 )
 
 // FS provides access to a hierarchical filesystem.
@@ -57,12 +59,17 @@ type file struct {
 	name    string
 	off     int64
 	data    []byte
+	pool    *pooledBuffer
+	closed  bool
 	modTime time.Time
 }
 
 func (f *file) Stat() (FileInfo, error) { return f, nil }
 
 func (f *file) Read(p []byte) (int, error) {
+	if f.closed {
+		return 0, &PathError{Op: "read", Path: f.name, Err: ErrClosed}
+	}
 	if f.off < 0 {
 		return 0, &PathError{Op: "read", Path: f.name, Err: ErrInvalid}
 	}
@@ -76,7 +83,91 @@ func (f *file) Read(p []byte) (int, error) {
 	return n, nil
 }
 
-func (f *file) Close() error       { return nil }
+func (f *file) ReadAt(p []byte, off int64) (int, error) {
+	if f.closed {
+		return 0, &PathError{Op: "read", Path: f.name, Err: ErrClosed}
+	}
+	if off < 0 {
+		return 0, &PathError{Op: "read", Path: f.name, Err: ErrInvalid}
+	}
+	if off >= int64(len(f.data)) {
+		return 0, io.EOF
+	}
+
+	n := copy(p, f.data[off:])
+
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (f *file) WriteTo(w io.Writer) (int64, error) {
+	if f.closed {
+		return 0, &PathError{Op: "read", Path: f.name, Err: ErrClosed}
+	}
+	if f.off < 0 {
+		return 0, &PathError{Op: "read", Path: f.name, Err: ErrInvalid}
+	}
+	if f.off >= int64(len(f.data)) {
+		return 0, nil
+	}
+
+	n, err := w.Write(f.data[f.off:])
+	f.off += int64(n)
+
+	return int64(n), err
+}
+
+// release closes the file and releases its hold on the buffer backing it, if
+// the file was created via ReadFileMax. The buffer is returned to the pool
+// once nothing else reads from it.
+func (f *file) release() {
+	if f.pool == nil {
+		return
+	}
+
+	f.closed = true
+	f.data = nil
+
+	f.pool.release()
+	f.pool = nil
+}
+
+// share returns a copy of the file that reads from the same buffer, but can
+// be read and released independently of it, along with the function to
+// release it. Files not backed by a pooled buffer are returned as is.
+func share(f File) (File, func()) {
+	v, ok := unwrapFile(f).(*file)
+
+	if !ok || v.pool == nil {
+		return f, func() {}
+	}
+
+	v.pool.retain()
+
+	cp := &file{
+		name:    v.name,
+		off:     v.off,
+		data:    v.data,
+		pool:    v.pool,
+		modTime: v.modTime,
+	}
+
+	if v == f {
+		return cp, cp.release
+	}
+
+	info, err := f.Stat()
+
+	if err != nil {
+		return cp, cp.release
+	}
+	return Rename(cp, info.Name()), cp.release
+}
+
+func (f *file) Close() error { return nil }
+
 func (f *file) Name() string       { return f.name }
 func (f *file) Size() int64        { return int64(len(f.data)) }
 func (f *file) Mode() FileMode     { return FileMode(0400) }
@@ -130,17 +221,32 @@ func ReadFileMax(name string, r io.Reader, maxMemory int64) (File, error) {
 		return Rename(f, name), nil
 	}
 
-	var buf bytes.Buffer
+	if maxMemory < 0 {
+		maxMemory = 0
+	}
+
+	// Read one byte more than maxMemory to know whether it was exceeded, taking
+	// care not to overflow.
+	limit := maxMemory + 1
 
-	n, err := io.CopyN(&buf, r, maxMemory+1)
+	if limit < 0 {
+		limit = maxMemory
+	}
+
+	buf := getBuffer()
+
+	n, err := io.CopyN(buf, r, limit)
 
 	if err != nil {
 		if !errors.Is(err, io.EOF) {
+			putBuffer(buf)
 			return nil, err
 		}
 	}
 
 	if n > maxMemory {
+		defer putBuffer(buf)
+
 		dir, err := os.MkdirTemp("", "fs-file-*")
 
 		if err != nil {
@@ -150,22 +256,30 @@ func ReadFileMax(name string, r io.Reader, maxMemory int64) (File, error) {
 		f, err := os.Create(filepath.Join(dir, name))
 
 		if err != nil {
+			os.RemoveAll(dir)
 			return nil, err
 		}
 
-		if _, err := io.Copy(f, io.MultiReader(&buf, r)); err != nil {
+		if _, err := copyBuffer(f, io.MultiReader(buf, r)); err != nil {
+			f.Close()
+			os.RemoveAll(dir)
 			return nil, err
 		}
 
 		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			f.Close()
+			os.RemoveAll(dir)
 			return nil, err
 		}
+
+		spooled.add(dir)
 		return f, nil
 	}
 
 	return &file{
 		name:    name,
 		data:    buf.Bytes(),
+		pool:    newPooledBuffer(buf),
 		modTime: time.Now(),
 	}, nil
 }
@@ -176,16 +290,22 @@ func ReadFile(name string, r io.Reader) (File, error) {
 	return ReadFileMax(name, r, 32<<20)
 }
 
-var reTmpDir = regexp.MustCompile(filepath.Join(os.TempDir(), "fs-file-(.+)"))
-
-// Cleanup deletes the given file if it exists on disk and is stored in the
-// temporary directory. This would typically be deferred after a prior call to
-// ReadFile.
+// Cleanup deletes the given file if it was spooled to disk by ReadFileMax. If
+// the file is held in memory by ReadFileMax then the memory is released for
+// reuse, and the file can no longer be read. Other files are left as they
+// are. This would typically be deferred after a prior call to ReadFile.
 func Cleanup(f File) error {
+	f = unwrapFile(f)
+
+	if f, ok := f.(*file); ok {
+		f.release()
+		return nil
+	}
+
 	if f, ok := f.(*os.File); ok {
 		dir := filepath.Dir(f.Name())
 
-		if reTmpDir.Match([]byte(dir)) {
+		if spooled.remove(dir) {
 			if err := os.RemoveAll(dir); err != nil {
 				return err
 			}
@@ -195,23 +315,74 @@ func Cleanup(f File) error {
 }
 
 type filesystem struct {
-	dir string
+	dir         string
+	mmap        bool
+	dirPerm     FileMode
+	filePerm    FileMode
+	ignoreUmask bool
+	chown       bool
+	uid         int
+	gid         int
+	durable     bool
+	strict      bool
 }
 
+// Option configures the FS returned from New.
+type Option func(*filesystem)
+
 // New returns a new FS for the operating system's filesystem.
-func New(dir string) FS {
-	return filesystem{
-		dir: dir,
+func New(dir string, opts ...Option) FS {
+	s := filesystem{
+		dir:      dir,
+		dirPerm:  FileMode(0750),
+		filePerm: FileMode(0666),
+	}
+
+	for _, opt := range opts {
+		opt(&s)
 	}
+	return s
+}
+
+// NewMkdir returns a new FS for the operating system's filesystem, creating
+// the given directory, and any missing parents, with the given permissions if
+// it does not exist. An error is returned if the directory cannot be created.
+// The permissions only apply to the directories created here, directories
+// created via Sub are configured via DirPerm.
+func NewMkdir(dir string, perm FileMode, opts ...Option) (FS, error) {
+	s := New(dir, opts...).(filesystem)
+
+	root := s
+	root.dirPerm = perm.Perm()
+
+	if err := root.mkdirAll(dir); err != nil {
+		return nil, &PathError{Op: "mkdir", Path: dir, Err: errors.Unwrap(err)}
+	}
+	return s, nil
 }
 
+// path returns the path of the given name on the operating system's
+// filesystem.
 func (s filesystem) path(name string) string {
-	return filepath.Join(s.dir, name)
+	return osPath(filepath.Join(s.dir, name))
 }
 
 func (s filesystem) Open(name string) (File, error) {
+	if err := s.check(name); err != nil {
+		return nil, &PathError{Op: "open", Path: name, Err: err}
+	}
+
 	name = s.path(name)
 
+	if s.mmap {
+		f, err := openMmap(name)
+
+		if err != nil {
+			return nil, &PathError{Op: "open", Path: name, Err: errors.Unwrap(err)}
+		}
+		return f, nil
+	}
+
 	f, err := os.Open(name)
 
 	if err != nil {
@@ -221,15 +392,28 @@ func (s filesystem) Open(name string) (File, error) {
 }
 
 func (s filesystem) Sub(dir string) (FS, error) {
-	subdir := s.path(dir)
+	if err := s.check(dir); err != nil {
+		return nil, &PathError{Op: "sub", Path: dir, Err: err}
+	}
 
-	if err := os.MkdirAll(subdir, FileMode(0750)); err != nil {
+	if s.strict {
+		if err := isDir(s.path(dir)); err != nil {
+			return nil, &PathError{Op: "sub", Path: dir, Err: err}
+		}
+	} else if err := s.mkdirAll(s.path(dir)); err != nil {
 		return nil, &PathError{Op: "sub", Path: dir, Err: errors.Unwrap(err)}
 	}
-	return New(subdir), nil
+	sub := s
+	sub.dir = filepath.Join(s.dir, dir)
+
+	return sub, nil
 }
 
 func (s filesystem) Stat(name string) (FileInfo, error) {
+	if err := s.check(name); err != nil {
+		return nil, &PathError{Op: "stat", Path: name, Err: err}
+	}
+
 	info, err := os.Stat(s.path(name))
 
 	if err != nil {
@@ -247,37 +431,134 @@ func (s filesystem) Put(f File) (File, error) {
 
 	name := info.Name()
 
-	dst, err := os.Create(s.path(name))
+	if err := s.check(name); err != nil {
+		return nil, &PathError{Op: "put", Path: name, Err: err}
+	}
+
+	// The file is written to a temporary file alongside the named file,
+	// which is then renamed to it. This means readers never see a partially
+	// written file, and a file hard linked to the named file is left as it
+	// is, since the link is replaced rather than written through.
+	dir := filepath.Dir(s.path(name))
+
+	tmp, err := tmpName("." + filepath.Base(name) + ".put-")
+
+	if err != nil {
+		return nil, &PathError{Op: "put", Path: name, Err: err}
+	}
+
+	tmp = filepath.Join(dir, tmp)
+
+	dst, err := s.create(tmp)
 
 	if err != nil {
 		return nil, &PathError{Op: "put", Path: name, Err: errors.Unwrap(err)}
 	}
 
-	if _, err := io.Copy(dst, f); err != nil {
+	if _, err := copyFile(dst, f); err != nil {
+		dst.Close()
+		os.Remove(tmp)
+		return nil, &PathError{Op: "put", Path: name, Err: errors.Unwrap(err)}
+	}
+
+	if s.durable {
+		if err := s.sync(dst); err != nil {
+			dst.Close()
+			os.Remove(tmp)
+			return nil, &PathError{Op: "put", Path: name, Err: errors.Unwrap(err)}
+		}
+	}
+
+	if err := dst.Close(); err != nil {
+		os.Remove(tmp)
 		return nil, &PathError{Op: "put", Path: name, Err: errors.Unwrap(err)}
 	}
 
-	if _, err := dst.Seek(0, io.SeekStart); err != nil {
+	if err := os.Rename(tmp, s.path(name)); err != nil {
+		os.Remove(tmp)
 		return nil, &PathError{Op: "put", Path: name, Err: errors.Unwrap(err)}
 	}
-	return dst, nil
+
+	if s.durable {
+		if err := syncDir(dir); err != nil {
+			return nil, &PathError{Op: "put", Path: name, Err: errors.Unwrap(err)}
+		}
+	}
+	return s.Open(name)
+}
+
+func (s filesystem) ReadDir(name string) ([]DirEntry, error) {
+	if err := s.check(name); err != nil {
+		return nil, &PathError{Op: "readdir", Path: name, Err: err}
+	}
+
+	ents, err := os.ReadDir(s.path(name))
+
+	if err != nil {
+		return nil, &PathError{Op: "readdir", Path: name, Err: errors.Unwrap(err)}
+	}
+	return hideDir(ents, claimDir), nil
+}
+
+func (s filesystem) Rename(oldname, newname string) error {
+	if err := s.check(oldname, newname); err != nil {
+		return &PathError{Op: "rename", Path: oldname, Err: err}
+	}
+
+	if err := os.Rename(s.path(oldname), s.path(newname)); err != nil {
+		return &PathError{Op: "rename", Path: oldname, Err: errors.Unwrap(err)}
+	}
+
+	if s.durable {
+		if err := syncDir(filepath.Dir(s.path(newname))); err != nil {
+			return &PathError{Op: "rename", Path: oldname, Err: errors.Unwrap(err)}
+		}
+	}
+	return nil
 }
 
 func (s filesystem) Remove(name string) error {
+	if err := s.check(name); err != nil {
+		return &PathError{Op: "remove", Path: name, Err: err}
+	}
+
 	if err := os.Remove(s.path(name)); err != nil {
 		return &PathError{Op: "remove", Path: name, Err: errors.Unwrap(err)}
 	}
 	return nil
 }
 
-type nullFS struct{}
+type nullFS struct {
+	size  int64
+	seed  int64
+	drain bool
+	fail  map[string]error
+	calls *NullCalls
+}
 
-// Null returns a store that returns empty files. Useful for testing.
-func Null() FS {
-	return nullFS{}
+// Null returns a store that returns empty files. Useful for testing. The
+// store can be configured to return files with content, to fail operations,
+// and to count calls via the given options.
+func Null(opts ...NullOption) FS {
+	s := nullFS{
+		fail: make(map[string]error),
+	}
+
+	for _, opt := range opts {
+		opt(&s)
+	}
+	return s
 }
 
 func (s nullFS) Open(name string) (File, error) {
+	if err := s.call("open", name); err != nil {
+		return nil, err
+	}
+
+	if s.size > 0 {
+		return newNullFile(name, s.size, s.seed), nil
+	}
+
 	return &file{
 		name:    name,
 		modTime: time.Now(),
@@ -285,10 +566,21 @@ func (s nullFS) Open(name string) (File, error) {
 }
 
 func (s nullFS) Sub(dir string) (FS, error) {
+	if err := s.call("sub", dir); err != nil {
+		return nil, err
+	}
 	return s, nil
 }
 
 func (s nullFS) Stat(name string) (FileInfo, error) {
+	if err := s.call("stat", name); err != nil {
+		return nil, err
+	}
+
+	if s.size > 0 {
+		return newNullFile(name, s.size, s.seed), nil
+	}
+
 	return &file{
 		name:    name,
 		modTime: time.Now(),
@@ -302,36 +594,84 @@ func (s nullFS) Put(f File) (File, error) {
 		return nil, err
 	}
 
+	if err := s.call("put", info.Name()); err != nil {
+		return nil, err
+	}
+
+	if s.drain {
+		if _, err := copyBuffer(io.Discard, f); err != nil {
+			return nil, &PathError{Op: "put", Path: info.Name(), Err: err}
+		}
+	}
+
 	return &file{
 		name:    info.Name(),
 		modTime: info.ModTime(),
 	}, nil
 }
 
-func (nullFS) Remove(string) error { return nil }
+func (s nullFS) ReadDir(name string) ([]DirEntry, error) {
+	if err := s.call("readdir", name); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func (s nullFS) Rename(oldname, _ string) error {
+	return s.call("rename", oldname)
+}
+
+func (s nullFS) Remove(name string) error {
+	return s.call("remove", name)
+}
 
 type uniqueFS struct {
 	FS
+
+	policy CollisionPolicy
 }
 
 // Unique returns a filesystem that will error with ErrExist when multiple files
 // with the same name are stored in it.
 func Unique(s FS) FS {
-	return uniqueFS{
-		FS: s,
+	return UniquePolicy(s, CollisionError)
+}
+
+// UniquePolicy returns a filesystem that handles multiple files with the same
+// name being stored in it according to the given policy.
+func UniquePolicy(s FS, policy CollisionPolicy) FS {
+	us := uniqueFS{
+		FS:     s,
+		policy: policy,
 	}
+
+	if _, ok := s.(RenameFS); ok {
+		return renameUniqueFS{uniqueFS: us}
+	}
+	return us
 }
 
+// renameUniqueFS is a uniqueFS over a filesystem that implements RenameFS.
+type renameUniqueFS struct {
+	uniqueFS
+}
+
+func (s uniqueFS) Unwrap() FS { return s.FS }
+
 func (s uniqueFS) Sub(dir string) (FS, error) {
 	fs, err := s.FS.Sub(dir)
 
 	if err != nil {
 		return nil, err
 	}
-	return Unique(fs), nil
+	return UniquePolicy(fs, s.policy), nil
 }
 
 func (s uniqueFS) Put(f File) (File, error) {
+	if s.policy == CollisionOverwrite {
+		return s.FS.Put(f)
+	}
+
 	info, err := f.Stat()
 
 	if err != nil {
@@ -347,34 +687,154 @@ func (s uniqueFS) Put(f File) (File, error) {
 	if err != nil {
 		return nil, err
 	}
+
+	if s.policy == CollisionSuffix {
+		return s.putSuffix(f, info.Name())
+	}
 	return nil, ErrExist
 }
 
+func (s uniqueFS) ReadDir(name string) ([]DirEntry, error) {
+	return ReadDir(s.FS, name)
+}
+
+// Rename renames the file, erroring with ErrExist if the new name already
+// exists, unless the policy is CollisionOverwrite.
+func (s renameUniqueFS) Rename(oldname, newname string) error {
+	if s.policy == CollisionOverwrite {
+		return Move(s.FS, oldname, newname)
+	}
+
+	_, err := s.Stat(newname)
+
+	if errors.Is(err, ErrNotExist) {
+		return Move(s.FS, oldname, newname)
+	}
+
+	if err != nil {
+		return err
+	}
+	return &PathError{Op: "rename", Path: oldname, Err: ErrExist}
+}
+
+func (s uniqueFS) Metadata(name string) (Metadata, error) {
+	return GetMetadata(s.FS, name)
+}
+
+func (s uniqueFS) SetMetadata(name string, md Metadata) error {
+	return SetMetadata(s.FS, name, md)
+}
+
 type hashFS struct {
 	FS
 
-	mech func() hash.Hash
+	mech     func() hash.Hash
+	encode   func([]byte) string
+	truncate int
+	prefix   string
+	linkDir  string
 }
 
 // Hash returns a filesystem that stores each file put in it against the hashed
 // contents of the file with the given hashing mechanism. The file returned will
-// be renamed to the content hash.
-func Hash(s FS, mech func() hash.Hash) FS {
-	return &hashFS{
-		FS:   s,
-		mech: mech,
+// be renamed to the content hash. By default the hash is hex encoded, this can
+// be configured via the given options.
+func Hash(s FS, mech func() hash.Hash, opts ...HashOption) FS {
+	h := &hashFS{
+		FS:     s,
+		mech:   mech,
+		encode: hex.EncodeToString,
+	}
+
+	for _, opt := range opts {
+		opt(h)
 	}
+	return h.wrap()
+}
+
+// renameHashFS is a hashFS over a filesystem that implements RenameFS.
+type renameHashFS struct {
+	*hashFS
 }
 
+// wrap returns the hashFS as a renameHashFS if the filesystem it wraps
+// implements RenameFS.
+func (s *hashFS) wrap() FS {
+	if canRename(s.FS) {
+		return renameHashFS{hashFS: s}
+	}
+	return s
+}
+
+func (s *hashFS) Unwrap() FS { return s.FS }
+
 func (s *hashFS) Sub(dir string) (FS, error) {
 	fs, err := s.FS.Sub(dir)
 
 	if err != nil {
 		return nil, err
 	}
-	return Hash(fs, s.mech), nil
+
+	sub := *s
+	sub.FS = fs
+
+	return sub.wrap(), nil
+}
+
+// name returns the name to store a file under for the given hash sum.
+func (s *hashFS) name(sum []byte) string {
+	name := s.encode(sum)
+
+	if s.truncate > 0 && len(name) > s.truncate {
+		name = name[:s.truncate]
+	}
+	return s.prefix + name
+}
+
+// hashReader hashes the contents of the underlying file as it is read.
+type hashReader struct {
+	File
+
+	r io.Reader
+}
+
+func (r *hashReader) Read(p []byte) (int, error) {
+	return r.r.Read(p)
+}
+
+func tmpName(prefix string) (string, error) {
+	b := make([]byte, 8)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return prefix + hex.EncodeToString(b), nil
+}
+
+// spool reads the entire file so its hash is known before it is put in the
+// underlying filesystem. This is used when the underlying filesystem cannot
+// rename files.
+func (s *hashFS) spool(f File, name string) (File, error) {
+	h := s.mech()
+
+	tmp, err := ReadFile("hash.Put", io.TeeReader(f, h))
+
+	if err != nil {
+		return nil, &PathError{Op: "put", Path: name, Err: errors.Unwrap(err)}
+	}
+
+	defer Cleanup(tmp)
+
+	hash := s.name(h.Sum(nil))
+
+	return s.FS.Put(Rename(tmp, hash))
 }
 
+// Put streams the file into the underlying filesystem under a temporary name
+// whilst hashing it, and then renames it to the content hash. If the
+// underlying filesystem does not implement RenameFS then the file is first
+// read in full via ReadFile to determine the hash. The temporary name is
+// removed if anything fails after it is put.
 func (s *hashFS) Put(f File) (File, error) {
 	info, err := f.Stat()
 
@@ -383,45 +843,143 @@ func (s *hashFS) Put(f File) (File, error) {
 	}
 
 	name := info.Name()
+
+	if s.linkDir != "" {
+		return s.putLink(f, name)
+	}
+
+	if _, ok := s.FS.(RenameFS); !ok {
+		return s.spool(f, name)
+	}
+
+	tmp, err := tmpName(".hash-")
+
+	if err != nil {
+		return nil, &PathError{Op: "put", Path: name, Err: err}
+	}
+
 	h := s.mech()
+	r := io.TeeReader(f, h)
 
-	tmp, err := ReadFile("hash.Put", io.TeeReader(f, h))
+	stored, err := s.FS.Put(Rename(&hashReader{File: f, r: r}, tmp))
 
 	if err != nil {
-		return nil, &PathError{Op: "put", Path: name, Err: errors.Unwrap(err)}
+		s.FS.Remove(tmp)
+		return nil, err
 	}
 
-	defer Cleanup(tmp)
+	// The underlying filesystem may not read the whole file, such as Null,
+	// so whatever is left is read so the hash is of the whole file.
+	if _, err := copyBuffer(io.Discard, r); err != nil {
+		stored.Close()
+		s.FS.Remove(tmp)
+		return nil, &PathError{Op: "put", Path: name, Err: err}
+	}
 
-	hash := hex.EncodeToString(h.Sum(nil))
+	hash := s.name(h.Sum(nil))
 
-	return s.FS.Put(Rename(tmp, hash))
+	if err := Move(s.FS, tmp, hash); err != nil {
+		stored.Close()
+
+		// A wrapper may implement RenameFS over a filesystem that cannot
+		// rename, in which case the file is put again under its hash.
+		if errors.Is(err, ErrUnsupported) {
+			return s.putAgain(f, info.Size(), tmp, hash)
+		}
+
+		s.FS.Remove(tmp)
+		return nil, err
+	}
+	return Rename(stored, hash), nil
 }
 
-type limit struct {
+// putAgain puts the file again under its hash, and removes the temporary name
+// it was first put under. The file is read again from the start if it can be,
+// otherwise it is read back from the temporary name.
+func (s *hashFS) putAgain(f File, size int64, tmp, hash string) (File, error) {
+	defer s.FS.Remove(tmp)
+
+	if ra, ok := f.(io.ReaderAt); ok {
+		return s.FS.Put(Rename(&hashReader{File: f, r: io.NewSectionReader(ra, 0, size)}, hash))
+	}
+
+	stored, err := s.FS.Open(tmp)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer stored.Close()
+
+	return s.FS.Put(Rename(stored, hash))
+}
+
+func (s *hashFS) ReadDir(name string) ([]DirEntry, error) {
+	return ReadDir(s.FS, name)
+}
+
+func (s renameHashFS) Rename(oldname, newname string) error {
+	return Move(s.FS, oldname, newname)
+}
+
+func (s *hashFS) Metadata(name string) (Metadata, error) {
+	return GetMetadata(s.FS, name)
+}
+
+func (s *hashFS) SetMetadata(name string, md Metadata) error {
+	return SetMetadata(s.FS, name, md)
+}
+
+type limitFS struct {
 	FS
 
 	limit int64
 }
 
+// limit is a limitFS over a filesystem that implements RenameFS, so the limit
+// only implements RenameFS itself when the underlying filesystem does.
+type limit struct {
+	limitFS
+}
+
+// SizeError is the error returned when a file exceeds a size limit. Size is
+// the limit that was exceeded, and Name and FileSize are the name and size of
+// the file that exceeded it.
 type SizeError struct {
-	Size int64
+	Size     int64
+	Name     string
+	FileSize int64
 }
 
-func humanSize(n int64) string {
-	units := [...]string{"B", "KB", "MB", "GB", "TB", "PB"}
-	i := 0
+func (e SizeError) Error() string {
+	size := HumanSize(e.Size)
 
-	for ; n >= 1024; i++ {
-		n /= 1024
+	if e.FileSize > 0 {
+		return "file too large, " + HumanSize(e.FileSize) + " exceeds the " + size + " limit"
 	}
-	return strconv.Itoa(int(n)) + " " + units[i]
+	return "file too large, cannot exceed " + size
 }
 
-func (e SizeError) Error() string {
-	size := humanSize(e.Size)
+// Is reports whether the target is a SizeError whose non-zero fields match
+// those of the error. This allows for errors.Is(err, SizeError{}) to match any
+// SizeError, and errors.Is(err, SizeError{Size: n}) to match a specific limit.
+func (e SizeError) Is(target error) bool {
+	t, ok := target.(SizeError)
 
-	return "file too large, cannot exceed " + size
+	if !ok {
+		return false
+	}
+
+	if t.Size != 0 && t.Size != e.Size {
+		return false
+	}
+	if t.Name != "" && t.Name != e.Name {
+		return false
+	}
+	if t.FileSize != 0 && t.FileSize != e.FileSize {
+		return false
+	}
+	return true
 }
 
 // Limit returns a filesystem that limits the size of files put in it to the
@@ -429,20 +987,27 @@ func (e SizeError) Error() string {
 // limit is changed to the new one. If any file that is put in the filesystem
 // exceeds the limit, then SizeError is returned in the *PathError.
 func Limit(s FS, n int64) FS {
-	if l, ok := s.(limit); ok {
-		return limit{
-			FS:    l.FS,
-			limit: n,
-		}
+	switch l := s.(type) {
+	case limit:
+		s = l.FS
+	case limitFS:
+		s = l.FS
 	}
 
-	return limit{
+	ls := limitFS{
 		FS:    s,
 		limit: n,
 	}
+
+	if _, ok := s.(RenameFS); ok {
+		return limit{limitFS: ls}
+	}
+	return ls
 }
 
-func (s limit) Sub(dir string) (FS, error) {
+func (s limitFS) Unwrap() FS { return s.FS }
+
+func (s limitFS) Sub(dir string) (FS, error) {
 	fs, err := s.FS.Sub(dir)
 
 	if err != nil {
@@ -451,7 +1016,7 @@ func (s limit) Sub(dir string) (FS, error) {
 	return Limit(fs, s.limit), nil
 }
 
-func (s limit) Put(f File) (File, error) {
+func (s limitFS) Put(f File) (File, error) {
 	info, err := f.Stat()
 
 	if err != nil {
@@ -462,19 +1027,40 @@ func (s limit) Put(f File) (File, error) {
 		return nil, &PathError{
 			Op:   "put",
 			Path: info.Name(),
-			Err:  SizeError{Size: s.limit},
+			Err: SizeError{
+				Size:     s.limit,
+				Name:     info.Name(),
+				FileSize: info.Size(),
+			},
 		}
 	}
 	return s.FS.Put(f)
 }
 
+func (s limitFS) ReadDir(name string) ([]DirEntry, error) {
+	return ReadDir(s.FS, name)
+}
+
+func (s limit) Rename(oldname, newname string) error {
+	return Move(s.FS, oldname, newname)
+}
+
+func (s limitFS) Metadata(name string) (Metadata, error) {
+	return GetMetadata(s.FS, name)
+}
+
+func (s limitFS) SetMetadata(name string, md Metadata) error {
+	return SetMetadata(s.FS, name, md)
+}
+
 type writeOnly struct {
 	FS
 }
 
 // WriteOnly returns a filesystem that can only have files put in it. Any
 // attempt to read a file via Open or Stat, or to modify a file via Remove
-// will return ErrPermission in the *PathError.
+// will return ErrPermission in the *PathError. The returned filesystem does
+// not implement RenameFS.
 func WriteOnly(s FS) FS {
 	return writeOnly{
 		FS: s,
@@ -485,6 +1071,8 @@ func (s writeOnly) Open(name string) (File, error) {
 	return nil, &PathError{Op: "open", Path: name, Err: ErrPermission}
 }
 
+func (s writeOnly) Unwrap() FS { return s.FS }
+
 func (s writeOnly) Sub(dir string) (FS, error) {
 	sub, err := s.FS.Sub(dir)
 
@@ -498,6 +1086,10 @@ func (s writeOnly) Stat(name string) (FileInfo, error) {
 	return nil, &PathError{Op: "stat", Path: name, Err: ErrPermission}
 }
 
+func (s writeOnly) ReadDir(name string) ([]DirEntry, error) {
+	return nil, &PathError{Op: "readdir", Path: name, Err: ErrPermission}
+}
+
 func (s writeOnly) Remove(name string) error {
 	return &PathError{Op: "remove", Path: name, Err: ErrPermission}
 }
@@ -510,11 +1102,23 @@ type readOnly struct {
 // attempt to write a file via Put or modify a file via Remove will return
 // ErrPermission in the *PathError.
 func ReadOnly(s FS) FS {
-	return readOnly{
+	ro := readOnly{
 		FS: s,
 	}
+
+	if _, ok := s.(RenameFS); ok {
+		return renameReadOnly{readOnly: ro}
+	}
+	return ro
+}
+
+// renameReadOnly is a readOnly over a filesystem that implements RenameFS.
+type renameReadOnly struct {
+	readOnly
 }
 
+func (s readOnly) Unwrap() FS { return s.FS }
+
 func (s readOnly) Sub(dir string) (FS, error) {
 	fs, err := s.FS.Sub(dir)
 
@@ -533,6 +1137,22 @@ func (s readOnly) Put(f File) (File, error) {
 	return nil, &PathError{Op: "put", Path: info.Name(), Err: ErrPermission}
 }
 
+func (s readOnly) ReadDir(name string) ([]DirEntry, error) {
+	return ReadDir(s.FS, name)
+}
+
+func (s renameReadOnly) Rename(oldname, _ string) error {
+	return &PathError{Op: "rename", Path: oldname, Err: ErrPermission}
+}
+
+func (s readOnly) Metadata(name string) (Metadata, error) {
+	return GetMetadata(s.FS, name)
+}
+
+func (s readOnly) SetMetadata(name string, _ Metadata) error {
+	return &PathError{Op: "setmetadata", Path: name, Err: ErrPermission}
+}
+
 func (s readOnly) Remove(name string) error {
 	return &PathError{Op: "remove", Path: name, Err: ErrPermission}
 }
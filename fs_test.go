@@ -10,6 +10,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 )
 
 func generateData(t *testing.T, n int) []byte {
@@ -58,6 +59,49 @@ func Test_ReadFile(t *testing.T) {
 	}
 }
 
+func Test_ReadFileRelease(t *testing.T) {
+	buf := generateData(t, 4096)
+
+	f, err := ReadFile(t.Name(), bytes.NewReader(buf))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := io.ReadAll(f)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(b, buf) {
+		t.Fatal("unexpected file content")
+	}
+
+	if err := Cleanup(f); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := f.Read(b); !errors.Is(err, ErrClosed) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", ErrClosed, err)
+	}
+}
+
+func Benchmark_ReadFile(b *testing.B) {
+	buf := make([]byte, 1<<20)
+
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		f, err := ReadFile(b.Name(), bytes.NewReader(buf))
+
+		if err != nil {
+			b.Fatal(err)
+		}
+		Cleanup(f)
+	}
+}
+
 func Test_Hash(t *testing.T) {
 	sizes := [...]int{
 		32 << 20,
@@ -103,6 +147,183 @@ func Test_Hash(t *testing.T) {
 	}
 }
 
+func Test_HashUnique(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	store := Hash(Unique(New(dir)), sha256.New)
+
+	buf := generateData(t, 4096)
+
+	for i := 0; i < 2; i++ {
+		f, err := ReadFile(t.Name(), bytes.NewReader(buf))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = store.Put(f)
+
+		if i == 0 && err != nil {
+			t.Fatal(err)
+		}
+
+		if i == 1 && !errors.Is(err, ErrExist) {
+			t.Fatalf("unexpected error, expected=%q, got=%v\n", ErrExist, err)
+		}
+	}
+
+	ents, err := os.ReadDir(dir)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ents) != 1 {
+		t.Fatalf("unexpected number of files, expected=%d, got=%d\n", 1, len(ents))
+	}
+}
+
+func Test_HashWriteOnly(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	store := Hash(WriteOnly(New(dir)), sha256.New)
+
+	buf := generateData(t, 4096)
+	sum := sha256.Sum256(buf)
+
+	f, err := ReadFile(t.Name(), bytes.NewReader(buf))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.Put(f); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, hex.EncodeToString(sum[:]))); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_HashLimitWriteOnly(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	store := Hash(Limit(WriteOnly(New(dir)), 1<<20), sha256.New)
+
+	buf := generateData(t, 4096)
+	sum := sha256.Sum256(buf)
+
+	f, err := ReadFile(t.Name(), bytes.NewReader(buf))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer Cleanup(f)
+
+	if _, err := store.Put(f); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, hex.EncodeToString(sum[:]))); err != nil {
+		t.Fatal(err)
+	}
+
+	tmps, err := filepath.Glob(filepath.Join(dir, ".hash-*"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tmps) != 0 {
+		t.Fatalf("unexpected temporary files, expected=%d, got=%d\n", 0, len(tmps))
+	}
+
+	if _, ok := Limit(WriteOnly(New(dir)), 1<<20).(RenameFS); ok {
+		t.Fatalf("unexpected RenameFS for limit over write only filesystem\n")
+	}
+}
+
+func Test_WrapperRename(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	key := make([]byte, 32)
+
+	tests := []struct {
+		name string
+		wrap func(FS) FS
+	}{
+		{"Balance", func(s FS) FS { return ReadBalance(s, RoundRobin(), Null()) }},
+		{"Bloom", func(s FS) FS { return Bloom(s, 10, 0.01) }},
+		{"Breaker", func(s FS) FS { return Breaker(s, BreakerPolicy{}) }},
+		{"CacheStat", func(s FS) FS { return CacheStat(s, time.Minute) }},
+		{"Chaos", func(s FS) FS { return Chaos(s, 0, ChaosConfig{}) }},
+		{"Checksum", func(s FS) FS { return Checksum(s, sha256.New, ".sha256") }},
+		{"Decompress", func(s FS) FS { return Decompress(s) }},
+		{"DryRun", func(s FS) FS { return DryRun(s, func(Op) {}) }},
+		{"Hash", func(s FS) FS { return Hash(s, sha256.New) }},
+		{"Hold", func(s FS) FS { return Hold(s) }},
+		{"Labeled", func(s FS) FS { return Labeled(s, "test") }},
+		{"Lanes", func(s FS) FS {
+			interactive, _ := Lanes(s, LaneConfig{})
+			return interactive
+		}},
+		{"Merkle", func(s FS) FS { return Merkle(s, sha256.New, 0) }},
+		{"Moderate", func(s FS) FS { return Moderate(s) }},
+		{"EncryptNames", func(s FS) FS {
+			s, err := EncryptNames(s, key)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			return s
+		}},
+		{"Quarantine", func(s FS) FS { return Quarantine(s, nil) }},
+		{"Residency", func(s FS) FS {
+			return Residency(nil, map[string]FS{"eu": s, "us": New(dir)})
+		}},
+		{"Scope", func(s FS) FS { return Scope(s, Hold, Inherit) }},
+		{"Shard", func(s FS) FS {
+			return Shard(map[string]FS{"a": s, "b": New(dir)})
+		}},
+		{"Instrument", func(s FS) FS { return Instrument(s, StatsConfig{}) }},
+		{"Tier", func(s FS) FS { return Tier(New(dir), s, TierPolicy{}) }},
+		{"Timeout", func(s FS) FS { return Timeout(s, time.Minute) }},
+		{"Variants", func(s FS) FS { return Variants(s) }},
+	}
+
+	for i, test := range tests {
+		if _, ok := test.wrap(New(dir)).(RenameFS); !ok {
+			t.Fatalf("tests[%d] - expected RenameFS for %s\n", i, test.name)
+		}
+
+		store := test.wrap(WriteOnly(New(dir)))
+
+		if _, ok := store.(RenameFS); ok {
+			t.Fatalf("tests[%d] - unexpected RenameFS for %s over write only filesystem\n", i, test.name)
+		}
+
+		if err := Move(store, "a", "b"); !errors.Is(err, ErrUnsupported) {
+			t.Fatalf("tests[%d] - unexpected error, expected=%q, got=%q\n", i, ErrUnsupported, err)
+		}
+
+		sub, err := store.Sub("sub")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, ok := sub.(RenameFS); ok {
+			t.Fatalf("tests[%d] - unexpected RenameFS for sub of %s over write only filesystem\n", i, test.name)
+		}
+	}
+}
+
 func Test_Limit(t *testing.T) {
 	dir := tmpdir(t)
 	defer os.RemoveAll(dir)
@@ -124,11 +345,48 @@ func Test_Limit(t *testing.T) {
 		if !errors.Is(err, expected) {
 			t.Fatalf("unexpected error, expected=%T, got=%T(%q)\n", expected, err, err)
 		}
+
+		if size := err.(SizeError).FileSize; size != 50<<20 {
+			t.Fatalf("unexpected file size, expected=%d, got=%d\n", 50<<20, size)
+		}
 		return
 	}
 	t.Fatal("expected LimitStore.Put to error, it did not")
 }
 
+func Test_SizeError(t *testing.T) {
+	err := SizeError{
+		Size:     32 << 20,
+		Name:     "file",
+		FileSize: 87 << 20,
+	}
+
+	tests := []struct {
+		target   SizeError
+		expected bool
+	}{
+		{SizeError{}, true},
+		{SizeError{Size: 32 << 20}, true},
+		{SizeError{Size: 1024}, false},
+		{SizeError{Name: "file"}, true},
+		{SizeError{Name: "other"}, false},
+		{SizeError{Size: 32 << 20, Name: "file", FileSize: 87 << 20}, true},
+		{SizeError{FileSize: 1}, false},
+	}
+
+	for i, test := range tests {
+		if is := errors.Is(err, test.target); is != test.expected {
+			t.Fatalf("tests[%d] - unexpected errors.Is, expected=%v, got=%v\n", i, test.expected, is)
+		}
+	}
+
+	expected := "file too large, 87 MB exceeds the 32 MB limit"
+
+	if msg := err.Error(); msg != expected {
+		t.Fatalf("unexpected error message, expected=%q, got=%q\n", expected, msg)
+	}
+}
+
 func Test_LimitChange(t *testing.T) {
 	dir := tmpdir(t)
 	defer os.RemoveAll(dir)
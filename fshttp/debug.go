@@ -0,0 +1,67 @@
+package fshttp
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/andrewpillar/fs"
+)
+
+// Layer is a single filesystem in the chain of wrappers reported by Debug.
+type Layer struct {
+	// Type is the Go type of the filesystem.
+	Type string `json:"type"`
+
+	// State is the internal state of the filesystem, if it implements
+	// fs.DebugFS.
+	State map[string]any `json:"state,omitempty"`
+}
+
+type debugHandler struct {
+	fs fs.FS
+}
+
+// Debug returns a handler that reports the chain of wrappers around the given
+// FS as JSON, outermost first, along with the internal state of each wrapper
+// that implements fs.DebugFS, such as the hit rate of a cache, or the
+// operations in flight. It is typically mounted alongside the other debug
+// handlers of a server, for example,
+//
+//	http.Handle("/debug/fs", fshttp.Debug(store))
+//
+// The state of the FS may reveal the names of files and directories, so the
+// handler should not be publicly accessible.
+func Debug(s fs.FS) http.Handler {
+	return &debugHandler{
+		fs: s,
+	}
+}
+
+func (h *debugHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeError(w, http.StatusMethodNotAllowed)
+		return
+	}
+
+	layers := make([]Layer, 0)
+
+	for s := h.fs; s != nil; s = fs.Unwrap(s) {
+		l := Layer{
+			Type: fmt.Sprintf("%T", s),
+		}
+
+		if ds, ok := s.(fs.DebugFS); ok {
+			l.State = ds.Debug()
+		}
+		layers = append(layers, l)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+
+	json.NewEncoder(w).Encode(map[string]any{
+		"chain": layers,
+	})
+}
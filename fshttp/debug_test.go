@@ -0,0 +1,57 @@
+package fshttp
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/andrewpillar/fs"
+	"github.com/andrewpillar/fs/fakefs"
+)
+
+func Test_Debug(t *testing.T) {
+	store := fs.Instrument(fs.CacheStat(fakefs.New(), time.Minute), fs.StatsConfig{})
+
+	store.Stat("file")
+	store.Stat("file")
+
+	rec := httptest.NewRecorder()
+
+	Debug(store).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/fs", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status, expected=%d, got=%d\n", http.StatusOK, rec.Code)
+	}
+
+	var resp struct {
+		Chain []Layer `json:"chain"`
+	}
+
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"fs.renameStatsFS", "fs.renameStatCache", "*fakefs.FS"}
+
+	if len(resp.Chain) != len(expected) {
+		t.Fatalf("unexpected chain, expected=%d layers, got=%d\n", len(expected), len(resp.Chain))
+	}
+
+	for i, typ := range expected {
+		if resp.Chain[i].Type != typ {
+			t.Fatalf("chain[%d] - unexpected type, expected=%q, got=%q\n", i, typ, resp.Chain[i].Type)
+		}
+	}
+
+	cache := resp.Chain[1].State
+
+	if cache["hits"] != float64(1) || cache["misses"] != float64(1) {
+		t.Fatalf("unexpected cache state, expected=1 hit 1 miss, got=%v\n", cache)
+	}
+
+	if resp.Chain[0].State["stats"] == nil {
+		t.Fatalf("expected stats in state of %q\n", expected[0])
+	}
+}
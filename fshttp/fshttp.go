@@ -0,0 +1,476 @@
+// Package fshttp serves the files in an FS over HTTP.
+//
+// A Handler serves downloads via GET and HEAD, uploads via PUT, and removals
+// via DELETE, where the path of the request is the name of the file. Uploads
+// and removals are only served if the Handler is configured via Authorize. It
+// is typically mounted under a prefix with http.StripPrefix, for example,
+//
+//	http.Handle("/files/", http.StripPrefix("/files/", fshttp.New(store)))
+//
+// A Handler configured with a Signer only serves downloads, and the path of
+// each request is a signed token for the file rather than its name, so
+// private files can be shared via links that expire.
+//
+// Large files can be uploaded in parts, and resumed after a failure, via the
+// tus protocol served by Uploads.
+//
+// The chain of wrappers around an FS, and their internal state, can be
+// inspected via the handler returned from Debug.
+package fshttp
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/andrewpillar/fs"
+)
+
+// Op is the operation a request makes on a file.
+type Op int
+
+const (
+	OpRead   Op = iota // Download a file.
+	OpWrite            // Upload a file.
+	OpDelete           // Remove a file.
+	OpList             // List a directory.
+)
+
+var opNames = [...]string{"read", "write", "delete", "list"}
+
+func (op Op) String() string {
+	if int(op) < len(opNames) {
+		return opNames[op]
+	}
+	return "Op(" + strconv.Itoa(int(op)) + ")"
+}
+
+// ErrUnauthorized can be returned from an AuthorizeFunc when a request is not
+// authenticated, so a 401 is sent rather than a 403.
+var ErrUnauthorized = errors.New("unauthorized")
+
+// AuthorizeFunc decides whether the given request may make the operation on
+// the named file. A nil error allows the request. ErrUnauthorized results in
+// a 401, ErrNotExist in a 404, and any other error in a 403.
+type AuthorizeFunc func(r *http.Request, name string, op Op) error
+
+// DefaultMaxUploadSize is the largest file that can be uploaded via PUT if no
+// other size is given via MaxUploadSize.
+const DefaultMaxUploadSize = 1 << 30
+
+// Handler serves the files in an FS over HTTP.
+type Handler struct {
+	fs        fs.FS
+	signer    *Signer
+	authorize AuthorizeFunc
+	listing   bool
+	maxUpload int64
+}
+
+var _ http.Handler = (*Handler)(nil)
+
+// Option configures a Handler.
+type Option func(*Handler)
+
+// Signed configures the Handler to only serve downloads via the tokens
+// created by the given Signer.
+func Signed(s *Signer) Option {
+	return func(h *Handler) {
+		h.signer = s
+	}
+}
+
+// Authorize configures the Handler to call the given function before each
+// request is served. Downloads via signed tokens are not passed to it, since
+// the token authorizes the download. Uploads and removals are refused with a
+// 405 unless the Handler is configured with this.
+func Authorize(fn AuthorizeFunc) Option {
+	return func(h *Handler) {
+		h.authorize = fn
+	}
+}
+
+// Listing configures the Handler to list the contents of a directory when it
+// is requested with a trailing slash. See the Handler.list method for the
+// formats the listing is served in.
+func Listing() Option {
+	return func(h *Handler) {
+		h.listing = true
+	}
+}
+
+// MaxUploadSize sets the largest file that can be uploaded via PUT, larger
+// uploads are refused with a 413. The default is DefaultMaxUploadSize.
+func MaxUploadSize(n int64) Option {
+	return func(h *Handler) {
+		if n > 0 {
+			h.maxUpload = n
+		}
+	}
+}
+
+// New returns a Handler that serves the files in the given FS.
+func New(s fs.FS, opts ...Option) *Handler {
+	h := &Handler{
+		fs:        s,
+		maxUpload: DefaultMaxUploadSize,
+	}
+
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// statusCode returns the HTTP status code for the given error from the FS.
+func statusCode(err error) int {
+	var maxBytes *http.MaxBytesError
+
+	switch {
+	case errors.As(err, &maxBytes):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, fs.ErrNotExist):
+		return http.StatusNotFound
+	case errors.Is(err, fs.ErrPermission):
+		return http.StatusForbidden
+	case errors.Is(err, fs.ErrExist):
+		return http.StatusConflict
+	case errors.Is(err, fs.SizeError{}):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, fs.ErrInvalid):
+		return http.StatusBadRequest
+	case errors.Is(err, fs.ErrUnsupported):
+		return http.StatusNotImplemented
+	}
+	return http.StatusInternalServerError
+}
+
+// allow calls the authorize hook, if any, and writes the error response if the
+// request is not allowed.
+func (h *Handler) allow(w http.ResponseWriter, r *http.Request, name string, op Op) bool {
+	if h.authorize == nil {
+		return true
+	}
+
+	err := h.authorize(r, name, op)
+
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, ErrUnauthorized):
+		writeError(w, http.StatusUnauthorized)
+	case errors.Is(err, fs.ErrNotExist):
+		writeError(w, http.StatusNotFound)
+	default:
+		writeError(w, http.StatusForbidden)
+	}
+	return false
+}
+
+func writeError(w http.ResponseWriter, status int) {
+	http.Error(w, http.StatusText(status), status)
+}
+
+// cleanName returns the name of the file for the given request path, or false
+// if the path is not a valid name.
+func cleanName(p string) (string, bool) {
+	name := strings.TrimPrefix(p, "/")
+
+	if name == "" {
+		return ".", true
+	}
+
+	name = strings.TrimSuffix(name, "/")
+
+	if name == "." || !fs.ValidPath(name) {
+		return "", false
+	}
+	return name, true
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.signer != nil {
+		h.serveToken(w, r)
+		return
+	}
+
+	name, ok := cleanName(r.URL.Path)
+
+	if !ok {
+		writeError(w, http.StatusBadRequest)
+		return
+	}
+
+	var op Op
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		op = OpRead
+
+		if h.listing && (name == "." || strings.HasSuffix(r.URL.Path, "/")) {
+			op = OpList
+		}
+	case http.MethodPut:
+		op = OpWrite
+	case http.MethodDelete:
+		op = OpDelete
+	default:
+		h.notAllowed(w)
+		return
+	}
+
+	if (op == OpWrite || op == OpDelete) && h.authorize == nil {
+		h.notAllowed(w)
+		return
+	}
+
+	if !h.allow(w, r, name, op) {
+		return
+	}
+
+	switch op {
+	case OpRead:
+		h.serveFile(w, r, name)
+	case OpWrite:
+		h.put(w, r, name)
+	case OpDelete:
+		h.remove(w, r, name)
+	case OpList:
+		h.list(w, r, name)
+	}
+}
+
+// notAllowed writes the response for a request made with a method that is not
+// allowed.
+func (h *Handler) notAllowed(w http.ResponseWriter) {
+	allow := "GET, HEAD"
+
+	if h.authorize != nil {
+		allow += ", PUT, DELETE"
+	}
+
+	w.Header().Set("Allow", allow)
+	writeError(w, http.StatusMethodNotAllowed)
+}
+
+func (h *Handler) serveToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeError(w, http.StatusMethodNotAllowed)
+		return
+	}
+
+	name, err := h.signer.Verify(strings.TrimPrefix(r.URL.Path, "/"))
+
+	if err != nil {
+		writeError(w, http.StatusForbidden)
+		return
+	}
+
+	// Signed links are unique to a file and expire, so should not be
+	// cached by anything shared.
+	w.Header().Set("Cache-Control", "private, no-store")
+
+	h.serveFile(w, r, name)
+}
+
+// contentType returns the content type of the named file from its metadata,
+// falling back to its extension.
+func (h *Handler) contentType(name string) string {
+	if md, err := fs.GetMetadata(h.fs, name); err == nil {
+		if ctype := md[fs.MetadataContentType]; ctype != "" {
+			return ctype
+		}
+	}
+
+	if ctype := mime.TypeByExtension(path.Ext(name)); ctype != "" {
+		return ctype
+	}
+	return "application/octet-stream"
+}
+
+// etag returns a strong ETag for the file derived from its modification time
+// and size, in the same form as nginx.
+func etag(info fs.FileInfo) string {
+	return `"` + strconv.FormatInt(info.ModTime().Unix(), 16) + "-" + strconv.FormatInt(info.Size(), 16) + `"`
+}
+
+// forwardSeeker is an io.ReadSeeker for a file that cannot seek. It knows the
+// size of the file, and can seek forwards by discarding what it skips, which
+// is enough to serve a single range.
+type forwardSeeker struct {
+	r    io.Reader
+	size int64
+	pos  int64
+	seen int64
+}
+
+func (s *forwardSeeker) Read(p []byte) (int, error) {
+	if s.pos != s.seen {
+		if _, err := io.CopyN(io.Discard, s.r, s.pos-s.seen); err != nil {
+			return 0, err
+		}
+		s.seen = s.pos
+	}
+
+	n, err := s.r.Read(p)
+
+	s.pos += int64(n)
+	s.seen = s.pos
+
+	return n, err
+}
+
+func (s *forwardSeeker) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += s.pos
+	case io.SeekEnd:
+		offset += s.size
+	default:
+		return 0, fs.ErrInvalid
+	}
+
+	// Seeking to the end is allowed without reading, since this is how
+	// http.ServeContent finds the size of the content.
+	if offset < s.seen && offset != s.size {
+		return 0, errors.New("fshttp: cannot seek backwards")
+	}
+
+	s.pos = offset
+	return offset, nil
+}
+
+// readSeeker returns an io.ReadSeeker for the file, using the file itself if
+// it can seek, or an io.SectionReader if it implements io.ReaderAt. Otherwise
+// a forwardSeeker is used, and false is returned, since only a single range
+// can be served.
+func readSeeker(f fs.File, size int64) (io.ReadSeeker, bool) {
+	if rs, ok := f.(io.ReadSeeker); ok {
+		return rs, true
+	}
+
+	if ra, ok := f.(io.ReaderAt); ok {
+		return io.NewSectionReader(ra, 0, size), true
+	}
+	return &forwardSeeker{r: f, size: size}, false
+}
+
+// serveFile serves the named file via http.ServeContent, so conditional and
+// range requests are handled. Files that can seek, or implement io.ReaderAt,
+// can be served with any ranges, otherwise requests for multiple ranges are
+// served the whole file.
+func (h *Handler) serveFile(w http.ResponseWriter, r *http.Request, name string) {
+	f, err := h.fs.Open(name)
+
+	if err != nil {
+		writeError(w, statusCode(err))
+		return
+	}
+
+	defer f.Close()
+
+	info, err := f.Stat()
+
+	if err != nil {
+		writeError(w, statusCode(err))
+		return
+	}
+
+	if info.IsDir() {
+		writeError(w, http.StatusNotFound)
+		return
+	}
+
+	hdr := w.Header()
+	hdr.Set("Content-Type", h.contentType(name))
+	hdr.Set("ETag", etag(info))
+
+	rs, ok := readSeeker(f, info.Size())
+
+	if !ok && strings.Contains(r.Header.Get("Range"), ",") {
+		r.Header.Del("Range")
+	}
+	http.ServeContent(w, r, name, info.ModTime(), rs)
+}
+
+func (h *Handler) put(w http.ResponseWriter, r *http.Request, name string) {
+	if name == "." {
+		writeError(w, http.StatusBadRequest)
+		return
+	}
+
+	dst := h.fs
+
+	if dir := path.Dir(name); dir != "." {
+		sub, err := h.fs.Sub(dir)
+
+		if err != nil {
+			writeError(w, statusCode(err))
+			return
+		}
+		dst = sub
+	}
+
+	f, err := fs.ReadFile(path.Base(name), http.MaxBytesReader(w, r.Body, h.maxUpload))
+
+	if err != nil {
+		writeError(w, statusCode(err))
+		return
+	}
+
+	defer fs.Cleanup(f)
+
+	if ctype := r.Header.Get("Content-Type"); ctype != "" {
+		f = withContentType(f, ctype)
+	}
+
+	stored, err := fs.PutMetadata(dst, f)
+
+	if err != nil {
+		writeError(w, statusCode(err))
+		return
+	}
+
+	defer stored.Close()
+
+	if info, err := stored.Stat(); err == nil {
+		w.Header().Set("Last-Modified", info.ModTime().UTC().Format(http.TimeFormat))
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (h *Handler) remove(w http.ResponseWriter, r *http.Request, name string) {
+	if name == "." {
+		writeError(w, http.StatusBadRequest)
+		return
+	}
+
+	if err := h.fs.Remove(name); err != nil {
+		writeError(w, statusCode(err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// metadataFile is a file uploaded with a content type, which is stored in
+// its metadata if the FS supports it.
+type metadataFile struct {
+	fs.File
+
+	md fs.Metadata
+}
+
+func (f *metadataFile) Metadata() fs.Metadata { return f.md }
+
+func withContentType(f fs.File, ctype string) fs.File {
+	return &metadataFile{
+		File: f,
+		md:   fs.Metadata{fs.MetadataContentType: ctype},
+	}
+}
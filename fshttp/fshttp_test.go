@@ -0,0 +1,221 @@
+package fshttp
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/andrewpillar/fs"
+	"github.com/andrewpillar/fs/fakefs"
+)
+
+func do(t *testing.T, h http.Handler, method, target string, body io.Reader) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, target, body))
+	return rec
+}
+
+func allowAll(*http.Request, string, Op) error { return nil }
+
+func Test_Handler(t *testing.T) {
+	h := New(fakefs.New(), Authorize(allowAll))
+
+	if rec := do(t, h, "PUT", "/docs/readme.txt", strings.NewReader("hello")); rec.Code != http.StatusCreated {
+		t.Fatalf("unexpected status, expected=%d, got=%d\n", http.StatusCreated, rec.Code)
+	}
+
+	rec := do(t, h, "GET", "/docs/readme.txt", nil)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status, expected=%d, got=%d\n", http.StatusOK, rec.Code)
+	}
+
+	if body := rec.Body.String(); body != "hello" {
+		t.Fatalf("unexpected body, expected=%q, got=%q\n", "hello", body)
+	}
+
+	if ctype := rec.Header().Get("Content-Type"); !strings.HasPrefix(ctype, "text/plain") {
+		t.Fatalf("unexpected content type, expected=%q, got=%q\n", "text/plain", ctype)
+	}
+
+	if rec := do(t, h, "DELETE", "/docs/readme.txt", nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("unexpected status, expected=%d, got=%d\n", http.StatusNoContent, rec.Code)
+	}
+
+	if rec := do(t, h, "GET", "/docs/readme.txt", nil); rec.Code != http.StatusNotFound {
+		t.Fatalf("unexpected status, expected=%d, got=%d\n", http.StatusNotFound, rec.Code)
+	}
+
+	if rec := do(t, h, "GET", "/docs/../../etc/passwd", nil); rec.Code != http.StatusBadRequest {
+		t.Fatalf("unexpected status, expected=%d, got=%d\n", http.StatusBadRequest, rec.Code)
+	}
+}
+
+func Test_HandlerAuthorize(t *testing.T) {
+	var ops []Op
+
+	h := New(fakefs.New(), Authorize(func(r *http.Request, name string, op Op) error {
+		ops = append(ops, op)
+
+		user := r.Header.Get("X-User")
+
+		if user == "" {
+			return ErrUnauthorized
+		}
+
+		if !strings.HasPrefix(name, user+"/") {
+			return errors.New("not your file")
+		}
+
+		if op == OpDelete && user != "admin" {
+			return fs.ErrPermission
+		}
+		return nil
+	}))
+
+	tests := []struct {
+		method string
+		target string
+		user   string
+		status int
+	}{
+		{"PUT", "/alice/a.txt", "", http.StatusUnauthorized},
+		{"PUT", "/alice/a.txt", "alice", http.StatusCreated},
+		{"GET", "/alice/a.txt", "alice", http.StatusOK},
+		{"GET", "/alice/a.txt", "bob", http.StatusForbidden},
+		{"DELETE", "/alice/a.txt", "alice", http.StatusForbidden},
+	}
+
+	for i, test := range tests {
+		req := httptest.NewRequest(test.method, test.target, strings.NewReader("data"))
+
+		if test.user != "" {
+			req.Header.Set("X-User", test.user)
+		}
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		if rec.Code != test.status {
+			t.Fatalf("tests[%d] - unexpected status, expected=%d, got=%d\n", i, test.status, rec.Code)
+		}
+	}
+
+	expected := []Op{OpWrite, OpWrite, OpRead, OpRead, OpDelete}
+
+	if !reflect.DeepEqual(ops, expected) {
+		t.Fatalf("unexpected ops, expected=%v, got=%v\n", expected, ops)
+	}
+}
+
+func Test_HandlerRange(t *testing.T) {
+	h := New(fakefs.New(), Authorize(allowAll))
+
+	if rec := do(t, h, "PUT", "/video.bin", strings.NewReader("0123456789")); rec.Code != http.StatusCreated {
+		t.Fatalf("unexpected status, expected=%d, got=%d\n", http.StatusCreated, rec.Code)
+	}
+
+	req := httptest.NewRequest("GET", "/video.bin", nil)
+	req.Header.Set("Range", "bytes=2-5")
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusPartialContent {
+		t.Fatalf("unexpected status, expected=%d, got=%d\n", http.StatusPartialContent, rec.Code)
+	}
+
+	if body := rec.Body.String(); body != "2345" {
+		t.Fatalf("unexpected body, expected=%q, got=%q\n", "2345", body)
+	}
+
+	etag := rec.Header().Get("ETag")
+
+	req = httptest.NewRequest("GET", "/video.bin", nil)
+	req.Header.Set("If-None-Match", etag)
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNotModified {
+		t.Fatalf("unexpected status, expected=%d, got=%d\n", http.StatusNotModified, rec.Code)
+	}
+}
+
+// readOnly hides any methods of the reader other than Read.
+type readOnly struct {
+	io.Reader
+}
+
+func Test_ForwardSeeker(t *testing.T) {
+	rs := &forwardSeeker{
+		r:    readOnly{strings.NewReader("0123456789")},
+		size: 10,
+	}
+
+	if n, err := rs.Seek(0, io.SeekEnd); err != nil || n != 10 {
+		t.Fatalf("unexpected seek, expected=%d, got=%d, err=%v\n", 10, n, err)
+	}
+
+	if _, err := rs.Seek(6, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+
+	b := make([]byte, 2)
+
+	if _, err := io.ReadFull(rs, b); err != nil {
+		t.Fatal(err)
+	}
+
+	if string(b) != "67" {
+		t.Fatalf("unexpected read, expected=%q, got=%q\n", "67", string(b))
+	}
+
+	if _, err := rs.Seek(2, io.SeekStart); err == nil {
+		t.Fatalf("expected error seeking backwards\n")
+	}
+}
+
+func Test_HandlerReadOnly(t *testing.T) {
+	h := New(fakefs.New())
+
+	for _, method := range []string{"PUT", "DELETE"} {
+		rec := do(t, h, method, "/file.txt", strings.NewReader("data"))
+
+		if rec.Code != http.StatusMethodNotAllowed {
+			t.Fatalf("unexpected status, expected=%d, got=%d\n", http.StatusMethodNotAllowed, rec.Code)
+		}
+
+		if allow := rec.Header().Get("Allow"); allow != "GET, HEAD" {
+			t.Fatalf("unexpected allow, expected=%q, got=%q\n", "GET, HEAD", allow)
+		}
+	}
+}
+
+func Test_HandlerMaxUploadSize(t *testing.T) {
+	h := New(fakefs.New(), Authorize(allowAll), MaxUploadSize(4))
+
+	if rec := do(t, h, "PUT", "/small.txt", strings.NewReader("data")); rec.Code != http.StatusCreated {
+		t.Fatalf("unexpected status, expected=%d, got=%d\n", http.StatusCreated, rec.Code)
+	}
+
+	if rec := do(t, h, "PUT", "/large.txt", strings.NewReader("too large")); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("unexpected status, expected=%d, got=%d\n", http.StatusRequestEntityTooLarge, rec.Code)
+	}
+
+	if rec := do(t, h, "GET", "/large.txt", nil); rec.Code != http.StatusNotFound {
+		t.Fatalf("unexpected status, expected=%d, got=%d\n", http.StatusNotFound, rec.Code)
+	}
+}
+
+func Test_HandlerBackslash(t *testing.T) {
+	h := New(fakefs.New(), Authorize(allowAll))
+
+	if rec := do(t, h, "PUT", `/..%5Cetc%5Cpasswd`, strings.NewReader("data")); rec.Code != http.StatusBadRequest {
+		t.Fatalf("unexpected status, expected=%d, got=%d\n", http.StatusBadRequest, rec.Code)
+	}
+}
@@ -0,0 +1,127 @@
+package fshttp
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/andrewpillar/fs"
+)
+
+// Entry is a single entry in a directory listing.
+type Entry struct {
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	IsDir   bool      `json:"is_dir"`
+}
+
+var listingTmpl = template.Must(template.New("listing").Funcs(template.FuncMap{
+	"humanSize": fs.HumanSize,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Index of {{.Dir}}</title>
+<style>
+body { font-family: sans-serif; }
+td { padding: 0 1em 0 0; }
+td.size { text-align: right; }
+</style>
+</head>
+<body>
+<h1>Index of {{.Dir}}</h1>
+<table>
+<tr><th>Name</th><th>Size</th><th>Modified</th></tr>
+{{- if ne .Dir "/"}}
+<tr><td><a href="../">../</a></td><td></td><td></td></tr>
+{{- end}}
+{{- range .Entries}}
+{{- if .IsDir}}
+<tr><td><a href="{{.Name}}/">{{.Name}}/</a></td><td></td><td>{{.ModTime.UTC.Format "2006-01-02 15:04:05"}}</td></tr>
+{{- else}}
+<tr><td><a href="{{.Name}}">{{.Name}}</a></td><td class="size">{{humanSize .Size}}</td><td>{{.ModTime.UTC.Format "2006-01-02 15:04:05"}}</td></tr>
+{{- end}}
+{{- end}}
+</table>
+</body>
+</html>
+`))
+
+// wantsJSON reports whether the request asked for the listing as JSON, either
+// via the format query parameter or the Accept header.
+func wantsJSON(r *http.Request) bool {
+	if format := r.URL.Query().Get("format"); format != "" {
+		return format == "json"
+	}
+	return strings.Contains(r.Header.Get("Accept"), "application/json")
+}
+
+// list serves the listing of the named directory. This is served as a JSON
+// array of Entry if requested with ?format=json, or an Accept header of
+// application/json, otherwise as an HTML page.
+func (h *Handler) list(w http.ResponseWriter, r *http.Request, name string) {
+	ents, err := fs.ReadDir(h.fs, name)
+
+	if err != nil {
+		writeError(w, statusCode(err))
+		return
+	}
+
+	list := make([]Entry, 0, len(ents))
+
+	for _, ent := range ents {
+		info, err := ent.Info()
+
+		if err != nil {
+			writeError(w, statusCode(err))
+			return
+		}
+
+		e := Entry{
+			Name:    ent.Name(),
+			ModTime: info.ModTime(),
+			IsDir:   ent.IsDir(),
+		}
+
+		if !e.IsDir {
+			e.Size = info.Size()
+		}
+		list = append(list, e)
+	}
+
+	// Listings change as files are put, so should always be revalidated.
+	w.Header().Set("Cache-Control", "no-cache")
+
+	if wantsJSON(r) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if r.Method == http.MethodHead {
+			return
+		}
+		json.NewEncoder(w).Encode(list)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	dir := "/"
+
+	if name != "." {
+		dir = "/" + name + "/"
+	}
+
+	listingTmpl.Execute(w, struct {
+		Dir     string
+		Entries []Entry
+	}{
+		Dir:     dir,
+		Entries: list,
+	})
+}
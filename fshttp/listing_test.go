@@ -0,0 +1,62 @@
+package fshttp
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/andrewpillar/fs/fakefs"
+)
+
+func Test_HandlerListing(t *testing.T) {
+	h := New(fakefs.New(), Listing(), Authorize(allowAll))
+
+	for _, name := range []string{"/builds/1/app.tar.gz", "/builds/2/app.tar.gz", "/builds/latest.txt"} {
+		if rec := do(t, h, "PUT", name, strings.NewReader("data")); rec.Code != http.StatusCreated {
+			t.Fatalf("unexpected status, expected=%d, got=%d\n", http.StatusCreated, rec.Code)
+		}
+	}
+
+	rec := do(t, h, "GET", "/builds/?format=json", nil)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status, expected=%d, got=%d\n", http.StatusOK, rec.Code)
+	}
+
+	var ents []Entry
+
+	if err := json.NewDecoder(rec.Body).Decode(&ents); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"1", "2", "latest.txt"}
+
+	if len(ents) != len(expected) {
+		t.Fatalf("unexpected entries, expected=%d, got=%d\n", len(expected), len(ents))
+	}
+
+	for i, ent := range ents {
+		if ent.Name != expected[i] {
+			t.Fatalf("ents[%d] - unexpected name, expected=%q, got=%q\n", i, expected[i], ent.Name)
+		}
+	}
+
+	if !ents[0].IsDir || ents[2].IsDir || ents[2].Size != 4 {
+		t.Fatalf("unexpected entries %+v\n", ents)
+	}
+
+	rec = do(t, h, "GET", "/builds/", nil)
+
+	if ctype := rec.Header().Get("Content-Type"); !strings.HasPrefix(ctype, "text/html") {
+		t.Fatalf("unexpected content type, expected=%q, got=%q\n", "text/html", ctype)
+	}
+
+	if body := rec.Body.String(); !strings.Contains(body, `<a href="latest.txt">latest.txt</a>`) {
+		t.Fatalf("expected listing to link to latest.txt, got=%q\n", body)
+	}
+
+	if rec := do(t, New(fakefs.New()), "GET", "/", nil); rec.Code != http.StatusNotFound {
+		t.Fatalf("unexpected status, expected=%d, got=%d\n", http.StatusNotFound, rec.Code)
+	}
+}
@@ -0,0 +1,98 @@
+package fshttp
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrTokenInvalid is the error returned when a token is malformed, or its
+	// signature does not match.
+	ErrTokenInvalid = errors.New("invalid token")
+
+	// ErrTokenExpired is the error returned when a token has expired.
+	ErrTokenExpired = errors.New("token expired")
+)
+
+// Signer creates and verifies the signed tokens used to download files from a
+// Handler configured via Signed. A token contains the name of the file and
+// the time it expires, signed with HMAC-SHA256, so it cannot be altered or
+// forged without the key.
+type Signer struct {
+	key []byte
+	now func() time.Time
+}
+
+// NewSigner returns a Signer that signs tokens with the given key. The key
+// should be at least 32 random bytes, and kept secret.
+func NewSigner(key []byte) *Signer {
+	return &Signer{
+		key: key,
+		now: time.Now,
+	}
+}
+
+func (s *Signer) mac(payload []byte) []byte {
+	h := hmac.New(sha256.New, s.key)
+	h.Write(payload)
+	return h.Sum(nil)
+}
+
+// Sign returns a token for the named file that expires after the given
+// duration. The token is safe to use in the path of a URL.
+func (s *Signer) Sign(name string, ttl time.Duration) string {
+	payload := make([]byte, 8, 8+len(name))
+	binary.BigEndian.PutUint64(payload, uint64(s.now().Add(ttl).Unix()))
+	payload = append(payload, name...)
+
+	enc := base64.RawURLEncoding
+
+	return enc.EncodeToString(payload) + "." + enc.EncodeToString(s.mac(payload))
+}
+
+// Verify verifies the given token, and returns the name of the file it is
+// for. If the token is invalid then ErrTokenInvalid is returned, and if it
+// has expired then ErrTokenExpired is returned.
+func (s *Signer) Verify(token string) (string, error) {
+	enc := base64.RawURLEncoding
+
+	p, sig, ok := strings.Cut(token, ".")
+
+	if !ok {
+		return "", ErrTokenInvalid
+	}
+
+	payload, err := enc.DecodeString(p)
+
+	if err != nil || len(payload) < 8 {
+		return "", ErrTokenInvalid
+	}
+
+	mac, err := enc.DecodeString(sig)
+
+	if err != nil {
+		return "", ErrTokenInvalid
+	}
+
+	if !hmac.Equal(mac, s.mac(payload)) {
+		return "", ErrTokenInvalid
+	}
+
+	expires := time.Unix(int64(binary.BigEndian.Uint64(payload)), 0)
+
+	if !s.now().Before(expires) {
+		return "", ErrTokenExpired
+	}
+
+	name, ok := cleanName(string(payload[8:]))
+
+	if !ok || name == "." {
+		return "", ErrTokenInvalid
+	}
+	return name, nil
+}
@@ -0,0 +1,76 @@
+package fshttp
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andrewpillar/fs/fakefs"
+)
+
+func Test_Signer(t *testing.T) {
+	now := time.Now()
+
+	s := NewSigner([]byte("secret"))
+	s.now = func() time.Time { return now }
+
+	token := s.Sign("private/report.pdf", time.Minute)
+
+	name, err := s.Verify(token)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if name != "private/report.pdf" {
+		t.Fatalf("unexpected name, expected=%q, got=%q\n", "private/report.pdf", name)
+	}
+
+	if _, err := NewSigner([]byte("other")).Verify(token); !errors.Is(err, ErrTokenInvalid) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", ErrTokenInvalid, err)
+	}
+
+	tampered := s.Sign("private/other.pdf", time.Minute)
+	tampered = tampered[:strings.Index(tampered, ".")] + token[strings.Index(token, "."):]
+
+	if _, err := s.Verify(tampered); !errors.Is(err, ErrTokenInvalid) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", ErrTokenInvalid, err)
+	}
+
+	now = now.Add(time.Minute)
+
+	if _, err := s.Verify(token); !errors.Is(err, ErrTokenExpired) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", ErrTokenExpired, err)
+	}
+}
+
+func Test_HandlerSigned(t *testing.T) {
+	store := fakefs.New()
+
+	if rec := do(t, New(store, Authorize(allowAll)), "PUT", "/report.txt", strings.NewReader("private")); rec.Code != http.StatusCreated {
+		t.Fatalf("unexpected status, expected=%d, got=%d\n", http.StatusCreated, rec.Code)
+	}
+
+	s := NewSigner([]byte("secret"))
+	h := New(store, Signed(s))
+
+	rec := do(t, h, "GET", "/"+s.Sign("report.txt", time.Minute), nil)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status, expected=%d, got=%d\n", http.StatusOK, rec.Code)
+	}
+
+	if body := rec.Body.String(); body != "private" {
+		t.Fatalf("unexpected body, expected=%q, got=%q\n", "private", body)
+	}
+
+	if rec := do(t, h, "GET", "/report.txt", nil); rec.Code != http.StatusForbidden {
+		t.Fatalf("unexpected status, expected=%d, got=%d\n", http.StatusForbidden, rec.Code)
+	}
+
+	if rec := do(t, h, "PUT", "/"+s.Sign("report.txt", time.Minute), strings.NewReader("x")); rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("unexpected status, expected=%d, got=%d\n", http.StatusMethodNotAllowed, rec.Code)
+	}
+}
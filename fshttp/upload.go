@@ -0,0 +1,715 @@
+package fshttp
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andrewpillar/fs"
+)
+
+// ErrOffsetConflict is the error returned by an UploadStore when the offset of
+// an upload is not the offset it is expected to be advanced from.
+var ErrOffsetConflict = errors.New("upload offset conflict")
+
+// Upload is the state of a resumable upload.
+type Upload struct {
+	ID      string    `json:"id"`
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	Offset  int64     `json:"offset"`
+	Created time.Time `json:"created"`
+}
+
+// UploadStore stores the state of resumable uploads. Uploads can be resumed on
+// any instance that shares the same UploadStore and parts FS, so deployments
+// of multiple instances behind a load balancer should use a shared store, such
+// as one backed by a shared FS via FSUploads, or an external database such as
+// Redis. Implementations must be safe for concurrent use.
+type UploadStore interface {
+	// Create stores the given upload.
+	Create(ctx context.Context, u Upload) error
+
+	// Get returns the upload with the given ID. If it does not exist then
+	// ErrNotExist is returned.
+	Get(ctx context.Context, id string) (Upload, error)
+
+	// Advance sets the offset of the upload to the given offset, if its
+	// current offset is from. Otherwise ErrOffsetConflict is returned. This
+	// should be atomic, so two requests for the same part of an upload
+	// cannot both succeed.
+	Advance(ctx context.Context, id string, from, to int64) error
+
+	// Delete deletes the upload with the given ID.
+	Delete(ctx context.Context, id string) error
+}
+
+type memoryUploads struct {
+	mu      sync.Mutex
+	uploads map[string]Upload
+}
+
+// MemoryUploads returns an UploadStore that keeps uploads in memory. This is
+// only suitable for a single instance.
+func MemoryUploads() UploadStore {
+	return &memoryUploads{
+		uploads: make(map[string]Upload),
+	}
+}
+
+func (s *memoryUploads) Create(_ context.Context, u Upload) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.uploads[u.ID]; ok {
+		return fs.ErrExist
+	}
+
+	s.uploads[u.ID] = u
+	return nil
+}
+
+func (s *memoryUploads) Get(_ context.Context, id string) (Upload, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.uploads[id]
+
+	if !ok {
+		return u, fs.ErrNotExist
+	}
+	return u, nil
+}
+
+func (s *memoryUploads) Advance(_ context.Context, id string, from, to int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.uploads[id]
+
+	if !ok {
+		return fs.ErrNotExist
+	}
+
+	if u.Offset != from {
+		return ErrOffsetConflict
+	}
+
+	u.Offset = to
+	s.uploads[id] = u
+
+	return nil
+}
+
+func (s *memoryUploads) Delete(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.uploads, id)
+	return nil
+}
+
+type fsUploads struct {
+	fs fs.FS
+
+	// mu only serializes advances made by this instance, advances made by
+	// other instances sharing the FS may race.
+	mu sync.Mutex
+}
+
+// FSUploads returns an UploadStore that keeps each upload as a JSON file in
+// the given FS. Advances are only atomic within a single instance, so if
+// multiple instances share the FS, then a client should only upload one part
+// of an upload at a time, as tus clients do.
+func FSUploads(s fs.FS) UploadStore {
+	return &fsUploads{
+		fs: s,
+	}
+}
+
+func (s *fsUploads) write(u Upload) error {
+	b, err := json.Marshal(u)
+
+	if err != nil {
+		return err
+	}
+
+	f, err := fs.ReadFile(u.ID+".json", bytes.NewReader(b))
+
+	if err != nil {
+		return err
+	}
+
+	stored, err := s.fs.Put(f)
+
+	if err != nil {
+		return err
+	}
+	return stored.Close()
+}
+
+func (s *fsUploads) Create(_ context.Context, u Upload) error {
+	return s.write(u)
+}
+
+func (s *fsUploads) Get(_ context.Context, id string) (Upload, error) {
+	var u Upload
+
+	f, err := s.fs.Open(id + ".json")
+
+	if err != nil {
+		return u, err
+	}
+
+	defer f.Close()
+
+	if err := json.NewDecoder(f).Decode(&u); err != nil {
+		return u, err
+	}
+	return u, nil
+}
+
+func (s *fsUploads) Advance(ctx context.Context, id string, from, to int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.Get(ctx, id)
+
+	if err != nil {
+		return err
+	}
+
+	if u.Offset != from {
+		return ErrOffsetConflict
+	}
+
+	u.Offset = to
+	return s.write(u)
+}
+
+func (s *fsUploads) Delete(_ context.Context, id string) error {
+	if err := s.fs.Remove(id + ".json"); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+const tusVersion = "1.0.0"
+
+// UploadConfig configures the handling of resumable uploads.
+type UploadConfig struct {
+	// FS is where completed uploads are put.
+	FS fs.FS
+
+	// Parts is where the parts of incomplete uploads are kept, in a
+	// directory per upload. This should not be beneath a directory that is
+	// served, and must be shared by every instance that shares the Store.
+	Parts fs.FS
+
+	// Store stores the state of each upload. If nil then MemoryUploads is
+	// used.
+	Store UploadStore
+
+	// MaxSize is the largest upload allowed. If zero then there is no limit.
+	MaxSize int64
+
+	// Authorize is called with OpWrite when an upload is created, with the
+	// name the upload will be stored under. If nil then no uploads can be
+	// created.
+	Authorize AuthorizeFunc
+}
+
+// Uploads serves resumable uploads via the core and creation parts of the tus
+// protocol, along with termination. An upload is created with a POST, with its
+// name in the filename key of the Upload-Metadata header. The parts of the
+// upload are then sent via PATCH to the URL in the Location of the response,
+// and once every part has been sent, the upload is put in the FS.
+//
+// A part that fails to be received in full is discarded, and must be sent
+// again from the offset returned by a HEAD request.
+type Uploads struct {
+	cfg UploadConfig
+}
+
+var _ http.Handler = (*Uploads)(nil)
+
+// NewUploads returns a handler for resumable uploads. It is typically mounted
+// under a prefix with http.StripPrefix.
+func NewUploads(cfg UploadConfig) *Uploads {
+	if cfg.Store == nil {
+		cfg.Store = MemoryUploads()
+	}
+
+	return &Uploads{
+		cfg: cfg,
+	}
+}
+
+func newUploadID() (string, error) {
+	b := make([]byte, 16)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// parseMetadata parses the Upload-Metadata header, which is a comma separated
+// list of keys and base64 encoded values.
+func parseMetadata(s string) (map[string]string, error) {
+	md := make(map[string]string)
+
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+
+		if pair == "" {
+			continue
+		}
+
+		key, val, _ := strings.Cut(pair, " ")
+
+		b, err := base64.StdEncoding.DecodeString(val)
+
+		if err != nil {
+			return nil, err
+		}
+		md[key] = string(b)
+	}
+	return md, nil
+}
+
+func (h *Uploads) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+
+	if r.Method == http.MethodOptions {
+		w.Header().Set("Tus-Version", tusVersion)
+		w.Header().Set("Tus-Extension", "creation,termination")
+
+		if h.cfg.MaxSize > 0 {
+			w.Header().Set("Tus-Max-Size", strconv.FormatInt(h.cfg.MaxSize, 10))
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if v := r.Header.Get("Tus-Resumable"); v != tusVersion {
+		w.Header().Set("Tus-Version", tusVersion)
+		writeError(w, http.StatusPreconditionFailed)
+		return
+	}
+
+	id := strings.Trim(r.URL.Path, "/")
+
+	if id == "" {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", "OPTIONS, POST")
+			writeError(w, http.StatusMethodNotAllowed)
+			return
+		}
+		h.create(w, r)
+		return
+	}
+
+	if strings.Contains(id, "/") {
+		writeError(w, http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodHead:
+		h.head(w, r, id)
+	case http.MethodPatch:
+		h.patch(w, r, id)
+	case http.MethodDelete:
+		h.terminate(w, r, id)
+	default:
+		w.Header().Set("Allow", "OPTIONS, HEAD, PATCH, DELETE")
+		writeError(w, http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *Uploads) create(w http.ResponseWriter, r *http.Request) {
+	size, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+
+	if err != nil || size < 0 {
+		writeError(w, http.StatusBadRequest)
+		return
+	}
+
+	if h.cfg.MaxSize > 0 && size > h.cfg.MaxSize {
+		writeError(w, http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	md, err := parseMetadata(r.Header.Get("Upload-Metadata"))
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest)
+		return
+	}
+
+	name, ok := cleanName(md["filename"])
+
+	if !ok || name == "." {
+		writeError(w, http.StatusBadRequest)
+		return
+	}
+
+	if h.cfg.Authorize == nil {
+		writeError(w, http.StatusForbidden)
+		return
+	}
+
+	if err := h.cfg.Authorize(r, name, OpWrite); err != nil {
+		if errors.Is(err, ErrUnauthorized) {
+			writeError(w, http.StatusUnauthorized)
+			return
+		}
+		writeError(w, http.StatusForbidden)
+		return
+	}
+
+	id, err := newUploadID()
+
+	if err != nil {
+		writeError(w, http.StatusInternalServerError)
+		return
+	}
+
+	u := Upload{
+		ID:      id,
+		Name:    name,
+		Size:    size,
+		Created: time.Now(),
+	}
+
+	if err := h.cfg.Store.Create(r.Context(), u); err != nil {
+		writeError(w, statusCode(err))
+		return
+	}
+
+	// An empty upload is complete as soon as it is created.
+	if size == 0 {
+		if err := h.complete(r.Context(), u); err != nil {
+			writeError(w, statusCode(err))
+			return
+		}
+	}
+
+	// The request URI is used rather than the URL, since the handler is
+	// typically mounted beneath a stripped prefix.
+	base := r.URL.Path
+
+	if uri, err := url.ParseRequestURI(r.RequestURI); err == nil {
+		base = uri.Path
+	}
+
+	w.Header().Set("Location", path.Join(base, id))
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (h *Uploads) head(w http.ResponseWriter, r *http.Request, id string) {
+	u, err := h.cfg.Store.Get(r.Context(), id)
+
+	if err != nil {
+		writeError(w, statusCode(err))
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Upload-Offset", strconv.FormatInt(u.Offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(u.Size, 10))
+	w.WriteHeader(http.StatusOK)
+}
+
+// partName returns a unique name for a part of an upload at the given offset.
+// The name is unique so concurrent requests at the same offset each put their
+// own part, and the request that fails to advance the upload only removes its
+// own.
+func partName(offset int64) (string, error) {
+	b := make([]byte, 8)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return partPrefix(offset) + "-" + hex.EncodeToString(b), nil
+}
+
+// partOffset returns the offset of the part with the given name.
+func partOffset(name string) (int64, bool) {
+	i := strings.IndexByte(name, '-')
+
+	if i < 0 {
+		return 0, false
+	}
+
+	offset, err := strconv.ParseInt(name[:i], 10, 64)
+
+	if err != nil {
+		return 0, false
+	}
+	return offset, true
+}
+
+func (h *Uploads) patch(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		writeError(w, http.StatusUnsupportedMediaType)
+		return
+	}
+
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+
+	u, err := h.cfg.Store.Get(ctx, id)
+
+	if err != nil {
+		writeError(w, statusCode(err))
+		return
+	}
+
+	if offset != u.Offset {
+		writeError(w, http.StatusConflict)
+		return
+	}
+
+	parts, err := h.cfg.Parts.Sub(id)
+
+	if err != nil {
+		writeError(w, statusCode(err))
+		return
+	}
+
+	name, err := partName(offset)
+
+	if err != nil {
+		writeError(w, http.StatusInternalServerError)
+		return
+	}
+
+	// Read one byte more than remains, so a part that is too big is caught.
+	part, err := fs.ReadFile(name, io.LimitReader(r.Body, u.Size-offset+1))
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest)
+		return
+	}
+
+	defer fs.Cleanup(part)
+
+	info, err := part.Stat()
+
+	if err != nil {
+		writeError(w, http.StatusInternalServerError)
+		return
+	}
+
+	end := offset + info.Size()
+
+	if end > u.Size {
+		writeError(w, http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	stored, err := parts.Put(part)
+
+	if err != nil {
+		writeError(w, statusCode(err))
+		return
+	}
+	stored.Close()
+
+	if err := h.cfg.Store.Advance(ctx, id, offset, end); err != nil {
+		parts.Remove(name)
+
+		if errors.Is(err, ErrOffsetConflict) {
+			writeError(w, http.StatusConflict)
+			return
+		}
+		writeError(w, statusCode(err))
+		return
+	}
+
+	if end == u.Size {
+		u.Offset = end
+
+		if err := h.complete(ctx, u); err != nil {
+			writeError(w, statusCode(err))
+			return
+		}
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(end, 10))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// complete puts the parts of the upload in the FS, and then removes the parts
+// and the state of the upload.
+func (h *Uploads) complete(ctx context.Context, u Upload) error {
+	parts, err := h.cfg.Parts.Sub(u.ID)
+
+	if err != nil {
+		return err
+	}
+
+	names, err := committedParts(parts, u.Size)
+
+	if err != nil {
+		return err
+	}
+
+	files := make([]fs.File, 0, len(names))
+
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+
+	readers := make([]io.Reader, 0, len(names))
+
+	for _, name := range names {
+		f, err := parts.Open(name)
+
+		if err != nil {
+			return err
+		}
+
+		files = append(files, f)
+		readers = append(readers, f)
+	}
+
+	f, err := fs.ReadFile(path.Base(u.Name), io.MultiReader(readers...))
+
+	if err != nil {
+		return err
+	}
+
+	defer fs.Cleanup(f)
+
+	stored, err := fs.PutPath(h.cfg.FS, u.Name, f)
+
+	if err != nil {
+		return err
+	}
+	stored.Close()
+
+	h.removeParts(ctx, u.ID)
+	return nil
+}
+
+// committedParts returns the names of the parts that make up an upload of the
+// given size, in order. Each part starts where the one before it ended. Parts
+// left behind by requests that failed to advance the upload are skipped,
+// since they do not continue from the part before them.
+func committedParts(parts fs.FS, size int64) ([]string, error) {
+	ents, err := fs.ReadDir(parts, ".")
+
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	sort.Slice(ents, func(i, j int) bool {
+		return ents[i].Name() < ents[j].Name()
+	})
+
+	type part struct {
+		name string
+		size int64
+	}
+
+	byOffset := make(map[int64][]part)
+
+	for _, ent := range ents {
+		offset, ok := partOffset(ent.Name())
+
+		if !ok || ent.IsDir() {
+			continue
+		}
+
+		info, err := ent.Info()
+
+		if err != nil {
+			return nil, err
+		}
+
+		if info.Size() > 0 {
+			byOffset[offset] = append(byOffset[offset], part{name: ent.Name(), size: info.Size()})
+		}
+	}
+
+	names := make([]string, 0)
+
+	var offset int64
+
+	for offset < size {
+		var next *part
+
+		for _, p := range byOffset[offset] {
+			end := offset + p.size
+
+			if end == size || len(byOffset[end]) > 0 {
+				p := p
+				next = &p
+				break
+			}
+		}
+
+		if next == nil {
+			return nil, &fs.PathError{Op: "complete", Path: partPrefix(offset), Err: fs.ErrNotExist}
+		}
+
+		names = append(names, next.name)
+		offset += next.size
+	}
+	return names, nil
+}
+
+// partPrefix returns the prefix of the names of the parts at the given offset.
+func partPrefix(offset int64) string {
+	return fmt.Sprintf("%020d", offset)
+}
+
+// removeParts removes the parts and the state of the upload. Errors are
+// ignored, since the upload has either completed or been terminated.
+func (h *Uploads) removeParts(ctx context.Context, id string) {
+	if parts, err := h.cfg.Parts.Sub(id); err == nil {
+		if ents, err := fs.ReadDir(parts, "."); err == nil {
+			for _, ent := range ents {
+				parts.Remove(ent.Name())
+			}
+		}
+	}
+
+	h.cfg.Parts.Remove(id)
+	h.cfg.Store.Delete(ctx, id)
+}
+
+func (h *Uploads) terminate(w http.ResponseWriter, r *http.Request, id string) {
+	if _, err := h.cfg.Store.Get(r.Context(), id); err != nil {
+		writeError(w, statusCode(err))
+		return
+	}
+
+	h.removeParts(r.Context(), id)
+	w.WriteHeader(http.StatusNoContent)
+}
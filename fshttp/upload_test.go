@@ -0,0 +1,201 @@
+package fshttp
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/andrewpillar/fs"
+	"github.com/andrewpillar/fs/fakefs"
+)
+
+func tusRequest(method, target string, body io.Reader) *http.Request {
+	req := httptest.NewRequest(method, target, body)
+	req.Header.Set("Tus-Resumable", tusVersion)
+	return req
+}
+
+// staleUploads is an UploadStore that returns the state of an upload as it was
+// before it was advanced, as if the state was read by a request at the same
+// time as another request advanced it.
+type staleUploads struct {
+	UploadStore
+}
+
+func (s staleUploads) Get(ctx context.Context, id string) (Upload, error) {
+	u, err := s.UploadStore.Get(ctx, id)
+
+	if err != nil {
+		return u, err
+	}
+
+	u.Offset = 0
+	return u, nil
+}
+
+func Test_Uploads(t *testing.T) {
+	store := fakefs.New()
+	state := fakefs.New()
+
+	// Two instances that share the same parts and state, as if behind a load
+	// balancer.
+	cfg := UploadConfig{
+		FS:        store,
+		Parts:     fakefs.New(),
+		Store:     FSUploads(state),
+		Authorize: allowAll,
+	}
+
+	a := http.StripPrefix("/uploads", NewUploads(cfg))
+	b := http.StripPrefix("/uploads", NewUploads(cfg))
+
+	req := tusRequest("POST", "/uploads/", nil)
+	req.Header.Set("Upload-Length", "11")
+	req.Header.Set("Upload-Metadata", "filename "+base64.StdEncoding.EncodeToString([]byte("videos/clip.mp4")))
+
+	rec := httptest.NewRecorder()
+	a.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("unexpected status, expected=%d, got=%d\n", http.StatusCreated, rec.Code)
+	}
+
+	loc := rec.Header().Get("Location")
+
+	if !strings.HasPrefix(loc, "/uploads/") {
+		t.Fatalf("unexpected location %q\n", loc)
+	}
+
+	patch := func(h http.Handler, offset int, data string) *httptest.ResponseRecorder {
+		req := tusRequest("PATCH", loc, strings.NewReader(data))
+		req.Header.Set("Content-Type", "application/offset+octet-stream")
+		req.Header.Set("Upload-Offset", strconv.Itoa(offset))
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := patch(a, 0, "hello "); rec.Code != http.StatusNoContent {
+		t.Fatalf("unexpected status, expected=%d, got=%d\n", http.StatusNoContent, rec.Code)
+	}
+
+	if rec := patch(b, 0, "hello "); rec.Code != http.StatusConflict {
+		t.Fatalf("unexpected status, expected=%d, got=%d\n", http.StatusConflict, rec.Code)
+	}
+
+	// A request at the same offset that loses the race to advance the upload
+	// only removes its own part.
+	stale := cfg
+	stale.Store = staleUploads{UploadStore: cfg.Store}
+
+	c := http.StripPrefix("/uploads", NewUploads(stale))
+
+	if rec := patch(c, 0, "HELLO "); rec.Code != http.StatusConflict {
+		t.Fatalf("unexpected status, expected=%d, got=%d\n", http.StatusConflict, rec.Code)
+	}
+
+	// A part left behind by a request that never advanced the upload is not
+	// used.
+	parts, err := cfg.Parts.Sub(strings.TrimPrefix(loc, "/uploads/"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stray, err := fs.ReadFile("00000000000000000000-stray", strings.NewReader("HE"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := parts.Put(stray); err != nil {
+		t.Fatal(err)
+	}
+
+	rec = httptest.NewRecorder()
+	b.ServeHTTP(rec, tusRequest("HEAD", loc, nil))
+
+	if offset := rec.Header().Get("Upload-Offset"); offset != "6" {
+		t.Fatalf("unexpected offset, expected=%q, got=%q\n", "6", offset)
+	}
+
+	if rec := patch(b, 6, "world!"); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("unexpected status, expected=%d, got=%d\n", http.StatusRequestEntityTooLarge, rec.Code)
+	}
+
+	if rec := patch(b, 6, "world"); rec.Code != http.StatusNoContent {
+		t.Fatalf("unexpected status, expected=%d, got=%d\n", http.StatusNoContent, rec.Code)
+	}
+
+	sub, err := store.Sub("videos")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := sub.Open("clip.mp4")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	data, err := io.ReadAll(f)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data) != "hello world" {
+		t.Fatalf("unexpected data, expected=%q, got=%q\n", "hello world", string(data))
+	}
+
+	id := strings.TrimPrefix(loc, "/uploads/")
+
+	if _, err := cfg.Store.Get(context.Background(), id); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", fs.ErrNotExist, err)
+	}
+}
+
+func Test_MemoryUploads(t *testing.T) {
+	ctx := context.Background()
+	s := MemoryUploads()
+
+	if err := s.Create(ctx, Upload{ID: "1", Size: 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Advance(ctx, "1", 0, 5); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Advance(ctx, "1", 0, 5); !errors.Is(err, ErrOffsetConflict) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", ErrOffsetConflict, err)
+	}
+
+	u, err := s.Get(ctx, "1")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if u.Offset != 5 {
+		t.Fatalf("unexpected offset, expected=%d, got=%d\n", 5, u.Offset)
+	}
+
+	if err := s.Delete(ctx, "1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Get(ctx, "1"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", fs.ErrNotExist, err)
+	}
+}
@@ -0,0 +1,121 @@
+// Package fstest provides helpers for checking that an implementation of FS
+// behaves as the fs package expects, either against given inputs via Check, or
+// against generated inputs via Fuzz.
+package fstest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/andrewpillar/fs"
+)
+
+// ValidName reports whether the given name is one that an FS would be
+// expected to store a file under. Names that are empty, contain a path
+// separator or NUL byte, or refer to the current or parent directory, are not
+// valid.
+func ValidName(name string) bool {
+	if name == "" || name == "." || name == ".." || len(name) > 255 {
+		return false
+	}
+	return !strings.ContainsAny(name, "/\\\x00")
+}
+
+// Check puts a file with the given name and data into the given FS, and checks
+// that it can be stat'd and opened with the same content under the name it was
+// stored as, and that it no longer exists once removed. Wrappers may store the
+// file under a different name, so the name reported by the stored file is the
+// one that is checked.
+func Check(s fs.FS, name string, data []byte) error {
+	f, err := fs.ReadFile(name, bytes.NewReader(data))
+
+	if err != nil {
+		return err
+	}
+
+	defer fs.Cleanup(f)
+
+	stored, err := s.Put(f)
+
+	if err != nil {
+		return fmt.Errorf("put %q: %w", name, err)
+	}
+
+	info, err := stored.Stat()
+
+	stored.Close()
+
+	if err != nil {
+		return fmt.Errorf("stat put %q: %w", name, err)
+	}
+
+	name = info.Name()
+
+	if info.Size() != int64(len(data)) {
+		return fmt.Errorf("put %q: unexpected size, expected=%d, got=%d", name, len(data), info.Size())
+	}
+
+	info, err = s.Stat(name)
+
+	if err != nil {
+		return fmt.Errorf("stat %q: %w", name, err)
+	}
+
+	if info.Size() != int64(len(data)) {
+		return fmt.Errorf("stat %q: unexpected size, expected=%d, got=%d", name, len(data), info.Size())
+	}
+
+	opened, err := s.Open(name)
+
+	if err != nil {
+		return fmt.Errorf("open %q: %w", name, err)
+	}
+
+	b, err := io.ReadAll(opened)
+
+	opened.Close()
+
+	if err != nil {
+		return fmt.Errorf("read %q: %w", name, err)
+	}
+
+	if !bytes.Equal(b, data) {
+		return fmt.Errorf("read %q: unexpected content", name)
+	}
+
+	if err := s.Remove(name); err != nil {
+		return fmt.Errorf("remove %q: %w", name, err)
+	}
+
+	if _, err := s.Stat(name); !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("stat %q: expected %v after remove, got %v", name, fs.ErrNotExist, err)
+	}
+	return nil
+}
+
+// Fuzz runs Check against the given FS with names and data generated by the
+// fuzzer. Names that are not valid, as reported by ValidName, are skipped.
+// This would typically be called from a fuzz test for an FS implementation,
+//
+//	func Fuzz_FS(f *testing.F) {
+//		fstest.Fuzz(f, New(dir))
+//	}
+func Fuzz(f *testing.F, s fs.FS) {
+	f.Add("file", []byte("data"))
+	f.Add("file.txt", []byte{})
+	f.Add(".hidden", []byte("\x00\xff"))
+
+	f.Fuzz(func(t *testing.T, name string, data []byte) {
+		if !ValidName(name) {
+			t.Skip()
+		}
+
+		if err := Check(s, name, data); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
@@ -0,0 +1,43 @@
+package fstest
+
+import (
+	"crypto/sha256"
+	"os"
+	"testing"
+
+	"github.com/andrewpillar/fs"
+	"github.com/andrewpillar/fs/fakefs"
+)
+
+func Test_Check(t *testing.T) {
+	dir, err := os.MkdirTemp("", "fstest")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	stores := []fs.FS{
+		fs.New(dir),
+		fs.Hash(fs.New(dir), sha256.New),
+		fs.Unique(fs.Limit(fs.New(dir), 1<<20)),
+		fakefs.New(),
+	}
+
+	for i, store := range stores {
+		if err := Check(store, "file", []byte("data")); err != nil {
+			t.Fatalf("stores[%d] - %s\n", i, err)
+		}
+	}
+}
+
+func Test_CheckNull(t *testing.T) {
+	if err := Check(fs.Null(), "file", []byte("data")); err == nil {
+		t.Fatal("expected Null to fail the contract check")
+	}
+}
+
+func Fuzz_FakeFS(f *testing.F) {
+	Fuzz(f, fakefs.New())
+}
@@ -0,0 +1,167 @@
+package fs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"math"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func Fuzz_CleanPath(f *testing.F) {
+	for _, name := range []string{"", ".", "..", "a/b", "/a", "a/../b", "a\\b", "a//b/"} {
+		f.Add(name)
+	}
+
+	f.Fuzz(func(t *testing.T, name string) {
+		cleaned, err := cleanPath(name)
+
+		if err != nil {
+			return
+		}
+
+		if path.IsAbs(cleaned) {
+			t.Fatalf("expected relative path, got=%q\n", cleaned)
+		}
+
+		if strings.Contains(cleaned, "\\") {
+			t.Fatalf("expected no backslashes, got=%q\n", cleaned)
+		}
+
+		if cleaned != path.Clean(cleaned) {
+			t.Fatalf("expected clean path, got=%q\n", cleaned)
+		}
+
+		for _, part := range strings.Split(cleaned, "/") {
+			if part == ".." {
+				t.Fatalf("expected path to stay within root, got=%q\n", cleaned)
+			}
+		}
+
+		again, err := cleanPath(cleaned)
+
+		if err != nil || again != cleaned {
+			t.Fatalf("expected cleanPath to be idempotent, expected=%q, got=%q\n", cleaned, again)
+		}
+	})
+}
+
+func Fuzz_ReadFileMax(f *testing.F) {
+	f.Add([]byte("data"), int64(4))
+	f.Add([]byte("data"), int64(3))
+	f.Add([]byte(""), int64(0))
+	f.Add([]byte("data"), int64(math.MaxInt64))
+
+	f.Fuzz(func(t *testing.T, data []byte, maxMemory int64) {
+		got, err := ReadFileMax("file", bytes.NewReader(data), maxMemory)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer Cleanup(got)
+		defer got.Close()
+
+		info, err := got.Stat()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if info.Size() != int64(len(data)) {
+			t.Fatalf("unexpected size, expected=%d, got=%d\n", len(data), info.Size())
+		}
+
+		b, err := io.ReadAll(got)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(b, data) {
+			t.Fatalf("unexpected data, expected=%q, got=%q\n", data, b)
+		}
+
+		_, inMemory := got.(*file)
+
+		if maxMemory >= int64(len(data)) && !inMemory {
+			t.Fatalf("expected %d bytes to be held in memory with maxMemory=%d\n", len(data), maxMemory)
+		}
+	})
+}
+
+func Fuzz_Wrappers(f *testing.F) {
+	f.Add("file", []byte("data"), uint8(0))
+	f.Add("file.txt", []byte(""), uint8(0xff))
+
+	dir, err := os.MkdirTemp("", "fs-fuzz")
+
+	if err != nil {
+		f.Fatal(err)
+	}
+
+	f.Cleanup(func() { os.RemoveAll(dir) })
+
+	wrappers := []func(FS) FS{
+		func(s FS) FS { return Hash(s, sha256.New) },
+		Unique,
+		func(s FS) FS { return Limit(s, 1<<20) },
+		func(s FS) FS { return CacheStat(s, 0) },
+	}
+
+	f.Fuzz(func(t *testing.T, name string, data []byte, mask uint8) {
+		if name == "" || name == "." || name == ".." || strings.ContainsAny(name, "/\\\x00") || len(name) > 128 {
+			t.Skip()
+		}
+
+		var store FS = New(dir)
+
+		for i, wrap := range wrappers {
+			if mask&(1<<i) != 0 {
+				store = wrap(store)
+			}
+		}
+
+		file, err := ReadFile(name, bytes.NewReader(data))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		stored, err := store.Put(file)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		info, err := stored.Stat()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+		stored.Close()
+
+		defer store.Remove(info.Name())
+
+		opened, err := store.Open(info.Name())
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer opened.Close()
+
+		b, err := io.ReadAll(opened)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(b, data) {
+			t.Fatalf("unexpected data, expected=%q, got=%q\n", data, b)
+		}
+	})
+}
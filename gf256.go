@@ -0,0 +1,140 @@
+package fs
+
+import "errors"
+
+// Arithmetic over GF(2^8) with the polynomial x^8 + x^4 + x^3 + x^2 + 1, as
+// used for Reed-Solomon coding by Erasure.
+var (
+	gfExp [512]byte
+	gfLog [256]byte
+)
+
+func init() {
+	x := 1
+
+	for i := 0; i < 255; i++ {
+		gfExp[i] = byte(x)
+		gfLog[x] = byte(i)
+
+		x <<= 1
+
+		if x&0x100 != 0 {
+			x ^= 0x11d
+		}
+	}
+
+	// Doubled so the sum of two logs can index the table without a modulo.
+	for i := 255; i < 512; i++ {
+		gfExp[i] = gfExp[i-255]
+	}
+}
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+int(gfLog[b])]
+}
+
+func gfInv(a byte) byte {
+	return gfExp[255-int(gfLog[a])]
+}
+
+// gfMulAdd adds c times src to dst.
+func gfMulAdd(dst, src []byte, c byte) {
+	if c == 0 {
+		return
+	}
+
+	logc := int(gfLog[c])
+
+	for i, b := range src {
+		if b != 0 {
+			dst[i] ^= gfExp[logc+int(gfLog[b])]
+		}
+	}
+}
+
+// gfMatrix is a matrix over GF(2^8).
+type gfMatrix [][]byte
+
+func newGFMatrix(rows, cols int) gfMatrix {
+	m := make(gfMatrix, rows)
+
+	for i := range m {
+		m[i] = make([]byte, cols)
+	}
+	return m
+}
+
+// codingMatrix returns the systematic coding matrix for k data shards and m
+// parity shards. The first k rows are the identity, and the last m rows are a
+// Cauchy matrix, so any k rows of the matrix are invertible.
+func codingMatrix(k, m int) gfMatrix {
+	mat := newGFMatrix(k+m, k)
+
+	for i := 0; i < k; i++ {
+		mat[i][i] = 1
+	}
+
+	for r := 0; r < m; r++ {
+		for c := 0; c < k; c++ {
+			mat[k+r][c] = gfInv(byte(k+r) ^ byte(c))
+		}
+	}
+	return mat
+}
+
+var errSingular = errors.New("singular matrix")
+
+// invert returns the inverse of the square matrix via Gauss-Jordan
+// elimination.
+func (m gfMatrix) invert() (gfMatrix, error) {
+	n := len(m)
+
+	// Augment the matrix with the identity.
+	work := newGFMatrix(n, 2*n)
+
+	for i := range m {
+		copy(work[i], m[i])
+		work[i][n+i] = 1
+	}
+
+	for col := 0; col < n; col++ {
+		pivot := -1
+
+		for row := col; row < n; row++ {
+			if work[row][col] != 0 {
+				pivot = row
+				break
+			}
+		}
+
+		if pivot < 0 {
+			return nil, errSingular
+		}
+
+		work[col], work[pivot] = work[pivot], work[col]
+
+		if c := work[col][col]; c != 1 {
+			inv := gfInv(c)
+
+			for j := range work[col] {
+				work[col][j] = gfMul(work[col][j], inv)
+			}
+		}
+
+		for row := 0; row < n; row++ {
+			if row != col && work[row][col] != 0 {
+				gfMulAdd(work[row], work[col], work[row][col])
+			}
+		}
+	}
+
+	inv := newGFMatrix(n, n)
+
+	for i := range inv {
+		copy(inv[i], work[i][n:])
+	}
+	return inv, nil
+}
@@ -0,0 +1,193 @@
+// Package golden provides a helper for golden file tests, where the expected
+// output of a test is stored in an FS and compared against the actual output.
+// Since the golden files are stored in an FS, they can be kept in any of the
+// backends supported by the fs package.
+//
+// Golden files are written, rather than compared, when the tests are run with
+// the -golden.update flag.
+package golden
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"strings"
+	"testing"
+
+	"github.com/andrewpillar/fs"
+)
+
+var update = flag.Bool("golden.update", false, "update golden files instead of comparing against them")
+
+// Golden stores and compares golden files in an FS.
+type Golden struct {
+	fs     fs.FS
+	update bool
+}
+
+// Option configures a Golden.
+type Option func(*Golden)
+
+// Update configures whether golden files should be updated with the actual
+// output rather than compared against it. By default this is the value of
+// the -golden.update flag.
+func Update(b bool) Option {
+	return func(g *Golden) {
+		g.update = b
+	}
+}
+
+// New returns a Golden that stores its golden files in the given FS.
+func New(s fs.FS, opts ...Option) *Golden {
+	g := &Golden{
+		fs:     s,
+		update: *update,
+	}
+
+	for _, opt := range opts {
+		opt(g)
+	}
+	return g
+}
+
+func (g *Golden) put(t testing.TB, name string, b []byte) {
+	t.Helper()
+
+	f, err := fs.ReadFile(name, bytes.NewReader(b))
+
+	if err != nil {
+		t.Fatalf("golden: %s\n", err)
+		return
+	}
+
+	stored, err := fs.PutPath(g.fs, name, f)
+
+	if err != nil {
+		t.Fatalf("golden: %s\n", err)
+		return
+	}
+	stored.Close()
+}
+
+func (g *Golden) read(name string) ([]byte, error) {
+	f, err := g.fs.Open(name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	var buf bytes.Buffer
+
+	if _, err := buf.ReadFrom(f); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Assert compares the given output against the golden file of the given name,
+// and fails the test with a diff if they differ. If the Golden is configured to
+// update, then the golden file is written with the given output instead.
+func (g *Golden) Assert(t testing.TB, name string, got []byte) {
+	t.Helper()
+
+	if g.update {
+		g.put(t, name, got)
+		return
+	}
+
+	want, err := g.read(name)
+
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			t.Fatalf("golden: %s does not exist, run with -golden.update to create it\n", name)
+			return
+		}
+		t.Fatalf("golden: %s\n", err)
+		return
+	}
+
+	if !bytes.Equal(want, got) {
+		t.Errorf("golden: %s does not match\n%s", name, Diff(want, got))
+	}
+}
+
+func lines(b []byte) []string {
+	if len(b) == 0 {
+		return nil
+	}
+
+	ll := strings.SplitAfter(string(b), "\n")
+
+	if ll[len(ll)-1] == "" {
+		ll = ll[:len(ll)-1]
+	}
+	return ll
+}
+
+// Diff returns a line based diff between want and got. Lines only in want are
+// prefixed with "-", lines only in got with "+", and common lines with " ".
+func Diff(want, got []byte) string {
+	a := lines(want)
+	b := lines(got)
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and
+	// b[j:].
+	lcs := make([][]int, len(a)+1)
+
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+				continue
+			}
+
+			lcs[i][j] = lcs[i+1][j]
+
+			if lcs[i][j+1] > lcs[i][j] {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var buf strings.Builder
+
+	line := func(prefix, s string) {
+		buf.WriteString(prefix)
+		buf.WriteString(s)
+
+		if !strings.HasSuffix(s, "\n") {
+			buf.WriteString("\n")
+		}
+	}
+
+	i, j := 0, 0
+
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			line(" ", a[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			line("-", a[i])
+			i++
+		default:
+			line("+", b[j])
+			j++
+		}
+	}
+
+	for ; i < len(a); i++ {
+		line("-", a[i])
+	}
+	for ; j < len(b); j++ {
+		line("+", b[j])
+	}
+	return buf.String()
+}
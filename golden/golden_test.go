@@ -0,0 +1,75 @@
+package golden
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/andrewpillar/fs/fakefs"
+)
+
+// recorder records the failures of a test without stopping it.
+type recorder struct {
+	testing.TB
+
+	errors []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...any) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func (r *recorder) Fatalf(format string, args ...any) {
+	r.Errorf(format, args...)
+}
+
+func Test_Assert(t *testing.T) {
+	store := fakefs.New()
+
+	r := &recorder{TB: t}
+
+	New(store).Assert(r, "testdata/out.golden", []byte("hello\n"))
+
+	if len(r.errors) != 1 {
+		t.Fatalf("expected missing golden file to fail, got %d errors\n", len(r.errors))
+	}
+
+	New(store, Update(true)).Assert(t, "testdata/out.golden", []byte("hello\n"))
+
+	r = &recorder{TB: t}
+
+	New(store).Assert(r, "testdata/out.golden", []byte("hello\n"))
+
+	if len(r.errors) != 0 {
+		t.Fatalf("unexpected errors %v\n", r.errors)
+	}
+
+	New(store).Assert(r, "testdata/out.golden", []byte("world\n"))
+
+	if len(r.errors) != 1 {
+		t.Fatalf("expected mismatch to fail, got %d errors\n", len(r.errors))
+	}
+}
+
+func Test_Diff(t *testing.T) {
+	tests := []struct {
+		want     string
+		got      string
+		expected string
+	}{
+		{"a\nb\nc\n", "a\nb\nc\n", " a\n b\n c\n"},
+		{"a\nb\nc\n", "a\nc\n", " a\n-b\n c\n"},
+		{"a\nc\n", "a\nb\nc\n", " a\n+b\n c\n"},
+		{"a\nb", "a\nc", " a\n-b\n+c\n"},
+		{"", "a\n", "+a\n"},
+	}
+
+	for i, test := range tests {
+		diff := Diff([]byte(test.want), []byte(test.got))
+
+		if diff != test.expected {
+			t.Fatalf("tests[%d] - unexpected diff, expected=%q, got=%q\n", i, test.expected, diff)
+		}
+	}
+}
@@ -0,0 +1,362 @@
+// Package goproxy stores Go modules in an FS in the layout of the GOPROXY
+// protocol.
+//
+// Each version of a module is stored as the files the go command requests
+// from a module proxy, for example,
+//
+//	golang.org/x/text/@v/list
+//	golang.org/x/text/@v/v0.3.0.info
+//	golang.org/x/text/@v/v0.3.0.mod
+//	golang.org/x/text/@v/v0.3.0.zip
+//	golang.org/x/text/@latest
+//
+// so the FS can be served as a module proxy by serving its files over HTTP,
+// for example,
+//
+//	proxy := goproxy.New(store)
+//
+//	if err := proxy.Put("example.com/lib", "v1.2.0", tagged, modfile, zip); err != nil {
+//		return err
+//	}
+//
+//	http.Handle("/", fshttp.New(store))
+package goproxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/andrewpillar/fs"
+)
+
+// Info is the metadata of a version of a module, stored in its .info file.
+type Info struct {
+	Version string
+	Time    time.Time
+}
+
+// Proxy stores modules in an FS.
+type Proxy struct {
+	fs fs.FS
+
+	// mu guards the list and latest files, which are rewritten each time a
+	// version is put.
+	mu sync.Mutex
+}
+
+// New returns a Proxy that stores modules in the given FS.
+func New(s fs.FS) *Proxy {
+	return &Proxy{
+		fs: s,
+	}
+}
+
+// Escape returns the module path or version escaped as it is in the file names
+// of a module proxy. Each upper case letter is replaced with an exclamation
+// mark followed by the lower case letter, so paths that differ only in case do
+// not collide on case insensitive filesystems.
+func Escape(s string) string {
+	var b strings.Builder
+
+	for _, r := range s {
+		if 'A' <= r && r <= 'Z' {
+			b.WriteByte('!')
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// checkPath checks that the module path is a valid path to store files under.
+func checkPath(mod string) error {
+	if mod == "" || mod == "." || strings.Contains(mod, "!") || strings.Contains(mod, "@") || !fs.ValidPath(mod) {
+		return fs.ErrInvalid
+	}
+	return nil
+}
+
+var pseudoVersion = regexp.MustCompile(`(^|\.)\d{14}-[0-9a-f]{12}$`)
+
+// isPseudo reports whether the version is a pseudo-version, such as
+// v0.0.0-20191109021931-daa7c04131f5, which are not listed.
+func isPseudo(v string) bool {
+	_, pre, _ := parseSemver(v)
+	return pseudoVersion.MatchString(pre)
+}
+
+// parseSemver splits the given version into its major, minor and patch
+// numbers, and its prerelease. Build metadata is dropped.
+func parseSemver(v string) ([3]int, string, bool) {
+	var nums [3]int
+
+	if !strings.HasPrefix(v, "v") {
+		return nums, "", false
+	}
+
+	v, _, _ = strings.Cut(v[1:], "+")
+	v, pre, hasPre := strings.Cut(v, "-")
+
+	if hasPre && pre == "" {
+		return nums, "", false
+	}
+
+	parts := strings.Split(v, ".")
+
+	if len(parts) != 3 {
+		return nums, "", false
+	}
+
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+
+		if err != nil || n < 0 || (len(part) > 1 && part[0] == '0') {
+			return nums, "", false
+		}
+		nums[i] = n
+	}
+	return nums, pre, true
+}
+
+// compareSemver compares the given versions by semantic version precedence,
+// returning -1, 0, or 1. Both versions must be valid.
+func compareSemver(a, b string) int {
+	anums, apre, _ := parseSemver(a)
+	bnums, bpre, _ := parseSemver(b)
+
+	for i := range anums {
+		if anums[i] != bnums[i] {
+			if anums[i] < bnums[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	// A release has a higher precedence than any of its prereleases.
+	switch {
+	case apre == bpre:
+		return 0
+	case apre == "":
+		return 1
+	case bpre == "":
+		return -1
+	}
+
+	aids := strings.Split(apre, ".")
+	bids := strings.Split(bpre, ".")
+
+	for i := 0; i < len(aids) && i < len(bids); i++ {
+		if c := compareIdent(aids[i], bids[i]); c != 0 {
+			return c
+		}
+	}
+
+	switch {
+	case len(aids) < len(bids):
+		return -1
+	case len(aids) > len(bids):
+		return 1
+	}
+	return 0
+}
+
+// compareIdent compares two prerelease identifiers. Numeric identifiers are
+// compared numerically, and have a lower precedence than alphanumeric ones.
+func compareIdent(a, b string) int {
+	an, aerr := strconv.Atoi(a)
+	bn, berr := strconv.Atoi(b)
+
+	switch {
+	case aerr == nil && berr == nil:
+		if an == bn {
+			return 0
+		}
+		if an < bn {
+			return -1
+		}
+		return 1
+	case aerr == nil:
+		return -1
+	case berr == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+type metadataFile struct {
+	fs.File
+
+	md fs.Metadata
+}
+
+func (f *metadataFile) Metadata() fs.Metadata { return f.md }
+
+// put puts the content read from r into the FS under the given name, with the
+// given content type set as metadata.
+func (p *Proxy) put(name, ctype string, r io.Reader) error {
+	f, err := fs.ReadFile(path.Base(name), r)
+
+	if err != nil {
+		return &fs.PathError{Op: "goproxy", Path: name, Err: err}
+	}
+
+	defer fs.Cleanup(f)
+
+	s, err := p.fs.Sub(path.Dir(name))
+
+	if err != nil {
+		return err
+	}
+
+	stored, err := fs.PutMetadata(s, &metadataFile{
+		File: f,
+		md:   fs.Metadata{fs.MetadataContentType: ctype},
+	})
+
+	if err != nil {
+		return err
+	}
+	return stored.Close()
+}
+
+// List returns the versions of the given module that have been put, in
+// ascending order. Pseudo-versions are not listed.
+func (p *Proxy) List(mod string) ([]string, error) {
+	if err := checkPath(mod); err != nil {
+		return nil, &fs.PathError{Op: "goproxy", Path: mod, Err: err}
+	}
+
+	b, err := readAll(p.fs, Escape(mod)+"/@v/list")
+
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return strings.Fields(string(b)), nil
+}
+
+func readAll(s fs.FS, name string) ([]byte, error) {
+	f, err := s.Open(name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	return io.ReadAll(f)
+}
+
+// Put puts the given version of a module into the FS, along with the time it
+// was created, and the contents of its go.mod file and module zip. The zip is
+// not checked, and should be created as the go command expects, such as with
+// golang.org/x/mod/zip. The list of versions, and the latest version of the
+// module, are updated once the files of the version have been put, so the
+// version is not advertised before it can be downloaded.
+func (p *Proxy) Put(mod, version string, t time.Time, modfile []byte, zip io.Reader) error {
+	if err := checkPath(mod); err != nil {
+		return &fs.PathError{Op: "goproxy", Path: mod, Err: err}
+	}
+
+	if _, _, ok := parseSemver(version); !ok {
+		return &fs.PathError{Op: "goproxy", Path: mod + "@" + version, Err: fs.ErrInvalid}
+	}
+
+	prefix := Escape(mod) + "/@v/" + Escape(version)
+
+	if err := p.put(prefix+".zip", "application/zip", zip); err != nil {
+		return err
+	}
+
+	if err := p.put(prefix+".mod", "text/plain; charset=utf-8", bytes.NewReader(modfile)); err != nil {
+		return err
+	}
+
+	info, err := json.Marshal(Info{
+		Version: version,
+		Time:    t.UTC(),
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if err := p.put(prefix+".info", "application/json", bytes.NewReader(info)); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.advertise(mod, version, info)
+}
+
+// advertise adds the version to the list of versions of the module, and
+// updates the latest version of the module if the version is the latest. This
+// should be called with the mutex held.
+func (p *Proxy) advertise(mod, version string, info []byte) error {
+	list, err := p.List(mod)
+
+	if err != nil {
+		return err
+	}
+
+	if !isPseudo(version) {
+		i := sort.Search(len(list), func(i int) bool {
+			return compareSemver(list[i], version) >= 0
+		})
+
+		if i == len(list) || list[i] != version {
+			list = append(list, "")
+			copy(list[i+1:], list[i:])
+			list[i] = version
+
+			content := strings.Join(list, "\n") + "\n"
+
+			if err := p.put(Escape(mod)+"/@v/list", "text/plain; charset=utf-8", strings.NewReader(content)); err != nil {
+				return err
+			}
+		}
+	}
+
+	// The go command only requests the latest version when no versions are
+	// listed, so it is the highest listed version if there is one, otherwise
+	// the highest pseudo-version.
+	latest := version
+
+	if len(list) > 0 {
+		latest = list[len(list)-1]
+	} else {
+		b, err := readAll(p.fs, Escape(mod)+"/@latest")
+
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+
+		var cur Info
+
+		if err == nil && json.Unmarshal(b, &cur) == nil {
+			if _, _, ok := parseSemver(cur.Version); ok && compareSemver(cur.Version, version) > 0 {
+				latest = cur.Version
+			}
+		}
+	}
+
+	if latest != version {
+		return nil
+	}
+	return p.put(Escape(mod)+"/@latest", "application/json", bytes.NewReader(info))
+}
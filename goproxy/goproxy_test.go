@@ -0,0 +1,119 @@
+package goproxy
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andrewpillar/fs/fakefs"
+	"github.com/andrewpillar/fs/fshttp"
+)
+
+func Test_Escape(t *testing.T) {
+	tests := []struct {
+		in       string
+		expected string
+	}{
+		{"golang.org/x/text", "golang.org/x/text"},
+		{"github.com/Azure/azure-sdk", "github.com/!azure/azure-sdk"},
+		{"v1.0.0-RC1", "v1.0.0-!r!c1"},
+	}
+
+	for i, test := range tests {
+		if escaped := Escape(test.in); escaped != test.expected {
+			t.Fatalf("tests[%d] - unexpected escape, expected=%q, got=%q\n", i, test.expected, escaped)
+		}
+	}
+}
+
+func Test_CompareSemver(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{"v1.2.0", "v1.10.0", -1},
+		{"v1.0.0", "v1.0.0-rc.1", 1},
+		{"v1.0.0-rc.2", "v1.0.0-rc.10", -1},
+		{"v1.0.0-alpha", "v1.0.0-1", 1},
+		{"v2.0.0+incompatible", "v2.0.0", 0},
+	}
+
+	for i, test := range tests {
+		if c := compareSemver(test.a, test.b); c != test.expected {
+			t.Fatalf("tests[%d] - unexpected comparison, expected=%d, got=%d\n", i, test.expected, c)
+		}
+	}
+}
+
+func get(t *testing.T, h http.Handler, target string) (int, string) {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+
+	b, err := io.ReadAll(rec.Result().Body)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rec.Code, string(b)
+}
+
+func Test_Proxy(t *testing.T) {
+	store := fakefs.New()
+	p := New(store)
+
+	tm := time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)
+	mod := "example.com/Lib"
+
+	pseudo := "v0.0.0-20060102150405-abcdefabcdef"
+
+	for _, v := range []string{pseudo, "v1.10.0", "v1.2.0", "v1.2.0"} {
+		if err := p.Put(mod, v, tm, []byte("module "+mod+"\n"), strings.NewReader("zip "+v)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := p.Put(mod, "1.0", tm, nil, strings.NewReader("")); err == nil {
+		t.Fatalf("expected error for invalid version\n")
+	}
+
+	list, err := p.List(mod)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := []string{"v1.2.0", "v1.10.0"}; !reflect.DeepEqual(list, expected) {
+		t.Fatalf("unexpected list, expected=%v, got=%v\n", expected, list)
+	}
+
+	h := fshttp.New(store)
+
+	code, body := get(t, h, "/example.com/!lib/@v/list")
+
+	if code != http.StatusOK || body != "v1.2.0\nv1.10.0\n" {
+		t.Fatalf("unexpected list, expected=%q, got=%d %q\n", "v1.2.0\nv1.10.0\n", code, body)
+	}
+
+	code, body = get(t, h, "/example.com/!lib/@v/"+pseudo+".zip")
+
+	if code != http.StatusOK || body != "zip "+pseudo {
+		t.Fatalf("unexpected zip, expected=%q, got=%d %q\n", "zip "+pseudo, code, body)
+	}
+
+	_, body = get(t, h, "/example.com/!lib/@latest")
+
+	var info Info
+
+	if err := json.Unmarshal([]byte(body), &info); err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Version != "v1.10.0" || !info.Time.Equal(tm) {
+		t.Fatalf("unexpected latest, expected=%q, got=%q\n", "v1.10.0", info.Version)
+	}
+}
@@ -0,0 +1,96 @@
+package fs
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"hash"
+	"strings"
+)
+
+// HashOption configures the filesystem returned from Hash.
+type HashOption func(*hashFS)
+
+var base32Encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// HexEncoding encodes a hash sum as lowercase hex. This is the default
+// encoding used by Hash.
+func HexEncoding(sum []byte) string {
+	return hex.EncodeToString(sum)
+}
+
+// Base32Encoding encodes a hash sum as lowercase, unpadded base32. This is
+// shorter than hex, and safe for case-insensitive filesystems.
+func Base32Encoding(sum []byte) string {
+	return strings.ToLower(base32Encoding.EncodeToString(sum))
+}
+
+// Base64URLEncoding encodes a hash sum as unpadded, URL safe base64. This is
+// the shortest of the encodings, but is not safe for case-insensitive
+// filesystems.
+func Base64URLEncoding(sum []byte) string {
+	return base64.RawURLEncoding.EncodeToString(sum)
+}
+
+// HashEncoding sets the function used to encode the hash sum of a file into
+// the name it is stored under, such as HexEncoding, Base32Encoding, or
+// Base64URLEncoding.
+func HashEncoding(encode func([]byte) string) HashOption {
+	return func(s *hashFS) {
+		s.encode = encode
+	}
+}
+
+// HashTruncate truncates the encoded hash sum to at most n characters. This
+// shortens the names files are stored under, at the cost of a greater chance
+// of collision.
+func HashTruncate(n int) HashOption {
+	return func(s *hashFS) {
+		s.truncate = n
+	}
+}
+
+// HashPrefix sets the prefix prepended to the encoded hash sum, such as the
+// name of the algorithm, "sha256:", to match the digests used by OCI.
+func HashPrefix(prefix string) HashOption {
+	return func(s *hashFS) {
+		s.prefix = prefix
+	}
+}
+
+// HMAC returns a hashing mechanism for Hash that computes the HMAC of a file
+// with the given hashing mechanism and key. Since the key is needed to compute
+// the name a file is stored under, the names cannot be precomputed by those
+// putting the files.
+func HMAC(mech func() hash.Hash, key []byte) func() hash.Hash {
+	key = append([]byte(nil), key...)
+
+	return func() hash.Hash {
+		return hmac.New(mech, key)
+	}
+}
+
+// HMACSHA256 returns a hashing mechanism for Hash that computes the
+// HMAC-SHA256 of a file with the given key.
+func HMACSHA256(key []byte) func() hash.Hash {
+	return HMAC(sha256.New, key)
+}
+
+// Keyed returns a hashing mechanism for Hash from a constructor that takes a
+// key, such as blake2b.New256. The constructor is called once with the given
+// key to check it is valid, any error it returns is returned.
+func Keyed(fn func(key []byte) (hash.Hash, error), key []byte) (func() hash.Hash, error) {
+	key = append([]byte(nil), key...)
+
+	if _, err := fn(key); err != nil {
+		return nil, err
+	}
+
+	return func() hash.Hash {
+		// The key has already been checked, so the constructor cannot fail.
+		h, _ := fn(key)
+		return h
+	}, nil
+}
@@ -0,0 +1,280 @@
+package fs
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_HashOptions(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	data := []byte("hello world\n")
+
+	// sha256 of "hello world\n".
+	sum := "a948904f2f0f479b8f8197694b30184b0d2ed1c1cd2a1ec0fb85d299a192a447"
+
+	tests := []struct {
+		opts     []HashOption
+		expected string
+	}{
+		{nil, sum},
+		{[]HashOption{HashPrefix("sha256:")}, "sha256:" + sum},
+		{[]HashOption{HashTruncate(12)}, sum[:12]},
+		{[]HashOption{HashTruncate(12), HashPrefix("sha256-")}, "sha256-" + sum[:12]},
+		{[]HashOption{HashEncoding(Base32Encoding)}, "vfejatzpb5dzxd4bs5uuwmayjmgs5uobzuvb5qh3qxjjtimsurdq"},
+		{[]HashOption{HashEncoding(Base64URLEncoding)}, "qUiQTy8PR5uPgZdpSzAYSw0u0cHNKh7A-4XSmaGSpEc"},
+	}
+
+	for i, test := range tests {
+		store := Hash(New(dir), sha256.New, test.opts...)
+
+		f, err := ReadFile("file", bytes.NewReader(data))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		stored, err := store.Put(f)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		info, err := stored.Stat()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+		stored.Close()
+
+		if name := info.Name(); name != test.expected {
+			t.Fatalf("tests[%d] - unexpected name, expected=%q, got=%q\n", i, test.expected, name)
+		}
+
+		if _, err := os.Stat(filepath.Join(dir, test.expected)); err != nil {
+			t.Fatalf("tests[%d] - %s\n", i, err)
+		}
+	}
+}
+
+func Test_HashHMAC(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	data := []byte("hello world\n")
+	key := []byte("secret")
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+
+	expected := hex.EncodeToString(mac.Sum(nil))
+
+	store := Hash(New(dir), HMACSHA256(key))
+
+	f, err := ReadFile("file", bytes.NewReader(data))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := store.Put(f)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer stored.Close()
+
+	info, err := stored.Stat()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if name := info.Name(); name != expected {
+		t.Fatalf("unexpected name, expected=%q, got=%q\n", expected, name)
+	}
+}
+
+func Test_Keyed(t *testing.T) {
+	errKey := errors.New("invalid key")
+
+	fn := func(key []byte) (hash.Hash, error) {
+		if len(key) == 0 {
+			return nil, errKey
+		}
+		return hmac.New(sha256.New, key), nil
+	}
+
+	if _, err := Keyed(fn, nil); !errors.Is(err, errKey) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", errKey, err)
+	}
+
+	mech, err := Keyed(fn, []byte("secret"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := mech().Sum(nil)
+	b := HMACSHA256([]byte("secret"))().Sum(nil)
+
+	if !bytes.Equal(a, b) {
+		t.Fatal("expected keyed hash to match HMAC-SHA256")
+	}
+}
+
+func Test_HashLink(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	store := Hash(New(dir), sha256.New, HashLink(".objects"))
+
+	for _, name := range []string{"a", "b", "a"} {
+		f, err := ReadFile(name, bytes.NewReader([]byte("data")))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		stored, err := store.Put(f)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		info, err := stored.Stat()
+
+		stored.Close()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if info.Name() != name {
+			t.Fatalf("unexpected name, expected=%q, got=%q\n", name, info.Name())
+		}
+	}
+
+	ents, err := os.ReadDir(filepath.Join(dir, ".objects"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ents) != 1 {
+		t.Fatalf("unexpected objects, expected=%d, got=%d\n", 1, len(ents))
+	}
+
+	a, err := os.Stat(filepath.Join(dir, "a"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.Stat(filepath.Join(dir, "b"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !os.SameFile(a, b) {
+		t.Fatal("expected files with identical content to be linked")
+	}
+
+	f, err := ReadFile("c", bytes.NewReader([]byte("data")))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Hash(Null(), sha256.New, HashLink(".objects")).Put(f); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", ErrUnsupported, err)
+	}
+}
+
+func Test_HashLinkReplace(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	store := Hash(New(dir), sha256.New, HashLink(".objects"))
+
+	for _, name := range []string{"a", "b"} {
+		f, err := ReadFile(name, bytes.NewReader([]byte("data")))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		stored, err := store.Put(f)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+		stored.Close()
+	}
+
+	f, err := ReadFile("a", bytes.NewReader([]byte("changed")))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := New(dir).Put(f)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored.Close()
+
+	for name, expected := range map[string]string{"a": "changed", "b": "data"} {
+		b, err := os.ReadFile(filepath.Join(dir, name))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(b) != expected {
+			t.Fatalf("unexpected content for %s, expected=%q, got=%q\n", name, expected, string(b))
+		}
+	}
+}
+
+func Test_HashNull(t *testing.T) {
+	buf := generateData(t, 4096)
+	sum := sha256.Sum256(buf)
+
+	f, err := ReadFile(t.Name(), bytes.NewReader(buf))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer Cleanup(f)
+
+	stored, err := Hash(Null(), sha256.New).Put(f)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := stored.Stat()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := hex.EncodeToString(sum[:])
+
+	if info.Name() != expected {
+		t.Fatalf("unexpected name, expected=%q, got=%q\n", expected, info.Name())
+	}
+}
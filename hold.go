@@ -0,0 +1,116 @@
+package fs
+
+import "errors"
+
+// MetadataHold is the metadata key for the legal hold of a file. A file with a
+// non-empty value under this key is held, the value would typically be the
+// reason for the hold, such as a case number.
+const MetadataHold = "hold"
+
+// ErrHeld is the error returned when removing or replacing a file that is
+// under a legal hold.
+var ErrHeld = errors.New("file under legal hold")
+
+type holdFS struct {
+	FS
+}
+
+// Hold returns a filesystem that refuses to remove, rename, or replace a file
+// while it is under a legal hold, returning ErrHeld in a *PathError instead.
+// A hold is placed on a file by setting MetadataHold via SetMetadata, and is
+// cleared by setting it to an empty value. The filesystem must implement
+// MetadataFS, otherwise no file can be held.
+func Hold(s FS) FS {
+	hs := &holdFS{
+		FS: s,
+	}
+
+	if canRename(s) {
+		return renameHoldFS{holdFS: hs}
+	}
+	return hs
+}
+
+// renameHoldFS is a holdFS over a filesystem that implements RenameFS.
+type renameHoldFS struct {
+	*holdFS
+}
+
+func (s *holdFS) Unwrap() FS { return s.FS }
+
+func (s *holdFS) Sub(dir string) (FS, error) {
+	sub, err := s.FS.Sub(dir)
+
+	if err != nil {
+		return nil, err
+	}
+	return Hold(sub), nil
+}
+
+// checkHold returns ErrHeld in a *PathError if the named file is under a
+// hold.
+func (s *holdFS) checkHold(op, name string) error {
+	md, err := GetMetadata(s.FS, name)
+
+	if err != nil {
+		if errors.Is(err, ErrNotExist) || errors.Is(err, ErrUnsupported) {
+			return nil
+		}
+		return err
+	}
+
+	if md[MetadataHold] != "" {
+		return &PathError{Op: op, Path: name, Err: ErrHeld}
+	}
+	return nil
+}
+
+func (s *holdFS) Put(f File) (File, error) {
+	info, err := f.Stat()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.checkHold("put", info.Name()); err != nil {
+		return nil, err
+	}
+	return s.FS.Put(f)
+}
+
+func (s *holdFS) ReadDir(name string) ([]DirEntry, error) {
+	return ReadDir(s.FS, name)
+}
+
+func (s renameHoldFS) Rename(oldname, newname string) error {
+	if err := s.checkHold("rename", oldname); err != nil {
+		return err
+	}
+
+	if err := s.checkHold("rename", newname); err != nil {
+		return err
+	}
+	return Move(s.FS, oldname, newname)
+}
+
+func (s *holdFS) Link(oldname, newname string) error {
+	if err := s.checkHold("link", newname); err != nil {
+		return err
+	}
+	return Link(s.FS, oldname, newname)
+}
+
+func (s *holdFS) Metadata(name string) (Metadata, error) {
+	return GetMetadata(s.FS, name)
+}
+
+func (s *holdFS) SetMetadata(name string, md Metadata) error {
+	return SetMetadata(s.FS, name, md)
+}
+
+func (s *holdFS) Remove(name string) error {
+	if err := s.checkHold("remove", name); err != nil {
+		return err
+	}
+	return s.FS.Remove(name)
+}
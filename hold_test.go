@@ -0,0 +1,65 @@
+package fs
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+)
+
+func Test_Hold(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	store := Hold(New(dir))
+
+	put := func(name, data string) error {
+		f, err := ReadFile(name, bytes.NewReader([]byte(data)))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		stored, err := store.Put(f)
+
+		if err != nil {
+			return err
+		}
+		return stored.Close()
+	}
+
+	if err := put("ledger.csv", "v1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SetMetadata(store, "ledger.csv", Metadata{MetadataHold: "case-1234"}); err != nil {
+		if errors.Is(err, ErrUnsupported) {
+			t.Skip("extended attributes are not supported")
+		}
+		t.Fatal(err)
+	}
+
+	if err := store.Remove("ledger.csv"); !errors.Is(err, ErrHeld) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", ErrHeld, err)
+	}
+
+	if err := put("ledger.csv", "v2"); !errors.Is(err, ErrHeld) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", ErrHeld, err)
+	}
+
+	if err := Move(store, "ledger.csv", "other.csv"); !errors.Is(err, ErrHeld) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", ErrHeld, err)
+	}
+
+	if b := readAll(t, store, "ledger.csv"); string(b) != "v1" {
+		t.Fatalf("unexpected data, expected=%q, got=%q\n", "v1", string(b))
+	}
+
+	if err := SetMetadata(store, "ledger.csv", Metadata{MetadataHold: ""}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Remove("ledger.csv"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,185 @@
+// Package httpcache stores the responses cached by HTTP caching middleware in
+// an FS.
+//
+// The Cache has the same method set as the Cache interface used by HTTP
+// caching transports, such as github.com/gregjones/httpcache, where each
+// response is stored as its wire format, headers and body, under a key
+// derived from the request. This lets the cache persist into any FS, for
+// example,
+//
+//	c := httpcache.New(store, httpcache.OnError(func(key string, err error) {
+//		log.Println("httpcache:", key, err)
+//	}))
+//
+// Each key is hashed to name the file it is stored in, so keys may be any
+// string, such as the URL of the request.
+package httpcache
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/andrewpillar/fs"
+)
+
+// Cache stores responses in an FS.
+type Cache struct {
+	fs      fs.FS
+	onError func(key string, err error)
+}
+
+// Option configures a Cache.
+type Option func(*Cache)
+
+// OnError sets the function called with the errors that occur when a response
+// is got, set, or deleted. The methods of the Cache interface have no error to
+// return, so these would otherwise be dropped.
+func OnError(fn func(key string, err error)) Option {
+	return func(c *Cache) {
+		c.onError = fn
+	}
+}
+
+// New returns a Cache that stores responses in the given FS.
+func New(s fs.FS, opts ...Option) *Cache {
+	c := &Cache{
+		fs:      s,
+		onError: func(string, error) {},
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Key returns the key for the given request. This is the method of the request
+// followed by its URL, with the method omitted for GET requests, as these are
+// the requests most often cached.
+func Key(r *http.Request) string {
+	if r.Method == http.MethodGet || r.Method == "" {
+		return r.URL.String()
+	}
+	return r.Method + " " + r.URL.String()
+}
+
+// name returns the name of the file the given key is stored in. The files are
+// spread across directories named after the first two characters of the hash,
+// so no one directory grows too large.
+func name(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	hash := hex.EncodeToString(sum[:])
+
+	return hash[:2] + "/" + hash
+}
+
+func (c *Cache) open(key string) (fs.File, error) {
+	f, err := c.fs.Open(name(key))
+
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			c.onError(key, err)
+		}
+		return nil, err
+	}
+	return f, nil
+}
+
+// Get returns the response stored under the given key, and whether it was
+// found.
+func (c *Cache) Get(key string) ([]byte, bool) {
+	f, err := c.open(key)
+
+	if err != nil {
+		return nil, false
+	}
+
+	defer f.Close()
+
+	b, err := io.ReadAll(f)
+
+	if err != nil {
+		c.onError(key, err)
+		return nil, false
+	}
+	return b, true
+}
+
+// Set stores the given response under the given key, replacing any response
+// already stored.
+func (c *Cache) Set(key string, resp []byte) {
+	n := name(key)
+
+	f, err := fs.ReadFile(n, bytes.NewReader(resp))
+
+	if err != nil {
+		c.onError(key, err)
+		return
+	}
+
+	defer fs.Cleanup(f)
+
+	stored, err := fs.PutPath(c.fs, n, f)
+
+	if err != nil {
+		c.onError(key, err)
+		return
+	}
+	stored.Close()
+}
+
+// Delete removes the response stored under the given key.
+func (c *Cache) Delete(key string) {
+	if err := c.fs.Remove(name(key)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		c.onError(key, err)
+	}
+}
+
+type body struct {
+	io.Reader
+	io.Closer
+}
+
+// Response returns the response stored under the given key for the given
+// request. The body of the response is read from the FS as it is read, so it
+// must be closed. If no response is stored then fs.ErrNotExist is returned.
+func (c *Cache) Response(key string, req *http.Request) (*http.Response, error) {
+	f, err := c.open(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(f), req)
+
+	if err != nil {
+		f.Close()
+		return nil, &fs.PathError{Op: "httpcache", Path: key, Err: err}
+	}
+
+	resp.Body = body{
+		Reader: resp.Body,
+		Closer: f,
+	}
+	return resp, nil
+}
+
+// Revalidate sets the conditional headers of the given request from the
+// validators of the given cached response, so the server can respond with 304
+// Not Modified if the cached response is still valid. Both the ETag and the
+// Last-Modified time are sent if the response has them, as described in RFC
+// 9111.
+func Revalidate(req *http.Request, cached *http.Response) {
+	if etag := cached.Header.Get("ETag"); etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+
+	if lastmod := cached.Header.Get("Last-Modified"); lastmod != "" {
+		req.Header.Set("If-Modified-Since", lastmod)
+	}
+}
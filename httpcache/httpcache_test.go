@@ -0,0 +1,103 @@
+package httpcache
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"testing"
+
+	"github.com/andrewpillar/fs"
+	"github.com/andrewpillar/fs/fakefs"
+)
+
+func Test_Cache(t *testing.T) {
+	rec := httptest.NewRecorder()
+	rec.Header().Set("ETag", `"v1"`)
+	rec.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+	rec.Header().Set("Cache-Control", "max-age=60")
+	rec.WriteString("hello")
+
+	dump, err := httputil.DumpResponse(rec.Result(), true)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := fakefs.New()
+
+	var errs []error
+
+	c := New(store, OnError(func(key string, err error) {
+		errs = append(errs, err)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/a?b=c", nil)
+	key := Key(req)
+
+	if key != "http://example.com/a?b=c" {
+		t.Fatalf("unexpected key, expected=%q, got=%q\n", "http://example.com/a?b=c", key)
+	}
+
+	if _, ok := c.Get(key); ok {
+		t.Fatalf("expected %q to not be cached\n", key)
+	}
+
+	c.Set(key, dump)
+
+	b, ok := c.Get(key)
+
+	if !ok {
+		t.Fatalf("expected %q to be cached\n", key)
+	}
+
+	if string(b) != string(dump) {
+		t.Fatalf("unexpected response, expected=%q, got=%q\n", dump, b)
+	}
+
+	resp, err := c.Response(key, req)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(body) != "hello" {
+		t.Fatalf("unexpected body, expected=%q, got=%q\n", "hello", body)
+	}
+
+	next := httptest.NewRequest(http.MethodGet, "http://example.com/a?b=c", nil)
+	Revalidate(next, resp)
+
+	if etag := next.Header.Get("If-None-Match"); etag != `"v1"` {
+		t.Fatalf("unexpected If-None-Match, expected=%q, got=%q\n", `"v1"`, etag)
+	}
+
+	if lastmod := next.Header.Get("If-Modified-Since"); lastmod != "Mon, 02 Jan 2006 15:04:05 GMT" {
+		t.Fatalf("unexpected If-Modified-Since, expected=%q, got=%q\n", "Mon, 02 Jan 2006 15:04:05 GMT", lastmod)
+	}
+
+	c.Delete(key)
+
+	if _, err := c.Response(key, req); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("unexpected error, expected=%q, got=%q\n", fs.ErrNotExist, err)
+	}
+
+	if len(errs) != 0 {
+		t.Fatalf("unexpected errors %v\n", errs)
+	}
+
+	store.Fail("put", "", errors.New("disk full"))
+	c.Set(key, dump)
+
+	if len(errs) != 1 {
+		t.Fatalf("unexpected errors, expected=%d, got=%d\n", 1, len(errs))
+	}
+}
@@ -0,0 +1,633 @@
+// Package index implements a queryable catalog of the files in an FS.
+//
+// The catalog is kept in an SQL database, and records the name, size,
+// modification time, hash, and metadata of each file. It is kept up to date
+// by the calls to Put, Rename, Link, SetMetadata, and Remove made through the
+// Index, so files can be listed, searched, and sorted without walking the
+// underlying FS, which may be slow if it is remote. The queries are written
+// for SQLite, the database driver is not imported by this package and must be
+// registered by the caller, for example,
+//
+//	db, err := sql.Open("sqlite", "index.db")
+//
+//	if err != nil {
+//		// Handle error.
+//	}
+//
+//	ix, err := index.New(store, db)
+package index
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"hash"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/andrewpillar/fs"
+)
+
+const schema = `CREATE TABLE IF NOT EXISTS files (
+	name     TEXT PRIMARY KEY,
+	size     INTEGER NOT NULL,
+	mod_time INTEGER NOT NULL,
+	hash     TEXT NOT NULL DEFAULT '',
+	metadata TEXT NOT NULL DEFAULT '{}'
+);
+CREATE INDEX IF NOT EXISTS files_size ON files (size);
+CREATE INDEX IF NOT EXISTS files_mod_time ON files (mod_time);
+CREATE INDEX IF NOT EXISTS files_hash ON files (hash);`
+
+const upsert = `INSERT INTO files (name, size, mod_time, hash, metadata)
+VALUES (?, ?, ?, ?, ?)
+ON CONFLICT (name) DO UPDATE SET
+	size = excluded.size,
+	mod_time = excluded.mod_time,
+	hash = excluded.hash,
+	metadata = excluded.metadata`
+
+// Entry is a single file in the catalog.
+type Entry struct {
+	Name     string
+	Size     int64
+	ModTime  time.Time
+	Hash     string
+	Metadata fs.Metadata
+}
+
+// Order is the order in which entries are returned from a query.
+type Order int
+
+const (
+	OrderName    Order = iota // Order by name.
+	OrderSize                 // Order by size.
+	OrderModTime              // Order by modification time.
+)
+
+var orderColumns = map[Order]string{
+	OrderName:    "name",
+	OrderSize:    "size",
+	OrderModTime: "mod_time",
+}
+
+// Query filters and sorts the entries in the catalog. The zero value of each
+// field does not filter anything, so the zero Query returns every entry in
+// name order.
+type Query struct {
+	Prefix   string      // Names that start with the prefix.
+	Pattern  string      // Names that match the GLOB pattern, * matches across slashes.
+	Terms    []string    // Names that contain each term, ignoring the case of ASCII letters.
+	MinSize  int64       // Files at least this size.
+	MaxSize  int64       // Files at most this size.
+	Since    time.Time   // Files modified at or after this time.
+	Until    time.Time   // Files modified before this time.
+	Hash     string      // Files with this hash.
+	Metadata fs.Metadata // Files with each of these metadata values.
+	Order    Order
+	Desc     bool
+	Limit    int
+	Offset   int
+}
+
+// lowerASCII returns the given string with only its ASCII letters in lower
+// case, the same as the lower function of SQLite, so terms are folded the same
+// way as the names they are compared against.
+func lowerASCII(s string) string {
+	b := []byte(s)
+
+	for i, c := range b {
+		if 'A' <= c && c <= 'Z' {
+			b[i] = c + ('a' - 'A')
+		}
+	}
+	return string(b)
+}
+
+// build returns the SQL statement and arguments for the query, limited to
+// the names in the given directory.
+func (q Query) build(dir string) (string, []any) {
+	var (
+		conds []string
+		args  []any
+	)
+
+	prefix := q.Prefix
+
+	if dir != "" {
+		prefix = dir + "/" + prefix
+	}
+
+	// Names are compared as blobs, so substr counts bytes as len does, rather
+	// than characters.
+	if prefix != "" {
+		conds = append(conds, "substr(CAST(name AS BLOB), 1, ?) = CAST(? AS BLOB)")
+		args = append(args, len(prefix), prefix)
+	}
+
+	if q.Pattern != "" {
+		pattern := q.Pattern
+
+		if dir != "" {
+			pattern = dir + "/" + pattern
+		}
+
+		conds = append(conds, "name GLOB ?")
+		args = append(args, pattern)
+	}
+
+	for _, term := range q.Terms {
+		if dir != "" {
+			conds = append(conds, "instr(lower(CAST(substr(CAST(name AS BLOB), ?) AS TEXT)), ?) > 0")
+			args = append(args, len(dir)+2, lowerASCII(term))
+			continue
+		}
+
+		conds = append(conds, "instr(lower(name), ?) > 0")
+		args = append(args, lowerASCII(term))
+	}
+
+	if q.MinSize > 0 {
+		conds = append(conds, "size >= ?")
+		args = append(args, q.MinSize)
+	}
+
+	if q.MaxSize > 0 {
+		conds = append(conds, "size <= ?")
+		args = append(args, q.MaxSize)
+	}
+
+	if !q.Since.IsZero() {
+		conds = append(conds, "mod_time >= ?")
+		args = append(args, q.Since.UnixNano())
+	}
+
+	if !q.Until.IsZero() {
+		conds = append(conds, "mod_time < ?")
+		args = append(args, q.Until.UnixNano())
+	}
+
+	if q.Hash != "" {
+		conds = append(conds, "hash = ?")
+		args = append(args, q.Hash)
+	}
+
+	keys := make([]string, 0, len(q.Metadata))
+
+	for k := range q.Metadata {
+		keys = append(keys, k)
+	}
+
+	// Sorted so the same query always builds the same statement.
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		conds = append(conds, "json_extract(metadata, ?) = ?")
+		args = append(args, `$."`+k+`"`, q.Metadata[k])
+	}
+
+	var buf strings.Builder
+
+	buf.WriteString("SELECT name, size, mod_time, hash, metadata FROM files")
+
+	if len(conds) > 0 {
+		buf.WriteString(" WHERE " + strings.Join(conds, " AND "))
+	}
+
+	col, ok := orderColumns[q.Order]
+
+	if !ok {
+		col = "name"
+	}
+
+	buf.WriteString(" ORDER BY " + col)
+
+	if q.Desc {
+		buf.WriteString(" DESC")
+	}
+
+	if col != "name" {
+		buf.WriteString(", name")
+	}
+
+	if q.Limit > 0 || q.Offset > 0 {
+		limit := q.Limit
+
+		if limit <= 0 {
+			limit = -1
+		}
+
+		buf.WriteString(" LIMIT ? OFFSET ?")
+		args = append(args, limit, q.Offset)
+	}
+	return buf.String(), args
+}
+
+// Option configures an Index.
+type Option func(*Index)
+
+// Hash sets the hash used for the files put in the Index, by default this is
+// SHA-256. Hashes are stored hex encoded.
+func Hash(mech func() hash.Hash) Option {
+	return func(ix *Index) {
+		ix.mech = mech
+	}
+}
+
+// Index is an FS that keeps a catalog of the files in the underlying FS.
+// Files put in the underlying FS by other means are not in the catalog until
+// Rebuild is called.
+type Index struct {
+	fs.FS
+
+	db   *sql.DB
+	mech func() hash.Hash
+	dir  string
+}
+
+// New returns an Index of the given FS stored in the given database. The
+// table for the catalog is created if it does not exist.
+func New(s fs.FS, db *sql.DB, opts ...Option) (*Index, error) {
+	ix := &Index{
+		FS:   s,
+		db:   db,
+		mech: sha256.New,
+	}
+
+	for _, opt := range opts {
+		opt(ix)
+	}
+
+	if _, err := db.Exec(schema); err != nil {
+		return nil, err
+	}
+	return ix, nil
+}
+
+func (ix *Index) key(name string) string {
+	return path.Join(ix.dir, name)
+}
+
+// metadata returns the metadata of the named file in the underlying FS, or an
+// empty Metadata if metadata is not supported.
+func (ix *Index) metadata(name string) (fs.Metadata, error) {
+	md, err := fs.GetMetadata(ix.FS, name)
+
+	if err != nil {
+		if errors.Is(err, fs.ErrUnsupported) {
+			return fs.Metadata{}, nil
+		}
+		return nil, err
+	}
+	return md, nil
+}
+
+func encodeMetadata(md fs.Metadata) (string, error) {
+	if md == nil {
+		md = fs.Metadata{}
+	}
+
+	b, err := json.Marshal(md)
+
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func (ix *Index) Unwrap() fs.FS { return ix.FS }
+
+// Sub returns an Index for the given directory that shares the same catalog.
+func (ix *Index) Sub(dir string) (fs.FS, error) {
+	sub, err := ix.FS.Sub(dir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Index{
+		FS:   sub,
+		db:   ix.db,
+		mech: ix.mech,
+		dir:  path.Join(ix.dir, dir),
+	}, nil
+}
+
+// hashReader hashes the contents of the file as it is read, and counts the
+// number of bytes read, so a hash of a file that was not read in full can be
+// discarded.
+type hashReader struct {
+	fs.File
+
+	h hash.Hash
+	n int64
+}
+
+func (r *hashReader) Read(p []byte) (int, error) {
+	n, err := r.File.Read(p)
+
+	r.h.Write(p[:n])
+	r.n += int64(n)
+
+	return n, err
+}
+
+// Put puts the file in the underlying FS, and records it in the catalog. The
+// file is hashed as it is put, if the underlying FS does not read the file
+// sequentially then the hash is left empty.
+func (ix *Index) Put(f fs.File) (fs.File, error) {
+	r := &hashReader{
+		File: f,
+		h:    ix.mech(),
+	}
+
+	stored, err := ix.FS.Put(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := stored.Stat()
+
+	if err != nil {
+		stored.Close()
+		return nil, err
+	}
+
+	name := info.Name()
+
+	var sum string
+
+	if r.n == info.Size() {
+		sum = hex.EncodeToString(r.h.Sum(nil))
+	}
+
+	md, err := ix.metadata(name)
+
+	if err != nil {
+		stored.Close()
+		return nil, err
+	}
+
+	if err := ix.record(name, info, sum, md); err != nil {
+		stored.Close()
+		return nil, &fs.PathError{Op: "put", Path: name, Err: err}
+	}
+	return stored, nil
+}
+
+func (ix *Index) record(name string, info fs.FileInfo, sum string, md fs.Metadata) error {
+	enc, err := encodeMetadata(md)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = ix.db.Exec(upsert, ix.key(name), info.Size(), info.ModTime().UnixNano(), sum, enc)
+	return err
+}
+
+func (ix *Index) ReadDir(name string) ([]fs.DirEntry, error) {
+	return fs.ReadDir(ix.FS, name)
+}
+
+// Rename renames the file in the underlying FS and in the catalog.
+func (ix *Index) Rename(oldname, newname string) error {
+	if err := fs.Move(ix.FS, oldname, newname); err != nil {
+		return err
+	}
+
+	tx, err := ix.db.Begin()
+
+	if err != nil {
+		return &fs.PathError{Op: "rename", Path: oldname, Err: err}
+	}
+
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM files WHERE name = ?", ix.key(newname)); err != nil {
+		return &fs.PathError{Op: "rename", Path: oldname, Err: err}
+	}
+
+	if _, err := tx.Exec("UPDATE files SET name = ? WHERE name = ?", ix.key(newname), ix.key(oldname)); err != nil {
+		return &fs.PathError{Op: "rename", Path: oldname, Err: err}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return &fs.PathError{Op: "rename", Path: oldname, Err: err}
+	}
+	return nil
+}
+
+// Link links the file in the underlying FS, and records the link in the
+// catalog with the same size, hash, and metadata as the original.
+func (ix *Index) Link(oldname, newname string) error {
+	if err := fs.Link(ix.FS, oldname, newname); err != nil {
+		return err
+	}
+
+	q := `INSERT OR REPLACE INTO files (name, size, mod_time, hash, metadata)
+SELECT ?, size, mod_time, hash, metadata FROM files WHERE name = ?`
+
+	if _, err := ix.db.Exec(q, ix.key(newname), ix.key(oldname)); err != nil {
+		return &fs.PathError{Op: "link", Path: oldname, Err: err}
+	}
+	return nil
+}
+
+func (ix *Index) Metadata(name string) (fs.Metadata, error) {
+	return fs.GetMetadata(ix.FS, name)
+}
+
+// SetMetadata sets the metadata of the file in the underlying FS, and then
+// records the resulting metadata in the catalog.
+func (ix *Index) SetMetadata(name string, md fs.Metadata) error {
+	if err := fs.SetMetadata(ix.FS, name, md); err != nil {
+		return err
+	}
+
+	md, err := ix.metadata(name)
+
+	if err != nil {
+		return err
+	}
+
+	enc, err := encodeMetadata(md)
+
+	if err != nil {
+		return &fs.PathError{Op: "setmetadata", Path: name, Err: err}
+	}
+
+	if _, err := ix.db.Exec("UPDATE files SET metadata = ? WHERE name = ?", enc, ix.key(name)); err != nil {
+		return &fs.PathError{Op: "setmetadata", Path: name, Err: err}
+	}
+	return nil
+}
+
+// Remove removes the file from the underlying FS and from the catalog.
+func (ix *Index) Remove(name string) error {
+	if err := ix.FS.Remove(name); err != nil {
+		return err
+	}
+
+	if _, err := ix.db.Exec("DELETE FROM files WHERE name = ?", ix.key(name)); err != nil {
+		return &fs.PathError{Op: "remove", Path: name, Err: err}
+	}
+	return nil
+}
+
+// Find returns the entries in the catalog that match the given query. The
+// names of the entries are relative to the Index.
+func (ix *Index) Find(ctx context.Context, q Query) ([]Entry, error) {
+	query, args := q.build(ix.dir)
+
+	rows, err := ix.db.QueryContext(ctx, query, args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	ents := make([]Entry, 0)
+
+	for rows.Next() {
+		var (
+			e       Entry
+			modTime int64
+			md      string
+		)
+
+		if err := rows.Scan(&e.Name, &e.Size, &modTime, &e.Hash, &md); err != nil {
+			return nil, err
+		}
+
+		if err := json.Unmarshal([]byte(md), &e.Metadata); err != nil {
+			return nil, err
+		}
+
+		if ix.dir != "" {
+			e.Name = strings.TrimPrefix(e.Name, ix.dir+"/")
+		}
+
+		e.ModTime = time.Unix(0, modTime)
+		ents = append(ents, e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return ents, nil
+}
+
+// Rebuild walks the underlying FS and brings the catalog in line with it.
+// Files are not read, so the hash of a file is kept only if its size and
+// modification time are unchanged, otherwise it is left empty.
+func (ix *Index) Rebuild(ctx context.Context) error {
+	tx, err := ix.db.BeginTx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	type known struct {
+		size    int64
+		modTime int64
+		hash    string
+	}
+
+	existing := make(map[string]known)
+
+	query, args := Query{}.build(ix.dir)
+
+	rows, err := tx.QueryContext(ctx, query, args...)
+
+	if err != nil {
+		return err
+	}
+
+	for rows.Next() {
+		var (
+			name string
+			k    known
+			md   string
+		)
+
+		if err := rows.Scan(&name, &k.size, &k.modTime, &k.hash, &md); err != nil {
+			rows.Close()
+			return err
+		}
+		existing[name] = k
+	}
+
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	err = fs.Walk(ix.FS, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			return nil
+		}
+
+		info, err := d.Info()
+
+		if err != nil {
+			return err
+		}
+
+		md, err := ix.metadata(name)
+
+		if err != nil {
+			return err
+		}
+
+		enc, err := encodeMetadata(md)
+
+		if err != nil {
+			return err
+		}
+
+		key := ix.key(name)
+		modTime := info.ModTime().UnixNano()
+
+		var sum string
+
+		if k, ok := existing[key]; ok {
+			if k.size == info.Size() && k.modTime == modTime {
+				sum = k.hash
+			}
+			delete(existing, key)
+		}
+
+		_, err = tx.ExecContext(ctx, upsert, key, info.Size(), modTime, sum, enc)
+		return err
+	})
+
+	if err != nil {
+		return err
+	}
+
+	for name := range existing {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM files WHERE name = ?", name); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
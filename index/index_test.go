@@ -0,0 +1,79 @@
+package index
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/andrewpillar/fs"
+)
+
+func Test_QueryBuild(t *testing.T) {
+	since := time.Unix(0, 1000)
+
+	tests := []struct {
+		q     Query
+		dir   string
+		query string
+		args  []any
+	}{
+		{
+			Query{},
+			"",
+			"SELECT name, size, mod_time, hash, metadata FROM files ORDER BY name",
+			nil,
+		},
+		{
+			Query{},
+			"logs",
+			"SELECT name, size, mod_time, hash, metadata FROM files WHERE substr(CAST(name AS BLOB), 1, ?) = CAST(? AS BLOB) ORDER BY name",
+			[]any{5, "logs/"},
+		},
+		{
+			Query{Prefix: "2023-", MinSize: 10, Order: OrderSize, Desc: true, Limit: 5},
+			"logs",
+			"SELECT name, size, mod_time, hash, metadata FROM files WHERE substr(CAST(name AS BLOB), 1, ?) = CAST(? AS BLOB) AND size >= ? ORDER BY size DESC, name LIMIT ? OFFSET ?",
+			[]any{10, "logs/2023-", int64(10), 5, 0},
+		},
+		{
+			Query{Pattern: "*.tar.gz", Since: since, Hash: "abc"},
+			"",
+			"SELECT name, size, mod_time, hash, metadata FROM files WHERE name GLOB ? AND mod_time >= ? AND hash = ? ORDER BY name",
+			[]any{"*.tar.gz", int64(1000), "abc"},
+		},
+		{
+			Query{Metadata: fs.Metadata{"b": "2", "a": "1"}, Offset: 10},
+			"",
+			"SELECT name, size, mod_time, hash, metadata FROM files WHERE json_extract(metadata, ?) = ? AND json_extract(metadata, ?) = ? ORDER BY name LIMIT ? OFFSET ?",
+			[]any{`$."a"`, "1", `$."b"`, "2", -1, 10},
+		},
+	}
+
+	for i, test := range tests {
+		query, args := test.q.build(test.dir)
+
+		if query != test.query {
+			t.Fatalf("tests[%d] - unexpected query, expected=%q, got=%q\n", i, test.query, query)
+		}
+
+		if !reflect.DeepEqual(args, test.args) {
+			t.Fatalf("tests[%d] - unexpected args, expected=%v, got=%v\n", i, test.args, args)
+		}
+	}
+}
+
+func Test_QueryBuildTerms(t *testing.T) {
+	q := Query{Terms: []string{"Report"}}
+
+	query, args := q.build("docs")
+
+	expected := "SELECT name, size, mod_time, hash, metadata FROM files WHERE substr(CAST(name AS BLOB), 1, ?) = CAST(? AS BLOB) AND instr(lower(CAST(substr(CAST(name AS BLOB), ?) AS TEXT)), ?) > 0 ORDER BY name"
+
+	if query != expected {
+		t.Fatalf("unexpected query, expected=%q, got=%q\n", expected, query)
+	}
+
+	if !reflect.DeepEqual(args, []any{5, "docs/", 6, "report"}) {
+		t.Fatalf("unexpected args, got=%v\n", args)
+	}
+}
@@ -0,0 +1,244 @@
+package index
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andrewpillar/fs"
+)
+
+// ErrQuery is the error returned when a search query cannot be parsed.
+var ErrQuery = errors.New("invalid query")
+
+var sortFields = map[string]Order{
+	"name":     OrderName,
+	"size":     OrderSize,
+	"modified": OrderModTime,
+}
+
+// tokenize splits the query on whitespace, keeping double quoted strings
+// together with the quotes removed.
+func tokenize(s string) ([]string, error) {
+	var (
+		toks   []string
+		buf    strings.Builder
+		quoted bool
+		inTok  bool
+	)
+
+	for _, r := range s {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			inTok = true
+		case !quoted && (r == ' ' || r == '\t' || r == '\n'):
+			if inTok {
+				toks = append(toks, buf.String())
+				buf.Reset()
+				inTok = false
+			}
+		default:
+			buf.WriteRune(r)
+			inTok = true
+		}
+	}
+
+	if quoted {
+		return nil, fmt.Errorf("%w: unterminated quote", ErrQuery)
+	}
+
+	if inTok {
+		toks = append(toks, buf.String())
+	}
+	return toks, nil
+}
+
+// splitRange splits a range value into its operator and operands. The
+// operator is one of ">", ">=", "<", "<=", "..", or "" for an exact value.
+func splitRange(v string) (op, lo, hi string) {
+	for _, op := range []string{">=", "<=", ">", "<"} {
+		if strings.HasPrefix(v, op) {
+			return op, v[len(op):], ""
+		}
+	}
+
+	if i := strings.Index(v, ".."); i >= 0 {
+		return "..", v[:i], v[i+2:]
+	}
+	return "", v, ""
+}
+
+func parseSizeRange(q *Query, v string) error {
+	op, lo, hi := splitRange(v)
+
+	a, err := fs.ParseSize(lo)
+
+	if err != nil {
+		return fmt.Errorf("%w: size %q", ErrQuery, v)
+	}
+
+	switch op {
+	case ">":
+		q.MinSize = a + 1
+	case ">=":
+		q.MinSize = a
+	case "<":
+		q.MaxSize = a - 1
+	case "<=":
+		q.MaxSize = a
+	case "..":
+		b, err := fs.ParseSize(hi)
+
+		if err != nil {
+			return fmt.Errorf("%w: size %q", ErrQuery, v)
+		}
+		q.MinSize, q.MaxSize = a, b
+	default:
+		q.MinSize, q.MaxSize = a, a
+	}
+
+	// A maximum of zero does not filter anything, so the smallest size that
+	// can be asked for is one byte.
+	if (op == "<" || op == "<=" || op == "" || op == "..") && q.MaxSize <= 0 {
+		return fmt.Errorf("%w: size %q matches nothing", ErrQuery, v)
+	}
+	return nil
+}
+
+// parseTime parses a date or an RFC 3339 timestamp, and returns the span of
+// time it covers, which is a day for a date.
+func parseTime(s string) (time.Time, time.Duration, error) {
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, 24 * time.Hour, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, s)
+
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	return t, time.Nanosecond, nil
+}
+
+func parseTimeRange(q *Query, v string) error {
+	op, lo, hi := splitRange(v)
+
+	a, span, err := parseTime(lo)
+
+	if err != nil {
+		return fmt.Errorf("%w: time %q", ErrQuery, v)
+	}
+
+	switch op {
+	case ">":
+		q.Since = a.Add(span)
+	case ">=":
+		q.Since = a
+	case "<":
+		q.Until = a
+	case "<=":
+		q.Until = a.Add(span)
+	case "..":
+		b, span, err := parseTime(hi)
+
+		if err != nil {
+			return fmt.Errorf("%w: time %q", ErrQuery, v)
+		}
+		q.Since, q.Until = a, b.Add(span)
+	default:
+		q.Since, q.Until = a, a.Add(span)
+	}
+	return nil
+}
+
+// ParseQuery parses a search query into a Query. A query is a list of
+// space separated terms, all of which must match. Values that contain spaces
+// can be double quoted. The terms are,
+//
+//	word               names containing the word, ignoring case
+//	name:pattern       names matching the GLOB pattern
+//	prefix:dir/        names starting with the prefix
+//	size:>10MB         sizes, with >, >=, <, <=, a range such as 1KB..1MB, or an exact size
+//	modified:>=2023-01-01
+//	                   modification times, with the same operators as size, as a date or RFC 3339 timestamp
+//	hash:hex           files with the hash
+//	key=value          files with the metadata value
+//	sort:-size         the order of the results, by name, size, or modified, a leading - reverses it
+//	limit:n            at most n results
+//	offset:n           skip the first n results
+func ParseQuery(s string) (Query, error) {
+	var q Query
+
+	toks, err := tokenize(s)
+
+	if err != nil {
+		return q, err
+	}
+
+	for _, tok := range toks {
+		if key, val, ok := strings.Cut(tok, "="); ok && key != "" && !strings.Contains(key, ":") {
+			if q.Metadata == nil {
+				q.Metadata = make(fs.Metadata)
+			}
+			q.Metadata[key] = val
+			continue
+		}
+
+		field, val, ok := strings.Cut(tok, ":")
+
+		if !ok {
+			q.Terms = append(q.Terms, tok)
+			continue
+		}
+
+		switch field {
+		case "name":
+			q.Pattern = val
+		case "prefix":
+			q.Prefix = val
+		case "size":
+			err = parseSizeRange(&q, val)
+		case "modified":
+			err = parseTimeRange(&q, val)
+		case "hash":
+			q.Hash = strings.ToLower(val)
+		case "sort":
+			order, ok := sortFields[strings.TrimPrefix(val, "-")]
+
+			if !ok {
+				return q, fmt.Errorf("%w: unknown sort %q", ErrQuery, val)
+			}
+			q.Order = order
+			q.Desc = strings.HasPrefix(val, "-")
+		case "limit":
+			q.Limit, err = strconv.Atoi(val)
+		case "offset":
+			q.Offset, err = strconv.Atoi(val)
+		default:
+			return q, fmt.Errorf("%w: unknown field %q", ErrQuery, field)
+		}
+
+		if err != nil {
+			if errors.Is(err, ErrQuery) {
+				return q, err
+			}
+			return q, fmt.Errorf("%w: %s %q", ErrQuery, field, val)
+		}
+	}
+	return q, nil
+}
+
+// Search returns the entries in the catalog that match the given search
+// query. See ParseQuery for the syntax of the query.
+func (ix *Index) Search(ctx context.Context, query string) ([]Entry, error) {
+	q, err := ParseQuery(query)
+
+	if err != nil {
+		return nil, err
+	}
+	return ix.Find(ctx, q)
+}
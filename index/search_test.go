@@ -0,0 +1,62 @@
+package index
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/andrewpillar/fs"
+)
+
+func Test_ParseQuery(t *testing.T) {
+	day := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		query    string
+		expected Query
+	}{
+		{"", Query{}},
+		{"report final", Query{Terms: []string{"report", "final"}}},
+		{`"annual report"`, Query{Terms: []string{"annual report"}}},
+		{"name:*.jpg prefix:photos/", Query{Pattern: "*.jpg", Prefix: "photos/"}},
+		{"size:>1KB", Query{MinSize: 1025}},
+		{"size:1KB..1MB", Query{MinSize: 1 << 10, MaxSize: 1 << 20}},
+		{"size:<=10", Query{MaxSize: 10}},
+		{"modified:2023-01-01", Query{Since: day, Until: day.Add(24 * time.Hour)}},
+		{"modified:>=2023-01-01", Query{Since: day}},
+		{"modified:<2023-01-01T00:00:00Z", Query{Until: day}},
+		{"content-type=image/png owner=me", Query{Metadata: fs.Metadata{"content-type": "image/png", "owner": "me"}}},
+		{"hash:ABC sort:-modified limit:10 offset:20", Query{Hash: "abc", Order: OrderModTime, Desc: true, Limit: 10, Offset: 20}},
+	}
+
+	for i, test := range tests {
+		q, err := ParseQuery(test.query)
+
+		if err != nil {
+			t.Fatalf("tests[%d] - unexpected error: %v\n", i, err)
+		}
+
+		if !reflect.DeepEqual(q, test.expected) {
+			t.Fatalf("tests[%d] - unexpected query, expected=%+v, got=%+v\n", i, test.expected, q)
+		}
+	}
+}
+
+func Test_ParseQueryError(t *testing.T) {
+	tests := []string{
+		`"unterminated`,
+		"size:big",
+		"size:<0",
+		"modified:yesterday",
+		"sort:colour",
+		"limit:ten",
+		"owner:me",
+	}
+
+	for i, test := range tests {
+		if _, err := ParseQuery(test); !errors.Is(err, ErrQuery) {
+			t.Fatalf("tests[%d] - unexpected error, expected=%q, got=%v\n", i, ErrQuery, err)
+		}
+	}
+}
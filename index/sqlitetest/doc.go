@@ -0,0 +1,4 @@
+// Package sqlitetest tests package index against an SQLite database. It is a
+// module of its own, so the SQLite driver is only a dependency of these
+// tests, and not of the modules that import package index.
+package sqlitetest
@@ -0,0 +1,285 @@
+package sqlitetest
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/andrewpillar/fs"
+	"github.com/andrewpillar/fs/fakefs"
+	"github.com/andrewpillar/fs/index"
+
+	_ "modernc.org/sqlite"
+)
+
+// newIndex returns an Index of a temporary directory, with the catalog kept in
+// a temporary SQLite database, along with the directory.
+func newIndex(t *testing.T) (*index.Index, string) {
+	dir, err := os.MkdirTemp("", "index-")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	return indexOf(t, fs.New(dir)), dir
+}
+
+// indexOf returns an Index of the given FS, with the catalog kept in a
+// temporary SQLite database.
+func indexOf(t *testing.T, s fs.FS) *index.Index {
+	dbdir, err := os.MkdirTemp("", "index-db-")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { os.RemoveAll(dbdir) })
+
+	db, err := sql.Open("sqlite", filepath.Join(dbdir, "index.db"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { db.Close() })
+
+	ix, err := index.New(s, db)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ix
+}
+
+func put(t *testing.T, s fs.FS, name, content string) {
+	f, err := fs.ReadFile(name, bytes.NewReader([]byte(content)))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer fs.Cleanup(f)
+
+	stored, err := s.Put(f)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored.Close()
+}
+
+func find(t *testing.T, ix *index.Index, q index.Query) []string {
+	ents, err := ix.Find(context.Background(), q)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := make([]string, 0, len(ents))
+
+	for _, e := range ents {
+		names = append(names, e.Name)
+	}
+	return names
+}
+
+func Test_Index(t *testing.T) {
+	ix, _ := newIndex(t)
+
+	put(t, ix, "a.txt", "a")
+	put(t, ix, "b.tar.gz", "bbbb")
+	put(t, ix, "Report.txt", "report")
+
+	logs, err := ix.Sub("logs")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	put(t, logs, "2023-01.log", "log")
+
+	tests := []struct {
+		q        index.Query
+		expected []string
+	}{
+		{index.Query{}, []string{"Report.txt", "a.txt", "b.tar.gz", "logs/2023-01.log"}},
+		{index.Query{Prefix: "logs/"}, []string{"logs/2023-01.log"}},
+		{index.Query{Pattern: "*.txt"}, []string{"Report.txt", "a.txt"}},
+		{index.Query{Terms: []string{"REPORT"}}, []string{"Report.txt"}},
+		{index.Query{MinSize: 3, MaxSize: 4}, []string{"b.tar.gz", "logs/2023-01.log"}},
+		{index.Query{Order: index.OrderSize, Desc: true, Limit: 2}, []string{"Report.txt", "b.tar.gz"}},
+		{index.Query{Order: index.OrderSize, Offset: 3}, []string{"Report.txt"}},
+	}
+
+	for i, test := range tests {
+		names := find(t, ix, test.q)
+
+		if !reflect.DeepEqual(names, test.expected) {
+			t.Fatalf("tests[%d] - unexpected names, expected=%v, got=%v\n", i, test.expected, names)
+		}
+	}
+
+	if names := find(t, logs.(*index.Index), index.Query{}); !reflect.DeepEqual(names, []string{"2023-01.log"}) {
+		t.Fatalf("unexpected names, expected=%v, got=%v\n", []string{"2023-01.log"}, names)
+	}
+
+	sum := sha256.Sum256([]byte("a"))
+
+	ents, err := ix.Find(context.Background(), index.Query{Hash: hex.EncodeToString(sum[:])})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ents) != 1 || ents[0].Name != "a.txt" || ents[0].Size != 1 {
+		t.Fatalf("unexpected entries for hash, got=%+v\n", ents)
+	}
+
+	if err := ix.Rename("a.txt", "c.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ix.Remove("b.tar.gz"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"Report.txt", "c.txt", "logs/2023-01.log"}
+
+	if names := find(t, ix, index.Query{}); !reflect.DeepEqual(names, expected) {
+		t.Fatalf("unexpected names, expected=%v, got=%v\n", expected, names)
+	}
+}
+
+func Test_IndexUnicode(t *testing.T) {
+	ix, _ := newIndex(t)
+
+	cafe, err := ix.Sub("café")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	put(t, cafe, "Menü.txt", "menu")
+	put(t, cafe, "CAFÉ.txt", "cafe")
+
+	tests := []struct {
+		q        index.Query
+		expected []string
+	}{
+		{index.Query{}, []string{"CAFÉ.txt", "Menü.txt"}},
+		{index.Query{Prefix: "Menü"}, []string{"Menü.txt"}},
+		{index.Query{Terms: []string{"MENü"}}, []string{"Menü.txt"}},
+		{index.Query{Terms: []string{"MENÜ"}}, []string{}},
+		{index.Query{Terms: []string{"café"}}, []string{}},
+		{index.Query{Terms: []string{"CAFÉ"}}, []string{"CAFÉ.txt"}},
+		{index.Query{Terms: []string{"é"}}, []string{}},
+	}
+
+	for i, test := range tests {
+		names := find(t, cafe.(*index.Index), test.q)
+
+		if !reflect.DeepEqual(names, test.expected) {
+			t.Fatalf("tests[%d] - unexpected names, expected=%v, got=%v\n", i, test.expected, names)
+		}
+	}
+
+	if names := find(t, ix, index.Query{Prefix: "café/M"}); !reflect.DeepEqual(names, []string{"café/Menü.txt"}) {
+		t.Fatalf("unexpected names, expected=%v, got=%v\n", []string{"café/Menü.txt"}, names)
+	}
+}
+
+func Test_IndexMetadata(t *testing.T) {
+	ix := indexOf(t, fakefs.New())
+
+	put(t, ix, "a.png", "a")
+	put(t, ix, "b.png", "b")
+
+	if err := ix.SetMetadata("a.png", fs.Metadata{"content-type": "image/png", "owner": "me"}); err != nil {
+		t.Fatal(err)
+	}
+
+	q := index.Query{Metadata: fs.Metadata{"content-type": "image/png", "owner": "me"}}
+
+	if names := find(t, ix, q); !reflect.DeepEqual(names, []string{"a.png"}) {
+		t.Fatalf("unexpected names, expected=%v, got=%v\n", []string{"a.png"}, names)
+	}
+}
+
+func Test_IndexRebuild(t *testing.T) {
+	ix, dir := newIndex(t)
+
+	put(t, ix, "a", "a")
+	put(t, ix, "b", "b")
+
+	if err := os.WriteFile(filepath.Join(dir, "c"), []byte("c"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Remove(filepath.Join(dir, "b")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ix.Rebuild(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ents, err := ix.Find(context.Background(), index.Query{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ents) != 2 || ents[0].Name != "a" || ents[1].Name != "c" {
+		t.Fatalf("unexpected entries, got=%+v\n", ents)
+	}
+
+	// The hash of a file that did not change is kept, and the hash of a file
+	// that was never read is empty.
+	if ents[0].Hash == "" || ents[1].Hash != "" {
+		t.Fatalf("unexpected hashes, got=%q, %q\n", ents[0].Hash, ents[1].Hash)
+	}
+}
+
+func Test_Search(t *testing.T) {
+	ix, _ := newIndex(t)
+
+	put(t, ix, "notes.txt", "notes")
+	put(t, ix, "annual report.txt", "annual report for the year")
+	put(t, ix, "photo.jpg", "jpg")
+
+	tests := []struct {
+		query    string
+		expected []string
+	}{
+		{"report", []string{"annual report.txt"}},
+		{"name:*.txt sort:-size", []string{"annual report.txt", "notes.txt"}},
+		{"size:<10", []string{"notes.txt", "photo.jpg"}},
+		{"size:>10 name:*.jpg", []string{}},
+	}
+
+	for i, test := range tests {
+		ents, err := ix.Search(context.Background(), test.query)
+
+		if err != nil {
+			t.Fatalf("tests[%d] - unexpected error: %v\n", i, err)
+		}
+
+		names := make([]string, 0, len(ents))
+
+		for _, e := range ents {
+			names = append(names, e.Name)
+		}
+
+		if !reflect.DeepEqual(names, test.expected) {
+			t.Fatalf("tests[%d] - unexpected names, expected=%v, got=%v\n", i, test.expected, names)
+		}
+	}
+}
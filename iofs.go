@@ -0,0 +1,33 @@
+package fs
+
+import (
+	"io/fs"
+)
+
+type ioFS struct {
+	fs FS
+}
+
+// ToIOFS returns the given filesystem as an fs.FS from io/fs, that also
+// implements fs.StatFS, fs.SubFS, and fs.ReadDirFS if the filesystem
+// implements ReadDirFS. This allows the filesystem to be used with the
+// functions of the standard library that take an fs.FS, such as fs.Glob,
+// template.ParseFS, and http.FS.
+func ToIOFS(s FS) fs.FS {
+	return ioFS{fs: s}
+}
+
+func (s ioFS) Open(name string) (fs.File, error) { return s.fs.Open(name) }
+
+func (s ioFS) Stat(name string) (fs.FileInfo, error) { return s.fs.Stat(name) }
+
+func (s ioFS) ReadDir(name string) ([]fs.DirEntry, error) { return ReadDir(s.fs, name) }
+
+func (s ioFS) Sub(dir string) (fs.FS, error) {
+	sub, err := s.fs.Sub(dir)
+
+	if err != nil {
+		return nil, err
+	}
+	return ioFS{fs: sub}, nil
+}
@@ -0,0 +1,259 @@
+// Package kv implements a key value store for blobs, such as sessions, on top
+// of an FS.
+//
+// The Store has the same method set as the Storage interface used by web
+// frameworks such as github.com/gofiber/fiber, so any FS can be used as the
+// storage of sessions, caches, and rate limiters, for example,
+//
+//	store := kv.New(sessions, kv.GCInterval(10*time.Minute))
+//	defer store.Close()
+//
+//	if err := store.Set(id, data, 24*time.Hour); err != nil {
+//		return err
+//	}
+package kv
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/andrewpillar/fs"
+)
+
+// headerLen is the length of the header at the start of each file, which holds
+// the time the value expires in nanoseconds since the Unix epoch, or zero if it
+// does not expire.
+const headerLen = 8
+
+// Store stores values in an FS. It is safe for concurrent use.
+type Store struct {
+	fs  fs.FS
+	now func() time.Time
+	gc  time.Duration
+
+	once sync.Once
+	done chan struct{}
+}
+
+// Option configures a Store.
+type Option func(*Store)
+
+// WithClock sets the function used to get the current time when checking
+// whether values have expired. Defaults to time.Now.
+func WithClock(now func() time.Time) Option {
+	return func(s *Store) {
+		s.now = now
+	}
+}
+
+// GCInterval sets how often expired values are removed from the FS in the
+// background. Expired values are never returned, but are otherwise only removed
+// when they are next got. Defaults to no collection in the background.
+func GCInterval(d time.Duration) Option {
+	return func(s *Store) {
+		s.gc = d
+	}
+}
+
+// New returns a Store that stores values in the given FS.
+func New(s fs.FS, opts ...Option) *Store {
+	st := &Store{
+		fs:   s,
+		now:  time.Now,
+		done: make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(st)
+	}
+
+	if st.gc > 0 {
+		go st.collect()
+	}
+	return st
+}
+
+func (s *Store) collect() {
+	t := time.NewTicker(s.gc)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-t.C:
+			s.Sweep()
+		}
+	}
+}
+
+// name returns the name of the file the given key is stored in. The files are
+// spread across directories named after the first two characters of the hash,
+// so no one directory grows too large.
+func name(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	hash := hex.EncodeToString(sum[:])
+
+	return hash[:2] + "/" + hash
+}
+
+// open opens the given file, and reads its header to check whether the value
+// has expired. The returned file is positioned at the start of the value.
+func (s *Store) open(name string) (fs.File, bool, error) {
+	f, err := s.fs.Open(name)
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	var hdr [headerLen]byte
+
+	if _, err := io.ReadFull(f, hdr[:]); err != nil {
+		f.Close()
+		return nil, false, &fs.PathError{Op: "kv", Path: name, Err: err}
+	}
+
+	exp := int64(binary.BigEndian.Uint64(hdr[:]))
+
+	return f, exp > 0 && s.now().UnixNano() >= exp, nil
+}
+
+// Get returns the value of the given key. If the key does not exist, or has
+// expired, then nil is returned.
+func (s *Store) Get(key string) ([]byte, error) {
+	if key == "" {
+		return nil, nil
+	}
+
+	n := name(key)
+
+	f, expired, err := s.open(n)
+
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if expired {
+		f.Close()
+
+		if err := s.fs.Remove(n); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		return nil, nil
+	}
+
+	defer f.Close()
+
+	return io.ReadAll(f)
+}
+
+// Set sets the value of the given key, which expires after the given duration.
+// A duration of zero means the value does not expire. Empty keys and values are
+// ignored.
+func (s *Store) Set(key string, val []byte, exp time.Duration) error {
+	if key == "" || len(val) == 0 {
+		return nil
+	}
+
+	var hdr [headerLen]byte
+
+	if exp > 0 {
+		binary.BigEndian.PutUint64(hdr[:], uint64(s.now().Add(exp).UnixNano()))
+	}
+
+	n := name(key)
+
+	f, err := fs.ReadFile(n, io.MultiReader(bytes.NewReader(hdr[:]), bytes.NewReader(val)))
+
+	if err != nil {
+		return err
+	}
+
+	defer fs.Cleanup(f)
+
+	stored, err := fs.PutPath(s.fs, n, f)
+
+	if err != nil {
+		return err
+	}
+	return stored.Close()
+}
+
+// Delete deletes the given key. Deleting a key that does not exist is not an
+// error.
+func (s *Store) Delete(key string) error {
+	if key == "" {
+		return nil
+	}
+
+	if err := s.fs.Remove(name(key)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// walk calls fn for the name of each value in the Store.
+func (s *Store) walk(fn func(name string) error) error {
+	return fs.Walk(s.fs, ".", func(name string, ent fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+
+		if ent.IsDir() {
+			return nil
+		}
+		return fn(name)
+	})
+}
+
+// Sweep removes the expired values from the FS.
+func (s *Store) Sweep() error {
+	return s.walk(func(name string) error {
+		f, expired, err := s.open(name)
+
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		f.Close()
+
+		if expired {
+			if err := s.fs.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Reset deletes every key.
+func (s *Store) Reset() error {
+	return s.walk(func(name string) error {
+		if err := s.fs.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		return nil
+	})
+}
+
+// Close stops the collection of expired values in the background.
+func (s *Store) Close() error {
+	s.once.Do(func() {
+		close(s.done)
+	})
+	return nil
+}
@@ -0,0 +1,106 @@
+package kv
+
+import (
+	"testing"
+	"time"
+
+	"github.com/andrewpillar/fs/fakefs"
+)
+
+func Test_Store(t *testing.T) {
+	clock := fakefs.NewManualClock(time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC))
+
+	fsys := fakefs.New()
+	s := New(fsys, WithClock(clock.Now))
+	defer s.Close()
+
+	if b, err := s.Get("missing"); err != nil || b != nil {
+		t.Fatalf("unexpected value, expected=%v, got=%q (%v)\n", nil, b, err)
+	}
+
+	if err := s.Set("session", []byte("data"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Set("forever", []byte("kept"), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := s.Get("session")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(b) != "data" {
+		t.Fatalf("unexpected value, expected=%q, got=%q\n", "data", b)
+	}
+
+	clock.Advance(time.Minute)
+
+	b, err = s.Get("session")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if b != nil {
+		t.Fatalf("unexpected value, expected=%v, got=%q\n", nil, b)
+	}
+
+	if files := fsys.Files(); len(files) != 1 {
+		t.Fatalf("unexpected files, expected=%d, got=%d\n", 1, len(files))
+	}
+
+	if b, _ := s.Get("forever"); string(b) != "kept" {
+		t.Fatalf("unexpected value, expected=%q, got=%q\n", "kept", b)
+	}
+
+	if err := s.Delete("forever"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Delete("forever"); err != nil {
+		t.Fatal(err)
+	}
+
+	if b, _ := s.Get("forever"); b != nil {
+		t.Fatalf("unexpected value, expected=%v, got=%q\n", nil, b)
+	}
+}
+
+func Test_StoreSweep(t *testing.T) {
+	clock := fakefs.NewManualClock(time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC))
+
+	fsys := fakefs.New()
+	s := New(fsys, WithClock(clock.Now))
+	defer s.Close()
+
+	for _, key := range []string{"a", "b", "c"} {
+		if err := s.Set(key, []byte(key), time.Second); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := s.Set("d", []byte("d"), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	clock.Advance(time.Minute)
+
+	if err := s.Sweep(); err != nil {
+		t.Fatal(err)
+	}
+
+	if files := fsys.Files(); len(files) != 1 {
+		t.Fatalf("unexpected files, expected=%d, got=%d\n", 1, len(files))
+	}
+
+	if err := s.Reset(); err != nil {
+		t.Fatal(err)
+	}
+
+	if files := fsys.Files(); len(files) != 0 {
+		t.Fatalf("unexpected files, expected=%d, got=%d\n", 0, len(files))
+	}
+}
@@ -0,0 +1,158 @@
+package fs
+
+import (
+	"context"
+	"fmt"
+	"runtime/pprof"
+	"strings"
+)
+
+type labeledFS struct {
+	FS
+
+	backend string
+	chain   string
+}
+
+// Labeled returns a filesystem that runs each operation on the given
+// filesystem under pprof labels, so CPU and heap profiles can be attributed to
+// the storage path that incurred them. The labels are fs.op, the name of the
+// operation such as open or put, fs.backend, the given name of the backend,
+// and fs.chain, the types of the wrappers around the backend, outermost
+// first. Reads of opened files are labeled with the read operation.
+func Labeled(s FS, backend string) FS {
+	ls := &labeledFS{
+		FS:      s,
+		backend: backend,
+		chain:   wrapperChain(s),
+	}
+
+	if canRename(s) {
+		return renameLabeledFS{labeledFS: ls}
+	}
+	return ls
+}
+
+// renameLabeledFS is a labeledFS over a filesystem that implements RenameFS.
+type renameLabeledFS struct {
+	*labeledFS
+}
+
+// wrapperChain returns the types of the given filesystem and each of the
+// filesystems it wraps, separated by >.
+func wrapperChain(s FS) string {
+	types := make([]string, 0)
+
+	for s != nil {
+		types = append(types, fmt.Sprintf("%T", s))
+		s = Unwrap(s)
+	}
+	return strings.Join(types, ">")
+}
+
+func (s *labeledFS) labels(op string) pprof.LabelSet {
+	return pprof.Labels("fs.op", op, "fs.backend", s.backend, "fs.chain", s.chain)
+}
+
+func (s *labeledFS) do(op string, fn func()) {
+	pprof.Do(context.Background(), s.labels(op), func(context.Context) {
+		fn()
+	})
+}
+
+func (s *labeledFS) Unwrap() FS { return s.FS }
+
+type labeledFile struct {
+	File
+
+	fs *labeledFS
+}
+
+func (f *labeledFile) Read(p []byte) (n int, err error) {
+	f.fs.do("read", func() {
+		n, err = f.File.Read(p)
+	})
+	return n, err
+}
+
+func (s *labeledFS) Open(name string) (f File, err error) {
+	s.do("open", func() {
+		f, err = s.FS.Open(name)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &labeledFile{
+		File: f,
+		fs:   s,
+	}, nil
+}
+
+func (s *labeledFS) Sub(dir string) (sub FS, err error) {
+	s.do("sub", func() {
+		sub, err = s.FS.Sub(dir)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return Labeled(sub, s.backend), nil
+}
+
+func (s *labeledFS) Stat(name string) (info FileInfo, err error) {
+	s.do("stat", func() {
+		info, err = s.FS.Stat(name)
+	})
+	return info, err
+}
+
+func (s *labeledFS) Put(f File) (stored File, err error) {
+	s.do("put", func() {
+		stored, err = s.FS.Put(f)
+	})
+	return stored, err
+}
+
+func (s *labeledFS) ReadDir(name string) (ents []DirEntry, err error) {
+	s.do("readdir", func() {
+		ents, err = ReadDir(s.FS, name)
+	})
+	return ents, err
+}
+
+func (s renameLabeledFS) Rename(oldname, newname string) (err error) {
+	s.do("rename", func() {
+		err = Move(s.FS, oldname, newname)
+	})
+	return err
+}
+
+func (s *labeledFS) Link(oldname, newname string) (err error) {
+	s.do("link", func() {
+		err = Link(s.FS, oldname, newname)
+	})
+	return err
+}
+
+func (s *labeledFS) Metadata(name string) (md Metadata, err error) {
+	s.do("metadata", func() {
+		md, err = GetMetadata(s.FS, name)
+	})
+	return md, err
+}
+
+func (s *labeledFS) SetMetadata(name string, md Metadata) (err error) {
+	s.do("setmetadata", func() {
+		err = SetMetadata(s.FS, name, md)
+	})
+	return err
+}
+
+func (s *labeledFS) Remove(name string) (err error) {
+	s.do("remove", func() {
+		err = s.FS.Remove(name)
+	})
+	return err
+}
@@ -0,0 +1,55 @@
+package fs
+
+import (
+	"context"
+	"io"
+	"runtime/pprof"
+	"testing"
+	"time"
+)
+
+func Test_Labeled(t *testing.T) {
+	store := Labeled(CacheStat(Null(), time.Minute), "null")
+
+	f, err := store.Open("file")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := f.Read(make([]byte, 1)); err != nil && err != io.EOF {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	labels := make(map[string]string)
+
+	ctx := pprof.WithLabels(context.Background(), store.(renameLabeledFS).labels("open"))
+
+	pprof.ForLabels(ctx, func(k, v string) bool {
+		labels[k] = v
+		return true
+	})
+
+	expected := map[string]string{
+		"fs.op":      "open",
+		"fs.backend": "null",
+		"fs.chain":   "fs.renameStatCache>fs.nullFS",
+	}
+
+	for k, v := range expected {
+		if labels[k] != v {
+			t.Fatalf("unexpected label %s, expected=%q, got=%q\n", k, v, labels[k])
+		}
+	}
+
+	sub, err := store.Sub("dir")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if chain := sub.(renameLabeledFS).chain; chain != expected["fs.chain"] {
+		t.Fatalf("unexpected chain, expected=%q, got=%q\n", expected["fs.chain"], chain)
+	}
+}
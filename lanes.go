@@ -0,0 +1,219 @@
+package fs
+
+import "sync"
+
+// LaneConfig configures the scheduling of operations between the lanes
+// returned from Lanes.
+type LaneConfig struct {
+	// Concurrency is the number of operations that can be made on the
+	// underlying filesystem at once, across both lanes. Defaults to 4.
+	Concurrency int
+
+	// Weight is the number of interactive operations that are let through for
+	// each bulk operation when both lanes are waiting. Defaults to 4.
+	Weight int
+}
+
+const (
+	laneInteractive = iota
+	laneBulk
+)
+
+// scheduler hands out slots for operations to each lane. Once all slots are
+// taken, operations are queued per lane, and freed slots are handed to the
+// queued operations by weight.
+type scheduler struct {
+	mu      sync.Mutex
+	max     int
+	weight  int
+	running int
+	streak  int
+	queues  [2][]chan struct{}
+}
+
+func (s *scheduler) acquire(lane int) {
+	s.mu.Lock()
+
+	if s.running < s.max && len(s.queues[laneInteractive]) == 0 && len(s.queues[laneBulk]) == 0 {
+		s.running++
+		s.mu.Unlock()
+		return
+	}
+
+	ch := make(chan struct{})
+	s.queues[lane] = append(s.queues[lane], ch)
+	s.mu.Unlock()
+
+	<-ch
+}
+
+// next returns the lane the next freed slot should be handed to, or -1 if
+// neither lane is waiting.
+func (s *scheduler) next() int {
+	interactive := len(s.queues[laneInteractive]) > 0
+	bulk := len(s.queues[laneBulk]) > 0
+
+	switch {
+	case interactive && bulk:
+		if s.streak < s.weight {
+			s.streak++
+			return laneInteractive
+		}
+		s.streak = 0
+		return laneBulk
+	case interactive:
+		return laneInteractive
+	case bulk:
+		s.streak = 0
+		return laneBulk
+	}
+	return -1
+}
+
+func (s *scheduler) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lane := s.next()
+
+	if lane < 0 {
+		s.running--
+		return
+	}
+
+	// The slot is handed straight to the queued operation, so running is left
+	// as is.
+	ch := s.queues[lane][0]
+	s.queues[lane] = s.queues[lane][1:]
+
+	close(ch)
+}
+
+type laneFS struct {
+	FS
+
+	sched *scheduler
+	lane  int
+}
+
+// Lanes returns two filesystems that make operations on the given filesystem
+// through a shared scheduler, one for interactive traffic and one for bulk
+// traffic. Once the configured concurrency is reached, operations are queued,
+// and interactive operations are let through ahead of bulk operations by the
+// configured weight. Bulk operations are still let through whilst there is
+// interactive traffic, so neither lane is starved.
+//
+// A slot is held for the duration of each call. For Put this includes copying
+// the file, however reading a file returned from Open is not scheduled.
+func Lanes(s FS, cfg LaneConfig) (FS, FS) {
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = 4
+	}
+	if cfg.Weight <= 0 {
+		cfg.Weight = 4
+	}
+
+	sched := &scheduler{
+		max:    cfg.Concurrency,
+		weight: cfg.Weight,
+	}
+
+	return newLaneFS(s, sched, laneInteractive), newLaneFS(s, sched, laneBulk)
+}
+
+// renameLaneFS is a laneFS over a filesystem that implements RenameFS.
+type renameLaneFS struct {
+	*laneFS
+}
+
+func newLaneFS(s FS, sched *scheduler, lane int) FS {
+	ls := &laneFS{
+		FS:    s,
+		sched: sched,
+		lane:  lane,
+	}
+
+	if canRename(s) {
+		return renameLaneFS{laneFS: ls}
+	}
+	return ls
+}
+
+func laneDo[T any](s *laneFS, fn func() (T, error)) (T, error) {
+	s.sched.acquire(s.lane)
+	defer s.sched.release()
+
+	return fn()
+}
+
+func (s *laneFS) Unwrap() FS { return s.FS }
+
+func (s *laneFS) Open(name string) (File, error) {
+	return laneDo(s, func() (File, error) {
+		return s.FS.Open(name)
+	})
+}
+
+func (s *laneFS) Sub(dir string) (FS, error) {
+	sub, err := laneDo(s, func() (FS, error) {
+		return s.FS.Sub(dir)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return newLaneFS(sub, s.sched, s.lane), nil
+}
+
+func (s *laneFS) Stat(name string) (FileInfo, error) {
+	return laneDo(s, func() (FileInfo, error) {
+		return s.FS.Stat(name)
+	})
+}
+
+func (s *laneFS) Put(f File) (File, error) {
+	return laneDo(s, func() (File, error) {
+		return s.FS.Put(f)
+	})
+}
+
+func (s *laneFS) ReadDir(name string) ([]DirEntry, error) {
+	return laneDo(s, func() ([]DirEntry, error) {
+		return ReadDir(s.FS, name)
+	})
+}
+
+func (s renameLaneFS) Rename(oldname, newname string) error {
+	_, err := laneDo(s.laneFS, func() (struct{}, error) {
+		return struct{}{}, Move(s.FS, oldname, newname)
+	})
+	return err
+}
+
+func (s *laneFS) Link(oldname, newname string) error {
+	_, err := laneDo(s, func() (struct{}, error) {
+		return struct{}{}, Link(s.FS, oldname, newname)
+	})
+	return err
+}
+
+func (s *laneFS) Remove(name string) error {
+	_, err := laneDo(s, func() (struct{}, error) {
+		return struct{}{}, s.FS.Remove(name)
+	})
+	return err
+}
+
+func (s *laneFS) Metadata(name string) (Metadata, error) {
+	return laneDo(s, func() (Metadata, error) {
+		return GetMetadata(s.FS, name)
+	})
+}
+
+func (s *laneFS) SetMetadata(name string, md Metadata) error {
+	_, err := laneDo(s, func() (struct{}, error) {
+		return struct{}{}, SetMetadata(s.FS, name, md)
+	})
+	return err
+}
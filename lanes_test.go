@@ -0,0 +1,118 @@
+package fs
+
+import (
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_LanesSchedule(t *testing.T) {
+	sched := &scheduler{
+		max:    1,
+		weight: 2,
+	}
+
+	// Take the only slot, so everything after is queued.
+	sched.acquire(laneInteractive)
+
+	var (
+		mu    sync.Mutex
+		order []int
+		wg    sync.WaitGroup
+	)
+
+	// waitQueued waits for n operations to be queued in the given lane.
+	waitQueued := func(lane, n int) {
+		for {
+			sched.mu.Lock()
+			queued := len(sched.queues[lane])
+			sched.mu.Unlock()
+
+			if queued == n {
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	queue := func(lane int) {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			sched.acquire(lane)
+
+			mu.Lock()
+			order = append(order, lane)
+			mu.Unlock()
+
+			sched.release()
+		}()
+	}
+
+	for i := 0; i < 3; i++ {
+		queue(laneBulk)
+	}
+	waitQueued(laneBulk, 3)
+
+	for i := 0; i < 3; i++ {
+		queue(laneInteractive)
+	}
+	waitQueued(laneInteractive, 3)
+
+	sched.release()
+	wg.Wait()
+
+	expected := []int{
+		laneInteractive,
+		laneInteractive,
+		laneBulk,
+		laneInteractive,
+		laneBulk,
+		laneBulk,
+	}
+
+	if len(order) != len(expected) {
+		t.Fatalf("unexpected order, expected=%v, got=%v\n", expected, order)
+	}
+
+	for i := range expected {
+		if order[i] != expected[i] {
+			t.Fatalf("unexpected order, expected=%v, got=%v\n", expected, order)
+		}
+	}
+
+	if sched.running != 0 {
+		t.Fatalf("unexpected running, expected=%d, got=%d\n", 0, sched.running)
+	}
+}
+
+func Test_Lanes(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	interactive, bulk := Lanes(New(dir), LaneConfig{Concurrency: 2})
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 8; i++ {
+		s := interactive
+
+		if i%2 == 0 {
+			s = bulk
+		}
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			if _, err := s.Stat("."); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,64 @@
+package fs
+
+type lazyFile struct {
+	s      FS
+	name   string
+	f      File
+	err    error
+	closed bool
+}
+
+// Lazy returns a file that defers opening the named file in the given
+// filesystem until it is first read or stat'd. This allows many files to be
+// constructed cheaply, for example to be passed to Put, and only those that
+// are used are opened. If opening the file fails, then the error is returned
+// from every subsequent call to Read and Stat. Closing a file that was never
+// opened does nothing.
+func Lazy(s FS, name string) File {
+	return &lazyFile{
+		s:    s,
+		name: name,
+	}
+}
+
+func (f *lazyFile) open(op string) (File, error) {
+	if f.closed {
+		return nil, &PathError{Op: op, Path: f.name, Err: ErrClosed}
+	}
+
+	if f.f == nil && f.err == nil {
+		f.f, f.err = f.s.Open(f.name)
+	}
+	return f.f, f.err
+}
+
+func (f *lazyFile) Stat() (FileInfo, error) {
+	file, err := f.open("stat")
+
+	if err != nil {
+		return nil, err
+	}
+	return file.Stat()
+}
+
+func (f *lazyFile) Read(p []byte) (int, error) {
+	file, err := f.open("read")
+
+	if err != nil {
+		return 0, err
+	}
+	return file.Read(p)
+}
+
+func (f *lazyFile) Close() error {
+	if f.closed {
+		return &PathError{Op: "close", Path: f.name, Err: ErrClosed}
+	}
+
+	f.closed = true
+
+	if f.f == nil {
+		return nil
+	}
+	return f.f.Close()
+}
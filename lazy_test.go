@@ -0,0 +1,68 @@
+package fs
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_Lazy(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	if err := os.WriteFile(filepath.Join(dir, "file"), []byte("data"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	store := &openCounter{FS: New(dir)}
+
+	files := make([]File, 0, 10)
+
+	for i := 0; i < cap(files); i++ {
+		files = append(files, Lazy(store, "file"))
+	}
+
+	if store.opens != 0 {
+		t.Fatalf("unexpected opens, expected=%d, got=%d\n", 0, store.opens)
+	}
+
+	info, err := files[0].Stat()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Size() != 4 {
+		t.Fatalf("unexpected size, expected=%d, got=%d\n", 4, info.Size())
+	}
+
+	b, err := io.ReadAll(files[0])
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(b) != "data" {
+		t.Fatalf("unexpected content, expected=%q, got=%q\n", "data", string(b))
+	}
+
+	for _, f := range files {
+		if err := f.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if store.opens != 1 {
+		t.Fatalf("unexpected opens, expected=%d, got=%d\n", 1, store.opens)
+	}
+
+	if _, err := files[0].Read(b); !errors.Is(err, ErrClosed) {
+		t.Fatalf("unexpected error, expected=%v, got=%v\n", ErrClosed, err)
+	}
+
+	if _, err := Lazy(store, "missing").Stat(); !errors.Is(err, ErrNotExist) {
+		t.Fatalf("unexpected error, expected=%v, got=%v\n", ErrNotExist, err)
+	}
+}
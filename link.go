@@ -0,0 +1,144 @@
+package fs
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path"
+)
+
+// LinkFS is the interface implemented by a filesystem that can create hard
+// links to the files stored in it.
+type LinkFS interface {
+	FS
+
+	// Link creates newname as a hard link to the file oldname. If newname
+	// already exists then ErrExist is returned.
+	Link(oldname, newname string) error
+}
+
+// Link creates newname as a hard link to the file oldname in the given
+// filesystem. If the filesystem does not implement LinkFS then ErrUnsupported
+// is returned in the *PathError.
+func Link(s FS, oldname, newname string) error {
+	ls, ok := s.(LinkFS)
+
+	if !ok {
+		return &PathError{Op: "link", Path: oldname, Err: ErrUnsupported}
+	}
+	return ls.Link(oldname, newname)
+}
+
+func (s filesystem) Link(oldname, newname string) error {
+	if err := s.check(oldname, newname); err != nil {
+		return &PathError{Op: "link", Path: oldname, Err: err}
+	}
+
+	if err := os.Link(s.path(oldname), s.path(newname)); err != nil {
+		return &PathError{Op: "link", Path: oldname, Err: errors.Unwrap(err)}
+	}
+	return nil
+}
+
+// HashLink configures Hash to store the content of each file under its hash in
+// the given directory, and to then hard link the file's name to it. Files with
+// identical content are stored once, no matter how many names they are put
+// under. The file returned from Put keeps the name it was put under. The
+// underlying filesystem must implement RenameFS and LinkFS.
+//
+// Removing a file only removes its link, the content remains in the given
+// directory. Files must only be replaced via Put on the returned filesystem,
+// since writing to a file in place would modify every file linked to the same
+// content.
+func HashLink(dir string) HashOption {
+	return func(s *hashFS) {
+		s.linkDir = dir
+	}
+}
+
+// putLink stores the file under its hash in the link directory, if content
+// with that hash is not already stored, and links the name of the file to it.
+func (s *hashFS) putLink(f File, name string) (File, error) {
+	if _, ok := s.FS.(LinkFS); !ok {
+		return nil, &PathError{Op: "put", Path: name, Err: ErrUnsupported}
+	}
+
+	objects, err := s.FS.Sub(s.linkDir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	tmp, err := tmpName(".hash-")
+
+	if err != nil {
+		return nil, &PathError{Op: "put", Path: name, Err: err}
+	}
+
+	h := s.mech()
+
+	stored, err := objects.Put(Rename(&hashReader{File: f, r: io.TeeReader(f, h)}, tmp))
+
+	if err != nil {
+		objects.Remove(tmp)
+		return nil, err
+	}
+	stored.Close()
+
+	hash := s.name(h.Sum(nil))
+
+	_, err = objects.Stat(hash)
+
+	if err != nil {
+		if !errors.Is(err, ErrNotExist) {
+			objects.Remove(tmp)
+			return nil, err
+		}
+
+		if err := Move(objects, tmp, hash); err != nil {
+			objects.Remove(tmp)
+			return nil, err
+		}
+	} else {
+		// Already stored, so the new copy is not needed.
+		objects.Remove(tmp)
+	}
+
+	if err := s.FS.Remove(name); err != nil && !errors.Is(err, ErrNotExist) {
+		return nil, err
+	}
+
+	if err := Link(s.FS, path.Join(s.linkDir, hash), name); err != nil {
+		return nil, err
+	}
+	return s.FS.Open(name)
+}
+
+func (s *hashFS) Link(oldname, newname string) error {
+	return Link(s.FS, oldname, newname)
+}
+
+func (s uniqueFS) Link(oldname, newname string) error {
+	return Link(s.FS, oldname, newname)
+}
+
+func (s limitFS) Link(oldname, newname string) error {
+	return Link(s.FS, oldname, newname)
+}
+
+func (s readOnly) Link(oldname, _ string) error {
+	return &PathError{Op: "link", Path: oldname, Err: ErrPermission}
+}
+
+func (s *statCache) Link(oldname, newname string) error {
+	defer s.invalidate(newname)
+
+	return Link(s.FS, oldname, newname)
+}
+
+func (s *chaos) Link(oldname, newname string) error {
+	if _, err := s.fault("link", oldname); err != nil {
+		return err
+	}
+	return Link(s.FS, oldname, newname)
+}
@@ -0,0 +1,485 @@
+package fs
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"hash"
+	"io"
+	"strings"
+)
+
+// MerkleExt is the extension of the sidecar file holding the Merkle tree of a
+// file put into the filesystem returned from Merkle.
+const MerkleExt = ".merkle"
+
+// MerkleTree is the Merkle tree of a file. Each leaf is the hash of a chunk of
+// the file, and the root is the hash of the leaves hashed together in pairs,
+// level by level. Leaves and nodes are hashed with a different prefix byte, so
+// a leaf cannot be passed off as a node.
+type MerkleTree struct {
+	Size      int64    `json:"size"`
+	ChunkSize int      `json:"chunk_size"`
+	Root      string   `json:"root"`
+	Leaves    []string `json:"leaves"`
+
+	mech func() hash.Hash
+}
+
+func merkleLeaf(h hash.Hash, p []byte) []byte {
+	h.Reset()
+	h.Write([]byte{0})
+	h.Write(p)
+	return h.Sum(nil)
+}
+
+// root returns the root of the tree built from the leaves. An odd node at the
+// end of a level is promoted to the next.
+func (t *MerkleTree) root() (string, error) {
+	if len(t.Leaves) == 0 {
+		return "", ErrInvalid
+	}
+
+	level := make([][]byte, 0, len(t.Leaves))
+
+	for _, leaf := range t.Leaves {
+		b, err := hex.DecodeString(leaf)
+
+		if err != nil {
+			return "", err
+		}
+		level = append(level, b)
+	}
+
+	h := t.mech()
+
+	for len(level) > 1 {
+		next := make([][]byte, 0, (len(level)+1)/2)
+
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+				break
+			}
+
+			h.Reset()
+			h.Write([]byte{1})
+			h.Write(level[i])
+			h.Write(level[i+1])
+
+			next = append(next, h.Sum(nil))
+		}
+		level = next
+	}
+	return hex.EncodeToString(level[0]), nil
+}
+
+// NewMerkleTree returns the Merkle tree of the content read from r, split into
+// chunks of the given size and hashed with the given hash.
+func NewMerkleTree(r io.Reader, mech func() hash.Hash, chunkSize int) (*MerkleTree, error) {
+	if chunkSize <= 0 {
+		return nil, ErrInvalid
+	}
+
+	w := newMerkleWriter(mech, chunkSize)
+
+	if _, err := copyBuffer(w, r); err != nil {
+		return nil, err
+	}
+	return w.tree()
+}
+
+// ReadMerkleTree returns the Merkle tree stored in the sidecar of the named
+// file. The tree is checked against its root, but the root itself should be
+// checked against a trusted copy if the sidecar could have been tampered with.
+func ReadMerkleTree(s FS, name string, mech func() hash.Hash) (*MerkleTree, error) {
+	f, err := s.Open(name + MerkleExt)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	t := &MerkleTree{
+		mech: mech,
+	}
+
+	if err := json.NewDecoder(f).Decode(t); err != nil {
+		return nil, &PathError{Op: "open", Path: name + MerkleExt, Err: err}
+	}
+
+	if t.ChunkSize <= 0 || t.Size < 0 {
+		return nil, &PathError{Op: "open", Path: name + MerkleExt, Err: ErrInvalid}
+	}
+
+	chunks := t.Size / int64(t.ChunkSize)
+
+	if t.Size%int64(t.ChunkSize) != 0 || chunks == 0 {
+		chunks++
+	}
+
+	if int64(len(t.Leaves)) != chunks {
+		return nil, &PathError{Op: "open", Path: name + MerkleExt, Err: ErrInvalid}
+	}
+
+	root, err := t.root()
+
+	if err != nil {
+		return nil, &PathError{Op: "open", Path: name + MerkleExt, Err: err}
+	}
+
+	if root != t.Root {
+		return nil, &ChecksumError{
+			Name:     name + MerkleExt,
+			Expected: t.Root,
+			Actual:   root,
+		}
+	}
+	return t, nil
+}
+
+// Reader returns a reader that reads the content of the file from r, checking
+// each chunk against its leaf before any of it is returned. A *ChecksumError
+// is returned for the first chunk that does not match, so a corrupt file is
+// caught as soon as the corrupt chunk is read, rather than at the end.
+func (t *MerkleTree) Reader(name string, r io.Reader) io.Reader {
+	return &merkleReader{
+		r:    r,
+		t:    t,
+		h:    t.mech(),
+		name: name,
+		buf:  make([]byte, t.ChunkSize),
+	}
+}
+
+type merkleReader struct {
+	r     io.Reader
+	t     *MerkleTree
+	h     hash.Hash
+	name  string
+	buf   []byte
+	chunk []byte
+	leaf  int
+	err   error
+}
+
+// next reads and checks the next chunk. A file that is shorter than its tree
+// results in io.ErrUnexpectedEOF, and one that is longer in a *ChecksumError.
+func (r *merkleReader) next() error {
+	n, err := io.ReadFull(r.r, r.buf)
+
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return err
+	}
+
+	// An empty file still has a single leaf, so is checked below.
+	if n == 0 && r.leaf > 0 {
+		if r.leaf < len(r.t.Leaves) {
+			return io.ErrUnexpectedEOF
+		}
+		return io.EOF
+	}
+
+	actual := hex.EncodeToString(merkleLeaf(r.h, r.buf[:n]))
+
+	if r.leaf >= len(r.t.Leaves) {
+		return &ChecksumError{
+			Name:     r.name,
+			Expected: "end of file",
+			Actual:   actual,
+		}
+	}
+
+	if expected := r.t.Leaves[r.leaf]; actual != expected {
+		return &ChecksumError{
+			Name:     r.name,
+			Expected: expected,
+			Actual:   actual,
+		}
+	}
+
+	r.leaf++
+	r.chunk = r.buf[:n]
+
+	if n == 0 {
+		return io.EOF
+	}
+	return nil
+}
+
+func (r *merkleReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+
+	if len(r.chunk) == 0 {
+		if err := r.next(); err != nil {
+			r.err = err
+			return 0, err
+		}
+	}
+
+	n := copy(p, r.chunk)
+	r.chunk = r.chunk[n:]
+
+	return n, nil
+}
+
+// merkleWriter computes the leaves of a Merkle tree from the content written
+// to it.
+type merkleWriter struct {
+	h      hash.Hash
+	mech   func() hash.Hash
+	buf    []byte
+	size   int64
+	leaves []string
+}
+
+func newMerkleWriter(mech func() hash.Hash, chunkSize int) *merkleWriter {
+	return &merkleWriter{
+		h:      mech(),
+		mech:   mech,
+		buf:    make([]byte, 0, chunkSize),
+		leaves: make([]string, 0),
+	}
+}
+
+func (w *merkleWriter) Write(p []byte) (int, error) {
+	n := len(p)
+
+	for len(p) > 0 {
+		m := copy(w.buf[len(w.buf):cap(w.buf)], p)
+
+		w.buf = w.buf[:len(w.buf)+m]
+		p = p[m:]
+
+		if len(w.buf) == cap(w.buf) {
+			w.leaves = append(w.leaves, hex.EncodeToString(merkleLeaf(w.h, w.buf)))
+			w.buf = w.buf[:0]
+		}
+	}
+
+	w.size += int64(n)
+	return n, nil
+}
+
+func (w *merkleWriter) tree() (*MerkleTree, error) {
+	if len(w.buf) > 0 || len(w.leaves) == 0 {
+		w.leaves = append(w.leaves, hex.EncodeToString(merkleLeaf(w.h, w.buf)))
+		w.buf = w.buf[:0]
+	}
+
+	t := &MerkleTree{
+		Size:      w.size,
+		ChunkSize: cap(w.buf),
+		Leaves:    w.leaves,
+		mech:      w.mech,
+	}
+
+	root, err := t.root()
+
+	if err != nil {
+		return nil, err
+	}
+
+	t.Root = root
+	return t, nil
+}
+
+// defaultMerkleChunkSize is the size of the chunks used by Merkle if the size
+// given is not positive.
+const defaultMerkleChunkSize = 64 << 10
+
+type merkleFS struct {
+	FS
+
+	mech      func() hash.Hash
+	chunkSize int
+}
+
+// Merkle returns a filesystem that writes a sidecar file containing the Merkle
+// tree of each file put in it, named after the file with MerkleExt appended.
+// The tree is built from chunks of the given size, or 64KB if the size is not
+// positive.
+//
+// Files opened from the filesystem are checked chunk by chunk as they are
+// read, and a *ChecksumError is returned as soon as a chunk does not match,
+// without returning any of the chunk. This lets large files be validated
+// progressively, unlike Checksum, which can only check a file once all of it
+// has been read. Files that do not have a sidecar are opened without being
+// checked. Sidecars are not listed by ReadDir.
+func Merkle(s FS, mech func() hash.Hash, chunkSize int) FS {
+	if chunkSize <= 0 {
+		chunkSize = defaultMerkleChunkSize
+	}
+
+	ms := &merkleFS{
+		FS:        s,
+		mech:      mech,
+		chunkSize: chunkSize,
+	}
+
+	if canRename(s) {
+		return renameMerkleFS{merkleFS: ms}
+	}
+	return ms
+}
+
+// renameMerkleFS is a merkleFS over a filesystem that implements RenameFS.
+type renameMerkleFS struct {
+	*merkleFS
+}
+
+// MerkleRoot returns the root of the Merkle tree of the named file, as stored
+// in its sidecar. This can be published alongside the file so that those
+// downloading it can check the tree before they check the file against it.
+func MerkleRoot(s FS, name string, mech func() hash.Hash) (string, error) {
+	t, err := ReadMerkleTree(s, name, mech)
+
+	if err != nil {
+		return "", err
+	}
+	return t.Root, nil
+}
+
+func (s *merkleFS) Unwrap() FS { return s.FS }
+
+func (s *merkleFS) Sub(dir string) (FS, error) {
+	fs, err := s.FS.Sub(dir)
+
+	if err != nil {
+		return nil, err
+	}
+	return Merkle(fs, s.mech, s.chunkSize), nil
+}
+
+type merkleFile struct {
+	File
+
+	r io.Reader
+}
+
+func (f *merkleFile) Read(p []byte) (int, error) { return f.r.Read(p) }
+
+func (s *merkleFS) Open(name string) (File, error) {
+	t, err := ReadMerkleTree(s.FS, name, s.mech)
+
+	if err != nil {
+		if errors.Is(err, ErrNotExist) {
+			return s.FS.Open(name)
+		}
+		return nil, err
+	}
+
+	f, err := s.FS.Open(name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &merkleFile{
+		File: f,
+		r:    t.Reader(name, f),
+	}, nil
+}
+
+func (s *merkleFS) Put(f File) (File, error) {
+	info, err := f.Stat()
+
+	if err != nil {
+		return nil, err
+	}
+
+	name := info.Name()
+
+	w := newMerkleWriter(s.mech, s.chunkSize)
+
+	stored, err := s.FS.Put(&hashReader{File: f, r: io.TeeReader(f, w)})
+
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := w.tree()
+
+	if err != nil {
+		stored.Close()
+		return nil, &PathError{Op: "put", Path: name, Err: err}
+	}
+
+	b, err := json.Marshal(t)
+
+	if err != nil {
+		stored.Close()
+		return nil, err
+	}
+
+	sidecar, err := ReadFile(name+MerkleExt, bytes.NewReader(b))
+
+	if err != nil {
+		stored.Close()
+		return nil, err
+	}
+
+	sc, err := s.FS.Put(sidecar)
+
+	if err != nil {
+		stored.Close()
+		return nil, err
+	}
+	sc.Close()
+
+	return stored, nil
+}
+
+func (s *merkleFS) ReadDir(name string) ([]DirEntry, error) {
+	ents, err := ReadDir(s.FS, name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	filtered := ents[:0]
+
+	for _, ent := range ents {
+		if !ent.IsDir() && strings.HasSuffix(ent.Name(), MerkleExt) {
+			continue
+		}
+		filtered = append(filtered, ent)
+	}
+	return filtered, nil
+}
+
+// Rename renames the file along with its sidecar.
+func (s renameMerkleFS) Rename(oldname, newname string) error {
+	if err := Move(s.FS, oldname, newname); err != nil {
+		return err
+	}
+
+	if err := Move(s.FS, oldname+MerkleExt, newname+MerkleExt); err != nil && !errors.Is(err, ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Remove removes the file along with its sidecar.
+func (s *merkleFS) Remove(name string) error {
+	if err := s.FS.Remove(name); err != nil {
+		return err
+	}
+
+	if err := s.FS.Remove(name + MerkleExt); err != nil && !errors.Is(err, ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *merkleFS) Metadata(name string) (Metadata, error) {
+	return GetMetadata(s.FS, name)
+}
+
+func (s *merkleFS) SetMetadata(name string, md Metadata) error {
+	return SetMetadata(s.FS, name, md)
+}
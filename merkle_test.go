@@ -0,0 +1,261 @@
+package fs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_Merkle(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	store := Merkle(New(dir), sha256.New, 1024)
+
+	buf := generateData(t, 4500)
+
+	f, err := ReadFile("file", bytes.NewReader(buf))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := store.Put(f)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored.Close()
+
+	tree, err := NewMerkleTree(bytes.NewReader(buf), sha256.New, 1024)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tree.Leaves) != 5 {
+		t.Fatalf("unexpected leaves, expected=%d, got=%d\n", 5, len(tree.Leaves))
+	}
+
+	root, err := MerkleRoot(store, "file", sha256.New)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if root != tree.Root {
+		t.Fatalf("unexpected root, expected=%q, got=%q\n", tree.Root, root)
+	}
+
+	f, err = store.Open("file")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := io.ReadAll(f)
+	f.Close()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(b, buf) {
+		t.Fatal("unexpected content")
+	}
+
+	ents, err := ReadDir(store, ".")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ents) != 1 || ents[0].Name() != "file" {
+		t.Fatalf("unexpected entries %v\n", ents)
+	}
+
+	// Corrupt a byte in the fourth chunk, the first three chunks should
+	// still be read before the error.
+	corrupt := append([]byte{}, buf...)
+	corrupt[3500] ^= 0xff
+
+	if err := os.WriteFile(filepath.Join(dir, "file"), corrupt, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err = store.Open("file")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err = io.ReadAll(f)
+	f.Close()
+
+	var cerr *ChecksumError
+
+	if !errors.As(err, &cerr) {
+		t.Fatalf("unexpected error, expected=%T, got=%v\n", cerr, err)
+	}
+
+	if len(b) != 3072 {
+		t.Fatalf("unexpected bytes read, expected=%d, got=%d\n", 3072, len(b))
+	}
+
+	// A truncated file is caught too.
+	if err := os.WriteFile(filepath.Join(dir, "file"), buf[:2048], 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err = store.Open("file")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = io.ReadAll(f)
+	f.Close()
+
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", io.ErrUnexpectedEOF, err)
+	}
+
+	if err := store.Remove("file"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "file"+MerkleExt)); !errors.Is(err, ErrNotExist) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", ErrNotExist, err)
+	}
+}
+
+func Test_MerkleTree(t *testing.T) {
+	tests := []int{0, 1, 1024, 1025, 8192}
+
+	for i, size := range tests {
+		buf := generateData(t, size)
+
+		tree, err := NewMerkleTree(bytes.NewReader(buf), sha256.New, 1024)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := io.ReadAll(tree.Reader("file", bytes.NewReader(buf)))
+
+		if err != nil {
+			t.Fatalf("tests[%d] - %s\n", i, err)
+		}
+
+		if !bytes.Equal(b, buf) {
+			t.Fatalf("tests[%d] - unexpected content\n", i)
+		}
+
+		// Trailing data does not match the tree.
+		_, err = io.ReadAll(tree.Reader("file", io.MultiReader(bytes.NewReader(buf), bytes.NewReader([]byte("x")))))
+
+		var cerr *ChecksumError
+
+		if !errors.As(err, &cerr) {
+			t.Fatalf("tests[%d] - unexpected error, expected=%T, got=%v\n", i, cerr, err)
+		}
+	}
+}
+
+func Test_MerkleSidecarTampered(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	store := Merkle(New(dir), sha256.New, 1024)
+
+	f, err := ReadFile("file", bytes.NewReader(generateData(t, 2048)))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := store.Put(f)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored.Close()
+
+	tree, err := NewMerkleTree(bytes.NewReader([]byte("other")), sha256.New, 1024)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sidecar, err := os.ReadFile(filepath.Join(dir, "file"+MerkleExt))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Swap a leaf without updating the root.
+	orig, err := ReadMerkleTree(New(dir), "file", sha256.New)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sidecar = bytes.Replace(sidecar, []byte(orig.Leaves[0]), []byte(tree.Leaves[0]), 1)
+
+	if err := os.WriteFile(filepath.Join(dir, "file"+MerkleExt), sidecar, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var cerr *ChecksumError
+
+	if _, err := store.Open("file"); !errors.As(err, &cerr) {
+		t.Fatalf("unexpected error, expected=%T, got=%v\n", cerr, err)
+	}
+}
+
+func Test_MerkleChunkSize(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	// A chunk size that is not positive uses the default.
+	store := Merkle(New(dir), sha256.New, 0)
+
+	f, err := ReadFile("file", bytes.NewReader(generateData(t, 2048)))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := store.Put(f)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored.Close()
+
+	tree, err := ReadMerkleTree(New(dir), "file", sha256.New)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tree.ChunkSize != defaultMerkleChunkSize {
+		t.Fatalf("unexpected chunk size, expected=%d, got=%d\n", defaultMerkleChunkSize, tree.ChunkSize)
+	}
+
+	// A sidecar with a chunk size of zero is invalid, rather than dividing
+	// by zero.
+	sidecar := []byte(`{"size":2048,"chunk_size":0,"leaves":[],"root":""}`)
+
+	if err := os.WriteFile(filepath.Join(dir, "file"+MerkleExt), sidecar, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.Open("file"); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", ErrInvalid, err)
+	}
+}
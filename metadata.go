@@ -0,0 +1,77 @@
+package fs
+
+// Metadata is a set of key-value pairs stored alongside a file, such as its
+// content type, origin, or checksum.
+type Metadata map[string]string
+
+// MetadataFS is the interface implemented by a filesystem that can store
+// metadata alongside the files stored in it.
+type MetadataFS interface {
+	FS
+
+	// Metadata returns the metadata of the named file. If the file has no
+	// metadata then an empty Metadata is returned.
+	Metadata(name string) (Metadata, error)
+
+	// SetMetadata sets the given metadata on the named file, keys that are
+	// not given are left as is. Keys with an empty value are removed.
+	SetMetadata(name string, md Metadata) error
+}
+
+// GetMetadata returns the metadata of the named file in the given filesystem.
+// If the filesystem does not implement MetadataFS then ErrUnsupported is
+// returned in the *PathError.
+func GetMetadata(s FS, name string) (Metadata, error) {
+	ms, ok := s.(MetadataFS)
+
+	if !ok {
+		return nil, &PathError{Op: "metadata", Path: name, Err: ErrUnsupported}
+	}
+	return ms.Metadata(name)
+}
+
+// SetMetadata sets the given metadata on the named file in the given
+// filesystem. If the filesystem does not implement MetadataFS then
+// ErrUnsupported is returned in the *PathError.
+func SetMetadata(s FS, name string, md Metadata) error {
+	ms, ok := s.(MetadataFS)
+
+	if !ok {
+		return &PathError{Op: "setmetadata", Path: name, Err: ErrUnsupported}
+	}
+	return ms.SetMetadata(name, md)
+}
+
+// Metadata returns the metadata of the named file from its extended
+// attributes in the user namespace, with the "user." prefix removed. This is
+// only supported on Linux, and requires a filesystem that supports extended
+// attributes.
+func (s filesystem) Metadata(name string) (Metadata, error) {
+	if err := s.check(name); err != nil {
+		return nil, &PathError{Op: "metadata", Path: name, Err: err}
+	}
+
+	md, err := getxattrs(s.path(name))
+
+	if err != nil {
+		return nil, &PathError{Op: "metadata", Path: name, Err: err}
+	}
+	return md, nil
+}
+
+// SetMetadata sets the metadata of the named file as extended attributes in
+// the user namespace.
+func (s filesystem) SetMetadata(name string, md Metadata) error {
+	if err := s.check(name); err != nil {
+		return &PathError{Op: "setmetadata", Path: name, Err: err}
+	}
+
+	path := s.path(name)
+
+	for k, v := range md {
+		if err := setxattr(path, k, v); err != nil {
+			return &PathError{Op: "setmetadata", Path: name, Err: err}
+		}
+	}
+	return nil
+}
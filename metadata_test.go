@@ -0,0 +1,65 @@
+package fs
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func Test_Metadata(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	store := Limit(New(dir), 1<<20)
+
+	f, err := ReadFile("file", bytes.NewReader([]byte("data")))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := store.Put(f)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored.Close()
+
+	md := Metadata{
+		"content-type": "text/plain",
+		"origin":       "https://example.com",
+	}
+
+	if err := SetMetadata(store, "file", md); err != nil {
+		if errors.Is(err, ErrUnsupported) {
+			t.Skip("extended attributes are not supported")
+		}
+		t.Fatal(err)
+	}
+
+	if err := SetMetadata(store, "file", Metadata{"origin": ""}); err != nil {
+		t.Fatal(err)
+	}
+
+	delete(md, "origin")
+
+	got, err := GetMetadata(store, "file")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(got, md) {
+		t.Fatalf("unexpected metadata, expected=%v, got=%v\n", md, got)
+	}
+
+	if err := SetMetadata(ReadOnly(store), "file", md); !errors.Is(err, ErrPermission) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", ErrPermission, err)
+	}
+
+	if _, err := GetMetadata(Null(), "file"); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", ErrUnsupported, err)
+	}
+}
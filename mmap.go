@@ -0,0 +1,12 @@
+package fs
+
+// MMap configures the FS to memory map the regular files that are opened via
+// Open. The returned File implements io.ReaderAt and io.Seeker, and reads are
+// served directly from the mapped memory, avoiding a syscall per read. This
+// is only supported on Unix systems, on other systems files are opened as
+// normal.
+func MMap() Option {
+	return func(s *filesystem) {
+		s.mmap = true
+	}
+}
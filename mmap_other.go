@@ -0,0 +1,13 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd)
+
+package fs
+
+import (
+	"os"
+)
+
+// openMmap opens the named file as normal, since memory mapping is not
+// supported on this platform.
+func openMmap(name string) (File, error) {
+	return os.Open(name)
+}
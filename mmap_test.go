@@ -0,0 +1,66 @@
+package fs
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_MMap(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	buf := generateData(t, 1<<20)
+
+	if err := os.WriteFile(filepath.Join(dir, "file"), buf, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	store := New(dir, MMap())
+
+	f, err := store.Open("file")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	ra, ok := f.(io.ReaderAt)
+
+	if !ok {
+		t.Fatalf("unexpected type, expected file to implement io.ReaderAt, got=%T\n", f)
+	}
+
+	p := make([]byte, 4096)
+
+	if _, err := ra.ReadAt(p, 8192); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(p, buf[8192:8192+4096]) {
+		t.Fatal("unexpected content from ReadAt")
+	}
+
+	b, err := io.ReadAll(f)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(b, buf) {
+		t.Fatal("unexpected content from Read")
+	}
+
+	sub, err := store.Sub("sub")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !sub.(filesystem).mmap {
+		t.Fatal("expected Sub to keep the MMap option, it did not")
+	}
+}
@@ -0,0 +1,133 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+
+package fs
+
+import (
+	"io"
+	"os"
+	"syscall"
+)
+
+// mmapFile is a read-only file whose contents are memory mapped.
+type mmapFile struct {
+	*os.File
+
+	data []byte
+	off  int64
+}
+
+// openMmap opens the named file and memory maps it. Empty files and anything
+// that is not a regular file are returned as a plain *os.File, since they
+// cannot be mapped.
+func openMmap(name string) (File, error) {
+	f, err := os.Open(name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := f.Stat()
+
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	size := info.Size()
+
+	if !info.Mode().IsRegular() || size == 0 || size != int64(int(size)) {
+		return f, nil
+	}
+
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+
+	if err != nil {
+		f.Close()
+		return nil, &PathError{Op: "mmap", Path: name, Err: err}
+	}
+
+	return &mmapFile{
+		File: f,
+		data: data,
+	}, nil
+}
+
+func (f *mmapFile) Read(p []byte) (int, error) {
+	if f.data == nil {
+		return 0, &PathError{Op: "read", Path: f.Name(), Err: ErrClosed}
+	}
+	if f.off >= int64(len(f.data)) {
+		return 0, io.EOF
+	}
+
+	n := copy(p, f.data[f.off:])
+	f.off += int64(n)
+
+	return n, nil
+}
+
+func (f *mmapFile) ReadAt(p []byte, off int64) (int, error) {
+	if f.data == nil {
+		return 0, &PathError{Op: "read", Path: f.Name(), Err: ErrClosed}
+	}
+	if off < 0 {
+		return 0, &PathError{Op: "read", Path: f.Name(), Err: ErrInvalid}
+	}
+	if off >= int64(len(f.data)) {
+		return 0, io.EOF
+	}
+
+	n := copy(p, f.data[off:])
+
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (f *mmapFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.off
+	case io.SeekEnd:
+		offset += int64(len(f.data))
+	default:
+		return 0, &PathError{Op: "seek", Path: f.Name(), Err: ErrInvalid}
+	}
+
+	if offset < 0 {
+		return 0, &PathError{Op: "seek", Path: f.Name(), Err: ErrInvalid}
+	}
+
+	f.off = offset
+	return offset, nil
+}
+
+func (f *mmapFile) WriteTo(w io.Writer) (int64, error) {
+	if f.data == nil {
+		return 0, &PathError{Op: "read", Path: f.Name(), Err: ErrClosed}
+	}
+	if f.off >= int64(len(f.data)) {
+		return 0, nil
+	}
+
+	n, err := w.Write(f.data[f.off:])
+	f.off += int64(n)
+
+	return int64(n), err
+}
+
+func (f *mmapFile) Close() error {
+	if f.data == nil {
+		return &PathError{Op: "close", Path: f.Name(), Err: ErrClosed}
+	}
+
+	err := syscall.Munmap(f.data)
+	f.data = nil
+
+	if cerr := f.File.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
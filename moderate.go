@@ -0,0 +1,276 @@
+package fs
+
+import (
+	"errors"
+	"path"
+	"strings"
+)
+
+// pendingDir is the directory files awaiting moderation are kept in.
+const pendingDir = ".pending"
+
+// ModerateFS is the interface implemented by a filesystem that holds the files
+// put in it for approval.
+type ModerateFS interface {
+	FS
+
+	// Pending returns the files awaiting approval, sorted by name.
+	Pending() ([]FileInfo, error)
+
+	// Approve makes the named pending file available to Open.
+	Approve(name string) error
+
+	// Reject removes the named pending file.
+	Reject(name string) error
+}
+
+// Pending returns the files awaiting approval in the given filesystem. If the
+// filesystem does not implement ModerateFS then ErrUnsupported is returned in
+// the *PathError.
+func Pending(s FS) ([]FileInfo, error) {
+	ms, ok := s.(ModerateFS)
+
+	if !ok {
+		return nil, &PathError{Op: "pending", Path: ".", Err: ErrUnsupported}
+	}
+	return ms.Pending()
+}
+
+// Approve approves the named pending file in the given filesystem. If the
+// filesystem does not implement ModerateFS then ErrUnsupported is returned in
+// the *PathError.
+func Approve(s FS, name string) error {
+	ms, ok := s.(ModerateFS)
+
+	if !ok {
+		return &PathError{Op: "approve", Path: name, Err: ErrUnsupported}
+	}
+	return ms.Approve(name)
+}
+
+// Reject rejects the named pending file in the given filesystem. If the
+// filesystem does not implement ModerateFS then ErrUnsupported is returned in
+// the *PathError.
+func Reject(s FS, name string) error {
+	ms, ok := s.(ModerateFS)
+
+	if !ok {
+		return &PathError{Op: "reject", Path: name, Err: ErrUnsupported}
+	}
+	return ms.Reject(name)
+}
+
+type moderateFS struct {
+	FS
+}
+
+// Moderate returns a filesystem that holds each file put in it as pending,
+// until it is approved via Approve, or rejected via Reject. Pending files are
+// kept in a ".pending" directory of the filesystem, and cannot be opened
+// until they are approved. A file that is pending under the name of an
+// existing file does not replace it until it is approved. The pending
+// directory is not listed by ReadDir. The filesystem must implement
+// ReadDirFS for Pending.
+func Moderate(s FS) FS {
+	ms := &moderateFS{
+		FS: s,
+	}
+
+	if canRename(s) {
+		return renameModerateFS{moderateFS: ms}
+	}
+	return ms
+}
+
+// renameModerateFS is a moderateFS over a filesystem that implements RenameFS.
+type renameModerateFS struct {
+	*moderateFS
+}
+
+// hideDir returns the entries without the named directory.
+func hideDir(ents []DirEntry, name string) []DirEntry {
+	filtered := ents[:0]
+
+	for _, ent := range ents {
+		if ent.IsDir() && ent.Name() == name {
+			continue
+		}
+		filtered = append(filtered, ent)
+	}
+	return filtered
+}
+
+func (s *moderateFS) Unwrap() FS { return s.FS }
+
+func (s *moderateFS) Sub(dir string) (FS, error) {
+	if err := checkPending("sub", dir); err != nil {
+		return nil, err
+	}
+
+	sub, err := s.FS.Sub(dir)
+
+	if err != nil {
+		return nil, err
+	}
+	return Moderate(sub), nil
+}
+
+func pendingName(name string) string {
+	return pendingDir + "/" + name
+}
+
+// checkPending returns ErrNotExist in a *PathError if the name refers to the
+// pending directory, so it cannot be reached through the filesystem. The name
+// is cleaned first, so the directory cannot be reached via names such as
+// "./.pending" either.
+func checkPending(op, name string) error {
+	clean := strings.TrimPrefix(path.Clean(name), "/")
+
+	if clean == pendingDir || strings.HasPrefix(clean, pendingDir+"/") {
+		return &PathError{Op: op, Path: name, Err: ErrNotExist}
+	}
+	return nil
+}
+
+func (s *moderateFS) Open(name string) (File, error) {
+	if err := checkPending("open", name); err != nil {
+		return nil, err
+	}
+	return s.FS.Open(name)
+}
+
+func (s *moderateFS) Stat(name string) (FileInfo, error) {
+	if err := checkPending("stat", name); err != nil {
+		return nil, err
+	}
+	return s.FS.Stat(name)
+}
+
+// Put puts the file in the pending directory, and returns it as it is stored
+// there.
+func (s *moderateFS) Put(f File) (File, error) {
+	pending, err := s.FS.Sub(pendingDir)
+
+	if err != nil {
+		return nil, err
+	}
+	return pending.Put(f)
+}
+
+func (s *moderateFS) ReadDir(name string) ([]DirEntry, error) {
+	if err := checkPending("readdir", name); err != nil {
+		return nil, err
+	}
+
+	ents, err := ReadDir(s.FS, name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if path.Clean(name) == "." {
+		ents = hideDir(ents, pendingDir)
+	}
+	return ents, nil
+}
+
+func (s *moderateFS) Pending() ([]FileInfo, error) {
+	ents, err := ReadDir(s.FS, pendingDir)
+
+	if err != nil {
+		if errors.Is(err, ErrNotExist) {
+			return []FileInfo{}, nil
+		}
+		return nil, err
+	}
+
+	infos := make([]FileInfo, 0, len(ents))
+
+	for _, ent := range ents {
+		if ent.IsDir() {
+			continue
+		}
+
+		info, err := ent.Info()
+
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// Approve moves the pending file into the filesystem, replacing any existing
+// file of the same name. If the filesystem cannot rename files, then the file
+// is copied and the pending file removed.
+func (s *moderateFS) Approve(name string) error {
+	if strings.Contains(name, "/") {
+		return &PathError{Op: "approve", Path: name, Err: ErrNotExist}
+	}
+
+	err := Move(s.FS, pendingName(name), name)
+
+	if err == nil {
+		return nil
+	}
+
+	if !errors.Is(err, ErrUnsupported) {
+		return err
+	}
+
+	f, err := s.FS.Open(pendingName(name))
+
+	if err != nil {
+		return err
+	}
+
+	stored, err := s.FS.Put(f)
+	f.Close()
+
+	if err != nil {
+		return err
+	}
+	stored.Close()
+
+	return s.FS.Remove(pendingName(name))
+}
+
+func (s *moderateFS) Reject(name string) error {
+	if strings.Contains(name, "/") {
+		return &PathError{Op: "reject", Path: name, Err: ErrNotExist}
+	}
+	return s.FS.Remove(pendingName(name))
+}
+
+func (s renameModerateFS) Rename(oldname, newname string) error {
+	if err := checkPending("rename", oldname); err != nil {
+		return err
+	}
+
+	if err := checkPending("rename", newname); err != nil {
+		return err
+	}
+	return Move(s.FS, oldname, newname)
+}
+
+func (s *moderateFS) Metadata(name string) (Metadata, error) {
+	if err := checkPending("metadata", name); err != nil {
+		return nil, err
+	}
+	return GetMetadata(s.FS, name)
+}
+
+func (s *moderateFS) SetMetadata(name string, md Metadata) error {
+	if err := checkPending("setmetadata", name); err != nil {
+		return err
+	}
+	return SetMetadata(s.FS, name, md)
+}
+
+func (s *moderateFS) Remove(name string) error {
+	if err := checkPending("remove", name); err != nil {
+		return err
+	}
+	return s.FS.Remove(name)
+}
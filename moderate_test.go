@@ -0,0 +1,84 @@
+package fs
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+)
+
+func Test_Moderate(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	store := Moderate(New(dir))
+
+	for _, name := range []string{"cat.jpg", "spam.jpg"} {
+		f, err := ReadFile(name, bytes.NewReader([]byte(name)))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		stored, err := store.Put(f)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+		stored.Close()
+	}
+
+	if _, err := store.Open("cat.jpg"); !errors.Is(err, ErrNotExist) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", ErrNotExist, err)
+	}
+
+	for _, name := range []string{".pending/cat.jpg", "./.pending/cat.jpg", "a/../.pending/cat.jpg"} {
+		if _, err := store.Open(name); !errors.Is(err, ErrNotExist) {
+			t.Fatalf("%s - unexpected error, expected=%q, got=%v\n", name, ErrNotExist, err)
+		}
+
+		if _, err := store.Stat(name); !errors.Is(err, ErrNotExist) {
+			t.Fatalf("%s - unexpected error, expected=%q, got=%v\n", name, ErrNotExist, err)
+		}
+	}
+
+	if _, err := ReadDir(store, "./.pending"); !errors.Is(err, ErrNotExist) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", ErrNotExist, err)
+	}
+
+	pending, err := Pending(store)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(pending) != 2 {
+		t.Fatalf("unexpected pending files, expected=%d, got=%d\n", 2, len(pending))
+	}
+
+	if err := Approve(store, "cat.jpg"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Reject(store, "spam.jpg"); err != nil {
+		t.Fatal(err)
+	}
+
+	if b := readAll(t, store, "cat.jpg"); string(b) != "cat.jpg" {
+		t.Fatalf("unexpected data, expected=%q, got=%q\n", "cat.jpg", string(b))
+	}
+
+	ents, err := ReadDir(store, ".")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ents) != 1 || ents[0].Name() != "cat.jpg" {
+		t.Fatalf("unexpected entries, expected=%q, got=%v\n", "cat.jpg", ents)
+	}
+
+	if pending, _ := Pending(store); len(pending) != 0 {
+		t.Fatalf("unexpected pending files, expected=%d, got=%d\n", 0, len(pending))
+	}
+}
@@ -0,0 +1,313 @@
+package fs
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"path"
+	"sort"
+	"strings"
+)
+
+// nameBlock is the size plaintext names are padded to a multiple of, so the
+// length of an encrypted name only reveals the length of the plaintext name to
+// within this many bytes.
+const nameBlock = 16
+
+// nameCipher deterministically encrypts names. The nonce for each name is
+// derived from an HMAC of the name, as in SIV, so the same name always
+// encrypts to the same ciphertext, and the nonce is checked against the
+// decrypted name.
+type nameCipher struct {
+	aead cipher.AEAD
+	mac  []byte
+}
+
+func newNameCipher(key []byte) (*nameCipher, error) {
+	derive := func(label string) []byte {
+		h := hmac.New(sha256.New, key)
+		h.Write([]byte(label))
+		return h.Sum(nil)[:len(key)]
+	}
+
+	block, err := aes.NewCipher(derive("fs name encryption"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &nameCipher{
+		aead: aead,
+		mac:  derive("fs name nonce"),
+	}, nil
+}
+
+func (c *nameCipher) nonce(plaintext []byte) []byte {
+	h := hmac.New(sha256.New, c.mac)
+	h.Write(plaintext)
+	return h.Sum(nil)[:c.aead.NonceSize()]
+}
+
+// pad pads the given name to a multiple of nameBlock with a single 0x80 byte
+// followed by zeros.
+func pad(name string) []byte {
+	n := (len(name)/nameBlock + 1) * nameBlock
+
+	b := make([]byte, n)
+	copy(b, name)
+	b[len(name)] = 0x80
+
+	return b
+}
+
+func unpad(b []byte) (string, bool) {
+	i := bytes.LastIndexByte(b, 0x80)
+
+	if i < 0 {
+		return "", false
+	}
+
+	for _, c := range b[i+1:] {
+		if c != 0 {
+			return "", false
+		}
+	}
+	return string(b[:i]), true
+}
+
+func (c *nameCipher) encrypt(name string) string {
+	plaintext := pad(name)
+	nonce := c.nonce(plaintext)
+
+	return Base32Encoding(c.aead.Seal(nonce, nonce, plaintext, nil))
+}
+
+func (c *nameCipher) decrypt(name string) (string, bool) {
+	b, err := base32Encoding.DecodeString(strings.ToUpper(name))
+
+	if err != nil || len(b) < c.aead.NonceSize() {
+		return "", false
+	}
+
+	nonce, ciphertext := b[:c.aead.NonceSize()], b[c.aead.NonceSize():]
+
+	plaintext, err := c.aead.Open(nil, nonce, ciphertext, nil)
+
+	if err != nil || !hmac.Equal(nonce, c.nonce(plaintext)) {
+		return "", false
+	}
+	return unpad(plaintext)
+}
+
+// encryptPath encrypts each element of the given slash separated path.
+func (c *nameCipher) encryptPath(name string) string {
+	parts := strings.Split(name, "/")
+
+	for i, part := range parts {
+		if part == "" || part == "." || part == ".." {
+			continue
+		}
+		parts[i] = c.encrypt(part)
+	}
+	return strings.Join(parts, "/")
+}
+
+type namedInfo struct {
+	FileInfo
+
+	name string
+}
+
+func (i *namedInfo) Name() string { return i.name }
+
+type namedDirEntry struct {
+	DirEntry
+
+	name string
+}
+
+func (e *namedDirEntry) Name() string { return e.name }
+
+func (e *namedDirEntry) Info() (FileInfo, error) {
+	info, err := e.DirEntry.Info()
+
+	if err != nil {
+		return nil, err
+	}
+	return &namedInfo{FileInfo: info, name: e.name}, nil
+}
+
+type encryptedNames struct {
+	FS
+
+	cipher *nameCipher
+}
+
+// EncryptNames returns a filesystem that encrypts the names of the files and
+// directories stored in the given filesystem, so the underlying storage learns
+// nothing of the names other than their approximate length. Names are
+// encrypted deterministically with AES-GCM, using a nonce derived from an HMAC
+// of the name, so the same name always encrypts to the same name in storage.
+// This means files can be looked up by name without a separate mapping, and
+// ReadDir decrypts names directly. Entries that cannot be decrypted with the
+// key, such as files put directly in the underlying filesystem, are omitted
+// from ReadDir.
+//
+// The key must be 16, 24, or 32 bytes long. Encrypted names are encoded as
+// lowercase base32, so they are longer than the original names, which may
+// exceed the limits on name length for some filesystems.
+func EncryptNames(s FS, key []byte) (FS, error) {
+	c, err := newNameCipher(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return newEncryptedNames(s, c), nil
+}
+
+// renameEncryptedNames is encryptedNames over a filesystem that implements
+// RenameFS.
+type renameEncryptedNames struct {
+	*encryptedNames
+}
+
+func newEncryptedNames(s FS, c *nameCipher) FS {
+	es := &encryptedNames{
+		FS:     s,
+		cipher: c,
+	}
+
+	if canRename(s) {
+		return renameEncryptedNames{encryptedNames: es}
+	}
+	return es
+}
+
+// pathError returns the given error as a *PathError for the given plaintext
+// name, so encrypted names are not leaked in errors.
+func (s *encryptedNames) pathError(op, name string, err error) error {
+	var perr *PathError
+
+	if errors.As(err, &perr) {
+		err = perr.Err
+	}
+	return &PathError{Op: op, Path: name, Err: err}
+}
+
+func (s *encryptedNames) Unwrap() FS { return s.FS }
+
+func (s *encryptedNames) Open(name string) (File, error) {
+	f, err := s.FS.Open(s.cipher.encryptPath(name))
+
+	if err != nil {
+		return nil, s.pathError("open", name, err)
+	}
+	return Rename(f, path.Base(name)), nil
+}
+
+func (s *encryptedNames) Sub(dir string) (FS, error) {
+	sub, err := s.FS.Sub(s.cipher.encryptPath(dir))
+
+	if err != nil {
+		return nil, s.pathError("sub", dir, err)
+	}
+
+	return newEncryptedNames(sub, s.cipher), nil
+}
+
+func (s *encryptedNames) Stat(name string) (FileInfo, error) {
+	info, err := s.FS.Stat(s.cipher.encryptPath(name))
+
+	if err != nil {
+		return nil, s.pathError("stat", name, err)
+	}
+	return &namedInfo{FileInfo: info, name: path.Base(name)}, nil
+}
+
+func (s *encryptedNames) Put(f File) (File, error) {
+	info, err := f.Stat()
+
+	if err != nil {
+		return nil, err
+	}
+
+	name := info.Name()
+
+	stored, err := s.FS.Put(Rename(f, s.cipher.encryptPath(name)))
+
+	if err != nil {
+		return nil, s.pathError("put", name, err)
+	}
+	return Rename(stored, path.Base(name)), nil
+}
+
+func (s *encryptedNames) ReadDir(name string) ([]DirEntry, error) {
+	ents, err := ReadDir(s.FS, s.cipher.encryptPath(name))
+
+	if err != nil {
+		return nil, s.pathError("readdir", name, err)
+	}
+
+	decrypted := make([]DirEntry, 0, len(ents))
+
+	for _, ent := range ents {
+		plain, ok := s.cipher.decrypt(ent.Name())
+
+		if !ok {
+			continue
+		}
+		decrypted = append(decrypted, &namedDirEntry{DirEntry: ent, name: plain})
+	}
+
+	sort.Slice(decrypted, func(i, j int) bool {
+		return decrypted[i].Name() < decrypted[j].Name()
+	})
+	return decrypted, nil
+}
+
+func (s renameEncryptedNames) Rename(oldname, newname string) error {
+	if err := Move(s.FS, s.cipher.encryptPath(oldname), s.cipher.encryptPath(newname)); err != nil {
+		return s.pathError("rename", oldname, err)
+	}
+	return nil
+}
+
+func (s *encryptedNames) Link(oldname, newname string) error {
+	if err := Link(s.FS, s.cipher.encryptPath(oldname), s.cipher.encryptPath(newname)); err != nil {
+		return s.pathError("link", oldname, err)
+	}
+	return nil
+}
+
+func (s *encryptedNames) Remove(name string) error {
+	if err := s.FS.Remove(s.cipher.encryptPath(name)); err != nil {
+		return s.pathError("remove", name, err)
+	}
+	return nil
+}
+
+func (s *encryptedNames) Metadata(name string) (Metadata, error) {
+	md, err := GetMetadata(s.FS, s.cipher.encryptPath(name))
+
+	if err != nil {
+		return nil, s.pathError("metadata", name, err)
+	}
+	return md, nil
+}
+
+func (s *encryptedNames) SetMetadata(name string, md Metadata) error {
+	if err := SetMetadata(s.FS, s.cipher.encryptPath(name), md); err != nil {
+		return s.pathError("setmetadata", name, err)
+	}
+	return nil
+}
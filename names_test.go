@@ -0,0 +1,161 @@
+package fs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func Test_EncryptNames(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	key := bytes.Repeat([]byte{1}, 32)
+
+	store, err := EncryptNames(New(dir), key)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sub, err := store.Sub("invoices")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := []string{"2023.pdf", "2024.pdf", "a much longer name for a file.txt"}
+
+	for _, name := range names {
+		f, err := ReadFile(name, bytes.NewReader([]byte(name)))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		stored, err := sub.Put(f)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		info, err := stored.Stat()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if info.Name() != name {
+			t.Fatalf("unexpected name, expected=%q, got=%q\n", name, info.Name())
+		}
+		stored.Close()
+	}
+
+	// Nothing of the names should be visible in the underlying directory.
+	ents, err := os.ReadDir(dir)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ents) != 1 || strings.Contains(ents[0].Name(), "invoices") {
+		t.Fatalf("unexpected entries in underlying directory %v\n", ents)
+	}
+
+	f, err := store.Open("invoices/2024.pdf")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	b, err := io.ReadAll(f)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(b) != "2024.pdf" {
+		t.Fatalf("unexpected content, expected=%q, got=%q\n", "2024.pdf", string(b))
+	}
+
+	// A file that cannot be decrypted is omitted from ReadDir.
+	if err := os.WriteFile(dir+"/plain", nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	dirents, err := ReadDir(store, ".")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(dirents) != 1 || dirents[0].Name() != "invoices" {
+		t.Fatalf("unexpected entries %v\n", dirents)
+	}
+
+	dirents, err = ReadDir(sub, ".")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(dirents) != len(names) {
+		t.Fatalf("unexpected entries, expected=%d, got=%d\n", len(names), len(dirents))
+	}
+
+	for i, ent := range dirents {
+		if ent.Name() != names[i] {
+			t.Fatalf("unexpected name, expected=%q, got=%q\n", names[i], ent.Name())
+		}
+	}
+
+	if _, err := sub.Stat("missing"); !errors.Is(err, ErrNotExist) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", ErrNotExist, err)
+	}
+}
+
+func Test_EncryptNamesDeterministic(t *testing.T) {
+	c, err := newNameCipher(bytes.Repeat([]byte{1}, 16))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := newNameCipher(bytes.Repeat([]byte{2}, 16))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []string{"", "a", "file.txt", "exactly16bytes!!", strings.Repeat("x", 40)}
+
+	for i, name := range tests {
+		enc := c.encrypt(name)
+
+		if enc != c.encrypt(name) {
+			t.Fatalf("tests[%d] - expected encryption to be deterministic\n", i)
+		}
+
+		plain, ok := c.decrypt(enc)
+
+		if !ok {
+			t.Fatalf("tests[%d] - failed to decrypt %q\n", i, enc)
+		}
+
+		if plain != name {
+			t.Fatalf("tests[%d] - unexpected name, expected=%q, got=%q\n", i, name, plain)
+		}
+
+		if _, ok := other.decrypt(enc); ok {
+			t.Fatalf("tests[%d] - expected decryption with another key to fail\n", i)
+		}
+	}
+
+	if len(c.encrypt("a")) != len(c.encrypt("abcdefghijklmno")) {
+		t.Fatal("expected names within the same block to encrypt to the same length")
+	}
+}
@@ -0,0 +1,128 @@
+package fs
+
+import (
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// NullOption configures the FS returned from Null.
+type NullOption func(*nullFS)
+
+// NullCalls counts the calls made to the FS returned from Null, by operation.
+// It is safe for concurrent use.
+type NullCalls struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func (c *NullCalls) add(op string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.counts == nil {
+		c.counts = make(map[string]int)
+	}
+	c.counts[op]++
+}
+
+// Count returns the number of calls made for the given operation, one of
+// "open", "sub", "stat", "put", "readdir", "rename", or "remove".
+func (c *NullCalls) Count(op string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.counts[op]
+}
+
+// NullContent configures Null to return files of the given size from Open and
+// Stat, with content derived from the given seed. Every file opened has the
+// same content.
+func NullContent(size, seed int64) NullOption {
+	return func(s *nullFS) {
+		s.size = size
+		s.seed = seed
+	}
+}
+
+// NullDrain configures Null to read the entirety of each file that is put in
+// it, as a real filesystem would, so that the cost of producing the file is
+// measured.
+func NullDrain() NullOption {
+	return func(s *nullFS) {
+		s.drain = true
+	}
+}
+
+// NullFail configures Null to return the given error, in a *PathError, for
+// every call of the given operation. See NullCalls.Count for the operations.
+func NullFail(op string, err error) NullOption {
+	return func(s *nullFS) {
+		s.fail[op] = err
+	}
+}
+
+// NullCount configures Null to count the calls made to it in the given
+// NullCalls.
+func NullCount(c *NullCalls) NullOption {
+	return func(s *nullFS) {
+		s.calls = c
+	}
+}
+
+// call records a call of the given operation, and returns the error it has
+// been configured to fail with, if any.
+func (s nullFS) call(op, name string) error {
+	if s.calls != nil {
+		s.calls.add(op)
+	}
+
+	if err, ok := s.fail[op]; ok {
+		return &PathError{Op: op, Path: name, Err: err}
+	}
+	return nil
+}
+
+// nullFile is a File whose content is generated from a seed as it is read.
+type nullFile struct {
+	name    string
+	size    int64
+	off     int64
+	rand    *rand.Rand
+	modTime time.Time
+}
+
+func newNullFile(name string, size, seed int64) *nullFile {
+	return &nullFile{
+		name:    name,
+		size:    size,
+		rand:    rand.New(rand.NewSource(seed)),
+		modTime: time.Now(),
+	}
+}
+
+func (f *nullFile) Stat() (FileInfo, error) { return f, nil }
+
+func (f *nullFile) Read(p []byte) (int, error) {
+	if f.off >= f.size {
+		return 0, io.EOF
+	}
+
+	if rem := f.size - f.off; int64(len(p)) > rem {
+		p = p[:rem]
+	}
+
+	n, _ := f.rand.Read(p)
+	f.off += int64(n)
+
+	return n, nil
+}
+
+func (f *nullFile) Close() error       { return nil }
+func (f *nullFile) Name() string       { return f.name }
+func (f *nullFile) Size() int64        { return f.size }
+func (f *nullFile) Mode() FileMode     { return FileMode(0400) }
+func (f *nullFile) ModTime() time.Time { return f.modTime }
+func (f *nullFile) IsDir() bool        { return false }
+func (f *nullFile) Sys() any           { return nil }
@@ -0,0 +1,82 @@
+package fs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func Test_NullContent(t *testing.T) {
+	store := Null(NullContent(4096, 42))
+
+	read := func() []byte {
+		f, err := store.Open("file")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer f.Close()
+
+		b, err := io.ReadAll(f)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	a := read()
+	b := read()
+
+	if len(a) != 4096 {
+		t.Fatalf("unexpected size, expected=%d, got=%d\n", 4096, len(a))
+	}
+
+	if !bytes.Equal(a, b) {
+		t.Fatal("expected the same content for the same seed")
+	}
+
+	info, err := store.Stat("file")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Size() != 4096 {
+		t.Fatalf("unexpected size, expected=%d, got=%d\n", 4096, info.Size())
+	}
+}
+
+func Test_NullFailCount(t *testing.T) {
+	var calls NullCalls
+
+	errFail := errors.New("fail")
+
+	store := Null(NullFail("put", errFail), NullCount(&calls), NullDrain())
+
+	f, err := ReadFile("file", bytes.NewReader([]byte("data")))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.Put(f); !errors.Is(err, errFail) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", errFail, err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := store.Stat("file"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n := calls.Count("put"); n != 1 {
+		t.Fatalf("unexpected put count, expected=%d, got=%d\n", 1, n)
+	}
+
+	if n := calls.Count("stat"); n != 3 {
+		t.Fatalf("unexpected stat count, expected=%d, got=%d\n", 3, n)
+	}
+}
@@ -0,0 +1,563 @@
+// Package outbox implements store-and-forward of files to an FS over an
+// unreliable connection.
+//
+// Each Put and Remove made on an Outbox is first recorded in a queue in a
+// local FS, and is then shipped to the remote FS in the background. Operations
+// are shipped strictly in the order they were made, and a failed operation is
+// retried until it succeeds before any operation after it is shipped. The
+// queue survives restarts, so the local FS should be durable, for example,
+//
+//	local := fs.New("/var/spool/outbox", fs.Durable())
+//
+// Delivery is at least once, if the process stops after an operation is
+// shipped but before it is removed from the queue, then it is shipped again
+// on restart.
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andrewpillar/fs"
+)
+
+const (
+	opPut    = "put"
+	opRemove = "remove"
+
+	dataExt     = ".data"
+	manifestExt = ".json"
+)
+
+// entry is a single operation in the queue. The manifest of each entry is
+// stored in the local FS alongside the data of the file, if any.
+type entry struct {
+	Seq  uint64 `json:"seq"`
+	Op   string `json:"op"`
+	Dir  string `json:"dir,omitempty"`
+	Name string `json:"name"`
+}
+
+func (e entry) key() string {
+	return path.Join(e.Dir, e.Name)
+}
+
+func seqName(seq uint64, ext string) string {
+	return fmt.Sprintf("%020d%s", seq, ext)
+}
+
+type queue struct {
+	local  fs.FS
+	remote fs.FS
+
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	onError    func(error)
+
+	mu      sync.Mutex
+	seq     uint64
+	entries []entry
+	latest  map[string]entry
+
+	ship   sync.Mutex
+	notify chan struct{}
+}
+
+// Option configures an Outbox.
+type Option func(*queue)
+
+// Backoff sets the minimum and maximum time to wait before retrying an
+// operation that failed to ship. The wait doubles after each failure. The
+// defaults are 1 second and 5 minutes.
+func Backoff(min, max time.Duration) Option {
+	return func(q *queue) {
+		if min > 0 {
+			q.minBackoff = min
+		}
+		if max >= q.minBackoff {
+			q.maxBackoff = max
+		}
+	}
+}
+
+// OnError sets the function called with each error encountered when shipping
+// operations in Run.
+func OnError(fn func(error)) Option {
+	return func(q *queue) {
+		q.onError = fn
+	}
+}
+
+// Outbox is an FS that queues the files put in it for shipping to a remote FS.
+// Files that have been put but not yet shipped can be opened from the Outbox,
+// anything else is opened from the remote FS.
+type Outbox struct {
+	q   *queue
+	dir string
+}
+
+var _ fs.ShutdownFS = (*Outbox)(nil)
+
+// New returns an Outbox that queues operations in the local FS for shipping to
+// the remote FS. Any operations already queued in the local FS are loaded, so
+// they are shipped before any new operations.
+func New(local, remote fs.FS, opts ...Option) (*Outbox, error) {
+	q := &queue{
+		local:      local,
+		remote:     remote,
+		minBackoff: time.Second,
+		maxBackoff: 5 * time.Minute,
+		latest:     make(map[string]entry),
+		notify:     make(chan struct{}, 1),
+	}
+
+	for _, opt := range opts {
+		opt(q)
+	}
+
+	if err := q.load(); err != nil {
+		return nil, err
+	}
+	return &Outbox{q: q}, nil
+}
+
+// load loads the queued entries from the local FS, and removes the data of any
+// entry whose manifest was not written.
+func (q *queue) load() error {
+	ents, err := fs.ReadDir(q.local, ".")
+
+	if err != nil {
+		return err
+	}
+
+	manifests := make(map[uint64]struct{})
+
+	for _, ent := range ents {
+		name := ent.Name()
+
+		if !strings.HasSuffix(name, manifestExt) {
+			continue
+		}
+
+		f, err := q.local.Open(name)
+
+		if err != nil {
+			return err
+		}
+
+		var e entry
+
+		err = json.NewDecoder(f).Decode(&e)
+		f.Close()
+
+		if err != nil {
+			return fmt.Errorf("outbox: %s: %w", name, err)
+		}
+
+		manifests[e.Seq] = struct{}{}
+		q.entries = append(q.entries, e)
+	}
+
+	for _, ent := range ents {
+		name := ent.Name()
+
+		if !strings.HasSuffix(name, dataExt) {
+			continue
+		}
+
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, dataExt), 10, 64)
+
+		if err != nil {
+			continue
+		}
+
+		if _, ok := manifests[seq]; !ok {
+			if err := q.local.Remove(name); err != nil {
+				return err
+			}
+		}
+	}
+
+	sort.Slice(q.entries, func(i, j int) bool {
+		return q.entries[i].Seq < q.entries[j].Seq
+	})
+
+	for _, e := range q.entries {
+		q.latest[e.key()] = e
+
+		if e.Seq > q.seq {
+			q.seq = e.Seq
+		}
+	}
+	return nil
+}
+
+// enqueue records the given entry in the local FS. For puts, the data of the
+// file must already be stored.
+func (q *queue) enqueue(e entry) error {
+	b, err := json.Marshal(e)
+
+	if err != nil {
+		return err
+	}
+
+	f, err := fs.ReadFile(seqName(e.Seq, manifestExt), bytes.NewReader(b))
+
+	if err != nil {
+		return err
+	}
+
+	stored, err := q.local.Put(f)
+
+	if err != nil {
+		return err
+	}
+	stored.Close()
+
+	q.mu.Lock()
+
+	// Concurrent operations may be enqueued out of order, so the entry is
+	// inserted by sequence to match the order the queue is loaded in.
+	i := sort.Search(len(q.entries), func(i int) bool {
+		return q.entries[i].Seq > e.Seq
+	})
+
+	q.entries = append(q.entries, entry{})
+	copy(q.entries[i+1:], q.entries[i:])
+	q.entries[i] = e
+
+	if latest, ok := q.latest[e.key()]; !ok || latest.Seq < e.Seq {
+		q.latest[e.key()] = e
+	}
+	q.mu.Unlock()
+
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (q *queue) next() uint64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.seq++
+	return q.seq
+}
+
+func (q *queue) pending(key string) (entry, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	e, ok := q.latest[key]
+	return e, ok
+}
+
+func (q *queue) head() (entry, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.entries) == 0 {
+		return entry{}, false
+	}
+	return q.entries[0], true
+}
+
+// pop removes the given entry from the queue, along with its manifest and data
+// in the local FS.
+func (q *queue) pop(e entry) error {
+	if err := q.local.Remove(seqName(e.Seq, manifestExt)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	q.mu.Lock()
+
+	for i := range q.entries {
+		if q.entries[i].Seq == e.Seq {
+			q.entries = append(q.entries[:i], q.entries[i+1:]...)
+			break
+		}
+	}
+
+	if latest, ok := q.latest[e.key()]; ok && latest.Seq == e.Seq {
+		delete(q.latest, e.key())
+	}
+	q.mu.Unlock()
+
+	if e.Op == opPut {
+		if err := q.local.Remove(seqName(e.Seq, dataExt)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (q *queue) target(dir string) (fs.FS, error) {
+	if dir == "" {
+		return q.remote, nil
+	}
+	return q.remote.Sub(dir)
+}
+
+// send makes the operation of the given entry on the remote FS.
+func (q *queue) send(e entry) error {
+	target, err := q.target(e.Dir)
+
+	if err != nil {
+		return err
+	}
+
+	if e.Op == opRemove {
+		if err := target.Remove(e.Name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+
+	f, err := q.local.Open(seqName(e.Seq, dataExt))
+
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	stored, err := target.Put(fs.Rename(f, e.Name))
+
+	if err != nil {
+		return err
+	}
+	return stored.Close()
+}
+
+// Len returns the number of operations waiting to be shipped.
+func (o *Outbox) Len() int {
+	o.q.mu.Lock()
+	defer o.q.mu.Unlock()
+
+	return len(o.q.entries)
+}
+
+// Ship ships the queued operations to the remote FS in order, stopping at the
+// first operation that fails.
+func (o *Outbox) Ship() error {
+	q := o.q
+
+	q.ship.Lock()
+	defer q.ship.Unlock()
+
+	for {
+		e, ok := q.head()
+
+		if !ok {
+			return nil
+		}
+
+		if err := q.send(e); err != nil {
+			return fmt.Errorf("outbox: %s %s: %w", e.Op, e.key(), err)
+		}
+
+		if err := q.pop(e); err != nil {
+			return fmt.Errorf("outbox: %w", err)
+		}
+	}
+}
+
+// Run ships queued operations to the remote FS until the given context is
+// cancelled, waiting for new operations once the queue is empty. Operations
+// that fail are retried with backoff.
+func (o *Outbox) Run(ctx context.Context) error {
+	q := o.q
+	backoff := q.minBackoff
+
+	for {
+		err := o.Ship()
+
+		if err == nil {
+			backoff = q.minBackoff
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-q.notify:
+			}
+			continue
+		}
+
+		if q.onError != nil {
+			q.onError(err)
+		}
+
+		if err := wait(ctx, backoff); err != nil {
+			return err
+		}
+
+		if backoff *= 2; backoff > q.maxBackoff {
+			backoff = q.maxBackoff
+		}
+	}
+}
+
+// wait waits for the given duration, or until the context is done.
+func wait(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// Shutdown ships the queued operations to the remote FS, retrying with backoff
+// until the queue is empty, or the given context is done, in which case the
+// operations still queued are shipped once the Outbox is next created. This
+// should be called once Run has returned, or is about to.
+func (o *Outbox) Shutdown(ctx context.Context) error {
+	q := o.q
+	backoff := q.minBackoff
+
+	for {
+		err := o.Ship()
+
+		if err == nil {
+			return nil
+		}
+
+		if q.onError != nil {
+			q.onError(err)
+		}
+
+		if err := wait(ctx, backoff); err != nil {
+			return err
+		}
+
+		if backoff *= 2; backoff > q.maxBackoff {
+			backoff = q.maxBackoff
+		}
+	}
+}
+
+type fileInfo struct {
+	fs.FileInfo
+
+	name string
+}
+
+func (fi *fileInfo) Name() string { return fi.name }
+
+// Open opens the named file from the queue if it has been put but not yet
+// shipped, otherwise from the remote FS.
+func (o *Outbox) Open(name string) (fs.File, error) {
+	if e, ok := o.q.pending(path.Join(o.dir, name)); ok {
+		if e.Op == opRemove {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+		}
+
+		f, err := o.q.local.Open(seqName(e.Seq, dataExt))
+
+		if err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+		return fs.Rename(f, path.Base(name)), nil
+	}
+
+	target, err := o.q.target(o.dir)
+
+	if err != nil {
+		return nil, err
+	}
+	return target.Open(name)
+}
+
+// Sub returns an Outbox for the given directory that shares the same queue.
+// The directory is only created in the remote FS when an operation in it is
+// shipped.
+func (o *Outbox) Sub(dir string) (fs.FS, error) {
+	return &Outbox{
+		q:   o.q,
+		dir: path.Join(o.dir, dir),
+	}, nil
+}
+
+func (o *Outbox) Stat(name string) (fs.FileInfo, error) {
+	if e, ok := o.q.pending(path.Join(o.dir, name)); ok {
+		if e.Op == opRemove {
+			return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+		}
+
+		info, err := o.q.local.Stat(seqName(e.Seq, dataExt))
+
+		if err != nil {
+			return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+		}
+		return &fileInfo{FileInfo: info, name: path.Base(name)}, nil
+	}
+
+	target, err := o.q.target(o.dir)
+
+	if err != nil {
+		return nil, err
+	}
+	return target.Stat(name)
+}
+
+// Put stores the file in the queue, and returns the file as it is stored in
+// the queue. The file is shipped to the remote FS in the background by Run, or
+// on the next call to Ship.
+func (o *Outbox) Put(f fs.File) (fs.File, error) {
+	info, err := f.Stat()
+
+	if err != nil {
+		return nil, err
+	}
+
+	name := info.Name()
+
+	e := entry{
+		Seq:  o.q.next(),
+		Op:   opPut,
+		Dir:  o.dir,
+		Name: name,
+	}
+
+	stored, err := o.q.local.Put(fs.Rename(f, seqName(e.Seq, dataExt)))
+
+	if err != nil {
+		return nil, &fs.PathError{Op: "put", Path: name, Err: err}
+	}
+
+	if err := o.q.enqueue(e); err != nil {
+		stored.Close()
+		o.q.local.Remove(seqName(e.Seq, dataExt))
+		return nil, &fs.PathError{Op: "put", Path: name, Err: err}
+	}
+	return fs.Rename(stored, name), nil
+}
+
+// Remove queues the removal of the named file from the remote FS.
+func (o *Outbox) Remove(name string) error {
+	e := entry{
+		Seq:  o.q.next(),
+		Op:   opRemove,
+		Dir:  o.dir,
+		Name: name,
+	}
+
+	if err := o.q.enqueue(e); err != nil {
+		return &fs.PathError{Op: "remove", Path: name, Err: err}
+	}
+	return nil
+}
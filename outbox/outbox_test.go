@@ -0,0 +1,228 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/andrewpillar/fs"
+	"github.com/andrewpillar/fs/fakefs"
+)
+
+func tmpdir(t *testing.T) string {
+	dir, err := os.MkdirTemp("", t.Name())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func put(t *testing.T, s fs.FS, name, content string) {
+	f, err := fs.ReadFile(name, bytes.NewReader([]byte(content)))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := s.Put(f)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored.Close()
+}
+
+func read(t *testing.T, s fs.FS, name string) string {
+	f, err := s.Open(name)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	b, err := io.ReadAll(f)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+var errOffline = errors.New("offline")
+
+func Test_Outbox(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	remote := fakefs.New()
+	remote.Fail("put", "", errOffline)
+
+	o, err := New(fs.New(dir), remote)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sub, err := o.Sub("logs")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	put(t, o, "a", "one")
+	put(t, sub, "b", "two")
+	put(t, o, "a", "three")
+
+	// Pending files are opened from the queue.
+	if content := read(t, o, "a"); content != "three" {
+		t.Fatalf("unexpected content, expected=%q, got=%q\n", "three", content)
+	}
+
+	if err := o.Ship(); !errors.Is(err, errOffline) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", errOffline, err)
+	}
+
+	if n := o.Len(); n != 3 {
+		t.Fatalf("unexpected queue length, expected=%d, got=%d\n", 3, n)
+	}
+
+	// Reload the queue from disk as if restarted.
+	o, err = New(fs.New(dir), remote)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := o.Remove("a"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := o.Stat("a"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", fs.ErrNotExist, err)
+	}
+
+	remote.Fail("put", "", nil)
+
+	if err := o.Ship(); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := o.Len(); n != 0 {
+		t.Fatalf("unexpected queue length, expected=%d, got=%d\n", 0, n)
+	}
+
+	files := remote.Files()
+
+	if len(files) != 1 || files[0] != "logs/b" {
+		t.Fatalf("unexpected remote files %v\n", files)
+	}
+
+	if content := read(t, remote, "logs/b"); content != "two" {
+		t.Fatalf("unexpected content, expected=%q, got=%q\n", "two", content)
+	}
+
+	ents, err := os.ReadDir(dir)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ents) != 0 {
+		t.Fatalf("unexpected entries left in queue %v\n", ents)
+	}
+}
+
+func Test_OutboxRun(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	remote := fakefs.New()
+	remote.Fail("put", "", errOffline)
+
+	errs := make(chan error, 10)
+
+	o, err := New(fs.New(dir), remote, Backoff(time.Millisecond, 10*time.Millisecond), OnError(func(err error) {
+		select {
+		case errs <- err:
+		default:
+		}
+	}))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan error)
+
+	go func() {
+		done <- o.Run(ctx)
+	}()
+
+	put(t, o, "file", "data")
+
+	if err := <-errs; !errors.Is(err, errOffline) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", errOffline, err)
+	}
+
+	remote.Fail("put", "", nil)
+
+	deadline := time.Now().Add(5 * time.Second)
+
+	for o.Len() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for queue to ship")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", context.Canceled, err)
+	}
+
+	if content := read(t, remote, "file"); content != "data" {
+		t.Fatalf("unexpected content, expected=%q, got=%q\n", "data", content)
+	}
+}
+
+func Test_OutboxShutdown(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	remote := fakefs.New()
+	remote.Fail("put", "", errOffline)
+
+	o, err := New(fs.New(dir), remote, Backoff(time.Millisecond, time.Millisecond))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	put(t, o, "file", "data")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if err := fs.Shutdown(ctx, o); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", context.DeadlineExceeded, err)
+	}
+
+	remote.Fail("put", "", nil)
+
+	if err := fs.Shutdown(context.Background(), o); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := o.Len(); n != 0 {
+		t.Fatalf("unexpected queue length, expected=%d, got=%d\n", 0, n)
+	}
+}
@@ -0,0 +1,551 @@
+package fs
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"hash/crc32"
+	"io"
+	iofs "io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A pack is a single file holding the content of many files. It begins with a
+// header, followed by the content of each file, followed by an index of the
+// files, and ends with a trailer pointing to the index,
+//
+//	header  magic[8]
+//	data    content...
+//	index   entry...
+//	trailer index offset[8] index crc32[4] magic[8]
+//
+// Each entry in the index is encoded as,
+//
+//	name length  uvarint
+//	name         bytes
+//	flags        uvarint
+//	mod time     varint, unix nanoseconds
+//	offset       uvarint
+//	size         uvarint
+//	sha256       [32]byte
+//
+// Integers in the header and trailer are big endian. Names are slash
+// separated paths. If a name appears more than once in a pack, then the last
+// entry for it takes precedence.
+var (
+	packMagic        = []byte("FSPACK\x00\x01")
+	packTrailerMagic = []byte("FSPACKIX")
+)
+
+const packTrailerSize = 8 + 4 + 8
+
+// packDeleted marks an entry as removing a file stored in an earlier pack.
+const packDeleted = 1
+
+// ErrBadPack is the error returned when reading a pack that is malformed.
+var ErrBadPack = errors.New("malformed pack")
+
+// PackEntry is a single entry in the index of a pack.
+type PackEntry struct {
+	Name string
+
+	// Deleted marks the entry as removing the file from an earlier pack,
+	// rather than storing it.
+	Deleted bool
+
+	ModTime time.Time
+
+	// Offset and Size are the location of the content of the file in the
+	// pack.
+	Offset int64
+	Size   int64
+
+	// Sum is the SHA256 hash of the content of the file.
+	Sum [sha256.Size]byte
+}
+
+// PackWriter writes a pack.
+type PackWriter struct {
+	w       *bufio.Writer
+	off     int64
+	entries []PackEntry
+}
+
+// NewPackWriter returns a PackWriter that writes a pack to the given writer.
+func NewPackWriter(w io.Writer) (*PackWriter, error) {
+	pw := &PackWriter{
+		w: bufio.NewWriter(w),
+	}
+
+	if _, err := pw.w.Write(packMagic); err != nil {
+		return nil, err
+	}
+
+	pw.off = int64(len(packMagic))
+	return pw, nil
+}
+
+// Add adds the content read from r to the pack under the given name.
+func (pw *PackWriter) Add(name string, modTime time.Time, r io.Reader) error {
+	h := sha256.New()
+
+	n, err := io.Copy(io.MultiWriter(pw.w, h), r)
+
+	if err != nil {
+		return err
+	}
+
+	e := PackEntry{
+		Name:    name,
+		ModTime: modTime,
+		Offset:  pw.off,
+		Size:    n,
+	}
+	copy(e.Sum[:], h.Sum(nil))
+
+	pw.off += n
+	pw.entries = append(pw.entries, e)
+	return nil
+}
+
+// Remove records the removal of the named file from an earlier pack.
+func (pw *PackWriter) Remove(name string) {
+	pw.entries = append(pw.entries, PackEntry{
+		Name:    name,
+		Deleted: true,
+	})
+}
+
+// Entries returns the entries added to the pack so far.
+func (pw *PackWriter) Entries() []PackEntry { return pw.entries }
+
+// Close writes the index and trailer of the pack. This does not close the
+// underlying writer.
+func (pw *PackWriter) Close() error {
+	var index bytes.Buffer
+
+	buf := make([]byte, binary.MaxVarintLen64)
+
+	putUvarint := func(v uint64) {
+		index.Write(buf[:binary.PutUvarint(buf, v)])
+	}
+
+	for _, e := range pw.entries {
+		var flags uint64
+
+		if e.Deleted {
+			flags |= packDeleted
+		}
+
+		putUvarint(uint64(len(e.Name)))
+		index.WriteString(e.Name)
+		putUvarint(flags)
+		index.Write(buf[:binary.PutVarint(buf, e.ModTime.UnixNano())])
+		putUvarint(uint64(e.Offset))
+		putUvarint(uint64(e.Size))
+		index.Write(e.Sum[:])
+	}
+
+	trailer := make([]byte, packTrailerSize)
+	binary.BigEndian.PutUint64(trailer, uint64(pw.off))
+	binary.BigEndian.PutUint32(trailer[8:], crc32.ChecksumIEEE(index.Bytes()))
+	copy(trailer[12:], packTrailerMagic)
+
+	if _, err := pw.w.Write(index.Bytes()); err != nil {
+		return err
+	}
+
+	if _, err := pw.w.Write(trailer); err != nil {
+		return err
+	}
+	return pw.w.Flush()
+}
+
+// WritePack writes a pack to the given writer containing every file beneath
+// root in the given filesystem, named by their path relative to root. The
+// filesystem must implement ReadDirFS.
+func WritePack(w io.Writer, s FS, root string) error {
+	pw, err := NewPackWriter(w)
+
+	if err != nil {
+		return err
+	}
+
+	err = Walk(s, root, func(name string, ent DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if ent.IsDir() {
+			return nil
+		}
+
+		f, err := s.Open(name)
+
+		if err != nil {
+			return err
+		}
+
+		defer f.Close()
+
+		info, err := f.Stat()
+
+		if err != nil {
+			return err
+		}
+
+		rel := strings.TrimPrefix(name, root+"/")
+
+		if root == "." {
+			rel = name
+		}
+		return pw.Add(rel, info.ModTime(), f)
+	})
+
+	if err != nil {
+		return err
+	}
+	return pw.Close()
+}
+
+// ReadPackIndex reads the index of the pack of the given size.
+func ReadPackIndex(r io.ReaderAt, size int64) ([]PackEntry, error) {
+	if size < int64(len(packMagic))+packTrailerSize {
+		return nil, ErrBadPack
+	}
+
+	header := make([]byte, len(packMagic))
+
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return nil, err
+	}
+
+	if !bytes.Equal(header, packMagic) {
+		return nil, ErrBadPack
+	}
+
+	trailer := make([]byte, packTrailerSize)
+
+	if _, err := r.ReadAt(trailer, size-packTrailerSize); err != nil {
+		return nil, err
+	}
+
+	if !bytes.Equal(trailer[12:], packTrailerMagic) {
+		return nil, ErrBadPack
+	}
+
+	off := int64(binary.BigEndian.Uint64(trailer))
+	end := size - packTrailerSize
+
+	if off < int64(len(packMagic)) || off > end {
+		return nil, ErrBadPack
+	}
+
+	index := make([]byte, end-off)
+
+	if _, err := r.ReadAt(index, off); err != nil {
+		return nil, err
+	}
+
+	if crc32.ChecksumIEEE(index) != binary.BigEndian.Uint32(trailer[8:]) {
+		return nil, ErrBadPack
+	}
+
+	br := bytes.NewReader(index)
+	entries := make([]PackEntry, 0)
+
+	for br.Len() > 0 {
+		var e PackEntry
+
+		n, err := binary.ReadUvarint(br)
+
+		if err != nil || n > uint64(br.Len()) {
+			return nil, ErrBadPack
+		}
+
+		name := make([]byte, n)
+		br.Read(name)
+		e.Name = string(name)
+
+		flags, err := binary.ReadUvarint(br)
+
+		if err != nil {
+			return nil, ErrBadPack
+		}
+		e.Deleted = flags&packDeleted != 0
+
+		nsec, err := binary.ReadVarint(br)
+
+		if err != nil {
+			return nil, ErrBadPack
+		}
+		e.ModTime = time.Unix(0, nsec)
+
+		offset, err := binary.ReadUvarint(br)
+
+		if err != nil {
+			return nil, ErrBadPack
+		}
+
+		size, err := binary.ReadUvarint(br)
+
+		if err != nil {
+			return nil, ErrBadPack
+		}
+
+		if offset > uint64(off) || size > uint64(off)-offset {
+			return nil, ErrBadPack
+		}
+
+		e.Offset = int64(offset)
+		e.Size = int64(size)
+
+		if _, err := io.ReadFull(br, e.Sum[:]); err != nil {
+			return nil, ErrBadPack
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// packedFile is a file read from a section of a pack. The content is checked
+// against the hash of the entry when read sequentially to the end.
+type packedFile struct {
+	*io.SectionReader
+
+	closer io.Closer
+	e      PackEntry
+	h      hash.Hash
+}
+
+func openPacked(r io.ReaderAt, closer io.Closer, e PackEntry) *packedFile {
+	return &packedFile{
+		SectionReader: io.NewSectionReader(r, e.Offset, e.Size),
+		closer:        closer,
+		e:             e,
+		h:             sha256.New(),
+	}
+}
+
+func (f *packedFile) Read(p []byte) (int, error) {
+	n, err := f.SectionReader.Read(p)
+
+	if f.h == nil {
+		return n, err
+	}
+
+	f.h.Write(p[:n])
+
+	if err == io.EOF {
+		sum := f.h.Sum(nil)
+		f.h = nil
+
+		if !bytes.Equal(sum, f.e.Sum[:]) {
+			return n, &ChecksumError{
+				Name:     f.e.Name,
+				Expected: hex.EncodeToString(f.e.Sum[:]),
+				Actual:   hex.EncodeToString(sum),
+			}
+		}
+	}
+	return n, err
+}
+
+// Seek seeks within the file. The content is only checked if the file is read
+// from the start, so checking stops unless seeking back to the start.
+func (f *packedFile) Seek(offset int64, whence int) (int64, error) {
+	pos, err := f.SectionReader.Seek(offset, whence)
+
+	if err != nil {
+		return pos, err
+	}
+
+	f.h = nil
+
+	if pos == 0 {
+		f.h = sha256.New()
+	}
+	return pos, nil
+}
+
+func (f *packedFile) Close() error {
+	if f.closer == nil {
+		return nil
+	}
+	return f.closer.Close()
+}
+
+func (f *packedFile) Stat() (FileInfo, error) { return packInfo{e: f.e}, nil }
+
+type packInfo struct {
+	e   PackEntry
+	dir bool
+}
+
+func (fi packInfo) Name() string       { return path.Base(fi.e.Name) }
+func (fi packInfo) Size() int64        { return fi.e.Size }
+func (fi packInfo) ModTime() time.Time { return fi.e.ModTime }
+func (fi packInfo) IsDir() bool        { return fi.dir }
+func (fi packInfo) Sys() any           { return nil }
+
+func (fi packInfo) Mode() FileMode {
+	if fi.dir {
+		return iofs.ModeDir | 0500
+	}
+	return FileMode(0400)
+}
+
+// PackReader reads the files in a pack.
+type PackReader struct {
+	r       io.ReaderAt
+	entries []PackEntry
+	files   map[string]PackEntry
+	dirs    map[string]struct{}
+}
+
+// NewPackReader returns a PackReader for the pack of the given size.
+func NewPackReader(r io.ReaderAt, size int64) (*PackReader, error) {
+	entries, err := ReadPackIndex(r, size)
+
+	if err != nil {
+		return nil, err
+	}
+
+	pr := &PackReader{
+		r:       r,
+		entries: entries,
+		files:   make(map[string]PackEntry),
+		dirs:    map[string]struct{}{".": {}},
+	}
+
+	for _, e := range entries {
+		if e.Deleted {
+			delete(pr.files, e.Name)
+			continue
+		}
+		pr.files[e.Name] = e
+	}
+
+	for name := range pr.files {
+		for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+			pr.dirs[dir] = struct{}{}
+		}
+	}
+	return pr, nil
+}
+
+// Entries returns the entries in the index of the pack, in the order they
+// were written.
+func (pr *PackReader) Entries() []PackEntry { return pr.entries }
+
+// Open opens the named file in the pack.
+func (pr *PackReader) Open(name string) (File, error) {
+	e, ok := pr.files[name]
+
+	if !ok {
+		return nil, &PathError{Op: "open", Path: name, Err: ErrNotExist}
+	}
+	return openPacked(pr.r, nil, e), nil
+}
+
+type packFS struct {
+	r   *PackReader
+	dir string
+}
+
+// MountPack returns a read-only filesystem of the files in the given pack.
+// Directories are derived from the names of the files. Any attempt to modify
+// the filesystem via Put or Remove will return ErrPermission in the
+// *PathError.
+func MountPack(r *PackReader) FS {
+	return &packFS{
+		r:   r,
+		dir: ".",
+	}
+}
+
+func (s *packFS) path(name string) string {
+	return path.Join(s.dir, name)
+}
+
+func (s *packFS) Open(name string) (File, error) {
+	f, err := s.r.Open(s.path(name))
+
+	if err != nil {
+		return nil, &PathError{Op: "open", Path: name, Err: ErrNotExist}
+	}
+	return f, nil
+}
+
+func (s *packFS) Sub(dir string) (FS, error) {
+	p := s.path(dir)
+
+	if _, ok := s.r.dirs[p]; !ok {
+		return nil, &PathError{Op: "sub", Path: dir, Err: ErrNotExist}
+	}
+
+	return &packFS{
+		r:   s.r,
+		dir: p,
+	}, nil
+}
+
+func (s *packFS) Stat(name string) (FileInfo, error) {
+	p := s.path(name)
+
+	if e, ok := s.r.files[p]; ok {
+		return packInfo{e: e}, nil
+	}
+
+	if _, ok := s.r.dirs[p]; ok {
+		return packInfo{e: PackEntry{Name: p}, dir: true}, nil
+	}
+	return nil, &PathError{Op: "stat", Path: name, Err: ErrNotExist}
+}
+
+func (s *packFS) Put(f File) (File, error) {
+	info, err := f.Stat()
+
+	if err != nil {
+		return nil, err
+	}
+	return nil, &PathError{Op: "put", Path: info.Name(), Err: ErrPermission}
+}
+
+func (s *packFS) Remove(name string) error {
+	return &PathError{Op: "remove", Path: name, Err: ErrPermission}
+}
+
+func (s *packFS) ReadDir(name string) ([]DirEntry, error) {
+	p := s.path(name)
+
+	if _, ok := s.r.dirs[p]; !ok {
+		return nil, &PathError{Op: "readdir", Path: name, Err: ErrNotExist}
+	}
+
+	ents := make([]DirEntry, 0)
+
+	for dir := range s.r.dirs {
+		if dir != "." && path.Dir(dir) == p {
+			ents = append(ents, iofs.FileInfoToDirEntry(packInfo{e: PackEntry{Name: dir}, dir: true}))
+		}
+	}
+
+	for file, e := range s.r.files {
+		if path.Dir(file) == p {
+			ents = append(ents, iofs.FileInfoToDirEntry(packInfo{e: e}))
+		}
+	}
+
+	sort.Slice(ents, func(i, j int) bool {
+		return ents[i].Name() < ents[j].Name()
+	})
+	return ents, nil
+}
@@ -0,0 +1,187 @@
+package fs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_PackIndex(t *testing.T) {
+	var buf bytes.Buffer
+
+	pw, err := NewPackWriter(&buf)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pw.Add("a", time.Now(), bytes.NewReader([]byte("aaa")))
+	pw.Add("b", time.Now(), bytes.NewReader([]byte("bb")))
+	pw.Remove("c")
+
+	if err := pw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	b := buf.Bytes()
+
+	entries, err := ReadPackIndex(bytes.NewReader(b), int64(len(b)))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 3 {
+		t.Fatalf("unexpected entries, expected=%d, got=%d\n", 3, len(entries))
+	}
+
+	if e := entries[1]; e.Name != "b" || string(b[e.Offset:e.Offset+e.Size]) != "bb" {
+		t.Fatalf("unexpected entry %+v\n", e)
+	}
+
+	if !entries[2].Deleted {
+		t.Fatal("expected entry to be deleted")
+	}
+
+	// Corrupting the index should be caught by the checksum.
+	b[len(b)-packTrailerSize-1] ^= 0xff
+
+	if _, err := ReadPackIndex(bytes.NewReader(b), int64(len(b))); !errors.Is(err, ErrBadPack) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", ErrBadPack, err)
+	}
+}
+
+func Test_MountPack(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"site/index.html":    "index",
+		"site/css/style.css": "style",
+		"site/js/app.js":     "app",
+		"other/not-included": "other",
+	}
+
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+
+		if err := os.MkdirAll(filepath.Dir(p), 0750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+
+	if err := WritePack(&buf, New(dir), "site"); err != nil {
+		t.Fatal(err)
+	}
+
+	pr, err := NewPackReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := len(pr.Entries()); n != 3 {
+		t.Fatalf("unexpected entries, expected=%d, got=%d\n", 3, n)
+	}
+
+	store := MountPack(pr)
+
+	names := make([]string, 0)
+
+	err = Walk(store, ".", func(name string, ent DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		names = append(names, name)
+		return nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{".", "css", "css/style.css", "index.html", "js", "js/app.js"}
+
+	if len(names) != len(expected) {
+		t.Fatalf("unexpected names, expected=%v, got=%v\n", expected, names)
+	}
+
+	for i := range expected {
+		if names[i] != expected[i] {
+			t.Fatalf("unexpected names, expected=%v, got=%v\n", expected, names)
+		}
+	}
+
+	sub, err := store.Sub("css")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if content := readAll(t, sub, "style.css"); content != "style" {
+		t.Fatalf("unexpected content, expected=%q, got=%q\n", "style", content)
+	}
+
+	f, err := ReadFile("file", bytes.NewReader(nil))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.Put(f); !errors.Is(err, ErrPermission) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", ErrPermission, err)
+	}
+
+	if _, err := store.Sub("missing"); !errors.Is(err, ErrNotExist) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", ErrNotExist, err)
+	}
+}
+
+func Test_PackChecksum(t *testing.T) {
+	var buf bytes.Buffer
+
+	pw, err := NewPackWriter(&buf)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pw.Add("file", time.Now(), bytes.NewReader([]byte("content")))
+
+	if err := pw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	b := buf.Bytes()
+
+	// Corrupt the content of the file, which is not covered by the index
+	// checksum.
+	b[len(packMagic)] ^= 0xff
+
+	pr, err := NewPackReader(bytes.NewReader(b), int64(len(b)))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := pr.Open("file")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var cerr *ChecksumError
+
+	if _, err := io.ReadAll(f); !errors.As(err, &cerr) {
+		t.Fatalf("unexpected error, expected=%T, got=%v\n", cerr, err)
+	}
+}
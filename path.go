@@ -0,0 +1,74 @@
+package fs
+
+import (
+	"io/fs"
+	"strings"
+)
+
+// ValidPath reports whether the given name is a valid name for a file, in the
+// sense of io/fs.ValidPath, a slash separated path with no "." or ".." elements
+// and no leading or trailing slash. Names containing a backslash are also not
+// valid, since they would be treated as separators on Windows. The name "."
+// is valid, and refers to the root.
+func ValidPath(name string) bool {
+	return fs.ValidPath(name) && !strings.Contains(name, `\`)
+}
+
+// reservedNames are the device names reserved by Windows, which cannot be used
+// as the name of a file, even with an extension.
+var reservedNames = map[string]struct{}{
+	"CON": {}, "PRN": {}, "AUX": {}, "NUL": {},
+	"COM1": {}, "COM2": {}, "COM3": {}, "COM4": {}, "COM5": {},
+	"COM6": {}, "COM7": {}, "COM8": {}, "COM9": {},
+	"LPT1": {}, "LPT2": {}, "LPT3": {}, "LPT4": {}, "LPT5": {},
+	"LPT6": {}, "LPT7": {}, "LPT8": {}, "LPT9": {},
+}
+
+// reservedName reports whether the given path element cannot be used as a
+// file name on Windows. This is the case for reserved device names, names
+// containing characters Windows does not allow, and names ending in a dot or
+// space, which Windows silently strips.
+func reservedName(elem string) bool {
+	if elem == "" || elem == "." || elem == ".." {
+		return false
+	}
+
+	if strings.HasSuffix(elem, ".") || strings.HasSuffix(elem, " ") {
+		return true
+	}
+
+	for _, r := range elem {
+		if r < 32 || strings.ContainsRune(`<>:"|?*`, r) {
+			return true
+		}
+	}
+
+	base := elem
+
+	if i := strings.IndexByte(base, '.'); i >= 0 {
+		base = base[:i]
+	}
+
+	_, ok := reservedNames[strings.ToUpper(strings.TrimRight(base, " "))]
+	return ok
+}
+
+// maxPath is the length at which a Windows path needs the \\?\ prefix to
+// exceed the MAX_PATH limit. This is lower than MAX_PATH itself, since
+// directories must leave room for an 8.3 file name.
+const maxPath = 248
+
+// longPath returns the given absolute Windows path with the \\?\ prefix if it
+// is long enough to need it. UNC paths are given the \\?\UNC\ prefix.
+func longPath(p string) string {
+	if len(p) < maxPath || strings.HasPrefix(p, `\\?\`) || strings.HasPrefix(p, `\\.\`) {
+		return p
+	}
+
+	p = strings.ReplaceAll(p, "/", `\`)
+
+	if strings.HasPrefix(p, `\\`) {
+		return `\\?\UNC\` + p[2:]
+	}
+	return `\\?\` + p
+}
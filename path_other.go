@@ -0,0 +1,7 @@
+//go:build !windows
+
+package fs
+
+func osPath(p string) string { return p }
+
+func checkName(string) error { return nil }
@@ -0,0 +1,83 @@
+package fs
+
+import "testing"
+
+func Test_ValidPath(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected bool
+	}{
+		{".", true},
+		{"file", true},
+		{"dir/file", true},
+		{"", false},
+		{"/file", false},
+		{"dir/", false},
+		{"dir//file", false},
+		{"../file", false},
+		{"dir/./file", false},
+		{`..\..\file`, false},
+		{`dir\file`, false},
+	}
+
+	for i, test := range tests {
+		if valid := ValidPath(test.name); valid != test.expected {
+			t.Fatalf("tests[%d] - unexpected ValidPath(%q), expected=%v, got=%v\n", i, test.name, test.expected, valid)
+		}
+	}
+}
+
+func Test_ReservedName(t *testing.T) {
+	tests := []struct {
+		elem     string
+		expected bool
+	}{
+		{"file.txt", false},
+		{".", false},
+		{"..", false},
+		{".bashrc", false},
+		{"CON", true},
+		{"con", true},
+		{"nul.txt", true},
+		{"COM1.tar.gz", true},
+		{"LPT9", true},
+		{"COM0", false},
+		{"CONSOLE", false},
+		{"file.", true},
+		{"file ", true},
+		{"a:b", true},
+		{"what?", true},
+		{"tab\t", true},
+	}
+
+	for i, test := range tests {
+		if reserved := reservedName(test.elem); reserved != test.expected {
+			t.Fatalf("tests[%d] - unexpected reservedName(%q), expected=%v, got=%v\n", i, test.elem, test.expected, reserved)
+		}
+	}
+}
+
+func Test_LongPath(t *testing.T) {
+	long := make([]byte, maxPath)
+
+	for i := range long {
+		long[i] = 'a'
+	}
+
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{`C:\dir\file`, `C:\dir\file`},
+		{`C:\` + string(long), `\\?\C:\` + string(long)},
+		{`\\server\share\` + string(long), `\\?\UNC\server\share\` + string(long)},
+		{`\\?\C:\` + string(long), `\\?\C:\` + string(long)},
+		{`C:/dir/` + string(long), `\\?\C:\dir\` + string(long)},
+	}
+
+	for i, test := range tests {
+		if p := longPath(test.path); p != test.expected {
+			t.Fatalf("tests[%d] - unexpected path, expected=%q, got=%q\n", i, test.expected, p)
+		}
+	}
+}
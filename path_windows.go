@@ -0,0 +1,26 @@
+package fs
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// osPath returns the given path as an absolute path, with the \\?\ prefix if
+// it exceeds MAX_PATH, since relative paths cannot be given the prefix.
+func osPath(p string) string {
+	if abs, err := filepath.Abs(p); err == nil {
+		p = abs
+	}
+	return longPath(p)
+}
+
+// checkName returns ErrInvalid if any element of the given name cannot be
+// used on Windows. Both / and \ are treated as separators.
+func checkName(name string) error {
+	for _, elem := range strings.FieldsFunc(name, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if reservedName(elem) {
+			return ErrInvalid
+		}
+	}
+	return nil
+}
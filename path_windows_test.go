@@ -0,0 +1,95 @@
+package fs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func Test_WindowsReservedNames(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	store := New(dir)
+
+	for _, name := range []string{"CON", "nul.txt", "file.", "a:b"} {
+		f, err := ReadFile("file", bytes.NewReader([]byte("data")))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := store.Put(Rename(f, name)); !errors.Is(err, ErrInvalid) {
+			t.Fatalf("unexpected error for %q, expected=%q, got=%v\n", name, ErrInvalid, err)
+		}
+	}
+
+	if _, err := store.Sub(`a\AUX`); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", ErrInvalid, err)
+	}
+
+	if _, err := store.Open("CON"); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", ErrInvalid, err)
+	}
+
+	if _, err := store.Stat("nul.txt"); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", ErrInvalid, err)
+	}
+
+	if err := store.Remove("file."); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", ErrInvalid, err)
+	}
+}
+
+func Test_WindowsLongPath(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	var store FS = New(dir)
+
+	elem := strings.Repeat("d", 100)
+
+	// Nest deep enough to exceed MAX_PATH.
+	for i := 0; i < 4; i++ {
+		sub, err := store.Sub(elem)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+		store = sub
+	}
+
+	f, err := ReadFile("file", bytes.NewReader([]byte("data")))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := store.Put(f)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored.Close()
+
+	opened, err := store.Open("file")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer opened.Close()
+
+	b, err := io.ReadAll(opened)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(b) != "data" {
+		t.Fatalf("unexpected content, expected=%q, got=%q\n", "data", string(b))
+	}
+}
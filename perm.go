@@ -0,0 +1,118 @@
+package fs
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// DirPerm sets the permissions of the directories created via Sub. By default
+// this is 0750.
+func DirPerm(perm FileMode) Option {
+	return func(s *filesystem) {
+		s.dirPerm = perm.Perm()
+	}
+}
+
+// FilePerm sets the permissions of the files put via Put. By default this is
+// 0666, the same as os.Create. Put always writes a new file and renames it
+// over any existing file, so this applies to every file put, replacing the
+// permissions of the file it replaces.
+func FilePerm(perm FileMode) Option {
+	return func(s *filesystem) {
+		s.filePerm = perm.Perm()
+	}
+}
+
+// IgnoreUmask configures the FS to set the exact permissions given via DirPerm
+// and FilePerm on the directories it creates and the files it puts,
+// regardless of the process's umask. Without this, the umask is applied as
+// normal, so 0770 with a umask of 022 would create a directory with 0750.
+func IgnoreUmask() Option {
+	return func(s *filesystem) {
+		s.ignoreUmask = true
+	}
+}
+
+// Owner sets the user and group ID of the files created via Put and the
+// directories created via Sub. An ID of -1 leaves that ID unchanged. Changing
+// the owner typically requires elevated privileges, and is not supported on
+// Windows.
+func Owner(uid, gid int) Option {
+	return func(s *filesystem) {
+		s.chown = true
+		s.uid = uid
+		s.gid = gid
+	}
+}
+
+// create creates or truncates the file with the given path, with the file
+// permissions and owner of the filesystem.
+func (s filesystem) create(name string) (*os.File, error) {
+	f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, s.filePerm)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if s.ignoreUmask {
+		if err := f.Chmod(s.filePerm); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+
+	if s.chown {
+		if err := f.Chown(s.uid, s.gid); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// mkdirAll creates the given directory along with any parents. If the umask is
+// ignored, then each directory that is created is explicitly given the
+// directory permissions, and likewise the owner if one is set.
+func (s filesystem) mkdirAll(dir string) error {
+	if !s.ignoreUmask && !s.chown {
+		return os.MkdirAll(dir, s.dirPerm)
+	}
+
+	info, err := os.Stat(dir)
+
+	if err == nil {
+		if !info.IsDir() {
+			return &PathError{Op: "mkdir", Path: dir, Err: ErrExist}
+		}
+		return nil
+	}
+
+	if !errors.Is(err, ErrNotExist) {
+		return err
+	}
+
+	if parent := filepath.Dir(dir); parent != dir {
+		if err := s.mkdirAll(parent); err != nil {
+			return err
+		}
+	}
+
+	if err := os.Mkdir(dir, s.dirPerm); err != nil {
+		if errors.Is(err, ErrExist) {
+			return nil
+		}
+		return err
+	}
+
+	if s.ignoreUmask {
+		if err := os.Chmod(dir, s.dirPerm); err != nil {
+			return err
+		}
+	}
+
+	if s.chown {
+		return os.Chown(dir, s.uid, s.gid)
+	}
+	return nil
+}
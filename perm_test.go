@@ -0,0 +1,150 @@
+package fs
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func Test_Perm(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("permissions are not supported on windows")
+	}
+
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	store := New(dir, DirPerm(0777), FilePerm(0666), IgnoreUmask())
+
+	sub, err := store.Sub("a/b")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"a", "a/b"} {
+		info, err := os.Stat(filepath.Join(dir, name))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if perm := info.Mode().Perm(); perm != 0777 {
+			t.Fatalf("unexpected perm for %s, expected=%v, got=%v\n", name, FileMode(0777), perm)
+		}
+	}
+
+	f, err := ReadFile("file", bytes.NewReader([]byte("data")))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := sub.Put(f)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer stored.Close()
+
+	info, err := os.Stat(filepath.Join(dir, "a", "b", "file"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if perm := info.Mode().Perm(); perm != 0666 {
+		t.Fatalf("unexpected perm, expected=%v, got=%v\n", FileMode(0666), perm)
+	}
+}
+
+func Test_Owner(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("ownership is not supported on windows")
+	}
+
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	// Changing the owner to the current user and group is permitted without
+	// elevated privileges.
+	uid, gid := os.Getuid(), os.Getgid()
+
+	store := New(dir, Owner(uid, gid))
+
+	sub, err := store.Sub("a")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := ReadFile("file", bytes.NewReader([]byte("data")))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := sub.Put(f)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored.Close()
+
+	if _, err := os.Stat(filepath.Join(dir, "a", "file")); err != nil {
+		t.Fatal(err)
+	}
+
+	store = New(dir, Owner(-1, -1))
+
+	if _, err := store.Sub("b"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_NewMkdir(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	root := filepath.Join(dir, "a", "b")
+
+	store, err := NewMkdir(root, 0700)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(root)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !info.IsDir() {
+		t.Fatalf("expected %s to be a directory\n", root)
+	}
+
+	f, err := ReadFile("file", bytes.NewReader([]byte("data")))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := store.Put(f)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored.Close()
+
+	if err := os.WriteFile(filepath.Join(dir, "file"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewMkdir(filepath.Join(dir, "file", "sub"), 0700); err == nil {
+		t.Fatal("expected NewMkdir beneath a file to error, it did not")
+	}
+}
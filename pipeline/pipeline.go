@@ -0,0 +1,372 @@
+// Package pipeline runs processors over the files stored in an FS.
+//
+// A Pipeline walks an FS and passes each file it finds to its processors, with
+// a bounded number of files processed at once. The files that have been
+// processed are recorded in a checkpoint, so a Pipeline that is restarted
+// picks up where it left off, and a file is only processed again if it
+// changes. Files that fail to be processed are copied to a dead-letter
+// directory, along with the error, for inspection, for example,
+//
+//	p, err := pipeline.New(store, []pipeline.Processor{thumbnail},
+//		pipeline.Concurrency(8),
+//		pipeline.Checkpoint(state, "thumbnails.json"),
+//		pipeline.DeadLetter("failed"),
+//	)
+//
+//	if err != nil {
+//		return err
+//	}
+//	return p.Watch(ctx, time.Minute)
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andrewpillar/fs"
+)
+
+// Processor processes a single file. The name is the path of the file in the
+// FS being walked. Each processor is given the file opened afresh.
+type Processor func(ctx context.Context, name string, f fs.File) error
+
+// state is the state of a file when it was processed, so changes to it are
+// detected.
+type state struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+type job struct {
+	name  string
+	state state
+}
+
+// Pipeline passes the files in an FS through its processors.
+type Pipeline struct {
+	fs    fs.FS
+	procs []Processor
+
+	concurrency int
+	checkpoint  fs.FS
+	cpname      string
+	deadLetter  string
+	onError     func(error)
+
+	mu   sync.Mutex
+	done map[string]state
+}
+
+// Option configures a Pipeline.
+type Option func(*Pipeline)
+
+// Concurrency sets the number of files processed at once. Defaults to 1.
+func Concurrency(n int) Option {
+	return func(p *Pipeline) {
+		if n > 0 {
+			p.concurrency = n
+		}
+	}
+}
+
+// Checkpoint sets the file the processed files are recorded in, so they are
+// not processed again when the Pipeline is restarted. The file should not be
+// in the FS being walked. Without a checkpoint the processed files are only
+// remembered for the lifetime of the Pipeline.
+func Checkpoint(s fs.FS, name string) Option {
+	return func(p *Pipeline) {
+		p.checkpoint = s
+		p.cpname = name
+	}
+}
+
+// DeadLetter sets the directory in the FS being walked that files that fail to
+// be processed are copied to. The error of each file is written alongside it,
+// with the .error extension. The directory is not walked. Files copied to the
+// directory are recorded as processed, so they are not retried unless they
+// change. Without a dead-letter directory files that fail are retried on the
+// next walk.
+func DeadLetter(dir string) Option {
+	return func(p *Pipeline) {
+		p.deadLetter = dir
+	}
+}
+
+// OnError sets the function called with each error encountered when
+// processing files.
+func OnError(fn func(error)) Option {
+	return func(p *Pipeline) {
+		p.onError = fn
+	}
+}
+
+// New returns a Pipeline that passes the files in the given FS through the
+// given processors, in order. The FS must implement fs.ReadDirFS. If a
+// checkpoint is configured then it is loaded.
+func New(s fs.FS, procs []Processor, opts ...Option) (*Pipeline, error) {
+	p := &Pipeline{
+		fs:          s,
+		procs:       procs,
+		concurrency: 1,
+		done:        make(map[string]state),
+	}
+
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	if err := p.load(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *Pipeline) load() error {
+	if p.checkpoint == nil {
+		return nil
+	}
+
+	f, err := p.checkpoint.Open(p.cpname)
+
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	defer f.Close()
+
+	if err := json.NewDecoder(f).Decode(&p.done); err != nil {
+		return fmt.Errorf("pipeline: %s: %w", p.cpname, err)
+	}
+	return nil
+}
+
+// save writes the checkpoint. This should be called with the mutex held.
+func (p *Pipeline) save() error {
+	if p.checkpoint == nil {
+		return nil
+	}
+
+	b, err := json.Marshal(p.done)
+
+	if err != nil {
+		return err
+	}
+
+	f, err := fs.ReadFile(p.cpname, bytes.NewReader(b))
+
+	if err != nil {
+		return err
+	}
+
+	defer fs.Cleanup(f)
+
+	stored, err := fs.PutPath(p.checkpoint, p.cpname, f)
+
+	if err != nil {
+		return err
+	}
+	return stored.Close()
+}
+
+// pending reports whether the named file has changed since it was processed.
+func (p *Pipeline) pending(name string, st state) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	done, ok := p.done[name]
+	return !ok || done.Size != st.Size || !done.ModTime.Equal(st.ModTime)
+}
+
+func (p *Pipeline) finish(name string, st state) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.done[name] = st
+
+	if err := p.save(); err != nil {
+		return fmt.Errorf("pipeline: checkpoint: %w", err)
+	}
+	return nil
+}
+
+func (p *Pipeline) report(err error) {
+	if p.onError != nil {
+		p.onError(err)
+	}
+}
+
+// process passes the named file through each processor.
+func (p *Pipeline) process(ctx context.Context, name string) error {
+	for _, proc := range p.procs {
+		f, err := p.fs.Open(name)
+
+		if err != nil {
+			return err
+		}
+
+		err = proc(ctx, name, f)
+		f.Close()
+
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bury copies the named file to the dead-letter directory along with the error
+// it failed with.
+func (p *Pipeline) bury(name string, procErr error) error {
+	dl, err := p.fs.Sub(p.deadLetter)
+
+	if err != nil {
+		return err
+	}
+
+	stored, err := fs.Copy(dl, p.fs, name)
+
+	if err != nil {
+		return err
+	}
+	stored.Close()
+
+	f, err := fs.ReadFile(name+".error", strings.NewReader(procErr.Error()+"\n"))
+
+	if err != nil {
+		return err
+	}
+
+	defer fs.Cleanup(f)
+
+	stored, err = fs.PutPath(dl, name+".error", f)
+
+	if err != nil {
+		return err
+	}
+	return stored.Close()
+}
+
+func (p *Pipeline) handle(ctx context.Context, name string, st state) {
+	err := p.process(ctx, name)
+
+	if err != nil {
+		// The file is retried if it was the context that stopped it being
+		// processed.
+		if ctx.Err() != nil {
+			return
+		}
+
+		p.report(fmt.Errorf("pipeline: %s: %w", name, err))
+
+		if p.deadLetter == "" {
+			return
+		}
+
+		if err := p.bury(name, err); err != nil {
+			p.report(fmt.Errorf("pipeline: dead letter %s: %w", name, err))
+			return
+		}
+	}
+
+	if err := p.finish(name, st); err != nil {
+		p.report(err)
+	}
+}
+
+// Run walks the FS once, and processes every file that has not been processed
+// yet, or that has changed since it was. It returns once every file has been
+// processed, or the given context is done. Errors from processing files are
+// passed to the OnError func, the returned error is from walking the FS, or
+// the context.
+func (p *Pipeline) Run(ctx context.Context) error {
+	jobs := make(chan job)
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < p.concurrency; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for j := range jobs {
+				p.handle(ctx, j.name, j.state)
+			}
+		}()
+	}
+
+	err := fs.Walk(p.fs, ".", func(name string, ent fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if ent.IsDir() {
+			if p.deadLetter != "" && name == p.deadLetter {
+				return fs.SkipDir
+			}
+			return nil
+		}
+
+		info, err := ent.Info()
+
+		if err != nil {
+			return err
+		}
+
+		st := state{
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		}
+
+		if !p.pending(name, st) {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case jobs <- job{name: name, state: st}:
+		}
+		return nil
+	})
+
+	close(jobs)
+	wg.Wait()
+
+	if err != nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+// Watch runs the Pipeline every interval until the given context is done,
+// so files are processed as they are added to the FS, or change. Errors from
+// walking the FS are passed to the OnError func.
+func (p *Pipeline) Watch(ctx context.Context, interval time.Duration) error {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		if err := p.Run(ctx); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			p.report(fmt.Errorf("pipeline: %w", err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
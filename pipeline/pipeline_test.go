@@ -0,0 +1,146 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/andrewpillar/fs"
+	"github.com/andrewpillar/fs/fakefs"
+)
+
+func put(t *testing.T, s fs.FS, name, content string) {
+	f, err := fs.ReadFile(name, bytes.NewReader([]byte(content)))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := fs.PutPath(s, name, f)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored.Close()
+}
+
+func read(t *testing.T, s fs.FS, name string) string {
+	f, err := s.Open(name)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	b, err := io.ReadAll(f)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+var errBad = errors.New("bad file")
+
+func Test_Pipeline(t *testing.T) {
+	store := fakefs.New()
+	state := fakefs.New()
+
+	put(t, store, "a.txt", "a")
+	put(t, store, "b.txt", "b")
+	put(t, store, "dir/c.txt", "c")
+	put(t, store, "bad.txt", "bad")
+
+	var (
+		mu        sync.Mutex
+		processed []string
+		errs      []error
+	)
+
+	proc := func(ctx context.Context, name string, f fs.File) error {
+		b, err := io.ReadAll(f)
+
+		if err != nil {
+			return err
+		}
+
+		if string(b) == "bad" {
+			return errBad
+		}
+
+		mu.Lock()
+		processed = append(processed, name)
+		mu.Unlock()
+		return nil
+	}
+
+	run := func() []string {
+		processed = nil
+
+		p, err := New(store, []Processor{proc},
+			Concurrency(2),
+			Checkpoint(state, "state/pipeline.json"),
+			DeadLetter("failed"),
+			OnError(func(err error) {
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
+			}),
+		)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := p.Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		sort.Strings(processed)
+		return processed
+	}
+
+	tests := []struct {
+		update   map[string]string
+		expected []string
+	}{
+		{nil, []string{"a.txt", "b.txt", "dir/c.txt"}},
+		{nil, nil},
+		{map[string]string{"b.txt": "bb"}, []string{"b.txt"}},
+	}
+
+	for i, test := range tests {
+		for name, content := range test.update {
+			put(t, store, name, content)
+		}
+
+		names := run()
+
+		if len(names) != len(test.expected) {
+			t.Fatalf("tests[%d] - unexpected processed files, expected=%v, got=%v\n", i, test.expected, names)
+		}
+
+		for j, name := range names {
+			if name != test.expected[j] {
+				t.Fatalf("tests[%d] - unexpected processed file, expected=%q, got=%q\n", i, test.expected[j], name)
+			}
+		}
+	}
+
+	if len(errs) != 1 || !errors.Is(errs[0], errBad) {
+		t.Fatalf("unexpected errors, expected=%q, got=%v\n", errBad, errs)
+	}
+
+	if data := read(t, store, "failed/bad.txt"); data != "bad" {
+		t.Fatalf("unexpected dead letter, expected=%q, got=%q\n", "bad", data)
+	}
+
+	if data := read(t, store, "failed/bad.txt.error"); data != errBad.Error()+"\n" {
+		t.Fatalf("unexpected dead letter error, expected=%q, got=%q\n", errBad.Error()+"\n", data)
+	}
+}
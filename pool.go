@@ -0,0 +1,80 @@
+package fs
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// maxPooledBuffer is the largest capacity of a buffer that will be returned
+// to the pool. Anything larger is left for the garbage collector so a single
+// large read does not pin memory.
+const maxPooledBuffer = 64 << 20
+
+var (
+	bufPool = sync.Pool{
+		New: func() any {
+			return new(bytes.Buffer)
+		},
+	}
+
+	copyBufPool = sync.Pool{
+		New: func() any {
+			b := make([]byte, 32<<10)
+			return &b
+		},
+	}
+)
+
+func getBuffer() *bytes.Buffer {
+	buf := bufPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	return buf
+}
+
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBuffer {
+		return
+	}
+	bufPool.Put(buf)
+}
+
+// pooledBuffer is a buffer from the pool shared by the files reading from it.
+// It is returned to the pool once every file has released it.
+type pooledBuffer struct {
+	buf  *bytes.Buffer
+	refs int32
+}
+
+func newPooledBuffer(buf *bytes.Buffer) *pooledBuffer {
+	return &pooledBuffer{
+		buf:  buf,
+		refs: 1,
+	}
+}
+
+func (b *pooledBuffer) retain() {
+	atomic.AddInt32(&b.refs, 1)
+}
+
+func (b *pooledBuffer) release() {
+	if atomic.AddInt32(&b.refs, -1) == 0 {
+		putBuffer(b.buf)
+	}
+}
+
+// writer hides any io.ReaderFrom implementation of the underlying writer so
+// that io.CopyBuffer uses the buffer it is given.
+type writer struct {
+	io.Writer
+}
+
+// copyBuffer copies from src to dst using a buffer from the pool. If src
+// implements io.WriterTo then that is used instead.
+func copyBuffer(dst io.Writer, src io.Reader) (int64, error) {
+	buf := copyBufPool.Get().(*[]byte)
+	defer copyBufPool.Put(buf)
+
+	return io.CopyBuffer(writer{Writer: dst}, src, *buf)
+}
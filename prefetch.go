@@ -0,0 +1,80 @@
+package fs
+
+import (
+	"errors"
+	"io/fs"
+)
+
+// PrefetchFS is the interface implemented by a filesystem that caches files,
+// and can warm its cache ahead of files being opened.
+type PrefetchFS interface {
+	FS
+
+	// Prefetch populates the cache with the named files.
+	Prefetch(names ...string) error
+}
+
+// Prefetch warms the cache of the given filesystem with the named files, ahead
+// of them being opened, for example the assets of the next page a user is
+// likely to view. This blocks until the files are cached, so should be called
+// in its own goroutine when warming in the background. If the filesystem does
+// not implement PrefetchFS then ErrUnsupported is returned in the *PathError.
+func Prefetch(s FS, names ...string) error {
+	ps, ok := s.(PrefetchFS)
+
+	if !ok {
+		return &PathError{Op: "prefetch", Path: ".", Err: ErrUnsupported}
+	}
+	return ps.Prefetch(names...)
+}
+
+// PrefetchMatch warms the cache of the given filesystem with the files that
+// match the given pattern, in the syntax of path.Match. The filesystem must
+// implement ReadDirFS if the pattern has any meta characters.
+func PrefetchMatch(s FS, pattern string) error {
+	names, err := fs.Glob(walkFS{FS: s}, pattern)
+
+	if err != nil {
+		return &PathError{Op: "prefetch", Path: pattern, Err: err}
+	}
+
+	if len(names) == 0 {
+		return nil
+	}
+	return Prefetch(s, names...)
+}
+
+// Prefetch stats each of the named files, so the results are cached. If the
+// underlying filesystem implements PrefetchFS then the files are prefetched
+// there too.
+func (s *statCache) Prefetch(names ...string) error {
+	if err := Prefetch(s.FS, names...); err != nil && !errors.Is(err, ErrUnsupported) {
+		return err
+	}
+
+	for _, name := range names {
+		if _, err := s.Stat(name); err != nil && !errors.Is(err, ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Prefetch copies each of the named files that are only in cold into hot,
+// regardless of whether the policy rehydrates files. The files are moved back
+// to cold by Migrate once they age again.
+func (s *tierFS) Prefetch(names ...string) error {
+	for _, name := range names {
+		if _, err := s.FS.Stat(name); err == nil {
+			continue
+		}
+
+		f, err := Copy(s.FS, s.cold, name)
+
+		if err != nil {
+			return err
+		}
+		f.Close()
+	}
+	return nil
+}
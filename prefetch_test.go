@@ -0,0 +1,52 @@
+package fs
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_Prefetch(t *testing.T) {
+	hot := tmpdir(t)
+	defer os.RemoveAll(hot)
+
+	cold := tmpdir(t)
+	defer os.RemoveAll(cold)
+
+	if err := os.MkdirAll(filepath.Join(cold, "chapter2"), 0750); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"chapter2/a.png", "chapter2/b.png", "chapter2/text.md"} {
+		if err := os.WriteFile(filepath.Join(cold, name), []byte(name), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	store := CacheStat(Tier(New(hot), New(cold), TierPolicy{Age: time.Hour}), time.Minute)
+
+	if err := PrefetchMatch(store, "chapter2/*.png"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{"chapter2/a.png", nil},
+		{"chapter2/b.png", nil},
+		{"chapter2/text.md", os.ErrNotExist},
+	}
+
+	for i, test := range tests {
+		if _, err := os.Stat(filepath.Join(hot, test.name)); !errors.Is(err, test.err) {
+			t.Fatalf("tests[%d] - unexpected error, expected=%v, got=%v\n", i, test.err, err)
+		}
+	}
+
+	if err := Prefetch(New(hot), "chapter2/a.png"); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("unexpected error, expected=%v, got=%v\n", ErrUnsupported, err)
+	}
+}
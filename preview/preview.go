@@ -0,0 +1,379 @@
+// Package preview implements a cache of previews of the files in an FS, such
+// as image thumbnails.
+//
+// Previews are generated on demand the first time they are requested, and are
+// stored in a separate FS keyed by the hash of the file they were generated
+// from and their size, so a file that is renamed or stored twice only has its
+// preview generated once. The FS for the previews is typically a Sub of the
+// FS of the files, for example,
+//
+//	previews, err := store.Sub(".previews")
+//
+//	if err != nil {
+//		// Handle error.
+//	}
+//
+//	c := preview.New(store, previews)
+//	c.Register("application/pdf", preview.Command("pdftoppm", "-png", "-singlefile", "-scale-to", "{size}", "-", "-"))
+package preview
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"io"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+
+	// Register the decoders for the image formats supported by Thumbnail.
+	_ "image/gif"
+	_ "image/png"
+
+	"github.com/andrewpillar/fs"
+)
+
+// Renderer writes a preview of the file read from r to w, that fits within a
+// square of the given size.
+type Renderer func(w io.Writer, r io.Reader, size int) error
+
+type rule struct {
+	pattern  string
+	renderer Renderer
+}
+
+// call is a preview being generated, so concurrent requests for the same
+// preview only generate it once.
+type call struct {
+	wg  sync.WaitGroup
+	err error
+}
+
+// Cache generates and caches the previews of the files in an FS.
+type Cache struct {
+	store    fs.FS
+	previews fs.FS
+	mech     func() hash.Hash
+
+	mu       sync.Mutex
+	rules    []rule
+	inflight map[string]*call
+}
+
+// New returns a Cache for the files in the given store, that stores the
+// previews it generates in the given previews FS. Thumbnail is registered for
+// JPEG, PNG, and GIF images.
+func New(store, previews fs.FS) *Cache {
+	c := &Cache{
+		store:    store,
+		previews: previews,
+		mech:     sha256.New,
+		inflight: make(map[string]*call),
+	}
+
+	c.Register("image/jpeg", Thumbnail)
+	c.Register("image/png", Thumbnail)
+	c.Register("image/gif", Thumbnail)
+
+	return c
+}
+
+// Register registers the renderer for the given content type pattern, such as
+// "image/png" or "image/*". Renderers registered later take precedence over
+// those registered earlier.
+func (c *Cache) Register(pattern string, r Renderer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.rules = append(c.rules, rule{
+		pattern:  pattern,
+		renderer: r,
+	})
+}
+
+func (c *Cache) renderer(ctype string) (Renderer, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Drop any parameters, such as the charset.
+	if i := strings.Index(ctype, ";"); i >= 0 {
+		ctype = ctype[:i]
+	}
+
+	for i := len(c.rules) - 1; i >= 0; i-- {
+		if ok, _ := path.Match(c.rules[i].pattern, ctype); ok {
+			return c.rules[i].renderer, true
+		}
+	}
+	return nil, false
+}
+
+// identify reads the named file, and returns its hash and content type. The
+// content type is taken from the metadata of the file if it has any, otherwise
+// it is detected from the contents.
+func (c *Cache) identify(name string) (string, string, error) {
+	f, err := c.store.Open(name)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	defer f.Close()
+
+	h := c.mech()
+
+	ctype, f2, err := fs.DetectContentType(f)
+
+	if err != nil {
+		return "", "", &fs.PathError{Op: "preview", Path: name, Err: err}
+	}
+
+	if _, err := io.Copy(h, f2); err != nil {
+		return "", "", &fs.PathError{Op: "preview", Path: name, Err: err}
+	}
+
+	if md, err := fs.GetMetadata(c.store, name); err == nil {
+		if v := md[fs.MetadataContentType]; v != "" {
+			ctype = v
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), ctype, nil
+}
+
+// Open returns the preview of the named file that fits within a square of
+// the given size, generating it if it has not been generated. If there is no
+// renderer for the content type of the file then ErrUnsupported is returned
+// in the *PathError.
+func (c *Cache) Open(name string, size int) (fs.File, error) {
+	if size <= 0 {
+		return nil, &fs.PathError{Op: "preview", Path: name, Err: fs.ErrInvalid}
+	}
+
+	sum, ctype, err := c.identify(name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	key := sum + "-" + strconv.Itoa(size)
+
+	f, err := c.previews.Open(key)
+
+	if err == nil {
+		return f, nil
+	}
+
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	render, ok := c.renderer(ctype)
+
+	if !ok {
+		return nil, &fs.PathError{Op: "preview", Path: name, Err: fs.ErrUnsupported}
+	}
+
+	if err := c.generate(name, key, size, render); err != nil {
+		return nil, err
+	}
+	return c.previews.Open(key)
+}
+
+// generate renders the preview of the named file and stores it under the
+// given key. If the preview is already being generated then this waits for
+// it instead.
+func (c *Cache) generate(name, key string, size int, render Renderer) error {
+	c.mu.Lock()
+
+	if cl, ok := c.inflight[key]; ok {
+		c.mu.Unlock()
+		cl.wg.Wait()
+		return cl.err
+	}
+
+	cl := &call{}
+	cl.wg.Add(1)
+
+	c.inflight[key] = cl
+	c.mu.Unlock()
+
+	cl.err = c.render(name, key, size, render)
+	cl.wg.Done()
+
+	c.mu.Lock()
+	delete(c.inflight, key)
+	c.mu.Unlock()
+
+	return cl.err
+}
+
+func (c *Cache) render(name, key string, size int, render Renderer) error {
+	f, err := c.store.Open(name)
+
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	var buf bytes.Buffer
+
+	if err := render(&buf, f, size); err != nil {
+		return &fs.PathError{Op: "preview", Path: name, Err: err}
+	}
+
+	pf, err := fs.ReadFile(key, &buf)
+
+	if err != nil {
+		return err
+	}
+
+	defer fs.Cleanup(pf)
+
+	stored, err := c.previews.Put(pf)
+
+	if err != nil {
+		return err
+	}
+	return stored.Close()
+}
+
+// Remove removes the previews of the named file, of each of the given sizes.
+func (c *Cache) Remove(name string, sizes ...int) error {
+	sum, _, err := c.identify(name)
+
+	if err != nil {
+		return err
+	}
+
+	for _, size := range sizes {
+		if err := c.previews.Remove(sum + "-" + strconv.Itoa(size)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Thumbnail is a Renderer for images. The image is scaled down to fit within
+// the size, keeping its aspect ratio, and is encoded as a JPEG. Images smaller
+// than the size are not scaled up.
+func Thumbnail(w io.Writer, r io.Reader, size int) error {
+	src, _, err := image.Decode(r)
+
+	if err != nil {
+		return err
+	}
+
+	b := src.Bounds()
+	width, height := b.Dx(), b.Dy()
+
+	if width > size || height > size {
+		if width >= height {
+			height = height * size / width
+			width = size
+		} else {
+			width = width * size / height
+			height = size
+		}
+
+		if width < 1 {
+			width = 1
+		}
+		if height < 1 {
+			height = 1
+		}
+	}
+
+	// Draw onto RGBA first, so every format is scaled the same way.
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), src, b.Min, draw.Src)
+
+	return jpeg.Encode(w, scale(rgba, width, height), &jpeg.Options{Quality: 85})
+}
+
+// scale scales the image to the given width and height by averaging the
+// pixels in the source that cover each pixel in the destination.
+func scale(src *image.RGBA, width, height int) *image.RGBA {
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+
+	if sw == width && sh == height {
+		return src
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		y0, y1 := y*sh/height, (y+1)*sh/height
+
+		if y1 == y0 {
+			y1++
+		}
+
+		for x := 0; x < width; x++ {
+			x0, x1 := x*sw/width, (x+1)*sw/width
+
+			if x1 == x0 {
+				x1++
+			}
+
+			var r, g, b, a, n int
+
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					i := src.PixOffset(sx, sy)
+
+					r += int(src.Pix[i])
+					g += int(src.Pix[i+1])
+					b += int(src.Pix[i+2])
+					a += int(src.Pix[i+3])
+					n++
+				}
+			}
+
+			i := dst.PixOffset(x, y)
+
+			dst.Pix[i] = uint8(r / n)
+			dst.Pix[i+1] = uint8(g / n)
+			dst.Pix[i+2] = uint8(b / n)
+			dst.Pix[i+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
+
+// Command returns a Renderer that runs the given command, with the file
+// written to its standard input, and the preview read from its standard
+// output. Any argument of "{size}" is replaced with the size of the preview.
+// This can be used to render previews with external tools, such as the first
+// page of a PDF with pdftoppm.
+func Command(name string, args ...string) Renderer {
+	return func(w io.Writer, r io.Reader, size int) error {
+		argv := make([]string, len(args))
+
+		for i, arg := range args {
+			argv[i] = strings.ReplaceAll(arg, "{size}", strconv.Itoa(size))
+		}
+
+		var stderr bytes.Buffer
+
+		cmd := exec.Command(name, argv...)
+		cmd.Stdin = r
+		cmd.Stdout = w
+		cmd.Stderr = &stderr
+
+		if err := cmd.Run(); err != nil {
+			if msg := strings.TrimSpace(stderr.String()); msg != "" {
+				return errors.New(name + ": " + msg)
+			}
+			return err
+		}
+		return nil
+	}
+}
@@ -0,0 +1,145 @@
+package preview
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/andrewpillar/fs"
+	"github.com/andrewpillar/fs/fakefs"
+)
+
+func put(t *testing.T, s fs.FS, name string, r io.Reader) {
+	f, err := fs.ReadFile(name, r)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := s.Put(f)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored.Close()
+}
+
+func Test_Preview(t *testing.T) {
+	store := fakefs.New()
+	previews := fakefs.New()
+
+	img := image.NewRGBA(image.Rect(0, 0, 100, 50))
+
+	for x := 0; x < 100; x++ {
+		for y := 0; y < 50; y++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 255, A: 255})
+		}
+	}
+
+	var buf bytes.Buffer
+
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+
+	data := buf.Bytes()
+
+	put(t, store, "a.png", bytes.NewReader(data))
+	put(t, store, "b.png", bytes.NewReader(data))
+
+	c := New(store, previews)
+
+	renders := 0
+
+	c.Register("image/png", func(w io.Writer, r io.Reader, size int) error {
+		renders++
+		return Thumbnail(w, r, size)
+	})
+
+	for _, name := range []string{"a.png", "b.png", "a.png"} {
+		f, err := c.Open(name, 20)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		thumb, format, err := image.Decode(f)
+		f.Close()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if format != "jpeg" {
+			t.Fatalf("unexpected format, expected=%q, got=%q\n", "jpeg", format)
+		}
+
+		if b := thumb.Bounds(); b.Dx() != 20 || b.Dy() != 10 {
+			t.Fatalf("unexpected bounds, expected=%dx%d, got=%dx%d\n", 20, 10, b.Dx(), b.Dy())
+		}
+	}
+
+	if renders != 1 {
+		t.Fatalf("unexpected renders, expected=%d, got=%d\n", 1, renders)
+	}
+
+	if _, err := c.Open("a.png", 40); err != nil {
+		t.Fatal(err)
+	}
+
+	if renders != 2 {
+		t.Fatalf("unexpected renders, expected=%d, got=%d\n", 2, renders)
+	}
+
+	if err := c.Remove("a.png", 20, 40); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := len(previews.Files()); n != 0 {
+		t.Fatalf("unexpected previews, expected=%d, got=%d\n", 0, n)
+	}
+}
+
+func Test_PreviewUnsupported(t *testing.T) {
+	store := fakefs.New()
+
+	put(t, store, "notes.txt", strings.NewReader("some notes"))
+
+	c := New(store, fakefs.New())
+
+	if _, err := c.Open("notes.txt", 20); !errors.Is(err, fs.ErrUnsupported) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", fs.ErrUnsupported, err)
+	}
+
+	c.Register("text/*", func(w io.Writer, r io.Reader, size int) error {
+		_, err := io.CopyN(w, r, int64(size))
+
+		if err == io.EOF {
+			return nil
+		}
+		return err
+	})
+
+	f, err := c.Open("notes.txt", 4)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	b, err := io.ReadAll(f)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(b) != "some" {
+		t.Fatalf("unexpected preview, expected=%q, got=%q\n", "some", string(b))
+	}
+}
@@ -0,0 +1,327 @@
+// Package publish publishes a directory of static assets to an FS under
+// content hashed names.
+//
+// Each file is stored with a hash of its content inserted before its
+// extension, such as css/app.3f2a9b1c.css, so the files can be served with
+// long lived cache headers, and a new version of a file never replaces one a
+// client has cached. A manifest mapping the name of each file to its hashed
+// name is written once every file has been published, for templates to look
+// up the names to link to, for example,
+//
+//	res, err := publish.Publish(store, "./dist", publish.Prune())
+//
+//	if err != nil {
+//		return err
+//	}
+//
+//	href := res.Manifest["css/app.css"]
+package publish
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/andrewpillar/fs"
+)
+
+// ManifestName is the name of the manifest written to the FS.
+const ManifestName = "manifest.json"
+
+// Manifest maps the name of each published file to the hashed name it was
+// stored under.
+type Manifest map[string]string
+
+// Result is the result of publishing a directory.
+type Result struct {
+	Manifest Manifest
+
+	// Uploaded is the hashed names of the files that were put into the FS.
+	// Files that were already published under the same hash are skipped.
+	Uploaded []string
+
+	// Pruned is the hashed names of the files that were removed from the FS.
+	Pruned []string
+}
+
+type publisher struct {
+	hashLen int
+	prune   bool
+}
+
+// Option configures Publish.
+type Option func(*publisher)
+
+// HashLen sets the number of hex characters of the hash that are used in the
+// hashed names. Defaults to 8.
+func HashLen(n int) Option {
+	return func(p *publisher) {
+		if n > 0 && n <= sha256.Size*2 {
+			p.hashLen = n
+		}
+	}
+}
+
+// Prune removes the hashed files that are not referenced by the new manifest,
+// or the manifest it replaces. Files from the previous manifest are kept so
+// pages that were loaded before the publish can still load their assets.
+func Prune() Option {
+	return func(p *publisher) {
+		p.prune = true
+	}
+}
+
+// hashedName returns the name with the hash inserted before its extension.
+func hashedName(name, hash string) string {
+	ext := path.Ext(name)
+
+	// A leading dot is part of the name of a hidden file, not its
+	// extension.
+	if ext == path.Base(name) {
+		ext = ""
+	}
+	return strings.TrimSuffix(name, ext) + "." + hash + ext
+}
+
+// isHashed reports whether the name has a hash of the given length before its
+// extension, or at the end of the name if it was published without one.
+func isHashed(name string, hashLen int) bool {
+	for i := 0; i < 2; i++ {
+		ext := path.Ext(name)
+
+		if len(ext) == hashLen+1 {
+			if _, err := hex.DecodeString(ext[1:]); err == nil {
+				return true
+			}
+		}
+		name = strings.TrimSuffix(name, ext)
+	}
+	return false
+}
+
+// ReadManifest returns the manifest last published to the given FS. If nothing
+// has been published then an empty manifest is returned.
+func ReadManifest(s fs.FS) (Manifest, error) {
+	f, err := s.Open(ManifestName)
+
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return Manifest{}, nil
+		}
+		return nil, err
+	}
+
+	defer f.Close()
+
+	var m Manifest
+
+	if err := json.NewDecoder(f).Decode(&m); err != nil {
+		return nil, &fs.PathError{Op: "publish", Path: ManifestName, Err: err}
+	}
+	return m, nil
+}
+
+type metadataFile struct {
+	fs.File
+
+	md fs.Metadata
+}
+
+func (f *metadataFile) Metadata() fs.Metadata { return f.md }
+
+// put puts the named file from src into dst under the hashed name, with its
+// content type set as metadata.
+func put(dst, src fs.FS, name, hashed string) error {
+	f, err := src.Open(name)
+
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	var file fs.File = fs.Rename(f, path.Base(hashed))
+
+	if ctype := mime.TypeByExtension(path.Ext(name)); ctype != "" {
+		file = &metadataFile{
+			File: file,
+			md:   fs.Metadata{fs.MetadataContentType: ctype},
+		}
+	}
+
+	if dir := path.Dir(hashed); dir != "." {
+		sub, err := dst.Sub(dir)
+
+		if err != nil {
+			return err
+		}
+		dst = sub
+	}
+
+	stored, err := fs.PutMetadata(dst, file)
+
+	if err != nil {
+		return err
+	}
+	return stored.Close()
+}
+
+func hash(s fs.FS, name string) (string, error) {
+	f, err := s.Open(name)
+
+	if err != nil {
+		return "", err
+	}
+
+	defer f.Close()
+
+	h := sha256.New()
+
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Publish publishes every file in the given directory on disk to the given FS
+// under its hashed name, and writes the manifest. Files that already exist
+// under their hashed name are not put again. The manifest is written last, so
+// a reader of the manifest only sees it once every file it references has been
+// published. The FS must implement fs.ReadDirFS if the Prune option is given.
+func Publish(s fs.FS, dir string, opts ...Option) (*Result, error) {
+	p := &publisher{
+		hashLen: 8,
+	}
+
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	if _, err := os.Stat(dir); err != nil {
+		return nil, err
+	}
+
+	prev, err := ReadManifest(s)
+
+	if err != nil {
+		return nil, err
+	}
+
+	src := fs.New(dir)
+
+	res := &Result{
+		Manifest: make(Manifest),
+	}
+
+	err = fs.Walk(src, ".", func(name string, ent fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if ent.IsDir() {
+			return nil
+		}
+
+		sum, err := hash(src, name)
+
+		if err != nil {
+			return err
+		}
+
+		hashed := hashedName(name, sum[:p.hashLen])
+		res.Manifest[name] = hashed
+
+		if _, err := s.Stat(hashed); err == nil {
+			return nil
+		}
+
+		if err := put(s, src, name, hashed); err != nil {
+			return err
+		}
+
+		res.Uploaded = append(res.Uploaded, hashed)
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := json.MarshalIndent(res.Manifest, "", "\t")
+
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := fs.ReadFile(ManifestName, bytes.NewReader(append(b, '\n')))
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer fs.Cleanup(f)
+
+	stored, err := s.Put(f)
+
+	if err != nil {
+		return nil, err
+	}
+	stored.Close()
+
+	if p.prune {
+		pruned, err := p.pruneFiles(s, res.Manifest, prev)
+
+		res.Pruned = pruned
+
+		if err != nil {
+			return res, err
+		}
+	}
+	return res, nil
+}
+
+// pruneFiles removes every hashed file that is not referenced by either of the
+// given manifests.
+func (p *publisher) pruneFiles(s fs.FS, manifests ...Manifest) ([]string, error) {
+	keep := make(map[string]struct{})
+
+	for _, m := range manifests {
+		for _, hashed := range m {
+			keep[hashed] = struct{}{}
+		}
+	}
+
+	var pruned []string
+
+	err := fs.Walk(s, ".", func(name string, ent fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if ent.IsDir() || name == ManifestName || !isHashed(name, p.hashLen) {
+			return nil
+		}
+
+		if _, ok := keep[name]; ok {
+			return nil
+		}
+
+		if err := s.Remove(name); err != nil {
+			return err
+		}
+
+		pruned = append(pruned, name)
+		return nil
+	})
+
+	sort.Strings(pruned)
+	return pruned, err
+}
@@ -0,0 +1,145 @@
+package publish
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/andrewpillar/fs"
+	"github.com/andrewpillar/fs/fakefs"
+)
+
+func writeFile(t *testing.T, dir, name, content string) {
+	p := filepath.Join(dir, filepath.FromSlash(name))
+
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_HashedName(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"app.css", "app.0123abcd.css"},
+		{"css/app.min.js", "css/app.min.0123abcd.js"},
+		{"LICENSE", "LICENSE.0123abcd"},
+		{".env", ".env.0123abcd"},
+	}
+
+	for i, test := range tests {
+		hashed := hashedName(test.name, "0123abcd")
+
+		if hashed != test.expected {
+			t.Fatalf("tests[%d] - unexpected name, expected=%q, got=%q\n", i, test.expected, hashed)
+		}
+
+		if !isHashed(hashed, 8) {
+			t.Fatalf("tests[%d] - expected %q to be hashed\n", i, hashed)
+		}
+
+		if isHashed(test.name, 8) {
+			t.Fatalf("tests[%d] - expected %q to not be hashed\n", i, test.name)
+		}
+	}
+}
+
+func Test_Publish(t *testing.T) {
+	dir, err := os.MkdirTemp("", "publish-")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	writeFile(t, dir, "index.html", "<html></html>")
+	writeFile(t, dir, "css/app.css", "body{}")
+
+	store := fakefs.New()
+
+	res, err := Publish(store, dir, Prune())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res.Uploaded) != 2 {
+		t.Fatalf("unexpected uploaded, expected=%d, got=%d\n", 2, len(res.Uploaded))
+	}
+
+	v1 := res.Manifest["css/app.css"]
+
+	if !isHashed(v1, 8) || filepath.Ext(v1) != ".css" {
+		t.Fatalf("unexpected hashed name %q\n", v1)
+	}
+
+	md, err := fs.GetMetadata(store, v1)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ctype := md[fs.MetadataContentType]; ctype != "text/css; charset=utf-8" {
+		t.Fatalf("unexpected content type, expected=%q, got=%q\n", "text/css; charset=utf-8", ctype)
+	}
+
+	res, err = Publish(store, dir, Prune())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res.Uploaded) != 0 {
+		t.Fatalf("unexpected uploaded, expected=%d, got=%d\n", 0, len(res.Uploaded))
+	}
+
+	writeFile(t, dir, "css/app.css", "body{color:red}")
+
+	res, err = Publish(store, dir, Prune())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v2 := res.Manifest["css/app.css"]
+
+	if len(res.Pruned) != 0 {
+		t.Fatalf("unexpected pruned, expected=%d, got=%d\n", 0, len(res.Pruned))
+	}
+
+	if _, err := store.Stat(v1); err != nil {
+		t.Fatalf("expected previous version %q to be kept: %s\n", v1, err)
+	}
+
+	writeFile(t, dir, "css/app.css", "body{color:blue}")
+
+	res, err = Publish(store, dir, Prune())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res.Pruned) != 1 || res.Pruned[0] != v1 {
+		t.Fatalf("unexpected pruned, expected=%q, got=%q\n", []string{v1}, res.Pruned)
+	}
+
+	if _, err := store.Stat(v2); err != nil {
+		t.Fatalf("expected previous version %q to be kept: %s\n", v2, err)
+	}
+
+	m, err := ReadManifest(store)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m["css/app.css"] != res.Manifest["css/app.css"] {
+		t.Fatalf("unexpected manifest entry, expected=%q, got=%q\n", res.Manifest["css/app.css"], m["css/app.css"])
+	}
+}
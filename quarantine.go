@@ -0,0 +1,449 @@
+package fs
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrQuarantined is the error returned when opening a file that has been
+// quarantined.
+var ErrQuarantined = errors.New("file quarantined")
+
+// quarantineDir is the directory quarantined files are kept in.
+const quarantineDir = ".quarantine"
+
+// quarantineExt is the extension of the record kept alongside each
+// quarantined file.
+const quarantineExt = ".quarantine.json"
+
+// ScanFunc scans the contents of the named file. If the file is suspicious
+// then a non-empty reason is returned, such as the name of the signature that
+// matched, and the file is quarantined.
+type ScanFunc func(name string, r io.Reader) (string, error)
+
+// QuarantineRecord is the record of a quarantined file.
+type QuarantineRecord struct {
+	Name     string    `json:"name"`
+	Reason   string    `json:"reason"`
+	Size     int64     `json:"size"`
+	Time     time.Time `json:"time"`
+	Metadata Metadata  `json:"metadata,omitempty"`
+}
+
+// QuarantineFS is the interface implemented by a filesystem that quarantines
+// suspicious files.
+type QuarantineFS interface {
+	FS
+
+	// Quarantined returns the records of the quarantined files, sorted by
+	// name.
+	Quarantined() ([]QuarantineRecord, error)
+
+	// Release moves the named file out of quarantine, making it available
+	// to Open.
+	Release(name string) error
+
+	// Purge removes the named file from quarantine.
+	Purge(name string) error
+}
+
+// Quarantined returns the records of the files quarantined in the given
+// filesystem. If the filesystem does not implement QuarantineFS then
+// ErrUnsupported is returned in the *PathError.
+func Quarantined(s FS) ([]QuarantineRecord, error) {
+	qs, ok := s.(QuarantineFS)
+
+	if !ok {
+		return nil, &PathError{Op: "quarantined", Path: ".", Err: ErrUnsupported}
+	}
+	return qs.Quarantined()
+}
+
+// Release releases the named file from quarantine in the given filesystem. If
+// the filesystem does not implement QuarantineFS then ErrUnsupported is
+// returned in the *PathError.
+func Release(s FS, name string) error {
+	qs, ok := s.(QuarantineFS)
+
+	if !ok {
+		return &PathError{Op: "release", Path: name, Err: ErrUnsupported}
+	}
+	return qs.Release(name)
+}
+
+// Purge removes the named file from quarantine in the given filesystem. If the
+// filesystem does not implement QuarantineFS then ErrUnsupported is returned
+// in the *PathError.
+func Purge(s FS, name string) error {
+	qs, ok := s.(QuarantineFS)
+
+	if !ok {
+		return &PathError{Op: "purge", Path: name, Err: ErrUnsupported}
+	}
+	return qs.Purge(name)
+}
+
+type quarantineFS struct {
+	FS
+
+	scan ScanFunc
+	now  func() time.Time
+}
+
+// Quarantine returns a filesystem that scans each file put in it. Files that
+// the scan finds suspicious are stored in a ".quarantine" directory of the
+// filesystem along with a record of why, and Put returns ErrQuarantined in a
+// *PathError. Opening a quarantined file returns ErrQuarantined until it is
+// either released via Release, or purged via Purge. The quarantine directory
+// is not listed by ReadDir. The filesystem must implement ReadDirFS for
+// Quarantined.
+func Quarantine(s FS, scan ScanFunc) FS {
+	qs := &quarantineFS{
+		FS:   s,
+		scan: scan,
+		now:  time.Now,
+	}
+
+	if canRename(s) {
+		return renameQuarantineFS{quarantineFS: qs}
+	}
+	return qs
+}
+
+// renameQuarantineFS is a quarantineFS over a filesystem that implements RenameFS.
+type renameQuarantineFS struct {
+	*quarantineFS
+}
+
+func (s *quarantineFS) Unwrap() FS { return s.FS }
+
+func (s *quarantineFS) Sub(dir string) (FS, error) {
+	if inQuarantine(dir) {
+		return nil, &PathError{Op: "sub", Path: dir, Err: ErrNotExist}
+	}
+
+	sub, err := s.FS.Sub(dir)
+
+	if err != nil {
+		return nil, err
+	}
+	return Quarantine(sub, s.scan), nil
+}
+
+// quarantine returns the quarantine directory, this is only used for Put, since
+// Sub may create the directory.
+func (s *quarantineFS) quarantine() (FS, error) {
+	return s.FS.Sub(quarantineDir)
+}
+
+// record returns the quarantine record of the named file. If the file is not
+// quarantined then ErrNotExist is returned.
+func (s *quarantineFS) record(name string) (QuarantineRecord, error) {
+	var rec QuarantineRecord
+
+	// Only files directly in the filesystem are put, so a name with a
+	// directory cannot be quarantined here.
+	if strings.Contains(name, "/") || name == quarantineDir {
+		return rec, ErrNotExist
+	}
+
+	f, err := s.FS.Open(quarantineDir + "/" + name + quarantineExt)
+
+	if err != nil {
+		return rec, err
+	}
+
+	defer f.Close()
+
+	if err := json.NewDecoder(f).Decode(&rec); err != nil {
+		return rec, err
+	}
+	return rec, nil
+}
+
+// inQuarantine reports whether the given name is the quarantine directory, or
+// is within it.
+func inQuarantine(name string) bool {
+	name = strings.TrimPrefix(path.Clean(name), "/")
+	return name == quarantineDir || strings.HasPrefix(name, quarantineDir+"/")
+}
+
+// checkQuarantined returns ErrQuarantined in a *PathError if the named file is
+// quarantined. ErrNotExist is returned for names within the quarantine
+// directory, so quarantined files cannot be reached directly.
+func (s *quarantineFS) checkQuarantined(op, name string) error {
+	if inQuarantine(name) {
+		return &PathError{Op: op, Path: name, Err: ErrNotExist}
+	}
+
+	if _, err := s.record(name); err == nil {
+		return &PathError{Op: op, Path: name, Err: ErrQuarantined}
+	}
+	return nil
+}
+
+func (s *quarantineFS) Open(name string) (File, error) {
+	if err := s.checkQuarantined("open", name); err != nil {
+		return nil, err
+	}
+	return s.FS.Open(name)
+}
+
+func (s *quarantineFS) Stat(name string) (FileInfo, error) {
+	if err := s.checkQuarantined("stat", name); err != nil {
+		return nil, err
+	}
+	return s.FS.Stat(name)
+}
+
+// Put scans the file as it is read into a temporary file, and then puts it
+// either in the filesystem, or in quarantine.
+func (s *quarantineFS) Put(f File) (File, error) {
+	info, err := f.Stat()
+
+	if err != nil {
+		return nil, err
+	}
+
+	name := info.Name()
+
+	pr, pw := io.Pipe()
+
+	type result struct {
+		reason string
+		err    error
+	}
+
+	done := make(chan result, 1)
+
+	go func() {
+		reason, err := s.scan(name, pr)
+
+		// Drain whatever the scan did not read, so the copy is not
+		// blocked.
+		io.Copy(io.Discard, pr)
+
+		done <- result{reason: reason, err: err}
+	}()
+
+	tmp, err := ReadFile(name, io.TeeReader(f, pw))
+
+	pw.CloseWithError(err)
+
+	res := <-done
+
+	if err != nil {
+		return nil, &PathError{Op: "put", Path: name, Err: err}
+	}
+
+	defer Cleanup(tmp)
+
+	if res.err != nil {
+		return nil, &PathError{Op: "put", Path: name, Err: res.err}
+	}
+
+	if res.reason == "" {
+		return s.FS.Put(tmp)
+	}
+
+	rec := QuarantineRecord{
+		Name:   name,
+		Reason: res.reason,
+		Size:   info.Size(),
+		Time:   s.now(),
+	}
+
+	if mf, ok := f.(MetadataFile); ok {
+		rec.Metadata = mf.Metadata()
+	}
+
+	if err := s.hold(tmp, rec); err != nil {
+		return nil, &PathError{Op: "put", Path: name, Err: err}
+	}
+	return nil, &PathError{Op: "put", Path: name, Err: ErrQuarantined}
+}
+
+// hold stores the file and its record in quarantine.
+func (s *quarantineFS) hold(f File, rec QuarantineRecord) error {
+	q, err := s.quarantine()
+
+	if err != nil {
+		return err
+	}
+
+	stored, err := q.Put(f)
+
+	if err != nil {
+		return err
+	}
+	stored.Close()
+
+	b, err := json.Marshal(rec)
+
+	if err != nil {
+		return err
+	}
+
+	recf, err := ReadFile(rec.Name+quarantineExt, bytes.NewReader(b))
+
+	if err != nil {
+		return err
+	}
+
+	defer Cleanup(recf)
+
+	stored, err = q.Put(recf)
+
+	if err != nil {
+		q.Remove(rec.Name)
+		return err
+	}
+	return stored.Close()
+}
+
+// metadataFile is a file that carries the given metadata with it.
+type metadataFile struct {
+	File
+
+	md Metadata
+}
+
+func (f *metadataFile) Metadata() Metadata { return f.md }
+
+func (s *quarantineFS) ReadDir(name string) ([]DirEntry, error) {
+	if inQuarantine(name) {
+		return nil, &PathError{Op: "readdir", Path: name, Err: ErrNotExist}
+	}
+
+	ents, err := ReadDir(s.FS, name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if path.Clean(name) == "." {
+		ents = hideDir(ents, quarantineDir)
+	}
+	return ents, nil
+}
+
+func (s *quarantineFS) Quarantined() ([]QuarantineRecord, error) {
+	ents, err := ReadDir(s.FS, quarantineDir)
+
+	if err != nil {
+		if errors.Is(err, ErrNotExist) {
+			return []QuarantineRecord{}, nil
+		}
+		return nil, err
+	}
+
+	recs := make([]QuarantineRecord, 0)
+
+	for _, ent := range ents {
+		name := ent.Name()
+
+		if ent.IsDir() || !strings.HasSuffix(name, quarantineExt) {
+			continue
+		}
+
+		rec, err := s.record(strings.TrimSuffix(name, quarantineExt))
+
+		if err != nil {
+			return nil, err
+		}
+		recs = append(recs, rec)
+	}
+
+	sort.Slice(recs, func(i, j int) bool {
+		return recs[i].Name < recs[j].Name
+	})
+	return recs, nil
+}
+
+// Release puts the quarantined file in the filesystem without scanning it,
+// and then purges it from quarantine.
+func (s *quarantineFS) Release(name string) error {
+	rec, err := s.record(name)
+
+	if err != nil {
+		return &PathError{Op: "release", Path: name, Err: err}
+	}
+
+	f, err := s.FS.Open(quarantineDir + "/" + name)
+
+	if err != nil {
+		return &PathError{Op: "release", Path: name, Err: err}
+	}
+
+	defer f.Close()
+
+	stored, err := PutMetadata(s.FS, &metadataFile{File: f, md: rec.Metadata})
+
+	if err != nil {
+		return err
+	}
+	stored.Close()
+
+	return s.Purge(name)
+}
+
+// Purge removes the quarantined file along with its record.
+func (s *quarantineFS) Purge(name string) error {
+	if _, err := s.record(name); err != nil {
+		return &PathError{Op: "purge", Path: name, Err: err}
+	}
+
+	if err := s.FS.Remove(quarantineDir + "/" + name); err != nil && !errors.Is(err, ErrNotExist) {
+		return err
+	}
+	return s.FS.Remove(quarantineDir + "/" + name + quarantineExt)
+}
+
+func (s renameQuarantineFS) Rename(oldname, newname string) error {
+	if err := s.checkQuarantined("rename", oldname); err != nil {
+		return err
+	}
+
+	if inQuarantine(newname) {
+		return &PathError{Op: "rename", Path: newname, Err: ErrInvalid}
+	}
+	return Move(s.FS, oldname, newname)
+}
+
+func (s *quarantineFS) Link(oldname, newname string) error {
+	if err := s.checkQuarantined("link", oldname); err != nil {
+		return err
+	}
+
+	if inQuarantine(newname) {
+		return &PathError{Op: "link", Path: newname, Err: ErrInvalid}
+	}
+	return Link(s.FS, oldname, newname)
+}
+
+func (s *quarantineFS) Metadata(name string) (Metadata, error) {
+	if err := s.checkQuarantined("metadata", name); err != nil {
+		return nil, err
+	}
+	return GetMetadata(s.FS, name)
+}
+
+func (s *quarantineFS) SetMetadata(name string, md Metadata) error {
+	if inQuarantine(name) {
+		return &PathError{Op: "setmetadata", Path: name, Err: ErrNotExist}
+	}
+	return SetMetadata(s.FS, name, md)
+}
+
+func (s *quarantineFS) Remove(name string) error {
+	if inQuarantine(name) {
+		return &PathError{Op: "remove", Path: name, Err: ErrNotExist}
+	}
+	return s.FS.Remove(name)
+}
@@ -0,0 +1,133 @@
+package fs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"testing"
+)
+
+func Test_Quarantine(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	// Flag anything containing the EICAR marker as suspicious.
+	scan := func(name string, r io.Reader) (string, error) {
+		b, err := io.ReadAll(r)
+
+		if err != nil {
+			return "", err
+		}
+
+		if bytes.Contains(b, []byte("EICAR")) {
+			return "EICAR-Test-File", nil
+		}
+		return "", nil
+	}
+
+	store := Quarantine(New(dir), scan)
+
+	put := func(name, data string) error {
+		f, err := ReadFile(name, bytes.NewReader([]byte(data)))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		stored, err := store.Put(f)
+
+		if err != nil {
+			return err
+		}
+		return stored.Close()
+	}
+
+	if err := put("clean.txt", "hello"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := put("bad.exe", "X5O!P%@AP EICAR"); !errors.Is(err, ErrQuarantined) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", ErrQuarantined, err)
+	}
+
+	if _, err := store.Open("bad.exe"); !errors.Is(err, ErrQuarantined) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", ErrQuarantined, err)
+	}
+
+	// The quarantined file cannot be reached within the quarantine directory
+	// either.
+	for _, name := range []string{".quarantine/bad.exe", "./.quarantine/bad.exe", "clean/../.quarantine/bad.exe"} {
+		if _, err := store.Open(name); !errors.Is(err, ErrNotExist) {
+			t.Fatalf("%s - unexpected error, expected=%q, got=%v\n", name, ErrNotExist, err)
+		}
+
+		if _, err := store.Stat(name); !errors.Is(err, ErrNotExist) {
+			t.Fatalf("%s - unexpected error, expected=%q, got=%v\n", name, ErrNotExist, err)
+		}
+
+		if _, err := GetMetadata(store, name); !errors.Is(err, ErrNotExist) {
+			t.Fatalf("%s - unexpected error, expected=%q, got=%v\n", name, ErrNotExist, err)
+		}
+
+		if err := Move(store, name, "moved.exe"); !errors.Is(err, ErrNotExist) {
+			t.Fatalf("%s - unexpected error, expected=%q, got=%v\n", name, ErrNotExist, err)
+		}
+
+		if err := Link(store, name, "linked.exe"); !errors.Is(err, ErrNotExist) {
+			t.Fatalf("%s - unexpected error, expected=%q, got=%v\n", name, ErrNotExist, err)
+		}
+	}
+
+	if _, err := ReadDir(store, ".quarantine"); !errors.Is(err, ErrNotExist) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", ErrNotExist, err)
+	}
+
+	ents, err := ReadDir(store, ".")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ents) != 1 || ents[0].Name() != "clean.txt" {
+		t.Fatalf("unexpected entries, expected=%q, got=%v\n", "clean.txt", ents)
+	}
+
+	recs, err := Quarantined(store)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(recs) != 1 {
+		t.Fatalf("unexpected records, expected=%d, got=%d\n", 1, len(recs))
+	}
+
+	if recs[0].Name != "bad.exe" || recs[0].Reason != "EICAR-Test-File" {
+		t.Fatalf("unexpected record %+v\n", recs[0])
+	}
+
+	if err := Release(store, "bad.exe"); err != nil {
+		t.Fatal(err)
+	}
+
+	if b := readAll(t, store, "bad.exe"); string(b) != "X5O!P%@AP EICAR" {
+		t.Fatalf("unexpected data, expected=%q, got=%q\n", "X5O!P%@AP EICAR", string(b))
+	}
+
+	if err := put("worse.exe", "EICAR"); !errors.Is(err, ErrQuarantined) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", ErrQuarantined, err)
+	}
+
+	if err := Purge(store, "worse.exe"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.Open("worse.exe"); !errors.Is(err, ErrNotExist) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", ErrNotExist, err)
+	}
+
+	if recs, _ := Quarantined(store); len(recs) != 0 {
+		t.Fatalf("unexpected records, expected=%d, got=%d\n", 0, len(recs))
+	}
+}
@@ -0,0 +1,533 @@
+// Package registry implements the blob storage driver used by container
+// registries, such as distribution, on top of an FS.
+//
+// The Driver has the same method set as the StorageDriver interface from
+// github.com/distribution/distribution/registry/storage/driver, using the
+// types declared in this package in place of the types declared there. This
+// avoids a dependency on the registry, at the cost of a thin shim being
+// needed to register the Driver with it, which only converts the FileInfo and
+// FileWriter types and the errors.
+package registry
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/andrewpillar/fs"
+)
+
+// DriverName is the name of the Driver.
+const DriverName = "fs"
+
+// ErrUnsupportedMethod is returned for methods the Driver does not support.
+var ErrUnsupportedMethod = errors.New("unsupported method")
+
+// ErrSkipDir can be returned from a WalkFunc to skip the directory being
+// walked.
+var ErrSkipDir = errors.New("skip this directory")
+
+// PathNotFoundError is returned when a path does not exist.
+type PathNotFoundError struct {
+	Path string
+}
+
+func (e PathNotFoundError) Error() string {
+	return DriverName + ": path not found: " + e.Path
+}
+
+// InvalidOffsetError is returned when reading from an offset beyond the end
+// of a file.
+type InvalidOffsetError struct {
+	Path   string
+	Offset int64
+}
+
+func (e InvalidOffsetError) Error() string {
+	return DriverName + ": invalid offset: " + e.Path
+}
+
+// InvalidPathError is returned for paths that are not absolute, or contain
+// elements that cannot be stored in an FS.
+type InvalidPathError struct {
+	Path string
+}
+
+func (e InvalidPathError) Error() string {
+	return DriverName + ": invalid path: " + e.Path
+}
+
+// FileInfo describes a file or directory in the Driver.
+type FileInfo interface {
+	Path() string
+	Size() int64
+	ModTime() time.Time
+	IsDir() bool
+}
+
+type fileInfo struct {
+	fs.FileInfo
+
+	path string
+}
+
+func (fi fileInfo) Path() string { return fi.path }
+
+// FileWriter writes a file to the Driver. Data written is held locally until
+// Commit is called, or the writer is closed.
+type FileWriter interface {
+	io.WriteCloser
+
+	// Size returns the number of bytes written to the file, including any
+	// content that was appended to.
+	Size() int64
+
+	// Cancel discards the file.
+	Cancel() error
+
+	// Commit stores the file in the Driver.
+	Commit() error
+}
+
+// WalkFunc is called for each file and directory visited by Walk.
+type WalkFunc func(FileInfo) error
+
+// Driver stores blobs in an FS.
+type Driver struct {
+	fs fs.FS
+}
+
+// New returns a Driver that stores blobs in the given FS. The FS must
+// implement fs.ReadDirFS for List and Walk, and fs.RenameFS for Move.
+func New(s fs.FS) *Driver {
+	return &Driver{
+		fs: s,
+	}
+}
+
+// Name returns DriverName.
+func (d *Driver) Name() string { return DriverName }
+
+// name returns the name of the file in the FS for the given driver path. The
+// root of the driver is ".".
+func name(p string) (string, error) {
+	if !strings.HasPrefix(p, "/") {
+		return "", InvalidPathError{Path: p}
+	}
+
+	if p == "/" {
+		return ".", nil
+	}
+
+	if p[1:] == "." || !fs.ValidPath(p[1:]) {
+		return "", InvalidPathError{Path: p}
+	}
+	return p[1:], nil
+}
+
+func notFound(p string, err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return PathNotFoundError{Path: p}
+	}
+	return err
+}
+
+// GetContent returns the content of the file at the given path.
+func (d *Driver) GetContent(ctx context.Context, p string) ([]byte, error) {
+	rc, err := d.Reader(ctx, p, 0)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rc.Close()
+
+	return io.ReadAll(rc)
+}
+
+// PutContent stores the given content at the given path.
+func (d *Driver) PutContent(ctx context.Context, p string, content []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	n, err := name(p)
+
+	if err != nil {
+		return err
+	}
+
+	f, err := fs.ReadFile(path.Base(n), bytes.NewReader(content))
+
+	if err != nil {
+		return err
+	}
+
+	defer fs.Cleanup(f)
+
+	stored, err := fs.PutPath(d.fs, n, f)
+
+	if err != nil {
+		return err
+	}
+	return stored.Close()
+}
+
+// Reader returns a reader for the file at the given path, starting from the
+// given offset.
+func (d *Driver) Reader(ctx context.Context, p string, offset int64) (io.ReadCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	n, err := name(p)
+
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := d.fs.Open(n)
+
+	if err != nil {
+		return nil, notFound(p, err)
+	}
+
+	info, err := f.Stat()
+
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	if info.IsDir() {
+		f.Close()
+		return nil, PathNotFoundError{Path: p}
+	}
+
+	if offset < 0 || offset > info.Size() {
+		f.Close()
+		return nil, InvalidOffsetError{Path: p, Offset: offset}
+	}
+
+	if offset > 0 {
+		if seeker, ok := f.(io.Seeker); ok {
+			_, err = seeker.Seek(offset, io.SeekStart)
+		} else {
+			_, err = io.CopyN(io.Discard, f, offset)
+		}
+
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+type fileWriter struct {
+	d      *Driver
+	name   string
+	tmp    *os.File
+	size   int64
+	closed bool
+	done   bool
+}
+
+// Writer returns a FileWriter for the file at the given path. If append is
+// true, then the writer continues on from the existing content of the file,
+// as left by a previous writer that was closed without being committed.
+func (d *Driver) Writer(ctx context.Context, p string, append bool) (FileWriter, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	n, err := name(p)
+
+	if err != nil {
+		return nil, err
+	}
+
+	tmp, err := os.CreateTemp("", "fs-registry-*")
+
+	if err != nil {
+		return nil, err
+	}
+
+	w := &fileWriter{
+		d:    d,
+		name: n,
+		tmp:  tmp,
+	}
+
+	if append {
+		f, err := d.fs.Open(n)
+
+		if err != nil {
+			w.discard()
+			return nil, notFound(p, err)
+		}
+
+		w.size, err = io.Copy(tmp, f)
+		f.Close()
+
+		if err != nil {
+			w.discard()
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+func (w *fileWriter) discard() {
+	w.tmp.Close()
+	os.Remove(w.tmp.Name())
+}
+
+func (w *fileWriter) Write(p []byte) (int, error) {
+	if w.closed || w.done {
+		return 0, fs.ErrClosed
+	}
+
+	n, err := w.tmp.Write(p)
+	w.size += int64(n)
+
+	return n, err
+}
+
+func (w *fileWriter) Size() int64 { return w.size }
+
+// store puts the content written so far into the driver.
+func (w *fileWriter) store() error {
+	if _, err := w.tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	stored, err := fs.PutPath(w.d.fs, w.name, fs.Rename(w.tmp, path.Base(w.name)))
+
+	if err != nil {
+		return err
+	}
+	stored.Close()
+
+	_, err = w.tmp.Seek(0, io.SeekEnd)
+	return err
+}
+
+// Close stores the content written so far, so it can be appended to by a
+// later writer, unless the writer was committed or cancelled.
+func (w *fileWriter) Close() error {
+	if w.closed {
+		return fs.ErrClosed
+	}
+
+	w.closed = true
+	defer w.discard()
+
+	if w.done {
+		return nil
+	}
+	return w.store()
+}
+
+func (w *fileWriter) Cancel() error {
+	if w.done {
+		return fs.ErrClosed
+	}
+
+	w.done = true
+
+	if err := w.d.fs.Remove(w.name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (w *fileWriter) Commit() error {
+	if w.done {
+		return fs.ErrClosed
+	}
+
+	w.done = true
+	return w.store()
+}
+
+// Stat returns the FileInfo for the given path.
+func (d *Driver) Stat(ctx context.Context, p string) (FileInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	n, err := name(p)
+
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := d.fs.Stat(n)
+
+	if err != nil {
+		return nil, notFound(p, err)
+	}
+	return fileInfo{FileInfo: info, path: p}, nil
+}
+
+// List returns the paths of the direct children of the given directory.
+func (d *Driver) List(ctx context.Context, p string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	n, err := name(p)
+
+	if err != nil {
+		return nil, err
+	}
+
+	ents, err := fs.ReadDir(d.fs, n)
+
+	if err != nil {
+		return nil, notFound(p, err)
+	}
+
+	paths := make([]string, 0, len(ents))
+
+	for _, ent := range ents {
+		paths = append(paths, path.Join(p, ent.Name()))
+	}
+	return paths, nil
+}
+
+// Move moves the file at the source path to the destination path, replacing
+// anything already there.
+func (d *Driver) Move(ctx context.Context, src, dst string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	srcName, err := name(src)
+
+	if err != nil {
+		return err
+	}
+
+	dstName, err := name(dst)
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := d.fs.Stat(srcName); err != nil {
+		return notFound(src, err)
+	}
+
+	// Make sure the directory of the destination exists.
+	if dir := path.Dir(dstName); dir != "." {
+		if _, err := d.fs.Sub(dir); err != nil {
+			return err
+		}
+	}
+	return fs.Move(d.fs, srcName, dstName)
+}
+
+// Delete removes the file or directory at the given path, along with
+// everything beneath it.
+func (d *Driver) Delete(ctx context.Context, p string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	n, err := name(p)
+
+	if err != nil {
+		return err
+	}
+
+	info, err := d.fs.Stat(n)
+
+	if err != nil {
+		return notFound(p, err)
+	}
+
+	if !info.IsDir() {
+		return d.fs.Remove(n)
+	}
+
+	names := make([]string, 0)
+
+	err = fs.Walk(d.fs, n, func(p string, ent fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		names = append(names, p)
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	// Remove the deepest paths first, so directories are empty by the time
+	// they are removed.
+	sort.Sort(sort.Reverse(sort.StringSlice(names)))
+
+	for _, name := range names {
+		if err := d.fs.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// URLFor is not supported, and always returns ErrUnsupportedMethod, so the
+// registry serves content itself.
+func (d *Driver) URLFor(ctx context.Context, p string, options map[string]any) (string, error) {
+	return "", ErrUnsupportedMethod
+}
+
+// Walk walks the tree rooted at the given path, calling fn for each file and
+// directory beneath it, not including the path itself. If fn returns
+// ErrSkipDir for a directory, then the directory is skipped.
+func (d *Driver) Walk(ctx context.Context, p string, fn WalkFunc) error {
+	n, err := name(p)
+
+	if err != nil {
+		return err
+	}
+
+	err = fs.Walk(d.fs, n, func(name string, ent fs.DirEntry, err error) error {
+		if err != nil {
+			return notFound(p, err)
+		}
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if name == n {
+			return nil
+		}
+
+		info, err := ent.Info()
+
+		if err != nil {
+			return err
+		}
+
+		err = fn(fileInfo{FileInfo: info, path: "/" + name})
+
+		if errors.Is(err, ErrSkipDir) {
+			if ent.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		return err
+	})
+	return err
+}
@@ -0,0 +1,145 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/andrewpillar/fs"
+)
+
+func tmpdir(t *testing.T) string {
+	dir, err := os.MkdirTemp("", t.Name())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func Test_Driver(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	d := New(fs.New(dir))
+
+	upload := "/docker/registry/v2/repositories/app/_uploads/1/data"
+	blob := "/docker/registry/v2/blobs/sha256/ab/abcd/data"
+
+	// Write the upload in two parts, as a resumed upload would.
+	w, err := d.Writer(ctx, upload, false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	io.WriteString(w, "hello ")
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	w, err = d.Writer(ctx, upload, true)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	io.WriteString(w, "world")
+
+	if w.Size() != 11 {
+		t.Fatalf("unexpected size, expected=%d, got=%d\n", 11, w.Size())
+	}
+
+	if err := w.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Move(ctx, upload, blob); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := d.GetContent(ctx, blob)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(b) != "hello world" {
+		t.Fatalf("unexpected content, expected=%q, got=%q\n", "hello world", string(b))
+	}
+
+	rc, err := d.Reader(ctx, blob, 6)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, _ = io.ReadAll(rc)
+	rc.Close()
+
+	if string(b) != "world" {
+		t.Fatalf("unexpected content, expected=%q, got=%q\n", "world", string(b))
+	}
+
+	if _, err := d.Reader(ctx, blob, 12); !errors.As(err, &InvalidOffsetError{}) {
+		t.Fatalf("unexpected error, expected=%T, got=%v\n", InvalidOffsetError{}, err)
+	}
+
+	if err := d.PutContent(ctx, "/docker/registry/v2/repositories/app/_manifests/tags/latest/current/link", []byte("sha256:abcd")); err != nil {
+		t.Fatal(err)
+	}
+
+	paths, err := d.List(ctx, "/docker/registry/v2/repositories/app")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "/docker/registry/v2/repositories/app/_manifests,/docker/registry/v2/repositories/app/_uploads"
+
+	if got := strings.Join(paths, ","); got != expected {
+		t.Fatalf("unexpected paths, expected=%q, got=%q\n", expected, got)
+	}
+
+	var files []string
+
+	err = d.Walk(ctx, "/docker/registry/v2", func(fi FileInfo) error {
+		if strings.HasSuffix(fi.Path(), "/_manifests") {
+			return ErrSkipDir
+		}
+
+		if !fi.IsDir() {
+			files = append(files, fi.Path())
+		}
+		return nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(files) != 1 || files[0] != blob {
+		t.Fatalf("unexpected files %v\n", files)
+	}
+
+	if err := d.Delete(ctx, "/docker/registry/v2/repositories"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := d.Stat(ctx, "/docker/registry/v2/repositories"); !errors.As(err, &PathNotFoundError{}) {
+		t.Fatalf("unexpected error, expected=%T, got=%v\n", PathNotFoundError{}, err)
+	}
+
+	if _, err := d.Stat(ctx, "/docker/../etc"); !errors.As(err, &InvalidPathError{}) {
+		t.Fatalf("unexpected error, expected=%T, got=%v\n", InvalidPathError{}, err)
+	}
+}
@@ -0,0 +1,47 @@
+package fs
+
+// RenameFS is the interface implemented by a filesystem that can rename the
+// files stored in it.
+type RenameFS interface {
+	FS
+
+	// Rename renames the file oldname to newname. If newname already exists
+	// then it is replaced.
+	Rename(oldname, newname string) error
+}
+
+// Move renames the file oldname to newname in the given filesystem. If the
+// filesystem does not implement RenameFS then ErrUnsupported is returned in
+// the *PathError.
+func Move(s FS, oldname, newname string) error {
+	rs, ok := s.(RenameFS)
+
+	if !ok {
+		return &PathError{Op: "rename", Path: oldname, Err: ErrUnsupported}
+	}
+	return rs.Rename(oldname, newname)
+}
+
+// canRename reports whether each of the given filesystems implements
+// RenameFS. A wrapper only implements RenameFS itself if the filesystems it
+// renames files in do, so checking for RenameFS on the wrapper can be relied
+// upon.
+func canRename(stores ...FS) bool {
+	for _, s := range stores {
+		if _, ok := s.(RenameFS); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// canRenameAll reports whether each of the filesystems in the given map
+// implements RenameFS.
+func canRenameAll(stores map[string]FS) bool {
+	for _, s := range stores {
+		if !canRename(s) {
+			return false
+		}
+	}
+	return true
+}
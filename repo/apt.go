@@ -0,0 +1,512 @@
+package repo
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andrewpillar/fs"
+)
+
+// ErrBadPackage is returned when a package cannot be parsed.
+var ErrBadPackage = errors.New("malformed package")
+
+// Apt is an Apt repository in an FS. It is safe for concurrent use, though
+// only one Apt should update the metadata of a suite at a time.
+type Apt struct {
+	fs  fs.FS
+	cfg *config
+
+	mu sync.Mutex
+}
+
+// NewApt returns an Apt repository in the given FS.
+func NewApt(s fs.FS, opts ...Option) *Apt {
+	return &Apt{
+		fs:  s,
+		cfg: newConfig(opts),
+	}
+}
+
+// field is a field of a control stanza.
+type field struct {
+	name  string
+	value string
+}
+
+// stanza is a paragraph of a control file, with its fields kept in order.
+type stanza []field
+
+func (s stanza) get(name string) string {
+	for _, f := range s {
+		if strings.EqualFold(f.name, name) {
+			return f.value
+		}
+	}
+	return ""
+}
+
+func (s stanza) String() string {
+	var b strings.Builder
+
+	for _, f := range s {
+		b.WriteString(f.name)
+		b.WriteString(":")
+
+		// Multi-line values, such as the description, keep their
+		// continuation lines as they were.
+		if !strings.HasPrefix(f.value, "\n") {
+			b.WriteString(" ")
+		}
+		b.WriteString(f.value)
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// parseStanzas parses the paragraphs of a control file.
+func parseStanzas(r io.Reader) ([]stanza, error) {
+	var (
+		stanzas []stanza
+		cur     stanza
+	)
+
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 1<<20)
+
+	for sc.Scan() {
+		line := sc.Text()
+
+		if strings.TrimSpace(line) == "" {
+			if len(cur) > 0 {
+				stanzas = append(stanzas, cur)
+				cur = nil
+			}
+			continue
+		}
+
+		if line[0] == ' ' || line[0] == '\t' {
+			if len(cur) == 0 {
+				return nil, ErrBadPackage
+			}
+			cur[len(cur)-1].value += "\n" + line
+			continue
+		}
+
+		name, value, ok := strings.Cut(line, ":")
+
+		if !ok {
+			return nil, ErrBadPackage
+		}
+		cur = append(cur, field{name: name, value: strings.TrimSpace(value)})
+	}
+
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(cur) > 0 {
+		stanzas = append(stanzas, cur)
+	}
+	return stanzas, nil
+}
+
+// readControl reads the control file from the given Debian package, which is
+// an ar archive holding the control and data archives.
+func readControl(r io.Reader) (stanza, error) {
+	br := bufio.NewReader(r)
+
+	magic := make([]byte, 8)
+
+	if _, err := io.ReadFull(br, magic); err != nil || string(magic) != "!<arch>\n" {
+		return nil, ErrBadPackage
+	}
+
+	hdr := make([]byte, 60)
+
+	for {
+		if _, err := io.ReadFull(br, hdr); err != nil {
+			return nil, ErrBadPackage
+		}
+
+		name := strings.TrimSuffix(strings.TrimSpace(string(hdr[:16])), "/")
+
+		size, err := strconv.ParseInt(strings.TrimSpace(string(hdr[48:58])), 10, 64)
+
+		if err != nil || size < 0 {
+			return nil, ErrBadPackage
+		}
+
+		member := io.LimitReader(br, size)
+
+		if strings.HasPrefix(name, "control.tar") {
+			return readControlTar(name, member)
+		}
+
+		// Members are padded to an even number of bytes.
+		if _, err := io.CopyN(io.Discard, br, size+size%2); err != nil {
+			return nil, ErrBadPackage
+		}
+	}
+}
+
+func readControlTar(name string, r io.Reader) (stanza, error) {
+	switch path.Ext(name) {
+	case ".tar":
+	case ".gz":
+		zr, err := gzip.NewReader(r)
+
+		if err != nil {
+			return nil, ErrBadPackage
+		}
+
+		defer zr.Close()
+
+		r = zr
+	default:
+		return nil, fmt.Errorf("repo: %s: %w", name, fs.ErrUnsupported)
+	}
+
+	tr := tar.NewReader(r)
+
+	for {
+		hdr, err := tr.Next()
+
+		if err != nil {
+			return nil, ErrBadPackage
+		}
+
+		if path.Clean(hdr.Name) != "control" {
+			continue
+		}
+
+		stanzas, err := parseStanzas(tr)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if len(stanzas) != 1 || !validControl(stanzas[0]) {
+			return nil, ErrBadPackage
+		}
+		return stanzas[0], nil
+	}
+}
+
+var (
+	packageName = regexp.MustCompile(`^[a-z0-9][a-z0-9+.-]*$`)
+	versionName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9.+~:-]*$`)
+	archName    = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+)
+
+// validControl reports whether the fields of the control file that make up
+// the name of the package in the pool are valid, so a package cannot be put
+// outside of the pool.
+func validControl(ctl stanza) bool {
+	if !packageName.MatchString(ctl.get("Package")) {
+		return false
+	}
+
+	if src := ctl.get("Source"); src != "" {
+		// The source may be followed by its version in parentheses.
+		src, _, _ = strings.Cut(src, " ")
+
+		if !packageName.MatchString(src) {
+			return false
+		}
+	}
+	return versionName.MatchString(ctl.get("Version")) && archName.MatchString(ctl.get("Architecture"))
+}
+
+// poolName returns the name of the package in the pool, which is grouped by
+// the first letter of its source package, or the first four letters of
+// libraries, as in the Debian archive.
+func (a *Apt) poolName(ctl stanza) string {
+	src := ctl.get("Source")
+
+	if src == "" {
+		src = ctl.get("Package")
+	}
+
+	// The source may be followed by its version in parentheses.
+	src, _, _ = strings.Cut(src, " ")
+
+	prefix := src[:1]
+
+	if strings.HasPrefix(src, "lib") && len(src) > 3 {
+		prefix = src[:4]
+	}
+
+	// Epochs are not part of the file name.
+	version := ctl.get("Version")
+
+	if _, v, ok := strings.Cut(version, ":"); ok {
+		version = v
+	}
+
+	file := ctl.get("Package") + "_" + version + "_" + ctl.get("Architecture") + ".deb"
+
+	return path.Join("pool", a.cfg.component, prefix, src, file)
+}
+
+// Put puts the given Debian package into the pool, and adds it to the index of
+// its architecture, replacing any package of the same name, version, and
+// architecture. The Release file of the suite is regenerated once the index
+// has been updated.
+//
+// Only packages with an uncompressed or gzip compressed control archive are
+// supported, otherwise ErrUnsupported is returned. Recent versions of dpkg-deb
+// compress the control archive with xz by default, and Ubuntu with zstd, so
+// packages should be built with "dpkg-deb -Zgzip" to be put. ErrBadPackage is returned if the name, version,
+// or architecture of the package is not valid.
+func (a *Apt) Put(f fs.File) error {
+	info, err := f.Stat()
+
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp("", "repo-*")
+
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	md5sum := md5.New()
+	sha256sum := sha256.New()
+
+	size, err := io.Copy(io.MultiWriter(tmp, md5sum, sha256sum), f)
+
+	if err != nil {
+		return &fs.PathError{Op: "repo", Path: info.Name(), Err: err}
+	}
+
+	ctl, err := readControl(io.NewSectionReader(tmp, 0, size))
+
+	if err != nil {
+		return &fs.PathError{Op: "repo", Path: info.Name(), Err: err}
+	}
+
+	name := a.poolName(ctl)
+
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	stored, err := fs.PutPath(a.fs, name, fs.Rename(tmp, path.Base(name)))
+
+	if err != nil {
+		return err
+	}
+	stored.Close()
+
+	entry := append(ctl, []field{
+		{name: "Filename", value: name},
+		{name: "Size", value: strconv.FormatInt(size, 10)},
+		{name: "MD5sum", value: hex.EncodeToString(md5sum.Sum(nil))},
+		{name: "SHA256", value: hex.EncodeToString(sha256sum.Sum(nil))},
+	}...)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := a.index(entry); err != nil {
+		return err
+	}
+	return a.release()
+}
+
+func (a *Apt) dist() string {
+	return path.Join("dists", a.cfg.suite)
+}
+
+// index adds the given entry to the Packages index of its architecture. This
+// should be called with the mutex held.
+func (a *Apt) index(entry stanza) error {
+	dir := path.Join(a.dist(), a.cfg.component, "binary-"+entry.get("Architecture"))
+
+	b, err := readAll(a.fs, path.Join(dir, "Packages"))
+
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	entries, err := parseStanzas(bytes.NewReader(b))
+
+	if err != nil {
+		return &fs.PathError{Op: "repo", Path: path.Join(dir, "Packages"), Err: err}
+	}
+
+	key := func(s stanza) string {
+		return s.get("Package") + " " + s.get("Version") + " " + s.get("Architecture")
+	}
+
+	replaced := false
+
+	for i, e := range entries {
+		if key(e) == key(entry) {
+			entries[i] = entry
+			replaced = true
+			break
+		}
+	}
+
+	if !replaced {
+		entries = append(entries, entry)
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].get("Package") < entries[j].get("Package")
+	})
+
+	var buf bytes.Buffer
+
+	for i, e := range entries {
+		if i > 0 {
+			buf.WriteString("\n")
+		}
+		buf.WriteString(e.String())
+	}
+
+	var gz bytes.Buffer
+
+	zw := gzip.NewWriter(&gz)
+
+	if _, err := zw.Write(buf.Bytes()); err != nil {
+		return err
+	}
+
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	if err := put(a.fs, path.Join(dir, "Packages.gz"), "application/gzip", &gz); err != nil {
+		return err
+	}
+	return put(a.fs, path.Join(dir, "Packages"), "text/plain; charset=utf-8", &buf)
+}
+
+// release regenerates the Release file of the suite from the indexes in it.
+// This should be called with the mutex held.
+func (a *Apt) release() error {
+	dist := a.dist()
+
+	type index struct {
+		name string
+		size int
+		hash string
+	}
+
+	var (
+		indexes []index
+		archs   []string
+		comps   []string
+	)
+
+	seenArch := make(map[string]struct{})
+	seenComp := make(map[string]struct{})
+
+	err := fs.Walk(a.fs, dist, func(name string, ent fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if ent.IsDir() {
+			return nil
+		}
+
+		base := path.Base(name)
+
+		if base != "Packages" && base != "Packages.gz" {
+			return nil
+		}
+
+		b, err := readAll(a.fs, name)
+
+		if err != nil {
+			return err
+		}
+
+		rel := strings.TrimPrefix(name, dist+"/")
+
+		indexes = append(indexes, index{
+			name: rel,
+			size: len(b),
+			hash: sha256Hex(b),
+		})
+
+		// Indexes are stored under <component>/binary-<arch>/.
+		parts := strings.Split(rel, "/")
+
+		if len(parts) == 3 {
+			if _, ok := seenComp[parts[0]]; !ok {
+				seenComp[parts[0]] = struct{}{}
+				comps = append(comps, parts[0])
+			}
+
+			arch := strings.TrimPrefix(parts[1], "binary-")
+
+			if _, ok := seenArch[arch]; !ok {
+				seenArch[arch] = struct{}{}
+				archs = append(archs, arch)
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	sort.Strings(archs)
+	sort.Strings(comps)
+	sort.Slice(indexes, func(i, j int) bool {
+		return indexes[i].name < indexes[j].name
+	})
+
+	rel := stanza{}
+
+	if a.cfg.origin != "" {
+		rel = append(rel, field{name: "Origin", value: a.cfg.origin})
+	}
+
+	if a.cfg.label != "" {
+		rel = append(rel, field{name: "Label", value: a.cfg.label})
+	}
+
+	rel = append(rel, []field{
+		{name: "Suite", value: a.cfg.suite},
+		{name: "Codename", value: a.cfg.suite},
+		{name: "Date", value: a.cfg.now().UTC().Format(time.RFC1123Z)},
+		{name: "Architectures", value: strings.Join(archs, " ")},
+		{name: "Components", value: strings.Join(comps, " ")},
+	}...)
+
+	var sums strings.Builder
+
+	for _, idx := range indexes {
+		fmt.Fprintf(&sums, "\n %s %d %s", idx.hash, idx.size, idx.name)
+	}
+
+	rel = append(rel, field{name: "SHA256", value: sums.String()})
+
+	return a.cfg.putSigned(a.fs, path.Join(dist, "Release"), path.Join(dist, "Release.gpg"), "text/plain; charset=utf-8", []byte(rel.String()))
+}
@@ -0,0 +1,179 @@
+// Package repo maintains the metadata of package repositories in an FS, so
+// packages can be installed from the FS with apt or dnf once it is served over
+// HTTP.
+//
+// An Apt repository stores Debian packages in a pool, and updates the Packages
+// index of their architecture, and the Release file of the suite, as each
+// package is put, for example,
+//
+//	apt := repo.NewApt(store, repo.Suite("stable"), repo.Component("main"))
+//
+//	if err := apt.Put(f); err != nil {
+//		return err
+//	}
+//
+// A Yum repository stores RPM packages, and updates the repodata as each
+// package is put.
+//
+// Neither repository signs its metadata unless a Signer is given, as this
+// requires OpenPGP, which is not part of the standard library.
+package repo
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"path"
+	"time"
+
+	"github.com/andrewpillar/fs"
+)
+
+// Signer returns a detached, ASCII armored OpenPGP signature of the given
+// metadata.
+type Signer func(b []byte) ([]byte, error)
+
+type config struct {
+	suite     string
+	component string
+	origin    string
+	label     string
+	sign      Signer
+	now       func() time.Time
+}
+
+// Option configures a repository.
+type Option func(*config)
+
+// Suite sets the suite of an Apt repository. Defaults to stable.
+func Suite(name string) Option {
+	return func(c *config) {
+		c.suite = name
+	}
+}
+
+// Component sets the component of an Apt repository. Defaults to main.
+func Component(name string) Option {
+	return func(c *config) {
+		c.component = name
+	}
+}
+
+// Origin sets the origin of an Apt repository, as given in its Release file.
+func Origin(name string) Option {
+	return func(c *config) {
+		c.origin = name
+	}
+}
+
+// Label sets the label of an Apt repository, as given in its Release file.
+func Label(name string) Option {
+	return func(c *config) {
+		c.label = name
+	}
+}
+
+// Sign sets the Signer used to sign the metadata of the repository. An Apt
+// repository writes the signature of its Release file to Release.gpg, and a
+// Yum repository writes the signature of its repomd.xml file to
+// repomd.xml.asc.
+func Sign(s Signer) Option {
+	return func(c *config) {
+		c.sign = s
+	}
+}
+
+// WithClock sets the function used to get the time the metadata was
+// generated. Defaults to time.Now.
+func WithClock(now func() time.Time) Option {
+	return func(c *config) {
+		c.now = now
+	}
+}
+
+func newConfig(opts []Option) *config {
+	c := &config{
+		suite:     "stable",
+		component: "main",
+		now:       time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+type metadataFile struct {
+	fs.File
+
+	md fs.Metadata
+}
+
+func (f *metadataFile) Metadata() fs.Metadata { return f.md }
+
+// put puts the content read from r into the FS under the given name, with the
+// given content type set as metadata.
+func put(s fs.FS, name, ctype string, r io.Reader) error {
+	f, err := fs.ReadFile(path.Base(name), r)
+
+	if err != nil {
+		return &fs.PathError{Op: "repo", Path: name, Err: err}
+	}
+
+	defer fs.Cleanup(f)
+
+	if dir := path.Dir(name); dir != "." {
+		sub, err := s.Sub(dir)
+
+		if err != nil {
+			return err
+		}
+		s = sub
+	}
+
+	stored, err := fs.PutMetadata(s, &metadataFile{
+		File: f,
+		md:   fs.Metadata{fs.MetadataContentType: ctype},
+	})
+
+	if err != nil {
+		return err
+	}
+	return stored.Close()
+}
+
+// putSigned puts the given metadata into the FS, along with its signature if
+// a Signer was given.
+func (c *config) putSigned(s fs.FS, name, sigName, ctype string, b []byte) error {
+	if c.sign != nil {
+		sig, err := c.sign(b)
+
+		if err != nil {
+			return &fs.PathError{Op: "repo", Path: name, Err: err}
+		}
+
+		if err := put(s, sigName, "application/pgp-signature", bytes.NewReader(sig)); err != nil {
+			return err
+		}
+	}
+	return put(s, name, ctype, bytes.NewReader(b))
+}
+
+func readAll(s fs.FS, name string) ([]byte, error) {
+	f, err := s.Open(name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	return io.ReadAll(f)
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,310 @@
+package repo
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andrewpillar/fs"
+	"github.com/andrewpillar/fs/fakefs"
+)
+
+func arMember(buf *bytes.Buffer, name string, data []byte) {
+	fmt.Fprintf(buf, "%-16s%-12d%-6d%-6d%-8s%-10d`\n", name, 0, 0, 0, "100644", len(data))
+	buf.Write(data)
+
+	if len(data)%2 == 1 {
+		buf.WriteByte('\n')
+	}
+}
+
+func debPackage(t *testing.T, control string) fs.File {
+	var ctl bytes.Buffer
+
+	zw := gzip.NewWriter(&ctl)
+	tw := tar.NewWriter(zw)
+
+	if err := tw.WriteHeader(&tar.Header{Name: "./control", Mode: 0644, Size: int64(len(control))}); err != nil {
+		t.Fatal(err)
+	}
+
+	io.WriteString(tw, control)
+	tw.Close()
+	zw.Close()
+
+	var buf bytes.Buffer
+
+	buf.WriteString("!<arch>\n")
+	arMember(&buf, "debian-binary", []byte("2.0\n"))
+	arMember(&buf, "control.tar.gz", ctl.Bytes())
+	arMember(&buf, "data.tar.gz", []byte("data"))
+
+	f, err := fs.ReadFile("pkg.deb", &buf)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func Test_Apt(t *testing.T) {
+	store := fakefs.New()
+
+	apt := NewApt(store, Origin("Example"), Sign(func(b []byte) ([]byte, error) {
+		return []byte("signature"), nil
+	}))
+
+	controls := []string{
+		"Package: hello\nVersion: 1.0-1\nArchitecture: amd64\nDescription: Say hello\n Prints a greeting.\n",
+		"Package: libfoo1\nSource: libfoo (1.2)\nVersion: 1:1.2-1\nArchitecture: amd64\n",
+		"Package: hello\nVersion: 1.0-1\nArchitecture: amd64\nDescription: Say hello again\n",
+	}
+
+	for _, ctl := range controls {
+		if err := apt.Put(debPackage(t, ctl)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, name := range []string{
+		"pool/main/h/hello/hello_1.0-1_amd64.deb",
+		"pool/main/libf/libfoo/libfoo1_1.2-1_amd64.deb",
+		"dists/stable/main/binary-amd64/Packages.gz",
+		"dists/stable/Release.gpg",
+	} {
+		if _, err := store.Stat(name); err != nil {
+			t.Fatalf("expected %q to exist: %s\n", name, err)
+		}
+	}
+
+	b, err := readAll(store, "dists/stable/main/binary-amd64/Packages")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := parseStanzas(bytes.NewReader(b))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 2 {
+		t.Fatalf("unexpected entries, expected=%d, got=%d\n", 2, len(entries))
+	}
+
+	if desc := entries[0].get("Description"); desc != "Say hello again" {
+		t.Fatalf("unexpected description, expected=%q, got=%q\n", "Say hello again", desc)
+	}
+
+	if name := entries[1].get("Filename"); name != "pool/main/libf/libfoo/libfoo1_1.2-1_amd64.deb" {
+		t.Fatalf("unexpected filename, expected=%q, got=%q\n", "pool/main/libf/libfoo/libfoo1_1.2-1_amd64.deb", name)
+	}
+
+	b, err = readAll(store, "dists/stable/Release")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rels, err := parseStanzas(bytes.NewReader(b))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rel := rels[0]
+
+	if origin := rel.get("Origin"); origin != "Example" {
+		t.Fatalf("unexpected origin, expected=%q, got=%q\n", "Example", origin)
+	}
+
+	if archs := rel.get("Architectures"); archs != "amd64" {
+		t.Fatalf("unexpected architectures, expected=%q, got=%q\n", "amd64", archs)
+	}
+
+	sums := strings.Split(strings.TrimSpace(rel.get("SHA256")), "\n")
+
+	if len(sums) != 2 || !strings.HasSuffix(sums[0], " main/binary-amd64/Packages") {
+		t.Fatalf("unexpected checksums %q\n", sums)
+	}
+
+	if err := apt.Put(debPackage(t, "Package: broken\n")); err == nil {
+		t.Fatalf("expected error for package without a version\n")
+	}
+
+	// Names that would place the package outside of the pool are refused.
+	bad := []string{
+		"Package: ../../evil\nVersion: 1.0\nArchitecture: amd64\n",
+		"Package: evil\nSource: ../evil\nVersion: 1.0\nArchitecture: amd64\n",
+		"Package: evil\nVersion: 1.0/../../x\nArchitecture: amd64\n",
+		"Package: evil\nVersion: 1.0\nArchitecture: ../amd64\n",
+		"Package: Evil\nVersion: 1.0\nArchitecture: amd64\n",
+	}
+
+	for i, control := range bad {
+		if err := apt.Put(debPackage(t, control)); !errors.Is(err, ErrBadPackage) {
+			t.Fatalf("bad[%d] - unexpected error, expected=%q, got=%v\n", i, ErrBadPackage, err)
+		}
+	}
+}
+
+type rpmTag struct {
+	tag  uint32
+	typ  uint32
+	vals []any
+}
+
+func rpmHeaderBytes(tags []rpmTag) []byte {
+	var index, store bytes.Buffer
+
+	for _, tag := range tags {
+		// Integers are aligned to four bytes.
+		if tag.typ == typeInt32 {
+			for store.Len()%4 != 0 {
+				store.WriteByte(0)
+			}
+		}
+
+		binary.Write(&index, binary.BigEndian, []uint32{tag.tag, tag.typ, uint32(store.Len()), uint32(len(tag.vals))})
+
+		for _, v := range tag.vals {
+			switch v := v.(type) {
+			case string:
+				store.WriteString(v)
+				store.WriteByte(0)
+			case int:
+				binary.Write(&store, binary.BigEndian, uint32(v))
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+
+	buf.Write(headerMagic)
+	buf.Write(make([]byte, 4))
+	binary.Write(&buf, binary.BigEndian, []uint32{uint32(len(tags)), uint32(store.Len())})
+	buf.Write(index.Bytes())
+	buf.Write(store.Bytes())
+	return buf.Bytes()
+}
+
+func rpmPackageFile(t *testing.T, version string) fs.File {
+	var buf bytes.Buffer
+
+	lead := make([]byte, 96)
+	copy(lead, []byte{0xed, 0xab, 0xee, 0xdb})
+	buf.Write(lead)
+
+	sig := rpmHeaderBytes([]rpmTag{{tag: 1000, typ: typeInt32, vals: []any{1}}})
+	buf.Write(sig)
+	buf.Write(make([]byte, (8-len(sig)%8)%8))
+
+	buf.Write(rpmHeaderBytes([]rpmTag{
+		{tag: tagName, typ: typeString, vals: []any{"hello"}},
+		{tag: tagVersion, typ: typeString, vals: []any{version}},
+		{tag: tagRelease, typ: typeString, vals: []any{"1"}},
+		{tag: tagSummary, typ: typeI18NString, vals: []any{"Say <hello>"}},
+		{tag: tagArch, typ: typeString, vals: []any{"x86_64"}},
+		{tag: tagSourceRPM, typ: typeString, vals: []any{"hello-" + version + "-1.src.rpm"}},
+		{tag: tagProvideName, typ: typeStringArray, vals: []any{"hello"}},
+		{tag: tagProvideFlags, typ: typeInt32, vals: []any{8}},
+		{tag: tagProvideVersion, typ: typeStringArray, vals: []any{version + "-1"}},
+		{tag: tagRequireName, typ: typeStringArray, vals: []any{"glibc", "rpmlib(CompressedFileNames)"}},
+		{tag: tagRequireFlags, typ: typeInt32, vals: []any{12, 8 | senseRPMLib}},
+		{tag: tagRequireVersion, typ: typeStringArray, vals: []any{"2.17", "3.0.4-1"}},
+	}))
+	buf.WriteString("payload")
+
+	f, err := fs.ReadFile("hello.rpm", &buf)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func Test_Yum(t *testing.T) {
+	store := fakefs.New()
+
+	clock := fakefs.NewManualClock(time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC))
+
+	yum := NewYum(store, WithClock(clock.Now))
+
+	for _, version := range []string{"1.0", "1.1", "1.0"} {
+		if err := yum.Put(rpmPackageFile(t, version)); err != nil {
+			t.Fatal(err)
+		}
+		clock.Advance(time.Second)
+	}
+
+	if _, err := store.Stat("Packages/hello-1.1-1.x86_64.rpm"); err != nil {
+		t.Fatal(err)
+	}
+
+	md, loc, err := yum.readPrimary()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(md.Packages) != 2 {
+		t.Fatalf("unexpected packages, expected=%d, got=%d\n", 2, len(md.Packages))
+	}
+
+	inner := md.Packages[0].Inner
+
+	for _, s := range []string{
+		"<summary>Say &lt;hello&gt;</summary>",
+		`<rpm:entry name="glibc" flags="GE" epoch="0" ver="2.17"/>`,
+		`<location href="Packages/hello-1.0-1.x86_64.rpm"/>`,
+	} {
+		if !strings.Contains(inner, s) {
+			t.Fatalf("expected primary to contain %q, got=%q\n", s, inner)
+		}
+	}
+
+	if strings.Contains(inner, "rpmlib(") {
+		t.Fatalf("unexpected rpmlib requirement in %q\n", inner)
+	}
+
+	var primaries int
+
+	for _, name := range store.Files() {
+		if strings.HasSuffix(name, "-primary.xml.gz") {
+			primaries++
+
+			if name != loc {
+				t.Fatalf("unexpected primary, expected=%q, got=%q\n", loc, name)
+			}
+		}
+	}
+
+	if primaries != 1 {
+		t.Fatalf("unexpected primaries, expected=%d, got=%d\n", 1, primaries)
+	}
+
+	b, err := readAll(store, "repodata/repomd.xml")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rmd repomd
+
+	if err := xml.Unmarshal(b, &rmd); err != nil {
+		t.Fatal(err)
+	}
+
+	if rmd.Data[0].Location.Href != loc {
+		t.Fatalf("unexpected location, expected=%q, got=%q\n", loc, rmd.Data[0].Location.Href)
+	}
+}
@@ -0,0 +1,631 @@
+package repo
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andrewpillar/fs"
+)
+
+// The tags of the RPM header used in the repodata.
+const (
+	tagName           = 1000
+	tagVersion        = 1001
+	tagRelease        = 1002
+	tagEpoch          = 1003
+	tagSummary        = 1004
+	tagDescription    = 1005
+	tagBuildTime      = 1006
+	tagBuildHost      = 1007
+	tagSize           = 1009
+	tagVendor         = 1011
+	tagLicense        = 1014
+	tagPackager       = 1015
+	tagGroup          = 1016
+	tagURL            = 1020
+	tagArch           = 1022
+	tagSourceRPM      = 1044
+	tagArchiveSize    = 1046
+	tagProvideName    = 1047
+	tagRequireFlags   = 1048
+	tagRequireName    = 1049
+	tagRequireVersion = 1050
+	tagProvideFlags   = 1112
+	tagProvideVersion = 1113
+)
+
+// The types of the values in the RPM header.
+const (
+	typeInt32       = 4
+	typeString      = 6
+	typeStringArray = 8
+	typeI18NString  = 9
+)
+
+// senseRPMLib marks a requirement on a feature of rpm itself, which is not
+// listed in the repodata.
+const senseRPMLib = 1 << 24
+
+var headerMagic = []byte{0x8e, 0xad, 0xe8, 0x01}
+
+type rpmEntry struct {
+	typ   uint32
+	count uint32
+	data  []byte
+}
+
+type rpmHeader map[uint32]rpmEntry
+
+// readHeader reads an RPM header from the given reader, and returns it along
+// with its length in bytes.
+func readHeader(r io.Reader) (rpmHeader, int64, error) {
+	intro := make([]byte, 16)
+
+	if _, err := io.ReadFull(r, intro); err != nil || !bytes.Equal(intro[:4], headerMagic) {
+		return nil, 0, ErrBadPackage
+	}
+
+	nindex := binary.BigEndian.Uint32(intro[8:])
+	hsize := binary.BigEndian.Uint32(intro[12:])
+
+	if nindex > 1<<16 || hsize > 256<<20 {
+		return nil, 0, ErrBadPackage
+	}
+
+	index := make([]byte, 16*nindex)
+
+	if _, err := io.ReadFull(r, index); err != nil {
+		return nil, 0, ErrBadPackage
+	}
+
+	store := make([]byte, hsize)
+
+	if _, err := io.ReadFull(r, store); err != nil {
+		return nil, 0, ErrBadPackage
+	}
+
+	h := make(rpmHeader)
+
+	for i := uint32(0); i < nindex; i++ {
+		ent := index[i*16:]
+
+		off := binary.BigEndian.Uint32(ent[8:])
+
+		if off > hsize {
+			return nil, 0, ErrBadPackage
+		}
+
+		h[binary.BigEndian.Uint32(ent)] = rpmEntry{
+			typ:   binary.BigEndian.Uint32(ent[4:]),
+			count: binary.BigEndian.Uint32(ent[12:]),
+			data:  store[off:],
+		}
+	}
+	return h, int64(16 + len(index) + len(store)), nil
+}
+
+// stringValues returns the string values of the given tag.
+func (h rpmHeader) stringValues(tag uint32) []string {
+	ent, ok := h[tag]
+
+	if !ok || (ent.typ != typeString && ent.typ != typeStringArray && ent.typ != typeI18NString) {
+		return nil
+	}
+
+	vals := make([]string, 0, ent.count)
+	data := ent.data
+
+	for i := uint32(0); i < ent.count; i++ {
+		end := bytes.IndexByte(data, 0)
+
+		if end < 0 {
+			break
+		}
+
+		vals = append(vals, string(data[:end]))
+		data = data[end+1:]
+	}
+	return vals
+}
+
+// stringValue returns the first string value of the given tag. Only the first
+// translation of an I18N string is used.
+func (h rpmHeader) stringValue(tag uint32) string {
+	if vals := h.stringValues(tag); len(vals) > 0 {
+		return vals[0]
+	}
+	return ""
+}
+
+// intValues returns the integer values of the given tag.
+func (h rpmHeader) intValues(tag uint32) []int64 {
+	ent, ok := h[tag]
+
+	if !ok || ent.typ != typeInt32 {
+		return nil
+	}
+
+	vals := make([]int64, 0, ent.count)
+
+	for i := uint32(0); i < ent.count && len(ent.data) >= int(i+1)*4; i++ {
+		vals = append(vals, int64(binary.BigEndian.Uint32(ent.data[i*4:])))
+	}
+	return vals
+}
+
+// intValue returns the first integer value of the given tag, and whether the tag was
+// present.
+func (h rpmHeader) intValue(tag uint32) (int64, bool) {
+	if vals := h.intValues(tag); len(vals) > 0 {
+		return vals[0], true
+	}
+	return 0, false
+}
+
+// rpmPackage is an RPM package, as parsed from its header.
+type rpmPackage struct {
+	header     rpmHeader
+	start, end int64 // The range of the header in the package.
+}
+
+// readRPM reads the headers of the given RPM package, which starts with a
+// lead, followed by the signature header, and then the header.
+func readRPM(r io.Reader) (*rpmPackage, error) {
+	br := bufio.NewReader(r)
+
+	lead := make([]byte, 96)
+
+	if _, err := io.ReadFull(br, lead); err != nil || !bytes.Equal(lead[:4], []byte{0xed, 0xab, 0xee, 0xdb}) {
+		return nil, ErrBadPackage
+	}
+
+	_, n, err := readHeader(br)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// The signature header is padded to a multiple of eight bytes.
+	pad := (8 - n%8) % 8
+
+	if _, err := io.CopyN(io.Discard, br, pad); err != nil {
+		return nil, ErrBadPackage
+	}
+
+	start := int64(len(lead)) + n + pad
+
+	h, n, err := readHeader(br)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if h.stringValue(tagName) == "" || h.stringValue(tagVersion) == "" || h.stringValue(tagRelease) == "" {
+		return nil, ErrBadPackage
+	}
+
+	return &rpmPackage{
+		header: h,
+		start:  start,
+		end:    start + n,
+	}, nil
+}
+
+func (p *rpmPackage) arch() string {
+	// Source packages have no source package.
+	if p.header.stringValue(tagSourceRPM) == "" {
+		return "src"
+	}
+	return p.header.stringValue(tagArch)
+}
+
+func (p *rpmPackage) epoch() string {
+	epoch, _ := p.header.intValue(tagEpoch)
+	return strconv.FormatInt(epoch, 10)
+}
+
+func (p *rpmPackage) fileName() string {
+	h := p.header
+	return h.stringValue(tagName) + "-" + h.stringValue(tagVersion) + "-" + h.stringValue(tagRelease) + "." + p.arch() + ".rpm"
+}
+
+func escapeXML(s string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
+
+// senseFlags returns the flags of a dependency as they are written in the
+// repodata.
+func senseFlags(flags int64) string {
+	switch flags & 0xe {
+	case 2:
+		return "LT"
+	case 4:
+		return "GT"
+	case 8:
+		return "EQ"
+	case 10:
+		return "LE"
+	case 12:
+		return "GE"
+	}
+	return ""
+}
+
+// writeDeps writes the dependencies with the given tags as entries of the
+// given element.
+func (p *rpmPackage) writeDeps(b *strings.Builder, elem string, nameTag, flagsTag, versionTag uint32) {
+	names := p.header.stringValues(nameTag)
+	flags := p.header.intValues(flagsTag)
+	versions := p.header.stringValues(versionTag)
+
+	var entries []string
+
+	for i, name := range names {
+		var (
+			flag    int64
+			version string
+		)
+
+		if i < len(flags) {
+			flag = flags[i]
+		}
+
+		if i < len(versions) {
+			version = versions[i]
+		}
+
+		if flag&senseRPMLib != 0 || strings.HasPrefix(name, "rpmlib(") {
+			continue
+		}
+
+		entry := `<rpm:entry name="` + escapeXML(name) + `"`
+
+		if sense := senseFlags(flag); sense != "" && version != "" {
+			epoch := "0"
+
+			if e, v, ok := strings.Cut(version, ":"); ok {
+				epoch, version = e, v
+			}
+
+			ver, rel, _ := strings.Cut(version, "-")
+
+			entry += ` flags="` + sense + `" epoch="` + escapeXML(epoch) + `" ver="` + escapeXML(ver) + `"`
+
+			if rel != "" {
+				entry += ` rel="` + escapeXML(rel) + `"`
+			}
+		}
+		entries = append(entries, entry+"/>")
+	}
+
+	if len(entries) == 0 {
+		return
+	}
+
+	b.WriteString("<rpm:" + elem + ">")
+
+	for _, entry := range entries {
+		b.WriteString(entry)
+	}
+	b.WriteString("</rpm:" + elem + ">")
+}
+
+// primary returns the inner XML of the package in the primary metadata.
+func (p *rpmPackage) primary(location, checksum string, size, mtime int64) string {
+	h := p.header
+
+	var b strings.Builder
+
+	installed, _ := h.intValue(tagSize)
+	archive, _ := h.intValue(tagArchiveSize)
+	built, _ := h.intValue(tagBuildTime)
+
+	fmt.Fprintf(&b, "<name>%s</name>", escapeXML(h.stringValue(tagName)))
+	fmt.Fprintf(&b, "<arch>%s</arch>", escapeXML(p.arch()))
+	fmt.Fprintf(&b, `<version epoch="%s" ver="%s" rel="%s"/>`, p.epoch(), escapeXML(h.stringValue(tagVersion)), escapeXML(h.stringValue(tagRelease)))
+	fmt.Fprintf(&b, `<checksum type="sha256" pkgid="YES">%s</checksum>`, checksum)
+	fmt.Fprintf(&b, "<summary>%s</summary>", escapeXML(h.stringValue(tagSummary)))
+	fmt.Fprintf(&b, "<description>%s</description>", escapeXML(h.stringValue(tagDescription)))
+	fmt.Fprintf(&b, "<packager>%s</packager>", escapeXML(h.stringValue(tagPackager)))
+	fmt.Fprintf(&b, "<url>%s</url>", escapeXML(h.stringValue(tagURL)))
+	fmt.Fprintf(&b, `<time file="%d" build="%d"/>`, mtime, built)
+	fmt.Fprintf(&b, `<size package="%d" installed="%d" archive="%d"/>`, size, installed, archive)
+	fmt.Fprintf(&b, `<location href="%s"/>`, escapeXML(location))
+	b.WriteString("<format>")
+	fmt.Fprintf(&b, "<rpm:license>%s</rpm:license>", escapeXML(h.stringValue(tagLicense)))
+	fmt.Fprintf(&b, "<rpm:vendor>%s</rpm:vendor>", escapeXML(h.stringValue(tagVendor)))
+	fmt.Fprintf(&b, "<rpm:group>%s</rpm:group>", escapeXML(h.stringValue(tagGroup)))
+	fmt.Fprintf(&b, "<rpm:buildhost>%s</rpm:buildhost>", escapeXML(h.stringValue(tagBuildHost)))
+	fmt.Fprintf(&b, "<rpm:sourcerpm>%s</rpm:sourcerpm>", escapeXML(h.stringValue(tagSourceRPM)))
+	fmt.Fprintf(&b, `<rpm:header-range start="%d" end="%d"/>`, p.start, p.end)
+	p.writeDeps(&b, "provides", tagProvideName, tagProvideFlags, tagProvideVersion)
+	p.writeDeps(&b, "requires", tagRequireName, tagRequireFlags, tagRequireVersion)
+	b.WriteString("</format>")
+
+	return b.String()
+}
+
+// primaryPackage is a package in the primary metadata. Only the fields that
+// identify the package are decoded, the rest is kept as it was written.
+type primaryPackage struct {
+	Name    string `xml:"name"`
+	Arch    string `xml:"arch"`
+	Version struct {
+		Epoch string `xml:"epoch,attr"`
+		Ver   string `xml:"ver,attr"`
+		Rel   string `xml:"rel,attr"`
+	} `xml:"version"`
+	Inner string `xml:",innerxml"`
+}
+
+func (p primaryPackage) key() string {
+	return p.Name + " " + p.Arch + " " + p.Version.Epoch + ":" + p.Version.Ver + "-" + p.Version.Rel
+}
+
+type primaryMetadata struct {
+	Packages []primaryPackage `xml:"package"`
+}
+
+type repomdChecksum struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+type repomdData struct {
+	Type         string         `xml:"type,attr"`
+	Checksum     repomdChecksum `xml:"checksum"`
+	OpenChecksum repomdChecksum `xml:"open-checksum"`
+	Location     struct {
+		Href string `xml:"href,attr"`
+	} `xml:"location"`
+	Timestamp int64 `xml:"timestamp"`
+	Size      int   `xml:"size"`
+	OpenSize  int   `xml:"open-size"`
+}
+
+type repomd struct {
+	XMLName  xml.Name     `xml:"http://linux.duke.edu/metadata/repo repomd"`
+	Revision int64        `xml:"revision"`
+	Data     []repomdData `xml:"data"`
+}
+
+// Yum is a Yum repository in an FS, which can be used by yum and dnf. It is
+// safe for concurrent use, though only one Yum should update the repodata of
+// the FS at a time.
+type Yum struct {
+	fs  fs.FS
+	cfg *config
+
+	mu sync.Mutex
+}
+
+// NewYum returns a Yum repository in the given FS. Only the Sign and WithClock
+// options apply to a Yum repository.
+func NewYum(s fs.FS, opts ...Option) *Yum {
+	return &Yum{
+		fs:  s,
+		cfg: newConfig(opts),
+	}
+}
+
+// Put puts the given RPM package into the Packages directory, and adds it to
+// the primary metadata in the repodata directory, replacing any package of the
+// same name, architecture, and version. The repomd.xml file is regenerated once
+// the primary metadata has been updated.
+func (y *Yum) Put(f fs.File) error {
+	info, err := f.Stat()
+
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp("", "repo-*")
+
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	sum := sha256.New()
+
+	size, err := io.Copy(io.MultiWriter(tmp, sum), f)
+
+	if err != nil {
+		return &fs.PathError{Op: "repo", Path: info.Name(), Err: err}
+	}
+
+	pkg, err := readRPM(io.NewSectionReader(tmp, 0, size))
+
+	if err != nil {
+		return &fs.PathError{Op: "repo", Path: info.Name(), Err: err}
+	}
+
+	name := path.Join("Packages", pkg.fileName())
+
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	stored, err := fs.PutPath(y.fs, name, fs.Rename(tmp, path.Base(name)))
+
+	if err != nil {
+		return err
+	}
+	stored.Close()
+
+	entry := primaryPackage{
+		Name:  pkg.header.stringValue(tagName),
+		Arch:  pkg.arch(),
+		Inner: pkg.primary(name, hex.EncodeToString(sum.Sum(nil)), size, y.cfg.now().Unix()),
+	}
+	entry.Version.Epoch = pkg.epoch()
+	entry.Version.Ver = pkg.header.stringValue(tagVersion)
+	entry.Version.Rel = pkg.header.stringValue(tagRelease)
+
+	y.mu.Lock()
+	defer y.mu.Unlock()
+
+	return y.index(entry)
+}
+
+// readPrimary returns the primary metadata referenced by the repomd.xml file,
+// along with its location.
+func (y *Yum) readPrimary() (primaryMetadata, string, error) {
+	var md primaryMetadata
+
+	b, err := readAll(y.fs, "repodata/repomd.xml")
+
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return md, "", nil
+		}
+		return md, "", err
+	}
+
+	var rmd repomd
+
+	if err := xml.Unmarshal(b, &rmd); err != nil {
+		return md, "", &fs.PathError{Op: "repo", Path: "repodata/repomd.xml", Err: err}
+	}
+
+	var loc string
+
+	for _, data := range rmd.Data {
+		if data.Type == "primary" {
+			loc = data.Location.Href
+		}
+	}
+
+	if loc == "" {
+		return md, "", nil
+	}
+
+	f, err := y.fs.Open(loc)
+
+	if err != nil {
+		return md, "", err
+	}
+
+	defer f.Close()
+
+	zr, err := gzip.NewReader(f)
+
+	if err != nil {
+		return md, "", &fs.PathError{Op: "repo", Path: loc, Err: err}
+	}
+
+	if err := xml.NewDecoder(zr).Decode(&md); err != nil {
+		return md, "", &fs.PathError{Op: "repo", Path: loc, Err: err}
+	}
+	return md, loc, nil
+}
+
+// index adds the given package to the primary metadata, and regenerates the
+// repomd.xml file. The primary metadata is stored under its checksum, so
+// clients that fetched the previous repomd.xml file do not fetch metadata that
+// does not match it. This should be called with the mutex held.
+func (y *Yum) index(entry primaryPackage) error {
+	md, prev, err := y.readPrimary()
+
+	if err != nil {
+		return err
+	}
+
+	replaced := false
+
+	for i, pkg := range md.Packages {
+		if pkg.key() == entry.key() {
+			md.Packages[i] = entry
+			replaced = true
+			break
+		}
+	}
+
+	if !replaced {
+		md.Packages = append(md.Packages, entry)
+	}
+
+	sort.SliceStable(md.Packages, func(i, j int) bool {
+		return md.Packages[i].Name < md.Packages[j].Name
+	})
+
+	var buf bytes.Buffer
+
+	buf.WriteString(xml.Header)
+	fmt.Fprintf(&buf, `<metadata xmlns="http://linux.duke.edu/metadata/common" xmlns:rpm="http://linux.duke.edu/metadata/rpm" packages="%d">`+"\n", len(md.Packages))
+
+	for _, pkg := range md.Packages {
+		buf.WriteString(`<package type="rpm">`)
+		buf.WriteString(pkg.Inner)
+		buf.WriteString("</package>\n")
+	}
+	buf.WriteString("</metadata>\n")
+
+	var gz bytes.Buffer
+
+	zw := gzip.NewWriter(&gz)
+
+	if _, err := zw.Write(buf.Bytes()); err != nil {
+		return err
+	}
+
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	checksum := sha256Hex(gz.Bytes())
+
+	data := repomdData{
+		Type:         "primary",
+		Checksum:     repomdChecksum{Type: "sha256", Value: checksum},
+		OpenChecksum: repomdChecksum{Type: "sha256", Value: sha256Hex(buf.Bytes())},
+		Timestamp:    y.cfg.now().Unix(),
+		Size:         gz.Len(),
+		OpenSize:     buf.Len(),
+	}
+	data.Location.Href = "repodata/" + checksum + "-primary.xml.gz"
+
+	if err := put(y.fs, data.Location.Href, "application/gzip", &gz); err != nil {
+		return err
+	}
+
+	b, err := xml.MarshalIndent(repomd{
+		Revision: data.Timestamp,
+		Data:     []repomdData{data},
+	}, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	b = append([]byte(xml.Header), append(b, '\n')...)
+
+	if err := y.cfg.putSigned(y.fs, "repodata/repomd.xml", "repodata/repomd.xml.asc", "application/xml", b); err != nil {
+		return err
+	}
+
+	if prev != "" && prev != data.Location.Href {
+		if err := y.fs.Remove(prev); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
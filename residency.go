@@ -0,0 +1,302 @@
+package fs
+
+import (
+	"errors"
+	"sort"
+	"sync"
+)
+
+// PickFunc picks the region a file is stored in, from its name and metadata.
+type PickFunc func(name string, md Metadata) string
+
+type residencyFS struct {
+	pick    PickFunc
+	regions map[string]FS
+	names   []string // The names of the regions, sorted.
+
+	mu    sync.Mutex
+	index map[string]string // Which region each file lives in.
+}
+
+// Residency returns a filesystem that routes each file put in it to the
+// filesystem of the region chosen by pick, so files can be kept in the
+// jurisdiction they belong to. The metadata given to pick is that of the file
+// being put if it implements MetadataFile, otherwise it is empty. If pick
+// returns a region that does not exist then ErrInvalid is returned in a
+// *PathError.
+//
+// An index of which region each file lives in is kept as files are put,
+// renamed, and removed. Opening a file that is not in the index looks for it
+// in each region in turn, in the order of their names, and adds it to the
+// index. Files are never moved between regions, so changing the metadata of a
+// file does not move it.
+func Residency(pick PickFunc, regions map[string]FS) FS {
+	names := make([]string, 0, len(regions))
+
+	for name := range regions {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	rs := &residencyFS{
+		pick:    pick,
+		regions: regions,
+		names:   names,
+		index:   make(map[string]string),
+	}
+
+	if canRenameAll(regions) {
+		return renameResidencyFS{residencyFS: rs}
+	}
+	return rs
+}
+
+// renameResidencyFS is a residencyFS over regions that each implement RenameFS.
+type renameResidencyFS struct {
+	*residencyFS
+}
+
+// locate returns the name and filesystem of the region the named file lives
+// in. If the file does not exist in any region then ErrNotExist is returned.
+func (s *residencyFS) locate(name string) (string, FS, error) {
+	s.mu.Lock()
+	region, ok := s.index[name]
+	s.mu.Unlock()
+
+	if ok {
+		return region, s.regions[region], nil
+	}
+
+	for _, region := range s.names {
+		store := s.regions[region]
+
+		if _, err := store.Stat(name); err != nil {
+			if errors.Is(err, ErrNotExist) {
+				continue
+			}
+			return "", nil, err
+		}
+
+		s.mu.Lock()
+		s.index[name] = region
+		s.mu.Unlock()
+
+		return region, store, nil
+	}
+	return "", nil, ErrNotExist
+}
+
+func (s *residencyFS) forget(names ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, name := range names {
+		delete(s.index, name)
+	}
+}
+
+// Unwrap returns the filesystem of each region, ordered by the name of the
+// region.
+func (s *residencyFS) Unwrap() []FS {
+	regions := make([]FS, 0, len(s.names))
+
+	for _, name := range s.names {
+		regions = append(regions, s.regions[name])
+	}
+	return regions
+}
+
+func (s *residencyFS) Open(name string) (File, error) {
+	_, store, err := s.locate(name)
+
+	if err != nil {
+		return nil, &PathError{Op: "open", Path: name, Err: err}
+	}
+	return store.Open(name)
+}
+
+// Sub returns a filesystem for the directory in every region, with its own
+// index.
+func (s *residencyFS) Sub(dir string) (FS, error) {
+	regions := make(map[string]FS, len(s.regions))
+
+	for region, store := range s.regions {
+		sub, err := store.Sub(dir)
+
+		if err != nil {
+			return nil, err
+		}
+		regions[region] = sub
+	}
+	return Residency(s.pick, regions), nil
+}
+
+func (s *residencyFS) Stat(name string) (FileInfo, error) {
+	_, store, err := s.locate(name)
+
+	if err != nil {
+		return nil, &PathError{Op: "stat", Path: name, Err: err}
+	}
+	return store.Stat(name)
+}
+
+// Put puts the file in the region picked for it. If the file already lives in
+// a different region then it is removed from there once the file is put.
+func (s *residencyFS) Put(f File) (File, error) {
+	info, err := f.Stat()
+
+	if err != nil {
+		return nil, err
+	}
+
+	name := info.Name()
+
+	md := Metadata{}
+
+	if mf, ok := f.(MetadataFile); ok {
+		md = mf.Metadata()
+	}
+
+	region := s.pick(name, md)
+
+	store, ok := s.regions[region]
+
+	if !ok {
+		return nil, &PathError{Op: "put", Path: name, Err: ErrInvalid}
+	}
+
+	prev, prevStore, err := s.locate(name)
+
+	if err != nil && !errors.Is(err, ErrNotExist) {
+		return nil, &PathError{Op: "put", Path: name, Err: err}
+	}
+
+	stored, err := store.Put(f)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if prevStore != nil && prev != region {
+		if err := prevStore.Remove(name); err != nil && !errors.Is(err, ErrNotExist) {
+			stored.Close()
+			return nil, err
+		}
+	}
+
+	s.mu.Lock()
+	s.index[name] = region
+	s.mu.Unlock()
+
+	return stored, nil
+}
+
+// mergeEntries merges the given directory listings into one sorted listing,
+// keeping the first entry of each name.
+func mergeEntries(lists ...[]DirEntry) []DirEntry {
+	seen := make(map[string]struct{})
+	ents := make([]DirEntry, 0)
+
+	for _, list := range lists {
+		for _, ent := range list {
+			if _, ok := seen[ent.Name()]; ok {
+				continue
+			}
+
+			seen[ent.Name()] = struct{}{}
+			ents = append(ents, ent)
+		}
+	}
+
+	sort.Slice(ents, func(i, j int) bool {
+		return ents[i].Name() < ents[j].Name()
+	})
+	return ents
+}
+
+// ReadDir merges the listings of the directory in every region. If the
+// directory does not exist in any region then ErrNotExist is returned.
+func (s *residencyFS) ReadDir(name string) ([]DirEntry, error) {
+	lists := make([][]DirEntry, 0, len(s.names))
+
+	for _, region := range s.names {
+		ents, err := ReadDir(s.regions[region], name)
+
+		if err != nil {
+			if errors.Is(err, ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		lists = append(lists, ents)
+	}
+
+	if len(lists) == 0 {
+		return nil, &PathError{Op: "readdir", Path: name, Err: ErrNotExist}
+	}
+	return mergeEntries(lists...), nil
+}
+
+// Rename renames the file within the region it lives in. If a file of the new
+// name lives in a different region then it is removed, as it would be if it
+// were replaced.
+func (s renameResidencyFS) Rename(oldname, newname string) error {
+	region, store, err := s.locate(oldname)
+
+	if err != nil {
+		return &PathError{Op: "rename", Path: oldname, Err: err}
+	}
+
+	other, otherStore, err := s.locate(newname)
+
+	if err != nil && !errors.Is(err, ErrNotExist) {
+		return &PathError{Op: "rename", Path: newname, Err: err}
+	}
+
+	if err := Move(store, oldname, newname); err != nil {
+		return err
+	}
+
+	if otherStore != nil && other != region {
+		if err := otherStore.Remove(newname); err != nil && !errors.Is(err, ErrNotExist) {
+			return err
+		}
+	}
+
+	s.forget(oldname, newname)
+	return nil
+}
+
+func (s *residencyFS) Metadata(name string) (Metadata, error) {
+	_, store, err := s.locate(name)
+
+	if err != nil {
+		return nil, &PathError{Op: "metadata", Path: name, Err: err}
+	}
+	return GetMetadata(store, name)
+}
+
+func (s *residencyFS) SetMetadata(name string, md Metadata) error {
+	_, store, err := s.locate(name)
+
+	if err != nil {
+		return &PathError{Op: "setmetadata", Path: name, Err: err}
+	}
+	return SetMetadata(store, name, md)
+}
+
+func (s *residencyFS) Remove(name string) error {
+	_, store, err := s.locate(name)
+
+	if err != nil {
+		return &PathError{Op: "remove", Path: name, Err: err}
+	}
+
+	if err := store.Remove(name); err != nil {
+		return err
+	}
+
+	s.forget(name)
+	return nil
+}
@@ -0,0 +1,109 @@
+package fs
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type metadataReader struct {
+	File
+
+	md Metadata
+}
+
+func (f *metadataReader) Metadata() Metadata { return f.md }
+
+func Test_Residency(t *testing.T) {
+	eu := tmpdir(t)
+	defer os.RemoveAll(eu)
+
+	us := tmpdir(t)
+	defer os.RemoveAll(us)
+
+	pick := func(name string, md Metadata) string {
+		if md["jurisdiction"] == "eu" {
+			return "eu"
+		}
+		return "us"
+	}
+
+	regions := map[string]FS{
+		"eu": New(eu),
+		"us": New(us),
+	}
+
+	store := Residency(pick, regions)
+
+	tests := []struct {
+		name         string
+		jurisdiction string
+		dir          string
+	}{
+		{"hans.txt", "eu", eu},
+		{"bob.txt", "us", us},
+		{"anon.txt", "", us},
+	}
+
+	for i, test := range tests {
+		f, err := ReadFile(test.name, bytes.NewReader([]byte(test.name)))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		stored, err := store.Put(&metadataReader{
+			File: f,
+			md:   Metadata{"jurisdiction": test.jurisdiction},
+		})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+		stored.Close()
+
+		if _, err := os.Stat(filepath.Join(test.dir, test.name)); err != nil {
+			t.Fatalf("tests[%d] - expected %q in %q: %v\n", i, test.name, test.dir, err)
+		}
+	}
+
+	// A fresh filesystem has an empty index, so has to find where each file
+	// lives.
+	store = Residency(pick, regions)
+
+	for _, test := range tests {
+		if b := readAll(t, store, test.name); string(b) != test.name {
+			t.Fatalf("unexpected data, expected=%q, got=%q\n", test.name, string(b))
+		}
+	}
+
+	ents, err := ReadDir(store, ".")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ents) != 3 {
+		t.Fatalf("unexpected entries, expected=%d, got=%d\n", 3, len(ents))
+	}
+
+	if err := store.Remove("hans.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.Stat("hans.txt"); !errors.Is(err, ErrNotExist) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", ErrNotExist, err)
+	}
+
+	f, err := ReadFile("bad.txt", bytes.NewReader(nil))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Residency(func(string, Metadata) string { return "mars" }, regions).Put(f); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", ErrInvalid, err)
+	}
+}
@@ -0,0 +1,298 @@
+// Package retention applies retention rules to the files in an FS, removing
+// the files that no rule keeps. This is intended for stores that accumulate
+// files over time, such as CI artifact and backup stores.
+//
+// Each rule applies to the files matching its pattern. A file is removed if it
+// matches at least one rule, and is not kept by any of the rules it matches.
+// Files that match no rule are never removed.
+package retention
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andrewpillar/fs"
+)
+
+// Rule is a single retention rule.
+type Rule struct {
+	// Pattern is the glob pattern, in the syntax of path.Match, that files
+	// must match for the rule to apply. If the pattern contains a slash then it
+	// is matched against the full path of the file, otherwise it is matched
+	// against the base name. An empty pattern matches every file.
+	Pattern string
+
+	// KeepLast keeps the given number of the most recently modified files.
+	KeepLast int
+
+	// KeepDaily keeps the most recently modified file for each of the given
+	// number of days, counting back from today.
+	KeepDaily int
+
+	// TTL keeps files modified within the given duration.
+	TTL time.Duration
+}
+
+func (r Rule) match(name string) bool {
+	if r.Pattern == "" {
+		return true
+	}
+
+	target := name
+
+	if !strings.Contains(r.Pattern, "/") {
+		target = path.Base(name)
+	}
+
+	ok, _ := path.Match(r.Pattern, target)
+	return ok
+}
+
+func (r Rule) String() string {
+	parts := make([]string, 0, 3)
+
+	if r.KeepLast > 0 {
+		parts = append(parts, "keep last "+strconv.Itoa(r.KeepLast))
+	}
+	if r.KeepDaily > 0 {
+		parts = append(parts, "keep daily "+strconv.Itoa(r.KeepDaily))
+	}
+	if r.TTL > 0 {
+		parts = append(parts, "ttl "+r.TTL.String())
+	}
+
+	pattern := r.Pattern
+
+	if pattern == "" {
+		pattern = "*"
+	}
+	return pattern + ": " + strings.Join(parts, ", ")
+}
+
+// Policy is a set of retention rules.
+type Policy struct {
+	Rules []Rule
+
+	// Now returns the current time. Defaults to time.Now.
+	Now func() time.Time
+}
+
+// Decision is the decision made for a single file.
+type Decision struct {
+	Name    string
+	Size    int64
+	ModTime time.Time
+	Keep    bool
+
+	// Reason is why the file is kept or removed.
+	Reason string
+}
+
+// Report is the outcome of applying a policy.
+type Report struct {
+	// Kept and Removed are sorted by modification time, newest first.
+	Kept    []Decision
+	Removed []Decision
+
+	// Bytes is the total size of the removed files.
+	Bytes int64
+}
+
+// String formats the report with a line for each file, followed by a
+// summary.
+func (r *Report) String() string {
+	var buf strings.Builder
+
+	for _, d := range r.Removed {
+		fmt.Fprintf(&buf, "remove %s (%s)\n", d.Name, d.Reason)
+	}
+	for _, d := range r.Kept {
+		fmt.Fprintf(&buf, "keep   %s (%s)\n", d.Name, d.Reason)
+	}
+
+	fmt.Fprintf(&buf, "%d kept, %d removed, %s freed\n", len(r.Kept), len(r.Removed), fs.HumanSize(r.Bytes))
+	return buf.String()
+}
+
+type file struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+// keep returns the reason the given rule keeps each of the given files, which
+// must be sorted newest first.
+func keep(r Rule, files []file, now time.Time) map[string]string {
+	kept := make(map[string]string)
+
+	for i, f := range files {
+		if i < r.KeepLast {
+			kept[f.name] = "keep last " + strconv.Itoa(r.KeepLast)
+			continue
+		}
+
+		if r.TTL > 0 && now.Sub(f.modTime) < r.TTL {
+			kept[f.name] = "within ttl " + r.TTL.String()
+		}
+	}
+
+	if r.KeepDaily > 0 {
+		y, m, d := now.Date()
+		oldest := time.Date(y, m, d-(r.KeepDaily-1), 0, 0, 0, 0, now.Location())
+
+		days := make(map[string]struct{})
+
+		for _, f := range files {
+			modTime := f.modTime.In(now.Location())
+
+			if modTime.Before(oldest) {
+				break
+			}
+
+			day := modTime.Format("2006-01-02")
+
+			if _, ok := days[day]; ok {
+				continue
+			}
+
+			days[day] = struct{}{}
+
+			if _, ok := kept[f.name]; !ok {
+				kept[f.name] = "keep daily " + strconv.Itoa(r.KeepDaily)
+			}
+		}
+	}
+	return kept
+}
+
+// Plan decides which files in the given FS to keep and remove under the
+// policy, without removing anything. The FS must implement fs.ReadDirFS.
+func Plan(s fs.FS, p Policy) (*Report, error) {
+	for i, r := range p.Rules {
+		if r.KeepLast <= 0 && r.KeepDaily <= 0 && r.TTL <= 0 {
+			return nil, fmt.Errorf("retention: rule %d keeps nothing", i)
+		}
+
+		if _, err := path.Match(r.Pattern, ""); err != nil {
+			return nil, fmt.Errorf("retention: rule %d: %w", i, err)
+		}
+	}
+
+	now := time.Now
+
+	if p.Now != nil {
+		now = p.Now
+	}
+
+	files := make([]file, 0)
+
+	err := fs.Walk(s, ".", func(name string, ent fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if ent.IsDir() {
+			return nil
+		}
+
+		info, err := ent.Info()
+
+		if err != nil {
+			return err
+		}
+
+		files = append(files, file{
+			name:    name,
+			size:    info.Size(),
+			modTime: info.ModTime(),
+		})
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].modTime.After(files[j].modTime)
+	})
+
+	t := now()
+
+	matched := make(map[string]string)
+	kept := make(map[string]string)
+
+	for _, r := range p.Rules {
+		candidates := make([]file, 0)
+
+		for _, f := range files {
+			if r.match(f.name) {
+				candidates = append(candidates, f)
+
+				if _, ok := matched[f.name]; !ok {
+					matched[f.name] = "not kept by " + r.String()
+				}
+			}
+		}
+
+		for name, reason := range keep(r, candidates, t) {
+			if _, ok := kept[name]; !ok {
+				kept[name] = reason
+			}
+		}
+	}
+
+	var r Report
+
+	for _, f := range files {
+		reason, ok := matched[f.name]
+
+		if !ok {
+			continue
+		}
+
+		d := Decision{
+			Name:    f.name,
+			Size:    f.size,
+			ModTime: f.modTime,
+			Reason:  reason,
+		}
+
+		if reason, ok := kept[f.name]; ok {
+			d.Keep = true
+			d.Reason = reason
+
+			r.Kept = append(r.Kept, d)
+			continue
+		}
+
+		r.Removed = append(r.Removed, d)
+		r.Bytes += f.size
+	}
+	return &r, nil
+}
+
+// Apply removes the files from the given FS that are not kept under the
+// policy, and returns the report of what was removed. Removal continues past
+// errors, the first of which is returned.
+func Apply(s fs.FS, p Policy) (*Report, error) {
+	r, err := Plan(s, p)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var first error
+
+	for _, d := range r.Removed {
+		if err := s.Remove(d.Name); err != nil && !errors.Is(err, fs.ErrNotExist) && first == nil {
+			first = err
+		}
+	}
+	return r, first
+}
@@ -0,0 +1,127 @@
+package retention
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andrewpillar/fs"
+)
+
+func tmpdir(t *testing.T) string {
+	dir, err := os.MkdirTemp("", t.Name())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func writeFile(t *testing.T, name string, modTime time.Time) {
+	if err := os.MkdirAll(filepath.Dir(name), 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(name, []byte(name), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(name, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func names(ds []Decision) string {
+	parts := make([]string, 0, len(ds))
+
+	for _, d := range ds {
+		parts = append(parts, d.Name)
+	}
+	return strings.Join(parts, ",")
+}
+
+func Test_Apply(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	now := time.Date(2023, 6, 10, 12, 0, 0, 0, time.UTC)
+
+	// Two backups a day for five days.
+	for i := 0; i < 10; i++ {
+		modTime := now.Add(-time.Duration(i) * 12 * time.Hour)
+		writeFile(t, filepath.Join(dir, "backups", "backup-"+modTime.Format("0102-15")+".tar"), modTime)
+	}
+
+	writeFile(t, filepath.Join(dir, "logs", "old.log"), now.Add(-48*time.Hour))
+	writeFile(t, filepath.Join(dir, "logs", "new.log"), now.Add(-time.Hour))
+	writeFile(t, filepath.Join(dir, "readme"), now.Add(-1000*time.Hour))
+
+	store := fs.New(dir)
+
+	p := Policy{
+		Rules: []Rule{
+			{Pattern: "backups/*", KeepLast: 1, KeepDaily: 3},
+			{Pattern: "*.log", TTL: 24 * time.Hour},
+		},
+		Now: func() time.Time { return now },
+	}
+
+	report, err := Plan(store, p)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "backups/backup-0610-12.tar,logs/new.log,backups/backup-0609-12.tar,backups/backup-0608-12.tar"
+
+	if kept := names(report.Kept); kept != expected {
+		t.Fatalf("unexpected kept files, expected=%q, got=%q\n", expected, kept)
+	}
+
+	if n := len(report.Removed); n != 8 {
+		t.Fatalf("unexpected removed files, expected=%d, got=%d\n%s\n", 8, n, report)
+	}
+
+	// Planning is a dry run, so nothing should have been removed yet.
+	if _, err := os.Stat(filepath.Join(dir, "logs", "old.log")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Apply(store, p); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "logs", "old.log")); !os.IsNotExist(err) {
+		t.Fatalf("expected old.log to be removed, got=%v\n", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "readme")); err != nil {
+		t.Fatal(err)
+	}
+
+	ents, err := os.ReadDir(filepath.Join(dir, "backups"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ents) != 3 {
+		t.Fatalf("unexpected backups, expected=%d, got=%d\n", 3, len(ents))
+	}
+}
+
+func Test_PlanInvalidRule(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	tests := []Rule{
+		{Pattern: "*"},
+		{Pattern: "[", KeepLast: 1},
+	}
+
+	for i, rule := range tests {
+		if _, err := Plan(fs.New(dir), Policy{Rules: []Rule{rule}}); err == nil {
+			t.Fatalf("tests[%d] - expected error, got nil\n", i)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package fs
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RotatePolicy configures when the files written by a rotating writer are
+// rotated.
+type RotatePolicy struct {
+	// MaxBytes is the number of bytes a file may hold before it is rotated.
+	// This is the number of bytes written, before any compression. A file
+	// may exceed this by the size of a single write.
+	MaxBytes int64
+
+	// MaxAge is how long a file may be written to before it is rotated.
+	MaxAge time.Duration
+
+	// Gzip compresses each file, and adds the .gz extension to its name.
+	Gzip bool
+}
+
+// rotateLayout is the layout of the time in the names of rotated files.
+const rotateLayout = "20060102T150405Z"
+
+type rotatingWriter struct {
+	fs     FS
+	name   string
+	policy RotatePolicy
+
+	mu      sync.Mutex
+	tmp     *os.File
+	gz      *gzip.Writer
+	w       io.Writer
+	n       int64
+	started time.Time
+	timer   *time.Timer
+	last    string // The name of the last file started, and how many times it was.
+	dups    int
+	err     error // The last error from a rotation in the background.
+	closed  bool
+}
+
+// NewRotatingWriter returns a writer that writes to a file that is put into
+// the given filesystem once it is rotated, as set by the given policy. Each
+// file is named after the given name with the time it was started inserted
+// before its extension, for example the name logs/app.log would produce files
+// such as logs/app-20060102T150405Z.log, with a numeric suffix for files
+// started within the same second. The data is written to a temporary
+// file on disk until it is rotated.
+//
+// Files are rotated in the background once they reach their MaxAge, so a file
+// is put even if nothing more is written. An error from a rotation in the
+// background is returned from the next call to Write or Close. The remaining
+// data is put when the writer is closed.
+//
+// The writer is safe for concurrent use, so can be used as the sink of a
+// logger.
+func NewRotatingWriter(s FS, name string, policy RotatePolicy) io.WriteCloser {
+	return &rotatingWriter{
+		fs:     s,
+		name:   name,
+		policy: policy,
+	}
+}
+
+// open starts a new file. This should be called with the mutex held.
+func (w *rotatingWriter) open() error {
+	tmp, err := os.CreateTemp("", "rotate-*")
+
+	if err != nil {
+		return err
+	}
+
+	w.tmp = tmp
+	w.w = tmp
+	w.gz = nil
+	w.n = 0
+	w.started = time.Now()
+
+	if name := w.started.UTC().Format(rotateLayout); name == w.last {
+		w.dups++
+	} else {
+		w.last = name
+		w.dups = 0
+	}
+
+	if w.policy.Gzip {
+		w.gz = gzip.NewWriter(tmp)
+		w.w = w.gz
+	}
+
+	if w.policy.MaxAge > 0 {
+		w.timer = time.AfterFunc(w.policy.MaxAge, w.expire)
+	}
+	return nil
+}
+
+// expire rotates the file once it reaches its MaxAge.
+func (w *rotatingWriter) expire() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed || w.tmp == nil || time.Since(w.started) < w.policy.MaxAge {
+		return
+	}
+
+	if err := w.rotate(); err != nil {
+		w.err = err
+	}
+}
+
+// rotatedName returns the name the current file is put under. Files started
+// within the same second have a numeric suffix.
+func (w *rotatingWriter) rotatedName() string {
+	ext := path.Ext(w.name)
+	name := strings.TrimSuffix(w.name, ext) + "-" + w.last
+
+	if w.dups > 0 {
+		name += "-" + strconv.Itoa(w.dups)
+	}
+	name += ext
+
+	if w.policy.Gzip {
+		name += ".gz"
+	}
+	return name
+}
+
+// rotate puts the current file into the filesystem. This should be called
+// with the mutex held.
+func (w *rotatingWriter) rotate() error {
+	if w.tmp == nil {
+		return nil
+	}
+
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+
+	tmp := w.tmp
+	w.tmp = nil
+
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if w.gz != nil {
+		if err := w.gz.Close(); err != nil {
+			return &PathError{Op: "rotate", Path: w.name, Err: err}
+		}
+	}
+
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return &PathError{Op: "rotate", Path: w.name, Err: err}
+	}
+
+	name := w.rotatedName()
+
+	stored, err := PutPath(w.fs, name, Rename(tmp, path.Base(name)))
+
+	if err != nil {
+		return err
+	}
+	return stored.Close()
+}
+
+func (w *rotatingWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return 0, &PathError{Op: "write", Path: w.name, Err: ErrClosed}
+	}
+
+	if err := w.err; err != nil {
+		w.err = nil
+		return 0, err
+	}
+
+	if w.tmp == nil {
+		if err := w.open(); err != nil {
+			return 0, &PathError{Op: "write", Path: w.name, Err: err}
+		}
+	}
+
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+
+	if err != nil {
+		return n, &PathError{Op: "write", Path: w.name, Err: err}
+	}
+
+	if w.policy.MaxBytes > 0 && w.n >= w.policy.MaxBytes {
+		if err := w.rotate(); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// Close puts the current file into the filesystem, and returns any error from
+// a rotation in the background.
+func (w *rotatingWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return &PathError{Op: "close", Path: w.name, Err: ErrClosed}
+	}
+
+	w.closed = true
+
+	if err := w.rotate(); err != nil {
+		return err
+	}
+	return w.err
+}
@@ -0,0 +1,112 @@
+package fs
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_RotatingWriter(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	w := NewRotatingWriter(New(dir), "logs/app.log", RotatePolicy{
+		MaxBytes: 10,
+		Gzip:     true,
+	})
+
+	lines := []string{"first line\n", "second line\n", "third\n"}
+
+	for _, line := range lines {
+		if _, err := io.WriteString(w, line); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := w.Write([]byte("closed")); err == nil {
+		t.Fatalf("expected error writing to closed writer\n")
+	}
+
+	matches, err := filepath.Glob(filepath.Join(dir, "logs", "app-*.log.gz"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(matches) != len(lines) {
+		t.Fatalf("unexpected files, expected=%d, got=%d\n", len(lines), len(matches))
+	}
+
+	contents := make([]string, 0, len(matches))
+
+	for _, name := range matches {
+		f, err := os.Open(name)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		zr, err := gzip.NewReader(f)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := io.ReadAll(zr)
+		f.Close()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		contents = append(contents, string(b))
+	}
+
+	// Files started within the same second do not sort in the order they
+	// were written, so only their contents are compared.
+	sort.Strings(contents)
+	sort.Strings(lines)
+
+	for i, content := range contents {
+		if content != lines[i] {
+			t.Fatalf("contents[%d] - unexpected content, expected=%q, got=%q\n", i, lines[i], content)
+		}
+	}
+}
+
+func Test_RotatingWriterMaxAge(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	w := NewRotatingWriter(New(dir), "app.log", RotatePolicy{
+		MaxAge: 50 * time.Millisecond,
+	})
+
+	defer w.Close()
+
+	if _, err := io.WriteString(w, "idle\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The file should be put without any further writes.
+	time.Sleep(200 * time.Millisecond)
+
+	ents, err := os.ReadDir(dir)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ents) != 1 || !strings.HasPrefix(ents[0].Name(), "app-") {
+		t.Fatalf("unexpected entries, expected=%d, got=%d\n", 1, len(ents))
+	}
+}
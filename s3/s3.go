@@ -0,0 +1,527 @@
+// Package s3 implements a minimal subset of the Amazon S3 API on top of an FS,
+// so tools that only speak S3 can read and write files in any FS.
+//
+// Buckets are the top level directories of the FS, and objects are the files
+// beneath them, with the key of an object being its path within the bucket.
+// Only path style requests are supported, for example,
+//
+//	GET /bucket/path/to/key
+//
+// The following operations are supported: CreateBucket, HeadBucket,
+// ListObjectsV2, PutObject, GetObject, HeadObject, and DeleteObject. Request
+// signatures are not verified, so the handler should only be exposed behind
+// something that authenticates requests.
+package s3
+
+import (
+	"bufio"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/andrewpillar/fs"
+)
+
+const (
+	xmlns = "http://s3.amazonaws.com/doc/2006-03-01/"
+
+	timeLayout = "2006-01-02T15:04:05.000Z"
+
+	defaultMaxKeys = 1000
+)
+
+// Error is an error returned in the response to an S3 request.
+type Error struct {
+	XMLName  xml.Name `xml:"Error"`
+	Status   int      `xml:"-"`
+	Code     string   `xml:"Code"`
+	Message  string   `xml:"Message"`
+	Resource string   `xml:"Resource"`
+}
+
+func (e *Error) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+func newError(status int, code, msg string) *Error {
+	return &Error{
+		Status:  status,
+		Code:    code,
+		Message: msg,
+	}
+}
+
+// toError returns the S3 error for the given error from the FS.
+func toError(err error, notExist string) *Error {
+	var serr *Error
+
+	switch {
+	case errors.As(err, &serr):
+		return serr
+	case errors.Is(err, fs.ErrNotExist):
+		return newError(http.StatusNotFound, notExist, err.Error())
+	case errors.Is(err, fs.ErrPermission):
+		return newError(http.StatusForbidden, "AccessDenied", err.Error())
+	case errors.Is(err, fs.SizeError{}):
+		return newError(http.StatusBadRequest, "EntityTooLarge", err.Error())
+	case errors.Is(err, fs.ErrInvalid):
+		return newError(http.StatusBadRequest, "InvalidArgument", err.Error())
+	}
+	return newError(http.StatusInternalServerError, "InternalError", err.Error())
+}
+
+// Handler serves S3 requests from an FS.
+type Handler struct {
+	fs fs.FS
+}
+
+var _ http.Handler = (*Handler)(nil)
+
+// New returns a Handler that serves the buckets in the given FS.
+func New(s fs.FS) *Handler {
+	return &Handler{
+		fs: s,
+	}
+}
+
+func writeXML(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+
+	io.WriteString(w, xml.Header)
+	xml.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, err *Error) {
+	err.Resource = r.URL.Path
+
+	if r.Method == http.MethodHead {
+		w.WriteHeader(err.Status)
+		return
+	}
+	writeXML(w, err.Status, err)
+}
+
+// validKey reports whether the given key can be used as the path of a file.
+func validKey(key string) bool {
+	return key != "" && key != "." && fs.ValidPath(key)
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+
+	if bucket == "" {
+		writeError(w, r, newError(http.StatusNotImplemented, "NotImplemented", "listing buckets is not supported"))
+		return
+	}
+
+	if !validKey(bucket) || strings.Contains(bucket, "/") {
+		writeError(w, r, newError(http.StatusBadRequest, "InvalidBucketName", "invalid bucket name"))
+		return
+	}
+
+	if key == "" {
+		h.serveBucket(w, r, bucket)
+		return
+	}
+
+	if !validKey(key) {
+		writeError(w, r, newError(http.StatusBadRequest, "InvalidArgument", "invalid key"))
+		return
+	}
+
+	b, err := h.bucket(bucket)
+
+	if err != nil {
+		writeError(w, r, toError(err, "NoSuchBucket"))
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		err = h.getObject(w, r, b, key)
+	case http.MethodPut:
+		err = h.putObject(w, r, b, key)
+	case http.MethodDelete:
+		err = h.deleteObject(w, b, key)
+	default:
+		err = newError(http.StatusMethodNotAllowed, "MethodNotAllowed", "method not allowed")
+	}
+
+	if err != nil {
+		writeError(w, r, toError(err, "NoSuchKey"))
+	}
+}
+
+// bucket returns the FS for the named bucket, if it exists.
+func (h *Handler) bucket(name string) (fs.FS, error) {
+	info, err := h.fs.Stat(name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.IsDir() {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	return h.fs.Sub(name)
+}
+
+func (h *Handler) serveBucket(w http.ResponseWriter, r *http.Request, name string) {
+	if r.Method == http.MethodPut {
+		if _, err := h.fs.Sub(name); err != nil {
+			writeError(w, r, toError(err, "NoSuchBucket"))
+			return
+		}
+		w.Header().Set("Location", "/"+name)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	b, err := h.bucket(name)
+
+	if err != nil {
+		writeError(w, r, toError(err, "NoSuchBucket"))
+		return
+	}
+
+	switch r.Method {
+	case http.MethodHead:
+		w.WriteHeader(http.StatusOK)
+	case http.MethodGet:
+		if r.URL.Query().Get("list-type") != "2" {
+			writeError(w, r, newError(http.StatusNotImplemented, "NotImplemented", "only ListObjectsV2 is supported"))
+			return
+		}
+
+		if err := h.listObjects(w, r, b, name); err != nil {
+			writeError(w, r, toError(err, "NoSuchBucket"))
+		}
+	default:
+		writeError(w, r, newError(http.StatusMethodNotAllowed, "MethodNotAllowed", "method not allowed"))
+	}
+}
+
+func (h *Handler) getObject(w http.ResponseWriter, r *http.Request, b fs.FS, key string) error {
+	f, err := b.Open(key)
+
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	info, err := f.Stat()
+
+	if err != nil {
+		return err
+	}
+
+	if info.IsDir() {
+		return &fs.PathError{Op: "open", Path: key, Err: fs.ErrNotExist}
+	}
+
+	if md, err := fs.GetMetadata(b, key); err == nil {
+		if typ := md[fs.MetadataContentType]; typ != "" {
+			w.Header().Set("Content-Type", typ)
+		}
+	}
+
+	if rs, ok := f.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, key, info.ModTime(), rs)
+		return nil
+	}
+
+	w.Header().Set("Content-Length", strconv.FormatInt(info.Size(), 10))
+	w.Header().Set("Last-Modified", info.ModTime().UTC().Format(http.TimeFormat))
+	w.WriteHeader(http.StatusOK)
+
+	if r.Method != http.MethodHead {
+		io.Copy(w, f)
+	}
+	return nil
+}
+
+func (h *Handler) putObject(w http.ResponseWriter, r *http.Request, b fs.FS, key string) error {
+	dir, name := path.Split(key)
+
+	if dir != "" {
+		sub, err := b.Sub(path.Clean(dir))
+
+		if err != nil {
+			return err
+		}
+		b = sub
+	}
+
+	var body io.Reader = r.Body
+
+	if strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		body = newChunkedReader(r.Body)
+	}
+
+	h5 := md5.New()
+
+	f, err := fs.ReadFile(name, io.TeeReader(body, h5))
+
+	if err != nil {
+		return newError(http.StatusBadRequest, "IncompleteBody", err.Error())
+	}
+
+	defer fs.Cleanup(f)
+
+	sum := h5.Sum(nil)
+
+	if want := r.Header.Get("Content-Md5"); want != "" && want != base64.StdEncoding.EncodeToString(sum) {
+		return newError(http.StatusBadRequest, "BadDigest", "the Content-MD5 does not match the content")
+	}
+
+	stored, err := b.Put(f)
+
+	if err != nil {
+		return err
+	}
+	stored.Close()
+
+	if typ := r.Header.Get("Content-Type"); typ != "" {
+		err := fs.SetMetadata(b, name, fs.Metadata{fs.MetadataContentType: typ})
+
+		if err != nil && !errors.Is(err, fs.ErrUnsupported) {
+			return err
+		}
+	}
+
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum)+`"`)
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+func (h *Handler) deleteObject(w http.ResponseWriter, b fs.FS, key string) error {
+	if err := b.Remove(key); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+type object struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified"`
+	Size         int64  `xml:"Size"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+type commonPrefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+type listBucketResult struct {
+	XMLName               xml.Name       `xml:"ListBucketResult"`
+	Xmlns                 string         `xml:"xmlns,attr"`
+	Name                  string         `xml:"Name"`
+	Prefix                string         `xml:"Prefix"`
+	Delimiter             string         `xml:"Delimiter,omitempty"`
+	StartAfter            string         `xml:"StartAfter,omitempty"`
+	ContinuationToken     string         `xml:"ContinuationToken,omitempty"`
+	NextContinuationToken string         `xml:"NextContinuationToken,omitempty"`
+	KeyCount              int            `xml:"KeyCount"`
+	MaxKeys               int            `xml:"MaxKeys"`
+	IsTruncated           bool           `xml:"IsTruncated"`
+	Contents              []object       `xml:"Contents"`
+	CommonPrefixes        []commonPrefix `xml:"CommonPrefixes"`
+}
+
+// listObjects lists the objects in the bucket. The whole bucket is walked and
+// sorted, since the order files are walked in does not match the order of
+// keys in S3.
+func (h *Handler) listObjects(w http.ResponseWriter, r *http.Request, b fs.FS, name string) error {
+	q := r.URL.Query()
+
+	res := listBucketResult{
+		Xmlns:             xmlns,
+		Name:              name,
+		Prefix:            q.Get("prefix"),
+		Delimiter:         q.Get("delimiter"),
+		StartAfter:        q.Get("start-after"),
+		ContinuationToken: q.Get("continuation-token"),
+		MaxKeys:           defaultMaxKeys,
+	}
+
+	if s := q.Get("max-keys"); s != "" {
+		n, err := strconv.Atoi(s)
+
+		if err != nil || n < 0 {
+			return newError(http.StatusBadRequest, "InvalidArgument", "invalid max-keys")
+		}
+
+		if n < res.MaxKeys {
+			res.MaxKeys = n
+		}
+	}
+
+	after := res.StartAfter
+
+	if res.ContinuationToken != "" {
+		b, err := base64.RawURLEncoding.DecodeString(res.ContinuationToken)
+
+		if err != nil {
+			return newError(http.StatusBadRequest, "InvalidArgument", "invalid continuation-token")
+		}
+		after = string(b)
+	}
+
+	infos := make(map[string]fs.FileInfo)
+	keys := make([]string, 0)
+
+	err := fs.Walk(b, ".", func(p string, ent fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if ent.IsDir() {
+			return nil
+		}
+
+		if !strings.HasPrefix(p, res.Prefix) || p <= after {
+			return nil
+		}
+
+		info, err := ent.Info()
+
+		if err != nil {
+			return err
+		}
+
+		infos[p] = info
+		keys = append(keys, p)
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	sort.Strings(keys)
+
+	var last string
+
+	for _, key := range keys {
+		if res.Delimiter != "" {
+			rest := key[len(res.Prefix):]
+
+			if i := strings.Index(rest, res.Delimiter); i >= 0 {
+				prefix := res.Prefix + rest[:i+len(res.Delimiter)]
+
+				// Skip the keys of a common prefix that has already been
+				// listed, either in this page or the last.
+				if prefix == last || prefix == after {
+					continue
+				}
+
+				if res.KeyCount == res.MaxKeys {
+					res.IsTruncated = true
+					break
+				}
+
+				res.CommonPrefixes = append(res.CommonPrefixes, commonPrefix{Prefix: prefix})
+				res.KeyCount++
+				last = prefix
+				continue
+			}
+		}
+
+		if res.KeyCount == res.MaxKeys {
+			res.IsTruncated = true
+			break
+		}
+
+		info := infos[key]
+
+		res.Contents = append(res.Contents, object{
+			Key:          key,
+			LastModified: info.ModTime().UTC().Format(timeLayout),
+			Size:         info.Size(),
+			StorageClass: "STANDARD",
+		})
+		res.KeyCount++
+		last = key
+	}
+
+	if res.IsTruncated {
+		res.NextContinuationToken = base64.RawURLEncoding.EncodeToString([]byte(last))
+	}
+
+	writeXML(w, http.StatusOK, res)
+	return nil
+}
+
+// chunkedReader decodes the body of a request sent with aws-chunked encoding,
+// as used by clients that sign streaming uploads. The chunk signatures are not
+// verified.
+type chunkedReader struct {
+	r   *bufio.Reader
+	n   int64
+	eof bool
+}
+
+func newChunkedReader(r io.Reader) *chunkedReader {
+	return &chunkedReader{
+		r: bufio.NewReader(r),
+	}
+}
+
+func (c *chunkedReader) Read(p []byte) (int, error) {
+	if c.eof {
+		return 0, io.EOF
+	}
+
+	if c.n == 0 {
+		line, err := c.r.ReadString('\n')
+
+		if err != nil {
+			return 0, io.ErrUnexpectedEOF
+		}
+
+		size, _, _ := strings.Cut(strings.TrimSpace(line), ";")
+
+		n, err := strconv.ParseInt(size, 16, 64)
+
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid chunk size %q", size)
+		}
+
+		if n == 0 {
+			c.eof = true
+			return 0, io.EOF
+		}
+		c.n = n
+	}
+
+	if int64(len(p)) > c.n {
+		p = p[:c.n]
+	}
+
+	n, err := c.r.Read(p)
+	c.n -= int64(n)
+
+	if c.n == 0 {
+		// Consume the CRLF that terminates the chunk data.
+		if _, err := c.r.Discard(2); err != nil {
+			return n, io.ErrUnexpectedEOF
+		}
+	}
+
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
@@ -0,0 +1,210 @@
+package s3
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/andrewpillar/fs"
+)
+
+func tmpdir(t *testing.T) string {
+	dir, err := os.MkdirTemp("", t.Name())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func do(t *testing.T, h http.Handler, method, target, body string, hdr map[string]string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+
+	for k, v := range hdr {
+		r.Header.Set(k, v)
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	return w
+}
+
+func Test_Objects(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	h := New(fs.New(dir))
+
+	if w := do(t, h, "PUT", "/bucket/a/b.txt", "", nil); w.Code != http.StatusNotFound {
+		t.Fatalf("unexpected status, expected=%d, got=%d\n", http.StatusNotFound, w.Code)
+	}
+
+	if w := do(t, h, "PUT", "/bucket", "", nil); w.Code != http.StatusOK {
+		t.Fatalf("unexpected status, expected=%d, got=%d\n", http.StatusOK, w.Code)
+	}
+
+	w := do(t, h, "PUT", "/bucket/a/b.txt", "hello", nil)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status, expected=%d, got=%d\n%s\n", http.StatusOK, w.Code, w.Body)
+	}
+
+	if etag := w.Header().Get("ETag"); etag != `"5d41402abc4b2a76b9719d911017c592"` {
+		t.Fatalf("unexpected etag, got=%q\n", etag)
+	}
+
+	w = do(t, h, "GET", "/bucket/a/b.txt", "", nil)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status, expected=%d, got=%d\n", http.StatusOK, w.Code)
+	}
+
+	if body := w.Body.String(); body != "hello" {
+		t.Fatalf("unexpected body, expected=%q, got=%q\n", "hello", body)
+	}
+
+	w = do(t, h, "HEAD", "/bucket/a/b.txt", "", nil)
+
+	if cl := w.Header().Get("Content-Length"); cl != "5" {
+		t.Fatalf("unexpected content length, expected=%q, got=%q\n", "5", cl)
+	}
+
+	w = do(t, h, "GET", "/bucket/missing", "", nil)
+
+	if w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), "<Code>NoSuchKey</Code>") {
+		t.Fatalf("unexpected response %d %s\n", w.Code, w.Body)
+	}
+
+	if w := do(t, h, "GET", "/bucket/../etc/passwd", "", nil); w.Code != http.StatusBadRequest {
+		t.Fatalf("unexpected status, expected=%d, got=%d\n", http.StatusBadRequest, w.Code)
+	}
+
+	if w := do(t, h, "DELETE", "/bucket/a/b.txt", "", nil); w.Code != http.StatusNoContent {
+		t.Fatalf("unexpected status, expected=%d, got=%d\n", http.StatusNoContent, w.Code)
+	}
+
+	if w := do(t, h, "GET", "/bucket/a/b.txt", "", nil); w.Code != http.StatusNotFound {
+		t.Fatalf("unexpected status, expected=%d, got=%d\n", http.StatusNotFound, w.Code)
+	}
+}
+
+func Test_PutChunked(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	h := New(fs.New(dir))
+
+	do(t, h, "PUT", "/bucket", "", nil)
+
+	body := "5;chunk-signature=abc\r\nhello\r\n6;chunk-signature=def\r\n world\r\n0;chunk-signature=ghi\r\n\r\n"
+
+	w := do(t, h, "PUT", "/bucket/file", body, map[string]string{
+		"X-Amz-Content-Sha256": "STREAMING-AWS4-HMAC-SHA256-PAYLOAD",
+	})
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status, expected=%d, got=%d\n%s\n", http.StatusOK, w.Code, w.Body)
+	}
+
+	b, err := os.ReadFile(dir + "/bucket/file")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(b) != "hello world" {
+		t.Fatalf("unexpected content, expected=%q, got=%q\n", "hello world", string(b))
+	}
+}
+
+func Test_ListObjectsV2(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	h := New(fs.New(dir))
+
+	do(t, h, "PUT", "/bucket", "", nil)
+
+	for _, key := range []string{"a-b", "a/1", "a/2", "b", "c/d/e"} {
+		if w := do(t, h, "PUT", "/bucket/"+key, key, nil); w.Code != http.StatusOK {
+			t.Fatalf("unexpected status, expected=%d, got=%d\n", http.StatusOK, w.Code)
+		}
+	}
+
+	list := func(query string) listBucketResult {
+		w := do(t, h, "GET", "/bucket?list-type=2"+query, "", nil)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("unexpected status, expected=%d, got=%d\n%s\n", http.StatusOK, w.Code, w.Body)
+		}
+
+		b, _ := io.ReadAll(w.Body)
+
+		var res listBucketResult
+
+		if err := xml.Unmarshal(b, &res); err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	keys := func(res listBucketResult) string {
+		parts := make([]string, 0)
+
+		for _, o := range res.Contents {
+			parts = append(parts, o.Key)
+		}
+		for _, p := range res.CommonPrefixes {
+			parts = append(parts, p.Prefix)
+		}
+		return strings.Join(parts, ",")
+	}
+
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		{"", "a-b,a/1,a/2,b,c/d/e"},
+		{"&prefix=a/", "a/1,a/2"},
+		{"&delimiter=/", "a-b,b,a/,c/"},
+		{"&prefix=c/&delimiter=/", "c/d/"},
+		{"&start-after=a/1", "a/2,b,c/d/e"},
+	}
+
+	for i, test := range tests {
+		if got := keys(list(test.query)); got != test.expected {
+			t.Fatalf("tests[%d] - unexpected keys, expected=%q, got=%q\n", i, test.expected, got)
+		}
+	}
+
+	// Page through with a delimiter, one key at a time.
+	var (
+		pages []string
+		token string
+	)
+
+	for {
+		query := "&delimiter=/&max-keys=1"
+
+		if token != "" {
+			query += "&continuation-token=" + token
+		}
+
+		res := list(query)
+		pages = append(pages, keys(res))
+
+		if !res.IsTruncated {
+			break
+		}
+		token = res.NextContinuationToken
+	}
+
+	if got := strings.Join(pages, ","); got != "a-b,a/,b,c/" {
+		t.Fatalf("unexpected pages, expected=%q, got=%q\n", "a-b,a/,b,c/", got)
+	}
+}
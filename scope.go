@@ -0,0 +1,130 @@
+package fs
+
+import (
+	"path"
+	"strings"
+)
+
+// SubPolicy reports whether a wrapper applies to the directory at the given
+// path, relative to the root of the filesystem given to Scope. The root itself
+// is ".".
+type SubPolicy func(dir string) bool
+
+// Inherit applies the wrapper to every directory, which is how wrappers behave
+// when not scoped.
+func Inherit(string) bool { return true }
+
+// RootOnly applies the wrapper to the root only, and not to any directory
+// returned from Sub.
+func RootOnly(dir string) bool { return dir == "." }
+
+// Under applies the wrapper to the given directories and everything beneath
+// them.
+func Under(dirs ...string) SubPolicy {
+	return func(dir string) bool {
+		for _, d := range dirs {
+			if within(dir, d) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Except applies the wrapper everywhere except the given directories and
+// everything beneath them.
+func Except(dirs ...string) SubPolicy {
+	under := Under(dirs...)
+
+	return func(dir string) bool {
+		return !under(dir)
+	}
+}
+
+// within reports whether dir is the same as, or beneath, parent.
+func within(dir, parent string) bool {
+	parent = path.Clean(parent)
+
+	if parent == "." {
+		return true
+	}
+	return dir == parent || strings.HasPrefix(dir, parent+"/")
+}
+
+type scoped struct {
+	FS
+
+	base   FS
+	wrap   func(FS) FS
+	policy SubPolicy
+	dir    string
+}
+
+// renameScoped is scoped over a filesystem that implements RenameFS, after
+// the wrapper is applied.
+type renameScoped struct {
+	*scoped
+}
+
+func newScoped(base FS, wrap func(FS) FS, policy SubPolicy, dir string) FS {
+	s := &scoped{
+		FS:     base,
+		base:   base,
+		wrap:   wrap,
+		policy: policy,
+		dir:    dir,
+	}
+
+	if policy(dir) {
+		s.FS = wrap(base)
+	}
+
+	if canRename(s.FS) {
+		return renameScoped{scoped: s}
+	}
+	return s
+}
+
+// Scope returns a filesystem that applies the given wrapper only to the
+// directories allowed by the given policy. Directories returned from Sub are
+// taken from the unwrapped filesystem, and then wrapped if the policy allows,
+// so a wrapper can apply to some subtrees and not others. For example, to only
+// hash the files stored beneath "objects",
+//
+//	store := fs.Scope(fs.New(dir), func(s fs.FS) fs.FS {
+//		return fs.Hash(s, sha256.New)
+//	}, fs.Under("objects"))
+func Scope(s FS, wrap func(FS) FS, policy SubPolicy) FS {
+	return newScoped(s, wrap, policy, ".")
+}
+
+func (s *scoped) Unwrap() FS { return s.FS }
+
+func (s *scoped) Sub(dir string) (FS, error) {
+	sub, err := s.base.Sub(dir)
+
+	if err != nil {
+		return nil, err
+	}
+	return newScoped(sub, s.wrap, s.policy, path.Join(s.dir, dir)), nil
+}
+
+func (s *scoped) ReadDir(name string) ([]DirEntry, error) {
+	return ReadDir(s.FS, name)
+}
+
+func (s renameScoped) Rename(oldname, newname string) error {
+	return Move(s.FS, oldname, newname)
+}
+
+func (s *scoped) Link(oldname, newname string) error {
+	return Link(s.FS, oldname, newname)
+}
+
+func (s *scoped) Metadata(name string) (Metadata, error) {
+	return GetMetadata(s.FS, name)
+}
+
+func (s *scoped) SetMetadata(name string, md Metadata) error {
+	return SetMetadata(s.FS, name, md)
+}
@@ -0,0 +1,86 @@
+package fs
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+)
+
+func Test_Scope(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	limit := func(s FS) FS { return Limit(s, 16) }
+
+	tests := []struct {
+		policy   SubPolicy
+		dirs     []string
+		expected []bool
+	}{
+		{Inherit, []string{".", "a", "a/b"}, []bool{true, true, true}},
+		{RootOnly, []string{".", "a", "a/b"}, []bool{true, false, false}},
+		{Under("a"), []string{".", "a", "a/b", "ab"}, []bool{false, true, true, false}},
+		{Except("a"), []string{".", "a", "a/b", "ab"}, []bool{true, false, false, true}},
+	}
+
+	data := generateData(t, 32)
+
+	for i, test := range tests {
+		root := Scope(New(dir), limit, test.policy)
+
+		for j, d := range test.dirs {
+			store := root
+
+			if d != "." {
+				sub, err := root.Sub(d)
+
+				if err != nil {
+					t.Fatal(err)
+				}
+				store = sub
+			}
+
+			f, err := ReadFile("file", bytes.NewReader(data))
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = store.Put(f)
+
+			if limited := errors.Is(err, SizeError{}); limited != test.expected[j] {
+				t.Fatalf("tests[%d] - unexpected limit for %q, expected=%v, got=%v (%v)\n", i, d, test.expected[j], limited, err)
+			}
+		}
+	}
+}
+
+func Test_ScopeNestedSub(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	root := Scope(New(dir), func(s FS) FS { return Limit(s, 16) }, Under("a/b"))
+
+	a, err := root.Sub("a")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := a.Sub("b")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := ReadFile("file", bytes.NewReader(generateData(t, 32)))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := b.Put(f); !errors.Is(err, SizeError{}) {
+		t.Fatalf("unexpected error, expected=%T, got=%v\n", SizeError{}, err)
+	}
+}
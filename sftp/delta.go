@@ -0,0 +1,137 @@
+package sftp
+
+import (
+	"errors"
+	"io"
+	"os"
+
+	"github.com/andrewpillar/fs"
+)
+
+func (s *FS) BlockSums(name string, blockSize int) ([]fs.BlockSum, error) {
+	f, err := s.cli.Open(s.path(name))
+
+	if err != nil {
+		return nil, &fs.PathError{Op: "blocksums", Path: name, Err: errors.Unwrap(err)}
+	}
+
+	defer f.Close()
+
+	sums, err := fs.ReadBlockSums(f, blockSize)
+
+	if err != nil {
+		return nil, &fs.PathError{Op: "blocksums", Path: name, Err: err}
+	}
+	return sums, nil
+}
+
+// Patch patches the named file in place, so the blocks of the file that have
+// not moved are never sent over the connection. Blocks that have moved are
+// read back from the file before anything is written, and only they and the
+// data that changed are written. This means the patch is not atomic, if it
+// fails part way through the file is left partially patched.
+func (s *FS) Patch(name string, ranges []fs.Range) (fs.File, error) {
+	f, err := s.cli.OpenFile(s.path(name), os.O_RDWR)
+
+	if err != nil {
+		return nil, &fs.PathError{Op: "patch", Path: name, Err: errors.Unwrap(err)}
+	}
+
+	defer f.Close()
+
+	info, err := f.Stat()
+
+	if err != nil {
+		return nil, &fs.PathError{Op: "patch", Path: name, Err: errors.Unwrap(err)}
+	}
+
+	// Blocks that have moved are spooled to a local file, since writing the
+	// patch may overwrite them in the remote file.
+	spool, err := os.CreateTemp("", "fs-sftp-patch-*")
+
+	if err != nil {
+		return nil, &fs.PathError{Op: "patch", Path: name, Err: err}
+	}
+
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+
+	moved := make(map[int]int64)
+
+	var (
+		off     int64
+		spooled int64
+	)
+
+	for i, rng := range ranges {
+		if rng.Data == nil {
+			if rng.Src < 0 || rng.Len < 0 || rng.Src+rng.Len > info.Size() {
+				return nil, &fs.PathError{Op: "patch", Path: name, Err: fs.ErrInvalid}
+			}
+
+			if rng.Src != off {
+				n, err := io.Copy(spool, io.NewSectionReader(f, rng.Src, rng.Len))
+
+				if err == nil && n != rng.Len {
+					err = io.ErrUnexpectedEOF
+				}
+
+				if err != nil {
+					return nil, &fs.PathError{Op: "patch", Path: name, Err: err}
+				}
+
+				moved[i] = spooled
+				spooled += n
+			}
+		}
+		off += rng.Len
+	}
+
+	off = 0
+
+	for i, rng := range ranges {
+		r := rng.Data
+
+		if r == nil {
+			pos, ok := moved[i]
+
+			if !ok {
+				off += rng.Len
+				continue
+			}
+			r = io.NewSectionReader(spool, pos, rng.Len)
+		}
+
+		if _, err := f.Seek(off, io.SeekStart); err != nil {
+			return nil, &fs.PathError{Op: "patch", Path: name, Err: errors.Unwrap(err)}
+		}
+
+		n, err := io.Copy(f, io.LimitReader(r, rng.Len))
+
+		if err == nil && n != rng.Len {
+			err = io.ErrUnexpectedEOF
+		}
+
+		if err != nil {
+			return nil, &fs.PathError{Op: "patch", Path: name, Err: err}
+		}
+		off += rng.Len
+	}
+
+	if off != info.Size() {
+		if err := f.Truncate(off); err != nil {
+			return nil, &fs.PathError{Op: "patch", Path: name, Err: errors.Unwrap(err)}
+		}
+	}
+
+	if s.durable {
+		if err := f.Sync(); err != nil {
+			return nil, &fs.PathError{Op: "patch", Path: name, Err: err}
+		}
+	}
+
+	if err := f.Close(); err != nil {
+		return nil, &fs.PathError{Op: "patch", Path: name, Err: errors.Unwrap(err)}
+	}
+	return s.Open(name)
+}
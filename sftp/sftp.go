@@ -3,6 +3,10 @@ package sftp
 import (
 	"errors"
 	"io"
+	iofs "io/fs"
+	"path"
+	"sort"
+	"sync/atomic"
 
 	"github.com/andrewpillar/fs"
 
@@ -10,18 +14,95 @@ import (
 )
 
 type FS struct {
-	cli *sftp.Client
-	dir string
+	cli         *sftp.Client
+	dir         string
+	concurrency int
+	chown       bool
+	uid         int
+	gid         int
+	durable     bool
+
+	// puts is the number of puts in flight, shared with each Sub.
+	puts *int64
+}
+
+var (
+	_ fs.ReadDirFS = (*FS)(nil)
+	_ fs.RenameFS  = (*FS)(nil)
+	_ fs.LinkFS    = (*FS)(nil)
+	_ fs.DebugFS   = (*FS)(nil)
+	_ fs.DeltaFS   = (*FS)(nil)
+)
+
+// Option configures an FS.
+type Option func(*FS)
+
+// ConcurrentWrites sets the number of concurrent write requests to use when a
+// file is put in the FS. By default files are written sequentially. The
+// concurrency is capped by the maximum number of outstanding requests
+// configured on the client.
+func ConcurrentWrites(n int) Option {
+	return func(s *FS) {
+		if n > 0 {
+			s.concurrency = n
+		}
+	}
+}
+
+// MaxPacket returns the client option that sets the maximum size of the
+// payload of each packet sent by the client. Sizes larger than 32KB may not be
+// supported by all servers. This is given to sftp.NewClient when the client is
+// created, since a client cannot be safely changed once it is in use.
+func MaxPacket(size int) sftp.ClientOption {
+	if size <= 0 {
+		return noClientOption
+	}
+	return sftp.MaxPacketUnchecked(size)
 }
 
-var _ fs.FS = (*FS)(nil)
+// MaxOutstanding returns the client option that sets the maximum number of
+// concurrent requests the client will make for a single file. This is given to
+// sftp.NewClient when the client is created.
+func MaxOutstanding(n int) sftp.ClientOption {
+	if n <= 0 {
+		return noClientOption
+	}
+	return sftp.MaxConcurrentRequestsPerFile(n)
+}
+
+func noClientOption(*sftp.Client) error { return nil }
+
+// Owner sets the user and group ID of the files created via Put and the
+// directories created via Sub. Unlike os.Chown, both IDs must be given.
+func Owner(uid, gid int) Option {
+	return func(s *FS) {
+		s.chown = true
+		s.uid = uid
+		s.gid = gid
+	}
+}
+
+// Durable configures the FS to request that each file put in it is flushed to
+// stable storage before Put returns. This requires the server to support the
+// fsync@openssh.com extension, otherwise Put will fail.
+func Durable() Option {
+	return func(s *FS) {
+		s.durable = true
+	}
+}
 
 // New returns a new FS for storing files over an SFTP connection.
-func New(cli *sftp.Client, dir string) *FS {
-	return &FS{
-		cli: cli,
-		dir: dir,
+func New(cli *sftp.Client, dir string, opts ...Option) *FS {
+	s := &FS{
+		cli:  cli,
+		dir:  dir,
+		puts: new(int64),
+	}
+
+	for _, opt := range opts {
+		opt(s)
 	}
+	return s
 }
 
 func (s *FS) path(name string) string {
@@ -40,10 +121,48 @@ func (s *FS) Open(name string) (fs.File, error) {
 func (s *FS) Sub(dir string) (fs.FS, error) {
 	subdir := s.path(dir)
 
-	if err := s.cli.MkdirAll(subdir); err != nil {
+	if err := s.mkdirAll(subdir); err != nil {
 		return nil, &fs.PathError{Op: "sub", Path: dir, Err: errors.Unwrap(err)}
 	}
-	return New(s.cli, subdir), nil
+	sub := *s
+	sub.dir = subdir
+
+	return &sub, nil
+}
+
+// mkdirAll creates the given directory along with any parents. If an owner is
+// set, then each directory that is created is given that owner.
+func (s *FS) mkdirAll(dir string) error {
+	if !s.chown {
+		return s.cli.MkdirAll(dir)
+	}
+
+	// Find the directories that do not exist yet, so only those are given the
+	// owner.
+	missing := make([]string, 0)
+
+	for p := dir; ; p = path.Dir(p) {
+		if _, err := s.cli.Stat(p); err == nil {
+			break
+		}
+
+		missing = append(missing, p)
+
+		if parent := path.Dir(p); parent == p {
+			break
+		}
+	}
+
+	if err := s.cli.MkdirAll(dir); err != nil {
+		return err
+	}
+
+	for i := len(missing) - 1; i >= 0; i-- {
+		if err := s.cli.Chown(missing[i], s.uid, s.gid); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (s *FS) Stat(name string) (fs.FileInfo, error) {
@@ -64,22 +183,107 @@ func (s *FS) Put(f fs.File) (fs.File, error) {
 
 	name := info.Name()
 
+	atomic.AddInt64(s.puts, 1)
+	defer atomic.AddInt64(s.puts, -1)
+
 	dst, err := s.cli.Create(s.path(name))
 
 	if err != nil {
 		return nil, &fs.PathError{Op: "put", Path: name, Err: errors.Unwrap(err)}
 	}
 
-	if _, err := io.Copy(dst, f); err != nil {
+	if s.chown {
+		if err := dst.Chown(s.uid, s.gid); err != nil {
+			dst.Close()
+			return nil, &fs.PathError{Op: "put", Path: name, Err: errors.Unwrap(err)}
+		}
+	}
+
+	if s.concurrency > 0 {
+		_, err = dst.ReadFromWithConcurrency(f, s.concurrency)
+	} else {
+		_, err = io.Copy(dst, f)
+	}
+
+	if err != nil {
 		return nil, &fs.PathError{Op: "put", Path: name, Err: errors.Unwrap(err)}
 	}
 
+	if s.durable {
+		if err := dst.Sync(); err != nil {
+			return nil, &fs.PathError{Op: "put", Path: name, Err: err}
+		}
+	}
+
 	if _, err := dst.Seek(0, io.SeekStart); err != nil {
 		return nil, &fs.PathError{Op: "put", Path: name, Err: errors.Unwrap(err)}
 	}
 	return dst, nil
 }
 
+// Debug returns the directory of the FS, along with the number of puts in
+// flight and the number of write requests each put may have outstanding.
+func (s *FS) Debug() map[string]any {
+	return map[string]any{
+		"dir":               s.dir,
+		"puts_in_flight":    atomic.LoadInt64(s.puts),
+		"concurrent_writes": s.concurrency,
+	}
+}
+
+func (s *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	infos, err := s.cli.ReadDir(s.path(name))
+
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.Unwrap(err)}
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name() < infos[j].Name()
+	})
+
+	ents := make([]fs.DirEntry, 0, len(infos))
+
+	for _, info := range infos {
+		ents = append(ents, iofs.FileInfoToDirEntry(info))
+	}
+	return ents, nil
+}
+
+// Rename renames the file oldname to newname, replacing newname if it exists.
+// If the server does not support the posix-rename@openssh.com extension then
+// newname is removed before the rename, so the replace is not atomic.
+func (s *FS) Rename(oldname, newname string) error {
+	if _, ok := s.cli.HasExtension("posix-rename@openssh.com"); ok {
+		if err := s.cli.PosixRename(s.path(oldname), s.path(newname)); err != nil {
+			return &fs.PathError{Op: "rename", Path: oldname, Err: errors.Unwrap(err)}
+		}
+		return nil
+	}
+
+	if _, err := s.cli.Lstat(s.path(oldname)); err != nil {
+		return &fs.PathError{Op: "rename", Path: oldname, Err: errors.Unwrap(err)}
+	}
+
+	if err := s.cli.Remove(s.path(newname)); err != nil && !errors.Is(err, iofs.ErrNotExist) {
+		return &fs.PathError{Op: "rename", Path: oldname, Err: errors.Unwrap(err)}
+	}
+
+	if err := s.cli.Rename(s.path(oldname), s.path(newname)); err != nil {
+		return &fs.PathError{Op: "rename", Path: oldname, Err: errors.Unwrap(err)}
+	}
+	return nil
+}
+
+// Link creates newname as a hard link to the file oldname. This requires the
+// server to support the hardlink@openssh.com extension.
+func (s *FS) Link(oldname, newname string) error {
+	if err := s.cli.Link(s.path(oldname), s.path(newname)); err != nil {
+		return &fs.PathError{Op: "link", Path: oldname, Err: errors.Unwrap(err)}
+	}
+	return nil
+}
+
 func (s *FS) Remove(name string) error {
 	if err := s.cli.Remove(s.path(name)); err != nil {
 		return &fs.PathError{Op: "remove", Path: name, Err: errors.Unwrap(err)}
@@ -0,0 +1,456 @@
+package fs
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+)
+
+// shardReplicas is the number of points each filesystem has on the hash ring
+// of a shard, so files are spread evenly between them.
+const shardReplicas = 128
+
+// RebalanceProgress reports the progress of a rebalance.
+type RebalanceProgress struct {
+	// Name is the name of the file last checked.
+	Name string
+
+	// Checked is the number of files checked so far.
+	Checked int
+
+	// Moved is the number of files moved so far.
+	Moved int
+
+	// Bytes is the number of bytes moved so far.
+	Bytes int64
+}
+
+// ShardFS is the interface implemented by a filesystem that spreads files
+// across multiple filesystems.
+type ShardFS interface {
+	FS
+
+	// Rebalance moves every file that is not on the filesystem it hashes to
+	// onto that filesystem. Files are also moved off of the drained
+	// filesystems, which are those that have been removed from the shard.
+	// The progress func, if not nil, is called after each file is checked.
+	Rebalance(progress func(RebalanceProgress), drain ...FS) (RebalanceProgress, error)
+}
+
+// Rebalance rebalances the files in the given filesystem. If the filesystem
+// does not implement ShardFS then ErrUnsupported is returned in the
+// *PathError.
+func Rebalance(s FS, progress func(RebalanceProgress), drain ...FS) (RebalanceProgress, error) {
+	ss, ok := s.(ShardFS)
+
+	if !ok {
+		return RebalanceProgress{}, &PathError{Op: "rebalance", Path: ".", Err: ErrUnsupported}
+	}
+	return ss.Rebalance(progress, drain...)
+}
+
+type ringPoint struct {
+	hash  uint64
+	store string
+}
+
+type shardFS struct {
+	stores map[string]FS
+	names  []string // The names of the filesystems, sorted.
+	ring   []ringPoint
+	dir    string // The directory of the shard, so files hash the same in a Sub.
+}
+
+// Shard returns a filesystem that spreads the files put in it across the
+// given filesystems via consistent hashing of their paths. Each filesystem is
+// identified by its name in the map, so adding or removing a filesystem only
+// changes where the files that hash to it are stored, and the names should not
+// change between runs.
+//
+// When the filesystems change, Rebalance moves the files that are no longer on
+// the filesystem they hash to. Until then, files are looked for on every
+// filesystem when not found where they hash to, though files on a filesystem
+// that was removed cannot be found until it is drained by Rebalance. Every
+// filesystem must implement ReadDirFS for Rebalance.
+func Shard(stores map[string]FS) FS {
+	return newShard(stores, ".")
+}
+
+func newShard(stores map[string]FS, dir string) FS {
+	names := make([]string, 0, len(stores))
+
+	for name := range stores {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	ring := make([]ringPoint, 0, len(names)*shardReplicas)
+
+	for _, name := range names {
+		for i := 0; i < shardReplicas; i++ {
+			ring = append(ring, ringPoint{
+				hash:  ringHash(name + "#" + strconv.Itoa(i)),
+				store: name,
+			})
+		}
+	}
+
+	sort.Slice(ring, func(i, j int) bool {
+		return ring[i].hash < ring[j].hash
+	})
+
+	ss := &shardFS{
+		stores: stores,
+		names:  names,
+		ring:   ring,
+		dir:    dir,
+	}
+
+	if canRenameAll(stores) {
+		return renameShardFS{shardFS: ss}
+	}
+	return ss
+}
+
+// renameShardFS is a shardFS over stores that each implement RenameFS.
+type renameShardFS struct {
+	*shardFS
+}
+
+func ringHash(s string) uint64 {
+	sum := sha256.Sum256([]byte(s))
+	return binary.BigEndian.Uint64(sum[:])
+}
+
+// owner returns the name of the filesystem the named file hashes to.
+func (s *shardFS) owner(name string) (string, error) {
+	if len(s.ring) == 0 {
+		return "", ErrInvalid
+	}
+
+	hash := ringHash(path.Join(s.dir, name))
+
+	i := sort.Search(len(s.ring), func(i int) bool {
+		return s.ring[i].hash >= hash
+	})
+
+	if i == len(s.ring) {
+		i = 0
+	}
+	return s.ring[i].store, nil
+}
+
+// locate returns the name of the filesystem the named file is stored on, which
+// is the one it hashes to unless the shard has not been rebalanced.
+func (s *shardFS) locate(name string) (string, error) {
+	owner, err := s.owner(name)
+
+	if err != nil {
+		return "", err
+	}
+
+	_, err = s.stores[owner].Stat(name)
+
+	if err == nil {
+		return owner, nil
+	}
+
+	if !errors.Is(err, ErrNotExist) {
+		return "", err
+	}
+
+	for _, n := range s.names {
+		if n == owner {
+			continue
+		}
+
+		if _, err := s.stores[n].Stat(name); err == nil {
+			return n, nil
+		}
+	}
+	return "", ErrNotExist
+}
+
+// Unwrap returns each of the filesystems files are spread across, ordered by
+// their name.
+func (s *shardFS) Unwrap() []FS {
+	stores := make([]FS, 0, len(s.names))
+
+	for _, name := range s.names {
+		stores = append(stores, s.stores[name])
+	}
+	return stores
+}
+
+func (s *shardFS) Open(name string) (File, error) {
+	store, err := s.locate(name)
+
+	if err != nil {
+		return nil, &PathError{Op: "open", Path: name, Err: err}
+	}
+	return s.stores[store].Open(name)
+}
+
+func (s *shardFS) Sub(dir string) (FS, error) {
+	stores := make(map[string]FS, len(s.stores))
+
+	for name, store := range s.stores {
+		sub, err := store.Sub(dir)
+
+		if err != nil {
+			return nil, err
+		}
+		stores[name] = sub
+	}
+	return newShard(stores, path.Join(s.dir, dir)), nil
+}
+
+func (s *shardFS) Stat(name string) (FileInfo, error) {
+	store, err := s.locate(name)
+
+	if err != nil {
+		return nil, &PathError{Op: "stat", Path: name, Err: err}
+	}
+	return s.stores[store].Stat(name)
+}
+
+// Put puts the file on the filesystem its name hashes to. If a file of the
+// same name is stored on another filesystem, because the shard has not been
+// rebalanced, then it is removed once the file is put.
+func (s *shardFS) Put(f File) (File, error) {
+	info, err := f.Stat()
+
+	if err != nil {
+		return nil, err
+	}
+
+	name := info.Name()
+
+	owner, err := s.owner(name)
+
+	if err != nil {
+		return nil, &PathError{Op: "put", Path: name, Err: err}
+	}
+
+	stored, err := s.stores[owner].Put(f)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, n := range s.names {
+		if n != owner {
+			if err := s.stores[n].Remove(name); err != nil && !errors.Is(err, ErrNotExist) {
+				stored.Close()
+				return nil, err
+			}
+		}
+	}
+	return stored, nil
+}
+
+// ReadDir merges the listings of the directory on every filesystem. If the
+// directory does not exist on any filesystem then ErrNotExist is returned.
+func (s *shardFS) ReadDir(name string) ([]DirEntry, error) {
+	lists := make([][]DirEntry, 0, len(s.names))
+
+	for _, n := range s.names {
+		ents, err := ReadDir(s.stores[n], name)
+
+		if err != nil {
+			if errors.Is(err, ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		lists = append(lists, ents)
+	}
+
+	if len(lists) == 0 {
+		return nil, &PathError{Op: "readdir", Path: name, Err: ErrNotExist}
+	}
+	return mergeEntries(lists...), nil
+}
+
+// moveFile moves the named file from src to dst, along with its metadata, and
+// returns the number of bytes moved.
+func moveFile(dst, src FS, name string) (int64, error) {
+	f, err := src.Open(name)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer f.Close()
+
+	info, err := f.Stat()
+
+	if err != nil {
+		return 0, err
+	}
+
+	md, err := GetMetadata(src, name)
+
+	if err != nil && !errors.Is(err, ErrUnsupported) {
+		return 0, err
+	}
+
+	stored, err := PutPath(dst, name, f)
+
+	if err != nil {
+		return 0, err
+	}
+	stored.Close()
+
+	if len(md) > 0 {
+		if err := SetMetadata(dst, name, md); err != nil && !errors.Is(err, ErrUnsupported) {
+			return 0, err
+		}
+	}
+
+	if err := src.Remove(name); err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// Rename renames the file, moving it to the filesystem the new name hashes to
+// if that differs from the one it is stored on.
+func (s renameShardFS) Rename(oldname, newname string) error {
+	store, err := s.locate(oldname)
+
+	if err != nil {
+		return &PathError{Op: "rename", Path: oldname, Err: err}
+	}
+
+	owner, err := s.owner(newname)
+
+	if err != nil {
+		return &PathError{Op: "rename", Path: newname, Err: err}
+	}
+
+	for _, n := range s.names {
+		if n != store && n != owner {
+			if err := s.stores[n].Remove(newname); err != nil && !errors.Is(err, ErrNotExist) {
+				return err
+			}
+		}
+	}
+
+	if err := Move(s.stores[store], oldname, newname); err != nil {
+		return err
+	}
+
+	if store == owner {
+		return nil
+	}
+
+	if _, err := moveFile(s.stores[owner], s.stores[store], newname); err != nil {
+		return &PathError{Op: "rename", Path: newname, Err: err}
+	}
+	return nil
+}
+
+func (s *shardFS) Metadata(name string) (Metadata, error) {
+	store, err := s.locate(name)
+
+	if err != nil {
+		return nil, &PathError{Op: "metadata", Path: name, Err: err}
+	}
+	return GetMetadata(s.stores[store], name)
+}
+
+func (s *shardFS) SetMetadata(name string, md Metadata) error {
+	store, err := s.locate(name)
+
+	if err != nil {
+		return &PathError{Op: "setmetadata", Path: name, Err: err}
+	}
+	return SetMetadata(s.stores[store], name, md)
+}
+
+func (s *shardFS) Remove(name string) error {
+	store, err := s.locate(name)
+
+	if err != nil {
+		return &PathError{Op: "remove", Path: name, Err: err}
+	}
+	return s.stores[store].Remove(name)
+}
+
+// Rebalance walks every filesystem, and the drained filesystems, and moves
+// each file that is not on the filesystem it hashes to. A file that exists on
+// the filesystem it hashes to is left where it is, and the misplaced copy is
+// removed.
+func (s *shardFS) Rebalance(progress func(RebalanceProgress), drain ...FS) (RebalanceProgress, error) {
+	var p RebalanceProgress
+
+	for _, n := range s.names {
+		if err := s.rebalance(&p, progress, s.stores[n], n, false); err != nil {
+			return p, err
+		}
+	}
+
+	// The drained filesystems are not in the ring, so every file on them is
+	// moved.
+	for _, store := range drain {
+		if err := s.rebalance(&p, progress, store, "", true); err != nil {
+			return p, err
+		}
+	}
+	return p, nil
+}
+
+// rebalance moves the files on the given filesystem that are not owned by it.
+// A drained filesystem owns no files.
+func (s *shardFS) rebalance(p *RebalanceProgress, progress func(RebalanceProgress), src FS, srcName string, drained bool) error {
+	return Walk(src, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			return nil
+		}
+
+		owner, err := s.owner(name)
+
+		if err != nil {
+			return err
+		}
+
+		p.Name = name
+		p.Checked++
+
+		if drained || owner != srcName {
+			dst := s.stores[owner]
+
+			// The copy on the owner is the newer one, since files are
+			// always put on their owner.
+			if _, err := dst.Stat(name); err == nil {
+				if err := src.Remove(name); err != nil {
+					return err
+				}
+			} else {
+				size, err := moveFile(dst, src, name)
+
+				if err != nil {
+					return &PathError{Op: "rebalance", Path: name, Err: err}
+				}
+
+				p.Moved++
+				p.Bytes += size
+			}
+		}
+
+		if progress != nil {
+			progress(*p)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,143 @@
+package fs
+
+import (
+	"bytes"
+	"os"
+	"strconv"
+	"testing"
+)
+
+func Test_ShardRebalance(t *testing.T) {
+	dirs := make(map[string]string)
+	stores := make(map[string]FS)
+
+	for _, name := range []string{"a", "b", "c"} {
+		dirs[name] = tmpdir(t)
+		defer os.RemoveAll(dirs[name])
+
+		stores[name] = New(dirs[name])
+	}
+
+	const files = 300
+
+	store := Shard(map[string]FS{
+		"a": stores["a"],
+		"b": stores["b"],
+	})
+
+	for i := 0; i < files; i++ {
+		name := "file" + strconv.Itoa(i)
+
+		f, err := ReadFile(name, bytes.NewReader([]byte(name)))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		stored, err := store.Put(f)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+		stored.Close()
+	}
+
+	count := func(name string) int {
+		ents, err := os.ReadDir(dirs[name])
+
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(ents)
+	}
+
+	if count("a") == 0 || count("b") == 0 {
+		t.Fatalf("unexpected spread, expected files on both, got a=%d b=%d\n", count("a"), count("b"))
+	}
+
+	checkAll := func(s FS) {
+		for i := 0; i < files; i++ {
+			name := "file" + strconv.Itoa(i)
+
+			if data := readAll(t, s, name); data != name {
+				t.Fatalf("unexpected content, expected=%q, got=%q\n", name, data)
+			}
+		}
+	}
+
+	tests := []struct {
+		stores  []string
+		drain   []string
+		removed string
+	}{
+		{[]string{"a", "b", "c"}, nil, ""},
+		{[]string{"a", "c"}, []string{"b"}, "b"},
+	}
+
+	for i, test := range tests {
+		ring := make(map[string]FS)
+
+		for _, name := range test.stores {
+			ring[name] = stores[name]
+		}
+
+		drain := make([]FS, 0, len(test.drain))
+
+		for _, name := range test.drain {
+			drain = append(drain, stores[name])
+		}
+
+		store := Shard(ring)
+
+		// Files should be found before the rebalance, even if they are not
+		// where they hash to, unless they are on a drained filesystem.
+		if len(drain) == 0 {
+			checkAll(store)
+		}
+
+		calls := 0
+
+		p, err := Rebalance(store, func(RebalanceProgress) { calls++ }, drain...)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if calls != p.Checked {
+			t.Fatalf("tests[%d] - unexpected progress calls, expected=%d, got=%d\n", i, p.Checked, calls)
+		}
+
+		if p.Moved == 0 || p.Moved >= files {
+			t.Fatalf("tests[%d] - unexpected files moved, expected between 0 and %d, got=%d\n", i, files, p.Moved)
+		}
+
+		total := 0
+
+		for _, name := range test.stores {
+			total += count(name)
+		}
+
+		if total != files {
+			t.Fatalf("tests[%d] - unexpected total files, expected=%d, got=%d\n", i, files, total)
+		}
+
+		if test.removed != "" {
+			if n := count(test.removed); n != 0 {
+				t.Fatalf("tests[%d] - unexpected files left on %q, expected=%d, got=%d\n", i, test.removed, 0, n)
+			}
+		}
+
+		checkAll(store)
+
+		// A second rebalance should have nothing to move.
+		p, err = Rebalance(store, nil)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if p.Moved != 0 {
+			t.Fatalf("tests[%d] - unexpected files moved, expected=%d, got=%d\n", i, 0, p.Moved)
+		}
+	}
+}
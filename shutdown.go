@@ -0,0 +1,61 @@
+package fs
+
+import (
+	"context"
+	"reflect"
+)
+
+// ShutdownFS is the interface implemented by a filesystem that buffers writes,
+// or does work in the background, which should be finished before the program
+// exits.
+type ShutdownFS interface {
+	FS
+
+	// Shutdown flushes anything buffered, and stops any background work.
+	// If the context is done before this completes then its error is
+	// returned.
+	Shutdown(ctx context.Context) error
+}
+
+// Shutdown shuts down the given filesystem and each of the filesystems it
+// wraps that implement ShutdownFS, outermost first, so each wrapper flushes
+// into the filesystem beneath it before that is shut down. Every filesystem
+// wrapped by a MultiUnwrapper is shut down, and a filesystem wrapped more than
+// once is only shut down once. Every filesystem is shut down even if one fails,
+// and the first error is returned. This would typically be called during the
+// graceful shutdown of a service, once it has stopped accepting requests.
+func Shutdown(ctx context.Context, s FS) error {
+	var err error
+
+	seen := make(map[any]struct{})
+
+	var walk func(s FS)
+
+	walk = func(s FS) {
+		if s == nil {
+			return
+		}
+
+		// Only pointers are checked, since a filesystem that is a value
+		// is copied each time it is wrapped, and may not be comparable.
+		if reflect.TypeOf(s).Kind() == reflect.Pointer {
+			if _, ok := seen[s]; ok {
+				return
+			}
+			seen[s] = struct{}{}
+		}
+
+		if ss, ok := s.(ShutdownFS); ok {
+			if err1 := ss.Shutdown(ctx); err1 != nil && err == nil {
+				err = err1
+			}
+		}
+
+		for _, wrapped := range unwrapAll(s) {
+			walk(wrapped)
+		}
+	}
+
+	walk(s)
+	return err
+}
@@ -0,0 +1,99 @@
+package fs
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+	"time"
+)
+
+func Test_Shutdown(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	reports := 0
+
+	store := Instrument(Batch(New(dir), BatchConfig{}), StatsConfig{
+		Interval: time.Hour,
+		Report: func(Stats) {
+			reports++
+		},
+	})
+
+	f, err := ReadFile("file", bytes.NewReader([]byte("data")))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := store.Put(f)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored.Close()
+
+	if n := countPacks(t, dir); n != 0 {
+		t.Fatalf("unexpected packs, expected=%d, got=%d\n", 0, n)
+	}
+
+	if err := Shutdown(context.Background(), store); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := countPacks(t, dir); n != 1 {
+		t.Fatalf("unexpected packs, expected=%d, got=%d\n", 1, n)
+	}
+
+	if reports != 1 {
+		t.Fatalf("unexpected reports, expected=%d, got=%d\n", 1, reports)
+	}
+
+	// Shutting down again should not report again.
+	if err := Shutdown(context.Background(), store); err != nil {
+		t.Fatal(err)
+	}
+
+	if reports != 1 {
+		t.Fatalf("unexpected reports, expected=%d, got=%d\n", 1, reports)
+	}
+}
+
+// shutdownCounter counts the calls to Shutdown.
+type shutdownCounter struct {
+	FS
+
+	n int
+}
+
+func (s *shutdownCounter) Shutdown(context.Context) error {
+	s.n++
+	return nil
+}
+
+func Test_ShutdownAll(t *testing.T) {
+	hot := &shutdownCounter{FS: Null()}
+	cold := &shutdownCounter{FS: Null()}
+	replica := &shutdownCounter{FS: Null()}
+
+	regions := map[string]FS{
+		"eu": Tier(hot, cold, TierPolicy{}),
+		"us": ReadBalance(cold, RoundRobin(), replica, hot),
+	}
+
+	store := Shard(map[string]FS{
+		"a": Residency(nil, regions),
+		"b": Erasure(1, 1, replica, cold),
+	})
+
+	if err := Shutdown(context.Background(), store); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, c := range []*shutdownCounter{hot, cold, replica} {
+		if c.n != 1 {
+			t.Fatalf("tests[%d] - unexpected shutdowns, expected=%d, got=%d\n", i, 1, c.n)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package fs
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+var (
+	binaryUnits = [...]string{"B", "KB", "MB", "GB", "TB", "PB", "EB"}
+	siUnits     = [...]string{"B", "kB", "MB", "GB", "TB", "PB", "EB"}
+)
+
+// HumanSize returns the given number of bytes as a human readable string in
+// binary units, to at most one decimal place, for example "1.9 GB".
+func HumanSize(n int64) string {
+	return FormatSize(n, 1, false)
+}
+
+// FormatSize returns the given number of bytes as a human readable string to
+// at most prec decimal places. Trailing zeros are trimmed. If si is true then
+// SI units are used, where a kB is 1000 bytes, otherwise binary units are used,
+// where a KB is 1024 bytes.
+func FormatSize(n int64, prec int, si bool) string {
+	base := 1024.0
+	units := binaryUnits[:]
+
+	if si {
+		base = 1000
+		units = siUnits[:]
+	}
+
+	if prec < 0 {
+		prec = 0
+	}
+
+	sign := ""
+	v := float64(n)
+
+	if v < 0 {
+		sign = "-"
+		v = -v
+	}
+
+	i := 0
+
+	for ; v >= base && i < len(units)-1; i++ {
+		v /= base
+	}
+
+	// Rounding may carry the value into the next unit, for example 1023.96
+	// bytes to one decimal place.
+	pow := math.Pow(10, float64(prec))
+
+	if math.Round(v*pow)/pow >= base && i < len(units)-1 {
+		v /= base
+		i++
+	}
+
+	s := strconv.FormatFloat(v, 'f', prec, 64)
+
+	if strings.Contains(s, ".") {
+		s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	}
+	return sign + s + " " + units[i]
+}
+
+// ParseSize parses a size such as "1.5 MB" or "512K" into a number of bytes.
+// Units are binary, so a KB is 1024 bytes, the trailing "B" is optional and
+// case is ignored. A number without a unit is in bytes.
+func ParseSize(s string) (int64, error) {
+	orig := s
+	s = strings.ToUpper(strings.TrimSpace(s))
+
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+
+	num, unit := s, ""
+
+	if i >= 0 {
+		num, unit = s[:i], strings.TrimSpace(s[i:])
+	}
+
+	v, err := strconv.ParseFloat(num, 64)
+
+	if err != nil || v < 0 {
+		return 0, &strconv.NumError{Func: "ParseSize", Num: orig, Err: strconv.ErrSyntax}
+	}
+
+	if unit != "B" {
+		unit = strings.TrimSuffix(unit, "B")
+	}
+
+	mult := 1.0
+
+	switch unit {
+	case "", "B":
+	case "K":
+		mult = 1 << 10
+	case "M":
+		mult = 1 << 20
+	case "G":
+		mult = 1 << 30
+	case "T":
+		mult = 1 << 40
+	case "P":
+		mult = 1 << 50
+	case "E":
+		mult = 1 << 60
+	default:
+		return 0, &strconv.NumError{Func: "ParseSize", Num: orig, Err: strconv.ErrSyntax}
+	}
+
+	v *= mult
+
+	if v >= math.MaxInt64 {
+		return 0, &strconv.NumError{Func: "ParseSize", Num: orig, Err: strconv.ErrRange}
+	}
+	return int64(v), nil
+}
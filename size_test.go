@@ -0,0 +1,71 @@
+package fs
+
+import "testing"
+
+func Test_FormatSize(t *testing.T) {
+	tests := []struct {
+		n        int64
+		prec     int
+		si       bool
+		expected string
+	}{
+		{0, 1, false, "0 B"},
+		{1023, 1, false, "1023 B"},
+		{1024, 1, false, "1 KB"},
+		{1536, 1, false, "1.5 KB"},
+		{32 << 20, 1, false, "32 MB"},
+		{1950 << 20, 1, false, "1.9 GB"},
+		{1950 << 20, 0, false, "2 GB"},
+		{1950 << 20, 3, false, "1.904 GB"},
+		{(1 << 20) - 1, 1, false, "1 MB"},
+		{1000, 1, true, "1 kB"},
+		{1500000, 2, true, "1.5 MB"},
+		{-1536, 1, false, "-1.5 KB"},
+		{1 << 62, 1, false, "4 EB"},
+	}
+
+	for i, test := range tests {
+		if s := FormatSize(test.n, test.prec, test.si); s != test.expected {
+			t.Fatalf("tests[%d] - unexpected size, expected=%q, got=%q\n", i, test.expected, s)
+		}
+	}
+}
+
+func Test_HumanSize(t *testing.T) {
+	if s := HumanSize(87 << 20); s != "87 MB" {
+		t.Fatalf("unexpected size, expected=%q, got=%q\n", "87 MB", s)
+	}
+}
+
+func Test_ParseSize(t *testing.T) {
+	tests := []struct {
+		s        string
+		expected int64
+		ok       bool
+	}{
+		{"0", 0, true},
+		{"512", 512, true},
+		{"512B", 512, true},
+		{"1KB", 1024, true},
+		{"1.5 MB", 1536 << 10, true},
+		{"2g", 2 << 30, true},
+		{"10M", 10 << 20, true},
+		{"", 0, false},
+		{"MB", 0, false},
+		{"-1KB", 0, false},
+		{"1 XB", 0, false},
+		{"16EB", 0, false},
+	}
+
+	for i, test := range tests {
+		n, err := ParseSize(test.s)
+
+		if test.ok != (err == nil) {
+			t.Fatalf("tests[%d] - unexpected error for %q: %v\n", i, test.s, err)
+		}
+
+		if n != test.expected {
+			t.Fatalf("tests[%d] - unexpected size, expected=%d, got=%d\n", i, test.expected, n)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package fs
+
+import (
+	"errors"
+	"io"
+	"os"
+	"syscall"
+)
+
+// The whence values for lseek(2) to find the data and holes in a file.
+const (
+	seekData = 3
+	seekHole = 4
+)
+
+// copySparse copies src into dst preserving any holes in src, so that the
+// holes are not written out as zeros. This is only attempted if src has not
+// been read from yet, and only reports handling the copy if src has holes and
+// the filesystem supports finding them.
+func copySparse(dst, src *os.File) (int64, bool, error) {
+	if off, err := src.Seek(0, io.SeekCurrent); err != nil || off != 0 {
+		return 0, false, nil
+	}
+
+	info, err := src.Stat()
+
+	if err != nil || !info.Mode().IsRegular() {
+		return 0, false, nil
+	}
+
+	size := info.Size()
+
+	// Not supported by the filesystem, or the file has no holes, in which case
+	// a regular copy is as good.
+	if hole, err := src.Seek(0, seekHole); err != nil || hole >= size {
+		src.Seek(0, io.SeekStart)
+		return 0, false, nil
+	}
+
+	var off int64
+
+	for off < size {
+		data, err := src.Seek(off, seekData)
+
+		if err != nil {
+			// No more data after the offset, the rest is a hole.
+			if errors.Is(err, syscall.ENXIO) {
+				break
+			}
+			return 0, true, err
+		}
+
+		hole, err := src.Seek(data, seekHole)
+
+		if err != nil {
+			return 0, true, err
+		}
+
+		if _, err := src.Seek(data, io.SeekStart); err != nil {
+			return 0, true, err
+		}
+
+		if _, err := dst.Seek(data, io.SeekStart); err != nil {
+			return 0, true, err
+		}
+
+		if _, err := dst.ReadFrom(io.LimitReader(src, hole-data)); err != nil {
+			return 0, true, err
+		}
+		off = hole
+	}
+
+	// Extend the file over any trailing hole.
+	if err := dst.Truncate(size); err != nil {
+		return 0, true, err
+	}
+
+	if _, err := dst.Seek(size, io.SeekStart); err != nil {
+		return 0, true, err
+	}
+
+	if _, err := src.Seek(size, io.SeekStart); err != nil {
+		return 0, true, err
+	}
+	return size, true, nil
+}
@@ -0,0 +1,72 @@
+package fs
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func Test_PutSparse(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	size := int64(16 << 20)
+	data := generateData(t, 4096)
+
+	src, err := os.Create(filepath.Join(dir, "src"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer src.Close()
+
+	// Data in the middle of the file, with holes either side.
+	if _, err := src.WriteAt(data, 8<<20); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := src.Truncate(size); err != nil {
+		t.Fatal(err)
+	}
+
+	sub, err := New(dir).Sub("dst")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := sub.Put(src)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer stored.Close()
+
+	b, err := io.ReadAll(stored)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := make([]byte, size)
+	copy(expected[8<<20:], data)
+
+	if !bytes.Equal(b, expected) {
+		t.Fatal("unexpected file content")
+	}
+
+	info, err := os.Stat(filepath.Join(dir, "dst", "src"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if allocated := info.Sys().(*syscall.Stat_t).Blocks * 512; allocated >= size {
+		t.Fatalf("expected holes to be preserved, allocated=%d, size=%d\n", allocated, size)
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package fs
+
+import "os"
+
+// copySparse is only supported on Linux, on every other platform holes are
+// copied as zeros.
+func copySparse(dst, src *os.File) (int64, bool, error) {
+	return 0, false, nil
+}
@@ -0,0 +1,461 @@
+// Package spool implements a durable FIFO queue of payloads in an FS, such as
+// outgoing email or webhooks, without a message broker.
+//
+// Each payload is a file that moves between the folders of the spool, much
+// like a maildir,
+//
+//	tmp/    payloads being enqueued
+//	new/    payloads waiting to be claimed
+//	cur/    payloads claimed by a worker
+//	retry/  payloads waiting to be retried after a failure
+//	dead/   payloads that failed too many times
+//
+// A worker claims a payload, delivers it, and then acks it to remove it from
+// the spool, or retries it if delivery failed, for example,
+//
+//	for {
+//		msg, err := sp.Claim()
+//
+//		if err != nil {
+//			if errors.Is(err, spool.ErrEmpty) {
+//				time.Sleep(time.Second)
+//				continue
+//			}
+//			return err
+//		}
+//
+//		if err := send(msg); err != nil {
+//			sp.Retry(msg)
+//			continue
+//		}
+//		sp.Ack(msg)
+//	}
+//
+// Payloads are moved between folders by renaming them, so the FS must
+// implement fs.RenameFS, and the rename should be atomic, as it is for the FS
+// returned from fs.New, for multiple workers to share the spool. Delivery is
+// at least once, a payload claimed by a worker that stops before acking it is
+// claimed again once its claim times out.
+package spool
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andrewpillar/fs"
+)
+
+// ErrEmpty is returned when there are no payloads to claim.
+var ErrEmpty = errors.New("spool empty")
+
+const (
+	tmpDir   = "tmp"
+	newDir   = "new"
+	curDir   = "cur"
+	retryDir = "retry"
+	deadDir  = "dead"
+)
+
+// Spool is a queue of payloads in an FS.
+type Spool struct {
+	fs fs.FS
+
+	minBackoff   time.Duration
+	maxBackoff   time.Duration
+	maxAttempts  int
+	claimTimeout time.Duration
+	now          func() time.Time
+}
+
+// Option configures a Spool.
+type Option func(*Spool)
+
+// Backoff sets the minimum and maximum time to wait before a payload that was
+// retried can be claimed again. The wait doubles after each attempt. The
+// defaults are 1 minute and 6 hours.
+func Backoff(min, max time.Duration) Option {
+	return func(s *Spool) {
+		if min > 0 {
+			s.minBackoff = min
+		}
+		if max >= s.minBackoff {
+			s.maxBackoff = max
+		}
+	}
+}
+
+// MaxAttempts sets the number of times a payload is attempted before it is
+// moved to the dead folder. Defaults to 10.
+func MaxAttempts(n int) Option {
+	return func(s *Spool) {
+		if n > 0 {
+			s.maxAttempts = n
+		}
+	}
+}
+
+// ClaimTimeout sets how long a payload may be claimed before it can be claimed
+// again, in case the worker that claimed it stopped. This should be longer
+// than a payload takes to be delivered. Defaults to 10 minutes.
+func ClaimTimeout(d time.Duration) Option {
+	return func(s *Spool) {
+		s.claimTimeout = d
+	}
+}
+
+// WithClock sets the function used to get the current time. Defaults to
+// time.Now.
+func WithClock(now func() time.Time) Option {
+	return func(s *Spool) {
+		s.now = now
+	}
+}
+
+// New returns a Spool in the given FS, creating its folders if they do not
+// exist.
+func New(s fs.FS, opts ...Option) (*Spool, error) {
+	sp := &Spool{
+		fs:           s,
+		minBackoff:   time.Minute,
+		maxBackoff:   6 * time.Hour,
+		maxAttempts:  10,
+		claimTimeout: 10 * time.Minute,
+		now:          time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(sp)
+	}
+
+	if _, ok := s.(fs.RenameFS); !ok {
+		return nil, &fs.PathError{Op: "spool", Path: ".", Err: fs.ErrUnsupported}
+	}
+
+	for _, dir := range []string{tmpDir, newDir, curDir, retryDir, deadDir} {
+		if _, err := s.Sub(dir); err != nil {
+			return nil, err
+		}
+	}
+	return sp, nil
+}
+
+// Message is a payload claimed from a Spool.
+type Message struct {
+	// ID is the ID of the payload, as returned when it was enqueued.
+	ID string
+
+	// Attempts is the number of times the payload was attempted before it
+	// was claimed.
+	Attempts int
+
+	// Enqueued is when the payload was enqueued.
+	Enqueued time.Time
+
+	name string // The name of the payload in the cur folder.
+	fs   fs.FS
+}
+
+// Open opens the payload of the message.
+func (m *Message) Open() (fs.File, error) {
+	return m.fs.Open(m.name)
+}
+
+// newID returns a new ID, which starts with the current time so the IDs sort
+// in the order the payloads were enqueued.
+func (s *Spool) newID() (string, error) {
+	b := make([]byte, 8)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%020d-%s", s.now().UnixNano(), hex.EncodeToString(b)), nil
+}
+
+// Enqueue adds the payload read from r to the spool, and returns its ID. The
+// payload is written to the tmp folder and then renamed into the new folder,
+// so it is never claimed partially written.
+func (s *Spool) Enqueue(r io.Reader) (string, error) {
+	id, err := s.newID()
+
+	if err != nil {
+		return "", err
+	}
+
+	f, err := fs.ReadFile(id, r)
+
+	if err != nil {
+		return "", &fs.PathError{Op: "spool", Path: id, Err: err}
+	}
+
+	defer fs.Cleanup(f)
+
+	stored, err := fs.PutPath(s.fs, path.Join(tmpDir, id), f)
+
+	if err != nil {
+		return "", err
+	}
+	stored.Close()
+
+	if err := fs.Move(s.fs, path.Join(tmpDir, id), path.Join(newDir, id)); err != nil {
+		s.fs.Remove(path.Join(tmpDir, id))
+		return "", err
+	}
+	return id, nil
+}
+
+// EnqueueBytes adds the given payload to the spool, and returns its ID.
+func (s *Spool) EnqueueBytes(b []byte) (string, error) {
+	return s.Enqueue(bytes.NewReader(b))
+}
+
+// stamped is the name of a payload in the cur and retry folders, which is
+// prefixed with a time, and the number of attempts made, as in
+// <time>-<attempts>-<id>. The time is when the payload was claimed in the cur
+// folder, and when it is due to be retried in the retry folder.
+type stamped struct {
+	time     time.Time
+	attempts int
+	id       string
+}
+
+func (st stamped) String() string {
+	return fmt.Sprintf("%020d-%d-%s", st.time.UnixNano(), st.attempts, st.id)
+}
+
+func parseStamped(name string) (stamped, bool) {
+	var st stamped
+
+	ts, rest, ok := strings.Cut(name, "-")
+
+	if !ok {
+		return st, false
+	}
+
+	attempts, id, ok := strings.Cut(rest, "-")
+
+	if !ok {
+		return st, false
+	}
+
+	nsec, err := strconv.ParseInt(ts, 10, 64)
+
+	if err != nil {
+		return st, false
+	}
+
+	n, err := strconv.Atoi(attempts)
+
+	if err != nil {
+		return st, false
+	}
+
+	st.time = time.Unix(0, nsec)
+	st.attempts = n
+	st.id = id
+	return st, true
+}
+
+// enqueued returns when the payload with the given ID was enqueued.
+func enqueued(id string) time.Time {
+	ts, _, _ := strings.Cut(id, "-")
+
+	nsec, _ := strconv.ParseInt(ts, 10, 64)
+	return time.Unix(0, nsec)
+}
+
+func (s *Spool) list(dir string) ([]string, error) {
+	ents, err := fs.ReadDir(s.fs, dir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(ents))
+
+	for _, ent := range ents {
+		if !ent.IsDir() {
+			names = append(names, ent.Name())
+		}
+	}
+
+	sort.Strings(names)
+	return names, nil
+}
+
+// candidate is a payload that can be claimed.
+type candidate struct {
+	name     string
+	id       string
+	attempts int
+}
+
+// candidates returns the payloads that can be claimed, in the order they
+// should be claimed. Payloads that are due to be retried, or whose claim has
+// timed out, come before new payloads, as they were enqueued earlier.
+func (s *Spool) candidates() ([]candidate, error) {
+	now := s.now()
+
+	var cands []candidate
+
+	for _, dir := range []string{curDir, retryDir} {
+		names, err := s.list(dir)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, name := range names {
+			st, ok := parseStamped(name)
+
+			if !ok {
+				continue
+			}
+
+			due := st.time
+
+			if dir == curDir {
+				if s.claimTimeout <= 0 {
+					continue
+				}
+				due = due.Add(s.claimTimeout)
+			}
+
+			if due.After(now) {
+				continue
+			}
+
+			cands = append(cands, candidate{
+				name:     path.Join(dir, name),
+				id:       st.id,
+				attempts: st.attempts,
+			})
+		}
+	}
+
+	sort.SliceStable(cands, func(i, j int) bool {
+		return cands[i].id < cands[j].id
+	})
+
+	names, err := s.list(newDir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range names {
+		cands = append(cands, candidate{
+			name: path.Join(newDir, name),
+			id:   name,
+		})
+	}
+	return cands, nil
+}
+
+// Claim claims the oldest payload that is ready to be delivered. The payload
+// must be acked once it has been delivered, or retried if delivery failed. If
+// there are no payloads ready then ErrEmpty is returned.
+func (s *Spool) Claim() (*Message, error) {
+	cands, err := s.candidates()
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, c := range cands {
+		// A claim that timed out counts as a failed attempt.
+		attempts := c.attempts
+
+		if strings.HasPrefix(c.name, curDir+"/") {
+			attempts++
+		}
+
+		if attempts >= s.maxAttempts {
+			if err := s.bury(c.name, c.id); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return nil, err
+			}
+			continue
+		}
+
+		name := path.Join(curDir, stamped{time: s.now(), attempts: attempts, id: c.id}.String())
+
+		// Another worker claimed the payload first.
+		if err := fs.Move(s.fs, c.name, name); err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+
+		return &Message{
+			ID:       c.id,
+			Attempts: attempts,
+			Enqueued: enqueued(c.id),
+			name:     name,
+			fs:       s.fs,
+		}, nil
+	}
+	return nil, ErrEmpty
+}
+
+// Ack removes the delivered payload of the message from the spool.
+func (s *Spool) Ack(m *Message) error {
+	return s.fs.Remove(m.name)
+}
+
+// backoff returns how long to wait before the given attempt.
+func (s *Spool) backoff(attempt int) time.Duration {
+	d := s.minBackoff
+
+	for i := 1; i < attempt && d < s.maxBackoff; i++ {
+		d *= 2
+	}
+
+	if d > s.maxBackoff {
+		d = s.maxBackoff
+	}
+	return d
+}
+
+// Retry returns the payload of the message to the spool, to be claimed again
+// once its backoff has passed. If the payload has been attempted the maximum
+// number of times then it is moved to the dead folder instead.
+func (s *Spool) Retry(m *Message) error {
+	attempts := m.Attempts + 1
+
+	if attempts >= s.maxAttempts {
+		return s.bury(m.name, m.ID)
+	}
+
+	name := path.Join(retryDir, stamped{
+		time:     s.now().Add(s.backoff(attempts)),
+		attempts: attempts,
+		id:       m.ID,
+	}.String())
+
+	return fs.Move(s.fs, m.name, name)
+}
+
+// bury moves the given payload to the dead folder.
+func (s *Spool) bury(name, id string) error {
+	return fs.Move(s.fs, name, path.Join(deadDir, id))
+}
+
+// Dead returns the IDs of the payloads in the dead folder.
+func (s *Spool) Dead() ([]string, error) {
+	return s.list(deadDir)
+}
+
+// Requeue moves the payload with the given ID from the dead folder back to the
+// new folder, with its attempts reset.
+func (s *Spool) Requeue(id string) error {
+	return fs.Move(s.fs, path.Join(deadDir, id), path.Join(newDir, id))
+}
@@ -0,0 +1,172 @@
+package spool
+
+import (
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/andrewpillar/fs/fakefs"
+)
+
+func payload(t *testing.T, m *Message) string {
+	f, err := m.Open()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	b, err := io.ReadAll(f)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func Test_Spool(t *testing.T) {
+	clock := fakefs.NewManualClock(time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC))
+
+	sp, err := New(fakefs.New(), WithClock(clock.Now), Backoff(time.Minute, time.Hour), MaxAttempts(3))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, s := range []string{"first", "second"} {
+		if _, err := sp.EnqueueBytes([]byte(s)); err != nil {
+			t.Fatal(err)
+		}
+		clock.Advance(time.Millisecond)
+	}
+
+	m, err := sp.Claim()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s := payload(t, m); s != "first" {
+		t.Fatalf("unexpected payload, expected=%q, got=%q\n", "first", s)
+	}
+
+	if err := sp.Retry(m); err != nil {
+		t.Fatal(err)
+	}
+
+	// The first payload is waiting to be retried, so the second is claimed.
+	m2, err := sp.Claim()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s := payload(t, m2); s != "second" {
+		t.Fatalf("unexpected payload, expected=%q, got=%q\n", "second", s)
+	}
+
+	if err := sp.Ack(m2); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := sp.Claim(); !errors.Is(err, ErrEmpty) {
+		t.Fatalf("unexpected error, expected=%q, got=%q\n", ErrEmpty, err)
+	}
+
+	clock.Advance(time.Minute)
+
+	m, err = sp.Claim()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Attempts != 1 || payload(t, m) != "first" {
+		t.Fatalf("unexpected attempts, expected=%d, got=%d\n", 1, m.Attempts)
+	}
+
+	if err := sp.Retry(m); err != nil {
+		t.Fatal(err)
+	}
+
+	// The backoff doubles after each attempt.
+	clock.Advance(time.Minute)
+
+	if _, err := sp.Claim(); !errors.Is(err, ErrEmpty) {
+		t.Fatalf("unexpected error, expected=%q, got=%q\n", ErrEmpty, err)
+	}
+
+	clock.Advance(time.Minute)
+
+	m, err = sp.Claim()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sp.Retry(m); err != nil {
+		t.Fatal(err)
+	}
+
+	dead, err := sp.Dead()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(dead) != 1 || dead[0] != m.ID {
+		t.Fatalf("unexpected dead, expected=%q, got=%q\n", m.ID, dead)
+	}
+
+	if err := sp.Requeue(m.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err = sp.Claim()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Attempts != 0 {
+		t.Fatalf("unexpected attempts, expected=%d, got=%d\n", 0, m.Attempts)
+	}
+}
+
+func Test_SpoolClaimTimeout(t *testing.T) {
+	clock := fakefs.NewManualClock(time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC))
+
+	sp, err := New(fakefs.New(), WithClock(clock.Now), ClaimTimeout(time.Minute))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := sp.EnqueueBytes([]byte("payload"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := sp.Claim(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := sp.Claim(); !errors.Is(err, ErrEmpty) {
+		t.Fatalf("unexpected error, expected=%q, got=%q\n", ErrEmpty, err)
+	}
+
+	clock.Advance(time.Minute)
+
+	m, err := sp.Claim()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.ID != id || m.Attempts != 1 {
+		t.Fatalf("unexpected message, expected=%q, got=%q (attempts=%d)\n", id, m.ID, m.Attempts)
+	}
+}
@@ -0,0 +1,277 @@
+package fs
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"sync"
+	"time"
+)
+
+// Stack wraps the given filesystem in each of the given wrappers in order, so
+// the first wrapper is the innermost. This is the same as nesting the calls by
+// hand, for example,
+//
+//	fs.Stack(base, hash, limit)
+//
+// is the same as limit(hash(base)).
+func Stack(base FS, wrappers ...func(FS) FS) FS {
+	s := base
+
+	for _, wrap := range wrappers {
+		s = wrap(s)
+	}
+	return s
+}
+
+// Layer is the declarative configuration of a single wrapper in a stack. The
+// Type is the name the wrapper was registered under via RegisterLayer, and
+// Params are the JSON encoded parameters for the wrapper, if any.
+type Layer struct {
+	Type   string          `json:"type"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+// LayerFunc returns a wrapper configured from the given JSON encoded
+// parameters, which may be empty.
+type LayerFunc func(params json.RawMessage) (func(FS) FS, error)
+
+var (
+	layersMu sync.RWMutex
+	layers   = make(map[string]LayerFunc)
+)
+
+// RegisterLayer registers a wrapper under the given type, so it can be used in
+// a Layer. Registering the same type twice replaces the previous wrapper. The
+// following types are registered by default,
+//
+//	cache     {"ttl": "1m"}
+//	decompress
+//	hash      {"algorithm": "sha256", "encoding": "hex", "prefix": "", "truncate": 0}
+//	limit     {"size": 5242880}
+//	readonly
+//	timeout   {"duration": "30s"}
+//	unique    {"policy": "error"}
+//	writeonly
+//
+// The ttl of cache is optional, and defaults to one minute.
+func RegisterLayer(typ string, fn LayerFunc) {
+	layersMu.Lock()
+	defer layersMu.Unlock()
+
+	layers[typ] = fn
+}
+
+// BuildStack wraps the given filesystem in the wrappers configured by the
+// given layers, in order, so the first layer is the innermost.
+func BuildStack(base FS, stack []Layer) (FS, error) {
+	wrappers := make([]func(FS) FS, 0, len(stack))
+
+	for i, l := range stack {
+		layersMu.RLock()
+		fn, ok := layers[l.Type]
+		layersMu.RUnlock()
+
+		if !ok {
+			return nil, fmt.Errorf("layer %d: unknown type %q", i, l.Type)
+		}
+
+		wrap, err := fn(l.Params)
+
+		if err != nil {
+			return nil, fmt.Errorf("layer %d: %s: %w", i, l.Type, err)
+		}
+		wrappers = append(wrappers, wrap)
+	}
+	return Stack(base, wrappers...), nil
+}
+
+// LoadStack reads a JSON array of layers from the given reader, and wraps the
+// given filesystem in them via BuildStack.
+func LoadStack(base FS, r io.Reader) (FS, error) {
+	var stack []Layer
+
+	if err := json.NewDecoder(r).Decode(&stack); err != nil {
+		return nil, err
+	}
+	return BuildStack(base, stack)
+}
+
+// decodeParams decodes the given parameters into v, if there are any.
+func decodeParams(params json.RawMessage, v any) error {
+	if len(params) == 0 {
+		return nil
+	}
+	return json.Unmarshal(params, v)
+}
+
+var hashAlgorithms = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+var hashEncodings = map[string]func([]byte) string{
+	"hex":       HexEncoding,
+	"base32":    Base32Encoding,
+	"base64url": Base64URLEncoding,
+}
+
+// defaultCacheTTL is the ttl of a cache layer that does not give one.
+const defaultCacheTTL = time.Minute
+
+var collisionPolicies = map[string]CollisionPolicy{
+	"error":     CollisionError,
+	"overwrite": CollisionOverwrite,
+	"suffix":    CollisionSuffix,
+}
+
+func init() {
+	RegisterLayer("cache", func(params json.RawMessage) (func(FS) FS, error) {
+		var p struct {
+			TTL string `json:"ttl"`
+		}
+
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+
+		ttl := defaultCacheTTL
+
+		if p.TTL != "" {
+			d, err := time.ParseDuration(p.TTL)
+
+			if err != nil {
+				return nil, err
+			}
+
+			if d <= 0 {
+				return nil, errors.New("ttl must be greater than zero")
+			}
+			ttl = d
+		}
+
+		return func(s FS) FS {
+			return CacheStat(s, ttl)
+		}, nil
+	})
+
+	RegisterLayer("decompress", func(json.RawMessage) (func(FS) FS, error) {
+		return func(s FS) FS {
+			return Decompress(s)
+		}, nil
+	})
+
+	RegisterLayer("hash", func(params json.RawMessage) (func(FS) FS, error) {
+		p := struct {
+			Algorithm string `json:"algorithm"`
+			Encoding  string `json:"encoding"`
+			Prefix    string `json:"prefix"`
+			Truncate  int    `json:"truncate"`
+		}{
+			Algorithm: "sha256",
+			Encoding:  "hex",
+		}
+
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+
+		mech, ok := hashAlgorithms[p.Algorithm]
+
+		if !ok {
+			return nil, fmt.Errorf("unknown algorithm %q", p.Algorithm)
+		}
+
+		encode, ok := hashEncodings[p.Encoding]
+
+		if !ok {
+			return nil, fmt.Errorf("unknown encoding %q", p.Encoding)
+		}
+
+		opts := []HashOption{
+			HashEncoding(encode),
+			HashPrefix(p.Prefix),
+			HashTruncate(p.Truncate),
+		}
+
+		return func(s FS) FS {
+			return Hash(s, mech, opts...)
+		}, nil
+	})
+
+	RegisterLayer("limit", func(params json.RawMessage) (func(FS) FS, error) {
+		var p struct {
+			Size int64 `json:"size"`
+		}
+
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+
+		if p.Size <= 0 {
+			return nil, errors.New("size must be greater than zero")
+		}
+
+		return func(s FS) FS {
+			return Limit(s, p.Size)
+		}, nil
+	})
+
+	RegisterLayer("readonly", func(json.RawMessage) (func(FS) FS, error) {
+		return ReadOnly, nil
+	})
+
+	RegisterLayer("timeout", func(params json.RawMessage) (func(FS) FS, error) {
+		var p struct {
+			Duration string `json:"duration"`
+		}
+
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+
+		d, err := time.ParseDuration(p.Duration)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return func(s FS) FS {
+			return Timeout(s, d)
+		}, nil
+	})
+
+	RegisterLayer("unique", func(params json.RawMessage) (func(FS) FS, error) {
+		p := struct {
+			Policy string `json:"policy"`
+		}{
+			Policy: "error",
+		}
+
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+
+		policy, ok := collisionPolicies[p.Policy]
+
+		if !ok {
+			return nil, fmt.Errorf("unknown policy %q", p.Policy)
+		}
+
+		return func(s FS) FS {
+			return UniquePolicy(s, policy)
+		}, nil
+	})
+
+	RegisterLayer("writeonly", func(json.RawMessage) (func(FS) FS, error) {
+		return WriteOnly, nil
+	})
+}
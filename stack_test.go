@@ -0,0 +1,117 @@
+package fs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func Test_Stack(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	store := Stack(New(dir), func(s FS) FS {
+		return Hash(s, sha256.New)
+	}, func(s FS) FS {
+		return Limit(s, 16)
+	})
+
+	if _, ok := store.(limit); !ok {
+		t.Fatalf("unexpected outermost wrapper, expected=%T, got=%T\n", limit{}, store)
+	}
+}
+
+func Test_LoadStack(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	config := `[
+		{"type": "hash", "params": {"algorithm": "sha256", "prefix": "sha256-", "truncate": 8}},
+		{"type": "unique"},
+		{"type": "limit", "params": {"size": 1024}}
+	]`
+
+	store, err := LoadStack(New(dir), strings.NewReader(config))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := ReadFile("file", bytes.NewReader([]byte("hello world\n")))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := store.Put(f)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer stored.Close()
+
+	info, err := stored.Stat()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if name := info.Name(); name != "sha256-a948904f" {
+		t.Fatalf("unexpected name, expected=%q, got=%q\n", "sha256-a948904f", name)
+	}
+
+	f, err = ReadFile("big", bytes.NewReader(generateData(t, 2048)))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.Put(f); !errors.Is(err, SizeError{Size: 1024}) {
+		t.Fatalf("unexpected error, expected=%T, got=%v\n", SizeError{}, err)
+	}
+}
+
+func Test_BuildStackCache(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	store, err := BuildStack(New(dir), []Layer{{Type: "cache"}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cache := store.(renameStatCache)
+
+	if cache.ttl != defaultCacheTTL {
+		t.Fatalf("unexpected ttl, expected=%v, got=%v\n", defaultCacheTTL, cache.ttl)
+	}
+
+	store.Stat("file")
+	store.Stat("file")
+
+	if cache.hits != 1 {
+		t.Fatalf("unexpected hits, expected=%d, got=%d\n", 1, cache.hits)
+	}
+}
+
+func Test_BuildStackErrors(t *testing.T) {
+	tests := []Layer{
+		{Type: "unknown"},
+		{Type: "limit"},
+		{Type: "hash", Params: []byte(`{"algorithm": "crc32"}`)},
+		{Type: "unique", Params: []byte(`{"policy": "ignore"}`)},
+		{Type: "cache", Params: []byte(`{"ttl": "soon"}`)},
+		{Type: "cache", Params: []byte(`{"ttl": "0s"}`)},
+	}
+
+	for i, test := range tests {
+		if _, err := BuildStack(Null(), []Layer{test}); err == nil {
+			t.Fatalf("tests[%d] - expected error for layer %q, got nil\n", i, test.Type)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+// Package stage materializes files from an FS onto a directory on the
+// operating system's filesystem, and syncs changes made there back to the FS.
+//
+// This lets workloads that need a real path, such as programs that only
+// operate on local files, be fed from any FS.
+package stage
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/andrewpillar/fs"
+)
+
+// state is the state of a file on disk when it was last staged or synced.
+type state struct {
+	size    int64
+	modTime time.Time
+}
+
+// Volume is a directory on disk staged from an FS.
+type Volume struct {
+	fs    fs.FS
+	dir   string
+	files map[string]state
+}
+
+// Stage copies every file beneath root in the given FS into the given
+// directory, creating it if it does not exist. The FS must implement
+// fs.ReadDirFS. The modification time of each file on disk is set to that of
+// the file in the FS.
+func Stage(s fs.FS, root, dir string) (*Volume, error) {
+	if root != "." {
+		sub, err := s.Sub(root)
+
+		if err != nil {
+			return nil, err
+		}
+		s = sub
+	}
+
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, err
+	}
+
+	v := &Volume{
+		fs:    s,
+		dir:   dir,
+		files: make(map[string]state),
+	}
+
+	err := fs.Walk(s, ".", func(name string, ent fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if ent.IsDir() {
+			if name == "." {
+				return nil
+			}
+			return os.MkdirAll(v.path(name), 0750)
+		}
+		return v.fetch(name)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func (v *Volume) path(name string) string {
+	return filepath.Join(v.dir, filepath.FromSlash(name))
+}
+
+// fetch copies the named file from the FS to disk.
+func (v *Volume) fetch(name string) error {
+	f, err := v.fs.Open(name)
+
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	info, err := f.Stat()
+
+	if err != nil {
+		return err
+	}
+
+	dst, err := os.Create(v.path(name))
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(dst, f); err != nil {
+		dst.Close()
+		return err
+	}
+
+	if err := dst.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Chtimes(v.path(name), info.ModTime(), info.ModTime()); err != nil {
+		return err
+	}
+	return v.record(name)
+}
+
+// record records the state of the named file on disk.
+func (v *Volume) record(name string) error {
+	info, err := os.Stat(v.path(name))
+
+	if err != nil {
+		return err
+	}
+
+	v.files[name] = state{
+		size:    info.Size(),
+		modTime: info.ModTime(),
+	}
+	return nil
+}
+
+// Path returns the directory the files were staged to.
+func (v *Volume) Path() string { return v.dir }
+
+// push puts the named file on disk into the FS.
+func (v *Volume) push(name string) error {
+	f, err := os.Open(v.path(name))
+
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	stored, err := fs.PutPath(v.fs, name, f)
+
+	if err != nil {
+		return err
+	}
+	stored.Close()
+
+	return v.record(name)
+}
+
+// Sync puts the files that have been created or modified on disk since they
+// were staged, or last synced, into the FS, and removes the files from the FS
+// that have been removed from disk. A file is considered modified if its size
+// or modification time has changed.
+func (v *Volume) Sync() error {
+	seen := make(map[string]struct{})
+
+	err := filepath.WalkDir(v.dir, func(p string, ent os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if ent.IsDir() || !ent.Type().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(v.dir, p)
+
+		if err != nil {
+			return err
+		}
+
+		name := filepath.ToSlash(rel)
+		seen[name] = struct{}{}
+
+		info, err := ent.Info()
+
+		if err != nil {
+			return err
+		}
+
+		if st, ok := v.files[name]; ok && st.size == info.Size() && st.modTime.Equal(info.ModTime()) {
+			return nil
+		}
+		return v.push(name)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	for name := range v.files {
+		if _, ok := seen[name]; ok {
+			continue
+		}
+
+		if err := v.fs.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		delete(v.files, name)
+	}
+	return nil
+}
+
+// Close syncs the volume, and then removes the directory from disk. The
+// directory is left in place if the sync fails, so no changes are lost.
+func (v *Volume) Close() error {
+	if err := v.Sync(); err != nil {
+		return err
+	}
+	return os.RemoveAll(v.dir)
+}
@@ -0,0 +1,97 @@
+package stage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/andrewpillar/fs"
+)
+
+func tmpdir(t *testing.T) string {
+	dir, err := os.MkdirTemp("", t.Name())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func writeFile(t *testing.T, name, content string) {
+	if err := os.MkdirAll(filepath.Dir(name), 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(name, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, name string) string {
+	b, err := os.ReadFile(name)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func Test_Stage(t *testing.T) {
+	src := tmpdir(t)
+	defer os.RemoveAll(src)
+
+	writeFile(t, filepath.Join(src, "job", "input", "a.txt"), "a")
+	writeFile(t, filepath.Join(src, "job", "b.txt"), "b")
+	writeFile(t, filepath.Join(src, "other", "c.txt"), "c")
+
+	dst := filepath.Join(tmpdir(t), "volume")
+	defer os.RemoveAll(filepath.Dir(dst))
+
+	v, err := Stage(fs.New(src), "job", dst)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if content := readFile(t, filepath.Join(dst, "input", "a.txt")); content != "a" {
+		t.Fatalf("unexpected content, expected=%q, got=%q\n", "a", content)
+	}
+
+	if _, err := os.Stat(filepath.Join(dst, "c.txt")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", os.ErrNotExist, err)
+	}
+
+	// Modify, create, and remove files on disk, then sync back.
+	writeFile(t, filepath.Join(dst, "b.txt"), "modified")
+	writeFile(t, filepath.Join(dst, "output", "d.txt"), "d")
+
+	// Make sure the modification time changes even on filesystems with a
+	// coarse resolution.
+	future := time.Now().Add(time.Hour)
+	os.Chtimes(filepath.Join(dst, "b.txt"), future, future)
+
+	if err := os.Remove(filepath.Join(dst, "input", "a.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := v.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if content := readFile(t, filepath.Join(src, "job", "b.txt")); content != "modified" {
+		t.Fatalf("unexpected content, expected=%q, got=%q\n", "modified", content)
+	}
+
+	if content := readFile(t, filepath.Join(src, "job", "output", "d.txt")); content != "d" {
+		t.Fatalf("unexpected content, expected=%q, got=%q\n", "d", content)
+	}
+
+	if _, err := os.Stat(filepath.Join(src, "job", "input", "a.txt")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", os.ErrNotExist, err)
+	}
+
+	if _, err := os.Stat(dst); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", os.ErrNotExist, err)
+	}
+}
@@ -0,0 +1,516 @@
+package fs
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	// statsSlots is the number of slots the window of the stats is divided
+	// into. Each slot is reset as the window rolls over it.
+	statsSlots = 60
+
+	// latencyBuckets is the number of buckets latencies are counted in. Each
+	// bucket holds latencies up to twice those of the previous one, starting
+	// from a microsecond, so the last bucket holds everything past half an
+	// hour.
+	latencyBuckets = 32
+)
+
+// OpStats are the statistics of a single operation.
+type OpStats struct {
+	Ops    int64
+	Errors int64
+	Bytes  int64
+
+	// P50, P99, and Max are the latencies of the operation. The percentiles
+	// are approximate, and accurate to within a factor of two.
+	P50 time.Duration
+	P99 time.Duration
+	Max time.Duration
+}
+
+// ErrorRate returns the fraction of operations that failed.
+func (s OpStats) ErrorRate() float64 {
+	if s.Ops == 0 {
+		return 0
+	}
+	return float64(s.Errors) / float64(s.Ops)
+}
+
+// Stats is a snapshot of the statistics collected by Instrument over the last
+// window.
+type Stats struct {
+	Window time.Duration
+
+	// Ops is the statistics of each operation, keyed by the name of the
+	// operation, such as open, read, or put. Reads are counted per call to
+	// Read on files that were opened.
+	Ops map[string]OpStats
+}
+
+// StatsConfig configures the statistics collected by Instrument.
+type StatsConfig struct {
+	// Window is the duration the statistics are collected over. Defaults to
+	// a minute.
+	Window time.Duration
+
+	// Interval is how often the statistics are passed to Report.
+	Interval time.Duration
+
+	// Report, if set, is called with the statistics every Interval until the
+	// Context is done.
+	Report func(Stats)
+
+	// Context stops the reporting of the statistics once it is done.
+	// Defaults to context.Background, so reporting only stops on Shutdown.
+	Context context.Context
+
+	// Now returns the current time. Defaults to time.Now.
+	Now func() time.Time
+}
+
+// StatsFS is the interface implemented by a filesystem that collects
+// statistics of the operations made on it.
+type StatsFS interface {
+	FS
+
+	// Stats returns the statistics collected over the last window.
+	Stats() Stats
+}
+
+// ReadStats returns the statistics collected by the given filesystem. If the
+// filesystem does not implement StatsFS then ErrUnsupported is returned in the
+// *PathError.
+func ReadStats(s FS) (Stats, error) {
+	ss, ok := s.(StatsFS)
+
+	if !ok {
+		return Stats{}, &PathError{Op: "stats", Path: ".", Err: ErrUnsupported}
+	}
+	return ss.Stats(), nil
+}
+
+type opCounters struct {
+	ops     int64
+	errors  int64
+	bytes   int64
+	max     time.Duration
+	latency [latencyBuckets]int64
+}
+
+func latencyBucket(d time.Duration) int {
+	us := d.Microseconds()
+
+	i := 0
+
+	for us > 1 && i < latencyBuckets-1 {
+		us = (us + 1) / 2
+		i++
+	}
+	return i
+}
+
+// percentile returns the upper bound of the bucket the given percentile of
+// latencies fall in, capped to the maximum latency.
+func (c *opCounters) percentile(p float64) time.Duration {
+	if c.ops == 0 {
+		return 0
+	}
+
+	rank := int64(float64(c.ops-1)*p) + 1
+
+	var seen int64
+
+	for i, n := range c.latency {
+		seen += n
+
+		if seen >= rank {
+			d := time.Duration(1<<i) * time.Microsecond
+
+			if d > c.max {
+				d = c.max
+			}
+			return d
+		}
+	}
+	return c.max
+}
+
+func (c *opCounters) add(other *opCounters) {
+	c.ops += other.ops
+	c.errors += other.errors
+	c.bytes += other.bytes
+
+	if other.max > c.max {
+		c.max = other.max
+	}
+
+	for i, n := range other.latency {
+		c.latency[i] += n
+	}
+}
+
+type statsSlot struct {
+	start time.Time
+	ops   map[string]*opCounters
+}
+
+// statsState is the statistics of a filesystem, shared with all of its sub
+// filesystems.
+type statsState struct {
+	window time.Duration
+	width  time.Duration // The duration of each slot.
+	now    func() time.Time
+
+	mu       sync.Mutex
+	slots    [statsSlots]statsSlot
+	inflight map[string]int64
+
+	report func(Stats)
+	stop   chan struct{}
+	once   sync.Once
+}
+
+// begin records the start of an operation, and returns when it started.
+func (s *statsState) begin(op string) time.Time {
+	s.mu.Lock()
+	s.inflight[op]++
+	s.mu.Unlock()
+
+	return s.now()
+}
+
+func (s *statsState) record(op string, d time.Duration, n int64, err error) {
+	start := s.now().Truncate(s.width)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.inflight[op]--
+
+	slot := &s.slots[int(start.UnixNano()/int64(s.width))%statsSlots]
+
+	if !slot.start.Equal(start) {
+		slot.start = start
+		slot.ops = make(map[string]*opCounters)
+	}
+
+	c, ok := slot.ops[op]
+
+	if !ok {
+		c = &opCounters{}
+		slot.ops[op] = c
+	}
+
+	c.ops++
+	c.bytes += n
+
+	if err != nil {
+		c.errors++
+	}
+
+	if d > c.max {
+		c.max = d
+	}
+	c.latency[latencyBucket(d)]++
+}
+
+func (s *statsState) snapshot() Stats {
+	since := s.now().Add(-s.window)
+
+	totals := make(map[string]*opCounters)
+
+	s.mu.Lock()
+
+	for _, slot := range s.slots {
+		if !slot.start.After(since) {
+			continue
+		}
+
+		for op, c := range slot.ops {
+			total, ok := totals[op]
+
+			if !ok {
+				total = &opCounters{}
+				totals[op] = total
+			}
+			total.add(c)
+		}
+	}
+
+	s.mu.Unlock()
+
+	stats := Stats{
+		Window: s.window,
+		Ops:    make(map[string]OpStats, len(totals)),
+	}
+
+	for op, c := range totals {
+		stats.Ops[op] = OpStats{
+			Ops:    c.ops,
+			Errors: c.errors,
+			Bytes:  c.bytes,
+			P50:    c.percentile(0.5),
+			P99:    c.percentile(0.99),
+			Max:    c.max,
+		}
+	}
+	return stats
+}
+
+type statsFS struct {
+	FS
+
+	state *statsState
+}
+
+// Instrument returns a filesystem that collects statistics of the operations
+// made on the given filesystem, over a rolling window. The statistics are
+// returned from the Stats method, and can be pushed to a callback on an
+// interval via the config, for applications that do not otherwise collect
+// metrics. Sub filesystems share the statistics of their parent.
+func Instrument(s FS, cfg StatsConfig) FS {
+	if cfg.Window <= 0 {
+		cfg.Window = time.Minute
+	}
+
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+
+	if cfg.Context == nil {
+		cfg.Context = context.Background()
+	}
+
+	state := &statsState{
+		window:   cfg.Window,
+		width:    cfg.Window / statsSlots,
+		now:      cfg.Now,
+		inflight: make(map[string]int64),
+		report:   cfg.Report,
+		stop:     make(chan struct{}),
+	}
+
+	if state.width <= 0 {
+		state.width = 1
+	}
+
+	if cfg.Report != nil && cfg.Interval > 0 {
+		go func() {
+			t := time.NewTicker(cfg.Interval)
+			defer t.Stop()
+
+			for {
+				select {
+				case <-cfg.Context.Done():
+					return
+				case <-state.stop:
+					return
+				case <-t.C:
+					cfg.Report(state.snapshot())
+				}
+			}
+		}()
+	}
+
+	ss := &statsFS{
+		FS:    s,
+		state: state,
+	}
+
+	if canRename(s) {
+		return renameStatsFS{statsFS: ss}
+	}
+	return ss
+}
+
+// renameStatsFS is a statsFS over a filesystem that implements RenameFS.
+type renameStatsFS struct {
+	*statsFS
+}
+
+func (s *statsFS) Unwrap() FS { return s.FS }
+
+func (s *statsFS) Stats() Stats {
+	return s.state.snapshot()
+}
+
+// Shutdown stops the reporting of the statistics, and reports them one last
+// time.
+func (s *statsFS) Shutdown(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.state.once.Do(func() {
+		close(s.state.stop)
+
+		if s.state.report != nil {
+			s.state.report(s.state.snapshot())
+		}
+	})
+	return nil
+}
+
+// Debug returns the number of each operation in flight, along with the
+// statistics collected over the last window.
+func (s *statsFS) Debug() map[string]any {
+	s.state.mu.Lock()
+
+	inflight := make(map[string]int64, len(s.state.inflight))
+
+	for op, n := range s.state.inflight {
+		if n > 0 {
+			inflight[op] = n
+		}
+	}
+
+	s.state.mu.Unlock()
+
+	return map[string]any{
+		"in_flight": inflight,
+		"stats":     s.state.snapshot(),
+	}
+}
+
+// observe records the duration of the operation since start.
+func (s *statsFS) observe(op string, start time.Time, n int64, err error) {
+	s.state.record(op, s.state.now().Sub(start), n, err)
+}
+
+type statsFile struct {
+	File
+
+	fs *statsFS
+}
+
+func (f *statsFile) Read(p []byte) (int, error) {
+	start := f.fs.state.begin("read")
+
+	n, err := f.File.Read(p)
+
+	if err == io.EOF {
+		f.fs.observe("read", start, int64(n), nil)
+	} else {
+		f.fs.observe("read", start, int64(n), err)
+	}
+	return n, err
+}
+
+func (s *statsFS) Open(name string) (File, error) {
+	start := s.state.begin("open")
+
+	f, err := s.FS.Open(name)
+
+	s.observe("open", start, 0, err)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &statsFile{
+		File: f,
+		fs:   s,
+	}, nil
+}
+
+func (s *statsFS) Sub(dir string) (FS, error) {
+	sub, err := s.FS.Sub(dir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	ss := &statsFS{
+		FS:    sub,
+		state: s.state,
+	}
+
+	if canRename(sub) {
+		return renameStatsFS{statsFS: ss}, nil
+	}
+	return ss, nil
+}
+
+func (s *statsFS) Stat(name string) (FileInfo, error) {
+	start := s.state.begin("stat")
+
+	info, err := s.FS.Stat(name)
+
+	s.observe("stat", start, 0, err)
+	return info, err
+}
+
+func (s *statsFS) Put(f File) (File, error) {
+	start := s.state.begin("put")
+
+	stored, err := s.FS.Put(f)
+
+	var n int64
+
+	if err == nil {
+		if info, err := stored.Stat(); err == nil {
+			n = info.Size()
+		}
+	}
+
+	s.observe("put", start, n, err)
+	return stored, err
+}
+
+func (s *statsFS) ReadDir(name string) ([]DirEntry, error) {
+	start := s.state.begin("readdir")
+
+	ents, err := ReadDir(s.FS, name)
+
+	s.observe("readdir", start, 0, err)
+	return ents, err
+}
+
+func (s renameStatsFS) Rename(oldname, newname string) error {
+	start := s.state.begin("rename")
+
+	err := Move(s.FS, oldname, newname)
+
+	s.observe("rename", start, 0, err)
+	return err
+}
+
+func (s *statsFS) Link(oldname, newname string) error {
+	start := s.state.begin("link")
+
+	err := Link(s.FS, oldname, newname)
+
+	s.observe("link", start, 0, err)
+	return err
+}
+
+func (s *statsFS) Metadata(name string) (Metadata, error) {
+	start := s.state.begin("metadata")
+
+	md, err := GetMetadata(s.FS, name)
+
+	s.observe("metadata", start, 0, err)
+	return md, err
+}
+
+func (s *statsFS) SetMetadata(name string, md Metadata) error {
+	start := s.state.begin("setmetadata")
+
+	err := SetMetadata(s.FS, name, md)
+
+	s.observe("setmetadata", start, 0, err)
+	return err
+}
+
+func (s *statsFS) Remove(name string) error {
+	start := s.state.begin("remove")
+
+	err := s.FS.Remove(name)
+
+	s.observe("remove", start, 0, err)
+	return err
+}
@@ -0,0 +1,106 @@
+package fs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_Instrument(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	if err := os.WriteFile(filepath.Join(dir, "file"), []byte("data"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+
+	store := Instrument(New(dir), StatsConfig{
+		Window: time.Minute,
+		Now: func() time.Time {
+			now = now.Add(time.Millisecond)
+			return now
+		},
+	})
+
+	for i := 0; i < 3; i++ {
+		if s := readAll(t, store, "file"); s != "data" {
+			t.Fatalf("unexpected content, expected=%q, got=%q\n", "data", s)
+		}
+	}
+
+	if _, err := store.Open("missing"); !errors.Is(err, ErrNotExist) {
+		t.Fatalf("unexpected error, expected=%v, got=%v\n", ErrNotExist, err)
+	}
+
+	stats, err := ReadStats(store)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	open := stats.Ops["open"]
+
+	if open.Ops != 4 || open.Errors != 1 {
+		t.Fatalf("unexpected open stats, expected=%d/%d, got=%d/%d\n", 4, 1, open.Ops, open.Errors)
+	}
+
+	if rate := open.ErrorRate(); rate != 0.25 {
+		t.Fatalf("unexpected error rate, expected=%v, got=%v\n", 0.25, rate)
+	}
+
+	if open.P99 != time.Millisecond {
+		t.Fatalf("unexpected p99, expected=%v, got=%v\n", time.Millisecond, open.P99)
+	}
+
+	if read := stats.Ops["read"]; read.Bytes != 12 || read.Errors != 0 {
+		t.Fatalf("unexpected read stats, expected=%d/%d, got=%d/%d\n", 12, 0, read.Bytes, read.Errors)
+	}
+
+	now = now.Add(2 * time.Minute)
+
+	if stats := store.(StatsFS).Stats(); len(stats.Ops) != 0 {
+		t.Fatalf("unexpected stats, expected none, got=%v\n", stats.Ops)
+	}
+}
+
+func Test_InstrumentReport(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	reports := make(chan Stats, 1)
+
+	store := Instrument(Null(), StatsConfig{
+		Interval: time.Millisecond,
+		Context:  ctx,
+		Report: func(s Stats) {
+			select {
+			case reports <- s:
+			default:
+			}
+		},
+	})
+
+	f, err := store.Open("file")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	io.Copy(io.Discard, f)
+	f.Close()
+
+	select {
+	case stats := <-reports:
+		if stats.Ops["open"].Ops != 1 {
+			t.Fatalf("unexpected opens, expected=%d, got=%d\n", 1, stats.Ops["open"].Ops)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for report")
+	}
+}
@@ -0,0 +1,87 @@
+package fs
+
+import (
+	"errors"
+	iofs "io/fs"
+	"os"
+	"runtime"
+	"strings"
+)
+
+// Strict configures the FS to only accept names that are valid as per
+// io/fs.ValidPath, so absolute names, names containing "." or ".." elements,
+// and empty names are rejected with ErrInvalid. On Windows, names containing
+// a backslash or colon are also rejected. Directories are not created via
+// Sub, and ErrNotExist is returned instead if they do not exist. This is the
+// same as the semantics of os.DirFS, and should be used when names come from
+// untrusted input, such as request paths.
+//
+// Strict does not prevent names from resolving outside of the root via
+// symbolic links within it.
+func Strict() Option {
+	return func(s *filesystem) {
+		s.strict = true
+	}
+}
+
+// NewStrict returns a new FS for the operating system's filesystem configured
+// via Strict. Unlike New, the given directory must already exist.
+func NewStrict(dir string, opts ...Option) (FS, error) {
+	if err := isDir(dir); err != nil {
+		return nil, &PathError{Op: "new", Path: dir, Err: err}
+	}
+	return New(dir, append(opts, Strict())...), nil
+}
+
+// strictPath reports whether the given name is valid for Strict.
+func strictPath(name string) bool {
+	if !iofs.ValidPath(name) {
+		return false
+	}
+	return runtime.GOOS != "windows" || !strings.ContainsAny(name, `\:`)
+}
+
+// check returns ErrInvalid if any of the given names are not valid, either
+// because the FS is strict, or because they cannot be used on Windows.
+func (s filesystem) check(names ...string) error {
+	if err := s.checkStrict(names...); err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		if err := checkName(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkStrict returns ErrInvalid if the FS is strict, and any of the given
+// names are not valid.
+func (s filesystem) checkStrict(names ...string) error {
+	if !s.strict {
+		return nil
+	}
+
+	for _, name := range names {
+		if !strictPath(name) {
+			return ErrInvalid
+		}
+	}
+	return nil
+}
+
+// isDir returns nil if the given path is an existing directory, otherwise
+// ErrNotExist, or the error from os.Stat.
+func isDir(path string) error {
+	info, err := os.Stat(path)
+
+	if err != nil {
+		return errors.Unwrap(err)
+	}
+
+	if !info.IsDir() {
+		return ErrNotExist
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package fs
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_NewStrict(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	if _, err := NewStrict(filepath.Join(dir, "missing")); !errors.Is(err, ErrNotExist) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", ErrNotExist, err)
+	}
+
+	store, err := NewStrict(dir)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, name := range []string{"", "/etc/passwd", "../file", "a/../file", "./file", "a//b", "a/"} {
+		if _, err := store.Open(name); !errors.Is(err, ErrInvalid) {
+			t.Fatalf("names[%d] - unexpected error for %q, expected=%q, got=%v\n", i, name, ErrInvalid, err)
+		}
+	}
+
+	if _, err := store.Sub("sub"); !errors.Is(err, ErrNotExist) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", ErrNotExist, err)
+	}
+
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0750); err != nil {
+		t.Fatal(err)
+	}
+
+	sub, err := store.Sub("sub")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := ReadFile("file", bytes.NewReader([]byte("data")))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := sub.Put(f)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored.Close()
+
+	if _, err := store.Stat("sub/file"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Move(store, "sub/file", "../escaped"); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", ErrInvalid, err)
+	}
+}
@@ -0,0 +1,552 @@
+// Package swarm distributes large files between the nodes of a fleet, that
+// share the same store, in pieces, so each node fetches most of a file from
+// its peers rather than from the store.
+//
+// A Manifest of the hash of each piece of a file is created once the file is
+// put into the store, for example,
+//
+//	if _, err := swarm.Create(store, "images/base.img", swarm.DefaultPieceSize); err != nil {
+//		return err
+//	}
+//
+// Each node serves the files it has with a Handler, and fetches the files it
+// needs with a Fetcher, which fetches each piece from its peers, and falls
+// back to the store for pieces no peer has. A Handler only serves files that
+// have a Manifest, which Fetch puts alongside each file it fetches,
+//
+//	http.Handle("/swarm/", http.StripPrefix("/swarm", swarm.Handler(local)))
+//
+//	m, err := swarm.ReadManifest(store, "images/base.img")
+//
+//	if err != nil {
+//		return err
+//	}
+//
+//	f := swarm.NewFetcher(store, []string{"http://node-2/swarm", "http://node-3/swarm"})
+//
+//	img, err := f.Fetch(ctx, m, local)
+//
+// Every piece is checked against its hash, so a peer cannot serve a corrupt
+// file.
+package swarm
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andrewpillar/fs"
+)
+
+// DefaultPieceSize is the size of the pieces of a file if none is given.
+const DefaultPieceSize = 4 << 20
+
+// ManifestExt is the extension added to the name of a file to name its
+// Manifest in the store.
+const ManifestExt = ".pieces.json"
+
+// ChecksumError is returned when a piece does not match its hash.
+type ChecksumError struct {
+	Piece int
+}
+
+func (e ChecksumError) Error() string {
+	return "piece " + strconv.Itoa(e.Piece) + " is corrupt"
+}
+
+// Manifest is the hash of each piece of a file.
+type Manifest struct {
+	Name      string   `json:"name"`
+	Size      int64    `json:"size"`
+	PieceSize int64    `json:"piece_size"`
+	Pieces    []string `json:"pieces"`
+}
+
+// piece returns the offset and length of the given piece.
+func (m *Manifest) piece(i int) (int64, int64) {
+	off := int64(i) * m.PieceSize
+	n := m.PieceSize
+
+	if off+n > m.Size {
+		n = m.Size - off
+	}
+	return off, n
+}
+
+func (m *Manifest) check(i int, b []byte) error {
+	sum := sha256.Sum256(b)
+
+	if hex.EncodeToString(sum[:]) != m.Pieces[i] {
+		return ChecksumError{Piece: i}
+	}
+	return nil
+}
+
+// Create hashes each piece of the named file in the given store, and puts the
+// Manifest alongside it, named after the file with ManifestExt appended.
+func Create(s fs.FS, name string, pieceSize int64) (*Manifest, error) {
+	if pieceSize <= 0 {
+		pieceSize = DefaultPieceSize
+	}
+
+	f, err := s.Open(name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	m := &Manifest{
+		Name:      name,
+		PieceSize: pieceSize,
+	}
+
+	buf := make([]byte, pieceSize)
+
+	for {
+		n, err := io.ReadFull(f, buf)
+
+		if n > 0 {
+			sum := sha256.Sum256(buf[:n])
+
+			m.Pieces = append(m.Pieces, hex.EncodeToString(sum[:]))
+			m.Size += int64(n)
+		}
+
+		if err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				break
+			}
+			return nil, err
+		}
+	}
+
+	if err := putManifest(s, m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// putManifest puts the given Manifest in the given store alongside its file.
+func putManifest(s fs.FS, m *Manifest) error {
+	b, err := json.Marshal(m)
+
+	if err != nil {
+		return err
+	}
+
+	f, err := fs.ReadFile(path.Base(m.Name)+ManifestExt, bytes.NewReader(b))
+
+	if err != nil {
+		return err
+	}
+
+	defer fs.Cleanup(f)
+
+	stored, err := fs.PutPath(s, m.Name+ManifestExt, f)
+
+	if err != nil {
+		return err
+	}
+	return stored.Close()
+}
+
+// ReadManifest returns the Manifest of the named file in the given store.
+func ReadManifest(s fs.FS, name string) (*Manifest, error) {
+	f, err := s.Open(name + ManifestExt)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	var m Manifest
+
+	if err := json.NewDecoder(f).Decode(&m); err != nil {
+		return nil, &fs.PathError{Op: "swarm", Path: name + ManifestExt, Err: err}
+	}
+
+	if m.Size < 0 || m.PieceSize <= 0 {
+		return nil, &fs.PathError{Op: "swarm", Path: name + ManifestExt, Err: fs.ErrInvalid}
+	}
+
+	// Counted without adding the sizes, so a manifest with a large size
+	// cannot overflow.
+	pieces := m.Size / m.PieceSize
+
+	if m.Size%m.PieceSize != 0 {
+		pieces++
+	}
+
+	if int64(len(m.Pieces)) != pieces {
+		return nil, &fs.PathError{Op: "swarm", Path: name + ManifestExt, Err: fs.ErrInvalid}
+	}
+	return &m, nil
+}
+
+// readAt reads n bytes at the given offset of the file.
+func readAt(f fs.File, off, n int64) ([]byte, error) {
+	r, err := section(f, off, n)
+
+	if err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, n)
+
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+type handler struct {
+	fs fs.FS
+}
+
+// Handler returns a handler that serves the pieces of the files in the given
+// FS to peers, requested as /<name>?piece=<n>. Only files with a Manifest are
+// served, and the size of each piece is taken from the Manifest.
+func Handler(s fs.FS) http.Handler {
+	return &handler{fs: s}
+}
+
+func httpError(w http.ResponseWriter, status int) {
+	http.Error(w, http.StatusText(status), status)
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		httpError(w, http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, "/")
+
+	if name == "." || !fs.ValidPath(name) {
+		httpError(w, http.StatusBadRequest)
+		return
+	}
+
+	piece, err := strconv.ParseInt(r.URL.Query().Get("piece"), 10, 64)
+
+	if err != nil || piece < 0 {
+		httpError(w, http.StatusBadRequest)
+		return
+	}
+
+	m, err := ReadManifest(h.fs, name)
+
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			httpError(w, http.StatusNotFound)
+			return
+		}
+		httpError(w, http.StatusInternalServerError)
+		return
+	}
+
+	if piece >= int64(len(m.Pieces)) {
+		httpError(w, http.StatusRequestedRangeNotSatisfiable)
+		return
+	}
+
+	f, err := h.fs.Open(name)
+
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			httpError(w, http.StatusNotFound)
+			return
+		}
+		httpError(w, http.StatusInternalServerError)
+		return
+	}
+
+	defer f.Close()
+
+	info, err := f.Stat()
+
+	if err != nil {
+		httpError(w, http.StatusInternalServerError)
+		return
+	}
+
+	// The file does not match its manifest, so this peer does not have the
+	// file that was asked for.
+	if info.Size() != m.Size {
+		httpError(w, http.StatusNotFound)
+		return
+	}
+
+	off, n := m.piece(int(piece))
+
+	r2, err := section(f, off, n)
+
+	if err != nil {
+		httpError(w, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.FormatInt(n, 10))
+
+	io.CopyN(w, r2, n)
+}
+
+// section returns a reader of the n bytes at the given offset of the file,
+// using io.ReaderAt or io.Seeker if the file implements them.
+func section(f fs.File, off, n int64) (io.Reader, error) {
+	if ra, ok := f.(io.ReaderAt); ok {
+		return io.NewSectionReader(ra, off, n), nil
+	}
+
+	if sk, ok := f.(io.Seeker); ok {
+		if _, err := sk.Seek(off, io.SeekStart); err != nil {
+			return nil, err
+		}
+	} else if _, err := io.CopyN(io.Discard, f, off); err != nil {
+		return nil, err
+	}
+	return io.LimitReader(f, n), nil
+}
+
+// Fetcher fetches files from peers, falling back to the store.
+type Fetcher struct {
+	store       fs.FS
+	peers       []string
+	client      *http.Client
+	concurrency int
+}
+
+// Option configures a Fetcher.
+type Option func(*Fetcher)
+
+// WithClient sets the client used to fetch pieces from peers. Defaults to
+// http.DefaultClient.
+func WithClient(c *http.Client) Option {
+	return func(f *Fetcher) {
+		f.client = c
+	}
+}
+
+// Concurrency sets the number of pieces fetched at once. Defaults to 4.
+func Concurrency(n int) Option {
+	return func(f *Fetcher) {
+		if n > 0 {
+			f.concurrency = n
+		}
+	}
+}
+
+// NewFetcher returns a Fetcher that fetches pieces from the given peers, which
+// are the base URLs of their Handlers, and from the given store for pieces
+// none of the peers have.
+func NewFetcher(store fs.FS, peers []string, opts ...Option) *Fetcher {
+	f := &Fetcher{
+		store:       store,
+		peers:       peers,
+		client:      http.DefaultClient,
+		concurrency: 4,
+	}
+
+	for _, opt := range opts {
+		opt(f)
+	}
+	return f
+}
+
+// fromPeer fetches the given piece from the given peer.
+func (f *Fetcher) fromPeer(ctx context.Context, peer string, m *Manifest, i int) ([]byte, error) {
+	parts := strings.Split(m.Name, "/")
+
+	for j, part := range parts {
+		parts[j] = url.PathEscape(part)
+	}
+
+	target := strings.TrimSuffix(peer, "/") + "/" + strings.Join(parts, "/") + "?piece=" + strconv.Itoa(i)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := f.client.Do(req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("swarm: %s: unexpected status %s", peer, resp.Status)
+	}
+
+	_, n := m.piece(i)
+
+	b, err := io.ReadAll(io.LimitReader(resp.Body, n+1))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(b)) != n {
+		return nil, ChecksumError{Piece: i}
+	}
+
+	if err := m.check(i, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// fromStore fetches the given piece from the store.
+func (f *Fetcher) fromStore(m *Manifest, i int) ([]byte, error) {
+	file, err := f.store.Open(m.Name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	off, n := m.piece(i)
+
+	b, err := readAt(file, off, n)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := m.check(i, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// fetch fetches the given piece, trying each peer in turn, starting with a
+// different peer for each piece to spread the load, before the store.
+func (f *Fetcher) fetch(ctx context.Context, m *Manifest, i int) ([]byte, error) {
+	for j := range f.peers {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		peer := f.peers[(i+j)%len(f.peers)]
+
+		if b, err := f.fromPeer(ctx, peer, m, i); err == nil {
+			return b, nil
+		}
+	}
+	return f.fromStore(m, i)
+}
+
+// Fetch fetches the file described by the given Manifest, and puts it into the
+// given FS under its name along with the Manifest, so it can in turn be served
+// to peers. The pieces are written to a temporary file on disk until every
+// piece has been fetched.
+func (f *Fetcher) Fetch(ctx context.Context, m *Manifest, dst fs.FS) (fs.File, error) {
+	tmp, err := os.CreateTemp("", "swarm-*")
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if err := tmp.Truncate(m.Size); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	pieces := make(chan int)
+
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		first error
+	)
+
+	for w := 0; w < f.concurrency; w++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for i := range pieces {
+				b, err := f.fetch(ctx, m, i)
+
+				if err == nil {
+					off, _ := m.piece(i)
+					_, err = tmp.WriteAt(b, off)
+				}
+
+				if err != nil {
+					mu.Lock()
+
+					if first == nil {
+						first = fmt.Errorf("swarm: %s: piece %d: %w", m.Name, i, err)
+					}
+					mu.Unlock()
+
+					cancel()
+				}
+			}
+		}()
+	}
+
+loop:
+	for i := range m.Pieces {
+		select {
+		case pieces <- i:
+		case <-ctx.Done():
+			break loop
+		}
+	}
+
+	close(pieces)
+	wg.Wait()
+
+	if first != nil {
+		return nil, first
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	stored, err := fs.PutPath(dst, m.Name, fs.Rename(tmp, path.Base(m.Name)))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := putManifest(dst, m); err != nil {
+		stored.Close()
+		return nil, err
+	}
+	return stored, nil
+}
@@ -0,0 +1,236 @@
+package swarm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/andrewpillar/fs"
+	"github.com/andrewpillar/fs/fakefs"
+)
+
+func put(t *testing.T, s fs.FS, name, content string) {
+	f, err := fs.ReadFile(name, bytes.NewReader([]byte(content)))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := fs.PutPath(s, name, f)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored.Close()
+}
+
+func read(t *testing.T, s fs.FS, name string) string {
+	f, err := s.Open(name)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	b, err := io.ReadAll(f)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+const content = "the quick brown fox jumps over the lazy dog"
+
+func Test_Create(t *testing.T) {
+	store := fakefs.New()
+
+	put(t, store, "images/base.img", content)
+
+	m, err := Create(store, "images/base.img", 8)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Size != int64(len(content)) {
+		t.Fatalf("unexpected size, expected=%d, got=%d\n", len(content), m.Size)
+	}
+
+	if len(m.Pieces) != 6 {
+		t.Fatalf("unexpected pieces, expected=%d, got=%d\n", 6, len(m.Pieces))
+	}
+
+	m2, err := ReadManifest(store, "images/base.img")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range m.Pieces {
+		if m.Pieces[i] != m2.Pieces[i] {
+			t.Fatalf("pieces[%d] - unexpected hash, expected=%q, got=%q\n", i, m.Pieces[i], m2.Pieces[i])
+		}
+	}
+}
+
+func Test_Fetch(t *testing.T) {
+	store := fakefs.New()
+
+	put(t, store, "images/base.img", content)
+
+	m, err := Create(store, "images/base.img", 8)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seed := fakefs.New()
+	put(t, seed, "images/base.img", content)
+
+	if _, err := Create(seed, "images/base.img", 8); err != nil {
+		t.Fatal(err)
+	}
+
+	bad := fakefs.New()
+	put(t, bad, "images/base.img", "THE QUICK BROWN FOX JUMPS OVER THE LAZY DOG")
+
+	if _, err := Create(bad, "images/base.img", 8); err != nil {
+		t.Fatal(err)
+	}
+
+	srv1 := httptest.NewServer(Handler(seed))
+	defer srv1.Close()
+
+	srv2 := httptest.NewServer(Handler(bad))
+	defer srv2.Close()
+
+	// The store is unavailable, so every piece must come from the good peer.
+	store.Fail("open", "images/base.img", fs.ErrPermission)
+
+	dst := fakefs.New()
+
+	f, err := NewFetcher(store, []string{srv2.URL, srv1.URL, "http://127.0.0.1:0"}, Concurrency(2)).Fetch(context.Background(), m, dst)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	if got := read(t, dst, "images/base.img"); got != content {
+		t.Fatalf("unexpected content, expected=%q, got=%q\n", content, got)
+	}
+
+	// The fetched file can in turn be served to other peers.
+	srv3 := httptest.NewServer(Handler(dst))
+	defer srv3.Close()
+
+	dst2 := fakefs.New()
+
+	f, err = NewFetcher(store, []string{srv3.URL}).Fetch(context.Background(), m, dst2)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	if got := read(t, dst2, "images/base.img"); got != content {
+		t.Fatalf("unexpected content, expected=%q, got=%q\n", content, got)
+	}
+}
+
+func Test_FetchStore(t *testing.T) {
+	store := fakefs.New()
+
+	put(t, store, "base.img", content)
+
+	m, err := Create(store, "base.img", 16)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dst := fakefs.New()
+
+	f, err := NewFetcher(store, nil).Fetch(context.Background(), m, dst)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	if got := read(t, dst, "base.img"); got != content {
+		t.Fatalf("unexpected content, expected=%q, got=%q\n", content, got)
+	}
+
+	// A corrupt store fails the fetch rather than storing a corrupt file.
+	put(t, store, "base.img", "THE QUICK BROWN FOX JUMPS OVER THE LAZY DOG")
+
+	dst = fakefs.New()
+
+	if _, err := NewFetcher(store, nil).Fetch(context.Background(), m, dst); !errors.As(err, &ChecksumError{}) {
+		t.Fatalf("unexpected error, expected=%T, got=%v\n", ChecksumError{}, err)
+	}
+
+	if _, err := dst.Stat("base.img"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", fs.ErrNotExist, err)
+	}
+}
+
+func Test_Handler(t *testing.T) {
+	store := fakefs.New()
+
+	put(t, store, "base.img", content)
+	put(t, store, "secret.txt", "hunter2")
+
+	if _, err := Create(store, "base.img", 16); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(Handler(store))
+	defer srv.Close()
+
+	tests := []struct {
+		target string
+		status int
+		body   string
+	}{
+		{"/base.img?piece=0", http.StatusOK, content[:16]},
+		{"/base.img?piece=2", http.StatusOK, content[32:]},
+		{"/base.img?piece=2&size=1073741824", http.StatusOK, content[32:]},
+		{"/base.img?piece=3", http.StatusRequestedRangeNotSatisfiable, ""},
+		{"/base.img?piece=9223372036854775807", http.StatusRequestedRangeNotSatisfiable, ""},
+		{"/base.img?piece=-1", http.StatusBadRequest, ""},
+		{"/base.img", http.StatusBadRequest, ""},
+		{"/secret.txt?piece=0", http.StatusNotFound, ""},
+		{"/missing.img?piece=0", http.StatusNotFound, ""},
+	}
+
+	for i, test := range tests {
+		resp, err := http.Get(srv.URL + test.target)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if resp.StatusCode != test.status {
+			t.Fatalf("tests[%d] - unexpected status, expected=%d, got=%d\n", i, test.status, resp.StatusCode)
+		}
+
+		if test.status == http.StatusOK && string(b) != test.body {
+			t.Fatalf("tests[%d] - unexpected body, expected=%q, got=%q\n", i, test.body, string(b))
+		}
+	}
+}
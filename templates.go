@@ -0,0 +1,174 @@
+package fs
+
+import (
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+	"time"
+)
+
+// TemplateSet is a set of templates parsed from the files in a filesystem.
+// The templates are parsed again when the files change, so they can be edited
+// in place. It is safe for concurrent use.
+type TemplateSet struct {
+	fs      fs.FS
+	pattern string
+	funcs   map[string]any
+	every   time.Duration
+
+	mu      sync.Mutex
+	checked time.Time
+	stamp   string
+	html    *htmltemplate.Template
+	text    *texttemplate.Template
+}
+
+// Templates returns a TemplateSet of the files in the given filesystem that
+// match the given pattern, which has the syntax of path.Match, for example,
+//
+//	tmpls := fs.Templates(store, "views/*.html").Funcs(funcs)
+//
+//	t, err := tmpls.HTML()
+//
+//	if err != nil {
+//		return err
+//	}
+//	return t.ExecuteTemplate(w, "index.html", data)
+//
+// The filesystem must implement ReadDirFS for the pattern to be matched. The
+// files are checked for changes at most every five seconds, which can be
+// changed with CheckEvery.
+func Templates(s FS, pattern string) *TemplateSet {
+	return &TemplateSet{
+		fs:      ToIOFS(s),
+		pattern: pattern,
+		every:   5 * time.Second,
+	}
+}
+
+// Funcs sets the functions available to the templates. This should be called
+// before the templates are first parsed.
+func (t *TemplateSet) Funcs(funcs map[string]any) *TemplateSet {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.funcs = funcs
+	return t
+}
+
+// CheckEvery sets how often the files are checked for changes. A duration of
+// zero checks the files each time the templates are used.
+func (t *TemplateSet) CheckEvery(d time.Duration) *TemplateSet {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.every = d
+	return t
+}
+
+// check checks whether the files have changed since the templates were last
+// parsed, and drops the parsed templates if so. It returns the names of the
+// files. This should be called with the mutex held.
+func (t *TemplateSet) check() ([]string, error) {
+	names, err := fs.Glob(t.fs, t.pattern)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(names) == 0 {
+		return nil, &PathError{Op: "templates", Path: t.pattern, Err: ErrNotExist}
+	}
+
+	var b strings.Builder
+
+	for _, name := range names {
+		info, err := fs.Stat(t.fs, name)
+
+		if err != nil {
+			return nil, err
+		}
+
+		b.WriteString(name)
+		b.WriteByte(' ')
+		b.WriteString(strconv.FormatInt(info.Size(), 10))
+		b.WriteByte(' ')
+		b.WriteString(strconv.FormatInt(info.ModTime().UnixNano(), 10))
+		b.WriteByte('\n')
+	}
+
+	if stamp := b.String(); stamp != t.stamp {
+		t.stamp = stamp
+		t.html = nil
+		t.text = nil
+	}
+
+	t.checked = time.Now()
+	return names, nil
+}
+
+// stale reports whether the files should be checked for changes. This should
+// be called with the mutex held.
+func (t *TemplateSet) stale() bool {
+	return t.stamp == "" || time.Since(t.checked) >= t.every
+}
+
+// HTML returns the templates parsed with html/template. The first file that
+// matched the pattern is the template returned, and the others are associated
+// with it.
+func (t *TemplateSet) HTML() (*htmltemplate.Template, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.html != nil && !t.stale() {
+		return t.html, nil
+	}
+
+	names, err := t.check()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if t.html == nil {
+		tmpl, err := htmltemplate.New(path.Base(names[0])).Funcs(t.funcs).ParseFS(t.fs, names...)
+
+		if err != nil {
+			return nil, err
+		}
+		t.html = tmpl
+	}
+	return t.html, nil
+}
+
+// Text returns the templates parsed with text/template. The first file that
+// matched the pattern is the template returned, and the others are associated
+// with it.
+func (t *TemplateSet) Text() (*texttemplate.Template, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.text != nil && !t.stale() {
+		return t.text, nil
+	}
+
+	names, err := t.check()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if t.text == nil {
+		tmpl, err := texttemplate.New(path.Base(names[0])).Funcs(t.funcs).ParseFS(t.fs, names...)
+
+		if err != nil {
+			return nil, err
+		}
+		t.text = tmpl
+	}
+	return t.text, nil
+}
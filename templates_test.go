@@ -0,0 +1,129 @@
+package fs
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_ToIOFS(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"a/one.txt", "a/two.txt", "b/three.md"} {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(p, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fsys := ToIOFS(New(dir))
+
+	matches, err := fs.Glob(fsys, "*/*.txt")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Join(matches, ",") != "a/one.txt,a/two.txt" {
+		t.Fatalf("unexpected matches, expected=%q, got=%q\n", "a/one.txt,a/two.txt", matches)
+	}
+
+	sub, err := fs.Sub(fsys, "b")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := fs.ReadFile(sub, "three.md")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(b) != "b/three.md" {
+		t.Fatalf("unexpected content, expected=%q, got=%q\n", "b/three.md", b)
+	}
+}
+
+func Test_Templates(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	views := filepath.Join(dir, "views")
+
+	if err := os.MkdirAll(views, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(views, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("index.html", `{{template "header.html" .}}<p>{{upper .}}</p>`)
+	write("header.html", `<h1>{{.}}</h1>`)
+
+	tmpls := Templates(New(dir), "views/*.html").CheckEvery(0).Funcs(map[string]any{
+		"upper": strings.ToUpper,
+	})
+
+	render := func() string {
+		tmpl, err := tmpls.HTML()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var buf strings.Builder
+
+		if err := tmpl.ExecuteTemplate(&buf, "index.html", "<hi>"); err != nil {
+			t.Fatal(err)
+		}
+		return buf.String()
+	}
+
+	if s := render(); s != "<h1>&lt;hi&gt;</h1><p>&lt;HI&gt;</p>" {
+		t.Fatalf("unexpected output, expected=%q, got=%q\n", "<h1>&lt;hi&gt;</h1><p>&lt;HI&gt;</p>", s)
+	}
+
+	write("header.html", `<h2>{{.}}</h2>`)
+
+	// Make sure the modification time changes on filesystems with a coarse
+	// resolution.
+	later := time.Now().Add(time.Second)
+	os.Chtimes(filepath.Join(views, "header.html"), later, later)
+
+	if s := render(); s != "<h2>&lt;hi&gt;</h2><p>&lt;HI&gt;</p>" {
+		t.Fatalf("unexpected output, expected=%q, got=%q\n", "<h2>&lt;hi&gt;</h2><p>&lt;HI&gt;</p>", s)
+	}
+
+	text, err := tmpls.Text()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf strings.Builder
+
+	if err := text.ExecuteTemplate(&buf, "header.html", "<hi>"); err != nil {
+		t.Fatal(err)
+	}
+
+	if buf.String() != "<h2><hi></h2>" {
+		t.Fatalf("unexpected output, expected=%q, got=%q\n", "<h2><hi></h2>", buf.String())
+	}
+
+	if _, err := Templates(New(dir), "missing/*.html").HTML(); err == nil {
+		t.Fatalf("expected error for pattern without matches\n")
+	}
+}
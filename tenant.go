@@ -0,0 +1,226 @@
+package fs
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+)
+
+// ErrNoTenant is the error returned when no tenant can be derived from a
+// context.
+var ErrNoTenant = errors.New("no tenant")
+
+type tenantKey struct{}
+
+// WithTenant returns a copy of the given context carrying the given tenant.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// TenantFromContext returns the tenant set on the given context via
+// WithTenant, if any.
+func TenantFromContext(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+	return tenant
+}
+
+// maxTenantSubs is the number of tenant filesystems kept by Tenants, after
+// which the least recently used is dropped, and created again on next use.
+const maxTenantSubs = 1024
+
+// Tenants routes operations into a sub filesystem per tenant, where the tenant
+// is derived from a context.
+type Tenants struct {
+	fs  FS
+	key func(ctx context.Context) string
+
+	mu   sync.Mutex
+	lru  *list.List
+	subs map[string]*list.Element
+}
+
+type tenantSub struct {
+	tenant string
+	fs     FS
+}
+
+// Tenant returns Tenants for the given filesystem, which use the given
+// function to derive the tenant from a context. If the function is nil, then
+// TenantFromContext is used.
+func Tenant(s FS, key func(ctx context.Context) string) *Tenants {
+	if key == nil {
+		key = TenantFromContext
+	}
+
+	return &Tenants{
+		fs:   s,
+		key:  key,
+		lru:  list.New(),
+		subs: make(map[string]*list.Element),
+	}
+}
+
+// validTenant reports whether the given tenant can be used as the name of a
+// single directory, so one tenant cannot reach into the directory of another.
+func validTenant(tenant string) bool {
+	return tenant != "." && ValidPath(tenant) && !strings.ContainsAny(tenant, "/\x00")
+}
+
+// For returns the filesystem for the tenant of the given context. This is a
+// sub filesystem named after the tenant, which only accepts names that are
+// valid as per ValidPath, so a tenant cannot reach out of its directory. The
+// filesystem is created on first use and reused after. If no tenant can be
+// derived from the context then ErrNoTenant is returned, and if the tenant is
+// not a valid directory name then ErrInvalid is returned.
+func (t *Tenants) For(ctx context.Context) (FS, error) {
+	tenant := t.key(ctx)
+
+	if tenant == "" {
+		return nil, &PathError{Op: "tenant", Path: tenant, Err: ErrNoTenant}
+	}
+
+	if !validTenant(tenant) {
+		return nil, &PathError{Op: "tenant", Path: tenant, Err: ErrInvalid}
+	}
+
+	if sub, ok := t.lookup(tenant); ok {
+		return sub, nil
+	}
+
+	sub, err := t.fs.Sub(tenant)
+
+	if err != nil {
+		return nil, err
+	}
+	return t.store(tenant, confine(sub)), nil
+}
+
+func (t *Tenants) lookup(tenant string) (FS, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	el, ok := t.subs[tenant]
+
+	if !ok {
+		return nil, false
+	}
+
+	t.lru.MoveToFront(el)
+	return el.Value.(*tenantSub).fs, true
+}
+
+// store stores the filesystem for the given tenant, unless one was stored
+// whilst it was being created, in which case that is returned instead.
+func (t *Tenants) store(tenant string, s FS) FS {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if el, ok := t.subs[tenant]; ok {
+		t.lru.MoveToFront(el)
+		return el.Value.(*tenantSub).fs
+	}
+
+	t.subs[tenant] = t.lru.PushFront(&tenantSub{
+		tenant: tenant,
+		fs:     s,
+	})
+
+	if t.lru.Len() > maxTenantSubs {
+		el := t.lru.Back()
+
+		t.lru.Remove(el)
+		delete(t.subs, el.Value.(*tenantSub).tenant)
+	}
+	return s
+}
+
+// confined only accepts names that are valid as per ValidPath.
+type confined struct {
+	FS
+}
+
+// renameConfined is confined over a filesystem that implements RenameFS.
+type renameConfined struct {
+	confined
+}
+
+func confine(s FS) FS {
+	c := confined{FS: s}
+
+	if _, ok := s.(RenameFS); ok {
+		return renameConfined{confined: c}
+	}
+	return c
+}
+
+func checkConfined(op string, names ...string) error {
+	for _, name := range names {
+		if !ValidPath(name) {
+			return &PathError{Op: op, Path: name, Err: ErrInvalid}
+		}
+	}
+	return nil
+}
+
+func (s confined) Open(name string) (File, error) {
+	if err := checkConfined("open", name); err != nil {
+		return nil, err
+	}
+	return s.FS.Open(name)
+}
+
+func (s confined) Sub(dir string) (FS, error) {
+	if err := checkConfined("sub", dir); err != nil {
+		return nil, err
+	}
+
+	sub, err := s.FS.Sub(dir)
+
+	if err != nil {
+		return nil, err
+	}
+	return confine(sub), nil
+}
+
+func (s confined) Stat(name string) (FileInfo, error) {
+	if err := checkConfined("stat", name); err != nil {
+		return nil, err
+	}
+	return s.FS.Stat(name)
+}
+
+func (s confined) Put(f File) (File, error) {
+	info, err := f.Stat()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkConfined("put", info.Name()); err != nil {
+		return nil, err
+	}
+	return s.FS.Put(f)
+}
+
+func (s confined) ReadDir(name string) ([]DirEntry, error) {
+	if err := checkConfined("readdir", name); err != nil {
+		return nil, err
+	}
+	return ReadDir(s.FS, name)
+}
+
+func (s confined) Remove(name string) error {
+	if err := checkConfined("remove", name); err != nil {
+		return err
+	}
+	return s.FS.Remove(name)
+}
+
+func (s renameConfined) Rename(oldname, newname string) error {
+	if err := checkConfined("rename", oldname, newname); err != nil {
+		return err
+	}
+	return Move(s.FS, oldname, newname)
+}
@@ -0,0 +1,153 @@
+package fs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func Test_Tenant(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	tenants := Tenant(New(dir), nil)
+
+	for _, tenant := range []string{"acme", "globex"} {
+		store, err := tenants.For(WithTenant(context.Background(), tenant))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		f, err := ReadFile("file", bytes.NewReader([]byte(tenant)))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		stored, err := store.Put(f)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+		stored.Close()
+	}
+
+	for _, tenant := range []string{"acme", "globex"} {
+		b, err := os.ReadFile(filepath.Join(dir, tenant, "file"))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(b) != tenant {
+			t.Fatalf("unexpected content, expected=%q, got=%q\n", tenant, string(b))
+		}
+	}
+}
+
+func Test_TenantInvalid(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	tenants := Tenant(New(dir), nil)
+
+	tests := []struct {
+		tenant string
+		err    error
+	}{
+		{"", ErrNoTenant},
+		{".", ErrInvalid},
+		{"..", ErrInvalid},
+		{"../other", ErrInvalid},
+		{"a/b", ErrInvalid},
+		{`a\b`, ErrInvalid},
+	}
+
+	for i, test := range tests {
+		_, err := tenants.For(WithTenant(context.Background(), test.tenant))
+
+		if !errors.Is(err, test.err) {
+			t.Fatalf("tests[%d] - unexpected error, expected=%q, got=%v\n", i, test.err, err)
+		}
+	}
+}
+
+func Test_TenantEscape(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	if err := os.MkdirAll(filepath.Join(dir, "globex"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "globex", "file"), []byte("globex"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := Tenant(New(dir), nil).For(WithTenant(context.Background(), "acme"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"../globex/file", "/etc/passwd", `..\globex\file`} {
+		if _, err := store.Open(name); !errors.Is(err, ErrInvalid) {
+			t.Fatalf("unexpected error for %q, expected=%q, got=%v\n", name, ErrInvalid, err)
+		}
+
+		if _, err := store.Stat(name); !errors.Is(err, ErrInvalid) {
+			t.Fatalf("unexpected error for %q, expected=%q, got=%v\n", name, ErrInvalid, err)
+		}
+
+		if err := store.Remove(name); !errors.Is(err, ErrInvalid) {
+			t.Fatalf("unexpected error for %q, expected=%q, got=%v\n", name, ErrInvalid, err)
+		}
+
+		if _, err := store.Sub(name); !errors.Is(err, ErrInvalid) {
+			t.Fatalf("unexpected error for %q, expected=%q, got=%v\n", name, ErrInvalid, err)
+		}
+
+		f, err := ReadFile("file", bytes.NewReader([]byte("acme")))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := store.Put(Rename(f, name)); !errors.Is(err, ErrInvalid) {
+			t.Fatalf("unexpected error for %q, expected=%q, got=%v\n", name, ErrInvalid, err)
+		}
+
+		if err := Move(store, "file", name); !errors.Is(err, ErrInvalid) {
+			t.Fatalf("unexpected error for %q, expected=%q, got=%v\n", name, ErrInvalid, err)
+		}
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, "globex", "file"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(b) != "globex" {
+		t.Fatalf("unexpected content, expected=%q, got=%q\n", "globex", string(b))
+	}
+}
+
+func Test_TenantBounded(t *testing.T) {
+	tenants := Tenant(Null(), nil)
+
+	for i := 0; i < maxTenantSubs+10; i++ {
+		if _, err := tenants.For(WithTenant(context.Background(), "tenant"+strconv.Itoa(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n := len(tenants.subs); n != maxTenantSubs {
+		t.Fatalf("unexpected tenants, expected=%d, got=%d\n", maxTenantSubs, n)
+	}
+}
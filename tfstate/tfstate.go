@@ -0,0 +1,329 @@
+// Package tfstate implements the HTTP state backend of Terraform and OpenTofu
+// on top of an FS.
+//
+// The Handler stores the state of each workspace, and its lock, under the path
+// of the request, for example,
+//
+//	http.Handle("/state/", http.StripPrefix("/state/", tfstate.New(store)))
+//
+// with the backend configured as,
+//
+//	terraform {
+//	  backend "http" {
+//	    address        = "https://example.com/state/network"
+//	    lock_address   = "https://example.com/state/network"
+//	    unlock_address = "https://example.com/state/network"
+//	  }
+//	}
+//
+// Locks are held in the FS, though are checked and taken under a mutex in the
+// Handler, so only one Handler should serve the state in an FS.
+package tfstate
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/andrewpillar/fs"
+)
+
+// maxStateSize is the largest state that is accepted.
+const maxStateSize = 64 << 20
+
+// LockInfo is the information about a lock, as sent by the client when the
+// state is locked.
+type LockInfo struct {
+	ID        string
+	Operation string
+	Info      string
+	Who       string
+	Version   string
+	Created   string
+	Path      string
+}
+
+// Handler serves the state in an FS.
+type Handler struct {
+	fs fs.FS
+
+	mu sync.Mutex
+}
+
+// New returns a Handler that stores state in the given FS.
+func New(s fs.FS) *Handler {
+	return &Handler{
+		fs: s,
+	}
+}
+
+// cleanName returns the name of the workspace for the given request path, or
+// false if the path is not a valid name.
+func cleanName(p string) (string, bool) {
+	name := strings.Trim(p, "/")
+
+	if name == "" || name == "." || !fs.ValidPath(name) {
+		return "", false
+	}
+	return name, true
+}
+
+func writeError(w http.ResponseWriter, status int) {
+	http.Error(w, http.StatusText(status), status)
+}
+
+// statusCode returns the HTTP status code for the given error from the FS.
+func statusCode(err error) int {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return http.StatusNotFound
+	case errors.Is(err, fs.ErrPermission):
+		return http.StatusForbidden
+	case errors.Is(err, fs.ErrInvalid):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name, ok := cleanName(r.URL.Path)
+
+	if !ok {
+		writeError(w, http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		h.get(w, name)
+	case http.MethodPost, http.MethodPut:
+		h.update(w, r, name)
+	case http.MethodDelete:
+		h.remove(w, r, name)
+	case "LOCK":
+		h.lock(w, r, name)
+	case "UNLOCK":
+		h.unlock(w, r, name)
+	default:
+		w.Header().Set("Allow", "GET, POST, PUT, DELETE, LOCK, UNLOCK")
+		writeError(w, http.StatusMethodNotAllowed)
+	}
+}
+
+func stateName(name string) string { return name + ".tfstate" }
+func lockName(name string) string  { return name + ".tfstate.lock" }
+
+// readLock returns the lock on the given workspace, or nil if it is not
+// locked.
+func (h *Handler) readLock(name string) (*LockInfo, error) {
+	f, err := h.fs.Open(lockName(name))
+
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	defer f.Close()
+
+	var info LockInfo
+
+	if err := json.NewDecoder(f).Decode(&info); err != nil {
+		return nil, &fs.PathError{Op: "tfstate", Path: lockName(name), Err: err}
+	}
+	return &info, nil
+}
+
+// writeLocked writes the 423 Locked response with the given lock, which the
+// client reports to the user.
+func writeLocked(w http.ResponseWriter, info *LockInfo) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusLocked)
+	json.NewEncoder(w).Encode(info)
+}
+
+// checkLock checks that the given request holds the lock on the workspace, if
+// it is locked. The client sends the ID of the lock it holds in the ID query
+// parameter.
+func (h *Handler) checkLock(w http.ResponseWriter, r *http.Request, name string) bool {
+	info, err := h.readLock(name)
+
+	if err != nil {
+		writeError(w, statusCode(err))
+		return false
+	}
+
+	if info != nil && info.ID != r.URL.Query().Get("ID") {
+		writeLocked(w, info)
+		return false
+	}
+	return true
+}
+
+func (h *Handler) get(w http.ResponseWriter, name string) {
+	f, err := h.fs.Open(stateName(name))
+
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		writeError(w, statusCode(err))
+		return
+	}
+
+	defer f.Close()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+
+	io.Copy(w, f)
+}
+
+func (h *Handler) put(name string, r io.Reader) error {
+	f, err := fs.ReadFile(name, r)
+
+	if err != nil {
+		return err
+	}
+
+	defer fs.Cleanup(f)
+
+	stored, err := fs.PutPath(h.fs, name, f)
+
+	if err != nil {
+		return err
+	}
+	return stored.Close()
+}
+
+func (h *Handler) update(w http.ResponseWriter, r *http.Request, name string) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxStateSize))
+
+	if err != nil {
+		writeError(w, http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	if !json.Valid(body) {
+		writeError(w, http.StatusBadRequest)
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if !h.checkLock(w, r, name) {
+		return
+	}
+
+	if err := h.put(stateName(name), bytes.NewReader(body)); err != nil {
+		writeError(w, statusCode(err))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *Handler) remove(w http.ResponseWriter, r *http.Request, name string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if !h.checkLock(w, r, name) {
+		return
+	}
+
+	if err := h.fs.Remove(stateName(name)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		writeError(w, statusCode(err))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *Handler) lock(w http.ResponseWriter, r *http.Request, name string) {
+	var info LockInfo
+
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&info); err != nil || info.ID == "" {
+		writeError(w, http.StatusBadRequest)
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	cur, err := h.readLock(name)
+
+	if err != nil {
+		writeError(w, statusCode(err))
+		return
+	}
+
+	if cur != nil {
+		writeLocked(w, cur)
+		return
+	}
+
+	b, err := json.Marshal(info)
+
+	if err != nil {
+		writeError(w, http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.put(lockName(name), bytes.NewReader(b)); err != nil {
+		writeError(w, statusCode(err))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// unlock removes the lock on the workspace if the ID matches that of the lock.
+// Force unlocking sends no lock at all, in which case the lock is removed
+// whatever its ID.
+func (h *Handler) unlock(w http.ResponseWriter, r *http.Request, name string) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest)
+		return
+	}
+
+	var info LockInfo
+
+	if len(bytes.TrimSpace(body)) > 0 {
+		if err := json.Unmarshal(body, &info); err != nil {
+			writeError(w, http.StatusBadRequest)
+			return
+		}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	cur, err := h.readLock(name)
+
+	if err != nil {
+		writeError(w, statusCode(err))
+		return
+	}
+
+	if cur == nil {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if info.ID != "" && cur.ID != info.ID {
+		writeLocked(w, cur)
+		return
+	}
+
+	if err := h.fs.Remove(lockName(name)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		writeError(w, statusCode(err))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,87 @@
+package tfstate
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andrewpillar/fs/fakefs"
+)
+
+func do(t *testing.T, h http.Handler, method, target, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, target, strings.NewReader(body)))
+	return rec
+}
+
+func Test_Handler(t *testing.T) {
+	h := New(fakefs.New())
+
+	if rec := do(t, h, http.MethodGet, "/network", ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("unexpected status, expected=%d, got=%d\n", http.StatusNoContent, rec.Code)
+	}
+
+	lock := `{"ID":"abc","Operation":"OperationTypeApply","Who":"alice@host"}`
+
+	tests := []struct {
+		method   string
+		target   string
+		body     string
+		expected int
+	}{
+		{"LOCK", "/network", lock, http.StatusOK},
+		{"LOCK", "/network", `{"ID":"def"}`, http.StatusLocked},
+		{http.MethodPost, "/network", `{"version":4}`, http.StatusLocked},
+		{http.MethodPost, "/network?ID=abc", `{"version":4}`, http.StatusOK},
+		{http.MethodPost, "/network?ID=abc", `not json`, http.StatusBadRequest},
+		{"UNLOCK", "/network", `{"ID":"def"}`, http.StatusLocked},
+		{"UNLOCK", "/network", lock, http.StatusOK},
+		{http.MethodPost, "/network", `{"version":4,"serial":2}`, http.StatusOK},
+		{"LOCK", "/network", `{"ID":"ghi"}`, http.StatusOK},
+		{"UNLOCK", "/network", "", http.StatusOK},
+		{http.MethodGet, "/../network", "", http.StatusBadRequest},
+	}
+
+	for i, test := range tests {
+		rec := do(t, h, test.method, test.target, test.body)
+
+		if rec.Code != test.expected {
+			t.Fatalf("tests[%d] - unexpected status, expected=%d, got=%d\n", i, test.expected, rec.Code)
+		}
+
+		if rec.Code == http.StatusLocked {
+			var info LockInfo
+
+			if err := json.NewDecoder(rec.Body).Decode(&info); err != nil {
+				t.Fatal(err)
+			}
+
+			if info.ID != "abc" {
+				t.Fatalf("tests[%d] - unexpected lock, expected=%q, got=%q\n", i, "abc", info.ID)
+			}
+		}
+	}
+
+	rec := do(t, h, http.MethodGet, "/network", "")
+
+	b, err := io.ReadAll(rec.Body)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(b) != `{"version":4,"serial":2}` {
+		t.Fatalf("unexpected state, expected=%q, got=%q\n", `{"version":4,"serial":2}`, b)
+	}
+
+	if rec := do(t, h, http.MethodDelete, "/network", ""); rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status, expected=%d, got=%d\n", http.StatusOK, rec.Code)
+	}
+
+	if rec := do(t, h, http.MethodGet, "/network", ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("unexpected status, expected=%d, got=%d\n", http.StatusNoContent, rec.Code)
+	}
+}
@@ -0,0 +1,253 @@
+package fs
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+// TierPolicy configures how files move between the hot and cold filesystems
+// of a tier.
+type TierPolicy struct {
+	// Age is how long since a file was last modified before it is migrated
+	// from hot to cold by Migrate.
+	Age time.Duration
+
+	// Rehydrate configures files opened from cold to be copied back into
+	// hot.
+	Rehydrate bool
+
+	// Now returns the current time. Defaults to time.Now.
+	Now func() time.Time
+}
+
+// TierFS is the interface implemented by a filesystem that can migrate files
+// between tiers of storage.
+type TierFS interface {
+	FS
+
+	// Migrate moves the files that have aged past the threshold of the tier
+	// into the colder storage, and returns the number of files moved.
+	Migrate() (int, error)
+}
+
+// Migrate migrates the aged files in the given filesystem to colder storage.
+// If the filesystem does not implement TierFS then ErrUnsupported is returned
+// in the *PathError.
+func Migrate(s FS) (int, error) {
+	ts, ok := s.(TierFS)
+
+	if !ok {
+		return 0, &PathError{Op: "migrate", Path: ".", Err: ErrUnsupported}
+	}
+	return ts.Migrate()
+}
+
+type tierFS struct {
+	FS
+
+	cold   FS
+	policy TierPolicy
+}
+
+// Tier returns a filesystem that puts files into the hot filesystem, and
+// serves them from hot, falling back to cold. Files are moved from hot to
+// cold once they age past the threshold of the policy on each call to
+// Migrate. If the policy rehydrates files, then files opened from cold are
+// copied back into hot, where they stay until they age again. Both
+// filesystems must implement ReadDirFS for Migrate.
+func Tier(hot, cold FS, policy TierPolicy) FS {
+	if policy.Now == nil {
+		policy.Now = time.Now
+	}
+
+	ts := &tierFS{
+		FS:     hot,
+		cold:   cold,
+		policy: policy,
+	}
+
+	if canRename(hot, cold) {
+		return renameTierFS{tierFS: ts}
+	}
+	return ts
+}
+
+// renameTierFS is a tierFS over hot and cold filesystems that both implement RenameFS.
+type renameTierFS struct {
+	*tierFS
+}
+
+func (s *tierFS) Unwrap() []FS { return []FS{s.FS, s.cold} }
+
+func (s *tierFS) Open(name string) (File, error) {
+	f, err := s.FS.Open(name)
+
+	if err == nil || !errors.Is(err, ErrNotExist) {
+		return f, err
+	}
+
+	if !s.policy.Rehydrate {
+		return s.cold.Open(name)
+	}
+
+	return Copy(s.FS, s.cold, name)
+}
+
+func (s *tierFS) Sub(dir string) (FS, error) {
+	hot, err := s.FS.Sub(dir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	cold, err := s.cold.Sub(dir)
+
+	if err != nil {
+		return nil, err
+	}
+	return Tier(hot, cold, s.policy), nil
+}
+
+func (s *tierFS) Stat(name string) (FileInfo, error) {
+	info, err := s.FS.Stat(name)
+
+	if err == nil || !errors.Is(err, ErrNotExist) {
+		return info, err
+	}
+	return s.cold.Stat(name)
+}
+
+// ReadDir returns the entries of the named directory in both filesystems,
+// with the entries in hot taking precedence.
+func (s *tierFS) ReadDir(name string) ([]DirEntry, error) {
+	hot, err := ReadDir(s.FS, name)
+
+	if err != nil && !errors.Is(err, ErrNotExist) {
+		return nil, err
+	}
+
+	cold, err1 := ReadDir(s.cold, name)
+
+	if err1 != nil {
+		if err != nil || !errors.Is(err1, ErrNotExist) {
+			return nil, err1
+		}
+	}
+
+	seen := make(map[string]struct{}, len(hot))
+
+	for _, ent := range hot {
+		seen[ent.Name()] = struct{}{}
+	}
+
+	ents := hot
+
+	for _, ent := range cold {
+		if _, ok := seen[ent.Name()]; !ok {
+			ents = append(ents, ent)
+		}
+	}
+
+	sort.Slice(ents, func(i, j int) bool {
+		return ents[i].Name() < ents[j].Name()
+	})
+	return ents, nil
+}
+
+// Rename renames the file in whichever filesystems it exists in.
+func (s renameTierFS) Rename(oldname, newname string) error {
+	err := Move(s.FS, oldname, newname)
+
+	if err != nil && !errors.Is(err, ErrNotExist) {
+		return err
+	}
+
+	err1 := Move(s.cold, oldname, newname)
+
+	if err1 != nil && !errors.Is(err1, ErrNotExist) {
+		return err1
+	}
+
+	if err != nil && err1 != nil {
+		return err
+	}
+	return nil
+}
+
+// Remove removes the file from both filesystems.
+func (s *tierFS) Remove(name string) error {
+	err := s.FS.Remove(name)
+
+	if err != nil && !errors.Is(err, ErrNotExist) {
+		return err
+	}
+
+	err1 := s.cold.Remove(name)
+
+	if err1 != nil && !errors.Is(err1, ErrNotExist) {
+		return err1
+	}
+
+	if err != nil && err1 != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *tierFS) Metadata(name string) (Metadata, error) {
+	md, err := GetMetadata(s.FS, name)
+
+	if err == nil || !errors.Is(err, ErrNotExist) {
+		return md, err
+	}
+	return GetMetadata(s.cold, name)
+}
+
+func (s *tierFS) Migrate() (int, error) {
+	threshold := s.policy.Now().Add(-s.policy.Age)
+
+	names := make([]string, 0)
+
+	err := Walk(s.FS, ".", func(name string, ent DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if ent.IsDir() {
+			return nil
+		}
+
+		info, err := ent.Info()
+
+		if err != nil {
+			return err
+		}
+
+		if info.ModTime().Before(threshold) {
+			names = append(names, name)
+		}
+		return nil
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+
+	for _, name := range names {
+		stored, err := Copy(s.cold, s.FS, name)
+
+		if err != nil {
+			return n, err
+		}
+		stored.Close()
+
+		if err := s.FS.Remove(name); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
@@ -0,0 +1,103 @@
+package fs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_Tier(t *testing.T) {
+	hot := tmpdir(t)
+	defer os.RemoveAll(hot)
+
+	cold := tmpdir(t)
+	defer os.RemoveAll(cold)
+
+	store := Tier(New(hot), New(cold), TierPolicy{
+		Age:       time.Hour,
+		Rehydrate: true,
+	})
+
+	for _, name := range []string{"old", "new"} {
+		f, err := ReadFile(name, bytes.NewReader([]byte(name)))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		stored, err := store.Put(f)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+		stored.Close()
+	}
+
+	past := time.Now().Add(-2 * time.Hour)
+
+	if err := os.Chtimes(filepath.Join(hot, "old"), past, past); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := Migrate(store)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 1 {
+		t.Fatalf("unexpected migrated files, expected=%d, got=%d\n", 1, n)
+	}
+
+	if _, err := os.Stat(filepath.Join(hot, "old")); !errors.Is(err, ErrNotExist) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", ErrNotExist, err)
+	}
+
+	ents, err := ReadDir(store, ".")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ents) != 2 || ents[0].Name() != "new" || ents[1].Name() != "old" {
+		t.Fatalf("unexpected entries %v\n", ents)
+	}
+
+	f, err := store.Open("old")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := io.ReadAll(f)
+	f.Close()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(b) != "old" {
+		t.Fatalf("unexpected content, expected=%q, got=%q\n", "old", string(b))
+	}
+
+	// Opening from cold should have rehydrated the file into hot.
+	if _, err := os.Stat(filepath.Join(hot, "old")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Remove("old"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.Stat("old"); !errors.Is(err, ErrNotExist) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", ErrNotExist, err)
+	}
+
+	if err := store.Remove("old"); !errors.Is(err, ErrNotExist) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", ErrNotExist, err)
+	}
+}
@@ -0,0 +1,205 @@
+package fs
+
+import (
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// ErrTimeout is the error returned when an operation does not complete within
+// the duration given to Timeout. This is os.ErrDeadlineExceeded, so it
+// reports true from a Timeout method.
+var ErrTimeout = os.ErrDeadlineExceeded
+
+type timeoutFS struct {
+	FS
+
+	d time.Duration
+}
+
+// Timeout returns a filesystem that bounds the duration of each operation on
+// the given filesystem to d. If an operation does not complete in time then
+// ErrTimeout is returned in the *PathError. For Put, the file being put stops
+// returning data once the operation times out, which aborts the copy for any
+// backend that reads the file as it writes it. Any file that is returned from
+// an operation after it timed out is closed.
+//
+// An operation that has timed out is left to complete in the background, since
+// it cannot be cancelled. A backend that never returns will still hold on to
+// the goroutine running the operation.
+//
+// A file created via ReadFile or ReadFileMax can be cleaned up as soon as Put
+// returns, since a put left running in the background holds on to its own
+// reference to the file's memory. Any other file may still be read from by the
+// put after it has timed out, until the read in progress returns, so should not
+// be closed until then. A backend that writes the file in place, rather than
+// writing it elsewhere and renaming it, may be left with a partially written
+// file when a put times out.
+func Timeout(s FS, d time.Duration) FS {
+	ts := &timeoutFS{
+		FS: s,
+		d:  d,
+	}
+
+	if canRename(s) {
+		return renameTimeoutFS{timeoutFS: ts}
+	}
+	return ts
+}
+
+// renameTimeoutFS is a timeoutFS over a filesystem that implements RenameFS.
+type renameTimeoutFS struct {
+	*timeoutFS
+}
+
+type result[T any] struct {
+	v   T
+	err error
+}
+
+// withTimeout runs fn, returning ErrTimeout if it does not return within d. If
+// fn returns after the timeout, then whatever it returned is closed if it can
+// be.
+func withTimeout[T any](d time.Duration, op, name string, fn func() (T, error)) (T, error) {
+	ch := make(chan result[T], 1)
+
+	go func() {
+		v, err := fn()
+		ch <- result[T]{v: v, err: err}
+	}()
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case r := <-ch:
+		return r.v, r.err
+	case <-t.C:
+		go func() {
+			r := <-ch
+
+			if c, ok := any(r.v).(io.Closer); ok && r.err == nil {
+				c.Close()
+			}
+		}()
+
+		var zero T
+		return zero, &PathError{Op: op, Path: name, Err: ErrTimeout}
+	}
+}
+
+func (s *timeoutFS) Unwrap() FS { return s.FS }
+
+func (s *timeoutFS) Open(name string) (File, error) {
+	return withTimeout(s.d, "open", name, func() (File, error) {
+		return s.FS.Open(name)
+	})
+}
+
+func (s *timeoutFS) Sub(dir string) (FS, error) {
+	sub, err := withTimeout(s.d, "sub", dir, func() (FS, error) {
+		return s.FS.Sub(dir)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return Timeout(sub, s.d), nil
+}
+
+func (s *timeoutFS) Stat(name string) (FileInfo, error) {
+	return withTimeout(s.d, "stat", name, func() (FileInfo, error) {
+		return s.FS.Stat(name)
+	})
+}
+
+// abortFile stops returning data from the underlying file once aborted.
+type abortFile struct {
+	File
+
+	once sync.Once
+	done chan struct{}
+}
+
+func (f *abortFile) abort() {
+	f.once.Do(func() { close(f.done) })
+}
+
+func (f *abortFile) Read(p []byte) (int, error) {
+	select {
+	case <-f.done:
+		return 0, ErrTimeout
+	default:
+	}
+	return f.File.Read(p)
+}
+
+func (s *timeoutFS) Put(f File) (File, error) {
+	info, err := f.Stat()
+
+	if err != nil {
+		return nil, err
+	}
+
+	// The put reads from its own view of the file, so the caller can clean
+	// up the file once Put returns, even if the put is still running in the
+	// background.
+	shared, release := share(f)
+
+	af := &abortFile{
+		File: shared,
+		done: make(chan struct{}),
+	}
+
+	stored, err := withTimeout(s.d, "put", info.Name(), func() (File, error) {
+		defer release()
+		return s.FS.Put(af)
+	})
+
+	if err != nil {
+		af.abort()
+		return nil, err
+	}
+	return stored, nil
+}
+
+func (s *timeoutFS) ReadDir(name string) ([]DirEntry, error) {
+	return withTimeout(s.d, "readdir", name, func() ([]DirEntry, error) {
+		return ReadDir(s.FS, name)
+	})
+}
+
+func (s renameTimeoutFS) Rename(oldname, newname string) error {
+	_, err := withTimeout(s.d, "rename", oldname, func() (struct{}, error) {
+		return struct{}{}, Move(s.FS, oldname, newname)
+	})
+	return err
+}
+
+func (s *timeoutFS) Link(oldname, newname string) error {
+	_, err := withTimeout(s.d, "link", oldname, func() (struct{}, error) {
+		return struct{}{}, Link(s.FS, oldname, newname)
+	})
+	return err
+}
+
+func (s *timeoutFS) Remove(name string) error {
+	_, err := withTimeout(s.d, "remove", name, func() (struct{}, error) {
+		return struct{}{}, s.FS.Remove(name)
+	})
+	return err
+}
+
+func (s *timeoutFS) Metadata(name string) (Metadata, error) {
+	return withTimeout(s.d, "metadata", name, func() (Metadata, error) {
+		return GetMetadata(s.FS, name)
+	})
+}
+
+func (s *timeoutFS) SetMetadata(name string, md Metadata) error {
+	_, err := withTimeout(s.d, "setmetadata", name, func() (struct{}, error) {
+		return struct{}{}, SetMetadata(s.FS, name, md)
+	})
+	return err
+}
@@ -0,0 +1,160 @@
+package fs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// slowFS blocks every Stat until released, and reads Put files slowly.
+type slowFS struct {
+	FS
+
+	release chan struct{}
+	read    chan error
+}
+
+func (s slowFS) Stat(name string) (FileInfo, error) {
+	<-s.release
+	return s.FS.Stat(name)
+}
+
+func (s slowFS) Put(f File) (File, error) {
+	buf := make([]byte, 1)
+
+	for {
+		_, err := f.Read(buf)
+
+		if err != nil {
+			s.read <- err
+			return nil, err
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// blockedFS blocks every Put until released, before reading the file.
+type blockedFS struct {
+	FS
+
+	release chan struct{}
+	done    chan struct{}
+}
+
+func (s blockedFS) Put(f File) (File, error) {
+	defer close(s.done)
+
+	<-s.release
+
+	_, err := io.ReadAll(f)
+	return nil, err
+}
+
+func Test_Timeout(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	slow := slowFS{
+		FS:      New(dir),
+		release: make(chan struct{}),
+		read:    make(chan error, 1),
+	}
+	defer close(slow.release)
+
+	store := Timeout(slow, 20*time.Millisecond)
+
+	if _, err := store.Stat("file"); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", ErrTimeout, err)
+	}
+
+	f, err := ReadFile("file", bytes.NewReader(generateData(t, 4096)))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.Put(f); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", ErrTimeout, err)
+	}
+
+	// The copy in the backend should be aborted rather than reading the file
+	// to the end.
+	select {
+	case err := <-slow.read:
+		if err == io.EOF {
+			t.Fatal("expected copy to be aborted, it read the whole file")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected copy to be aborted, it was not")
+	}
+}
+
+func Test_TimeoutFast(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	store := Timeout(New(dir), time.Second)
+
+	f, err := ReadFile("file", bytes.NewReader([]byte("data")))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := store.Put(f)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored.Close()
+
+	if _, err := store.Stat("file"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_TimeoutCleanup(t *testing.T) {
+	blocked := blockedFS{
+		FS:      Null(),
+		release: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	store := Timeout(blocked, 20*time.Millisecond)
+
+	f, err := ReadFile("file", bytes.NewReader(generateData(t, 4096)))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := f.(*file).pool
+
+	if _, err := store.Put(f); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", ErrTimeout, err)
+	}
+
+	Cleanup(f)
+
+	// The put is still running, so the buffer should not have been returned
+	// to the pool.
+	if refs := atomic.LoadInt32(&pool.refs); refs != 1 {
+		t.Fatalf("unexpected refs, expected=%d, got=%d\n", 1, refs)
+	}
+
+	close(blocked.release)
+	<-blocked.done
+
+	deadline := time.Now().Add(time.Second)
+
+	for atomic.LoadInt32(&pool.refs) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected buffer to be released once the put returned")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
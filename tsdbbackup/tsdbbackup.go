@@ -0,0 +1,379 @@
+// Package tsdbbackup backs up the blocks of a Prometheus TSDB into an FS.
+//
+// Each block in the data directory, or a snapshot of it, is copied into the FS
+// under its ULID once it has been written, and blocks older than the retention
+// period are removed from the FS, for example,
+//
+//	b := tsdbbackup.New(store, "/prometheus/data",
+//		tsdbbackup.Retention(90*24*time.Hour),
+//		tsdbbackup.OnError(func(err error) {
+//			log.Println(err)
+//		}),
+//	)
+//
+//	go b.Run(ctx, time.Hour)
+//
+// The head block, and the write ahead log, are not backed up, so the backup
+// lags the database by up to the block duration, two hours by default. A
+// snapshot taken with the snapshot API of Prometheus includes the head block.
+package tsdbbackup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/andrewpillar/fs"
+)
+
+// metaName is the name of the file that describes a block. It is copied last,
+// so a block in the FS is only complete once it has one.
+const metaName = "meta.json"
+
+// Meta is the part of the meta.json file of a block used by the backup.
+type Meta struct {
+	ULID    string `json:"ulid"`
+	MinTime int64  `json:"minTime"`
+	MaxTime int64  `json:"maxTime"`
+
+	Compaction struct {
+		Level   int      `json:"level"`
+		Sources []string `json:"sources"`
+	} `json:"compaction"`
+}
+
+// Result is the result of a single backup.
+type Result struct {
+	// Uploaded is the ULIDs of the blocks that were copied into the FS.
+	Uploaded []string
+
+	// Removed is the ULIDs of the blocks that were removed from the FS,
+	// either because they were older than the retention period, or because
+	// their data is held by a block they were compacted into.
+	Removed []string
+}
+
+// Backup backs up the blocks in a directory into an FS.
+type Backup struct {
+	fs        fs.FS
+	dir       string
+	retention time.Duration
+	now       func() time.Time
+	onError   func(error)
+}
+
+// Option configures a Backup.
+type Option func(*Backup)
+
+// Retention sets how long blocks are kept in the FS, by the time of the newest
+// sample in each block. Defaults to keeping blocks forever.
+func Retention(d time.Duration) Option {
+	return func(b *Backup) {
+		b.retention = d
+	}
+}
+
+// WithClock sets the function used to get the current time when applying the
+// retention period. Defaults to time.Now.
+func WithClock(now func() time.Time) Option {
+	return func(b *Backup) {
+		b.now = now
+	}
+}
+
+// OnError sets the function called with the errors that occur when backing up
+// on a schedule with Run.
+func OnError(fn func(error)) Option {
+	return func(b *Backup) {
+		b.onError = fn
+	}
+}
+
+// New returns a Backup that copies the blocks in the given directory on disk
+// into the given FS.
+func New(s fs.FS, dir string, opts ...Option) *Backup {
+	b := &Backup{
+		fs:      s,
+		dir:     dir,
+		now:     time.Now,
+		onError: func(error) {},
+	}
+
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// isULID reports whether the name is a ULID, which is how blocks are named.
+// Blocks still being written have a suffix, so are not matched.
+func isULID(name string) bool {
+	if len(name) != 26 {
+		return false
+	}
+
+	for _, r := range name {
+		if !('0' <= r && r <= '9' || 'A' <= r && r <= 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+func readMeta(s fs.FS, ulid string) (*Meta, error) {
+	f, err := s.Open(path.Join(ulid, metaName))
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	var m Meta
+
+	if err := json.NewDecoder(f).Decode(&m); err != nil {
+		return nil, &fs.PathError{Op: "tsdbbackup", Path: path.Join(ulid, metaName), Err: err}
+	}
+	return &m, nil
+}
+
+// blocks returns the complete blocks in the given FS.
+func blocks(s fs.FS) (map[string]*Meta, error) {
+	ents, err := fs.ReadDir(s, ".")
+
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return map[string]*Meta{}, nil
+		}
+		return nil, err
+	}
+
+	metas := make(map[string]*Meta)
+
+	for _, ent := range ents {
+		if !ent.IsDir() || !isULID(ent.Name()) {
+			continue
+		}
+
+		m, err := readMeta(s, ent.Name())
+
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		metas[ent.Name()] = m
+	}
+	return metas, nil
+}
+
+// upload copies the given block into the FS, with its meta.json last.
+func (b *Backup) upload(src fs.FS, ulid string) error {
+	err := fs.Walk(src, ulid, func(name string, ent fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if ent.IsDir() || name == path.Join(ulid, metaName) {
+			return nil
+		}
+
+		f, err := fs.Copy(b.fs, src, name)
+
+		if err != nil {
+			return err
+		}
+		return f.Close()
+	})
+
+	if err != nil {
+		return err
+	}
+
+	f, err := fs.Copy(b.fs, src, path.Join(ulid, metaName))
+
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// remove removes the given block from the FS, with its meta.json first, so the
+// block is no longer complete if it cannot be removed in full.
+func (b *Backup) remove(ulid string) error {
+	if err := b.fs.Remove(path.Join(ulid, metaName)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	var names []string
+
+	err := fs.Walk(b.fs, ulid, func(name string, ent fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		names = append(names, name)
+		return nil
+	})
+
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	// Remove the deepest names first, so directories are empty when they
+	// are removed.
+	for i := len(names) - 1; i >= 0; i-- {
+		if err := b.fs.Remove(names[i]); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// covered reports whether the data of the block m is held by the block other,
+// because other was compacted from every source of m. Of two blocks with the
+// same sources the one with the greater ULID is kept.
+func covered(m, other *Meta) bool {
+	if m.ULID == other.ULID || len(other.Compaction.Sources) < len(m.Compaction.Sources) {
+		return false
+	}
+
+	sources := make(map[string]struct{}, len(other.Compaction.Sources))
+
+	for _, src := range other.Compaction.Sources {
+		sources[src] = struct{}{}
+	}
+
+	for _, src := range m.Compaction.Sources {
+		if _, ok := sources[src]; !ok {
+			return false
+		}
+	}
+
+	if len(other.Compaction.Sources) == len(m.Compaction.Sources) {
+		return other.ULID > m.ULID
+	}
+	return true
+}
+
+// Sync copies the blocks in the directory that are not yet in the FS, and then
+// removes the blocks from the FS that are older than the retention period, or
+// that have been compacted into another block in the FS.
+func (b *Backup) Sync(ctx context.Context) (*Result, error) {
+	if _, err := os.Stat(b.dir); err != nil {
+		return nil, err
+	}
+
+	src := fs.New(b.dir)
+
+	local, err := blocks(src)
+
+	if err != nil {
+		return nil, err
+	}
+
+	remote, err := blocks(b.fs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var cutoff int64
+
+	if b.retention > 0 {
+		cutoff = b.now().Add(-b.retention).UnixMilli()
+	}
+
+	expired := func(m *Meta) bool {
+		return b.retention > 0 && m.MaxTime < cutoff
+	}
+
+	ulids := make([]string, 0, len(local))
+
+	for ulid, m := range local {
+		// Blocks past the retention period are only removed from the
+		// directory by Prometheus, so would otherwise be copied again on
+		// each sync.
+		if !expired(m) {
+			ulids = append(ulids, ulid)
+		}
+	}
+	sort.Strings(ulids)
+
+	var res Result
+
+	for _, ulid := range ulids {
+		if err := ctx.Err(); err != nil {
+			return &res, err
+		}
+
+		if _, ok := remote[ulid]; ok {
+			continue
+		}
+
+		if err := b.upload(src, ulid); err != nil {
+			return &res, fmt.Errorf("tsdbbackup: %s: %w", ulid, err)
+		}
+
+		remote[ulid] = local[ulid]
+		res.Uploaded = append(res.Uploaded, ulid)
+	}
+
+	ulids = ulids[:0]
+
+	for ulid, m := range remote {
+		remove := expired(m)
+
+		if !remove {
+			for _, other := range remote {
+				if covered(m, other) {
+					remove = true
+					break
+				}
+			}
+		}
+
+		if remove {
+			ulids = append(ulids, ulid)
+		}
+	}
+	sort.Strings(ulids)
+
+	for _, ulid := range ulids {
+		if err := b.remove(ulid); err != nil {
+			return &res, fmt.Errorf("tsdbbackup: %s: %w", ulid, err)
+		}
+		res.Removed = append(res.Removed, ulid)
+	}
+	return &res, nil
+}
+
+// Run syncs the blocks every interval until the given context is done. Errors
+// from each sync are passed to the OnError func.
+func (b *Backup) Run(ctx context.Context, interval time.Duration) error {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		if _, err := b.Sync(ctx); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			b.onError(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
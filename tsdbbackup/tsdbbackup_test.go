@@ -0,0 +1,156 @@
+package tsdbbackup
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/andrewpillar/fs/fakefs"
+)
+
+func writeBlock(t *testing.T, dir, ulid string, maxTime time.Time, sources ...string) {
+	if len(sources) == 0 {
+		sources = []string{ulid}
+	}
+
+	var m Meta
+
+	m.ULID = ulid
+	m.MaxTime = maxTime.UnixMilli()
+	m.MinTime = maxTime.Add(-2 * time.Hour).UnixMilli()
+	m.Compaction.Level = 1
+	m.Compaction.Sources = sources
+
+	b, err := json.Marshal(m)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string][]byte{
+		"meta.json":     b,
+		"index":         []byte("index"),
+		"chunks/000001": []byte("chunks"),
+		"tombstones":    []byte("tombstones"),
+	}
+
+	for name, data := range files {
+		p := filepath.Join(dir, ulid, filepath.FromSlash(name))
+
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(p, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func Test_Sync(t *testing.T) {
+	dir, err := os.MkdirTemp("", "tsdbbackup-")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	now := time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)
+
+	const (
+		old = "01ARZ3NDEKTSV4RRFFQ69G5FA0"
+		a   = "01ARZ3NDEKTSV4RRFFQ69G5FAA"
+		b   = "01ARZ3NDEKTSV4RRFFQ69G5FAB"
+		ab  = "01ARZ3NDEKTSV4RRFFQ69G5FAC"
+	)
+
+	writeBlock(t, dir, old, now.Add(-48*time.Hour))
+	writeBlock(t, dir, a, now.Add(-4*time.Hour))
+	writeBlock(t, dir, b, now.Add(-2*time.Hour))
+
+	// A block still being written is not backed up.
+	if err := os.MkdirAll(filepath.Join(dir, a+".tmp-for-creation"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	store := fakefs.New()
+
+	clock := fakefs.NewManualClock(now)
+
+	bk := New(store, dir, Retention(24*time.Hour), WithClock(clock.Now))
+
+	res, err := bk.Sync(context.Background())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := []string{a, b}; !reflect.DeepEqual(res.Uploaded, expected) {
+		t.Fatalf("unexpected uploaded, expected=%v, got=%v\n", expected, res.Uploaded)
+	}
+
+	if len(res.Removed) != 0 {
+		t.Fatalf("unexpected removed, expected=%d, got=%d\n", 0, len(res.Removed))
+	}
+
+	if _, err := store.Stat(a + "/chunks/000001"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Compacting a and b into ab removes them from the FS once ab is
+	// backed up.
+	os.RemoveAll(filepath.Join(dir, a))
+	os.RemoveAll(filepath.Join(dir, b))
+	writeBlock(t, dir, ab, now.Add(-2*time.Hour), a, b)
+
+	res, err = bk.Sync(context.Background())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := []string{ab}; !reflect.DeepEqual(res.Uploaded, expected) {
+		t.Fatalf("unexpected uploaded, expected=%v, got=%v\n", expected, res.Uploaded)
+	}
+
+	if expected := []string{a, b}; !reflect.DeepEqual(res.Removed, expected) {
+		t.Fatalf("unexpected removed, expected=%v, got=%v\n", expected, res.Removed)
+	}
+
+	remote, err := blocks(store)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(remote) != 1 || remote[ab] == nil {
+		t.Fatalf("unexpected blocks, expected=%q, got=%v\n", ab, remote)
+	}
+
+	for _, name := range store.Files() {
+		if filepath.Dir(filepath.Dir(name)) == a || filepath.Dir(name) == a {
+			t.Fatalf("unexpected file %q\n", name)
+		}
+	}
+
+	clock.Advance(48 * time.Hour)
+
+	res, err = bk.Sync(context.Background())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := []string{ab}; len(res.Uploaded) != 0 || !reflect.DeepEqual(res.Removed, expected) {
+		t.Fatalf("unexpected removed, expected=%v, got=%v\n", expected, res.Removed)
+	}
+
+	if files := store.Files(); len(files) != 0 {
+		t.Fatalf("unexpected files %v\n", files)
+	}
+}
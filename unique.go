@@ -0,0 +1,74 @@
+package fs
+
+import (
+	"errors"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// CollisionPolicy is how a filesystem returned from UniquePolicy handles a
+// file being put in it with the same name as an existing file.
+type CollisionPolicy uint
+
+const (
+	// CollisionError errors with ErrExist, the behaviour of Unique.
+	CollisionError CollisionPolicy = iota
+
+	// CollisionOverwrite replaces the existing file.
+	CollisionOverwrite
+
+	// CollisionSuffix stores the file under its name with a number suffixed
+	// to it, for example "file (1).txt".
+	CollisionSuffix
+)
+
+// maxSuffix is the largest suffix tried by CollisionSuffix before giving up
+// with ErrExist.
+const maxSuffix = 10000
+
+func (p CollisionPolicy) String() string {
+	switch p {
+	case CollisionError:
+		return "error"
+	case CollisionOverwrite:
+		return "overwrite"
+	case CollisionSuffix:
+		return "suffix"
+	default:
+		return "unknown"
+	}
+}
+
+// suffixName returns the given name with the given number suffixed to it
+// before the extension, for example "file (1).txt".
+func suffixName(name string, n int) string {
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+
+	// Keep dotfiles such as ".bashrc" whole.
+	if base == "" {
+		base, ext = ext, ""
+	}
+	return base + " (" + strconv.Itoa(n) + ")" + ext
+}
+
+// putSuffix puts the file under the first suffixed variant of the name that
+// does not exist. Since the check and the put are not atomic, concurrent puts
+// of the same name may still collide.
+func (s uniqueFS) putSuffix(f File, name string) (File, error) {
+	for i := 1; i <= maxSuffix; i++ {
+		suffixed := suffixName(name, i)
+
+		_, err := s.Stat(suffixed)
+
+		if errors.Is(err, ErrNotExist) {
+			return s.FS.Put(Rename(f, suffixed))
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+	return nil, &PathError{Op: "put", Path: name, Err: ErrExist}
+}
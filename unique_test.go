@@ -0,0 +1,97 @@
+package fs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"testing"
+)
+
+func putString(t *testing.T, s FS, name, data string) string {
+	f, err := ReadFile(name, bytes.NewReader([]byte(data)))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := s.Put(f)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer stored.Close()
+
+	info, err := stored.Stat()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info.Name()
+}
+
+func Test_UniqueOverwrite(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	store := UniquePolicy(New(dir), CollisionOverwrite)
+
+	putString(t, store, "file", "first")
+	putString(t, store, "file", "second")
+
+	f, err := store.Open("file")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	b, err := io.ReadAll(f)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(b) != "second" {
+		t.Fatalf("unexpected content, expected=%q, got=%q\n", "second", string(b))
+	}
+}
+
+func Test_UniqueSuffix(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	store := UniquePolicy(New(dir), CollisionSuffix)
+
+	expected := []string{"file.txt", "file (1).txt", "file (2).txt"}
+
+	for i, name := range expected {
+		if stored := putString(t, store, "file.txt", "data"); stored != name {
+			t.Fatalf("expected[%d] - unexpected name, expected=%q, got=%q\n", i, name, stored)
+		}
+	}
+
+	if err := store.(RenameFS).Rename("file.txt", "file (1).txt"); !errors.Is(err, ErrExist) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", ErrExist, err)
+	}
+}
+
+func Test_SuffixName(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"file", "file (1)"},
+		{"file.txt", "file (1).txt"},
+		{"archive.tar.gz", "archive.tar (1).gz"},
+		{".bashrc", ".bashrc (1)"},
+	}
+
+	for i, test := range tests {
+		if name := suffixName(test.name, 1); name != test.expected {
+			t.Fatalf("tests[%d] - unexpected name, expected=%q, got=%q\n", i, test.expected, name)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package fs
+
+// Unwrapper is the interface implemented by a filesystem that wraps another
+// filesystem, such as those returned from Hash, Limit, and Unique.
+type Unwrapper interface {
+	// Unwrap returns the filesystem that is wrapped.
+	Unwrap() FS
+}
+
+// MultiUnwrapper is the interface implemented by a filesystem that wraps more
+// than one filesystem, such as those returned from Tier, Shard, and Erasure.
+type MultiUnwrapper interface {
+	// Unwrap returns the filesystems that are wrapped, the primary first if
+	// there is one.
+	Unwrap() []FS
+}
+
+// Unwrap returns the filesystem wrapped by the given filesystem, or nil if it
+// does not implement Unwrapper. If it implements MultiUnwrapper then the first
+// filesystem it wraps is returned.
+func Unwrap(s FS) FS {
+	switch u := s.(type) {
+	case Unwrapper:
+		return u.Unwrap()
+	case MultiUnwrapper:
+		if wrapped := u.Unwrap(); len(wrapped) > 0 {
+			return wrapped[0]
+		}
+	}
+	return nil
+}
+
+// unwrapAll returns every filesystem wrapped by the given filesystem.
+func unwrapAll(s FS) []FS {
+	switch u := s.(type) {
+	case Unwrapper:
+		if wrapped := u.Unwrap(); wrapped != nil {
+			return []FS{wrapped}
+		}
+	case MultiUnwrapper:
+		return u.Unwrap()
+	}
+	return nil
+}
+
+// Base returns the innermost filesystem beneath any wrappers, by repeatedly
+// calling Unwrap.
+func Base(s FS) FS {
+	for {
+		next := Unwrap(s)
+
+		if next == nil {
+			return s
+		}
+		s = next
+	}
+}
+
+// Has returns the first filesystem in the chain of wrappers, starting with the
+// given filesystem, that implements T. This can be used to find a capability
+// that is buried under wrappers that do not forward it,
+//
+//	if signer, ok := fs.Has[URLSigner](store); ok {
+//		...
+//	}
+func Has[T any](s FS) (T, bool) {
+	for s != nil {
+		if v, ok := s.(T); ok {
+			return v, true
+		}
+		s = Unwrap(s)
+	}
+
+	var zero T
+	return zero, false
+}
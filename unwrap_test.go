@@ -0,0 +1,54 @@
+package fs
+
+import (
+	"crypto/sha256"
+	"os"
+	"testing"
+	"time"
+)
+
+// marker is a capability that is not forwarded by any wrapper.
+type marker interface {
+	Mark() string
+}
+
+type markedFS struct {
+	FS
+}
+
+func (markedFS) Mark() string { return "marked" }
+
+func Test_Unwrap(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	base := markedFS{FS: New(dir)}
+
+	store := Limit(Unique(CacheStat(Hash(ReadOnly(base), sha256.New), time.Minute)), 1024)
+
+	if Unwrap(base) != nil {
+		t.Fatal("expected nil from Unwrap of unwrapped filesystem")
+	}
+
+	if _, ok := Base(store).(markedFS); !ok {
+		t.Fatalf("unexpected base, expected=%T, got=%T\n", base, Base(store))
+	}
+
+	m, ok := Has[marker](store)
+
+	if !ok {
+		t.Fatal("expected to find marker beneath wrappers")
+	}
+
+	if s := m.Mark(); s != "marked" {
+		t.Fatalf("unexpected mark, expected=%q, got=%q\n", "marked", s)
+	}
+
+	if _, ok := Has[*hashFS](store); !ok {
+		t.Fatal("expected to find hash wrapper")
+	}
+
+	if _, ok := Has[marker](New(dir)); ok {
+		t.Fatal("expected not to find marker")
+	}
+}
@@ -0,0 +1,291 @@
+package fs
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"strings"
+)
+
+// Encoder produces an encoded variant of a file.
+type Encoder struct {
+	// Encoding is the name of the encoding, as used in the Content-Encoding
+	// header.
+	Encoding string
+
+	// Ext is the extension appended to the name of the file to store the
+	// variant under.
+	Ext string
+
+	// NewWriter returns a writer that encodes to the given writer.
+	NewWriter func(w io.Writer) (io.WriteCloser, error)
+}
+
+// GzipEncoder encodes variants with gzip at the best compression level, since
+// variants are typically encoded once and served many times.
+var GzipEncoder = Encoder{
+	Encoding: "gzip",
+	Ext:      ".gz",
+	NewWriter: func(w io.Writer) (io.WriteCloser, error) {
+		return gzip.NewWriterLevel(w, gzip.BestCompression)
+	},
+}
+
+// VariantFS is the interface implemented by a filesystem that stores encoded
+// variants of its files.
+type VariantFS interface {
+	FS
+
+	// OpenVariant opens the variant of the named file in the given encoding.
+	// The encoding "identity" opens the file as is.
+	OpenVariant(name, encoding string) (File, error)
+}
+
+// OpenVariant opens the variant of the named file in the given encoding. If
+// the filesystem does not implement VariantFS, then only the "identity"
+// encoding can be opened, otherwise ErrUnsupported is returned. If the
+// variant does not exist then ErrNotExist is returned, so callers can fall
+// back to another encoding.
+func OpenVariant(s FS, name, encoding string) (File, error) {
+	if vs, ok := s.(VariantFS); ok {
+		return vs.OpenVariant(name, encoding)
+	}
+
+	if encoding == "identity" || encoding == "" {
+		return s.Open(name)
+	}
+	return nil, &PathError{Op: "openvariant", Path: name, Err: ErrUnsupported}
+}
+
+type variantFS struct {
+	FS
+
+	encoders []Encoder
+}
+
+// Variants returns a filesystem that stores an encoded variant of each file
+// put in the given filesystem for each of the given encoders, alongside the
+// file itself. The variant is stored under the name of the file with the
+// extension of the encoder appended. Variants are hidden from ReadDir, and are
+// renamed and removed along with the file. If no encoders are given then
+// GzipEncoder is used.
+func Variants(s FS, encoders ...Encoder) FS {
+	if len(encoders) == 0 {
+		encoders = []Encoder{GzipEncoder}
+	}
+
+	vs := &variantFS{
+		FS:       s,
+		encoders: encoders,
+	}
+
+	if canRename(s) {
+		return renameVariantFS{variantFS: vs}
+	}
+	return vs
+}
+
+// renameVariantFS is a variantFS over a filesystem that implements RenameFS.
+type renameVariantFS struct {
+	*variantFS
+}
+
+func (s *variantFS) encoder(encoding string) (Encoder, bool) {
+	for _, enc := range s.encoders {
+		if enc.Encoding == encoding {
+			return enc, true
+		}
+	}
+	return Encoder{}, false
+}
+
+func (s *variantFS) Unwrap() FS { return s.FS }
+
+func (s *variantFS) OpenVariant(name, encoding string) (File, error) {
+	if encoding == "identity" || encoding == "" {
+		return s.FS.Open(name)
+	}
+
+	enc, ok := s.encoder(encoding)
+
+	if !ok {
+		return nil, &PathError{Op: "openvariant", Path: name, Err: ErrNotExist}
+	}
+	return s.FS.Open(name + enc.Ext)
+}
+
+func (s *variantFS) Sub(dir string) (FS, error) {
+	sub, err := s.FS.Sub(dir)
+
+	if err != nil {
+		return nil, err
+	}
+	return Variants(sub, s.encoders...), nil
+}
+
+// putVariant encodes the given reader and puts it under the given name.
+func (s *variantFS) putVariant(enc Encoder, name string, r io.Reader) error {
+	pr, pw := io.Pipe()
+
+	go func() {
+		w, err := enc.NewWriter(pw)
+
+		if err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+
+		if _, err := io.Copy(w, r); err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		pw.CloseWithError(w.Close())
+	}()
+
+	f, err := ReadFile(name, pr)
+
+	if err != nil {
+		pr.CloseWithError(err)
+		return err
+	}
+
+	defer Cleanup(f)
+
+	stored, err := s.FS.Put(f)
+
+	if err != nil {
+		return err
+	}
+	return stored.Close()
+}
+
+// Put puts the file, followed by each of its variants. The variants are
+// encoded from the stored file, so the file is only read once.
+func (s *variantFS) Put(f File) (File, error) {
+	stored, err := s.FS.Put(f)
+
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := stored.Stat()
+
+	if err != nil {
+		stored.Close()
+		return nil, err
+	}
+
+	name := info.Name()
+
+	for _, enc := range s.encoders {
+		if err := s.putVariant(enc, name+enc.Ext, stored); err != nil {
+			stored.Close()
+			return nil, &PathError{Op: "put", Path: name, Err: err}
+		}
+
+		if err := s.rewind(&stored, name); err != nil {
+			return nil, &PathError{Op: "put", Path: name, Err: err}
+		}
+	}
+	return stored, nil
+}
+
+// rewind sets the offset of the given file back to the beginning, reopening
+// it if it cannot seek.
+func (s *variantFS) rewind(f *File, name string) error {
+	if seeker, ok := (*f).(io.Seeker); ok {
+		if _, err := seeker.Seek(0, io.SeekStart); err == nil {
+			return nil
+		}
+	}
+
+	(*f).Close()
+
+	reopened, err := s.FS.Open(name)
+
+	if err != nil {
+		return err
+	}
+
+	*f = reopened
+	return nil
+}
+
+// isVariant reports whether the given name is the name of a variant of a
+// file that is in the given set of names.
+func (s *variantFS) isVariant(name string, names map[string]struct{}) bool {
+	for _, enc := range s.encoders {
+		base := strings.TrimSuffix(name, enc.Ext)
+
+		if base == name {
+			continue
+		}
+
+		if _, ok := names[base]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *variantFS) ReadDir(name string) ([]DirEntry, error) {
+	ents, err := ReadDir(s.FS, name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]struct{}, len(ents))
+
+	for _, ent := range ents {
+		if !ent.IsDir() {
+			names[ent.Name()] = struct{}{}
+		}
+	}
+
+	filtered := make([]DirEntry, 0, len(ents))
+
+	for _, ent := range ents {
+		if !ent.IsDir() && s.isVariant(ent.Name(), names) {
+			continue
+		}
+		filtered = append(filtered, ent)
+	}
+	return filtered, nil
+}
+
+// Rename renames the file along with its variants.
+func (s renameVariantFS) Rename(oldname, newname string) error {
+	if err := Move(s.FS, oldname, newname); err != nil {
+		return err
+	}
+
+	for _, enc := range s.encoders {
+		if err := Move(s.FS, oldname+enc.Ext, newname+enc.Ext); err != nil && !errors.Is(err, ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Remove removes the file along with its variants.
+func (s *variantFS) Remove(name string) error {
+	if err := s.FS.Remove(name); err != nil {
+		return err
+	}
+
+	for _, enc := range s.encoders {
+		if err := s.FS.Remove(name + enc.Ext); err != nil && !errors.Is(err, ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *variantFS) Metadata(name string) (Metadata, error) {
+	return GetMetadata(s.FS, name)
+}
+
+func (s *variantFS) SetMetadata(name string, md Metadata) error {
+	return SetMetadata(s.FS, name, md)
+}
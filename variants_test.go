@@ -0,0 +1,96 @@
+package fs
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"testing"
+)
+
+func Test_Variants(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	store := Variants(New(dir))
+
+	data := bytes.Repeat([]byte("body { color: red; }\n"), 100)
+
+	f, err := ReadFile("style.css", bytes.NewReader(data))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := store.Put(f)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := io.ReadAll(stored)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored.Close()
+
+	if !bytes.Equal(b, data) {
+		t.Fatal("unexpected content of stored file")
+	}
+
+	gz, err := OpenVariant(store, "style.css", "gzip")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gz.Close()
+
+	zr, err := gzip.NewReader(gz)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err = io.ReadAll(zr)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(b, data) {
+		t.Fatal("unexpected content of gzip variant")
+	}
+
+	if _, err := OpenVariant(store, "style.css", "br"); !errors.Is(err, ErrNotExist) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", ErrNotExist, err)
+	}
+
+	ents, err := ReadDir(store, ".")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ents) != 1 || ents[0].Name() != "style.css" {
+		t.Fatalf("unexpected entries %v\n", ents)
+	}
+
+	if err := store.Remove("style.css"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(dir + "/style.css.gz"); !errors.Is(err, ErrNotExist) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", ErrNotExist, err)
+	}
+}
+
+func Test_OpenVariantUnsupported(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	if _, err := OpenVariant(New(dir), "file", "gzip"); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", ErrUnsupported, err)
+	}
+}
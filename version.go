@@ -0,0 +1,476 @@
+package fs
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// versionsDir is the directory the older versions of files are kept in.
+const versionsDir = ".versions"
+
+// VersionFS is the interface implemented by a filesystem that keeps the older
+// versions of the files put in it.
+type VersionFS interface {
+	FS
+
+	// Versions returns the older versions of the named file, oldest first.
+	// The current version of the file is not included.
+	Versions(name string) ([]int, error)
+
+	// OpenVersion opens the given older version of the named file.
+	OpenVersion(name string, version int) (File, error)
+}
+
+// Versions returns the older versions of the named file in the given
+// filesystem, oldest first. If the filesystem does not implement VersionFS
+// then ErrUnsupported is returned in the *PathError.
+func Versions(s FS, name string) ([]int, error) {
+	vs, ok := s.(VersionFS)
+
+	if !ok {
+		return nil, &PathError{Op: "versions", Path: name, Err: ErrUnsupported}
+	}
+	return vs.Versions(name)
+}
+
+// OpenVersion opens the given older version of the named file in the given
+// filesystem. If the filesystem does not implement VersionFS then
+// ErrUnsupported is returned in the *PathError.
+func OpenVersion(s FS, name string, version int) (File, error) {
+	vs, ok := s.(VersionFS)
+
+	if !ok {
+		return nil, &PathError{Op: "openversion", Path: name, Err: ErrUnsupported}
+	}
+	return vs.OpenVersion(name, version)
+}
+
+type versionFS struct {
+	FS
+
+	keep int
+	mu   *sync.Mutex
+}
+
+// Versioned returns a filesystem that keeps the older versions of the files
+// put in it, up to the given number of versions for each file, or every
+// version if keep is 0. Older versions are kept in a ".versions" directory of
+// the filesystem, each as a patch against the version that replaced it, so a
+// version that changed little from the next takes up little space. Opening an
+// older version via OpenVersion applies each patch in turn to the current
+// version, and returns the version as a File read via ReadFile, which should
+// be given to Cleanup once done with.
+//
+// The versions directory is not listed by ReadDir, and removing a file
+// removes its older versions. The filesystem must implement ReadDirFS for the
+// older versions to be listed.
+func Versioned(s FS, keep int) FS {
+	return &versionFS{
+		FS:   s,
+		keep: keep,
+		mu:   &sync.Mutex{},
+	}
+}
+
+func (s *versionFS) Unwrap() FS { return s.FS }
+
+func (s *versionFS) Sub(dir string) (FS, error) {
+	sub, err := s.FS.Sub(dir)
+
+	if err != nil {
+		return nil, err
+	}
+	return Versioned(sub, s.keep), nil
+}
+
+func versionName(name string, version int) string {
+	return versionsDir + "/" + name + "/" + strconv.Itoa(version)
+}
+
+func (s *versionFS) Versions(name string) ([]int, error) {
+	ents, err := ReadDir(s.FS, versionsDir+"/"+name)
+
+	if err != nil {
+		if errors.Is(err, ErrNotExist) {
+			return []int{}, nil
+		}
+		return nil, err
+	}
+
+	versions := make([]int, 0, len(ents))
+
+	for _, ent := range ents {
+		v, err := strconv.Atoi(ent.Name())
+
+		if err != nil || ent.IsDir() {
+			continue
+		}
+		versions = append(versions, v)
+	}
+
+	sort.Ints(versions)
+	return versions, nil
+}
+
+func (s *versionFS) OpenVersion(name string, version int) (File, error) {
+	versions, err := s.Versions(name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	i := sort.SearchInts(versions, version)
+
+	if i == len(versions) || versions[i] != version {
+		return nil, &PathError{Op: "openversion", Path: name, Err: ErrNotExist}
+	}
+
+	cur, err := s.FS.Open(name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer cur.Close()
+
+	f, err := ReadFile(name, cur)
+
+	if err != nil {
+		return nil, &PathError{Op: "openversion", Path: name, Err: err}
+	}
+
+	// Each patch is against the version after it, so they are applied from
+	// the newest back to the version asked for.
+	for j := len(versions) - 1; j >= i; j-- {
+		next, err := s.applyPatch(f, name, versions[j])
+
+		Cleanup(f)
+
+		if err != nil {
+			return nil, err
+		}
+		f = next
+	}
+	return f, nil
+}
+
+// applyPatch returns the given version of the named file, built from the
+// patch of that version against the given file.
+func (s *versionFS) applyPatch(f File, name string, version int) (File, error) {
+	patch, err := s.FS.Open(versionName(name, version))
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer patch.Close()
+
+	r := &patchReader{
+		base:  unwrapFile(f).(io.ReaderAt),
+		patch: bufio.NewReader(patch),
+	}
+
+	next, err := ReadFile(name, r)
+
+	if err != nil {
+		return nil, &PathError{Op: "openversion", Path: name, Err: err}
+	}
+	return next, nil
+}
+
+// patchReader reads the file built from a patch against the base file. A
+// patch is a sequence of ranges, each either a copy of a range of the base
+// file, or data held in the patch.
+type patchReader struct {
+	base  io.ReaderAt
+	patch *bufio.Reader
+	cur   io.Reader
+}
+
+const (
+	patchCopy byte = 'c'
+	patchData byte = 'd'
+)
+
+func (r *patchReader) next() error {
+	op, err := r.patch.ReadByte()
+
+	if err != nil {
+		return err
+	}
+
+	switch op {
+	case patchCopy:
+		var hdr [2]int64
+
+		if err := binary.Read(r.patch, binary.BigEndian, &hdr); err != nil {
+			return io.ErrUnexpectedEOF
+		}
+		r.cur = io.NewSectionReader(r.base, hdr[0], hdr[1])
+	case patchData:
+		var n int64
+
+		if err := binary.Read(r.patch, binary.BigEndian, &n); err != nil {
+			return io.ErrUnexpectedEOF
+		}
+		r.cur = io.LimitReader(r.patch, n)
+	default:
+		return ErrInvalid
+	}
+	return nil
+}
+
+func (r *patchReader) Read(p []byte) (int, error) {
+	for {
+		if r.cur != nil {
+			n, err := r.cur.Read(p)
+
+			if n > 0 {
+				return n, nil
+			}
+
+			if err != nil && !errors.Is(err, io.EOF) {
+				return 0, err
+			}
+			r.cur = nil
+		}
+
+		if err := r.next(); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// writePatch writes the given ranges as a patch, the copies being of ranges of
+// the file the patch is against.
+func writePatch(w io.Writer, ranges []Range) error {
+	bw := bufio.NewWriter(w)
+
+	for _, rng := range ranges {
+		if rng.Data == nil {
+			bw.WriteByte(patchCopy)
+
+			if err := binary.Write(bw, binary.BigEndian, [2]int64{rng.Src, rng.Len}); err != nil {
+				return err
+			}
+			continue
+		}
+
+		bw.WriteByte(patchData)
+
+		if err := binary.Write(bw, binary.BigEndian, rng.Len); err != nil {
+			return err
+		}
+
+		n, err := io.Copy(bw, io.LimitReader(rng.Data, rng.Len))
+
+		if err == nil && n != rng.Len {
+			err = io.ErrUnexpectedEOF
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// diff returns the patch of the old file against the new file, read via
+// ReadFile.
+func diff(name string, oldAt, newAt io.ReaderAt, oldSize, newSize int64) (File, error) {
+	blockSize := deltaBlockSize(newSize)
+
+	sums, err := ReadBlockSums(io.NewSectionReader(newAt, 0, newSize), blockSize)
+
+	if err != nil {
+		return nil, err
+	}
+
+	ranges, err := computeDelta(oldAt, oldSize, sums, blockSize)
+
+	if err != nil {
+		return nil, err
+	}
+
+	pr, pw := io.Pipe()
+
+	go func() {
+		pw.CloseWithError(writePatch(pw, ranges))
+	}()
+
+	f, err := ReadFile(name, pr)
+
+	// Unblock the writer if the patch was not read in full.
+	pr.Close()
+
+	return f, err
+}
+
+// readerAt returns the given file as an io.ReaderAt. If the file does not
+// implement io.ReaderAt then it is read via ReadFile, and the file read is
+// returned to be used in its place.
+func readerAt(f File) (io.ReaderAt, File, error) {
+	if ra, ok := unwrapFile(f).(io.ReaderAt); ok {
+		return ra, f, nil
+	}
+
+	info, err := f.Stat()
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	read, err := ReadFile(info.Name(), f)
+
+	if err != nil {
+		return nil, nil, err
+	}
+	return unwrapFile(read).(io.ReaderAt), read, nil
+}
+
+// Put puts the given file, keeping the file it replaces as a patch against
+// it. The patch is made before the file is put, but only stored after, so if
+// the file cannot be put then no version is kept.
+func (s *versionFS) Put(f File) (File, error) {
+	info, err := f.Stat()
+
+	if err != nil {
+		return nil, err
+	}
+
+	name := info.Name()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old, err := s.FS.Open(name)
+
+	if err != nil {
+		if errors.Is(err, ErrNotExist) {
+			return s.FS.Put(f)
+		}
+		return nil, err
+	}
+
+	defer old.Close()
+
+	oldInfo, err := old.Stat()
+
+	if err != nil {
+		return nil, err
+	}
+
+	oldAt, oldRead, err := readerAt(old)
+
+	if err != nil {
+		return nil, &PathError{Op: "put", Path: name, Err: err}
+	}
+
+	if oldRead != old {
+		defer Cleanup(oldRead)
+	}
+
+	newAt, newRead, err := readerAt(f)
+
+	if err != nil {
+		return nil, &PathError{Op: "put", Path: name, Err: err}
+	}
+
+	if newRead != f {
+		defer Cleanup(newRead)
+	}
+
+	newInfo, err := newRead.Stat()
+
+	if err != nil {
+		return nil, err
+	}
+
+	patch, err := diff(name, oldAt, newAt, oldInfo.Size(), newInfo.Size())
+
+	if err != nil {
+		return nil, &PathError{Op: "put", Path: name, Err: err}
+	}
+
+	defer Cleanup(patch)
+
+	versions, err := s.Versions(name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	version := 1
+
+	if n := len(versions); n > 0 {
+		version = versions[n-1] + 1
+	}
+
+	stored, err := s.FS.Put(newRead)
+
+	if err != nil {
+		return nil, err
+	}
+
+	kept, err := PutPath(s.FS, versionName(name, version), patch)
+
+	if err != nil {
+		stored.Close()
+		return nil, err
+	}
+	kept.Close()
+
+	if s.keep > 0 {
+		versions = append(versions, version)
+
+		for len(versions) > s.keep {
+			if err := s.FS.Remove(versionName(name, versions[0])); err != nil && !errors.Is(err, ErrNotExist) {
+				stored.Close()
+				return nil, err
+			}
+			versions = versions[1:]
+		}
+	}
+	return stored, nil
+}
+
+func (s *versionFS) ReadDir(name string) ([]DirEntry, error) {
+	ents, err := ReadDir(s.FS, name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if name == "." {
+		ents = hideDir(ents, versionsDir)
+	}
+	return ents, nil
+}
+
+// Remove removes the named file along with its older versions.
+func (s *versionFS) Remove(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.FS.Remove(name); err != nil {
+		return err
+	}
+
+	versions, err := s.Versions(name)
+
+	if err != nil {
+		return err
+	}
+
+	for _, v := range versions {
+		if err := s.FS.Remove(versionName(name, v)); err != nil && !errors.Is(err, ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package fs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"os"
+	"testing"
+)
+
+func Test_Versioned(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	store := Versioned(New(dir), 3)
+
+	put := func(data []byte) {
+		f, err := ReadFile("disk.img", bytes.NewReader(data))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer Cleanup(f)
+
+		stored, err := store.Put(f)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+		stored.Close()
+	}
+
+	base := make([]byte, 256<<10)
+	rand.New(rand.NewSource(1)).Read(base)
+
+	contents := make([][]byte, 0)
+
+	for i := 0; i < 5; i++ {
+		b := append(base[:0:0], base...)
+		copy(b[i*40000:], "version")
+
+		b = append(b, bytes.Repeat([]byte{byte(i)}, i*1000)...)
+
+		contents = append(contents, b)
+		put(b)
+	}
+
+	versions, err := Versions(store, "disk.img")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []int{2, 3, 4}
+
+	if len(versions) != len(expected) {
+		t.Fatalf("unexpected versions, expected=%v, got=%v\n", expected, versions)
+	}
+
+	for i, v := range expected {
+		if versions[i] != v {
+			t.Fatalf("unexpected versions, expected=%v, got=%v\n", expected, versions)
+		}
+	}
+
+	for _, v := range versions {
+		f, err := OpenVersion(store, "disk.img", v)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := io.ReadAll(f)
+		Cleanup(f)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Version n is the content put n times ago, counting from 1.
+		if want := contents[v-1]; !bytes.Equal(b, want) {
+			t.Fatalf("version %d - unexpected content, expected=%d bytes, got=%d bytes\n", v, len(want), len(b))
+		}
+
+		// Each version is stored as a patch, which is much smaller than
+		// the file itself.
+		info, err := os.Stat(dir + "/" + versionName("disk.img", v))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if info.Size() > int64(len(base))/10 {
+			t.Fatalf("version %d - unexpected patch size, expected<%d, got=%d\n", v, len(base)/10, info.Size())
+		}
+	}
+
+	if _, err := OpenVersion(store, "disk.img", 1); !errors.Is(err, ErrNotExist) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", ErrNotExist, err)
+	}
+
+	ents, err := ReadDir(store, ".")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ents) != 1 || ents[0].Name() != "disk.img" {
+		t.Fatalf("unexpected entries, expected=%d, got=%d\n", 1, len(ents))
+	}
+
+	if err := store.Remove("disk.img"); err != nil {
+		t.Fatal(err)
+	}
+
+	versions, err = Versions(store, "disk.img")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(versions) != 0 {
+		t.Fatalf("unexpected versions, expected=%v, got=%v\n", []int{}, versions)
+	}
+}
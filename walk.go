@@ -0,0 +1,50 @@
+package fs
+
+import (
+	"io/fs"
+)
+
+type (
+	DirEntry = fs.DirEntry
+	WalkFunc = fs.WalkDirFunc
+)
+
+// SkipDir can be returned from a WalkFunc to skip the directory being walked.
+var SkipDir = fs.SkipDir
+
+// ReadDirFS is the interface implemented by a filesystem that can list the
+// contents of a directory.
+type ReadDirFS interface {
+	FS
+
+	// ReadDir reads the named directory and returns a list of directory
+	// entries sorted by filename.
+	ReadDir(name string) ([]DirEntry, error)
+}
+
+// ReadDir reads the named directory from the given filesystem. If the
+// filesystem does not implement ReadDirFS then ErrUnsupported is returned in
+// the *PathError.
+func ReadDir(s FS, name string) ([]DirEntry, error) {
+	rd, ok := s.(ReadDirFS)
+
+	if !ok {
+		return nil, &PathError{Op: "readdir", Path: name, Err: ErrUnsupported}
+	}
+	return rd.ReadDir(name)
+}
+
+type walkFS struct {
+	FS
+}
+
+func (s walkFS) ReadDir(name string) ([]DirEntry, error) {
+	return ReadDir(s.FS, name)
+}
+
+// Walk walks the file tree rooted at root in the given filesystem, calling fn
+// for each file or directory in the tree, including root. This has the same
+// semantics as fs.WalkDir from io/fs. The filesystem must implement ReadDirFS.
+func Walk(s FS, root string, fn WalkFunc) error {
+	return fs.WalkDir(walkFS{FS: s}, root, fn)
+}
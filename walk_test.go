@@ -0,0 +1,52 @@
+package fs
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func Test_Walk(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"a", "dir/b", "dir/sub/c"} {
+		path := filepath.Join(dir, name)
+
+		if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := []string{".", "a", "dir", "dir/b", "dir/sub", "dir/sub/c"}
+	walked := make([]string, 0, len(expected))
+
+	err := Walk(New(dir), ".", func(name string, d DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		walked = append(walked, name)
+		return nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(expected, walked) {
+		t.Fatalf("unexpected walk, expected=%v, got=%v\n", expected, walked)
+	}
+
+	err = Walk(WriteOnly(New(dir)), ".", func(name string, d DirEntry, err error) error {
+		return err
+	})
+
+	if !errors.Is(err, ErrPermission) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", ErrPermission, err)
+	}
+}
@@ -0,0 +1,102 @@
+package fs
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Event is a change to a watched file.
+type Event struct {
+	Name string
+
+	// Removed is whether the file no longer exists.
+	Removed bool
+
+	// Err is the error that occurred checking the file for changes, if any.
+	Err error
+}
+
+// WatchFS is the interface implemented by a filesystem that can notify of
+// changes to the files stored in it.
+type WatchFS interface {
+	FS
+
+	// Watch sends an Event each time the named file is put or removed,
+	// until the given context is done, at which point the channel is
+	// closed.
+	Watch(ctx context.Context, name string) (<-chan Event, error)
+}
+
+// Watch watches the named file in the given filesystem for changes until the
+// given context is done, at which point the returned channel is closed. If the
+// filesystem implements WatchFS then it is used, otherwise the file is polled
+// every interval, and an Event is sent when its size or modification time
+// change, or it is put or removed.
+func Watch(ctx context.Context, s FS, name string, interval time.Duration) (<-chan Event, error) {
+	if ws, ok := s.(WatchFS); ok {
+		return ws.Watch(ctx, name)
+	}
+
+	prev, err := s.Stat(name)
+
+	if err != nil {
+		if !errors.Is(err, ErrNotExist) {
+			return nil, err
+		}
+		prev = nil
+	}
+
+	ch := make(chan Event)
+
+	go func() {
+		defer close(ch)
+
+		t := time.NewTicker(interval)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+			}
+
+			info, err := s.Stat(name)
+
+			if err != nil {
+				if !errors.Is(err, ErrNotExist) {
+					select {
+					case ch <- Event{Name: name, Err: err}:
+					case <-ctx.Done():
+						return
+					}
+					continue
+				}
+				info = nil
+			}
+
+			if !changed(prev, info) {
+				continue
+			}
+
+			prev = info
+
+			select {
+			case ch <- Event{Name: name, Removed: info == nil}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// changed reports whether a polled file has changed, where a nil FileInfo is a
+// file that does not exist.
+func changed(prev, cur FileInfo) bool {
+	if prev == nil || cur == nil {
+		return prev != cur
+	}
+	return prev.Size() != cur.Size() || !prev.ModTime().Equal(cur.ModTime())
+}
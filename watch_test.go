@@ -0,0 +1,64 @@
+package fs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_Watch(t *testing.T) {
+	dir := tmpdir(t)
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch, err := Watch(ctx, New(dir), "app.json", 10*time.Millisecond)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	next := func() Event {
+		select {
+		case ev := <-ch:
+			return ev
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for event\n")
+		}
+		return Event{}
+	}
+
+	name := filepath.Join(dir, "app.json")
+
+	if err := os.WriteFile(name, []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if ev := next(); ev.Name != "app.json" || ev.Removed {
+		t.Fatalf("unexpected event, expected=%q, got=%+v\n", "app.json", ev)
+	}
+
+	if err := os.WriteFile(name, []byte(`{"debug":true}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if ev := next(); ev.Removed {
+		t.Fatalf("unexpected event, expected=%v, got=%v\n", false, ev.Removed)
+	}
+
+	if err := os.Remove(name); err != nil {
+		t.Fatal(err)
+	}
+
+	if ev := next(); !ev.Removed {
+		t.Fatalf("unexpected event, expected=%v, got=%v\n", true, ev.Removed)
+	}
+
+	cancel()
+
+	for range ch {
+	}
+}
@@ -0,0 +1,108 @@
+package fs
+
+import (
+	"bytes"
+	"errors"
+	"syscall"
+)
+
+// xattrPrefix is the namespace metadata is stored in, which unprivileged
+// processes can read and write.
+const xattrPrefix = "user."
+
+func xattrErr(err error) error {
+	if errors.Is(err, syscall.ENOTSUP) {
+		return ErrUnsupported
+	}
+	if errors.Is(err, syscall.ENOENT) {
+		return ErrNotExist
+	}
+	return err
+}
+
+func getxattr(path, attr string) ([]byte, error) {
+	for {
+		n, err := syscall.Getxattr(path, attr, nil)
+
+		if err != nil {
+			return nil, xattrErr(err)
+		}
+
+		buf := make([]byte, n)
+
+		n, err = syscall.Getxattr(path, attr, buf)
+
+		if err != nil {
+			// The attribute grew between the calls, so try again.
+			if errors.Is(err, syscall.ERANGE) {
+				continue
+			}
+			return nil, xattrErr(err)
+		}
+		return buf[:n], nil
+	}
+}
+
+func getxattrs(path string) (Metadata, error) {
+	var names []byte
+
+	for {
+		n, err := syscall.Listxattr(path, nil)
+
+		if err != nil {
+			return nil, xattrErr(err)
+		}
+
+		names = make([]byte, n)
+
+		n, err = syscall.Listxattr(path, names)
+
+		if err != nil {
+			if errors.Is(err, syscall.ERANGE) {
+				continue
+			}
+			return nil, xattrErr(err)
+		}
+
+		names = names[:n]
+		break
+	}
+
+	md := make(Metadata)
+
+	for _, name := range bytes.Split(names, []byte{0}) {
+		if !bytes.HasPrefix(name, []byte(xattrPrefix)) {
+			continue
+		}
+
+		attr := string(name)
+
+		val, err := getxattr(path, attr)
+
+		if err != nil {
+			// Removed between listing and reading.
+			if errors.Is(err, syscall.ENODATA) {
+				continue
+			}
+			return nil, err
+		}
+		md[attr[len(xattrPrefix):]] = string(val)
+	}
+	return md, nil
+}
+
+func setxattr(path, key, val string) error {
+	attr := xattrPrefix + key
+
+	if val == "" {
+		if err := syscall.Removexattr(path, attr); err != nil && !errors.Is(err, syscall.ENODATA) {
+			return xattrErr(err)
+		}
+		return nil
+	}
+
+	if err := syscall.Setxattr(path, attr, []byte(val), 0); err != nil {
+		return xattrErr(err)
+	}
+	return nil
+}
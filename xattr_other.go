@@ -0,0 +1,7 @@
+//go:build !linux
+
+package fs
+
+func getxattrs(string) (Metadata, error) { return nil, ErrUnsupported }
+
+func setxattr(string, string, string) error { return ErrUnsupported }